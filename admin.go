@@ -0,0 +1,206 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+type descriptorVersionsResponse struct {
+	DescriptorID string                   `json:"descriptor_id"`
+	Versions     []core.DescriptorVersion `json:"versions"`
+}
+
+type descriptorRollbackRequest struct {
+	DescriptorID string `json:"descriptor_id"`
+	Version      int    `json:"version"`
+}
+
+// Caches of the cache flush admin route.
+const (
+	cacheDescriptors = "descriptors" // inline descriptors cached under descriptor_ids
+	cacheMethods     = "methods"     // methods resolved from the descriptor directory and embedded descriptors
+	cacheConnections = "connections" // pooled upstream connections
+	cacheIdempotency = "idempotency" // results stored under Idempotency-Keys, see IdempotencyFlusher
+)
+
+type cacheFlushRequest struct {
+	Caches       []string `json:"caches"`        // empty means all but idempotency
+	DescriptorID string   `json:"descriptor_id"` // limits descriptors to this id
+	Target       string   `json:"target"`        // limits connections to this target
+}
+
+type cacheFlushResponse struct {
+	Flushed map[string]int `json:"flushed"` // entries dropped by cache
+}
+
+// serveAdmin handles the admin routes below {Path}/admin, scoped to the caller's descriptor namespace:
+//
+//	GET  /descriptors/versions?descriptor_id=ID  retained versions of a descriptor_id
+//	POST /descriptors/rollback                   {"descriptor_id": ID, "version": N} makes version N current
+//	GET  /usage[?client=KEY]                     quota usage per hashed client key (Options.Quota)
+//	POST /reload                                 reloads the configuration through Options.Reload
+//	POST /cache/flush                            clears descriptors, methods, connections or idempotency results; see flushCaches
+//	*    /kill-switches                          methods and targets disabled during incidents, see serveKillSwitches
+//	*    /mocks                                  runtime toggles of method mocks (MethodConfig.Mock), see serveMocks
+//	*    /faults                                 injected delays and aborts (Options.Faults), see serveFaults
+//	GET  /debug/pprof/..., /debug/vars           runtime profiles and statistics (Options.Profiling, see serveProfiling)
+//
+// Every admin request needs Options.AdminToken in the X-Gateway-Admin-Token header; without a configured
+// token the routes do not exist.
+func (h *handler) serveAdmin(w http.ResponseWriter, r *http.Request, rel string) {
+	token := h.live.Load().opts.AdminToken
+	if token == "" {
+		h.rejectRoute(w, r, "")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(adminTokenHeader)), []byte(token)) != 1 {
+		h.writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "admin request requires a valid "+adminTokenHeader+" header")
+		return
+	}
+	var namespace string
+	if h.opts.DescriptorNamespace != nil {
+		namespace = h.opts.DescriptorNamespace(r)
+	}
+	if hasNUL(namespace, r.URL.Query().Get("descriptor_id")) {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, errNULInDescriptorKey)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(rel, "/debug/") && h.opts.Profiling:
+		h.serveProfiling(w, r, rel)
+	case rel == "/kill-switches":
+		h.serveKillSwitches(w, r)
+	case rel == "/mocks":
+		h.serveMocks(w, r)
+	case rel == "/faults":
+		h.serveFaults(w, r)
+	case rel == "/descriptors/versions" && r.Method == http.MethodGet:
+		h.writeDescriptorVersions(w, r, namespace, r.URL.Query().Get("descriptor_id"))
+	case rel == "/descriptors/rollback" && r.Method == http.MethodPost:
+		var req descriptorRollbackRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+		if hasNUL(req.DescriptorID) {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, errNULInDescriptorKey)
+			return
+		}
+		if req.DescriptorID == "" || req.Version <= 0 {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "descriptor_id and a positive version are required")
+			return
+		}
+		if err := h.inv.RollbackDescriptor(namespace, req.DescriptorID, req.Version); err != nil {
+			h.writeError(w, r, http.StatusNotFound, ErrCodeNotFound, err.Error())
+			return
+		}
+		h.writeDescriptorVersions(w, r, namespace, req.DescriptorID)
+	case rel == "/usage" && r.Method == http.MethodGet && h.quota != nil:
+		now := core.ClockFromContext(r.Context(), h.opts.Clock).Now()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(h.quota.usageResponse(r.URL.Query().Get("client"), now))
+	case rel == "/reload" && r.Method == http.MethodPost && h.opts.Reload != nil:
+		if err := h.reload(); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"reloaded":true}`))
+	case rel == "/cache/flush" && r.Method == http.MethodPost:
+		h.flushCaches(w, r, namespace)
+	case rel == "/descriptors/versions", rel == "/usage" && h.quota != nil:
+		h.rejectRoute(w, r, http.MethodGet)
+	case rel == "/descriptors/rollback", rel == "/cache/flush", rel == "/reload" && h.opts.Reload != nil:
+		h.rejectRoute(w, r, http.MethodPost)
+	default:
+		h.rejectRoute(w, r, "")
+	}
+}
+
+func (h *handler) writeDescriptorVersions(w http.ResponseWriter, r *http.Request, namespace, descriptorID string) {
+	if descriptorID == "" {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "missing descriptor_id")
+		return
+	}
+	versions, ok := h.inv.DescriptorVersions(namespace, descriptorID)
+	if !ok {
+		h.writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "descriptor not found for id "+descriptorID)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(descriptorVersionsResponse{DescriptorID: descriptorID, Versions: versions})
+}
+
+// flushCaches clears the caches selected by the cacheFlushRequest body (all without a body), so operators can
+// drop poisoned or stale state without a restart: the caller's cached descriptors (or one descriptor_id),
+// the methods of the descriptor directory, and the pooled connections (or those to one target). The results
+// stored under the caller's Idempotency-Keys are only dropped when named, since clients retrying after a
+// flush execute their calls again.
+func (h *handler) flushCaches(w http.ResponseWriter, r *http.Request, namespace string) {
+	var req cacheFlushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if hasNUL(req.DescriptorID) {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, errNULInDescriptorKey)
+		return
+	}
+	caches := req.Caches
+	if len(caches) == 0 {
+		caches = []string{cacheDescriptors, cacheMethods, cacheConnections}
+	}
+	var idempotency IdempotencyFlusher
+	for _, c := range caches {
+		switch c {
+		case cacheDescriptors, cacheMethods, cacheConnections:
+		case cacheIdempotency:
+			var ok bool
+			if h.opts.Idempotency == nil {
+				h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "idempotency is not enabled")
+				return
+			}
+			if idempotency, ok = h.opts.Idempotency.Store.(IdempotencyFlusher); !ok {
+				h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "the idempotency store cannot be flushed")
+				return
+			}
+		default:
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("unknown cache %q; want %s, %s, %s or %s", c, cacheDescriptors, cacheMethods, cacheConnections, cacheIdempotency))
+			return
+		}
+	}
+
+	resp := cacheFlushResponse{Flushed: make(map[string]int, len(caches))}
+	for _, c := range caches {
+		var n int
+		switch c {
+		case cacheDescriptors:
+			n = h.inv.FlushDescriptors(namespace, req.DescriptorID)
+		case cacheMethods:
+			n = h.inv.FlushMethods()
+		case cacheConnections:
+			n = h.inv.FlushConnections(req.Target)
+		case cacheIdempotency:
+			var err error
+			if n, err = idempotency.Flush(r.Context(), h.idempotencyKeyPrefix(namespace)); err != nil {
+				h.writeError(w, r, http.StatusServiceUnavailable, ErrCodeUnavailable, "idempotency store: "+err.Error())
+				return
+			}
+		}
+		resp.Flushed[c] = n
+		h.metrics.Add("gateway_cache_flushes_total", 1, "cache", c)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,274 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGateway_AdminDescriptorRollback(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	mux := http.NewServeMux()
+	h := Handler(Options{Timeout: 5 * time.Second, Path: "/grpc-gateway", AdminToken: "s3cret"})
+	mux.Handle("/grpc-gateway", h)
+	mux.Handle("/grpc-gateway/", h)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// v1: the echo descriptor; v2: echo merged with an unrelated file.
+	extra, err := builder.NewFile("extra.proto").SetPackageName("extra").AddMessage(builder.NewMessage("Note")).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	extraSet, _ := proto.Marshal(desc.ToFileDescriptorSet(extra))
+	for _, body := range []map[string]any{
+		{"descriptor": base64.StdEncoding.EncodeToString(mustReadDescriptor(t))},
+		{"descriptor": base64.StdEncoding.EncodeToString(extraSet), "descriptor_merge": true},
+	} {
+		body["target"], body["method"], body["descriptor_id"] = target, "/echo.EchoService/Echo", "echo"
+		if code, b := postGateway(t, srv.URL+"/grpc-gateway", body, nil); code != http.StatusOK {
+			t.Fatalf("upload: %d %s", code, b)
+		}
+	}
+
+	admin := func(method, path string, body any, token string) (int, descriptorVersionsResponse) {
+		t.Helper()
+		var raw []byte
+		if body != nil {
+			raw, _ = json.Marshal(body)
+		}
+		req, _ := http.NewRequest(method, srv.URL+"/grpc-gateway/admin"+path, bytes.NewReader(raw))
+		req.Header.Set("X-Gateway-Admin-Token", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("admin %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var out descriptorVersionsResponse
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	if code, _ := admin(http.MethodGet, "/descriptors/versions?descriptor_id=echo", nil, "wrong"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 without valid token, got %d", code)
+	}
+	code, out := admin(http.MethodGet, "/descriptors/versions?descriptor_id=echo", nil, "s3cret")
+	if code != http.StatusOK || len(out.Versions) != 2 || !out.Versions[1].Current {
+		t.Fatalf("versions: %d %+v", code, out)
+	}
+
+	code, out = admin(http.MethodPost, "/descriptors/rollback", descriptorRollbackRequest{DescriptorID: "echo", Version: 1}, "s3cret")
+	if code != http.StatusOK || !out.Versions[0].Current || out.Versions[1].Current {
+		t.Fatalf("rollback: %d %+v", code, out)
+	}
+
+	// Both the current (rolled back) and pinned versions still serve calls.
+	for _, id := range []string{"echo", "echo@v2"} {
+		code, b := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{
+			"target": target, "method": "/echo.EchoService/Echo", "descriptor_id": id, "params": map[string]any{"message": "hi"},
+		}, nil)
+		if code != http.StatusOK {
+			t.Fatalf("call %s: %d %s", id, code, b)
+		}
+	}
+}
+
+func TestGateway_AdminDisabledWithoutToken(t *testing.T) {
+	mux := http.NewServeMux()
+	h := Handler(Options{Path: "/grpc-gateway"})
+	mux.Handle("/grpc-gateway/", h)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/grpc-gateway/admin/descriptors/versions?descriptor_id=echo")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestGateway_AdminProfiling(t *testing.T) {
+	metrics := core.NewMemoryMetrics()
+	metrics.Add("gateway_requests_total", 1)
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", AdminToken: "s3cret", Profiling: true, Metrics: metrics}))
+	defer srv.Close()
+
+	get := func(path, token string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/grpc-gateway/admin"+path, nil)
+		req.Header.Set(adminTokenHeader, token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	if code, _ := get("/debug/pprof/", "wrong"); code != http.StatusForbidden {
+		t.Fatalf("without token: status=%d", code)
+	}
+	if code, body := get("/debug/pprof/", "s3cret"); code != http.StatusOK || !strings.Contains(body, "\tgoroutine\n") {
+		t.Fatalf("index: status=%d body=%s", code, body)
+	}
+	if code, body := get("/debug/pprof/goroutine?debug=1", "s3cret"); code != http.StatusOK || !strings.Contains(body, "goroutine profile:") {
+		t.Fatalf("goroutine: status=%d body=%.200s", code, body)
+	}
+	if code, body := get("/debug/pprof/heap", "s3cret"); code != http.StatusOK || len(body) == 0 {
+		t.Fatalf("heap: status=%d", code)
+	}
+	if code, body := get("/debug/pprof/profile?seconds=0.05", "s3cret"); code != http.StatusOK || len(body) == 0 {
+		t.Fatalf("cpu profile: status=%d body=%.200s", code, body)
+	}
+	if code, _ := get("/debug/pprof/nope", "s3cret"); code != http.StatusNotFound {
+		t.Fatalf("unknown profile: status=%d", code)
+	}
+	if code, _ := get("/debug/pprof/profile?seconds=-1", "s3cret"); code != http.StatusBadRequest {
+		t.Fatalf("bad seconds: status=%d", code)
+	}
+	code, body := get("/debug/vars", "s3cret")
+	var vars varsResponse
+	if err := json.Unmarshal([]byte(body), &vars); code != http.StatusOK || err != nil || vars.Goroutines == 0 || vars.MemStats.HeapAlloc == 0 {
+		t.Fatalf("vars: status=%d err=%v body=%.200s", code, err, body)
+	}
+	if vars.Metrics[core.MetricKey("gateway_requests_total")] != 1 {
+		t.Fatalf("vars metrics = %v", vars.Metrics)
+	}
+
+	// Without Options.Profiling the routes do not exist.
+	off := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", AdminToken: "s3cret"}))
+	defer off.Close()
+	req, _ := http.NewRequest(http.MethodGet, off.URL+"/grpc-gateway/admin/debug/pprof/", nil)
+	req.Header.Set(adminTokenHeader, "s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("profiling disabled: status=%d", resp.StatusCode)
+	}
+}
+
+func TestGateway_AdminCacheFlush(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	metrics := core.NewMemoryMetrics()
+	srv := httptest.NewServer(Handler(Options{
+		Timeout: 5 * time.Second, Path: "/grpc-gateway", AdminToken: "s3cret", Metrics: metrics,
+		// Leave out the directory, whose embedded echo set would otherwise answer unknown descriptor_ids.
+		DescriptorLayers: []core.DescriptorLayer{core.LayerCache, core.LayerRegistry},
+	}))
+	defer srv.Close()
+
+	call := func(body map[string]any) int {
+		body["target"], body["method"], body["descriptor_id"] = target, "/echo.EchoService/Echo", "echo"
+		code, _ := postGateway(t, srv.URL+"/grpc-gateway", body, nil)
+		return code
+	}
+	if code := call(map[string]any{"descriptor": base64.StdEncoding.EncodeToString(mustReadDescriptor(t))}); code != http.StatusOK {
+		t.Fatalf("upload: %d", code)
+	}
+
+	flush := func(method string, body string) (int, cacheFlushResponse) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+"/grpc-gateway/admin/cache/flush", strings.NewReader(body))
+		req.Header.Set("X-Gateway-Admin-Token", "s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("flush: %v", err)
+		}
+		defer resp.Body.Close()
+		var out cacheFlushResponse
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	code, out := flush(http.MethodPost, `{"caches":["descriptors","connections"],"target":"`+target+`"}`)
+	if code != http.StatusOK || out.Flushed["descriptors"] != 1 || out.Flushed["connections"] != 1 || len(out.Flushed) != 2 {
+		t.Fatalf("flush: %d %+v", code, out)
+	}
+	if got := metrics.Get("gateway_cache_flushes_total", "cache", "descriptors"); got != 1 {
+		t.Fatalf("flush metric = %v", got)
+	}
+
+	// The descriptor_id is gone; uploading it again works over a fresh connection.
+	if code := call(map[string]any{}); code == http.StatusOK {
+		t.Fatal("flushed descriptor_id still resolves")
+	}
+	if code := call(map[string]any{"descriptor": base64.StdEncoding.EncodeToString(mustReadDescriptor(t))}); code != http.StatusOK {
+		t.Fatalf("upload after flush: %d", code)
+	}
+
+	// Without a body, every cache is flushed.
+	if code, out := flush(http.MethodPost, ""); code != http.StatusOK || out.Flushed["descriptors"] != 1 || len(out.Flushed) != 3 {
+		t.Fatalf("flush all: %d %+v", code, out)
+	}
+	if code, _ := flush(http.MethodPost, `{"caches":["responses"]}`); code != http.StatusBadRequest {
+		t.Fatalf("unknown cache: %d", code)
+	}
+	if code, _ := flush(http.MethodGet, ""); code != http.StatusNotFound {
+		t.Fatalf("GET: %d", code)
+	}
+}
+
+func TestGateway_AdminCacheFlushIdempotency(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", AdminToken: "s3cret", Idempotency: &IdempotencyConfig{Store: NewMemoryIdempotencyStore()}}))
+	defer srv.Close()
+	plain := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", AdminToken: "s3cret"}))
+	defer plain.Close()
+
+	call := func(msg string) int {
+		t.Helper()
+		code, _ := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": msg}}, map[string]string{"Idempotency-Key": "k1"})
+		return code
+	}
+	flush := func(url string) (int, cacheFlushResponse) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, url+"/grpc-gateway/admin/cache/flush", strings.NewReader(`{"caches":["idempotency"]}`))
+		req.Header.Set(adminTokenHeader, "s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("flush: %v", err)
+		}
+		defer resp.Body.Close()
+		var out cacheFlushResponse
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	if code := call("charge"); code != http.StatusOK {
+		t.Fatalf("first call: %d", code)
+	}
+	if code := call("other"); code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key before flush: %d", code)
+	}
+	if code, out := flush(srv.URL); code != http.StatusOK || out.Flushed["idempotency"] != 1 || len(out.Flushed) != 1 {
+		t.Fatalf("flush: %d %+v", code, out)
+	}
+	if code := call("other"); code != http.StatusOK {
+		t.Fatalf("reused key after flush: %d", code)
+	}
+	if code, _ := flush(plain.URL); code != http.StatusBadRequest {
+		t.Fatalf("flush without idempotency: %d", code)
+	}
+}
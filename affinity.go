@@ -0,0 +1,28 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// AffinityConfig selects the affinity key of a method's calls (MethodConfig.Affinity), see
+// core.InvokeRequest.AffinityKey.
+type AffinityConfig struct {
+	// Header names the request header whose value is the key, e.g. "X-User-Id".
+	Header string
+	// Field is a dotted request field path (JSON or proto names) whose value is the key, e.g. "user_id",
+	// used when Header is empty or absent from the request.
+	Field string
+}
+
+// apply sets the affinity key of the call of r on req.
+func (a *AffinityConfig) apply(r *http.Request, req *core.InvokeRequest) {
+	if a == nil {
+		return
+	}
+	if a.Header != "" {
+		req.AffinityKey = r.Header.Get(a.Header)
+	}
+	req.AffinityField = a.Field
+}
@@ -0,0 +1,27 @@
+package gateway
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+func TestAffinityConfig_Apply(t *testing.T) {
+	a := &AffinityConfig{Header: "X-User-Id", Field: "user_id"}
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("X-User-Id", "u-42")
+	var req core.InvokeRequest
+	a.apply(r, &req)
+	if req.AffinityKey != "u-42" || req.AffinityField != "user_id" {
+		t.Fatalf("with header: %q %q", req.AffinityKey, req.AffinityField)
+	}
+
+	// Without the header the invoker falls back to the field.
+	req = core.InvokeRequest{}
+	a.apply(httptest.NewRequest("POST", "/", nil), &req)
+	if req.AffinityKey != "" || req.AffinityField != "user_id" {
+		t.Fatalf("without header: %q %q", req.AffinityKey, req.AffinityField)
+	}
+	(*AffinityConfig)(nil).apply(r, &req) // methods without affinity
+}
@@ -0,0 +1,266 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AsyncConfig enables fire-and-forget invocation for methods with MethodConfig.Async: the call is validated,
+// persisted to Queue and acknowledged with 202 Accepted; background workers invoke the upstream later.
+type AsyncConfig struct {
+	// Queue stores accepted calls until a worker has processed them; see AsyncQueue.
+	Queue AsyncQueue
+	// Workers is the number of background workers; default 1.
+	Workers int
+	// MaxAttempts bounds upstream attempts per job for transient failures (Unavailable, DeadlineExceeded,
+	// ResourceExhausted, Aborted); default 5. Other failures are final.
+	MaxAttempts int
+	// Backoff spaces the attempts; the zero value uses core.Backoff defaults.
+	Backoff core.Backoff
+	// OnResult, if set, is called once per job with the upstream response or the final error, e.g. to publish
+	// results or dead-letter failed jobs.
+	OnResult func(job *AsyncJob, response []byte, err error)
+}
+
+// AsyncJob is an accepted call as stored in an AsyncQueue.
+type AsyncJob struct {
+	ID             string              `json:"id"` // the request ID returned to the caller
+	Target         string              `json:"target"`
+	Namespace      string              `json:"namespace,omitempty"`
+	FullMethodName string              `json:"full_method_name,omitempty"`
+	ServiceName    string              `json:"service,omitempty"`
+	MethodName     string              `json:"method,omitempty"`
+	DescriptorID   string              `json:"descriptor_id,omitempty"`
+	Descriptor     []byte              `json:"descriptor,omitempty"` // inline FileDescriptorSet sent without a descriptor_id
+	Metadata       map[string][]string `json:"metadata,omitempty"`
+	Body           []byte              `json:"body"`
+	BodyFormat     core.BodyFormat     `json:"body_format,omitempty"`
+	ContentType    string              `json:"content_type,omitempty"` // of raw bodies, see core.InvokeRequest.HTTPBodyContentType
+	Timeout        time.Duration       `json:"timeout,omitempty"`
+	FetchAllPages  int                 `json:"fetch_all_pages,omitempty"`
+	EnqueuedAt     time.Time           `json:"enqueued_at"`
+
+	// How Body is decoded, as configured for the method when the call was accepted.
+	LenientEnums  bool                    `json:"lenient_enums,omitempty"`
+	UnknownFields core.UnknownFieldPolicy `json:"unknown_fields,omitempty"`
+	Defaults      map[string]any          `json:"defaults,omitempty"`
+	Overrides     map[string]any          `json:"overrides,omitempty"` // field bindings of Options.Routes
+	AffinityKey   string                  `json:"affinity_key,omitempty"`
+	AffinityField string                  `json:"affinity_field,omitempty"`
+}
+
+// AsyncQueue is the durable store behind async invocation. Implementations backed by Kafka, NATS JetStream
+// or SQS map Dequeue to consuming a message and Ack to committing it, so jobs survive gateway restarts.
+type AsyncQueue interface {
+	// Enqueue persists job; the caller is acknowledged only after it returns nil.
+	Enqueue(ctx context.Context, job *AsyncJob) error
+	// Dequeue blocks until a job is available. It returns ErrQueueClosed once the queue is shut down,
+	// which stops the workers.
+	Dequeue(ctx context.Context) (*AsyncJob, error)
+	// Ack marks job as processed (successfully or finally failed).
+	Ack(ctx context.Context, job *AsyncJob) error
+}
+
+var (
+	// ErrQueueClosed is returned by AsyncQueue.Dequeue after the queue is closed.
+	ErrQueueClosed = errors.New("async queue closed")
+	// ErrQueueFull is returned by AsyncQueue.Enqueue when the queue cannot take more jobs.
+	ErrQueueFull = errors.New("async queue full")
+)
+
+// MemoryQueue is an in-process AsyncQueue with bounded capacity. It is not durable: jobs are lost when the
+// process exits. Use it for development and tests.
+type MemoryQueue struct {
+	jobs      chan *AsyncJob
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemoryQueue returns a MemoryQueue holding up to capacity pending jobs.
+func NewMemoryQueue(capacity int) *MemoryQueue {
+	return &MemoryQueue{jobs: make(chan *AsyncJob, capacity), done: make(chan struct{})}
+}
+
+func (q *MemoryQueue) Enqueue(_ context.Context, job *AsyncJob) error {
+	select {
+	case <-q.done:
+		return ErrQueueClosed
+	default:
+	}
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (q *MemoryQueue) Dequeue(ctx context.Context) (*AsyncJob, error) {
+	select {
+	case job := <-q.jobs:
+		return job, nil
+	case <-q.done:
+		return nil, ErrQueueClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (q *MemoryQueue) Ack(context.Context, *AsyncJob) error { return nil }
+
+// Close stops the workers consuming q; pending jobs are dropped.
+func (q *MemoryQueue) Close() error {
+	q.closeOnce.Do(func() { close(q.done) })
+	return nil
+}
+
+type asyncAccepted struct {
+	JobID  string `json:"job_id"`
+	Status string `json:"status"`
+}
+
+// enqueue validates invokeReq (method, body, authorization) and stores it as a job instead of invoking it.
+func (h *handler) enqueue(ctx context.Context, w http.ResponseWriter, r *http.Request, requestID string, invokeReq core.InvokeRequest) {
+	invokeReq.ValidateOnly = true
+	if _, err := h.inv.Invoke(ctx, &invokeReq); err != nil {
+		var denied *authorizationError
+		if errors.As(err, &denied) {
+			h.writeError(w, r, denied.status, denied.code, denied.msg)
+			return
+		}
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	job := &AsyncJob{
+		ID:             requestID,
+		Target:         invokeReq.Target,
+		Namespace:      invokeReq.DescriptorNamespace,
+		FullMethodName: invokeReq.FullMethodName,
+		ServiceName:    invokeReq.ServiceName,
+		MethodName:     invokeReq.MethodName,
+		DescriptorID:   invokeReq.DescriptorID,
+		Metadata:       invokeReq.Metadata,
+		Body:           invokeReq.Body,
+		BodyFormat:     invokeReq.BodyFormat,
+		ContentType:    invokeReq.HTTPBodyContentType,
+		LenientEnums:   invokeReq.LenientEnums,
+		UnknownFields:  invokeReq.UnknownFields,
+		Defaults:       invokeReq.Defaults,
+		Overrides:      invokeReq.Overrides,
+		AffinityKey:    invokeReq.AffinityKey,
+		AffinityField:  invokeReq.AffinityField,
+		Timeout:        invokeReq.Timeout,
+		FetchAllPages:  invokeReq.FetchAllPages,
+		EnqueuedAt:     core.ClockFromContext(ctx, nil).Now(),
+	}
+	if job.DescriptorID == "" {
+		job.Descriptor = invokeReq.InlineDescriptorSet
+	}
+	if err := h.live.Load().opts.Async.Queue.Enqueue(ctx, job); err != nil {
+		h.writeError(w, r, http.StatusServiceUnavailable, ErrCodeUnavailable, "enqueue: "+err.Error())
+		return
+	}
+	h.metrics.Add("gateway_async_jobs_total", 1, "outcome", "accepted")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(asyncAccepted{JobID: job.ID, Status: "accepted"})
+}
+
+// startAsyncWorkers runs the workers of cfg until its queue is closed.
+func (h *handler) startAsyncWorkers(cfg AsyncConfig) {
+	for i := 0; i < max(cfg.Workers, 1); i++ {
+		go h.asyncWorker(cfg)
+	}
+}
+
+func (h *handler) asyncWorker(cfg AsyncConfig) {
+	for failures := 0; ; {
+		// The current options, not those at startup, so every job sees the latest reload.
+		opts := h.live.Load().opts
+		ctx := core.ContextWithClock(context.Background(), core.ClockFromContext(context.Background(), opts.Clock))
+		ctx = core.ContextWithRand(ctx, core.RandFromContext(ctx, opts.Rand))
+		job, err := cfg.Queue.Dequeue(ctx)
+		if errors.Is(err, ErrQueueClosed) {
+			return
+		}
+		if err != nil {
+			// The queue backend is unavailable; back off instead of spinning.
+			_ = core.Sleep(ctx, core.ClockFromContext(ctx, nil), cfg.Backoff.Delay(failures, core.RandFromContext(ctx, nil)))
+			failures++
+			continue
+		}
+		failures = 0
+		h.runAsyncJob(ctx, cfg, job)
+	}
+}
+
+// runAsyncJob invokes job, retrying transient upstream failures, then reports and acknowledges it.
+func (h *handler) runAsyncJob(ctx context.Context, cfg AsyncConfig, job *AsyncJob) {
+	attempts := cfg.MaxAttempts
+	if attempts <= 0 {
+		attempts = 5
+	}
+	opts := h.live.Load().opts
+	invokeReq := core.InvokeRequest{
+		Target:              job.Target,
+		FullMethodName:      job.FullMethodName,
+		ServiceName:         job.ServiceName,
+		MethodName:          job.MethodName,
+		InlineDescriptorSet: job.Descriptor,
+		DescriptorID:        job.DescriptorID,
+		DescriptorNamespace: job.Namespace,
+		Metadata:            job.Metadata,
+		Body:                job.Body,
+		BodyFormat:          job.BodyFormat,
+		HTTPBodyContentType: job.ContentType,
+		WKTCoercion:         opts.WKTCoercion,
+		FieldPresence:       opts.FieldPresence,
+		Int64Encoding:       opts.Int64Encoding,
+		LenientEnums:        job.LenientEnums,
+		UnknownFields:       job.UnknownFields,
+		Defaults:            job.Defaults,
+		Overrides:           job.Overrides,
+		AffinityKey:         job.AffinityKey,
+		AffinityField:       job.AffinityField,
+		Timeout:             job.Timeout,
+		FetchAllPages:       job.FetchAllPages,
+	}
+	var resp []byte
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			h.metrics.Add("gateway_async_jobs_total", 1, "outcome", "retried")
+			_ = core.Sleep(ctx, core.ClockFromContext(ctx, nil), cfg.Backoff.Delay(attempt-1, core.RandFromContext(ctx, nil)))
+		}
+		resp, err = h.inv.Invoke(ctx, &invokeReq)
+		if err == nil || !asyncRetryable(err) {
+			break
+		}
+	}
+	if err != nil {
+		h.metrics.Add("gateway_async_jobs_total", 1, "outcome", "failed")
+	} else {
+		h.metrics.Add("gateway_async_jobs_total", 1, "outcome", "ok")
+	}
+	if cfg.OnResult != nil {
+		cfg.OnResult(job, resp, err)
+	}
+	_ = cfg.Queue.Ack(ctx, job)
+}
+
+func asyncRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
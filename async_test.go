@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type asyncResult struct {
+	job  *AsyncJob
+	resp []byte
+	err  error
+}
+
+func TestGateway_AsyncInvocation(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	queue := NewMemoryQueue(8)
+	defer queue.Close()
+	results := make(chan asyncResult, 1)
+	srv := httptest.NewServer(Handler(Options{
+		Async: &AsyncConfig{Queue: queue, OnResult: func(job *AsyncJob, resp []byte, err error) {
+			results <- asyncResult{job, resp, err}
+		}},
+		Methods: map[string]MethodConfig{"/echo.EchoService/Echo": {Async: true}},
+	}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "later"}}, map[string]string{"X-Request-Id": "job-1"})
+	if code != http.StatusAccepted {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	var accepted asyncAccepted
+	if err := json.Unmarshal(b, &accepted); err != nil || accepted.JobID != "job-1" {
+		t.Fatalf("unexpected acceptance %s: %v", b, err)
+	}
+
+	select {
+	case res := <-results:
+		if res.err != nil || res.job.ID != "job-1" || string(res.resp) != `{"message":"later"}` {
+			t.Fatalf("unexpected result: job=%+v resp=%s err=%v", res.job, res.resp, res.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job was not processed")
+	}
+
+	// Invalid bodies are rejected up front rather than queued.
+	code, b = postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"nope": 1}}, nil)
+	if code != http.StatusBadRequest {
+		t.Fatalf("invalid body: status=%d body=%s", code, b)
+	}
+}
+
+func TestMemoryQueue_FullAndClosed(t *testing.T) {
+	q := NewMemoryQueue(1)
+	ctx := context.Background()
+	if err := q.Enqueue(ctx, &AsyncJob{ID: "a"}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if err := q.Enqueue(ctx, &AsyncJob{ID: "b"}); err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	if job, err := q.Dequeue(ctx); err != nil || job.ID != "a" {
+		t.Fatalf("dequeue: %v %v", job, err)
+	}
+	_ = q.Close()
+	if _, err := q.Dequeue(ctx); err != ErrQueueClosed {
+		t.Fatalf("expected ErrQueueClosed, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc/status"
+)
+
+// AuditRecord is one audited call, with request and response payloads after redaction.
+type AuditRecord struct {
+	Time      time.Time       `json:"time"`
+	RequestID string          `json:"request_id,omitempty"`
+	Namespace string          `json:"namespace,omitempty"`
+	Client    string          `json:"client,omitempty"` // IP address of the HTTP caller, see Options.ClientIP
+	Method    string          `json:"method"`
+	Target    string          `json:"target"`
+	Request   json.RawMessage `json:"request,omitempty"`
+	Response  json.RawMessage `json:"response,omitempty"`
+	GRPCCode  string          `json:"grpc_code"` // "OK" on success
+	Error     string          `json:"error,omitempty"`
+	Duration  time.Duration   `json:"duration_ns"`
+}
+
+// AuditSink stores audit records, e.g. in a file, a webhook or a Kafka topic (wrap the producer in an
+// AuditSinkFunc). It is called synchronously after the upstream call, so slow sinks should buffer.
+type AuditSink interface {
+	WriteAudit(ctx context.Context, rec *AuditRecord) error
+}
+
+// AuditSinkFunc adapts a function to AuditSink.
+type AuditSinkFunc func(ctx context.Context, rec *AuditRecord) error
+
+func (f AuditSinkFunc) WriteAudit(ctx context.Context, rec *AuditRecord) error { return f(ctx, rec) }
+
+// NewWriterAuditSink returns a sink that writes records as JSON lines to w (e.g. an append-only *os.File).
+func NewWriterAuditSink(w io.Writer) AuditSink {
+	return &writerAuditSink{w: w}
+}
+
+type writerAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *writerAuditSink) WriteAudit(_ context.Context, rec *AuditRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// WebhookAuditSink POSTs each record as JSON to URL.
+type WebhookAuditSink struct {
+	URL    string
+	Header http.Header  // extra request headers, e.g. Authorization
+	Client *http.Client // nil means http.DefaultClient
+}
+
+func (s *WebhookAuditSink) WriteAudit(ctx context.Context, rec *AuditRecord) error {
+	return postJSON(ctx, s.Client, s.URL, s.Header, rec, "audit webhook")
+}
+
+// postJSON POSTs v as JSON to url with header; what names the sink in errors for non-2xx responses.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, v any, what string) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", what, resp.Status)
+	}
+	return nil
+}
+
+// auditCall collects the audit record of one call; its capture method is the core.InvokeRequest.Capture hook.
+// rec stays nil unless the resolved method is audited.
+type auditCall struct {
+	opts  Options
+	start time.Time
+	rec   *AuditRecord
+}
+
+func (c *auditCall) capture(md *desc.MethodDescriptor, request, response []byte) {
+	method := "/" + md.GetService().GetFullyQualifiedName() + "/" + md.GetName()
+	mc := c.opts.methodConfig(method)
+	if !mc.Audit {
+		return
+	}
+	c.rec = &AuditRecord{
+		Time:     c.start,
+		Method:   method,
+		Request:  redactPayload(md.GetInputType(), request, mc.redactPaths()),
+		Response: redactPayload(md.GetOutputType(), response, mc.redactPaths()),
+	}
+}
+
+// redactPayload redacts body; a payload that cannot be redacted is dropped rather than recorded in clear.
+func redactPayload(md *desc.MessageDescriptor, body []byte, paths []string) json.RawMessage {
+	if body == nil {
+		return nil
+	}
+	b, err := core.RedactJSON(md, body, paths)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// writeAudit completes rec with the outcome of the call and hands it to the sink. The write is detached from
+// the request context so a client disconnect does not lose the record.
+func (h *handler) writeAudit(ctx context.Context, r *http.Request, rec *AuditRecord, err error) {
+	rec.Client = remoteIP(r)
+	rec.Duration = core.ClockFromContext(ctx, nil).Now().Sub(rec.Time)
+	rec.GRPCCode = status.Code(err).String()
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if werr := h.opts.AuditSink.WriteAudit(context.WithoutCancel(ctx), rec); werr != nil {
+		h.metrics.Add("gateway_audit_errors_total", 1, "method", rec.Method)
+	}
+}
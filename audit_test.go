@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGateway_AuditLog(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	var buf bytes.Buffer
+	srv := httptest.NewServer(Handler(Options{
+		AuditSink: NewWriterAuditSink(&buf),
+		Methods: map[string]MethodConfig{
+			"/echo.EchoService/Echo": {Audit: true, Redact: []string{"message"}},
+		},
+	}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "secret"}}, map[string]string{"X-Request-Id": "req-1"})
+	if code != http.StatusOK || string(b) != `{"message":"secret"}` {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatalf("audit log leaks redacted field: %s", buf.String())
+	}
+	var rec AuditRecord
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("decode audit record %q: %v", buf.String(), err)
+	}
+	if rec.Method != "/echo.EchoService/Echo" || rec.Target != target || rec.RequestID != "req-1" || rec.GRPCCode != "OK" {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+	if string(rec.Request) != `{"message":"[REDACTED]"}` || string(rec.Response) != `{"message":"[REDACTED]"}` {
+		t.Fatalf("unexpected payloads: request=%s response=%s", rec.Request, rec.Response)
+	}
+}
@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+)
+
+// authzEnv declares the variables available to MethodConfig.Authorize expressions.
+func authzEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("method", cel.StringType),
+		// JSON numbers arrive as doubles; let them compare with int literals (request.amount < 100).
+		cel.CrossTypeNumericComparisons(true),
+	)
+}
+
+// authorizer evaluates per-method authorization rules; programs are compiled once in Handler.
+// A rule that fails to compile denies every call of its method, with the compile error.
+type authorizer struct {
+	programs map[string]cel.Program // by Options.Methods key
+	errs     map[string]error
+}
+
+func newAuthorizer(opts Options) *authorizer {
+	a := &authorizer{programs: make(map[string]cel.Program), errs: make(map[string]error)}
+	var env *cel.Env
+	for name, mc := range opts.Methods {
+		if mc.Authorize == "" {
+			continue
+		}
+		if env == nil {
+			var err error
+			if env, err = authzEnv(); err != nil {
+				a.errs[name] = fmt.Errorf("authorization rule for %s: %w", name, err)
+				continue
+			}
+		}
+		ast, iss := env.Compile(mc.Authorize)
+		if iss.Err() != nil {
+			a.errs[name] = fmt.Errorf("authorization rule for %s: %w", name, iss.Err())
+			continue
+		}
+		if t := ast.OutputType(); !t.IsExactType(cel.BoolType) && !t.IsExactType(cel.DynType) {
+			a.errs[name] = fmt.Errorf("authorization rule for %s: must evaluate to bool, not %s", name, t)
+			continue
+		}
+		prg, err := env.Program(ast)
+		if err != nil {
+			a.errs[name] = fmt.Errorf("authorization rule for %s: %w", name, err)
+			continue
+		}
+		a.programs[name] = prg
+	}
+	return a
+}
+
+// enabled reports whether any method has an authorization rule.
+func (a *authorizer) enabled() bool {
+	return len(a.programs) > 0 || len(a.errs) > 0
+}
+
+// authorizationError rejects a call before it reaches the upstream.
+type authorizationError struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *authorizationError) Error() string { return e.msg }
+
+// check returns the core.InvokeRequest.Authorize hook for r: it evaluates the rule of the resolved method
+// against r's headers, the caller's claims and the decoded request message.
+func (a *authorizer) check(opts Options, r *http.Request) func(method string, request []byte) error {
+	return func(method string, request []byte) error {
+		key := method
+		if _, ok := opts.Methods[key]; !ok {
+			key = "*"
+		}
+		if err := a.errs[key]; err != nil {
+			return &authorizationError{status: http.StatusInternalServerError, code: ErrCodeInternal, msg: err.Error()}
+		}
+		prg := a.programs[key]
+		if prg == nil {
+			return nil
+		}
+
+		claims := map[string]any{}
+		if opts.Claims != nil {
+			c, err := opts.Claims(r)
+			if err != nil {
+				return &authorizationError{status: http.StatusUnauthorized, code: ErrCodeUnauthenticated, msg: "unauthenticated: " + err.Error()}
+			}
+			if c != nil {
+				claims = c
+			}
+		}
+		var body map[string]any
+		if err := json.Unmarshal(request, &body); err != nil {
+			return &authorizationError{status: http.StatusInternalServerError, code: ErrCodeInternal, msg: "authorization: decode request: " + err.Error()}
+		}
+		headers := make(map[string]string, len(r.Header))
+		for k, vs := range r.Header {
+			headers[strings.ToLower(k)] = strings.Join(vs, ", ")
+		}
+
+		out, _, err := prg.Eval(map[string]any{
+			"request": body,
+			"headers": headers,
+			"claims":  claims,
+			"method":  method,
+		})
+		if err != nil {
+			// Fail closed: a rule that cannot be evaluated (e.g. a missing claim) denies the call.
+			return &authorizationError{status: http.StatusForbidden, code: ErrCodeForbidden, msg: "permission denied: " + err.Error()}
+		}
+		if allowed, ok := out.Value().(bool); !ok || !allowed {
+			return &authorizationError{status: http.StatusForbidden, code: ErrCodeForbidden, msg: "permission denied"}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,60 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGateway_AuthorizationRules(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{
+		Methods: map[string]MethodConfig{
+			"/echo.EchoService/Echo": {Authorize: `request.message == claims.sub && headers["x-tenant"] == "acme"`},
+		},
+		Claims: func(r *http.Request) (map[string]any, error) {
+			sub := r.Header.Get("X-Test-Sub")
+			if sub == "" {
+				return nil, errors.New("no token")
+			}
+			return map[string]any{"sub": sub}, nil
+		},
+	}))
+	defer srv.Close()
+
+	call := func(message string, headers map[string]string) (int, []byte) {
+		return postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": message}}, headers)
+	}
+
+	if code, b := call("alice", map[string]string{"X-Test-Sub": "alice", "X-Tenant": "acme"}); code != http.StatusOK {
+		t.Fatalf("allowed call: status=%d body=%s", code, b)
+	}
+	if code, b := call("bob", map[string]string{"X-Test-Sub": "alice", "X-Tenant": "acme"}); code != http.StatusForbidden || !strings.Contains(string(b), `"code":"forbidden"`) {
+		t.Fatalf("other user: status=%d body=%s", code, b)
+	}
+	if code, b := call("alice", map[string]string{"X-Test-Sub": "alice"}); code != http.StatusForbidden {
+		t.Fatalf("missing tenant: status=%d body=%s", code, b)
+	}
+	if code, b := call("alice", nil); code != http.StatusUnauthorized || !strings.Contains(string(b), `"code":"unauthenticated"`) {
+		t.Fatalf("no claims: status=%d body=%s", code, b)
+	}
+}
+
+func TestGateway_AuthorizationRuleCompileError(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{Methods: map[string]MethodConfig{
+		"*": {Authorize: `request.message +`},
+	}}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+	if code != http.StatusInternalServerError || !strings.Contains(string(b), "authorization rule for *") {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+}
@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// BenchmarkGateway_Envelope measures a b64v1 envelope request through the handler to a local gRPC server.
+func BenchmarkGateway_Envelope(b *testing.B) {
+	target, stop := startTestGRPCServer(b)
+	defer stop()
+	h := Handler(Options{})
+	raw, _ := json.Marshal(map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hello"}})
+	body := []byte(encodeBase64V1(raw))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			b.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+}
+
+// BenchmarkGateway_MethodRoute measures a plain JSON request to a method route.
+func BenchmarkGateway_MethodRoute(b *testing.B) {
+	target, stop := startTestGRPCServer(b)
+	defer stop()
+	h := Handler(Options{Path: "/grpc-gateway"})
+	body := []byte(`{"message":"hello"}`)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/grpc-gateway/echo.EchoService/Echo", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(targetHeader, target)
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			b.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+}
+
+// BenchmarkGateway_EncodedBody measures a method route request with a 64KiB message in each body codec, the
+// path that decodes into pooled buffers.
+func BenchmarkGateway_EncodedBody(b *testing.B) {
+	target, stop := startTestGRPCServer(b)
+	defer stop()
+	h := Handler(Options{Path: "/grpc-gateway"})
+	plain, _ := json.Marshal(map[string]any{"message": strings.Repeat("hello ", 64<<10/6)})
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(plain)
+	_ = zw.Close()
+
+	for _, tc := range []struct {
+		encoding string
+		body     []byte
+	}{
+		{EncodingPlain, plain},
+		{EncodingB64V1, []byte(encodeBase64V1(plain))},
+		{EncodingGzip, gz.Bytes()},
+	} {
+		b.Run(tc.encoding, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(plain)))
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/grpc-gateway/echo.EchoService/Echo", bytes.NewReader(tc.body))
+				r.Header.Set(targetHeader, target)
+				r.Header.Set(encodingHeader, tc.encoding)
+				h.ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					b.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+			}
+		})
+	}
+}
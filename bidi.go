@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+// wantsBidi reports whether a method route request asks for a full-duplex NDJSON stream, see
+// Options.BidiStreaming.
+func wantsBidi(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept)); mediaType == ndjsonContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// serveBidi opens the bidirectional stream of invokeReq and relays it: each NDJSON line of the request body
+// is sent as it arrives while every response message is written as an NDJSON line and flushed. Errors before
+// the stream opens get a normal error response; later ones end the response with an {"error": ...} line.
+// Writers that cannot read the body while writing, or cannot flush, fail the request instead of buffering.
+func (h *handler) serveBidi(ctx context.Context, opts Options, w http.ResponseWriter, r *http.Request, invokeReq core.InvokeRequest) {
+	rc := http.NewResponseController(w)
+	// HTTP/2 requests are always full duplex; HTTP/1.1 servers only read the body while writing when asked.
+	if err := rc.EnableFullDuplex(); err != nil && r.ProtoMajor < 2 {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "bidirectional streaming is not supported by this server: "+err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := h.inv.OpenBidiStream(ctx, &invokeReq)
+	if err != nil {
+		var denied *authorizationError
+		switch {
+		case errors.As(err, &denied):
+			h.writeError(w, r, denied.status, denied.code, denied.msg)
+		case errors.Is(err, core.ErrNotBidiStreaming):
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		default:
+			h.writeInvokeError(w, r, err, nil)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		// The status is out, so all that is left is to end the call and say why.
+		opts.logger().LogAttrs(ctx, slog.LevelWarn, "bidirectional stream cannot be flushed",
+			slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+		return
+	}
+
+	var sendErr *errorResponse // why sending failed, if it did; read after sent is closed
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		if err := sendBidi(r.Body, stream); err != nil {
+			sendErr = bidiSendError(err)
+			cancel()
+		}
+	}()
+
+	enc := json.NewEncoder(w)
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			e := invokeErrorResponse(err, nil)
+			if ctx.Err() != nil {
+				<-sent
+				if sendErr != nil {
+					e = *sendErr
+				}
+			}
+			if enc.Encode(struct {
+				Error errorResponse `json:"error"`
+			}{e}) == nil {
+				_ = rc.Flush() // the stream ends here either way
+			}
+			return
+		}
+		if _, err := w.Write(append(msg, '\n')); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// sendBidi sends the NDJSON lines of body on stream as they are read and closes the sending side at the end
+// of body. It stops early, without error, if the upstream ended the call.
+func sendBidi(body io.Reader, stream *core.BidiStream) error {
+	sc := bufio.NewScanner(body)
+	sc.Buffer(nil, maxDecompressedBody)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return fmt.Errorf("%w: line %d is not JSON", core.ErrInvalidStreamBody, n)
+		}
+		if err := stream.Send(line); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return stream.CloseSend()
+}
+
+// bidiSendError is the error line for a request message that could not be sent.
+func bidiSendError(err error) *errorResponse {
+	var denied *authorizationError
+	if errors.As(err, &denied) {
+		return &errorResponse{Error: denied.msg, Code: denied.code}
+	}
+	return &errorResponse{Error: err.Error(), Code: ErrCodeInvalidRequest}
+}
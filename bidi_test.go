@@ -0,0 +1,242 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// startChatServer serves acme.Chat/Shout, a bidirectional-streaming method answering every message with
+// its text in upper case. It returns the target and the descriptor set of the service.
+func startChatServer(t *testing.T) (string, []byte) {
+	t.Helper()
+	line := builder.NewMessage("Line").AddField(builder.NewField("text", builder.FieldTypeString()))
+	svc := builder.NewService("Chat").
+		AddMethod(builder.NewMethod("Shout", builder.RpcTypeMessage(line, true), builder.RpcTypeMessage(line, true)))
+	fd, err := builder.NewFile("acme/chat.proto").SetPackageName("acme").AddMessage(line).AddService(svc).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	method := fd.FindService("acme.Chat").FindMethodByName("Shout")
+
+	s := grpc.NewServer()
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "acme.Chat",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Shout",
+			ClientStreams: true,
+			ServerStreams: true,
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				for {
+					in := dynamic.NewMessage(method.GetInputType())
+					if err := stream.RecvMsg(in); err == io.EOF {
+						return nil
+					} else if err != nil {
+						return err
+					}
+					out := dynamic.NewMessage(method.GetOutputType())
+					out.SetFieldByName("text", strings.ToUpper(in.GetFieldByName("text").(string)))
+					if err := stream.SendMsg(out); err != nil {
+						return err
+					}
+				}
+			},
+		}},
+	}, struct{}{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	set, err := proto.Marshal(desc.ToFileDescriptorSet(fd))
+	if err != nil {
+		t.Fatalf("marshal descriptor: %v", err)
+	}
+	return lis.Addr().String(), set
+}
+
+func TestGateway_BidiStreaming(t *testing.T) {
+	target, set := startChatServer(t)
+	counter, counterSet := startCounterServer(t)
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", BidiStreaming: true}))
+	defer srv.Close()
+	for id, s := range map[string][]byte{"chat": set, "counter": counterSet} {
+		if code, b := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{
+			"descriptor_id":          id,
+			"descriptor_chunk":       base64.StdEncoding.EncodeToString(s),
+			"descriptor_chunk_total": 1,
+		}, nil); code != http.StatusOK {
+			t.Fatalf("upload %s: status=%d body=%s", id, code, b)
+		}
+	}
+
+	open := func(path, target, id string, body io.Reader) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/"+path, body)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.Header.Set("Accept", "application/x-ndjson")
+		req.Header.Set(targetHeader, target)
+		req.Header.Set(descriptorIDHeader, id)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// Each response arrives before the next request message is written.
+	pr, pw := io.Pipe()
+	resp := open("acme.Chat/Shout", target, "chat", pr)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("status=%d content-type=%s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	lines := bufio.NewScanner(resp.Body)
+	for _, text := range []string{"hello", "world"} {
+		if _, err := io.WriteString(pw, `{"text":"`+text+`"}`+"\n"); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if !lines.Scan() || lines.Text() != `{"text":"`+strings.ToUpper(text)+`"}` {
+			t.Fatalf("line for %s = %q, %v", text, lines.Text(), lines.Err())
+		}
+	}
+	pw.Close()
+	if lines.Scan() {
+		t.Fatalf("unexpected line after close: %s", lines.Text())
+	}
+
+	// A bad message ends the stream with an error line; responses to earlier messages may or may not precede it.
+	resp = open("acme.Chat/Shout", target, "chat", strings.NewReader("{\"text\":\"a\"}\n{\"txt\":1}\n"))
+	out, _ := io.ReadAll(resp.Body)
+	if got := strings.Split(strings.TrimSpace(string(out)), "\n"); !strings.Contains(got[len(got)-1], `"code":"invalid_request"`) {
+		t.Fatalf("bad message: %s", out)
+	}
+
+	// Other methods are refused before the stream opens.
+	resp = open("acme.Counter/Sum", counter, "counter", strings.NewReader(`{"n":1}`))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("client-streaming: status=%d", resp.StatusCode)
+	}
+}
+
+func TestGateway_BidiStreamingWrappedWriter(t *testing.T) {
+	target, set := startChatServer(t)
+	for name, opts := range map[string]Options{
+		"quota":       {Quota: &QuotaConfig{Limits: []QuotaLimit{{Name: "daily", Window: 24 * time.Hour, MaxCalls: 100}}}},
+		"compression": {ResponseCompression: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts.Path, opts.BidiStreaming = "/grpc-gateway", true
+			srv := httptest.NewServer(Handler(opts))
+			defer srv.Close()
+			if code, b := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{
+				"descriptor_id":          "chat",
+				"descriptor_chunk":       base64.StdEncoding.EncodeToString(set),
+				"descriptor_chunk_total": 1,
+			}, nil); code != http.StatusOK {
+				t.Fatalf("upload: status=%d body=%s", code, b)
+			}
+
+			pr, pw := io.Pipe()
+			defer pw.Close()
+			// Writers held back by the gateway time out instead of hanging the test: the request body here, and
+			// the response below.
+			defer time.AfterFunc(5*time.Second, func() { pw.Close() }).Stop()
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/acme.Chat/Shout", pr)
+			req.Header.Set("Content-Type", "application/x-ndjson")
+			req.Header.Set("Accept", "application/x-ndjson")
+			req.Header.Set(targetHeader, target)
+			req.Header.Set(descriptorIDHeader, "chat")
+			resp, err := (&http.Client{Timeout: 5 * time.Second}).Do(req)
+			if err != nil {
+				t.Fatalf("post: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status=%d", resp.StatusCode)
+			}
+			if opts.ResponseCompression && !resp.Uncompressed {
+				t.Fatalf("response was not compressed")
+			}
+			lines := bufio.NewScanner(resp.Body)
+			for _, text := range []string{"hello", "world"} {
+				if _, err := io.WriteString(pw, `{"text":"`+text+`"}`+"\n"); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+				if !lines.Scan() || lines.Text() != `{"text":"`+strings.ToUpper(text)+`"}` {
+					t.Fatalf("line for %s = %q, %v", text, lines.Text(), lines.Err())
+				}
+			}
+		})
+	}
+}
+
+func TestGateway_BidiStreamingUnflushable(t *testing.T) {
+	target, set := startChatServer(t)
+	h := Handler(Options{Path: "/grpc-gateway", BidiStreaming: true})
+	// A middleware writer that hides the server's, so the stream could neither flush nor run full duplex.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(struct{ http.ResponseWriter }{w}, r)
+	}))
+	defer srv.Close()
+	if code, b := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{
+		"descriptor_id":          "chat",
+		"descriptor_chunk":       base64.StdEncoding.EncodeToString(set),
+		"descriptor_chunk_total": 1,
+	}, nil); code != http.StatusOK {
+		t.Fatalf("upload: status=%d body=%s", code, b)
+	}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/acme.Chat/Shout", strings.NewReader(`{"text":"a"}`))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Accept", "application/x-ndjson")
+	req.Header.Set(targetHeader, target)
+	req.Header.Set(descriptorIDHeader, "chat")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	if b, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusInternalServerError || !strings.Contains(string(b), "not supported") {
+		t.Fatalf("status=%d body=%s", resp.StatusCode, b)
+	}
+}
+
+func TestGateway_BidiStreamingSigned(t *testing.T) {
+	target, _ := startChatServer(t)
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", BidiStreaming: true, Signature: &SignatureConfig{
+		Keys: func(string) ([]byte, bool) { return []byte("s3cret"), true },
+	}}))
+	defer srv.Close()
+
+	// The body never ends, so the gateway must answer without reading it.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/acme.Chat/Shout", pr)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Accept", "application/x-ndjson")
+	req.Header.Set(targetHeader, target)
+	req.Header.Set(descriptorIDHeader, "chat")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("signed bidi: status=%d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGateway_MethodRouteBodyFormats(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{Timeout: 5 * time.Second, Path: "/grpc-gateway"}))
+	defer srv.Close()
+
+	cases := []struct {
+		contentType, body string
+		status            int
+		want              string
+	}{
+		{"application/json", `{"message":"json"}`, http.StatusOK, `{"message":"json"}`},
+		{"text/x-protobuf", `message: "text"`, http.StatusOK, `{"message":"text"}`},
+		{"application/yaml; charset=utf-8", "message: yaml\n", http.StatusOK, `{"message":"yaml"}`},
+		{"application/x-yaml", "", http.StatusOK, `{"message":""}`},
+		{"text/x-protobuf", `nope: 1`, http.StatusBadGateway, "prototext to message"},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/echo.EchoService/Echo", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		req.Header.Set(targetHeader, target)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.contentType, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || !strings.Contains(string(b), tc.want) {
+			t.Fatalf("%s %q: status=%d body=%s", tc.contentType, tc.body, resp.StatusCode, b)
+		}
+	}
+}
+
+func TestGateway_MethodRouteGET(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{Timeout: 5 * time.Second, Path: "/grpc-gateway", DefaultTarget: target, StrictErrors: true}))
+	defer srv.Close()
+
+	cases := []struct {
+		method, query string
+		status        int
+		want          string
+	}{
+		{http.MethodGet, "message=hello+world", http.StatusOK, `{"message":"hello world"}`},
+		{http.MethodGet, "", http.StatusOK, `{"message":""}`},
+		{http.MethodGet, "message=a&message=b", http.StatusBadRequest, "message is set more than once"},
+		{http.MethodGet, "nope=1", http.StatusBadRequest, "nope"},
+		{http.MethodPut, "message=a", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, srv.URL+"/grpc-gateway/echo.EchoService/Echo?"+tc.query, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.query, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || !strings.Contains(string(b), tc.want) {
+			t.Fatalf("%s %q: status=%d body=%s", tc.method, tc.query, resp.StatusCode, b)
+		}
+		if tc.status == http.StatusMethodNotAllowed && resp.Header.Get("Allow") != "GET, POST" {
+			t.Fatalf("Allow = %q", resp.Header.Get("Allow"))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+)
+
+// blockingEchoServer parks every call until the caller cancels it.
+type blockingEchoServer struct {
+	pb.UnimplementedEchoServiceServer
+	entered   chan struct{}
+	cancelled chan struct{}
+}
+
+func (s blockingEchoServer) Echo(ctx context.Context, _ *pb.EchoRequest) (*pb.EchoResponse, error) {
+	close(s.entered)
+	select {
+	case <-ctx.Done():
+		close(s.cancelled)
+		return nil, ctx.Err()
+	case <-time.After(30 * time.Second):
+		return &pb.EchoResponse{}, nil
+	}
+}
+
+func TestGateway_ClientDisconnectCancelsUpstream(t *testing.T) {
+	upstream := blockingEchoServer{entered: make(chan struct{}), cancelled: make(chan struct{})}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, upstream)
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	metrics := core.NewMemoryMetrics()
+	disconnected := make(chan error, 1)
+	srv := httptest.NewServer(Handler(Options{
+		Metrics:            metrics,
+		OnClientDisconnect: func(_ *http.Request, err error) { disconnected <- err },
+	}))
+	defer srv.Close()
+
+	raw, _ := json.Marshal(map[string]any{"target": lis.Addr().String(), "method": "/echo.EchoService/Echo"})
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL, bytes.NewBufferString(encodeBase64V1(raw)))
+	go func() {
+		<-upstream.entered
+		cancel()
+	}()
+	if _, err := http.DefaultClient.Do(req); err == nil {
+		t.Fatalf("expected client-side error after cancel")
+	}
+
+	select {
+	case <-upstream.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("upstream call was not cancelled after client disconnect")
+	}
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("OnClientDisconnect not called")
+	}
+	if got := metrics.Get(core.MetricKey("gateway_upstream_cancelled_total", "method", "/echo.EchoService/Echo", "reason", "canceled")); got != 1 {
+		t.Fatalf("cancelled metric = %v, want 1", got)
+	}
+}
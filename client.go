@@ -0,0 +1,274 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls a remote gateway endpoint from Go, building the request envelope and applying the body
+// encoding (b64v1 by default, see WithEncoding) so callers only deal with targets, methods and JSON payloads.
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+	header     http.Header
+	signKeyID  string // see WithSignature
+	signSecret []byte
+	encoding   string      // see WithEncoding
+	cipher     *bodyCipher // see WithEncryption
+	cipherErr  error
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithHTTPClient sets the HTTP client used for gateway calls; default http.DefaultClient.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithHeader adds a header sent with every call (e.g. auth or descriptor write tokens).
+func WithHeader(key, value string) ClientOption {
+	return func(c *Client) {
+		c.header.Add(key, value)
+	}
+}
+
+// WithSignature signs every call with HMAC-SHA256 under keyID, for gateways with an Options.Signature using
+// the default algorithm and headers. Each call carries a random nonce, so repeated calls are not taken for
+// replays.
+func WithSignature(keyID string, secret []byte) ClientOption {
+	return func(c *Client) {
+		c.signKeyID, c.signSecret = keyID, secret
+	}
+}
+
+// WithEncoding selects the request body codec: EncodingB64V1 (default), EncodingPlain or EncodingGzip. The
+// latter two need a gateway that understands X-Gateway-Encoding. Use WithEncryption for EncodingAESGCM.
+func WithEncoding(encoding string) ClientOption {
+	return func(c *Client) {
+		c.encoding = encoding
+	}
+}
+
+// WithEncryption sends every call aesgcm-encoded under the AES key named keyID and decrypts the responses, for
+// gateways with an Options.Encryption holding that key. Invalid keys fail every call.
+func WithEncryption(keyID string, key []byte) ClientOption {
+	return func(c *Client) {
+		c.cipher, c.cipherErr = newBodyCipher(keyID, key)
+	}
+}
+
+// NewClient returns a Client for the gateway at endpoint, e.g. "http://gateway.internal:8080/grpc-gateway".
+func NewClient(endpoint string, opts ...ClientOption) *Client {
+	c := &Client{
+		endpoint:   endpoint,
+		httpClient: http.DefaultClient,
+		header:     make(http.Header),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ClientError is returned when the gateway answers with a non-200 status.
+type ClientError struct {
+	StatusCode int
+	Message    string // the gateway's "error" field, or the raw body if it was not JSON
+	Code       string // the gateway's stable error code (ErrCode constants), if any
+	GRPCCode   string // upstream gRPC status code name for upstream errors, e.g. "NotFound"
+	// Details are the upstream gRPC status details as JSON (each with "@type"), if any.
+	Details []json.RawMessage
+}
+
+func (e *ClientError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("gateway: http status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("gateway: http status %d: %s", e.StatusCode, e.Message)
+}
+
+// InvokeJSON calls fullMethod ("/package.Service/Method") on target using descriptors known to the gateway
+// (v1 request) and returns the JSON response. A nil body sends {}.
+func (c *Client) InvokeJSON(ctx context.Context, target, fullMethod string, body json.RawMessage) (json.RawMessage, error) {
+	return c.do(ctx, gatewayRequest{
+		Target: target,
+		Method: fullMethod,
+		Body:   body,
+	})
+}
+
+// InvokeWithDescriptor calls method on target using an inline FileDescriptorSet (v2 request).
+// method is either a full method name or a bare method name; in the latter case service must be set.
+// If descriptor is nil, the gateway looks up descriptorID in its cache (uploaded earlier or via SyncDescriptor).
+// descriptor may be gzip- or zstd-compressed; the gateway detects it.
+func (c *Client) InvokeWithDescriptor(ctx context.Context, target, service, method string, descriptor []byte, descriptorID string, body json.RawMessage) (json.RawMessage, error) {
+	req := gatewayRequest{
+		Target:       target,
+		Service:      service,
+		Method:       method,
+		DescriptorID: descriptorID,
+		Params:       body,
+	}
+	if len(descriptor) > 0 {
+		req.Descriptor = base64.StdEncoding.EncodeToString(descriptor)
+	}
+	return c.do(ctx, req)
+}
+
+// SyncDescriptor uploads descriptor under descriptorID in chunks of at most chunkSize bytes, so that
+// later InvokeWithDescriptor calls can pass only the id. chunkSize <= 0 selects 256KiB. Compressing descriptor
+// with gzip or zstd first saves most of the upload.
+func (c *Client) SyncDescriptor(ctx context.Context, descriptorID string, descriptor []byte, chunkSize int) error {
+	if len(descriptor) == 0 {
+		return fmt.Errorf("gateway: empty descriptor")
+	}
+	if chunkSize <= 0 {
+		chunkSize = 256 << 10
+	}
+	total := (len(descriptor) + chunkSize - 1) / chunkSize
+	for i := 0; i < total; i++ {
+		end := min((i+1)*chunkSize, len(descriptor))
+		_, err := c.do(ctx, gatewayRequest{
+			DescriptorID:         descriptorID,
+			DescriptorChunk:      base64.StdEncoding.EncodeToString(descriptor[i*chunkSize : end]),
+			DescriptorChunkIndex: i,
+			DescriptorChunkTotal: total,
+			DescriptorChunkReset: i == 0,
+		})
+		if err != nil {
+			return fmt.Errorf("sync chunk %d/%d: %w", i+1, total, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, req gatewayRequest) (json.RawMessage, error) {
+	plain, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("gateway: marshal request: %w", err)
+	}
+	if c.cipherErr != nil {
+		return nil, fmt.Errorf("gateway: %w", c.cipherErr)
+	}
+	encoding := c.encoding
+	if c.cipher != nil {
+		encoding = EncodingAESGCM
+	}
+	var body []byte
+	switch encoding {
+	case EncodingAESGCM:
+		if body, err = c.cipher.seal("request", plain); err != nil {
+			return nil, fmt.Errorf("gateway: encrypt request: %w", err)
+		}
+	case EncodingPlain:
+		body = plain
+	case EncodingGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(plain)
+		_ = zw.Close()
+		body = buf.Bytes()
+	case "", EncodingB64V1:
+		encoding = ""
+		body = []byte(encodeBase64V1(plain))
+	default:
+		return nil, fmt.Errorf("gateway: unsupported body encoding %q", encoding)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("gateway: build request: %w", err)
+	}
+	for k, v := range c.header {
+		httpReq.Header[k] = append([]string(nil), v...)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		httpReq.Header.Set(encodingHeader, encoding)
+	}
+	if c.signKeyID != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		path := httpReq.URL.Path
+		if path == "" {
+			path = "/"
+		}
+		nonce := make([]byte, 12)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("gateway: sign request: %w", err)
+		}
+		httpReq.Header.Set(signatureNonceHeader, hex.EncodeToString(nonce))
+		sig := signRequest(sha256.New, c.signSecret, ts, http.MethodPost, path, httpReq.URL.RawQuery,
+			signedHeaderValues(httpReq.Header, signatureNonceHeader), body)
+		httpReq.Header.Set(signatureKeyIDHeader, c.signKeyID)
+		httpReq.Header.Set(signatureTimestampHeader, ts)
+		httpReq.Header.Set(signatureHeader, hex.EncodeToString(sig))
+	}
+	if c.cipher != nil {
+		httpReq.Header.Set(encryptionKeyIDHeader, c.cipher.keyID)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("gateway: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("gateway: read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var er errorResponse
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/problem+json") {
+			var p problemDetails
+			if json.Unmarshal(b, &p) == nil {
+				er = errorResponse{Error: p.Detail, Code: p.Code, GRPCCode: p.GRPCCode, Details: p.Details}
+			}
+		} else {
+			_ = json.Unmarshal(b, &er)
+		}
+		if er.Error != "" {
+			return nil, &ClientError{
+				StatusCode: resp.StatusCode,
+				Message:    er.Error,
+				Code:       er.Code,
+				GRPCCode:   er.GRPCCode,
+				Details:    er.Details,
+			}
+		}
+		return nil, &ClientError{StatusCode: resp.StatusCode, Message: string(bytes.TrimSpace(b))}
+	}
+	// Symmetric responses (Options.SymmetricResponses) come in the request's codec.
+	switch strings.ToLower(resp.Header.Get(encodingHeader)) {
+	case EncodingAESGCM:
+		if c.cipher == nil {
+			return nil, fmt.Errorf("gateway: encrypted response without an encryption key")
+		}
+		if b, err = c.cipher.open("response", b); err != nil {
+			return nil, fmt.Errorf("gateway: decrypt response: %w", err)
+		}
+	case EncodingB64V1:
+		if b, err = decodeReversedBase64(b); err != nil {
+			return nil, fmt.Errorf("gateway: decode response: %w", err)
+		}
+	case EncodingGzip:
+		if b, err = gunzip(bytes.NewReader(b)); err != nil {
+			return nil, fmt.Errorf("gateway: decode response: %w", err)
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,49 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_InvokeJSONAndDescriptor(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	srv := httptest.NewServer(Handler(Options{Timeout: 5 * time.Second}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	ctx := context.Background()
+
+	out, err := c.InvokeJSON(ctx, target, "/echo.EchoService/Echo", json.RawMessage(`{"message":"v1"}`))
+	if err != nil {
+		t.Fatalf("InvokeJSON: %v", err)
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(out, &resp); err != nil || resp["message"] != "v1" {
+		t.Fatalf("unexpected InvokeJSON response: %s (%v)", out, err)
+	}
+
+	desc := mustReadDescriptor(t)
+	if err := c.SyncDescriptor(ctx, "echo-client", desc, 64); err != nil {
+		t.Fatalf("SyncDescriptor: %v", err)
+	}
+	out, err = c.InvokeWithDescriptor(ctx, target, "EchoService", "Echo", nil, "echo-client", json.RawMessage(`{"message":"v2"}`))
+	if err != nil {
+		t.Fatalf("InvokeWithDescriptor: %v", err)
+	}
+	if err := json.Unmarshal(out, &resp); err != nil || resp["message"] != "v2" {
+		t.Fatalf("unexpected InvokeWithDescriptor response: %s (%v)", out, err)
+	}
+
+	_, err = c.InvokeJSON(ctx, target, "/echo.EchoService/Missing", nil)
+	var ce *ClientError
+	if !errors.As(err, &ce) || ce.StatusCode != http.StatusBadGateway || ce.Message == "" {
+		t.Fatalf("expected ClientError with 502, got %v", err)
+	}
+}
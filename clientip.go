@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPConfig determines the IP address of callers and restricts which may use the gateway
+// (Options.ClientIP). The address also identifies callers for quotas (without a QuotaConfig.ClientKey) and
+// audit records.
+type ClientIPConfig struct {
+	// TrustedProxies are the CIDR prefixes (or single addresses) of proxies in front of the gateway. For
+	// requests from them the client is the last X-Forwarded-For address not in TrustedProxies, or X-Real-IP
+	// without X-Forwarded-For; requests from other peers cannot claim a different address.
+	TrustedProxies []string
+	// Allow, if non-empty, lists the only CIDR prefixes (or addresses) clients may call from.
+	Allow []string
+	// Deny lists CIDR prefixes (or addresses) rejected even if Allow matches them.
+	Deny []string
+}
+
+// clientIPFilter is the parsed form of ClientIPConfig.
+type clientIPFilter struct {
+	trusted, allow, deny []netip.Prefix
+}
+
+func newClientIPFilter(cfg ClientIPConfig) (*clientIPFilter, error) {
+	var f clientIPFilter
+	var err error
+	if f.trusted, err = parsePrefixes("trusted proxies", cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
+	if f.allow, err = parsePrefixes("allow", cfg.Allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parsePrefixes("deny", cfg.Deny); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// parsePrefixes parses CIDR prefixes and single addresses.
+func parsePrefixes(field string, entries []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(entries))
+	for _, e := range entries {
+		if !strings.Contains(e, "/") {
+			addr, err := netip.ParseAddr(e)
+			if err != nil {
+				return nil, fmt.Errorf("client ip %s: %w", field, err)
+			}
+			out = append(out, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(e)
+		if err != nil {
+			return nil, fmt.Errorf("client ip %s: %w", field, err)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the caller of r, looking through trusted proxies.
+func (f *clientIPFilter) clientIP(r *http.Request) (netip.Addr, bool) {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr := peer.Addr().Unmap()
+	if !containsAddr(f.trusted, addr) {
+		return addr, true
+	}
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return realIP.Unmap(), true
+		}
+		return addr, true
+	}
+	// Each proxy appends the address it received the request from; walk back until an untrusted one.
+	hops := strings.Split(strings.Join(forwarded, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return addr, true // a malformed entry was not written by a trusted proxy; stop at the last trusted one
+		}
+		addr = hop.Unmap()
+		if !containsAddr(f.trusted, addr) {
+			break
+		}
+	}
+	return addr, true
+}
+
+// allowed reports whether addr may call the gateway.
+func (f *clientIPFilter) allowed(addr netip.Addr) bool {
+	if containsAddr(f.deny, addr) {
+		return false
+	}
+	return len(f.allow) == 0 || containsAddr(f.allow, addr)
+}
+
+type clientIPKey struct{}
+
+// remoteIP returns the caller's address of r as determined under Options.ClientIP, or the host of
+// r.RemoteAddr.
+func remoteIP(r *http.Request) string {
+	if addr, ok := r.Context().Value(clientIPKey{}).(netip.Addr); ok {
+		return addr.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// filterClientIP determines the caller's address under Options.ClientIP and rejects callers that are not
+// allowed; otherwise it returns r with the address recorded for remoteIP.
+func (h *handler) filterClientIP(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if h.clientIP == nil {
+		return r, true
+	}
+	addr, ok := h.clientIP.clientIP(r)
+	if !ok || !h.clientIP.allowed(addr) {
+		h.metrics.Add("gateway_client_ip_rejections_total", 1)
+		h.writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "client address is not allowed")
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, addr)), true
+}
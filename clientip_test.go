@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPFilter_ClientIP(t *testing.T) {
+	f, err := newClientIPFilter(ClientIPConfig{TrustedProxies: []string{"10.0.0.0/8", "192.0.2.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name, remote, xff, realIP, want string
+	}{
+		{"direct", "198.51.100.4:5000", "", "", "198.51.100.4"},
+		{"untrusted peer cannot spoof", "198.51.100.4:5000", "203.0.113.9", "203.0.113.9", "198.51.100.4"},
+		{"one proxy", "10.1.2.3:443", "203.0.113.9", "", "203.0.113.9"},
+		{"proxy chain", "10.1.2.3:443", "203.0.113.9, 10.4.4.4, 192.0.2.1", "", "203.0.113.9"},
+		{"spoofed leftmost entry", "10.1.2.3:443", "1.1.1.1, 203.0.113.9", "", "203.0.113.9"},
+		{"multiple headers", "10.1.2.3:443", "", "", "10.1.2.3"},
+		{"x-real-ip", "10.1.2.3:443", "", "203.0.113.9", "203.0.113.9"},
+		{"malformed entry", "10.1.2.3:443", "junk, 10.4.4.4", "", "10.4.4.4"},
+		{"ipv4-mapped", "[::ffff:198.51.100.4]:5000", "", "", "198.51.100.4"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			r.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.realIP != "" {
+			r.Header.Set("X-Real-IP", tc.realIP)
+		}
+		if got, ok := f.clientIP(r); !ok || got.String() != tc.want {
+			t.Errorf("%s: client ip = %v, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGateway_ClientIPAllowDeny(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	var audited []string
+	h := Handler(Options{
+		ClientIP: &ClientIPConfig{TrustedProxies: []string{"10.0.0.0/8"}, Allow: []string{"203.0.113.0/24"}, Deny: []string{"203.0.113.66"}},
+		Methods:  map[string]MethodConfig{"*": {Audit: true}},
+		AuditSink: AuditSinkFunc(func(_ context.Context, rec *AuditRecord) error {
+			audited = append(audited, rec.Client)
+			return nil
+		}),
+	})
+	raw, _ := json.Marshal(map[string]any{"target": target, "method": "/echo.EchoService/Echo"})
+	call := func(remote, xff string) int {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(encodeBase64V1(raw)))
+		r.RemoteAddr = remote
+		if xff != "" {
+			r.Header.Set("X-Forwarded-For", xff)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := call("10.0.0.5:443", "203.0.113.10"); code != http.StatusOK {
+		t.Fatalf("allowed client: status=%d", code)
+	}
+	if code := call("10.0.0.5:443", "203.0.113.66"); code != http.StatusForbidden {
+		t.Fatalf("denied client: status=%d", code)
+	}
+	if code := call("10.0.0.5:443", "198.51.100.1"); code != http.StatusForbidden {
+		t.Fatalf("client outside allow list: status=%d", code)
+	}
+	if code := call("198.51.100.1:5000", "203.0.113.10"); code != http.StatusForbidden {
+		t.Fatalf("spoofed X-Forwarded-For: status=%d", code)
+	}
+	if len(audited) != 1 || audited[0] != "203.0.113.10" {
+		t.Fatalf("audited clients = %v", audited)
+	}
+}
@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// startCounterServer serves acme.Counter/Sum, a client-streaming method adding up the n of every message.
+// It returns the target and the descriptor set of the service.
+func startCounterServer(t *testing.T) (string, []byte) {
+	t.Helper()
+	add := builder.NewMessage("AddRequest").AddField(builder.NewField("n", builder.FieldTypeInt32()))
+	sum := builder.NewMessage("SumResponse").
+		AddField(builder.NewField("total", builder.FieldTypeInt32())).
+		AddField(builder.NewField("count", builder.FieldTypeInt32()))
+	svc := builder.NewService("Counter").
+		AddMethod(builder.NewMethod("Sum", builder.RpcTypeMessage(add, true), builder.RpcTypeMessage(sum, false)))
+	fd, err := builder.NewFile("acme/counter.proto").SetPackageName("acme").AddMessage(add).AddMessage(sum).AddService(svc).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	method := fd.FindService("acme.Counter").FindMethodByName("Sum")
+
+	s := grpc.NewServer()
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "acme.Counter",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Sum",
+			ClientStreams: true,
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				var total, count int32
+				for {
+					in := dynamic.NewMessage(method.GetInputType())
+					if err := stream.RecvMsg(in); err == io.EOF {
+						break
+					} else if err != nil {
+						return err
+					}
+					total += in.GetFieldByName("n").(int32)
+					count++
+				}
+				out := dynamic.NewMessage(method.GetOutputType())
+				out.SetFieldByName("total", total)
+				out.SetFieldByName("count", count)
+				return stream.SendMsg(out)
+			},
+		}},
+	}, struct{}{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	set, err := proto.Marshal(desc.ToFileDescriptorSet(fd))
+	if err != nil {
+		t.Fatalf("marshal descriptor: %v", err)
+	}
+	return lis.Addr().String(), set
+}
+
+func TestGateway_ClientStreaming(t *testing.T) {
+	target, set := startCounterServer(t)
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway"}))
+	defer srv.Close()
+
+	// A JSON array sends one message per element.
+	code, b := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{
+		"target":        target,
+		"service":       "acme.Counter",
+		"method":        "Sum",
+		"descriptor":    base64.StdEncoding.EncodeToString(set),
+		"descriptor_id": "counter",
+		"params":        []map[string]any{{"n": 1}, {"n": 2}, {"n": 3}},
+	}, nil)
+	if code != http.StatusOK || string(b) != `{"total":6,"count":3}` {
+		t.Fatalf("array: status=%d body=%s", code, b)
+	}
+
+	// Method routes take NDJSON.
+	post := func(body string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/acme.Counter/Sum", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.Header.Set(targetHeader, target)
+		req.Header.Set(descriptorIDHeader, "counter")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		out, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(out)
+	}
+	if code, out := post("{\"n\":10}\n\n{\"n\":5}\n"); code != http.StatusOK || out != `{"total":15,"count":2}` {
+		t.Fatalf("ndjson: status=%d body=%s", code, out)
+	}
+	if code, out := post("[]"); code != http.StatusOK || out != `{"total":0,"count":0}` {
+		t.Fatalf("empty stream: status=%d body=%s", code, out)
+	}
+	for name, body := range map[string]string{
+		"broken line":   "{\"n\":1}\n{\"n\":",
+		"broken array":  `[{"n":1},`,
+		"wrong message": `[{"n":1},{"m":2}]`,
+	} {
+		if code, out := post(body); code != http.StatusBadRequest {
+			t.Errorf("%s: status=%d body=%s", name, code, out)
+		}
+	}
+}
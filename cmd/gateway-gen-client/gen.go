@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+type genConfig struct {
+	Lang         string // "ts" or "js"
+	DescriptorID string // sent as descriptor_id; empty means v1 requests by full method name
+	Descriptor   []byte // embedded FileDescriptorSet, uploaded when the gateway lacks DescriptorID
+}
+
+// wellKnownTS maps google.protobuf types to their canonical proto3 JSON shape.
+var wellKnownTS = map[string]string{
+	"google.protobuf.Timestamp":   "string",
+	"google.protobuf.Duration":    "string",
+	"google.protobuf.FieldMask":   "string",
+	"google.protobuf.Struct":      "{ [key: string]: unknown }",
+	"google.protobuf.Value":       "unknown",
+	"google.protobuf.ListValue":   "unknown[]",
+	"google.protobuf.Empty":       "Record<string, never>",
+	"google.protobuf.Any":         `{ "@type": string; [key: string]: unknown }`,
+	"google.protobuf.DoubleValue": "number | null",
+	"google.protobuf.FloatValue":  "number | null",
+	"google.protobuf.Int32Value":  "number | null",
+	"google.protobuf.UInt32Value": "number | null",
+	"google.protobuf.Int64Value":  "string | null",
+	"google.protobuf.UInt64Value": "string | null",
+	"google.protobuf.BoolValue":   "boolean | null",
+	"google.protobuf.StringValue": "string | null",
+	"google.protobuf.BytesValue":  "string | null",
+}
+
+type generator struct {
+	cfg      genConfig
+	messages map[string]*desc.MessageDescriptor
+	enums    map[string]*desc.EnumDescriptor
+	names    map[string]string // fully-qualified proto name -> TS identifier
+}
+
+func generate(files map[string]*desc.FileDescriptor, cfg genConfig) (string, error) {
+	if cfg.Lang != "ts" && cfg.Lang != "js" {
+		return "", fmt.Errorf("unsupported -lang %q (want ts or js)", cfg.Lang)
+	}
+	g := &generator{
+		cfg:      cfg,
+		messages: make(map[string]*desc.MessageDescriptor),
+		enums:    make(map[string]*desc.EnumDescriptor),
+		names:    make(map[string]string),
+	}
+
+	var services []*desc.ServiceDescriptor
+	var sources []string
+	for _, name := range sortedKeys(files) {
+		fd := files[name]
+		if len(fd.GetServices()) == 0 {
+			continue
+		}
+		sources = append(sources, fd.GetName())
+		for _, svc := range fd.GetServices() {
+			services = append(services, svc)
+			for _, m := range svc.GetMethods() {
+				if m.IsClientStreaming() || m.IsServerStreaming() {
+					continue
+				}
+				g.collect(m.GetInputType())
+				g.collect(m.GetOutputType())
+			}
+		}
+	}
+	if len(services) == 0 {
+		return "", fmt.Errorf("no services found in descriptor set")
+	}
+	g.assignNames()
+
+	var b strings.Builder
+	b.WriteString("// Code generated by gateway-gen-client. DO NOT EDIT.\n")
+	fmt.Fprintf(&b, "// source: %s\n\n", strings.Join(sources, ", "))
+
+	if cfg.Lang == "ts" {
+		g.writeTypes(&b)
+	}
+	g.writeTransport(&b)
+	for _, svc := range services {
+		g.writeService(&b, svc)
+	}
+	return b.String(), nil
+}
+
+// collect records md and every message/enum reachable from its fields.
+func (g *generator) collect(md *desc.MessageDescriptor) {
+	fqn := md.GetFullyQualifiedName()
+	if _, ok := wellKnownTS[fqn]; ok {
+		return
+	}
+	if _, ok := g.messages[fqn]; ok {
+		return
+	}
+	g.messages[fqn] = md
+	for _, f := range md.GetFields() {
+		if f.IsMap() {
+			f = f.GetMapValueType()
+		}
+		if mt := f.GetMessageType(); mt != nil {
+			g.collect(mt)
+		}
+		if et := f.GetEnumType(); et != nil {
+			g.enums[et.GetFullyQualifiedName()] = et
+		}
+	}
+}
+
+// assignNames derives TS identifiers from package-relative names (Outer.Inner -> Outer_Inner),
+// falling back to the fully-qualified name when two packages define the same type.
+func (g *generator) assignNames() {
+	short := func(fqn, pkg string) string {
+		rel := strings.TrimPrefix(fqn, pkg+".")
+		return strings.ReplaceAll(rel, ".", "_")
+	}
+	count := make(map[string]int)
+	var all []struct{ fqn, pkg string }
+	for fqn, md := range g.messages {
+		all = append(all, struct{ fqn, pkg string }{fqn, md.GetFile().GetPackage()})
+	}
+	for fqn, ed := range g.enums {
+		all = append(all, struct{ fqn, pkg string }{fqn, ed.GetFile().GetPackage()})
+	}
+	for _, t := range all {
+		count[short(t.fqn, t.pkg)]++
+	}
+	for _, t := range all {
+		name := short(t.fqn, t.pkg)
+		if count[name] > 1 {
+			name = strings.ReplaceAll(t.fqn, ".", "_")
+		}
+		g.names[t.fqn] = name
+	}
+}
+
+func (g *generator) writeTypes(b *strings.Builder) {
+	for _, fqn := range sortedKeys(g.enums) {
+		ed := g.enums[fqn]
+		var values []string
+		for _, v := range ed.GetValues() {
+			values = append(values, fmt.Sprintf("%q", v.GetName()))
+		}
+		// Enums are accepted as names or numbers; the gateway responds with names.
+		fmt.Fprintf(b, "export type %s = %s | number;\n\n", g.names[fqn], strings.Join(values, " | "))
+	}
+	for _, fqn := range sortedKeys(g.messages) {
+		md := g.messages[fqn]
+		fmt.Fprintf(b, "export interface %s {\n", g.names[fqn])
+		for _, f := range md.GetFields() {
+			fmt.Fprintf(b, "  %s?: %s;\n", f.GetJSONName(), g.fieldType(f))
+		}
+		b.WriteString("}\n\n")
+	}
+}
+
+func (g *generator) fieldType(f *desc.FieldDescriptor) string {
+	if f.IsMap() {
+		return fmt.Sprintf("{ [key: string]: %s }", g.singularType(f.GetMapValueType()))
+	}
+	t := g.singularType(f)
+	if f.IsRepeated() {
+		if strings.ContainsAny(t, " |{") {
+			return "Array<" + t + ">"
+		}
+		return t + "[]"
+	}
+	return t
+}
+
+func (g *generator) singularType(f *desc.FieldDescriptor) string {
+	switch f.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+		descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT32, descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return "number"
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64, descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		// proto3 JSON encodes 64-bit integers as strings to survive JavaScript number precision.
+		return "string"
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return "boolean"
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING, descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return "string"
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return g.names[f.GetEnumType().GetFullyQualifiedName()]
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		fqn := f.GetMessageType().GetFullyQualifiedName()
+		if t, ok := wellKnownTS[fqn]; ok {
+			return t
+		}
+		return g.names[fqn]
+	}
+	return "unknown"
+}
+
+func (g *generator) writeTransport(b *strings.Builder) {
+	descriptor := ""
+	if len(g.cfg.Descriptor) > 0 {
+		descriptor = base64.StdEncoding.EncodeToString(g.cfg.Descriptor)
+	}
+	if g.cfg.Lang == "ts" {
+		fmt.Fprintf(b, tsTransport, g.cfg.DescriptorID, descriptor)
+	} else {
+		fmt.Fprintf(b, jsTransport, g.cfg.DescriptorID, descriptor)
+	}
+}
+
+func (g *generator) writeService(b *strings.Builder, svc *desc.ServiceDescriptor) {
+	ts := g.cfg.Lang == "ts"
+	fmt.Fprintf(b, "\n/** %sClient calls %s through the gateway. */\n", svc.GetName(), svc.GetFullyQualifiedName())
+	fmt.Fprintf(b, "export class %sClient {\n", svc.GetName())
+	if ts {
+		b.WriteString("  constructor(private readonly transport: GatewayTransport) {}\n")
+	} else {
+		b.WriteString("  /** @param {GatewayTransport} transport */\n  constructor(transport) {\n    this.transport = transport;\n  }\n")
+	}
+	for _, m := range svc.GetMethods() {
+		full := "/" + svc.GetFullyQualifiedName() + "/" + m.GetName()
+		if m.IsClientStreaming() || m.IsServerStreaming() {
+			fmt.Fprintf(b, "\n  // %s: streaming methods are not supported by the gateway client.\n", m.GetName())
+			continue
+		}
+		fmt.Fprintf(b, "\n  /** %s calls %s. */\n", lowerFirst(m.GetName()), full)
+		if ts {
+			in, out := g.messageRef(m.GetInputType()), g.messageRef(m.GetOutputType())
+			fmt.Fprintf(b, "  %s(request: %s, init?: RequestInit): Promise<%s> {\n", lowerFirst(m.GetName()), in, out)
+			fmt.Fprintf(b, "    return this.transport.call<%s, %s>(%q, request, init);\n  }\n", in, out, full)
+		} else {
+			fmt.Fprintf(b, "  %s(request, init) {\n", lowerFirst(m.GetName()))
+			fmt.Fprintf(b, "    return this.transport.call(%q, request, init);\n  }\n", full)
+		}
+	}
+	b.WriteString("}\n")
+}
+
+func (g *generator) messageRef(md *desc.MessageDescriptor) string {
+	if t, ok := wellKnownTS[md.GetFullyQualifiedName()]; ok {
+		return t
+	}
+	return g.names[md.GetFullyQualifiedName()]
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	if len(r) > 0 {
+		r[0] = unicode.ToLower(r[0])
+	}
+	return string(r)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// tsTransport and jsTransport implement the gateway envelope and b64v1 encoding (base64 of the UTF-8 JSON,
+// then the whole string reversed). Format verbs: descriptor_id, base64 descriptor.
+const tsTransport = `const DESCRIPTOR_ID = %[1]q;
+const DESCRIPTOR = %[2]q;
+
+/** GatewayError is thrown when the gateway answers with a non-200 status. */
+export class GatewayError extends Error {
+  constructor(readonly status: number, message: string) {
+    super(message || "gateway: http status " + status);
+  }
+}
+
+function encodeB64V1(json: string): string {
+  const bytes = new TextEncoder().encode(json);
+  let bin = "";
+  for (let i = 0; i < bytes.length; i++) bin += String.fromCharCode(bytes[i]);
+  return btoa(bin).split("").reverse().join("");
+}
+
+/** GatewayTransport posts request envelopes to a gateway endpoint for one gRPC target. */
+export class GatewayTransport {
+  constructor(
+    private readonly endpoint: string,
+    private readonly target: string,
+    private readonly defaults: RequestInit = {},
+  ) {}
+
+  async call<Req, Res>(method: string, request: Req, init?: RequestInit): Promise<Res> {
+    try {
+      return await this.send<Res>(this.envelope(method, request, false), init);
+    } catch (err) {
+      // The gateway may have evicted our descriptor; upload the embedded copy once and retry.
+      if (DESCRIPTOR && err instanceof GatewayError && err.message.includes("descriptor not found")) {
+        return this.send<Res>(this.envelope(method, request, true), init);
+      }
+      throw err;
+    }
+  }
+
+  private envelope(method: string, request: unknown, withDescriptor: boolean): Record<string, unknown> {
+    if (!DESCRIPTOR_ID) {
+      return { target: this.target, method, body: request };
+    }
+    const env: Record<string, unknown> = { target: this.target, method, descriptor_id: DESCRIPTOR_ID, params: request };
+    if (withDescriptor) env.descriptor = DESCRIPTOR;
+    return env;
+  }
+
+  private async send<Res>(envelope: Record<string, unknown>, init?: RequestInit): Promise<Res> {
+    const resp = await fetch(this.endpoint, {
+      ...this.defaults,
+      ...init,
+      method: "POST",
+      headers: { "Content-Type": "application/json", ...this.defaults.headers, ...init?.headers },
+      body: encodeB64V1(JSON.stringify(envelope)),
+    });
+    const text = await resp.text();
+    if (!resp.ok) {
+      let message = text;
+      try {
+        message = JSON.parse(text).error ?? text;
+      } catch {
+        // not JSON
+      }
+      throw new GatewayError(resp.status, message);
+    }
+    return JSON.parse(text) as Res;
+  }
+}
+`
+
+const jsTransport = `const DESCRIPTOR_ID = %[1]q;
+const DESCRIPTOR = %[2]q;
+
+/** GatewayError is thrown when the gateway answers with a non-200 status. */
+export class GatewayError extends Error {
+  constructor(status, message) {
+    super(message || "gateway: http status " + status);
+    this.status = status;
+  }
+}
+
+function encodeB64V1(json) {
+  const bytes = new TextEncoder().encode(json);
+  let bin = "";
+  for (let i = 0; i < bytes.length; i++) bin += String.fromCharCode(bytes[i]);
+  return btoa(bin).split("").reverse().join("");
+}
+
+/** GatewayTransport posts request envelopes to a gateway endpoint for one gRPC target. */
+export class GatewayTransport {
+  /**
+   * @param {string} endpoint gateway URL, e.g. "https://api.example.com/grpc-gateway"
+   * @param {string} target gRPC target, e.g. "users:50051"
+   * @param {RequestInit} [defaults] fetch options applied to every call
+   */
+  constructor(endpoint, target, defaults = {}) {
+    this.endpoint = endpoint;
+    this.target = target;
+    this.defaults = defaults;
+  }
+
+  async call(method, request, init) {
+    try {
+      return await this.send(this.envelope(method, request, false), init);
+    } catch (err) {
+      // The gateway may have evicted our descriptor; upload the embedded copy once and retry.
+      if (DESCRIPTOR && err instanceof GatewayError && err.message.includes("descriptor not found")) {
+        return this.send(this.envelope(method, request, true), init);
+      }
+      throw err;
+    }
+  }
+
+  envelope(method, request, withDescriptor) {
+    if (!DESCRIPTOR_ID) {
+      return { target: this.target, method, body: request };
+    }
+    const env = { target: this.target, method, descriptor_id: DESCRIPTOR_ID, params: request };
+    if (withDescriptor) env.descriptor = DESCRIPTOR;
+    return env;
+  }
+
+  async send(envelope, init) {
+    const resp = await fetch(this.endpoint, {
+      ...this.defaults,
+      ...init,
+      method: "POST",
+      headers: { "Content-Type": "application/json", ...this.defaults.headers, ...(init && init.headers) },
+      body: encodeB64V1(JSON.stringify(envelope)),
+    });
+    const text = await resp.text();
+    if (!resp.ok) {
+      let message = text;
+      try {
+        message = JSON.parse(text).error ?? text;
+      } catch {
+        // not JSON
+      }
+      throw new GatewayError(resp.status, message);
+    }
+    return JSON.parse(text);
+  }
+}
+`
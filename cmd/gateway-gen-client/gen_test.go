@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func echoFiles(t *testing.T) map[string]*desc.FileDescriptor {
+	t.Helper()
+
+	raw, ok := core.EmbeddedDescriptorSet("echo.EchoService")
+	if !ok {
+		t.Fatalf("missing embedded descriptor for echo.EchoService")
+	}
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(raw, &fds); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	files, err := desc.CreateFileDescriptorsFromSet(&fds)
+	if err != nil {
+		t.Fatalf("create file descriptors: %v", err)
+	}
+	return files
+}
+
+func TestGenerate_TypeScript(t *testing.T) {
+	code, err := generate(echoFiles(t), genConfig{Lang: "ts"})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	for _, want := range []string{
+		"export interface EchoRequest {\n  message?: string;\n}",
+		"export class EchoServiceClient {",
+		`echo(request: EchoRequest, init?: RequestInit): Promise<EchoResponse> {`,
+		`this.transport.call<EchoRequest, EchoResponse>("/echo.EchoService/Echo", request, init);`,
+		`return btoa(bin).split("").reverse().join("");`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("generated code missing %q:\n%s", want, code)
+		}
+	}
+}
+
+func TestGenerate_JavaScriptWithDescriptorID(t *testing.T) {
+	code, err := generate(echoFiles(t), genConfig{Lang: "js", DescriptorID: "echo-v1", Descriptor: []byte{1, 2, 3}})
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if strings.Contains(code, "interface") || strings.Contains(code, ": string") {
+		t.Fatalf("js output must not contain TypeScript types:\n%s", code)
+	}
+	for _, want := range []string{`const DESCRIPTOR_ID = "echo-v1";`, `const DESCRIPTOR = "AQID";`, `echo(request, init) {`} {
+		if !strings.Contains(code, want) {
+			t.Fatalf("generated code missing %q:\n%s", want, code)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Command gateway-gen-client generates a small TypeScript (or JavaScript) client for frontend consumers
+// from a FileDescriptorSet. The client wraps the gateway request envelope and b64v1 body encoding and exposes
+// one typed method per unary RPC.
+//
+// Usage:
+//
+//	protoc --include_imports --descriptor_set_out=api.pb api.proto
+//	gateway-gen-client -descriptor api.pb -out api.gateway.ts
+//	gateway-gen-client -descriptor api.pb -lang js -descriptor-id api-v3 -embed-descriptor -out api.gateway.js
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func main() {
+	var (
+		descriptorPath = flag.String("descriptor", "", "path to a binary FileDescriptorSet (protoc --include_imports --descriptor_set_out)")
+		out            = flag.String("out", "", "output file; default stdout")
+		lang           = flag.String("lang", "ts", "output language: ts or js")
+		descriptorID   = flag.String("descriptor-id", "", "descriptor_id sent with every call (v2 requests); empty uses v1 full method names")
+		embed          = flag.Bool("embed-descriptor", false, "embed the descriptor so the client can upload it when the gateway does not have descriptor-id cached")
+	)
+	flag.Parse()
+	if *descriptorPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *embed && *descriptorID == "" {
+		log.Fatal("-embed-descriptor requires -descriptor-id")
+	}
+
+	raw, err := os.ReadFile(*descriptorPath)
+	if err != nil {
+		log.Fatalf("read descriptor: %v", err)
+	}
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(raw, &fds); err != nil {
+		log.Fatalf("unmarshal FileDescriptorSet: %v", err)
+	}
+	files, err := desc.CreateFileDescriptorsFromSet(&fds)
+	if err != nil {
+		log.Fatalf("create file descriptors: %v", err)
+	}
+
+	cfg := genConfig{
+		Lang:         *lang,
+		DescriptorID: *descriptorID,
+	}
+	if *embed {
+		cfg.Descriptor = raw
+	}
+	code, err := generate(files, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *out == "" {
+		fmt.Print(code)
+		return
+	}
+	if err := os.WriteFile(*out, []byte(code), 0o644); err != nil {
+		log.Fatalf("write %s: %v", *out, err)
+	}
+}
@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+)
+
+// gatedEchoServer counts calls and holds them until release is closed.
+type gatedEchoServer struct {
+	pb.UnimplementedEchoServiceServer
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (s *gatedEchoServer) Echo(ctx context.Context, req *pb.EchoRequest) (*pb.EchoResponse, error) {
+	s.calls.Add(1)
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &pb.EchoResponse{Message: req.GetMessage()}, nil
+}
+
+func TestGateway_CoalescedCalls(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	upstream := &gatedEchoServer{release: make(chan struct{})}
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, upstream)
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+	target := lis.Addr().String()
+
+	metrics := core.NewMemoryMetrics()
+	srv := httptest.NewServer(Handler(Options{
+		Timeout: 5 * time.Second,
+		Metrics: metrics,
+		Methods: map[string]MethodConfig{"/echo.EchoService/Echo": {Coalesce: true}},
+	}))
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		message := "hot"
+		if i == len(codes)-1 {
+			message = "other"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i], _ = postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": message}}, nil)
+		}()
+	}
+	// Let every request reach the gateway before the upstream answers.
+	deadline := time.Now().Add(2 * time.Second)
+	for upstream.calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(upstream.release)
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("request %d: status=%d", i, code)
+		}
+	}
+	if got := upstream.calls.Load(); got != 2 {
+		t.Fatalf("upstream calls = %d, want 2 (one per distinct request)", got)
+	}
+	if got := metrics.Get("gateway_coalesced_calls_total", "method", "/echo.EchoService/Echo"); got != 3 {
+		t.Fatalf("coalesced calls = %v, want 3", got)
+	}
+}
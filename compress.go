@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultCompressionMinSize = 1 << 10
+
+// negotiateEncoding picks "gzip" or "deflate" from an Accept-Encoding header, preferring gzip on ties;
+// it returns "" when neither is acceptable.
+func negotiateEncoding(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		switch name {
+		case "gzip", "deflate", "*":
+		default:
+			continue
+		}
+		if name == "*" {
+			name = "gzip"
+		}
+		if q > bestQ || (q == bestQ && name == "gzip") {
+			best, bestQ = name, q
+		}
+	}
+	if bestQ <= 0 {
+		return ""
+	}
+	return best
+}
+
+// compressWriter compresses the response body once it reaches minSize bytes. Smaller bodies, and responses
+// that already carry a Content-Encoding, are sent as is. The status line is held back until that decision
+// is made, or until Flush, which always compresses; Close must be called once the handler is done.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	zw      flushWriteCloser // nil: pass-through
+}
+
+// flushWriteCloser is a *gzip.Writer or *flate.Writer.
+type flushWriteCloser interface {
+	io.WriteCloser
+	Flush() error
+}
+
+type compressWriterKey struct{}
+
+// responseContentCoding returns the content coding the compressWriter of r (see Options.ResponseCompression)
+// will apply to a body of size bytes sent with header, or "" if it sends the body as is.
+func responseContentCoding(r *http.Request, header http.Header, size int) string {
+	cw, _ := r.Context().Value(compressWriterKey{}).(*compressWriter)
+	if cw == nil || size < cw.minSize || header.Get("Content-Encoding") != "" {
+		return ""
+	}
+	return cw.encoding
+}
+
+func newCompressWriter(w http.ResponseWriter, encoding string, minSize int) *compressWriter {
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	return &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, status: http.StatusOK}
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if !cw.decided {
+		cw.status = code
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.decided {
+		if cw.zw != nil {
+			return cw.zw.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+	cw.buf.Write(p)
+	if cw.buf.Len() >= cw.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide commits the response headers, compressing if compress is set and nothing else encoded the body.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if compress && h.Get("Content-Encoding") == "" && cw.status != http.StatusNoContent && cw.status != http.StatusNotModified {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		if cw.encoding == "gzip" {
+			cw.zw = gzip.NewWriter(cw.ResponseWriter)
+		} else {
+			cw.zw, _ = flate.NewWriter(cw.ResponseWriter, flate.DefaultCompression)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if cw.zw != nil {
+		_, err = cw.zw.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+// FlushError sends what was written so far: it commits to compressing, since a flushed body is streamed and
+// its final size unknown, flushes the compressor and then the underlying writer.
+func (cw *compressWriter) FlushError() error {
+	if !cw.decided {
+		if err := cw.decide(true); err != nil {
+			return err
+		}
+	}
+	if cw.zw != nil {
+		if err := cw.zw.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Flush implements http.Flusher; see FlushError.
+func (cw *compressWriter) Flush() {
+	_ = cw.FlushError()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. for EnableFullDuplex.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close flushes a body that stayed below minSize uncompressed, or finishes the compressed stream.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		return cw.decide(false)
+	}
+	if cw.zw != nil {
+		return cw.zw.Close()
+	}
+	return nil
+}
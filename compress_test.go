@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/keicoqk/gateway/core"
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                        "",
+		"gzip":                    "gzip",
+		"deflate":                 "deflate",
+		"deflate, gzip":           "gzip",
+		"gzip;q=0.5, deflate":     "deflate",
+		"br":                      "",
+		"gzip;q=0":                "",
+		"*":                       "gzip",
+		"identity, deflate;q=0.1": "deflate",
+	} {
+		if got := negotiateEncoding(accept); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestGateway_Compression(t *testing.T) {
+	encodings := make(chan string, 4)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.StatsHandler(inHeaderRecorder(func(h *stats.InHeader) { encodings <- h.Compression })))
+	pb.RegisterEchoServiceServer(s, echoServer{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	srv := httptest.NewServer(Handler(Options{
+		ResponseCompression: true,
+		Targets:             map[string]core.TargetConfig{"*": {Compression: "gzip"}},
+	}))
+	defer srv.Close()
+	hc := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	call := func(message string) *http.Response {
+		t.Helper()
+		raw, _ := json.Marshal(map[string]any{"target": lis.Addr().String(), "method": "/echo.EchoService/Echo", "body": map[string]any{"message": message}})
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, bytes.NewBufferString(encodeBase64V1(raw)))
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := hc.Do(req)
+		if err != nil {
+			t.Fatalf("do: %v", err)
+		}
+		if enc := <-encodings; enc != "gzip" {
+			t.Fatalf("upstream grpc-encoding = %q, want gzip", enc)
+		}
+		return resp
+	}
+
+	large := strings.Repeat("abc", 2000)
+	resp := call(large)
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "gzip" || resp.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("unexpected headers: %v", resp.Header)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	b, _ := io.ReadAll(zr)
+	var out map[string]string
+	if err := json.Unmarshal(b, &out); err != nil || out["message"] != large {
+		t.Fatalf("unexpected body (err=%v): %.80s", err, b)
+	}
+
+	small := call("hi")
+	defer small.Body.Close()
+	if small.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("small response should not be compressed")
+	}
+	if b, _ := io.ReadAll(small.Body); !strings.Contains(string(b), `"hi"`) {
+		t.Fatalf("unexpected small body: %s", b)
+	}
+}
+
+// inHeaderRecorder is a server stats.Handler reporting the request headers of every call.
+type inHeaderRecorder func(*stats.InHeader)
+
+func (f inHeaderRecorder) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (f inHeaderRecorder) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if h, ok := s.(*stats.InHeader); ok {
+		f(h)
+	}
+}
+
+func (f inHeaderRecorder) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (f inHeaderRecorder) HandleConn(context.Context, stats.ConnStats) {}
+
+func TestCompressWriter_Flush(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := newCompressWriter(w, "gzip", 0)
+		defer cw.Close()
+		_, _ = cw.Write([]byte("first\n"))
+		if err := http.NewResponseController(cw).Flush(); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+		<-release
+		_, _ = cw.Write([]byte("second\n"))
+	}))
+	defer srv.Close()
+	defer close(release)
+	hc := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err := hc.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The handler is still blocked, so the first line can only arrive through Flush.
+	buf := make([]byte, len("first\n"))
+	if _, err := io.ReadFull(zr, buf); err != nil || string(buf) != "first\n" {
+		t.Fatalf("first chunk = %q, %v", buf, err)
+	}
+}
@@ -0,0 +1,934 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"gopkg.in/yaml.v3"
+)
+
+// configEnv names the environment variable LoadOptions reads the config file path from.
+const configEnv = "GATEWAY_CONFIG"
+
+// fileConfig is the file form of Options read by LoadOptions, in YAML or JSON (a subset of YAML).
+// Durations are strings such as "1.5s" or "24h".
+type fileConfig struct {
+	Path                 string         `yaml:"path"`
+	Timeout              configDuration `yaml:"timeout"`
+	DefaultTarget        string         `yaml:"default_target"`
+	AllowedTargets       []string       `yaml:"allowed_targets"`
+	AdminToken           string         `yaml:"admin_token"`
+	Profiling            bool           `yaml:"profiling"` // admin pprof and vars routes
+	DescriptorWriteToken string         `yaml:"descriptor_write_token"`
+	StrictErrors         bool           `yaml:"strict_errors"`
+	ErrorFormat          string         `yaml:"error_format"`
+	ProblemTypeBase      string         `yaml:"problem_type_base"`
+	MetadataAllow        []string       `yaml:"metadata_allow"`
+	MetadataDeny         []string       `yaml:"metadata_deny"`
+	ResponseCompression  bool           `yaml:"response_compression"`
+	SymmetricResponses   bool           `yaml:"symmetric_responses"`
+	BidiStreaming        bool           `yaml:"bidi_streaming"`
+	RequestEcho          bool           `yaml:"request_echo"`
+	UnknownFields        string         `yaml:"unknown_fields"` // "reject", "drop" or "warn"
+	FieldPresence        string         `yaml:"field_presence"` // "omit" or "null"
+	Int64Encoding        string         `yaml:"int64_encoding"` // "string" or "number"
+	// DescriptorDir is the directory of {service}.pb descriptor files (Options.DescriptorFS).
+	DescriptorDir string `yaml:"descriptor_dir"`
+	// ContractDir is the directory of golden files of recorded methods (NewGoldenContractSink).
+	ContractDir string `yaml:"contract_dir"`
+	// PreloadDescriptors are descriptor set file paths or globs, and http(s) URLs.
+	PreloadDescriptors []string `yaml:"preload_descriptors"`
+	// BaseDescriptors are read like PreloadDescriptors (Options.BaseDescriptors).
+	BaseDescriptors []string `yaml:"base_descriptors"`
+	// DescriptorLayers are "local", "directory", "cache" and "registry" in resolution order.
+	DescriptorLayers []string `yaml:"descriptor_layers"`
+	// ResponseCompressionMinSize and MaxResponseBytes are in bytes.
+	ResponseCompressionMinSize int `yaml:"response_compression_min_size"`
+	MaxResponseBytes           int `yaml:"max_response_bytes"`
+	// Proxy is the forward proxy URL of upstream connections (Options.Proxy).
+	Proxy string `yaml:"proxy"`
+
+	// TLS applies to targets without a TLS section of their own.
+	TLS             *tlsFileConfig               `yaml:"tls"`
+	Targets         map[string]targetFileConfig  `yaml:"targets"`
+	Methods         map[string]methodFileConfig  `yaml:"methods"`
+	CORS            *corsFileConfig              `yaml:"cors"`
+	Quota           []quotaLimitFileConfig       `yaml:"quota"`
+	WKTCoercion     *wktFileConfig               `yaml:"wkt_coercion"`
+	HealthCheck     *healthCheckFileConfig       `yaml:"health_check"`
+	Readiness       *readinessFileConfig         `yaml:"readiness"`
+	Faults          []faultFileConfig            `yaml:"faults"`
+	Routes          []routeFileConfig            `yaml:"routes"`
+	Signature       *signatureFileConfig         `yaml:"signature"`
+	Encryption      *encryptionFileConfig        `yaml:"encryption"`
+	PII             *piiFileConfig               `yaml:"pii"`
+	TargetOverride  *targetOverrideFileConfig    `yaml:"target_override"`
+	ClientIP        *clientIPFileConfig          `yaml:"client_ip"`
+	TenantHeader    string                       `yaml:"tenant_header"`
+	Tenants         map[string]tenantFileConfig  `yaml:"tenants"`
+	Versions        map[string]versionFileConfig `yaml:"versions"`
+	DescriptorCache struct {
+		MaxEntries int            `yaml:"max_entries"`
+		MaxBytes   int64          `yaml:"max_bytes"`
+		TTL        configDuration `yaml:"ttl"`
+	} `yaml:"descriptor_cache"`
+}
+
+// healthCheckFileConfig is the file form of core.HealthCheckConfig.
+type healthCheckFileConfig struct {
+	Interval           configDuration `yaml:"interval"`
+	Timeout            configDuration `yaml:"timeout"`
+	Service            string         `yaml:"service"`
+	UnhealthyThreshold int            `yaml:"unhealthy_threshold"`
+}
+
+// faultFileConfig is the file form of Fault.
+type faultFileConfig struct {
+	Method       string         `yaml:"method"`
+	Target       string         `yaml:"target"`
+	Delay        configDuration `yaml:"delay"`
+	DelayPercent float64        `yaml:"delay_percent"`
+	AbortCode    string         `yaml:"abort_code"`
+	AbortPercent float64        `yaml:"abort_percent"`
+	Message      string         `yaml:"message"`
+}
+
+// routeFileConfig is the file form of Route; field values are YAML or JSON values.
+type routeFileConfig struct {
+	Pattern string         `yaml:"pattern"`
+	Method  string         `yaml:"method"`
+	Target  string         `yaml:"target"`
+	Fields  map[string]any `yaml:"fields"`
+}
+
+// readinessFileConfig is the file form of ReadinessConfig; warm-up bodies are YAML or JSON request messages.
+type readinessFileConfig struct {
+	Targets []string `yaml:"targets"`
+	WarmUp  []struct {
+		Target string `yaml:"target"`
+		Method string `yaml:"method"`
+		Body   any    `yaml:"body"`
+	} `yaml:"warm_up"`
+	Timeout       configDuration `yaml:"timeout"`
+	RetryInterval configDuration `yaml:"retry_interval"`
+}
+
+// tlsFileConfig enables TLS to upstream targets.
+type tlsFileConfig struct {
+	CAFile             string `yaml:"ca_file"`   // PEM roots; default the system pool
+	CertFile           string `yaml:"cert_file"` // client certificate for mTLS, with KeyFile
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// targetFileConfig is the file form of core.TargetConfig.
+type targetFileConfig struct {
+	TLS                    *tlsFileConfig `yaml:"tls"`
+	Authority              string         `yaml:"authority"`
+	UserAgent              string         `yaml:"user_agent"`
+	MaxRecvMsgSize         int            `yaml:"max_recv_msg_size"`
+	MaxSendMsgSize         int            `yaml:"max_send_msg_size"`
+	KeepaliveTime          configDuration `yaml:"keepalive_time"`
+	KeepaliveTimeout       configDuration `yaml:"keepalive_timeout"`
+	KeepaliveWithoutStream bool           `yaml:"keepalive_without_stream"`
+	Compression            string         `yaml:"compression"`
+	WaitForReady           bool           `yaml:"wait_for_ready"`
+	Transport              string         `yaml:"transport"`
+	MaxInFlight            int            `yaml:"max_in_flight"`
+	QueueTimeout           configDuration `yaml:"queue_timeout"`
+	ConsistentHash         bool           `yaml:"consistent_hash"`
+	Proxy                  string         `yaml:"proxy"` // proxy URL, or "direct"
+}
+
+// methodFileConfig is the file form of the data fields of MethodConfig.
+type methodFileConfig struct {
+	Timeout          configDuration       `yaml:"timeout"`
+	RenameFields     map[string]string    `yaml:"rename_fields"`
+	ResponseEnvelope string               `yaml:"response_envelope"`
+	ResponseHeaders  map[string]string    `yaml:"response_headers"`
+	Authorize        string               `yaml:"authorize"`
+	VisibleIf        map[string]string    `yaml:"visible_if"`
+	PII              []string             `yaml:"pii"`
+	Audit            bool                 `yaml:"audit"`
+	Record           bool                 `yaml:"record"`
+	Redact           []string             `yaml:"redact"`
+	HedgeDelay       configDuration       `yaml:"hedge_delay"`
+	Coalesce         bool                 `yaml:"coalesce"`
+	LenientEnums     bool                 `yaml:"lenient_enums"`
+	UnknownFields    string               `yaml:"unknown_fields"`
+	Defaults         map[string]any       `yaml:"defaults"`
+	FetchAllPages    int                  `yaml:"fetch_all_pages"`
+	Affinity         *affinityFileConfig  `yaml:"affinity"`
+	ETag             bool                 `yaml:"etag"`
+	Deprecation      *deprecationConfig   `yaml:"deprecation"`
+	Mock             *mockFileConfig      `yaml:"mock"`
+	Multipart        *multipartFileConfig `yaml:"multipart"`
+	RawResponse      *rawResponseConfig   `yaml:"raw_response"`
+	SlowThreshold    configDuration       `yaml:"slow_threshold"`
+}
+
+// affinityFileConfig is the file form of AffinityConfig.
+type affinityFileConfig struct {
+	Header string `yaml:"header"`
+	Field  string `yaml:"field"`
+}
+
+// rawResponseConfig is the file form of RawResponse.
+type rawResponseConfig struct {
+	Field            string `yaml:"field"`
+	ContentType      string `yaml:"content_type"`
+	ContentTypeField string `yaml:"content_type_field"`
+}
+
+// multipartFileConfig is the file form of MultipartConfig.
+type multipartFileConfig struct {
+	Fields    map[string]string `yaml:"fields"`
+	FileNames map[string]string `yaml:"file_names"`
+}
+
+// mockFileConfig is the file form of MockConfig. The response is a template string, or a YAML or JSON
+// value served as is.
+type mockFileConfig struct {
+	Enabled      bool           `yaml:"enabled"`
+	Response     any            `yaml:"response"`
+	Latency      configDuration `yaml:"latency"`
+	Jitter       configDuration `yaml:"jitter"`
+	ErrorRate    float64        `yaml:"error_rate"`
+	ErrorCode    string         `yaml:"error_code"`
+	ErrorMessage string         `yaml:"error_message"`
+}
+
+// clientIPFileConfig is the file form of ClientIPConfig.
+type clientIPFileConfig struct {
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	Allow          []string `yaml:"allow"`
+	Deny           []string `yaml:"deny"`
+}
+
+// signatureFileConfig is the file form of SignatureConfig, with the secrets by key id.
+type signatureFileConfig struct {
+	Keys            map[string]string `yaml:"keys"`
+	Algorithm       string            `yaml:"algorithm"`
+	Header          string            `yaml:"header"`
+	KeyIDHeader     string            `yaml:"key_id_header"`
+	TimestampHeader string            `yaml:"timestamp_header"`
+	MaxSkew         configDuration    `yaml:"max_skew"`
+}
+
+// encryptionFileConfig is the file form of EncryptionConfig, with the base64-encoded AES keys by key id.
+type encryptionFileConfig struct {
+	Keys     map[string]string `yaml:"keys"`
+	Required bool              `yaml:"required"`
+}
+
+// piiFileConfig is the file form of PIIPolicy.
+type piiFileConfig struct {
+	RequireEncryption bool   `yaml:"require_encryption"`
+	TrustedIf         string `yaml:"trusted_if"`
+}
+
+// targetOverrideFileConfig is the file form of TargetOverrideConfig.
+type targetOverrideFileConfig struct {
+	AllowIf string   `yaml:"allow_if"`
+	Targets []string `yaml:"targets"`
+}
+
+// deprecationConfig is the file form of Deprecation; dates are YAML timestamps, e.g. 2026-06-30 or
+// 2026-06-30T00:00:00Z.
+type deprecationConfig struct {
+	Since             time.Time `yaml:"since"`
+	Sunset            time.Time `yaml:"sunset"`
+	Link              string    `yaml:"link"`
+	RejectAfterSunset bool      `yaml:"reject_after_sunset"`
+}
+
+// corsFileConfig is the file form of CORSConfig.
+type corsFileConfig struct {
+	AllowedOrigins   []string       `yaml:"allowed_origins"`
+	AllowedMethods   []string       `yaml:"allowed_methods"`
+	AllowedHeaders   []string       `yaml:"allowed_headers"`
+	ExposedHeaders   []string       `yaml:"exposed_headers"`
+	MaxAge           configDuration `yaml:"max_age"`
+	AllowCredentials bool           `yaml:"allow_credentials"`
+}
+
+// quotaLimitFileConfig is the file form of QuotaLimit.
+type quotaLimitFileConfig struct {
+	Name     string         `yaml:"name"`
+	Window   configDuration `yaml:"window"`
+	MaxCalls int64          `yaml:"max_calls"`
+	MaxBytes int64          `yaml:"max_bytes"`
+}
+
+// wktFileConfig is the file form of core.WKTCoercion; an empty section enables the lenient request forms.
+type wktFileConfig struct {
+	Timestamps      string `yaml:"timestamps"` // "", "unix" or "unix_ms"
+	DurationSeconds bool   `yaml:"duration_seconds"`
+}
+
+// tenantFileConfig is the file form of TenantConfig.
+type tenantFileConfig struct {
+	DefaultTarget        string                      `yaml:"default_target"`
+	AllowedTargets       []string                    `yaml:"allowed_targets"`
+	AdminToken           string                      `yaml:"admin_token"`
+	DescriptorWriteToken string                      `yaml:"descriptor_write_token"`
+	Methods              map[string]methodFileConfig `yaml:"methods"`
+	Quota                []quotaLimitFileConfig      `yaml:"quota"`
+}
+
+// versionFileConfig is the file form of APIVersion.
+type versionFileConfig struct {
+	DefaultTarget      string                      `yaml:"default_target"`
+	AllowedTargets     []string                    `yaml:"allowed_targets"`
+	DescriptorDir      string                      `yaml:"descriptor_dir"`
+	PreloadDescriptors []string                    `yaml:"preload_descriptors"`
+	Methods            map[string]methodFileConfig `yaml:"methods"`
+	Deprecation        *deprecationConfig          `yaml:"deprecation"`
+}
+
+// configDuration is a time.Duration written as a string ("500ms", "2m") in config files.
+type configDuration time.Duration
+
+func (d *configDuration) UnmarshalYAML(node *yaml.Node) error {
+	v, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	*d = configDuration(v)
+	return nil
+}
+
+// LoadOptions builds Options from the config file at path (or at $GATEWAY_CONFIG when path is empty; no file
+// if both are empty), then GATEWAY_* environment variables, which take precedence:
+//
+//	GATEWAY_PATH, GATEWAY_TIMEOUT, GATEWAY_DEFAULT_TARGET, GATEWAY_PROXY, GATEWAY_ALLOWED_TARGETS (comma-separated),
+//	GATEWAY_ADMIN_TOKEN, GATEWAY_DESCRIPTOR_WRITE_TOKEN, GATEWAY_STRICT_ERRORS, GATEWAY_ERROR_FORMAT,
+//	GATEWAY_METADATA_ALLOW, GATEWAY_METADATA_DENY, GATEWAY_CORS_ORIGINS, GATEWAY_RESPONSE_COMPRESSION,
+//	GATEWAY_TLS_CA_FILE, GATEWAY_TLS_CERT_FILE, GATEWAY_TLS_KEY_FILE, GATEWAY_TLS_SERVER_NAME,
+//	GATEWAY_TLS_INSECURE_SKIP_VERIFY, GATEWAY_DESCRIPTOR_DIR, GATEWAY_PRELOAD_DESCRIPTORS (comma-separated)
+//
+// Unset settings keep DefaultOptions. Settings that are code (Claims, sinks, queues, ...) are set on the
+// returned Options before passing them to Handler.
+func LoadOptions(path string) (Options, error) {
+	var fc fileConfig
+	if path == "" {
+		path = os.Getenv(configEnv)
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return Options{}, fmt.Errorf("read config: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+			return Options{}, fmt.Errorf("parse config %s: %w", path, err)
+		}
+	}
+	if err := fc.applyEnv(os.LookupEnv); err != nil {
+		return Options{}, err
+	}
+	return fc.options()
+}
+
+// applyEnv overrides fc with the GATEWAY_* variables found by lookup.
+func (fc *fileConfig) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v, ok := lookup(name); ok {
+			*dst = v
+		}
+	}
+	list := func(name string, dst *[]string) {
+		if v, ok := lookup(name); ok {
+			*dst = splitList(v)
+		}
+	}
+	boolean := func(name string, dst *bool) {
+		if v, ok := lookup(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+			*dst = b
+		}
+	}
+	str("GATEWAY_PATH", &fc.Path)
+	if v, ok := lookup("GATEWAY_TIMEOUT"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("GATEWAY_TIMEOUT: %w", err))
+		}
+		fc.Timeout = configDuration(d)
+	}
+	str("GATEWAY_DEFAULT_TARGET", &fc.DefaultTarget)
+	str("GATEWAY_PROXY", &fc.Proxy)
+	list("GATEWAY_ALLOWED_TARGETS", &fc.AllowedTargets)
+	str("GATEWAY_ADMIN_TOKEN", &fc.AdminToken)
+	str("GATEWAY_DESCRIPTOR_WRITE_TOKEN", &fc.DescriptorWriteToken)
+	boolean("GATEWAY_STRICT_ERRORS", &fc.StrictErrors)
+	str("GATEWAY_ERROR_FORMAT", &fc.ErrorFormat)
+	list("GATEWAY_METADATA_ALLOW", &fc.MetadataAllow)
+	list("GATEWAY_METADATA_DENY", &fc.MetadataDeny)
+	str("GATEWAY_DESCRIPTOR_DIR", &fc.DescriptorDir)
+	str("GATEWAY_CONTRACT_DIR", &fc.ContractDir)
+	list("GATEWAY_PRELOAD_DESCRIPTORS", &fc.PreloadDescriptors)
+	list("GATEWAY_BASE_DESCRIPTORS", &fc.BaseDescriptors)
+	list("GATEWAY_DESCRIPTOR_LAYERS", &fc.DescriptorLayers)
+	boolean("GATEWAY_RESPONSE_COMPRESSION", &fc.ResponseCompression)
+	if _, ok := lookup("GATEWAY_CORS_ORIGINS"); ok {
+		if fc.CORS == nil {
+			fc.CORS = &corsFileConfig{}
+		}
+		list("GATEWAY_CORS_ORIGINS", &fc.CORS.AllowedOrigins)
+	}
+	for _, name := range []string{"GATEWAY_TLS_CA_FILE", "GATEWAY_TLS_CERT_FILE", "GATEWAY_TLS_KEY_FILE", "GATEWAY_TLS_SERVER_NAME", "GATEWAY_TLS_INSECURE_SKIP_VERIFY"} {
+		if _, ok := lookup(name); ok && fc.TLS == nil {
+			fc.TLS = &tlsFileConfig{}
+		}
+	}
+	if fc.TLS != nil {
+		str("GATEWAY_TLS_CA_FILE", &fc.TLS.CAFile)
+		str("GATEWAY_TLS_CERT_FILE", &fc.TLS.CertFile)
+		str("GATEWAY_TLS_KEY_FILE", &fc.TLS.KeyFile)
+		str("GATEWAY_TLS_SERVER_NAME", &fc.TLS.ServerName)
+		boolean("GATEWAY_TLS_INSECURE_SKIP_VERIFY", &fc.TLS.InsecureSkipVerify)
+	}
+	return errors.Join(errs...)
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// options validates fc and converts it, starting from DefaultOptions.
+func (fc *fileConfig) options() (Options, error) {
+	opts := DefaultOptions()
+	var errs []error
+	if fc.Path != "" {
+		if !strings.HasPrefix(fc.Path, "/") {
+			errs = append(errs, fmt.Errorf("path %q must start with /", fc.Path))
+		}
+		opts.Path = fc.Path
+	}
+	if fc.Timeout < 0 {
+		errs = append(errs, errors.New("timeout must not be negative"))
+	}
+	opts.Timeout = time.Duration(fc.Timeout)
+	opts.DefaultTarget = fc.DefaultTarget
+	opts.AllowedTargets = fc.AllowedTargets
+	opts.AdminToken = fc.AdminToken
+	if fc.Profiling && fc.AdminToken == "" {
+		errs = append(errs, errors.New("profiling requires admin_token"))
+	}
+	opts.Profiling = fc.Profiling
+	opts.DescriptorWriteToken = fc.DescriptorWriteToken
+	opts.StrictErrors = fc.StrictErrors
+	opts.SymmetricResponses = fc.SymmetricResponses
+	opts.BidiStreaming = fc.BidiStreaming
+	opts.RequestEcho = fc.RequestEcho
+	if fc.DescriptorDir != "" {
+		if info, err := os.Stat(fc.DescriptorDir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("descriptor_dir %s is not a directory", fc.DescriptorDir))
+		}
+		opts.DescriptorFS = os.DirFS(fc.DescriptorDir)
+	}
+	if fc.ContractDir != "" {
+		opts.ContractSink = NewGoldenContractSink(fc.ContractDir)
+	}
+	opts.PreloadDescriptors = descriptorSources(fc.PreloadDescriptors)
+	opts.BaseDescriptors = descriptorSources(fc.BaseDescriptors)
+	if fc.DescriptorLayers != nil {
+		layers, err := core.ParseDescriptorLayers(fc.DescriptorLayers)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("descriptor_layers: %w", err))
+		}
+		opts.DescriptorLayers = layers
+	}
+	switch ErrorFormat(fc.ErrorFormat) {
+	case ErrorFormatJSON, ErrorFormatProblem:
+		opts.ErrorFormat = ErrorFormat(fc.ErrorFormat)
+	default:
+		errs = append(errs, fmt.Errorf("error_format %q must be empty or %q", fc.ErrorFormat, ErrorFormatProblem))
+	}
+	opts.ProblemTypeBase = fc.ProblemTypeBase
+	opts.MetadataAllow, opts.MetadataDeny = fc.MetadataAllow, fc.MetadataDeny
+	opts.ResponseCompression = fc.ResponseCompression
+	opts.UnknownFields = unknownFieldPolicy("unknown_fields", fc.UnknownFields, &errs)
+	switch p := core.FieldPresence(fc.FieldPresence); p {
+	case core.FieldPresenceDefault, core.FieldPresenceOmit, core.FieldPresenceNull:
+		opts.FieldPresence = p
+	default:
+		errs = append(errs, fmt.Errorf("field_presence %q must be empty, %q or %q", p, core.FieldPresenceOmit, core.FieldPresenceNull))
+	}
+	switch e := core.Int64Encoding(fc.Int64Encoding); e {
+	case core.Int64Default, core.Int64Strings, core.Int64Numbers:
+		opts.Int64Encoding = e
+	default:
+		errs = append(errs, fmt.Errorf("int64_encoding %q must be empty, %q or %q", e, core.Int64Strings, core.Int64Numbers))
+	}
+	opts.ResponseCompressionMinSize = fc.ResponseCompressionMinSize
+	if fc.MaxResponseBytes < 0 {
+		errs = append(errs, errors.New("max_response_bytes must not be negative"))
+	}
+	opts.MaxResponseBytes = fc.MaxResponseBytes
+	if fc.Proxy != "" {
+		if _, err := core.ParseProxyURL(fc.Proxy); err != nil {
+			errs = append(errs, err)
+		}
+		opts.Proxy = fc.Proxy
+	}
+	if hc := fc.HealthCheck; hc != nil {
+		if hc.Interval < 0 || hc.Timeout < 0 || hc.UnhealthyThreshold < 0 {
+			errs = append(errs, errors.New("health_check: interval, timeout and unhealthy_threshold must not be negative"))
+		}
+		opts.HealthCheck = &core.HealthCheckConfig{
+			Interval:           time.Duration(hc.Interval),
+			Timeout:            time.Duration(hc.Timeout),
+			Service:            hc.Service,
+			UnhealthyThreshold: hc.UnhealthyThreshold,
+		}
+	}
+	for _, f := range fc.Faults {
+		fault := Fault{Method: f.Method, Target: f.Target, Delay: time.Duration(f.Delay), DelayPercent: f.DelayPercent, AbortCode: f.AbortCode, AbortPercent: f.AbortPercent, Message: f.Message}
+		if err := fault.validate(); err != nil {
+			errs = append(errs, err)
+		}
+		opts.Faults = append(opts.Faults, fault)
+	}
+	for i, rc := range fc.Routes {
+		route := Route{Pattern: rc.Pattern, Method: rc.Method, Target: rc.Target, Fields: rc.Fields}
+		if _, err := compileRoute(route); err != nil {
+			errs = append(errs, fmt.Errorf("routes[%d]: %w", i, err))
+		}
+		opts.Routes = append(opts.Routes, route)
+	}
+	if rc := fc.Readiness; rc != nil {
+		if rc.Timeout < 0 || rc.RetryInterval < 0 {
+			errs = append(errs, errors.New("readiness: timeout and retry_interval must not be negative"))
+		}
+		opts.Readiness = &ReadinessConfig{Targets: rc.Targets, Timeout: time.Duration(rc.Timeout), RetryInterval: time.Duration(rc.RetryInterval)}
+		for i, w := range rc.WarmUp {
+			if _, _, err := core.ParseFullMethodName(w.Method); err != nil {
+				errs = append(errs, fmt.Errorf("readiness: warm_up %d: %w", i, err))
+				continue
+			}
+			call := WarmUpCall{Target: w.Target, Method: w.Method}
+			if w.Body != nil {
+				body, err := json.Marshal(w.Body)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("readiness: warm_up %d: body: %w", i, err))
+					continue
+				}
+				call.Body = body
+			}
+			opts.Readiness.WarmUp = append(opts.Readiness.WarmUp, call)
+		}
+	}
+	if c := fc.ClientIP; c != nil {
+		opts.ClientIP = &ClientIPConfig{TrustedProxies: c.TrustedProxies, Allow: c.Allow, Deny: c.Deny}
+		if _, err := newClientIPFilter(*opts.ClientIP); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if sc := fc.Signature; sc != nil {
+		if len(sc.Keys) == 0 {
+			errs = append(errs, errors.New("signature: keys are required"))
+		}
+		if _, err := signatureHash(SignatureConfig{Algorithm: sc.Algorithm}.withDefaults().Algorithm); err != nil {
+			errs = append(errs, fmt.Errorf("signature: %w", err))
+		}
+		if sc.MaxSkew < 0 {
+			errs = append(errs, errors.New("signature: max_skew must not be negative"))
+		}
+		keys := sc.Keys
+		opts.Signature = &SignatureConfig{
+			Keys: func(keyID string) ([]byte, bool) {
+				secret, ok := keys[keyID]
+				return []byte(secret), ok
+			},
+			Algorithm:       sc.Algorithm,
+			Header:          sc.Header,
+			KeyIDHeader:     sc.KeyIDHeader,
+			TimestampHeader: sc.TimestampHeader,
+			MaxSkew:         time.Duration(sc.MaxSkew),
+		}
+	}
+	if ec := fc.Encryption; ec != nil {
+		if len(ec.Keys) == 0 {
+			errs = append(errs, errors.New("encryption: keys are required"))
+		}
+		keys := make(map[string][]byte, len(ec.Keys))
+		for id, encoded := range ec.Keys {
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err == nil {
+				_, err = newBodyCipher(id, key)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("encryption: key %s: %w", id, err))
+				continue
+			}
+			keys[id] = key
+		}
+		opts.Encryption = &EncryptionConfig{
+			Keys: func(keyID string) ([]byte, bool) {
+				key, ok := keys[keyID]
+				return key, ok
+			},
+			Required: ec.Required,
+		}
+	}
+	if pc := fc.PII; pc != nil {
+		if pc.RequireEncryption && fc.Encryption == nil {
+			errs = append(errs, errors.New("pii.require_encryption needs encryption"))
+		}
+		opts.PII = &PIIPolicy{RequireEncryption: pc.RequireEncryption, TrustedIf: pc.TrustedIf}
+	}
+	if oc := fc.TargetOverride; oc != nil {
+		if oc.AllowIf == "" {
+			errs = append(errs, errors.New("target_override.allow_if is required"))
+		}
+		opts.TargetOverride = &TargetOverrideConfig{AllowIf: oc.AllowIf, Targets: oc.Targets}
+	}
+	opts.DescriptorCache = core.DescriptorCacheLimits{
+		MaxEntries: fc.DescriptorCache.MaxEntries,
+		MaxBytes:   fc.DescriptorCache.MaxBytes,
+		TTL:        time.Duration(fc.DescriptorCache.TTL),
+	}
+
+	if fc.TLS != nil || len(fc.Targets) > 0 {
+		opts.Targets = make(map[string]core.TargetConfig, len(fc.Targets)+1)
+	}
+	if fc.TLS != nil {
+		if _, ok := fc.Targets[defaultTargetKey]; !ok {
+			tc, err := targetFileConfig{}.targetConfig(fc.TLS)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			opts.Targets[defaultTargetKey] = tc
+		}
+	}
+	for name, t := range fc.Targets {
+		tls := t.TLS
+		if tls == nil {
+			tls = fc.TLS
+		}
+		tc, err := t.targetConfig(tls)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("targets[%s]: %w", name, err))
+		} else if core.IsXDSTarget(name) && tc.Transport == core.TransportGRPCWeb {
+			errs = append(errs, fmt.Errorf("targets[%s]: xDS targets cannot use transport %s", name, tc.Transport))
+		}
+		opts.Targets[name] = tc
+	}
+
+	opts.Methods = methodConfigs("methods", fc.Methods, &errs)
+
+	if c := fc.CORS; c != nil {
+		opts.CORS = &CORSConfig{
+			AllowedOrigins:   c.AllowedOrigins,
+			AllowedMethods:   c.AllowedMethods,
+			AllowedHeaders:   c.AllowedHeaders,
+			ExposedHeaders:   c.ExposedHeaders,
+			MaxAge:           time.Duration(c.MaxAge),
+			AllowCredentials: c.AllowCredentials,
+		}
+		if err := opts.CORS.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	opts.Quota = quotaConfig("quota", fc.Quota, &errs)
+	if c := fc.WKTCoercion; c != nil {
+		switch f := core.TimestampFormat(c.Timestamps); f {
+		case core.TimestampRFC3339, core.TimestampUnix, core.TimestampUnixMillis:
+		default:
+			errs = append(errs, fmt.Errorf("wkt_coercion.timestamps %q must be empty, %q or %q", f, core.TimestampUnix, core.TimestampUnixMillis))
+		}
+		opts.WKTCoercion = &core.WKTCoercion{Timestamps: core.TimestampFormat(c.Timestamps), DurationSeconds: c.DurationSeconds}
+	}
+	opts.TenantHeader = fc.TenantHeader
+	if len(fc.Tenants) > 0 {
+		opts.Tenants = make(map[string]TenantConfig, len(fc.Tenants))
+	}
+	for name, t := range fc.Tenants {
+		if name == "" || strings.Contains(name, "/") {
+			errs = append(errs, fmt.Errorf("tenants[%s]: name must be non-empty and must not contain /", name))
+		}
+		prefix := "tenants[" + name + "]."
+		opts.Tenants[name] = TenantConfig{
+			DefaultTarget:        t.DefaultTarget,
+			AllowedTargets:       t.AllowedTargets,
+			AdminToken:           t.AdminToken,
+			DescriptorWriteToken: t.DescriptorWriteToken,
+			Methods:              methodConfigs(prefix+"methods", t.Methods, &errs),
+			Quota:                quotaConfig(prefix+"quota", t.Quota, &errs),
+		}
+	}
+	if len(fc.Versions) > 0 {
+		if len(fc.Tenants) > 0 {
+			errs = append(errs, errors.New("versions cannot be combined with tenants"))
+		}
+		opts.Versions = make(map[string]APIVersion, len(fc.Versions))
+	}
+	for name, v := range fc.Versions {
+		if name == "" || strings.Contains(name, "/") {
+			errs = append(errs, fmt.Errorf("versions[%s]: name must be non-empty and must not contain /", name))
+		}
+		prefix := "versions[" + name + "]"
+		version := APIVersion{
+			DefaultTarget:      v.DefaultTarget,
+			AllowedTargets:     v.AllowedTargets,
+			PreloadDescriptors: descriptorSources(v.PreloadDescriptors),
+			Methods:            methodConfigs(prefix+".methods", v.Methods, &errs),
+			Deprecation:        deprecation(prefix, v.Deprecation, &errs),
+		}
+		if v.DescriptorDir != "" {
+			if info, err := os.Stat(v.DescriptorDir); err != nil || !info.IsDir() {
+				errs = append(errs, fmt.Errorf("%s.descriptor_dir %s is not a directory", prefix, v.DescriptorDir))
+			}
+			version.DescriptorFS = os.DirFS(v.DescriptorDir)
+		}
+		opts.Versions[name] = version
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Options{}, fmt.Errorf("invalid config: %w", err)
+	}
+	return opts, nil
+}
+
+// deprecation converts the deprecation section of field, appending its errors to errs.
+func deprecation(field string, d *deprecationConfig, errs *[]error) *Deprecation {
+	if d == nil {
+		return nil
+	}
+	if d.RejectAfterSunset && d.Sunset.IsZero() {
+		*errs = append(*errs, fmt.Errorf("%s.deprecation: reject_after_sunset requires a sunset", field))
+	}
+	return &Deprecation{Since: d.Since, Sunset: d.Sunset, Link: d.Link, RejectAfterSunset: d.RejectAfterSunset}
+}
+
+// methodConfigs converts the methods section named field, appending its errors to errs.
+func methodConfigs(field string, methods map[string]methodFileConfig, errs *[]error) map[string]MethodConfig {
+	if len(methods) == 0 {
+		return nil
+	}
+	out := make(map[string]MethodConfig, len(methods))
+	for name, m := range methods {
+		if m.Timeout < 0 || m.HedgeDelay < 0 {
+			*errs = append(*errs, fmt.Errorf("%s[%s]: durations must not be negative", field, name))
+		}
+		if m.FetchAllPages < 0 {
+			*errs = append(*errs, fmt.Errorf("%s[%s].fetch_all_pages must not be negative", field, name))
+		}
+		dep := deprecation(field+"["+name+"]", m.Deprecation, errs)
+		var affinity *AffinityConfig
+		if a := m.Affinity; a != nil {
+			if a.Header == "" && a.Field == "" {
+				*errs = append(*errs, fmt.Errorf("%s[%s].affinity needs a header or field", field, name))
+			}
+			affinity = &AffinityConfig{Header: a.Header, Field: a.Field}
+		}
+		var mock *MockConfig
+		if mc := m.Mock; mc != nil {
+			mock = &MockConfig{
+				Enabled:      mc.Enabled,
+				Latency:      time.Duration(mc.Latency),
+				Jitter:       time.Duration(mc.Jitter),
+				ErrorRate:    mc.ErrorRate,
+				ErrorCode:    mc.ErrorCode,
+				ErrorMessage: mc.ErrorMessage,
+			}
+			switch resp := mc.Response.(type) {
+			case nil:
+			case string:
+				mock.Response = resp
+			default:
+				b, err := json.Marshal(resp)
+				if err != nil {
+					*errs = append(*errs, fmt.Errorf("%s[%s].mock.response: %w", field, name, err))
+				}
+				mock.Response = string(b)
+			}
+			if mc.ErrorRate < 0 || mc.ErrorRate > 1 || mc.Latency < 0 || mc.Jitter < 0 {
+				*errs = append(*errs, fmt.Errorf("%s[%s].mock: error_rate must be in [0, 1] and latency and jitter must not be negative", field, name))
+			}
+			if _, ok := grpcCodeByName(mc.ErrorCode); !ok {
+				*errs = append(*errs, fmt.Errorf("%s[%s].mock.error_code: unknown gRPC code %q", field, name, mc.ErrorCode))
+			}
+		}
+		var multipart *MultipartConfig
+		if mp := m.Multipart; mp != nil {
+			multipart = &MultipartConfig{Fields: mp.Fields, FileNames: mp.FileNames}
+		}
+		var raw *RawResponse
+		if rc := m.RawResponse; rc != nil {
+			if rc.Field == "" {
+				*errs = append(*errs, fmt.Errorf("%s[%s].raw_response.field is required", field, name))
+			}
+			raw = &RawResponse{Field: rc.Field, ContentType: rc.ContentType, ContentTypeField: rc.ContentTypeField}
+		}
+		if m.SlowThreshold < 0 {
+			*errs = append(*errs, fmt.Errorf("%s[%s].slow_threshold must not be negative", field, name))
+		}
+		out[name] = MethodConfig{
+			Timeout:          time.Duration(m.Timeout),
+			RenameFields:     m.RenameFields,
+			ResponseEnvelope: m.ResponseEnvelope,
+			ResponseHeaders:  m.ResponseHeaders,
+			Authorize:        m.Authorize,
+			VisibleIf:        m.VisibleIf,
+			PII:              m.PII,
+			Audit:            m.Audit,
+			Record:           m.Record,
+			Redact:           m.Redact,
+			Hedge:            core.HedgeConfig{Delay: time.Duration(m.HedgeDelay)},
+			Coalesce:         m.Coalesce,
+			LenientEnums:     m.LenientEnums,
+			UnknownFields:    unknownFieldPolicy(field+"["+name+"].unknown_fields", m.UnknownFields, errs),
+			Defaults:         m.Defaults,
+			FetchAllPages:    m.FetchAllPages,
+			Affinity:         affinity,
+			ETag:             m.ETag,
+			Deprecation:      dep,
+			Mock:             mock,
+			Multipart:        multipart,
+			RawResponse:      raw,
+			SlowThreshold:    time.Duration(m.SlowThreshold),
+		}
+	}
+	// Templates are parsed as Handler will, so that they fail here rather than on traffic.
+	if err := newResponseTransformer(Options{Methods: out}).err(); err != nil {
+		*errs = append(*errs, fmt.Errorf("%s: %w", field, err))
+	}
+	return out
+}
+
+// unknownFieldPolicy validates the unknown-field policy v of field, appending its error to errs.
+func unknownFieldPolicy(field, v string, errs *[]error) core.UnknownFieldPolicy {
+	switch p := core.UnknownFieldPolicy(v); p {
+	case "", core.UnknownFieldsReject, core.UnknownFieldsDrop, core.UnknownFieldsWarn:
+		return p
+	}
+	*errs = append(*errs, fmt.Errorf("%s %q must be %q, %q or %q", field, v, core.UnknownFieldsReject, core.UnknownFieldsDrop, core.UnknownFieldsWarn))
+	return ""
+}
+
+// quotaConfig converts the quota section named field, appending its errors to errs.
+func quotaConfig(field string, limits []quotaLimitFileConfig, errs *[]error) *QuotaConfig {
+	if len(limits) == 0 {
+		return nil
+	}
+	q := &QuotaConfig{}
+	for i, l := range limits {
+		if l.Window <= 0 {
+			*errs = append(*errs, fmt.Errorf("%s[%d]: window must be positive", field, i))
+		}
+		q.Limits = append(q.Limits, QuotaLimit{Name: l.Name, Window: time.Duration(l.Window), MaxCalls: l.MaxCalls, MaxBytes: l.MaxBytes})
+	}
+	return q
+}
+
+// defaultTargetKey is the Targets entry applying to targets without their own.
+const defaultTargetKey = "*"
+
+func (t targetFileConfig) targetConfig(tlsConfig *tlsFileConfig) (core.TargetConfig, error) {
+	tc := core.TargetConfig{
+		KeepaliveTime:          time.Duration(t.KeepaliveTime),
+		KeepaliveTimeout:       time.Duration(t.KeepaliveTimeout),
+		KeepaliveWithoutStream: t.KeepaliveWithoutStream,
+		MaxRecvMsgSize:         t.MaxRecvMsgSize,
+		MaxSendMsgSize:         t.MaxSendMsgSize,
+		Authority:              t.Authority,
+		UserAgent:              t.UserAgent,
+		Compression:            t.Compression,
+		WaitForReady:           t.WaitForReady,
+		Transport:              core.Transport(t.Transport),
+		MaxInFlight:            t.MaxInFlight,
+		QueueTimeout:           time.Duration(t.QueueTimeout),
+		ConsistentHash:         t.ConsistentHash,
+		Proxy:                  t.Proxy,
+	}
+	if t.MaxInFlight < 0 || t.QueueTimeout < 0 || t.MaxRecvMsgSize < 0 || t.MaxSendMsgSize < 0 {
+		return tc, errors.New("max_in_flight, queue_timeout, max_recv_msg_size and max_send_msg_size must not be negative")
+	}
+	if t.Compression != "" && encoding.GetCompressor(t.Compression) == nil {
+		return tc, fmt.Errorf("unknown compression %q", t.Compression)
+	}
+	switch tc.Transport {
+	case core.TransportGRPC, core.TransportGRPCWeb:
+	default:
+		return tc, fmt.Errorf("unknown transport %q", t.Transport)
+	}
+	if t.Proxy != "" && t.Proxy != core.ProxyDirect {
+		if _, err := core.ParseProxyURL(t.Proxy); err != nil {
+			return tc, err
+		}
+	}
+	if tlsConfig != nil {
+		cfg, err := tlsConfig.config()
+		if err != nil {
+			return tc, err
+		}
+		tc.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(cfg))}
+	}
+	return tc, nil
+}
+
+func (c *tlsFileConfig) config() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls ca_file: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls ca_file %s: no PEM certificates", c.CAFile)
+		}
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("tls cert_file and key_file must be set together")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// descriptorSources turns the descriptor set paths, globs and http(s) URLs of a file config into sources.
+func descriptorSources(list []string) []DescriptorSource {
+	var out []DescriptorSource
+	for _, src := range list {
+		if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+			out = append(out, DescriptorSource{URL: src})
+		} else {
+			out = append(out, DescriptorSource{Path: src})
+		}
+	}
+	return out
+}
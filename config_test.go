@@ -0,0 +1,300 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadOptions_FileAndEnv(t *testing.T) {
+	path := writeConfig(t, "gateway.yaml", `
+path: /rpc
+timeout: 3s
+default_target: users:9000
+allowed_targets: ["users:*", "billing:9000"]
+error_format: problem+json
+field_presence: omit
+int64_encoding: number
+proxy: http://proxy.corp:3128
+targets:
+  users:9000:
+    authority: users.internal
+    keepalive_time: 30s
+    max_in_flight: 64
+    queue_timeout: 200ms
+    compression: gzip
+    max_send_msg_size: 16777216
+    wait_for_ready: true
+    consistent_hash: true
+    proxy: direct
+methods:
+  /echo.EchoService/Echo:
+    timeout: 500ms
+    hedge_delay: 50ms
+    coalesce: true
+    lenient_enums: true
+    redact: [secret]
+    defaults: {page_size: 20}
+    fetch_all_pages: 10
+    response_headers: {Cache-Control: "max-age=60"}
+    etag: true
+    record: true
+    mock: {enabled: true, response: {message: mocked}, latency: 100ms, error_rate: 0.1, error_code: Unavailable}
+    multipart: {fields: {file: message}, file_names: {file: name}}
+    raw_response: {field: data, content_type: application/pdf, content_type_field: mimeType}
+    slow_threshold: 750ms
+    visible_if: {email: "'admin' in claims.roles"}
+    pii: [email]
+    affinity: {header: X-User-Id, field: user_id}
+    deprecation: {since: 2026-01-01, sunset: 2026-06-30, link: "https://docs.example.com/echo-v2", reject_after_sunset: true}
+cors:
+  allowed_origins: ["https://app.example.com"]
+quota:
+  - name: daily
+    window: 24h
+    max_calls: 1000
+wkt_coercion: {timestamps: unix_ms}
+health_check: {interval: 15s, service: users.v1.Users}
+faults:
+  - {method: /users.v1.Users/Get, delay: 250ms, delay_percent: 10}
+routes:
+  - {pattern: "POST /api/orders", method: /orders.OrderService/CreateOrder, target: orders:443, fields: {channel: web}}
+readiness:
+  timeout: 2s
+  warm_up:
+    - {method: /users.v1.Users/Get, body: {id: warm}}
+signature: {algorithm: hmac-sha512, max_skew: 1m, keys: {k1: s3cret}}
+client_ip: {trusted_proxies: [10.0.0.0/8], deny: [203.0.113.7]}
+symmetric_responses: true
+bidi_streaming: true
+request_echo: true
+encryption: {required: true, keys: {k1: MDEyMzQ1Njc4OWFiY2RlZg==}}
+pii: {require_encryption: true, trusted_if: "'pii' in claims.scopes"}
+target_override: {allow_if: "'staff' in claims.roles", targets: [dev-*]}
+preload_descriptors: [descriptors/*.pb, "https://schemas.example.com/users.pb"]
+base_descriptors: [common/*.pb]
+contract_dir: testdata/contracts
+descriptor_layers: [local, cache, directory]
+tenant_header: X-Tenant
+tenants:
+  search:
+    allowed_targets: ["search:*"]
+    quota:
+      - {name: minute, window: 1m, max_calls: 60}
+`)
+	t.Setenv("GATEWAY_TIMEOUT", "5s")
+	t.Setenv("GATEWAY_DESCRIPTOR_DIR", t.TempDir())
+	t.Setenv("GATEWAY_METADATA_ALLOW", "x-tenant, x-trace-*")
+
+	opts, err := LoadOptions(path)
+	if err != nil {
+		t.Fatalf("LoadOptions: %v", err)
+	}
+	if opts.Path != "/rpc" || opts.Timeout != 5*time.Second || opts.DefaultTarget != "users:9000" || opts.ErrorFormat != ErrorFormatProblem || opts.FieldPresence != core.FieldPresenceOmit || opts.Int64Encoding != core.Int64Numbers {
+		t.Fatalf("top-level settings: %+v", opts)
+	}
+	if len(opts.AllowedTargets) != 2 || len(opts.MetadataAllow) != 2 || opts.MetadataAllow[1] != "x-trace-*" {
+		t.Fatalf("lists: allowed=%v metadata=%v", opts.AllowedTargets, opts.MetadataAllow)
+	}
+	if tc := opts.Targets["users:9000"]; tc.Authority != "users.internal" || tc.KeepaliveTime != 30*time.Second || tc.MaxInFlight != 64 || tc.QueueTimeout != 200*time.Millisecond || tc.Compression != "gzip" || tc.MaxSendMsgSize != 16<<20 || !tc.WaitForReady || !tc.ConsistentHash || tc.Proxy != core.ProxyDirect || opts.Proxy != "http://proxy.corp:3128" {
+		t.Fatalf("target config: %+v", tc)
+	}
+	if mc := opts.Methods["/echo.EchoService/Echo"]; mc.Timeout != 500*time.Millisecond || mc.Hedge.Delay != 50*time.Millisecond || !mc.Coalesce || !mc.LenientEnums || len(mc.Redact) != 1 || mc.Defaults["page_size"] != 20 || mc.FetchAllPages != 10 || mc.ResponseHeaders["Cache-Control"] != "max-age=60" || !mc.ETag || !mc.Record || mc.Mock == nil || mc.Mock.Response != `{"message":"mocked"}` || mc.Mock.Latency != 100*time.Millisecond || mc.Multipart == nil || mc.Multipart.Fields["file"] != "message" || mc.Multipart.FileNames["file"] != "name" || mc.RawResponse == nil || mc.RawResponse.Field != "data" || mc.RawResponse.ContentType != "application/pdf" || mc.RawResponse.ContentTypeField != "mimeType" || mc.SlowThreshold != 750*time.Millisecond || mc.VisibleIf["email"] != "'admin' in claims.roles" || len(mc.PII) != 1 || mc.Affinity == nil || mc.Affinity.Header != "X-User-Id" || mc.Affinity.Field != "user_id" {
+		t.Fatalf("method config: %+v", mc)
+	}
+	if dep := opts.Methods["/echo.EchoService/Echo"].Deprecation; dep == nil || !dep.Sunset.Equal(time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC)) || !dep.RejectAfterSunset || dep.Link == "" {
+		t.Fatalf("deprecation: %+v", dep)
+	}
+	if opts.CORS == nil || opts.CORS.AllowedOrigins[0] != "https://app.example.com" {
+		t.Fatalf("cors: %+v", opts.CORS)
+	}
+	if opts.Quota == nil || opts.Quota.Limits[0].Window != 24*time.Hour || opts.Quota.Limits[0].MaxCalls != 1000 {
+		t.Fatalf("quota: %+v", opts.Quota)
+	}
+	if opts.WKTCoercion == nil || opts.WKTCoercion.Timestamps != core.TimestampUnixMillis {
+		t.Fatalf("wkt_coercion: %+v", opts.WKTCoercion)
+	}
+	if hc := opts.HealthCheck; hc == nil || hc.Interval != 15*time.Second || hc.Service != "users.v1.Users" {
+		t.Fatalf("health_check: %+v", hc)
+	}
+	if f := opts.Faults; len(f) != 1 || f[0].Delay != 250*time.Millisecond || f[0].DelayPercent != 10 {
+		t.Fatalf("faults: %+v", f)
+	}
+	if rc := opts.Readiness; rc == nil || rc.Timeout != 2*time.Second || len(rc.WarmUp) != 1 || string(rc.WarmUp[0].Body) != `{"id":"warm"}` {
+		t.Fatalf("readiness: %+v", rc)
+	}
+	if sc := opts.Signature; sc == nil || sc.Algorithm != SignatureHMACSHA512 || sc.MaxSkew != time.Minute {
+		t.Fatalf("signature: %+v", sc)
+	} else if secret, ok := sc.Keys("k1"); !ok || string(secret) != "s3cret" {
+		t.Fatal("signature key k1 not found")
+	}
+	if !opts.SymmetricResponses {
+		t.Fatal("symmetric_responses not set")
+	}
+	if !opts.BidiStreaming {
+		t.Fatal("bidi_streaming not set")
+	}
+	if !opts.RequestEcho {
+		t.Fatal("request_echo not set")
+	}
+	if oc := opts.TargetOverride; oc == nil || oc.AllowIf != "'staff' in claims.roles" || len(oc.Targets) != 1 {
+		t.Fatalf("target_override: %+v", oc)
+	}
+	if r := opts.Routes; len(r) != 1 || r[0].Pattern != "POST /api/orders" || r[0].Target != "orders:443" || r[0].Fields["channel"] != "web" {
+		t.Fatalf("routes: %+v", r)
+	}
+	if ec := opts.Encryption; ec == nil || !ec.Required {
+		t.Fatalf("encryption: %+v", ec)
+	} else if key, ok := ec.Keys("k1"); !ok || string(key) != "0123456789abcdef" {
+		t.Fatal("encryption key k1 not found")
+	}
+	if p := opts.PII; p == nil || !p.RequireEncryption || p.TrustedIf != "'pii' in claims.scopes" {
+		t.Fatalf("pii: %+v", p)
+	}
+	if ip := opts.ClientIP; ip == nil || ip.TrustedProxies[0] != "10.0.0.0/8" || ip.Deny[0] != "203.0.113.7" {
+		t.Fatalf("client_ip: %+v", ip)
+	}
+	if opts.DescriptorFS == nil {
+		t.Fatal("descriptor_dir not set")
+	}
+	if pd := opts.PreloadDescriptors; len(pd) != 2 || pd[0].Path != "descriptors/*.pb" || pd[1].URL != "https://schemas.example.com/users.pb" {
+		t.Fatalf("preload_descriptors: %+v", pd)
+	}
+	if bd := opts.BaseDescriptors; len(bd) != 1 || bd[0].Path != "common/*.pb" {
+		t.Fatalf("base_descriptors: %+v", bd)
+	}
+	if cs, ok := opts.ContractSink.(*goldenContractSink); !ok || cs.dir != "testdata/contracts" {
+		t.Fatalf("contract_dir: %#v", opts.ContractSink)
+	}
+	if dl := opts.DescriptorLayers; len(dl) != 3 || dl[1] != core.LayerCache {
+		t.Fatalf("descriptor_layers: %v", dl)
+	}
+	if tc := opts.Tenants["search"]; opts.TenantHeader != "X-Tenant" || len(tc.AllowedTargets) != 1 || tc.Quota == nil || tc.Quota.Limits[0].Window != time.Minute {
+		t.Fatalf("tenants: header=%q %+v", opts.TenantHeader, opts.Tenants)
+	}
+}
+
+func TestLoadOptions_EnvOnlyKeepsDefaults(t *testing.T) {
+	t.Setenv("GATEWAY_CONFIG", "")
+	t.Setenv("GATEWAY_DEFAULT_TARGET", "localhost:50051")
+	opts, err := LoadOptions("")
+	if err != nil {
+		t.Fatalf("LoadOptions: %v", err)
+	}
+	if opts.Path != DefaultOptions().Path || opts.DefaultTarget != "localhost:50051" {
+		t.Fatalf("opts = %+v", opts)
+	}
+}
+
+func TestLoadOptions_Versions(t *testing.T) {
+	opts, err := LoadOptions(writeConfig(t, "gateway.yaml", `
+path: /api
+versions:
+  v1:
+    default_target: orders-v1:443
+    preload_descriptors: [descriptors/v1/*.pb]
+    deprecation: {sunset: 2026-12-31, reject_after_sunset: true, link: "https://docs.example.com/v2"}
+  v2:
+    default_target: orders-v2:443
+    methods: {/orders.OrderService/CreateOrder: {timeout: 3s}}
+`))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	v1, v2 := opts.Versions["v1"], opts.Versions["v2"]
+	if v1.DefaultTarget != "orders-v1:443" || len(v1.PreloadDescriptors) != 1 || v1.PreloadDescriptors[0].Path != "descriptors/v1/*.pb" {
+		t.Fatalf("v1: %+v", v1)
+	}
+	if d := v1.Deprecation; d == nil || !d.RejectAfterSunset || !d.Sunset.Equal(time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("v1 deprecation: %+v", d)
+	}
+	if v2.Deprecation != nil || v2.Methods["/orders.OrderService/CreateOrder"].Timeout != 3*time.Second {
+		t.Fatalf("v2: %+v", v2)
+	}
+}
+
+func TestLoadOptions_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown field":  "pat: /rpc\n",
+		"bad duration":   "timeout: soon\n",
+		"relative path":  "path: rpc\n",
+		"error format":   "error_format: xml\n",
+		"field presence": "field_presence: empty\n",
+		"int64 encoding": "int64_encoding: float\n",
+		"quota window":   "quota: [{name: x, max_calls: 1}]\n",
+		"missing ca":     "tls: {ca_file: /nonexistent/ca.pem}\n",
+		"half key pair":  "tls: {cert_file: c.pem}\n",
+		"transport":      "targets: {a: {transport: quic}}\n",
+		"compression":    "targets: {a: {compression: brotli}}\n",
+		"negative delay": "methods: {/a.B/C: {hedge_delay: -1s}}\n",
+		"tenant name":    "tenants: {a/b: {}}\n",
+		"wkt timestamps": "wkt_coercion: {timestamps: iso}\n",
+		"unknown fields": "methods: {/a.B/C: {unknown_fields: ignore}}\n",
+		"tenant quota":   "tenants: {a: {quota: [{name: x}]}}\n",
+		"profiling":      "profiling: true\n",
+		"descriptor dir": "descriptor_dir: /nonexistent\n",
+		"sunset":         "methods: {/a.B/C: {deprecation: {reject_after_sunset: true}}}\n",
+		"signature keys": "signature: {algorithm: hmac-sha256}\n",
+		"signature alg":  "signature: {algorithm: md5, keys: {k: s}}\n",
+		"client ip":      "client_ip: {allow: [10.0.0.0/33]}\n",
+		"encryption key": "encryption: {keys: {k1: c2hvcnQ=}}\n",
+		"pii encryption": "pii: {require_encryption: true}\n",
+		"layer":          "descriptor_layers: [directory, bsr]\n",
+		"warm-up method": "readiness: {warm_up: [{method: Get}]}\n",
+		"mock code":      "methods: {/a.B/C: {mock: {error_rate: 0.5, error_code: Oops}}}\n",
+		"mock rate":      "methods: {/a.B/C: {mock: {error_rate: 2}}}\n",
+		"raw response":   "methods: {/a.B/C: {raw_response: {content_type: text/plain}}}\n",
+		"slow threshold": "methods: {/a.B/C: {slow_threshold: -1s}}\n",
+		"fault":          "faults: [{method: /a.B/C, abort_percent: 50}]\n",
+		"route pattern":  "routes: [{pattern: GET api/orders, method: /a.B/C}]\n",
+		"route method":   "routes: [{pattern: GET /api/orders, method: C}]\n",
+		"version name":   "versions: {v1/beta: {}}\n",
+		"override rule":  "target_override: {targets: [dev-*]}\n",
+		"affinity":       "methods: {/a.B/C: {affinity: {}}}\n",
+		"proxy":          "proxy: ftp://p:1\n",
+		"target proxy":   "targets: {a: {proxy: socks5://}}\n",
+		"xds grpc-web":   "targets: {\"xds:///a\": {transport: grpc-web}}\n",
+		"version sunset": "versions: {v1: {deprecation: {reject_after_sunset: true}}}\n",
+		"version tenant": "versions: {v1: {}}\ntenants: {a: {}}\n",
+		"envelope":       "methods: {/a.B/C: {response_envelope: \"{{.Response\"}}\n",
+		"cors wildcard":  "cors: {allowed_origins: [\"*\"], allow_credentials: true}\n",
+	} {
+		if _, err := LoadOptions(writeConfig(t, "gateway.yaml", content)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	t.Setenv("GATEWAY_STRICT_ERRORS", "maybe")
+	if _, err := LoadOptions(writeConfig(t, "gateway.json", `{"path": "/rpc"}`)); err == nil || !strings.Contains(err.Error(), "GATEWAY_STRICT_ERRORS") {
+		t.Fatalf("bad env bool: %v", err)
+	}
+}
+
+func TestGateway_AllowedTargets(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{AllowedTargets: []string{"127.0.0.1:*"}}))
+	defer srv.Close()
+
+	if code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil); code != http.StatusOK {
+		t.Fatalf("allowed: status=%d body=%s", code, b)
+	}
+	if code, b := postGateway(t, srv.URL, map[string]any{"target": "metadata.internal:80", "method": "/echo.EchoService/Echo"}, nil); code != http.StatusForbidden {
+		t.Fatalf("disallowed: status=%d body=%s", code, b)
+	}
+}
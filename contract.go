@@ -0,0 +1,247 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc/status"
+)
+
+// ContractRecord is a recorded call of a method with MethodConfig.Record, for contract and regression tests
+// that replay it with ReplayContract. Request and response are the messages in the proto3 JSON mapping,
+// redacted like audit records. Records carry no time, target or request ID, so recordings of the same
+// exchange are equal.
+type ContractRecord struct {
+	Method   string          `json:"method"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	GRPCCode string          `json:"grpc_code"` // "OK" on success
+}
+
+// ContractSink stores contract records, e.g. as golden files (NewGoldenContractSink) or by POSTing them to a
+// collector (WebhookContractSink). It is called synchronously after the upstream call.
+type ContractSink interface {
+	WriteContract(ctx context.Context, rec *ContractRecord) error
+}
+
+// ContractSinkFunc adapts a function to ContractSink.
+type ContractSinkFunc func(ctx context.Context, rec *ContractRecord) error
+
+func (f ContractSinkFunc) WriteContract(ctx context.Context, rec *ContractRecord) error {
+	return f(ctx, rec)
+}
+
+// NewGoldenContractSink returns a sink that appends records as JSON lines to golden files under dir, one per
+// method: {dir}/{package.Service}/{Method}.jsonl. Records already in the file are not written again, so
+// repeated test runs or production traffic only add new exchanges.
+func NewGoldenContractSink(dir string) ContractSink {
+	return &goldenContractSink{dir: dir, seen: make(map[string]map[string]bool)}
+}
+
+type goldenContractSink struct {
+	dir  string
+	mu   sync.Mutex
+	seen map[string]map[string]bool // record lines by file, loaded on the first write to it
+}
+
+func (s *goldenContractSink) WriteContract(_ context.Context, rec *ContractRecord) error {
+	service, method, err := core.ParseFullMethodName(rec.Method)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, service, method+".jsonl")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seen, ok := s.seen[path]
+	if !ok {
+		seen = make(map[string]bool)
+		recs, err := readContractFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		for _, r := range recs {
+			if b, err := json.Marshal(r); err == nil {
+				seen[string(b)] = true
+			}
+		}
+		s.seen[path] = seen
+	}
+	if seen[string(line)] {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	seen[string(line)] = true
+	return nil
+}
+
+// WebhookContractSink POSTs each record as JSON to URL.
+type WebhookContractSink struct {
+	URL    string
+	Header http.Header  // extra request headers, e.g. Authorization
+	Client *http.Client // nil means http.DefaultClient
+}
+
+func (s *WebhookContractSink) WriteContract(ctx context.Context, rec *ContractRecord) error {
+	return postJSON(ctx, s.Client, s.URL, s.Header, rec, "contract webhook")
+}
+
+// LoadContracts reads the golden files written by NewGoldenContractSink under dir, ordered by method.
+func LoadContracts(dir string) ([]*ContractRecord, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(path, ".jsonl") {
+			paths = append(paths, path)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var out []*ContractRecord
+	for _, path := range paths {
+		recs, err := readContractFile(path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, recs...)
+	}
+	return out, nil
+}
+
+func readContractFile(path string) ([]*ContractRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []*ContractRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, maxDecompressedBody)
+	for n := 1; sc.Scan(); n++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var rec ContractRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		out = append(out, &rec)
+	}
+	return out, sc.Err()
+}
+
+// ReplayContract calls rec's method on target through Handler(opts)'s upstream invoker with the recorded
+// request and compares the outcome with the recording: the gRPC code, and for successful calls the response
+// message, redacted as when recording. Fields are compared by value, so key order and formatting do not
+// matter. Recorded requests are sent as recorded, so replay methods whose requests have redacted fields
+// against upstreams that accept RedactedValue in them.
+func ReplayContract(ctx context.Context, opts Options, target string, rec *ContractRecord) error {
+	h := newHandler(opts, "")
+	defer h.inv.Close()
+	call := &contractCall{opts: opts, all: true}
+	_, err := h.inv.Invoke(ctx, &core.InvokeRequest{
+		Target:         target,
+		FullMethodName: rec.Method,
+		Body:           rec.Request,
+		Capture:        call.capture,
+	})
+	if code := status.Code(err).String(); code != rec.GRPCCode {
+		return fmt.Errorf("contract %s: grpc code %s, recorded %s (%v)", rec.Method, code, rec.GRPCCode, err)
+	}
+	if err != nil {
+		return nil
+	}
+	var got json.RawMessage
+	if call.rec != nil {
+		got = call.rec.Response
+	}
+	if !jsonEqual(got, rec.Response) {
+		return fmt.Errorf("contract %s: response %s, recorded %s", rec.Method, got, rec.Response)
+	}
+	return nil
+}
+
+// jsonEqual reports whether a and b encode the same JSON value.
+func jsonEqual(a, b []byte) bool {
+	var va, vb any
+	da, db := json.NewDecoder(bytes.NewReader(a)), json.NewDecoder(bytes.NewReader(b))
+	da.UseNumber()
+	db.UseNumber()
+	if da.Decode(&va) != nil || db.Decode(&vb) != nil {
+		return bytes.Equal(bytes.TrimSpace(a), bytes.TrimSpace(b))
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// contractCall collects the contract record of one call; its capture method is a core.InvokeRequest.Capture
+// hook. rec stays nil unless the resolved method is recorded (or all is set).
+type contractCall struct {
+	opts Options
+	all  bool
+	rec  *ContractRecord
+}
+
+func (c *contractCall) capture(md *desc.MethodDescriptor, request, response []byte) {
+	method := "/" + md.GetService().GetFullyQualifiedName() + "/" + md.GetName()
+	mc := c.opts.methodConfig(method)
+	if !mc.Record && !c.all {
+		return
+	}
+	c.rec = &ContractRecord{
+		Method:   method,
+		Request:  redactPayload(md.GetInputType(), request, mc.redactPaths()),
+		Response: redactPayload(md.GetOutputType(), response, mc.redactPaths()),
+	}
+}
+
+// writeContract completes rec with the outcome of the call and hands it to the sink, detached from the
+// request context like audit records.
+func (h *handler) writeContract(ctx context.Context, rec *ContractRecord, err error) {
+	rec.GRPCCode = status.Code(err).String()
+	if werr := h.opts.ContractSink.WriteContract(context.WithoutCancel(ctx), rec); werr != nil {
+		h.metrics.Add("gateway_contract_errors_total", 1, "method", rec.Method)
+	}
+}
+
+// chainCapture returns a core.InvokeRequest.Capture hook calling first (if set) and then next.
+func chainCapture(first, next func(md *desc.MethodDescriptor, request, response []byte)) func(md *desc.MethodDescriptor, request, response []byte) {
+	if first == nil {
+		return next
+	}
+	return func(md *desc.MethodDescriptor, request, response []byte) {
+		first(md, request, response)
+		next(md, request, response)
+	}
+}
@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGateway_ContractRecording(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	dir := t.TempDir()
+	opts := Options{
+		ContractSink: NewGoldenContractSink(dir),
+		Methods: map[string]MethodConfig{
+			"/echo.EchoService/Echo": {Record: true},
+		},
+	}
+	srv := httptest.NewServer(Handler(opts))
+	defer srv.Close()
+
+	// The repeated exchange is recorded once.
+	for _, msg := range []string{"hi", "hi", "bye"} {
+		body := map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": msg}}
+		if code, b := postGateway(t, srv.URL, body, nil); code != http.StatusOK {
+			t.Fatalf("status=%d body=%s", code, b)
+		}
+	}
+	golden, err := os.ReadFile(filepath.Join(dir, "echo.EchoService", "Echo.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(golden)), "\n"); len(lines) != 2 || lines[0] != `{"method":"/echo.EchoService/Echo","request":{"message":"hi"},"response":{"message":"hi"},"grpc_code":"OK"}` {
+		t.Fatalf("golden file:\n%s", golden)
+	}
+
+	recs, err := LoadContracts(dir)
+	if err != nil || len(recs) != 2 {
+		t.Fatalf("load: %d records, %v", len(recs), err)
+	}
+	for _, rec := range recs {
+		if err := ReplayContract(context.Background(), opts, target, rec); err != nil {
+			t.Errorf("replay: %v", err)
+		}
+	}
+	changed := *recs[0]
+	changed.Response = json.RawMessage(`{"message":"hello"}`)
+	if err := ReplayContract(context.Background(), opts, target, &changed); err == nil || !strings.Contains(err.Error(), `recorded {"message":"hello"}`) {
+		t.Fatalf("changed response: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+// consistentHashPolicy is the name of the load balancing policy of targets with TargetConfig.ConsistentHash.
+const consistentHashPolicy = "gateway_consistent_hash"
+
+// ringReplicas is the number of points each endpoint has on the hash ring; more points spread keys more
+// evenly across endpoints.
+const ringReplicas = 100
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(consistentHashPolicy, consistentHashPickerBuilder{}, base.Config{HealthCheck: true}))
+}
+
+// consistentHashDialOption selects the consistent-hash policy for a channel.
+func consistentHashDialOption() grpc.DialOption {
+	return grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"` + consistentHashPolicy + `": {}}]}`)
+}
+
+type affinityKeyContextKey struct{}
+
+// withAffinityKey returns a context whose calls the consistent-hash policy routes by key.
+func withAffinityKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, affinityKeyContextKey{}, key)
+}
+
+// affinityKey returns the key of the call of req with request message msg: AffinityKey, or the value of
+// AffinityField in msg. Unset fields give no key.
+func (req *InvokeRequest) affinityKey(msg proto.Message) string {
+	if req.AffinityKey != "" || req.AffinityField == "" {
+		return req.AffinityKey
+	}
+	dm, ok := msg.(*dynamic.Message)
+	if !ok {
+		return ""
+	}
+	path := strings.Split(req.AffinityField, ".")
+	for i, name := range path {
+		md := dm.GetMessageDescriptor()
+		fd := md.FindFieldByJSONName(name)
+		if fd == nil {
+			fd = md.FindFieldByName(name)
+		}
+		if fd == nil || fd.IsRepeated() || !dm.HasField(fd) {
+			return ""
+		}
+		v := dm.GetField(fd)
+		if i == len(path)-1 {
+			return fmt.Sprint(v)
+		}
+		if dm, ok = v.(*dynamic.Message); !ok {
+			return ""
+		}
+	}
+	return ""
+}
+
+// consistentHashPickerBuilder builds pickers that send calls with an affinity key to the endpoint the key
+// hashes to on a ring of the ready endpoints, so that a key keeps its endpoint as long as that endpoint is
+// ready, and only the keys of an endpoint that goes away move. Calls without a key are spread round-robin.
+type consistentHashPickerBuilder struct{}
+
+type ringPoint struct {
+	hash uint64
+	sc   balancer.SubConn
+}
+
+func (consistentHashPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &consistentHashPicker{}
+	for sc, sci := range info.ReadySCs {
+		p.subConns = append(p.subConns, sc)
+		for i := 0; i < ringReplicas; i++ {
+			p.ring = append(p.ring, ringPoint{hash: ringHash(sci.Address.Addr + "#" + strconv.Itoa(i)), sc: sc})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+	return p
+}
+
+type consistentHashPicker struct {
+	ring     []ringPoint
+	subConns []balancer.SubConn
+	next     atomic.Uint32
+}
+
+func (p *consistentHashPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	key, _ := info.Ctx.Value(affinityKeyContextKey{}).(string)
+	if key == "" {
+		n := p.next.Add(1)
+		return balancer.PickResult{SubConn: p.subConns[int(n)%len(p.subConns)]}, nil
+	}
+	h := ringHash(key)
+	i := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+	if i == len(p.ring) {
+		i = 0
+	}
+	return balancer.PickResult{SubConn: p.ring[i].sc}, nil
+}
+
+// ringHash hashes s onto the ring: FNV-1a, with the splitmix64 finalizer to spread similar strings such as
+// "host#1" and "host#2".
+func ringHash(s string) uint64 {
+	f := fnv.New64a()
+	_, _ = f.Write([]byte(s))
+	h := f.Sum64()
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	return h ^ h>>31
+}
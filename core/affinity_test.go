@@ -0,0 +1,150 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeSubConn struct {
+	balancer.SubConn
+	addr string
+}
+
+func TestConsistentHashPicker(t *testing.T) {
+	build := func(addrs ...string) balancer.Picker {
+		ready := make(map[balancer.SubConn]base.SubConnInfo)
+		for _, a := range addrs {
+			ready[&fakeSubConn{addr: a}] = base.SubConnInfo{Address: resolver.Address{Addr: a}}
+		}
+		return consistentHashPickerBuilder{}.Build(base.PickerBuildInfo{ReadySCs: ready})
+	}
+	pick := func(p balancer.Picker, key string) string {
+		res, err := p.Pick(balancer.PickInfo{Ctx: withAffinityKey(context.Background(), key)})
+		if err != nil {
+			t.Fatalf("pick %q: %v", key, err)
+		}
+		return res.SubConn.(*fakeSubConn).addr
+	}
+
+	three, two := build("a:1", "b:1", "c:1"), build("a:1", "b:1")
+	counts := map[string]int{}
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		got := pick(three, key)
+		if again := pick(three, key); again != got {
+			t.Fatalf("%s: picked %s then %s", key, got, again)
+		}
+		counts[got]++
+		// Removing c moves only the keys that were on c.
+		if got != "c:1" && pick(two, key) != got {
+			t.Fatalf("%s moved from %s after c left", key, got)
+		}
+	}
+	for _, a := range []string{"a:1", "b:1", "c:1"} {
+		if counts[a] < 50 {
+			t.Fatalf("uneven spread: %v", counts)
+		}
+	}
+
+	// Calls without a key are spread round-robin.
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		seen[pick(three, "")] = true
+	}
+	if len(seen) != 3 {
+		t.Fatalf("round-robin picked %v", seen)
+	}
+	if _, err := build().Pick(balancer.PickInfo{Ctx: context.Background()}); err != balancer.ErrNoSubConnAvailable {
+		t.Fatalf("no endpoints: %v", err)
+	}
+}
+
+func TestInvoker_AffinityField(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]map[string]bool{} // endpoint -> messages
+	listeners := map[string]*bufconn.Listener{}
+	var addrs []resolver.Address
+	for _, name := range []string{"e1", "e2", "e3"} {
+		name := name
+		lis := bufconn.Listen(1 << 16)
+		srv := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			mu.Lock()
+			if hits[name] == nil {
+				hits[name] = map[string]bool{}
+			}
+			hits[name][req.(*pb.EchoRequest).GetMessage()] = true
+			mu.Unlock()
+			return handler(ctx, req)
+		}))
+		pb.RegisterEchoServiceServer(srv, benchEchoServer{})
+		go func() { _ = srv.Serve(lis) }()
+		defer srv.Stop()
+		listeners[name] = lis
+		addrs = append(addrs, resolver.Address{Addr: name})
+	}
+	r := manual.NewBuilderWithScheme("affinity")
+	r.InitialState(resolver.State{Addresses: addrs})
+
+	inv := NewInvoker(
+		WithDescriptorDir(t.TempDir()),
+		WithCallTimeout(time.Minute),
+		WithDialer(func(ctx context.Context, addr string) (net.Conn, error) { return listeners[addr].DialContext(ctx) }),
+		WithTargetConfigs(map[string]TargetConfig{"affinity:///echo": {ConsistentHash: true, DialOptions: []grpc.DialOption{grpc.WithResolvers(r)}}}),
+	)
+	defer inv.Close()
+
+	// Keys only keep their endpoint while the set of ready endpoints is stable: warm up until all three are
+	// ready, with keyless calls that go round-robin.
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		mu.Lock()
+		n := len(hits)
+		hits = map[string]map[string]bool{}
+		mu.Unlock()
+		if n == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d endpoints became ready", n)
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := inv.Invoke(context.Background(), &InvokeRequest{Target: "affinity:///echo", FullMethodName: benchMethod, Body: []byte(`{}`)}); err != nil {
+				t.Fatalf("warm-up: %v", err)
+			}
+		}
+	}
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 20; i++ {
+			body := fmt.Sprintf(`{"message":"user-%d"}`, i)
+			req := &InvokeRequest{Target: "affinity:///echo", FullMethodName: benchMethod, Body: []byte(body), AffinityField: "message"}
+			if _, err := inv.Invoke(context.Background(), req); err != nil {
+				t.Fatalf("invoke: %v", err)
+			}
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	endpoints := map[string]string{}
+	for endpoint, msgs := range hits {
+		for msg := range msgs {
+			if other, ok := endpoints[msg]; ok {
+				t.Fatalf("%s reached %s and %s", msg, other, endpoint)
+			}
+			endpoints[msg] = endpoint
+		}
+	}
+	if len(endpoints) != 20 || len(hits) < 2 {
+		t.Fatalf("hits = %v", hits)
+	}
+}
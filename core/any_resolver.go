@@ -0,0 +1,39 @@
+package core
+
+import (
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// anyResolver resolves google.protobuf.Any type URLs during JSON conversion. It looks in the called method's
+// file and its imports first, then (built lazily, since most payloads carry no Any) in every loaded descriptor:
+// embedded sets, the descriptor directory and the caller's inline pools. Types linked into the binary, such as
+// google.rpc error details, resolve as a last resort.
+type anyResolver struct {
+	inv       *Invoker
+	namespace string
+	primary   jsonpb.AnyResolver
+
+	once sync.Once
+	all  jsonpb.AnyResolver
+}
+
+func (inv *Invoker) anyResolver(namespace string, md *desc.MethodDescriptor) *anyResolver {
+	return &anyResolver{inv: inv, namespace: namespace, primary: dynamic.AnyResolver(nil, md.GetFile())}
+}
+
+func (r *anyResolver) Resolve(typeURL string) (proto.Message, error) {
+	if m, err := r.primary.Resolve(typeURL); err == nil {
+		return m, nil
+	}
+	r.once.Do(func() {
+		files := r.inv.resolver.Files()
+		files = append(files, r.inv.inlineResolver.Files(r.namespace)...)
+		r.all = dynamic.AnyResolver(nil, files...)
+	})
+	return r.all.Resolve(typeURL)
+}
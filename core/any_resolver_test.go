@@ -0,0 +1,56 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/dynamic"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestAnyResolver_InlinePools(t *testing.T) {
+	fd, err := builder.NewFile("acme/widget.proto").SetPackageName("acme").
+		AddMessage(builder.NewMessage("Widget").AddField(builder.NewField("name", builder.FieldTypeString()))).
+		Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	set, err := protov2.Marshal(desc.ToFileDescriptorSet(fd))
+	if err != nil {
+		t.Fatalf("marshal set: %v", err)
+	}
+
+	inv := NewInvoker(WithDescriptorDir(t.TempDir()))
+	if _, _, _, err := inv.SyncInlineDescriptorChunk("widgets", 0, 1, set, true, false); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	md, err := inv.resolver.Resolve("/echo.EchoService/Echo")
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	widget := dynamic.NewMessage(fd.FindMessage("acme.Widget"))
+	widget.SetFieldByName("name", "sprocket")
+	value, _ := widget.Marshal()
+	anyMsg := proto.MessageV1(&anypb.Any{TypeUrl: "type.googleapis.com/acme.Widget", Value: value})
+
+	if _, err := messageToJSON(anyMsg, nil); err == nil {
+		t.Fatalf("expected failure without a resolver over inline pools")
+	}
+	b, err := messageToJSON(anyMsg, inv.anyResolver("", md))
+	if err != nil {
+		t.Fatalf("marshal with resolver: %v", err)
+	}
+	if !strings.Contains(string(b), `"@type":"type.googleapis.com/acme.Widget"`) || !strings.Contains(string(b), `"name":"sprocket"`) {
+		t.Fatalf("unexpected JSON: %s", b)
+	}
+
+	// Pools of other namespaces are not consulted.
+	if _, err := inv.anyResolver("tenant-b", md).Resolve("type.googleapis.com/acme.Widget"); err == nil {
+		t.Fatalf("expected namespace isolation")
+	}
+}
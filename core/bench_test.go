@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+)
+
+const benchMethod = "/echo.EchoService/Echo"
+
+var benchBody = []byte(`{"message":"the quick brown fox jumps over the lazy dog"}`)
+
+type benchEchoServer struct {
+	pb.UnimplementedEchoServiceServer
+}
+
+func (benchEchoServer) Echo(_ context.Context, req *pb.EchoRequest) (*pb.EchoResponse, error) {
+	return &pb.EchoResponse{Message: req.GetMessage()}, nil
+}
+
+func BenchmarkResolve(b *testing.B) {
+	dir := b.TempDir()
+	b.Run("cold", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := NewMethodResolver(dir).Resolve(benchMethod); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		r := NewMethodResolver(dir)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := r.Resolve(benchMethod); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkConvert(b *testing.B) {
+	md, err := NewMethodResolver(b.TempDir()).Resolve(benchMethod)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("json_to_message", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := JSONToMessage(md, benchBody); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	msg, _ := JSONToMessage(md, benchBody)
+	b.Run("message_to_json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := MessageToJSON(msg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkInvoke measures the whole pipeline against an in-process server, without network I/O.
+func BenchmarkInvoke(b *testing.B) {
+	srv := grpc.NewServer()
+	pb.RegisterEchoServiceServer(srv, benchEchoServer{})
+	inv := NewInvoker(WithDescriptorDir(b.TempDir()), WithLocalServer(srv))
+	defer inv.Close()
+	req := InvokeRequest{Target: LocalTarget, FullMethodName: benchMethod, Body: benchBody}
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := req
+		if _, err := inv.Invoke(ctx, &r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
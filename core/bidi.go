@@ -0,0 +1,110 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+)
+
+// ErrNotBidiStreaming is returned by OpenBidiStream for methods that are not bidirectional-streaming.
+var ErrNotBidiStreaming = errors.New("method is not bidirectional-streaming")
+
+// BidiStream is an open bidirectional-streaming call, see OpenBidiStream. Send and CloseSend may be called
+// from one goroutine while Recv is called from another.
+type BidiStream struct {
+	inv      *Invoker
+	ctx      context.Context // of the call, for the clock of decodeRequest
+	req      InvokeRequest
+	stream   *grpcdynamic.BidiStream
+	resolver jsonpb.AnyResolver
+	md       *desc.MethodDescriptor
+	method   string
+	sent     int
+}
+
+// OpenBidiStream starts a bidirectional-streaming call; req.Body is ignored and the request messages are
+// passed to Send. OnResolve runs once when the call opens; Authorize runs for every message sent. As for
+// OpenServerStream, the call lasts until the stream ends or ctx is done.
+func (inv *Invoker) OpenBidiStream(ctx context.Context, req *InvokeRequest) (*BidiStream, error) {
+	method, methodName, err := inv.resolve(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if !method.Method.IsServerStreaming() || !method.Method.IsClientStreaming() {
+		return nil, fmt.Errorf("%w: %s", ErrNotBidiStreaming, methodName)
+	}
+	ctx = withResolvedCall(ctx, req, method, methodName)
+	if req.OnResolve != nil {
+		if err := req.OnResolve(method.Method); err != nil {
+			return nil, err
+		}
+	}
+	resolver := inv.anyResolver(req.DescriptorNamespace, method.Method)
+	// The stream opens before any message, so only AffinityKey applies.
+	ctx = withAffinityKey(outgoingMetadata(ctx, req.Metadata), req.AffinityKey)
+	channel, _, err := inv.conns.channel(req.Target)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", req.Target, err)
+	}
+	stream, err := grpcdynamic.NewStub(channel).InvokeRpcBidiStream(ctx, method.Method)
+	if err != nil {
+		return nil, newUpstreamError(err, resolver)
+	}
+	inv.metrics.Add("gateway_streams_opened_total", 1, "method", methodName)
+	s := &BidiStream{inv: inv, ctx: ctx, req: *req, stream: stream, resolver: resolver, md: method.Method, method: methodName}
+	s.req.OnResolve, s.req.Capture = nil, nil
+	return s, nil
+}
+
+// Method returns the full method name of the call.
+func (s *BidiStream) Method() string { return s.method }
+
+// Send decodes body, a JSON request message, as Invoke decodes Body and sends it. If the upstream has ended
+// the call, Send returns io.EOF and Recv returns its status.
+func (s *BidiStream) Send(body []byte) error {
+	r := s.req
+	r.Body, r.BodyFormat = body, BodyFormatJSON
+	msg, _, err := s.inv.decodeRequest(s.ctx, &r, s.method, s.md, s.resolver)
+	if err != nil {
+		return fmt.Errorf("message %d: %w", s.sent, err)
+	}
+	if err := s.stream.SendMsg(msg); err != nil {
+		return err
+	}
+	s.sent++
+	s.inv.metrics.Add("gateway_stream_messages_sent_total", 1, "method", s.method)
+	return nil
+}
+
+// CloseSend tells the upstream that no more messages follow.
+func (s *BidiStream) CloseSend() error { return s.stream.CloseSend() }
+
+// Recv returns the next response message as JSON, as ServerStream.Recv does.
+func (s *BidiStream) Recv() ([]byte, error) {
+	msg, err := s.stream.RecvMsg()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, newUpstreamError(err, s.resolver)
+	}
+	resp, err := messageToJSON(msg, s.resolver)
+	if err == nil {
+		resp, err = s.req.FieldPresence.applyPresence(msg, resp)
+	}
+	if err == nil {
+		resp, err = s.req.FieldVisibility.hideFields(s.md.GetOutputType(), resp)
+	}
+	if err == nil {
+		resp, err = s.req.Int64Encoding.encodeResponse(s.md.GetOutputType(), resp)
+	}
+	if err == nil && s.req.WKTCoercion != nil {
+		resp, err = s.req.WKTCoercion.coerceResponse(s.md.GetOutputType(), resp)
+	}
+	return resp, err
+}
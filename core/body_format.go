@@ -0,0 +1,103 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"gopkg.in/yaml.v3"
+)
+
+// BodyFormat is the encoding of InvokeRequest.Body.
+type BodyFormat string
+
+const (
+	BodyFormatJSON BodyFormat = ""          // proto3 JSON mapping
+	BodyFormatText BodyFormat = "prototext" // protocol buffers text format
+	BodyFormatYAML BodyFormat = "yaml"      // YAML with the field names and values of the proto3 JSON mapping
+	// BodyFormatQuery is a URL query string (without "?") bound to the fields of the message; the
+	// invoker converts it to JSON first, so every JSON option applies to it.
+	BodyFormatQuery BodyFormat = "query"
+)
+
+// decodeBody converts body in format to a dynamic.Message of the method's input type. An empty text or
+// YAML body is the empty message. Unknown JSON and YAML fields are ignored if allowUnknown.
+func decodeBody(method *desc.MethodDescriptor, body []byte, format BodyFormat, resolver jsonpb.AnyResolver, allowUnknown bool) (proto.Message, error) {
+	switch format {
+	case BodyFormatJSON:
+		return jsonToMessage(method, body, resolver, allowUnknown)
+	case BodyFormatText:
+		msg := dynamic.NewMessage(method.GetInputType())
+		if err := msg.UnmarshalText(body); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	case BodyFormatYAML:
+		jsonBody, err := yamlToJSON(body)
+		if err != nil {
+			return nil, err
+		}
+		return jsonToMessage(method, jsonBody, resolver, allowUnknown)
+	}
+	return nil, fmt.Errorf("unsupported body format %q", format)
+}
+
+// yamlToJSON re-encodes a YAML document as JSON so it can go through the proto3 JSON mapping.
+func yamlToJSON(body []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(body, &v); err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return []byte("{}"), nil
+	}
+	v, err := jsonCompatible(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// jsonCompatible converts YAML mappings with non-string keys (e.g. map fields keyed by integers) into
+// string-keyed maps, as the JSON mapping expects.
+func jsonCompatible(v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			c, err := jsonCompatible(e)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = c
+		}
+		return v, nil
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			switch k.(type) {
+			case string, int, int64, uint64, bool, float64:
+			default:
+				return nil, fmt.Errorf("unsupported yaml mapping key %v", k)
+			}
+			c, err := jsonCompatible(e)
+			if err != nil {
+				return nil, err
+			}
+			out[fmt.Sprint(k)] = c
+		}
+		return out, nil
+	case []any:
+		for i, e := range v {
+			c, err := jsonCompatible(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = c
+		}
+		return v, nil
+	}
+	return v, nil
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DescriptorFetcher loads a FileDescriptorSet for a descriptor_id that is not in the inline cache.
+// ok=false means the fetcher does not handle this kind of descriptor_id.
+type DescriptorFetcher interface {
+	FetchDescriptorSet(ctx context.Context, descriptorID string) (data []byte, ok bool, err error)
+}
+
+const (
+	defaultBSRHost     = "buf.build"
+	bsrGetFDSProcedure = "/buf.reflect.v1beta1.FileDescriptorSetService/GetFileDescriptorSet"
+	maxBSRResponseSize = maxDescriptorSyncBytes
+)
+
+// BSRFetcher fetches FileDescriptorSets from the Buf Schema Registry by module reference,
+// e.g. descriptor_id "buf.build/acme/payments:v1.2.0" (the ":version" suffix is optional and defaults to latest).
+type BSRFetcher struct {
+	// Token is an optional BSR API token sent as a bearer token.
+	Token string
+	// Hosts lists the registry hosts descriptor_ids may refer to; default {"buf.build"}.
+	// Module references with any other host are not handled, so clients cannot make the gateway call arbitrary hosts.
+	Hosts []string
+	// BaseURL overrides the registry URL (e.g. a private BSR instance); default "https://" + module host.
+	BaseURL string
+	// Client is the HTTP client used for registry calls; nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// ParseBSRModuleRef splits "host/owner/repo[:version]" into module name and version.
+func ParseBSRModuleRef(ref string) (host, module, version string, err error) {
+	ref = strings.TrimSpace(ref)
+	module, version, _ = strings.Cut(ref, ":")
+	parts := strings.Split(module, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid BSR module reference %q, expected host/owner/repo[:version]", ref)
+	}
+	return parts[0], module, version, nil
+}
+
+// FetchDescriptorSet implements DescriptorFetcher.
+func (f *BSRFetcher) FetchDescriptorSet(ctx context.Context, descriptorID string) ([]byte, bool, error) {
+	host, module, version, err := ParseBSRModuleRef(descriptorID)
+	if err != nil || !f.allowedHost(host) {
+		return nil, false, nil
+	}
+
+	// Connect unary call with binary protobuf payloads:
+	// GetFileDescriptorSetRequest{module = 1, version = 2}.
+	var reqMsg []byte
+	reqMsg = protowire.AppendTag(reqMsg, 1, protowire.BytesType)
+	reqMsg = protowire.AppendString(reqMsg, module)
+	if version != "" {
+		reqMsg = protowire.AppendTag(reqMsg, 2, protowire.BytesType)
+		reqMsg = protowire.AppendString(reqMsg, version)
+	}
+
+	baseURL := f.BaseURL
+	if baseURL == "" {
+		baseURL = "https://" + host
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+bsrGetFDSProcedure, bytes.NewReader(reqMsg))
+	if err != nil {
+		return nil, true, fmt.Errorf("build BSR request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/proto")
+	httpReq.Header.Set("Connect-Protocol-Version", "1")
+	if f.Token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+f.Token)
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, true, fmt.Errorf("fetch %s from BSR: %w", descriptorID, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBSRResponseSize+1))
+	if err != nil {
+		return nil, true, fmt.Errorf("read BSR response: %w", err)
+	}
+	if len(body) > maxBSRResponseSize {
+		return nil, true, fmt.Errorf("BSR response too large (max %d bytes)", maxBSRResponseSize)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var connectErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &connectErr) == nil && connectErr.Code != "" {
+			return nil, true, fmt.Errorf("fetch %s from BSR: %s: %s", descriptorID, connectErr.Code, connectErr.Message)
+		}
+		return nil, true, fmt.Errorf("fetch %s from BSR: http status %d", descriptorID, resp.StatusCode)
+	}
+
+	// GetFileDescriptorSetResponse{file_descriptor_set = 1}: the embedded message bytes are a serialized FileDescriptorSet.
+	for len(body) > 0 {
+		num, typ, n := protowire.ConsumeTag(body)
+		if n < 0 {
+			return nil, true, fmt.Errorf("decode BSR response: %w", protowire.ParseError(n))
+		}
+		body = body[n:]
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(body)
+			if n < 0 {
+				return nil, true, fmt.Errorf("decode BSR response: %w", protowire.ParseError(n))
+			}
+			return append([]byte(nil), v...), true, nil
+		}
+		n = protowire.ConsumeFieldValue(num, typ, body)
+		if n < 0 {
+			return nil, true, fmt.Errorf("decode BSR response: %w", protowire.ParseError(n))
+		}
+		body = body[n:]
+	}
+	return nil, true, fmt.Errorf("BSR response for %s has no file_descriptor_set", descriptorID)
+}
+
+func (f *BSRFetcher) allowedHost(host string) bool {
+	hosts := f.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{defaultBSRHost}
+	}
+	for _, h := range hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
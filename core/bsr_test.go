@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestBSRFetcher_ResolveByModuleRef(t *testing.T) {
+	fds, ok := EmbeddedDescriptorSet("echo.EchoService")
+	if !ok {
+		t.Fatalf("missing embedded descriptor for echo.EchoService")
+	}
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != bsrGetFDSProcedure {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("unexpected authorization: %q", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "buf.build/acme/echo") || !strings.Contains(string(body), "v1.2.0") {
+			t.Errorf("unexpected request body: %q", body)
+		}
+		var resp []byte
+		resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+		resp = protowire.AppendBytes(resp, fds)
+		w.Header().Set("Content-Type", "application/proto")
+		_, _ = w.Write(resp)
+	}))
+	defer srv.Close()
+
+	r := NewInlineMethodResolver()
+	r.fetcher = &BSRFetcher{Token: "secret", BaseURL: srv.URL}
+
+	for i := 0; i < 2; i++ {
+		rm, key, err := r.Resolve(context.Background(), "", nil, "buf.build/acme/echo:v1.2.0", "", "/echo.EchoService/Echo")
+		if err != nil {
+			t.Fatalf("resolve %d: %v", i, err)
+		}
+		if key != "buf.build/acme/echo:v1.2.0" || rm.ServiceFQN != "echo.EchoService" {
+			t.Fatalf("unexpected resolution: key=%q service=%q", key, rm.ServiceFQN)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected registry to be called once (then cached), got %d", calls)
+	}
+}
+
+func TestBSRFetcher_IgnoresUnknownHosts(t *testing.T) {
+	f := &BSRFetcher{}
+	for _, id := range []string{"echo-v1", "evil.example.com/acme/echo:v1", "buf.build/acme"} {
+		_, handled, err := f.FetchDescriptorSet(context.Background(), id)
+		if handled || err != nil {
+			t.Fatalf("%q: expected not handled, got handled=%v err=%v", id, handled, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package core
+
+import (
+	"bytes"
+	"sync"
+)
+
+// bufferPool holds scratch buffers for JSON encoding on the call path and, through GetBuffer, for request
+// decoding in the gateway. Results are copied out of them into exactly sized slices, so pooled memory never
+// escapes to callers.
+var bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// maxPooledBuffer keeps the pool from pinning the buffers of unusually large messages.
+const maxPooledBuffer = 1 << 20
+
+// GetBuffer returns an empty scratch buffer from the pool; return it with PutBuffer once nothing refers to
+// its contents.
+func GetBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// PutBuffer returns buf to the pool, unless it grew too large to keep.
+func PutBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
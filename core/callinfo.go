@@ -0,0 +1,74 @@
+package core
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// CallInfo describes the invocation carried by a context: the Invoker fills it in once the method is
+// resolved, so gRPC client interceptors, loggers and error mappers can tell which call they see without
+// re-parsing the request. Fields stay zero until then, e.g. for a body that failed to parse.
+type CallInfo struct {
+	Method     *desc.MethodDescriptor
+	FullMethod string // "/package.Service/Method"
+	// Target is the requested upstream; hedged duplicates (see HedgeConfig) may go to another.
+	Target string
+	// DescriptorKey is the descriptor cache key the method was found under (see NamespacedDescriptorID);
+	// empty for methods of the directory and local layers.
+	DescriptorKey    string
+	DescriptorSource string // as Diagnostics.DescriptorSource
+
+	mu   sync.Mutex
+	peer string
+}
+
+// Peer returns the address of the upstream that answered the latest attempt of the call, or "" before one
+// has.
+func (c *CallInfo) Peer() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peer
+}
+
+func (c *CallInfo) setPeer(addr string) {
+	c.mu.Lock()
+	c.peer = addr
+	c.mu.Unlock()
+}
+
+type callInfoKey struct{}
+
+// WithCallInfo returns ctx carrying an empty CallInfo for the Invoker to fill in, so that the caller can read
+// it from ctx after the call (e.g. to render an error). Without it, the Invoker installs its own for the
+// contexts of upstream calls only.
+func WithCallInfo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callInfoKey{}, &CallInfo{})
+}
+
+// CallInfoFromContext returns the CallInfo carried by ctx, or nil.
+func CallInfoFromContext(ctx context.Context) *CallInfo {
+	c, _ := ctx.Value(callInfoKey{}).(*CallInfo)
+	return c
+}
+
+// withResolvedCall returns ctx carrying the CallInfo of the resolved method of req, filling in the one
+// installed by WithCallInfo if there is one.
+func withResolvedCall(ctx context.Context, req *InvokeRequest, method *ResolvedMethod, methodName string) context.Context {
+	c := CallInfoFromContext(ctx)
+	if c == nil {
+		c = &CallInfo{}
+		ctx = context.WithValue(ctx, callInfoKey{}, c)
+	}
+	c.Method, c.FullMethod, c.Target = method.Method, methodName, req.Target
+	c.DescriptorKey, c.DescriptorSource = method.Key, method.Source
+	return ctx
+}
+
+// recordPeer notes the upstream that answered an attempt under ctx in its CallInfo.
+func recordPeer(ctx context.Context, addr string) {
+	if c := CallInfoFromContext(ctx); c != nil {
+		c.setPeer(addr)
+	}
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// CanonicalRequest is the upstream call that a request maps to, see Invoker.Canonicalize.
+type CanonicalRequest struct {
+	Method   string              `json:"method"` // "/package.Service/Method"
+	Target   string              `json:"target"`
+	Metadata map[string][]string `json:"metadata,omitempty"` // InvokeRequest.Metadata
+	// Messages are the request messages, one for unary and server-streaming methods and one per body message
+	// for client- and bidi-streaming methods.
+	Messages []CanonicalMessage `json:"messages"`
+}
+
+// CanonicalMessage is a request message as the upstream receives it.
+type CanonicalMessage struct {
+	// Binary is the message in the protobuf wire format, with deterministic map order; base64 in JSON.
+	Binary []byte `json:"binary"`
+	// JSON is the message in the proto3 JSON mapping, with the gateway's defaults applied and, as in
+	// responses, fields at their default value included.
+	JSON json.RawMessage `json:"json"`
+}
+
+// Canonicalize resolves and decodes req as Invoke (or OpenServerStream, OpenBidiStream) would, including
+// OnResolve, defaults and Authorize, and returns the request messages it would send instead of calling the
+// upstream, so integrators can compare them with what a backend that rejects the call expects.
+func (inv *Invoker) Canonicalize(ctx context.Context, req *InvokeRequest) (*CanonicalRequest, error) {
+	method, methodName, err := inv.resolve(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	withResolvedCall(ctx, req, method, methodName)
+	resolver := inv.anyResolver(req.DescriptorNamespace, method.Method)
+	var msgs []proto.Message
+	if method.Method.IsClientStreaming() {
+		if msgs, _, err = inv.decodeStream(ctx, req, methodName, method.Method, resolver); err != nil {
+			return nil, err
+		}
+	} else {
+		msg, _, err := inv.decodeRequest(ctx, req, methodName, method.Method, resolver)
+		if err != nil {
+			return nil, err
+		}
+		msgs = []proto.Message{msg}
+	}
+
+	out := &CanonicalRequest{Method: methodName, Target: req.Target, Metadata: req.Metadata, Messages: make([]CanonicalMessage, len(msgs))}
+	for i, msg := range msgs {
+		var binary []byte
+		if dm, ok := msg.(*dynamic.Message); ok {
+			binary, err = dm.MarshalDeterministic()
+		} else {
+			binary, err = proto.Marshal(msg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("message %d: marshal: %w", i, err)
+		}
+		js, err := messageToJSON(msg, resolver)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: message to json: %w", i, err)
+		}
+		out.Messages[i] = CanonicalMessage{Binary: binary, JSON: js}
+	}
+	return out, nil
+}
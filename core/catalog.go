@@ -0,0 +1,160 @@
+package core
+
+import (
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Services returns the services loaded from every descriptor source: preloaded and embedded sets, .pb files
+// in the descriptor directory, and inline descriptors cached for namespace. Services are deduplicated by
+// fully-qualified name (preloaded/embedded/directory first) and sorted.
+func (inv *Invoker) Services(namespace string) []*desc.ServiceDescriptor {
+	seen := make(map[string]bool)
+	var out []*desc.ServiceDescriptor
+	add := func(svcs []*desc.ServiceDescriptor) {
+		for _, svc := range svcs {
+			if fqn := svc.GetFullyQualifiedName(); !seen[fqn] {
+				seen[fqn] = true
+				out = append(out, svc)
+			}
+		}
+	}
+	add(inv.resolver.Services())
+	add(inv.inlineResolver.Services(namespace))
+	sort.Slice(out, func(i, j int) bool { return out[i].GetFullyQualifiedName() < out[j].GetFullyQualifiedName() })
+	return out
+}
+
+// Services returns the services defined in preloaded and embedded descriptor sets and in the descriptor directory.
+// Unreadable or invalid files are skipped; Resolve reports their errors when a method is actually called.
+func (r *MethodResolver) Services() []*desc.ServiceDescriptor {
+	var out []*desc.ServiceDescriptor
+	for _, fd := range r.Files() {
+		out = append(out, fd.GetServices()...)
+	}
+	return out
+}
+
+// Files returns the preloaded files and those of embedded descriptor sets and of the descriptor directory,
+// skipping invalid sets. The embedded and directory sets are parsed once and kept until Flush.
+func (r *MethodResolver) Files() []*desc.FileDescriptor {
+	r.mu.RLock()
+	out := append([]*desc.FileDescriptor(nil), r.preloaded...)
+	listed, flushes := r.listed, r.flushes
+	r.mu.RUnlock()
+	if listed == nil {
+		listed = r.listFiles()
+		r.mu.Lock()
+		if r.flushes == flushes {
+			r.listed = listed
+		}
+		r.mu.Unlock()
+	}
+	return append(out, listed...)
+}
+
+// listFiles parses the embedded descriptor sets and the .pb files of the descriptor directory, skipping
+// invalid sets.
+func (r *MethodResolver) listFiles() []*desc.FileDescriptor {
+	out := []*desc.FileDescriptor{}
+	var sets [][]byte
+	for _, name := range sortedEmbeddedServices() {
+		if b, ok := EmbeddedDescriptorSet(name); ok {
+			sets = append(sets, b)
+		}
+	}
+	paths, _ := fs.Glob(r.files, "*.pb")
+	sort.Strings(paths)
+	for _, p := range paths {
+		if b, err := fs.ReadFile(r.files, p); err == nil {
+			sets = append(sets, b)
+		}
+	}
+
+	for _, b := range sets {
+		var fds descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(b, &fds); err != nil {
+			continue
+		}
+		files, err := desc.CreateFileDescriptorsFromSet(&fds)
+		if err != nil {
+			continue
+		}
+		out = append(out, sortedFiles(files)...)
+	}
+	return out
+}
+
+// Services returns the services of every cached pool in namespace.
+func (r *InlineMethodResolver) Services(namespace string) []*desc.ServiceDescriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*desc.ServiceDescriptor
+	for el := r.pools.ll.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*descriptorCacheEntry)
+		if !inNamespace(e.key, namespace) {
+			continue
+		}
+		out = append(out, e.pool.Services()...)
+	}
+	return out
+}
+
+// Files returns the files of every cached pool in namespace.
+func (r *InlineMethodResolver) Files(namespace string) []*desc.FileDescriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []*desc.FileDescriptor
+	for el := r.pools.ll.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*descriptorCacheEntry)
+		if inNamespace(e.key, namespace) {
+			out = append(out, e.pool.files...)
+		}
+	}
+	return out
+}
+
+// Services returns the pool's services sorted by fully-qualified name.
+func (p *InlineDescriptorPool) Services() []*desc.ServiceDescriptor {
+	out := make([]*desc.ServiceDescriptor, 0, len(p.servicesByFQN)/2)
+	for fqn, svc := range p.servicesByFQN {
+		if !strings.HasPrefix(fqn, ".") {
+			out = append(out, svc)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetFullyQualifiedName() < out[j].GetFullyQualifiedName() })
+	return out
+}
+
+// inNamespace reports whether the cache key belongs to namespace (see NamespacedDescriptorID).
+func inNamespace(key, namespace string) bool {
+	ns, _, namespaced := strings.Cut(key, "\x00")
+	if !namespaced {
+		return namespace == ""
+	}
+	return ns == namespace
+}
+
+func sortedEmbeddedServices() []string {
+	names := make([]string, 0, len(embeddedDescriptorSets))
+	for name := range embeddedDescriptorSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedFiles returns the values of files (as built by desc.CreateFileDescriptorsFromSet) sorted by name.
+func sortedFiles(files map[string]*desc.FileDescriptor) []*desc.FileDescriptor {
+	out := make([]*desc.FileDescriptor, 0, len(files))
+	for _, fd := range files {
+		out = append(out, fd)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetName() < out[j].GetName() })
+	return out
+}
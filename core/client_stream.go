@@ -0,0 +1,145 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// ErrInvalidStreamBody is returned by Invoke for client-streaming methods whose Body is neither a JSON array
+// nor NDJSON.
+var ErrInvalidStreamBody = errors.New("invalid client-streaming body")
+
+// streamMessages splits the body of a client-streaming call into the JSON of its messages: the elements of
+// a JSON (or YAML) array, or the non-empty lines of NDJSON.
+func streamMessages(body []byte, format BodyFormat) ([][]byte, error) {
+	if format == BodyFormatYAML {
+		var err error
+		if body, err = yamlToJSON(body); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidStreamBody, err)
+		}
+	} else if format != BodyFormatJSON {
+		return nil, fmt.Errorf("%w: %s bodies are not supported", ErrInvalidStreamBody, format)
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if body[0] == '[' {
+		var elems []json.RawMessage
+		if err := json.Unmarshal(body, &elems); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidStreamBody, err)
+		}
+		msgs := make([][]byte, len(elems))
+		for i, e := range elems {
+			msgs[i] = e
+		}
+		return msgs, nil
+	}
+	var msgs [][]byte
+	for n, line := range bytes.Split(body, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			return nil, fmt.Errorf("%w: line %d is not JSON", ErrInvalidStreamBody, n+1)
+		}
+		msgs = append(msgs, line)
+	}
+	return msgs, nil
+}
+
+// decodeStream decodes the messages of a client-streaming call as decodeRequest does (OnResolve runs once,
+// Authorize per message). The messages are also returned as a JSON array if Capture needs them.
+func (inv *Invoker) decodeStream(ctx context.Context, req *InvokeRequest, methodName string, md *desc.MethodDescriptor, resolver jsonpb.AnyResolver) ([]proto.Message, []byte, error) {
+	bodies, err := streamMessages(req.Body, req.BodyFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.OnResolve != nil {
+		if err := req.OnResolve(md); err != nil {
+			return nil, nil, err
+		}
+	}
+	msgs := make([]proto.Message, len(bodies))
+	requests := make([][]byte, len(bodies))
+	for i, body := range bodies {
+		r := *req
+		r.Body, r.BodyFormat, r.HTTPBodyContentType, r.OnResolve = body, BodyFormatJSON, "", nil
+		if msgs[i], requests[i], err = inv.decodeRequest(ctx, &r, methodName, md, resolver); err != nil {
+			return nil, nil, fmt.Errorf("message %d: %w", i, err)
+		}
+	}
+	var request []byte
+	if req.Capture != nil {
+		request = append(append([]byte("["), bytes.Join(requests, []byte(","))...), ']')
+	}
+	return msgs, request, nil
+}
+
+// invokeClientStream sends msgs in order on a client-streaming call of md and returns its single response.
+// Hedging, coalescing, shadowing and churn retries do not apply.
+func (inv *Invoker) invokeClientStream(ctx context.Context, target, methodName string, md *desc.MethodDescriptor, msgs []proto.Message) (proto.Message, error) {
+	clock := ClockFromContext(ctx, inv.clock)
+	ctx, span := StartSpan(ctx, "attempt")
+	span.SetTarget(target, methodName)
+	release, err := inv.limiter.acquire(ctx, clock, inv.metrics, target, inv.conns.label(target), inv.conns.config(target))
+	if err != nil {
+		span.End(err)
+		return nil, err
+	}
+	defer release()
+	diag := diagnosticsFromContext(ctx)
+	start := clock.Now()
+	channel, _, err := inv.conns.channel(target)
+	if diag != nil {
+		diag.DialDuration += clock.Now().Sub(start)
+		diag.Attempts++
+		start = clock.Now()
+	}
+	if err != nil {
+		span.End(err)
+		return nil, fmt.Errorf("dial %s: %w", target, err)
+	}
+	var p peer.Peer
+	respMsg, err := sendClientStream(ctx, channel, md, msgs, grpc.Peer(&p))
+	if p.Addr != nil {
+		recordPeer(ctx, p.Addr.String())
+	}
+	if diag != nil {
+		diag.InvokeDuration += clock.Now().Sub(start)
+		if p.Addr != nil {
+			diag.Peer = p.Addr.String()
+		}
+	}
+	span.End(err)
+	inv.metrics.Add("gateway_stream_messages_sent_total", float64(len(msgs)), "method", methodName)
+	if err != nil {
+		return nil, fmt.Errorf("invoke rpc: %w", err)
+	}
+	return respMsg, nil
+}
+
+func sendClientStream(ctx context.Context, channel grpc.ClientConnInterface, md *desc.MethodDescriptor, msgs []proto.Message, opts ...grpc.CallOption) (proto.Message, error) {
+	stream, err := grpcdynamic.NewStub(channel).InvokeRpcClientStream(ctx, md, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if err := stream.SendMsg(msg); err != nil {
+			// The upstream ended the call; its status comes with the response.
+			break
+		}
+	}
+	return stream.CloseAndReceive()
+}
@@ -0,0 +1,249 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Clock is the time source used for timestamps, deadlines, backoff and TTLs.
+// Tests and the replay harness substitute it to make gateway behavior deterministic.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine once d has elapsed; stop cancels the call if it has not run yet.
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+// Rand is the randomness source used for request IDs and jitter.
+type Rand interface {
+	// Int63 returns a non-negative pseudo-random 63-bit integer.
+	Int63() int64
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+type systemRand struct{}
+
+func (systemRand) Int63() int64 { return rand.Int64() }
+
+// SystemClock returns the wall clock.
+func SystemClock() Clock { return systemClock{} }
+
+// SystemRand returns a Rand backed by math/rand/v2.
+func SystemRand() Rand { return systemRand{} }
+
+type clockKey struct{}
+type randKey struct{}
+
+// ContextWithClock returns a context carrying c; it overrides the configured clock for work done under ctx.
+func ContextWithClock(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// ContextWithRand returns a context carrying r; it overrides the configured randomness source for work done under ctx.
+func ContextWithRand(ctx context.Context, r Rand) context.Context {
+	return context.WithValue(ctx, randKey{}, r)
+}
+
+// ClockFromContext returns the clock carried by ctx, or fallback (or the system clock if fallback is nil).
+func ClockFromContext(ctx context.Context, fallback Clock) Clock {
+	if c, ok := ctx.Value(clockKey{}).(Clock); ok && c != nil {
+		return c
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return SystemClock()
+}
+
+// RandFromContext returns the randomness source carried by ctx, or fallback (or SystemRand if fallback is nil).
+func RandFromContext(ctx context.Context, fallback Rand) Rand {
+	if r, ok := ctx.Value(randKey{}).(Rand); ok && r != nil {
+		return r
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return SystemRand()
+}
+
+// WithTimeout is context.WithTimeout driven by clock, so fake clocks can expire deadlines deterministically.
+// With the system clock it is exactly context.WithTimeout. With any other clock the context still reports a
+// deadline d from now on the wall clock, so gRPC sends it upstream as grpc-timeout, and Err returns
+// context.DeadlineExceeded once clock has advanced by d.
+func WithTimeout(ctx context.Context, clock Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	if clock == nil {
+		clock = SystemClock()
+	}
+	if _, ok := clock.(systemClock); ok {
+		return context.WithTimeout(ctx, d)
+	}
+	inner, cancel := context.WithCancelCause(ctx)
+	c := &clockContext{Context: inner, deadline: time.Now().Add(d), done: make(chan struct{})}
+	stopDone := context.AfterFunc(inner, func() { close(c.done) })
+	stop := clock.AfterFunc(d, func() { cancel(context.DeadlineExceeded) })
+	return c, func() {
+		stop()
+		cancel(context.Canceled)
+		if stopDone() {
+			close(c.done)
+		}
+	}
+}
+
+// clockContext is the context of WithTimeout for clocks other than the system clock. Its Done channel is
+// its own rather than the one of the embedded context, so contexts derived from it take their error from
+// Err (DeadlineExceeded on expiry) instead of from the embedded context (Canceled).
+type clockContext struct {
+	context.Context // cancelled with cause context.DeadlineExceeded when the clock reaches the deadline
+	deadline        time.Time
+	done            chan struct{} // closed once the embedded context is done
+}
+
+func (c *clockContext) Deadline() (time.Time, bool) {
+	if d, ok := c.Context.Deadline(); ok && d.Before(c.deadline) {
+		return d, true
+	}
+	return c.deadline, true
+}
+
+func (c *clockContext) Done() <-chan struct{} { return c.done }
+
+func (c *clockContext) Err() error {
+	select {
+	case <-c.done:
+	default:
+		return nil
+	}
+	if errors.Is(context.Cause(c.Context), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
+
+// Sleep waits for d on clock, returning early with ctx.Err() if ctx is done first.
+func Sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	if clock == nil {
+		clock = SystemClock()
+	}
+	done := make(chan struct{})
+	stop := clock.AfterFunc(d, func() { close(done) })
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		stop()
+		return ctx.Err()
+	}
+}
+
+// Backoff computes exponential retry delays with jitter.
+type Backoff struct {
+	Base time.Duration // delay before the first retry; default 50ms
+	Max  time.Duration // upper bound for any delay; default 2s
+	// Jitter is the fraction of the delay randomized, in [0, 1]; e.g. 0.2 yields delay*[0.8, 1.2).
+	Jitter float64
+}
+
+// Delay returns the delay before retry number attempt (0-based), using rnd for jitter.
+func (b Backoff) Delay(attempt int, rnd Rand) time.Duration {
+	base, max := b.Base, b.Max
+	if base <= 0 {
+		base = 50 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 2 * time.Second
+	}
+	d := base
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if b.Jitter > 0 {
+		if rnd == nil {
+			rnd = SystemRand()
+		}
+		// Map Int63 onto [-1, 1) and scale by the jitter fraction.
+		f := float64(rnd.Int63())/float64(1<<63-1)*2 - 1
+		d = time.Duration(float64(d) * (1 + f*b.Jitter))
+	}
+	return d
+}
+
+// FakeClock is a manually advanced Clock for deterministic tests of timeouts, backoff and TTLs.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+// NewFakeClock returns a FakeClock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now implements Clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc implements Clock; f runs when Advance moves the clock past now+d.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if t.stopped {
+			return false
+		}
+		t.stopped = true
+		return true
+	}
+}
+
+// Advance moves the clock forward by d and fires every timer that became due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []func()
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		switch {
+		case t.stopped:
+		case !t.at.After(c.now):
+			t.stopped = true
+			due = append(due, t.f)
+		default:
+			pending = append(pending, t)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+	for _, f := range due {
+		go f()
+	}
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fixedRand int64
+
+func (r fixedRand) Int63() int64 { return int64(r) }
+
+func TestWithTimeout_FakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	ctx, cancel := WithTimeout(context.Background(), clock, 5*time.Second)
+	defer cancel()
+	child, cancelChild := context.WithCancel(ctx)
+	defer cancelChild()
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) <= 4*time.Second {
+		t.Fatalf("deadline = %v, %v; want 5s from now, for grpc-timeout", deadline, ok)
+	}
+
+	clock.Advance(4 * time.Second)
+	select {
+	case <-ctx.Done():
+		t.Fatalf("context expired early")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("context did not expire after advancing the clock")
+	}
+	if !errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+		t.Fatalf("unexpected cause: %v", context.Cause(ctx))
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want DeadlineExceeded", ctx.Err())
+	}
+	<-child.Done()
+	if child.Err() != context.DeadlineExceeded {
+		t.Fatalf("derived context err = %v, want DeadlineExceeded", child.Err())
+	}
+}
+
+func TestWithTimeout_FakeClockCancel(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), NewFakeClock(time.Unix(1700000000, 0)), time.Second)
+	cancel()
+	<-ctx.Done()
+	if ctx.Err() != context.Canceled {
+		t.Fatalf("err = %v, want Canceled", ctx.Err())
+	}
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Base: 100 * time.Millisecond, Max: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if got := b.Delay(i, nil); got != w {
+			t.Fatalf("attempt %d: got %v, want %v", i, got, w)
+		}
+	}
+
+	// Int63 at its midpoint maps to zero jitter; the max value maps to (almost) +Jitter.
+	j := Backoff{Base: 100 * time.Millisecond, Jitter: 0.5}
+	if got := j.Delay(0, fixedRand(1<<62)); got != 100*time.Millisecond {
+		t.Fatalf("midpoint jitter: got %v", got)
+	}
+	if got := j.Delay(0, fixedRand(1<<63-1)); got != 150*time.Millisecond {
+		t.Fatalf("max jitter: got %v", got)
+	}
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// WithCoalescing enables request coalescing per method, keyed by full method name ("/package.Service/Method");
+// the "*" entry applies to methods without their own. While a call is in flight, identical calls (same target,
+// method, request message and metadata) wait for it and share its response instead of reaching the upstream,
+// which protects backends from thundering herds on hot reads. Only enable it for methods without side effects.
+func WithCoalescing(coalesce map[string]bool) InvokerOption {
+	return func(inv *Invoker) {
+		p := *inv.methodPolicies()
+		p.coalesce = coalesce
+		inv.policies.Store(&p)
+	}
+}
+
+func (inv *Invoker) coalesceEnabled(methodName string) bool {
+	configs := inv.methodPolicies().coalesce
+	on, ok := configs[methodName]
+	if !ok {
+		on = configs["*"]
+	}
+	return on
+}
+
+// flight is an upstream call shared by identical requests.
+type flight struct {
+	done chan struct{}
+	resp proto.Message // read-only once done
+	err  error
+}
+
+// flightGroup tracks the calls in flight by coalescing key.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// invokeCoalesced calls call, unless an identical call is in flight, in which case it waits for that call's
+// result. If the call that was joined is cancelled by its own caller, a still-waiting caller makes its own.
+func (inv *Invoker) invokeCoalesced(ctx context.Context, methodName, target string, reqMsg proto.Message, call func(context.Context) (proto.Message, error)) (proto.Message, error) {
+	if !inv.coalesceEnabled(methodName) {
+		return call(ctx)
+	}
+	key, err := coalesceKey(ctx, methodName, target, reqMsg)
+	if err != nil {
+		return call(ctx)
+	}
+	for {
+		inv.flights.mu.Lock()
+		f, joined := inv.flights.flights[key]
+		if !joined {
+			if inv.flights.flights == nil {
+				inv.flights.flights = make(map[string]*flight)
+			}
+			f = &flight{done: make(chan struct{})}
+			inv.flights.flights[key] = f
+		}
+		inv.flights.mu.Unlock()
+
+		if !joined {
+			f.resp, f.err = call(ctx)
+			inv.flights.mu.Lock()
+			delete(inv.flights.flights, key)
+			inv.flights.mu.Unlock()
+			close(f.done)
+			return f.resp, f.err
+		}
+
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if f.err != nil && ctx.Err() == nil && callerAborted(f.err) {
+			continue // the first caller went away or ran out of time; call again
+		}
+		inv.metrics.Add("gateway_coalesced_calls_total", 1, "method", methodName)
+		SpanFromContext(ctx).SetAttr("coalesced", "true")
+		if d := diagnosticsFromContext(ctx); d != nil {
+			d.Coalesced = true
+		}
+		return f.resp, f.err
+	}
+}
+
+// callerAborted reports whether err is a cancellation or deadline, possibly of the caller that made the call.
+func callerAborted(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// coalesceKey identifies a call by target, method, request message and outgoing metadata, so that callers with
+// different credentials never share a response.
+func coalesceKey(ctx context.Context, methodName, target string, reqMsg proto.Message) (string, error) {
+	var body []byte
+	var err error
+	if m, ok := reqMsg.(interface{ MarshalDeterministic() ([]byte, error) }); ok {
+		body, err = m.MarshalDeterministic()
+	} else {
+		body, err = proto.Marshal(reqMsg)
+	}
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, s := range []string{target, methodName} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range md[k] {
+			h.Write([]byte{0})
+			h.Write([]byte(k))
+			h.Write([]byte{0})
+			h.Write([]byte(v))
+		}
+	}
+	return string(h.Sum(nil)), nil
+}
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// Comments returns the documentation of d written in its proto source: the comment above its definition, else
+// the one after it on the same line, without the comment markers' leading space. It is empty when the
+// descriptors were built without source code info (protoc --include_source_info).
+func Comments(d desc.Descriptor) string {
+	loc := d.GetSourceInfo()
+	if loc == nil {
+		return ""
+	}
+	c := loc.GetLeadingComments()
+	if strings.TrimSpace(c) == "" {
+		c = loc.GetTrailingComments()
+	}
+	lines := strings.Split(c, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(strings.TrimPrefix(line, " "), " \t\r")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrTargetOverloaded is returned by Invoke when a call waited longer than TargetConfig.QueueTimeout for one
+// of the MaxInFlight call slots of its target.
+var ErrTargetOverloaded = errors.New("upstream target overloaded")
+
+// targetLimiter bounds the calls in flight per target (TargetConfig.MaxInFlight), so a slow upstream holds
+// at most that many gateway goroutines and further calls queue instead of piling up on it.
+type targetLimiter struct {
+	mu   sync.Mutex
+	sems map[string]chan struct{}
+}
+
+// acquire takes a call slot of target, waiting up to cfg.QueueTimeout (or as long as ctx allows if zero) for
+// one to free up. The returned release gives it back. Metrics are labeled with label (see connPool.label).
+func (l *targetLimiter) acquire(ctx context.Context, clock Clock, metrics Metrics, target, label string, cfg TargetConfig) (release func(), err error) {
+	if cfg.MaxInFlight <= 0 {
+		return func() {}, nil
+	}
+	sem := l.sem(target, cfg.MaxInFlight)
+	release = func() {
+		<-sem
+		metrics.Set("gateway_upstream_in_flight", float64(len(sem)), "target", label)
+	}
+	select {
+	case sem <- struct{}{}:
+		metrics.Set("gateway_upstream_in_flight", float64(len(sem)), "target", label)
+		return release, nil
+	default:
+	}
+
+	metrics.Add("gateway_upstream_queued_total", 1, "target", label)
+	var timeout chan struct{}
+	if cfg.QueueTimeout > 0 {
+		timeout = make(chan struct{})
+		stop := clock.AfterFunc(cfg.QueueTimeout, func() { close(timeout) })
+		defer stop()
+	}
+	select {
+	case sem <- struct{}{}:
+		metrics.Set("gateway_upstream_in_flight", float64(len(sem)), "target", label)
+		return release, nil
+	case <-timeout:
+		metrics.Add("gateway_upstream_queue_timeouts_total", 1, "target", label)
+		return nil, fmt.Errorf("%w: %s has %d calls in flight, queued for %v", ErrTargetOverloaded, target, cfg.MaxInFlight, cfg.QueueTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *targetLimiter) sem(target string, size int) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.sems == nil {
+		l.sems = make(map[string]chan struct{})
+	}
+	sem, ok := l.sems[target]
+	if !ok || cap(sem) != size {
+		sem = make(chan struct{}, size)
+		l.sems[target] = sem
+	}
+	return sem
+}
@@ -0,0 +1,477 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// connPool keeps one long-lived *grpc.ClientConn per target so calls reuse HTTP/2 connections
+// instead of dialing per request. Connections are replaced when upstream churn is detected. The pool holds at
+// most maxConns connections and gRPC-Web channels together, evicting the least recently used one to make
+// room, and drops those left unused for idleTimeout, so callers naming ever new targets cannot pin
+// connections without bound.
+type connPool struct {
+	mu      sync.Mutex
+	conns   map[string]*pooledConn
+	configs map[string]TargetConfig
+	dial    func(target string, cfg TargetConfig) (*grpc.ClientConn, error)
+	clock   Clock
+
+	maxConns    int           // see WithConnPoolLimits
+	idleTimeout time.Duration // see WithConnPoolLimits
+	nextSweep   time.Time     // when get next looks for idle connections
+
+	labels map[string]bool // unconfigured targets given their own label, see label
+
+	// gRPC-Web targets share one HTTP/1.1 client and its keep-alive connections.
+	web       map[string]*pooledConn
+	webClient *http.Client
+
+	local *bufconn.Listener // in-memory listener of the local server, if any
+
+	maxRecvMsgSize int // caps TargetConfig.MaxRecvMsgSize, see WithMaxResponseBytes
+
+	dialOptions  []grpc.DialOption // for every gRPC target, see WithDialOptions
+	drainTimeout time.Duration     // see WithConnDrainTimeout
+
+	proxy        string                  // see WithProxy
+	proxyClients map[string]*http.Client // gRPC-Web clients by proxy URL, while a pooled channel uses them
+}
+
+// pooledConn is a pooled connection, or gRPC-Web channel, and when a call last took it from the pool.
+type pooledConn struct {
+	conn     *grpc.ClientConn
+	web      *grpcWebChannel
+	lastUsed time.Time
+}
+
+// Default connection pool limits, see WithConnPoolLimits.
+const (
+	defaultMaxConns        = 256
+	defaultConnIdleTimeout = 10 * time.Minute
+)
+
+func newConnPool() *connPool {
+	p := &connPool{
+		conns:        make(map[string]*pooledConn),
+		clock:        SystemClock(),
+		maxConns:     defaultMaxConns,
+		idleTimeout:  defaultConnIdleTimeout,
+		labels:       make(map[string]bool),
+		web:          make(map[string]*pooledConn),
+		proxyClients: make(map[string]*http.Client),
+		webClient:    &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()},
+		drainTimeout: defaultConnDrainTimeout,
+	}
+	p.dial = func(target string, cfg TargetConfig) (*grpc.ClientConn, error) {
+		shared := p.dialOptions
+		if target == LocalTarget && p.local != nil {
+			shared = append(shared[:len(shared):len(shared)], dialLocal(p.local))
+		} else if proxy := p.proxyFor(cfg); proxy != "" {
+			dial, err := proxyDialer(proxy)
+			if err != nil {
+				return nil, err
+			}
+			shared = append([]grpc.DialOption{grpc.WithContextDialer(dial)}, shared...)
+		}
+		if IsXDSTarget(target) {
+			xds, err := xdsDialOption()
+			if err != nil {
+				return nil, err
+			}
+			shared = append([]grpc.DialOption{xds}, shared...)
+		}
+		return grpc.Dial(target, cfg.dialOptions(shared...)...)
+	}
+	return p
+}
+
+// WithDialOptions adds opts to the dial options of every gRPC target, after those derived from its
+// TargetConfig and before its TargetConfig.DialOptions, which can thus override them. gRPC-Web targets
+// ignore them.
+func WithDialOptions(opts ...grpc.DialOption) InvokerOption {
+	return func(inv *Invoker) {
+		inv.conns.dialOptions = append(inv.conns.dialOptions, opts...)
+	}
+}
+
+// WithDialer dials upstream connections with dial instead of net.Dialer, e.g. to tunnel them or to
+// connect to in-memory listeners in tests.
+func WithDialer(dial func(ctx context.Context, addr string) (net.Conn, error)) InvokerOption {
+	return WithDialOptions(grpc.WithContextDialer(dial))
+}
+
+// WithTLS dials upstreams with TLS under cfg (nil: system roots) instead of plaintext.
+func WithTLS(cfg *tls.Config) InvokerOption {
+	return WithDialOptions(grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
+}
+
+// WithUnaryInterceptors chains interceptors around every unary upstream call, e.g. for tracing or auth.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryClientInterceptor) InvokerOption {
+	return WithDialOptions(grpc.WithChainUnaryInterceptor(interceptors...))
+}
+
+// WithStreamInterceptors chains interceptors around every streaming upstream call (see OpenServerStream).
+func WithStreamInterceptors(interceptors ...grpc.StreamClientInterceptor) InvokerOption {
+	return WithDialOptions(grpc.WithChainStreamInterceptor(interceptors...))
+}
+
+// WithCodec marshals upstream messages with codec instead of the registered proto codec. The messages are
+// dynamic messages of the resolved descriptors, so codec must handle proto.Message values.
+func WithCodec(codec encoding.Codec) InvokerOption {
+	return WithDialOptions(grpc.WithDefaultCallOptions(grpc.ForceCodec(codec)))
+}
+
+// WithConnDrainTimeout sets how long a pooled connection replaced after upstream churn stays open for the
+// calls still using it; default 30s.
+func WithConnDrainTimeout(d time.Duration) InvokerOption {
+	return func(inv *Invoker) {
+		if d > 0 {
+			inv.conns.drainTimeout = d
+		}
+	}
+}
+
+// WithConnPoolLimits bounds the pooled gRPC connections and gRPC-Web channels: at most maxConns targets keep
+// one (the least recently used one is dropped to make room) and those unused for idleTimeout are dropped.
+// Dropped connections are closed after the drain timeout (see WithConnDrainTimeout); a proxy client of
+// gRPC-Web channels closes its idle connections once no channel uses it. Zero keeps the defaults of 256
+// connections and 10 minutes.
+func WithConnPoolLimits(maxConns int, idleTimeout time.Duration) InvokerOption {
+	return func(inv *Invoker) {
+		if maxConns > 0 {
+			inv.conns.maxConns = maxConns
+		}
+		if idleTimeout > 0 {
+			inv.conns.idleTimeout = idleTimeout
+		}
+	}
+}
+
+// channel returns the channel for target: a gRPC-Web channel if the target is configured for it,
+// otherwise the pooled connection (conn is nil for gRPC-Web).
+func (p *connPool) channel(target string) (ch grpc.ClientConnInterface, conn *grpc.ClientConn, err error) {
+	cfg := p.config(target)
+	if cfg.Transport != TransportGRPCWeb {
+		conn, _, err = p.get(target)
+		return conn, conn, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	if !now.Before(p.nextSweep) {
+		p.sweepLocked(now)
+	}
+	if pc, ok := p.web[target]; ok {
+		pc.lastUsed = now
+		return pc.web, nil, nil
+	}
+	client := p.webClient
+	if proxy := p.proxyFor(cfg); proxy != "" {
+		if client, err = p.proxyClient(proxy); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(p.conns)+len(p.web) >= p.maxConns {
+		p.evictLRULocked()
+	}
+	web := newGRPCWebChannel(target, cfg, client)
+	p.web[target] = &pooledConn{web: web, lastUsed: now}
+	return web, nil, nil
+}
+
+// Connect dials the pooled connection for target, if it is not pooled yet, and waits until it is ready or ctx
+// is done, e.g. to warm connections up before serving. gRPC-Web targets have nothing to connect and return nil.
+func (inv *Invoker) Connect(ctx context.Context, target string) error {
+	_, conn, err := inv.conns.channel(target)
+	if err != nil || conn == nil {
+		return err
+	}
+	for {
+		state := conn.GetState()
+		switch state {
+		case connectivity.Ready:
+			return nil
+		case connectivity.Idle:
+			conn.Connect()
+		case connectivity.Shutdown:
+			return fmt.Errorf("connect %s: connection closed", target)
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("connect %s: %w (state %s)", target, ctx.Err(), state)
+		}
+	}
+}
+
+// config returns the TargetConfig for target with the pool-wide receive limit applied.
+func (p *connPool) config(target string) TargetConfig {
+	cfg := targetConfig(p.configs, target)
+	if p.maxRecvMsgSize > 0 && (cfg.MaxRecvMsgSize <= 0 || cfg.MaxRecvMsgSize > p.maxRecvMsgSize) {
+		cfg.MaxRecvMsgSize = p.maxRecvMsgSize
+	}
+	return cfg
+}
+
+// get returns the pooled connection for target, dialing it on first use. Dialing a new target into a full
+// pool first drops the least recently used connection.
+func (p *connPool) get(target string) (conn *grpc.ClientConn, fresh bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.clock.Now()
+	if !now.Before(p.nextSweep) {
+		p.sweepLocked(now)
+	}
+	if pc, ok := p.conns[target]; ok {
+		pc.lastUsed = now
+		return pc.conn, false, nil
+	}
+	conn, err = p.dial(target, p.config(target))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(p.conns)+len(p.web) >= p.maxConns {
+		p.evictLRULocked()
+	}
+	p.conns[target] = &pooledConn{conn: conn, lastUsed: now}
+	return conn, true, nil
+}
+
+// sweepLocked drops the connections and gRPC-Web channels unused for idleTimeout. p.mu must be held.
+func (p *connPool) sweepLocked(now time.Time) {
+	for _, m := range []map[string]*pooledConn{p.conns, p.web} {
+		for target, pc := range m {
+			if now.Sub(pc.lastUsed) >= p.idleTimeout {
+				delete(m, target)
+				p.releaseLocked(pc)
+			}
+		}
+	}
+	p.nextSweep = now.Add(p.idleTimeout / 2)
+}
+
+// evictLRULocked drops the least recently used connection or gRPC-Web channel. p.mu must be held.
+func (p *connPool) evictLRULocked() {
+	var oldest *pooledConn
+	var from map[string]*pooledConn
+	var oldestTarget string
+	for _, m := range []map[string]*pooledConn{p.conns, p.web} {
+		for target, pc := range m {
+			if oldest == nil || pc.lastUsed.Before(oldest.lastUsed) {
+				oldest, from, oldestTarget = pc, m, target
+			}
+		}
+	}
+	if oldest != nil {
+		delete(from, oldestTarget)
+		p.releaseLocked(oldest)
+	}
+}
+
+// releaseLocked closes what a dropped pool entry holds: a connection after the drain timeout, or the proxy
+// client of a gRPC-Web channel once no other channel uses it. p.mu must be held.
+func (p *connPool) releaseLocked(pc *pooledConn) {
+	if pc.conn != nil {
+		p.drain(pc.conn)
+		return
+	}
+	client := pc.web.client
+	if client == p.webClient {
+		return
+	}
+	for _, other := range p.web {
+		if other.web.client == client {
+			return
+		}
+	}
+	for proxy, c := range p.proxyClients {
+		if c == client {
+			delete(p.proxyClients, proxy)
+		}
+	}
+	client.CloseIdleConnections()
+}
+
+// drain closes conn after the drain timeout, leaving calls still using it time to finish.
+func (p *connPool) drain(conn *grpc.ClientConn) {
+	p.clock.AfterFunc(p.drainTimeout, func() { _ = conn.Close() })
+}
+
+// snapshot returns the pooled gRPC connections by target.
+func (p *connPool) snapshot() map[string]*grpc.ClientConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[string]*grpc.ClientConn, len(p.conns))
+	for target, pc := range p.conns {
+		out[target] = pc.conn
+	}
+	return out
+}
+
+// maxTargetLabels is how many unconfigured targets get their own metric label and ChurnStats entry; further
+// ones share otherTargetsLabel.
+const maxTargetLabels = 100
+
+// otherTargetsLabel stands for the unconfigured targets beyond maxTargetLabels.
+const otherTargetsLabel = "other"
+
+// label returns the metric label and ChurnStats key of target: the target itself if it has its own
+// TargetConfig or is among the first maxTargetLabels unconfigured targets seen, otherwise otherTargetsLabel,
+// so callers cycling through targets cannot grow metric series without bound.
+func (p *connPool) label(target string) string {
+	if _, ok := p.configs[target]; ok {
+		return target
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.labels[target] {
+		return target
+	}
+	if len(p.labels) >= maxTargetLabels {
+		return otherTargetsLabel
+	}
+	p.labels[target] = true
+	return target
+}
+
+// defaultConnDrainTimeout is how long an evicted connection stays open so in-flight calls on it can finish.
+const defaultConnDrainTimeout = 30 * time.Second
+
+// evict removes conn from the pool if it is still the pooled connection for target, so the next call dials
+// a fresh one. The old connection is closed after the drain timeout rather than immediately, because other
+// in-flight calls may still be using it. It reports whether conn was removed by this call.
+func (p *connPool) evict(target string, conn *grpc.ClientConn, clock Clock) bool {
+	p.mu.Lock()
+	cur, ok := p.conns[target]
+	removed := ok && cur.conn == conn
+	if removed {
+		delete(p.conns, target)
+	}
+	p.mu.Unlock()
+	if removed {
+		clock.AfterFunc(p.drainTimeout, func() { _ = conn.Close() })
+	}
+	return removed
+}
+
+// flush evicts the pooled connections to target, or to every target if it is empty, as evict does. It
+// returns the number of connections evicted.
+func (p *connPool) flush(target string, clock Clock) int {
+	p.mu.Lock()
+	var conns []*grpc.ClientConn
+	for t, pc := range p.conns {
+		if target == "" || t == target {
+			conns = append(conns, pc.conn)
+			delete(p.conns, t)
+		}
+	}
+	p.mu.Unlock()
+	for _, conn := range conns {
+		clock.AfterFunc(p.drainTimeout, func() { _ = conn.Close() })
+	}
+	return len(conns)
+}
+
+// FlushConnections drops the pooled gRPC connections to target, or to every target if it is empty, so the
+// next calls dial anew, e.g. after the upstream's DNS records or certificates changed. Calls in flight finish
+// on the old connections, which are closed after the drain timeout (see WithConnDrainTimeout). It returns
+// the number of connections dropped.
+func (inv *Invoker) FlushConnections(target string) int {
+	return inv.conns.flush(target, inv.clock)
+}
+
+func (p *connPool) closeAll() {
+	p.mu.Lock()
+	conns := p.conns
+	p.conns = make(map[string]*pooledConn)
+	p.mu.Unlock()
+	for _, pc := range conns {
+		_ = pc.conn.Close()
+	}
+	p.webClient.CloseIdleConnections()
+	for _, c := range p.proxyClients {
+		c.CloseIdleConnections()
+	}
+	if p.local != nil {
+		_ = p.local.Close() // stops the local server serving in memory, not on its other listeners
+	}
+}
+
+// Upstream churn kinds reported in metrics and ChurnStats.
+const (
+	churnGoAway = "goaway"
+	churnReset  = "reset"
+)
+
+// ChurnStats counts connection churn observed for one upstream target.
+type ChurnStats struct {
+	GoAways    int64 `json:"goaways"`
+	Resets     int64 `json:"resets"`
+	Reconnects int64 `json:"reconnects"`
+	Retries    int64 `json:"retries"`
+}
+
+type churnTracker struct {
+	mu      sync.Mutex
+	targets map[string]*ChurnStats
+}
+
+func (t *churnTracker) record(target string, f func(*ChurnStats)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.targets == nil {
+		t.targets = make(map[string]*ChurnStats)
+	}
+	st, ok := t.targets[target]
+	if !ok {
+		st = &ChurnStats{}
+		t.targets[target] = st
+	}
+	f(st)
+}
+
+func (t *churnTracker) snapshot() map[string]ChurnStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]ChurnStats, len(t.targets))
+	for k, v := range t.targets {
+		out[k] = *v
+	}
+	return out
+}
+
+// classifyChurn reports whether err is caused by the upstream connection going away
+// (GOAWAY during a rolling deploy, connection reset, transport closing) rather than by the RPC itself.
+func classifyChurn(err error) (kind string, ok bool) {
+	if err == nil {
+		return "", false
+	}
+	st, isStatus := status.FromError(err)
+	if !isStatus || st.Code() != codes.Unavailable {
+		return "", false
+	}
+	msg := strings.ToLower(st.Message())
+	switch {
+	case strings.Contains(msg, "goaway"), strings.Contains(msg, "server closed the stream without sending trailers"):
+		return churnGoAway, true
+	case strings.Contains(msg, "connection reset"),
+		strings.Contains(msg, "transport is closing"),
+		strings.Contains(msg, "error reading from server: eof"),
+		strings.Contains(msg, "broken pipe"):
+		return churnReset, true
+	}
+	return "", false
+}
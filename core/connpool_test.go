@@ -0,0 +1,284 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestClassifyChurn(t *testing.T) {
+	cases := []struct {
+		err   error
+		kind  string
+		churn bool
+	}{
+		{status.Error(codes.Unavailable, `connection error: desc = "error reading from server: EOF"`), churnReset, true},
+		{status.Error(codes.Unavailable, "the connection is draining due to GOAWAY"), churnGoAway, true},
+		{fmt.Errorf("invoke: %w", status.Error(codes.Unavailable, "read: connection reset by peer")), churnReset, true},
+		{status.Error(codes.Unavailable, "service is down for maintenance"), "", false},
+		{status.Error(codes.Internal, "transport is closing"), "", false},
+		{errors.New("boom"), "", false},
+		{nil, "", false},
+	}
+	for _, c := range cases {
+		kind, churn := classifyChurn(c.err)
+		if kind != c.kind || churn != c.churn {
+			t.Errorf("classifyChurn(%v) = (%q, %v), want (%q, %v)", c.err, kind, churn, c.kind, c.churn)
+		}
+	}
+}
+
+func TestInvoker_DialerAndInterceptors(t *testing.T) {
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer()
+	pb.RegisterEchoServiceServer(srv, benchEchoServer{})
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	var intercepted []string
+	inv := NewInvoker(
+		WithDescriptorDir(t.TempDir()),
+		WithCallTimeout(time.Minute),
+		WithDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		WithUnaryInterceptors(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			intercepted = append(intercepted, method)
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}),
+	)
+	defer inv.Close()
+
+	resp, err := inv.Invoke(context.Background(), &InvokeRequest{Target: "echo.internal:443", FullMethodName: benchMethod, Body: []byte(`{"message":"hi"}`)})
+	if err != nil || string(resp) != `{"message":"hi"}` {
+		t.Fatalf("invoke: %s, %v", resp, err)
+	}
+	if len(intercepted) != 1 || intercepted[0] != benchMethod {
+		t.Fatalf("intercepted = %v", intercepted)
+	}
+}
+
+func TestConnPool_LRUAndIdleEviction(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	p := newConnPool()
+	p.clock = clock
+	p.maxConns = 2
+	p.idleTimeout = time.Minute
+	p.dial = func(target string, _ TargetConfig) (*grpc.ClientConn, error) {
+		return grpc.Dial("passthrough:///"+target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	defer p.closeAll()
+
+	get := func(target string) *grpc.ClientConn {
+		t.Helper()
+		conn, _, err := p.get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	closed := func(conn *grpc.ClientConn) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		for conn.GetState() != connectivity.Shutdown {
+			if !conn.WaitForStateChange(ctx, conn.GetState()) {
+				return false
+			}
+		}
+		return true
+	}
+
+	a := get("a")
+	clock.Advance(time.Second)
+	b := get("b")
+	clock.Advance(time.Second)
+	get("a") // a is now more recently used than b
+	clock.Advance(time.Second)
+	get("c")
+	if _, ok := p.snapshot()["b"]; ok || len(p.snapshot()) != 2 {
+		t.Fatalf("pooled = %v, want a and c", p.snapshot())
+	}
+	clock.Advance(p.drainTimeout)
+	if !closed(b) {
+		t.Fatal("evicted connection not closed after the drain timeout")
+	}
+
+	clock.Advance(time.Minute)
+	get("d")
+	if got := p.snapshot(); len(got) != 1 || got["d"] == nil {
+		t.Fatalf("pooled = %v, want only d after the idle timeout", got)
+	}
+	clock.Advance(p.drainTimeout)
+	if !closed(a) {
+		t.Fatal("idle connection not closed after the drain timeout")
+	}
+}
+
+func TestConnPool_WebChannelsShareTheLimits(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	p := newConnPool()
+	p.clock = clock
+	p.maxConns = 2
+	p.idleTimeout = time.Minute
+	p.configs = map[string]TargetConfig{
+		"*":  {Transport: TransportGRPCWeb},
+		"w1": {Transport: TransportGRPCWeb, Proxy: "http://127.0.0.1:1"},
+	}
+	p.dial = func(target string, _ TargetConfig) (*grpc.ClientConn, error) {
+		return grpc.Dial("passthrough:///"+target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	defer p.closeAll()
+
+	channel := func(target string) {
+		t.Helper()
+		if _, _, err := p.channel(target); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Second)
+	}
+	channel("w1")
+	if len(p.proxyClients) != 1 {
+		t.Fatalf("proxy clients = %d, want 1", len(p.proxyClients))
+	}
+	channel("w2")
+	channel("w3")
+	if _, ok := p.web["w1"]; ok || len(p.web) != 2 || len(p.proxyClients) != 0 {
+		t.Fatalf("web channels = %v, proxy clients = %d; want w1 and its proxy client evicted", p.web, len(p.proxyClients))
+	}
+	if _, _, err := p.get("g"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(p.conns) + len(p.web); n != 2 {
+		t.Fatalf("pooled = %d, want connections and channels to share the limit of 2", n)
+	}
+
+	clock.Advance(time.Minute)
+	channel("w4")
+	if _, ok := p.web["w4"]; !ok || len(p.web) != 1 || len(p.conns) != 0 {
+		t.Fatalf("web channels = %v, conns = %v; want only w4 after the idle timeout", p.web, p.conns)
+	}
+}
+
+func TestConnPool_LabelCollapsesUnconfiguredTargets(t *testing.T) {
+	p := newConnPool()
+	p.configs = map[string]TargetConfig{"known:443": {}}
+	for i := 0; i < maxTargetLabels; i++ {
+		target := fmt.Sprintf("t%d:443", i)
+		if got := p.label(target); got != target {
+			t.Fatalf("label(%s) = %s", target, got)
+		}
+	}
+	if got := p.label("new:443"); got != otherTargetsLabel {
+		t.Fatalf("label beyond the limit = %s, want %s", got, otherTargetsLabel)
+	}
+	if got := p.label("t0:443"); got != "t0:443" {
+		t.Fatalf("label of a seen target = %s", got)
+	}
+	if got := p.label("known:443"); got != "known:443" {
+		t.Fatalf("label of a configured target = %s", got)
+	}
+}
+
+// blockingEchoServer signals started and blocks each call until its context is done.
+type blockingEchoServer struct {
+	pb.UnimplementedEchoServiceServer
+	started chan struct{}
+}
+
+func (s blockingEchoServer) Echo(ctx context.Context, _ *pb.EchoRequest) (*pb.EchoResponse, error) {
+	s.started <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestInvoker_RetriesOnFreshConnectionAfterGoAway(t *testing.T) {
+	draining := bufconn.Listen(1 << 16)
+	old := grpc.NewServer()
+	started := make(chan struct{}, 1)
+	pb.RegisterEchoServiceServer(old, blockingEchoServer{started: started})
+	go func() { _ = old.Serve(draining) }()
+	defer old.Stop()
+
+	replacement := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer()
+	pb.RegisterEchoServiceServer(srv, benchEchoServer{})
+	go func() { _ = srv.Serve(replacement) }()
+	defer srv.Stop()
+
+	var current atomic.Pointer[bufconn.Listener]
+	current.Store(draining)
+	inv := NewInvoker(
+		WithDescriptorDir(t.TempDir()),
+		WithDialer(func(ctx context.Context, _ string) (net.Conn, error) { return current.Load().DialContext(ctx) }),
+	)
+	defer inv.Close()
+
+	// Echo declared free of side effects, so that churn retries apply to it.
+	fdp := protodesc.ToFileDescriptorProto(pb.File_echo_proto)
+	fdp.Service[0].Method[0].Options = &descriptorpb.MethodOptions{IdempotencyLevel: descriptorpb.MethodOptions_NO_SIDE_EFFECTS.Enum()}
+	fd, err := desc.CreateFileDescriptor(fdp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fd.FindService("echo.EchoService").FindMethodByName("Echo")
+	req := dynamic.NewMessage(md.GetInputType())
+	req.SetFieldByName("message", "hi")
+
+	const target = "echo.internal:443"
+	type result struct {
+		resp string
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := inv.invokeUnary(context.Background(), target, md, req)
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{resp: resp.String()}
+	}()
+
+	<-started
+	current.Store(replacement)
+	go old.GracefulStop()
+	// Wait for the client to receive the GOAWAY, then drop the connection under the call still in flight.
+	conn := inv.conns.snapshot()[target]
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for conn.GetState() == connectivity.Ready {
+		if !conn.WaitForStateChange(ctx, connectivity.Ready) {
+			t.Fatal("client did not observe the GOAWAY")
+		}
+	}
+	old.Stop()
+
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("invoke: %v", r.err)
+	}
+	if r.resp != `message:"hi"` {
+		t.Fatalf("response = %s", r.resp)
+	}
+	st := inv.ChurnStats()[target]
+	if st.GoAways != 1 || st.Reconnects != 1 || st.Retries != 1 {
+		t.Fatalf("churn stats = %+v, want one goaway, reconnect and retry", st)
+	}
+	if inv.conns.snapshot()[target] == conn {
+		t.Fatal("connection that went away is still pooled")
+	}
+}
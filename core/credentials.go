@@ -0,0 +1,117 @@
+package core
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// tokenCredentials are PerRPCCredentials sending the token of src in the authorization header.
+type tokenCredentials struct {
+	src oauth2.TokenSource
+}
+
+func (c tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	tok, err := c.src.Token()
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "target credentials: %v", err)
+	}
+	return map[string]string{"authorization": tok.Type() + " " + tok.AccessToken}, nil
+}
+
+func (tokenCredentials) RequireTransportSecurity() bool { return true }
+
+// BearerToken returns credentials sending a fixed bearer token with every call.
+func BearerToken(token string) credentials.PerRPCCredentials {
+	return tokenCredentials{src: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token, TokenType: "Bearer"})}
+}
+
+// TokenSourceCredentials returns credentials sending tokens from src, which is asked for a new token only once
+// the previous one has expired.
+func TokenSourceCredentials(src oauth2.TokenSource) credentials.PerRPCCredentials {
+	return tokenCredentials{src: oauth2.ReuseTokenSource(nil, src)}
+}
+
+// ClientCredentials returns credentials obtaining access tokens with the OAuth2 client-credentials grant of cfg,
+// refreshed shortly before they expire.
+func ClientCredentials(cfg *clientcredentials.Config) credentials.PerRPCCredentials {
+	return tokenCredentials{src: cfg.TokenSource(context.Background())}
+}
+
+// GoogleCredentials returns credentials sending access tokens of the Google application default credentials
+// (GOOGLE_APPLICATION_CREDENTIALS, gcloud, or the metadata server of GCE, GKE and Cloud Run) for scopes.
+func GoogleCredentials(ctx context.Context, scopes ...string) (credentials.PerRPCCredentials, error) {
+	src, err := google.DefaultTokenSource(ctx, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("google credentials: %w", err)
+	}
+	return tokenCredentials{src: src}, nil
+}
+
+// GoogleIDTokenCredentials returns credentials sending identity tokens for audience, minted by the metadata
+// server for the default service account, as required by IAM-protected services such as Cloud Run.
+func GoogleIDTokenCredentials(audience string) credentials.PerRPCCredentials {
+	return tokenCredentials{src: oauth2.ReuseTokenSource(nil, idTokenSource{audience: audience})}
+}
+
+type idTokenSource struct {
+	audience string
+}
+
+func (s idTokenSource) Token() (*oauth2.Token, error) {
+	raw, err := metadata.Get("instance/service-accounts/default/identity?audience=" + url.QueryEscape(s.audience) + "&format=full")
+	if err != nil {
+		return nil, fmt.Errorf("fetch identity token: %w", err)
+	}
+	expiry, err := jwtExpiry(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{AccessToken: raw, TokenType: "Bearer", Expiry: expiry}, nil
+}
+
+// jwtExpiry returns the "exp" claim of a JWT, without verifying it.
+func jwtExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("identity token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("decode identity token: %w", err)
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("decode identity token: %w", err)
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
+
+// insecureCredentials allows credentials to be sent over a plaintext connection.
+type insecureCredentials struct {
+	credentials.PerRPCCredentials
+}
+
+func (insecureCredentials) RequireTransportSecurity() bool { return false }
+
+// perRPCCredentials returns c.Credentials, relaxed by c.InsecureCredentials.
+func (c TargetConfig) perRPCCredentials() credentials.PerRPCCredentials {
+	if c.Credentials == nil || !c.InsecureCredentials {
+		return c.Credentials
+	}
+	return insecureCredentials{c.Credentials}
+}
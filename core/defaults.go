@@ -0,0 +1,198 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DefaultValueOption is the field number of the gateway.default_value field option (see
+// proto/gateway/options.proto): the JSON value, e.g. "20" or "\"ASC\"", that the gateway sets on the field
+// when a request leaves it unset:
+//
+//	int32 page_size = 1 [(gateway.default_value) = "20"];
+const DefaultValueOption = 50751
+
+// applyDefaults sets the unset fields of msg at the paths of defaults (dotted field names, JSON or proto
+// form, e.g. "paging.page_size") to their values in the proto3 JSON mapping, creating intermediate messages
+// as needed. Then every unset field with a default_value option in msg, in its set message fields and in the
+// elements of its repeated message fields gets the option's value. Unset means not present, so for proto3
+// scalars a zero value counts as unset.
+func applyDefaults(msg *dynamic.Message, defaults map[string]any, resolver jsonpb.AnyResolver) error {
+	for path, v := range defaults {
+		value, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("default for %s: %w", path, err)
+		}
+		if err := setPath(msg, strings.Split(path, "."), value, false, resolver); err != nil {
+			return fmt.Errorf("default for %s: %w", path, err)
+		}
+	}
+	return applyOptionDefaults(msg, resolver)
+}
+
+// ErrInvalidBinding is returned (wrapped) for InvokeRequest.Overrides that cannot be set on the request
+// message.
+var ErrInvalidBinding = errors.New("invalid field binding")
+
+// applyOverrides sets the fields of msg at the paths of overrides to their values in the proto3 JSON
+// mapping, whether set or not, creating intermediate messages as needed.
+func applyOverrides(msg *dynamic.Message, overrides map[string]any, resolver jsonpb.AnyResolver) error {
+	for path, v := range overrides {
+		value, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", path, err)
+		}
+		if err := setPath(msg, strings.Split(path, "."), value, true, resolver); err != nil {
+			return fmt.Errorf("field %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// setPath sets the field of msg at path to value, unless it is set and overwrite is false.
+func setPath(msg *dynamic.Message, path []string, value []byte, overwrite bool, resolver jsonpb.AnyResolver) error {
+	md := msg.GetMessageDescriptor()
+	fd := md.FindFieldByJSONName(path[0])
+	if fd == nil {
+		fd = md.FindFieldByName(path[0])
+	}
+	if fd == nil {
+		return fmt.Errorf("%s has no field %s", md.GetFullyQualifiedName(), path[0])
+	}
+	if len(path) == 1 {
+		if msg.HasField(fd) && !overwrite {
+			return nil
+		}
+		if overwrite {
+			msg.ClearField(fd)
+		}
+		return setFieldJSON(msg, fd, value, resolver)
+	}
+	if fd.GetMessageType() == nil || fd.IsRepeated() {
+		return fmt.Errorf("%s is not a singular message field", fd.GetName())
+	}
+	var sub *dynamic.Message
+	if msg.HasField(fd) {
+		var err error
+		if sub, err = dynamic.AsDynamicMessage(msg.GetField(fd).(proto.Message)); err != nil {
+			return err
+		}
+	} else {
+		sub = dynamic.NewMessage(fd.GetMessageType())
+	}
+	if err := setPath(sub, path[1:], value, overwrite, resolver); err != nil {
+		return err
+	}
+	return msg.TrySetField(fd, sub)
+}
+
+// setFieldJSON sets field fd of msg to value, a JSON value in the proto3 JSON mapping.
+func setFieldJSON(msg *dynamic.Message, fd *desc.FieldDescriptor, value []byte, resolver jsonpb.AnyResolver) error {
+	tmp := dynamic.NewMessage(msg.GetMessageDescriptor())
+	js := append(append([]byte(`{"`+fd.GetJSONName()+`":`), value...), '}')
+	if err := (&jsonpb.Unmarshaler{AnyResolver: resolver}).Unmarshal(bytes.NewReader(js), tmp); err != nil {
+		return err
+	}
+	if !tmp.HasField(fd) {
+		return nil // the zero value: nothing to set
+	}
+	return msg.TrySetField(fd, tmp.GetField(fd))
+}
+
+func applyOptionDefaults(msg *dynamic.Message, resolver jsonpb.AnyResolver) error {
+	for _, fd := range msg.GetMessageDescriptor().GetFields() {
+		if !msg.HasField(fd) {
+			if value, ok := defaultValueOption(fd); ok {
+				if err := setFieldJSON(msg, fd, []byte(value), resolver); err != nil {
+					return fmt.Errorf("default_value of %s: %w", fd.GetFullyQualifiedName(), err)
+				}
+			}
+			continue
+		}
+		if fd.GetMessageType() == nil || fd.IsMap() {
+			continue
+		}
+		var subs []any
+		if fd.IsRepeated() {
+			for i := 0; i < msg.FieldLength(fd); i++ {
+				subs = append(subs, msg.GetRepeatedField(fd, i))
+			}
+		} else {
+			subs = append(subs, msg.GetField(fd))
+		}
+		for _, v := range subs {
+			sub, ok := v.(*dynamic.Message)
+			if !ok {
+				continue
+			}
+			if err := applyOptionDefaults(sub, resolver); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// defaultValueOption returns the gateway.default_value option of fd. The option's extension is not linked
+// into the gateway, so it is read from the unknown fields of the field options.
+func defaultValueOption(fd *desc.FieldDescriptor) (string, bool) {
+	return stringFieldOption(fd, DefaultValueOption)
+}
+
+// stringFieldOption returns the string field option num of fd from the unknown fields of its options.
+func stringFieldOption(fd *desc.FieldDescriptor, num protowire.Number) (string, bool) {
+	b, ok := fieldOption(fd, num, protowire.BytesType)
+	if !ok {
+		return "", false
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return "", false
+	}
+	return string(v), true
+}
+
+// boolFieldOption returns the bool field option num of fd from the unknown fields of its options.
+func boolFieldOption(fd *desc.FieldDescriptor, num protowire.Number) bool {
+	b, ok := fieldOption(fd, num, protowire.VarintType)
+	if !ok {
+		return false
+	}
+	v, n := protowire.ConsumeVarint(b)
+	return n > 0 && v != 0
+}
+
+// fieldOption returns the encoded value, from just after its tag, of the field option num of fd if it is in
+// the unknown fields of the options with wire type typ.
+func fieldOption(fd *desc.FieldDescriptor, num protowire.Number, typ protowire.Type) ([]byte, bool) {
+	opts := fd.GetFieldOptions()
+	if opts == nil {
+		return nil, false
+	}
+	b := opts.ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		n, t, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return nil, false
+		}
+		b = b[l:]
+		if n == num && t == typ {
+			return b, true
+		}
+		l = protowire.ConsumeFieldValue(n, t, b)
+		if l < 0 {
+			return nil, false
+		}
+		b = b[l:]
+	}
+	return nil, false
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// defaultValue returns field options carrying the gateway.default_value option, as protoc would encode it.
+func defaultValue(v string) *descriptorpb.FieldOptions {
+	opts := &descriptorpb.FieldOptions{}
+	b := protowire.AppendTag(nil, DefaultValueOption, protowire.BytesType)
+	opts.ProtoReflect().SetUnknown(protowire.AppendString(b, v))
+	return opts
+}
+
+func TestApplyDefaults(t *testing.T) {
+	paging := builder.NewMessage("Paging").
+		AddField(builder.NewField("page_size", builder.FieldTypeInt32()).SetOptions(defaultValue("20"))).
+		AddField(builder.NewField("order_by", builder.FieldTypeString()))
+	list := builder.NewMessage("ListRequest").
+		AddField(builder.NewField("paging", builder.FieldTypeMessage(paging))).
+		AddField(builder.NewField("pages", builder.FieldTypeMessage(paging)).SetRepeated()).
+		AddField(builder.NewField("filter", builder.FieldTypeString())).
+		AddField(builder.NewField("view", builder.FieldTypeString()).SetOptions(defaultValue(`"BASIC"`)))
+	fd, err := builder.NewFile("acme/list.proto").SetPackageName("acme").AddMessage(paging).AddMessage(list).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	md := fd.FindMessage("acme.ListRequest")
+
+	decode := func(body string) *dynamic.Message {
+		msg := dynamic.NewMessage(md)
+		if err := msg.UnmarshalJSON([]byte(body)); err != nil {
+			t.Fatalf("decode %s: %v", body, err)
+		}
+		return msg
+	}
+	msg := decode(`{"filter":"state=open","view":"FULL","pages":[{"orderBy":"name"}]}`)
+	defaults := map[string]any{"paging.orderBy": "create_time", "filter": "all", "view": "FULL"}
+	if err := applyDefaults(msg, defaults, nil); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	got, _ := msg.MarshalJSON()
+	want := `{"paging":{"pageSize":20,"orderBy":"create_time"},"pages":[{"pageSize":20,"orderBy":"name"}],"filter":"state=open","view":"FULL"}`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	// Configured defaults win over the field option.
+	msg = decode(`{}`)
+	if err := applyDefaults(msg, map[string]any{"view": "COMPACT", "paging.page_size": 50}, nil); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	got, _ = msg.MarshalJSON()
+	if want := `{"paging":{"pageSize":50},"view":"COMPACT"}`; string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	for path, wantErr := range map[string]string{"missing": "has no field missing", "filter.x": "not a singular message field"} {
+		if err := applyDefaults(decode(`{}`), map[string]any{path: 1}, nil); err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: got %v, want %q", path, err, wantErr)
+		}
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	paging := builder.NewMessage("Paging").
+		AddField(builder.NewField("page_size", builder.FieldTypeInt32())).
+		AddField(builder.NewField("order_by", builder.FieldTypeString()))
+	list := builder.NewMessage("ListRequest").
+		AddField(builder.NewField("paging", builder.FieldTypeMessage(paging))).
+		AddField(builder.NewField("tags", builder.FieldTypeString()).SetRepeated()).
+		AddField(builder.NewField("channel", builder.FieldTypeString()))
+	fd, err := builder.NewFile("acme/list.proto").SetPackageName("acme").AddMessage(paging).AddMessage(list).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	msg := dynamic.NewMessage(fd.FindMessage("acme.ListRequest"))
+	if err := msg.UnmarshalJSON([]byte(`{"channel":"api","tags":["a"],"paging":{"orderBy":"name"}}`)); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	// Path parameters arrive as strings; the proto3 JSON mapping accepts them for numbers.
+	overrides := map[string]any{"channel": "web", "tags": []string{"b", "c"}, "paging.page_size": "10"}
+	if err := applyOverrides(msg, overrides, nil); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	got, _ := msg.MarshalJSON()
+	if want := `{"paging":{"pageSize":10,"orderBy":"name"},"tags":["b","c"],"channel":"web"}`; string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	if err := applyOverrides(msg, map[string]any{"paging.page_size": "ten"}, nil); err == nil {
+		t.Fatal("non-numeric page_size accepted")
+	}
+}
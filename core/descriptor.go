@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -14,6 +15,8 @@ import (
 )
 
 // DefaultDescriptorDir returns the directory of the core package (descriptor .pb files live here, shipped with SDK; callers need not generate them).
+// It is the source directory the package was built from, so it only exists where the source tree does; binaries
+// deployed without it should ship their descriptors with WithDescriptorFS instead.
 func DefaultDescriptorDir() string {
 	_, f, _, _ := runtime.Caller(0)
 	return filepath.Dir(f)
@@ -31,17 +34,52 @@ func ParseFullMethodName(fullMethodName string) (serviceName string, methodName
 
 // MethodResolver resolves and caches *desc.MethodDescriptor by full_method_name.
 type MethodResolver struct {
-	descriptorDir string
-	mu            sync.RWMutex
-	cache         map[string]*desc.MethodDescriptor
+	files     fs.FS  // holds the {service_name}.pb descriptor files
+	location  string // of files, for error messages
+	mu        sync.RWMutex
+	cache     map[string]*desc.MethodDescriptor
+	preloaded []*desc.FileDescriptor // see Preload
+	listed    []*desc.FileDescriptor // embedded and directory files parsed by Files; nil until then
+	flushes   int                    // Flush calls, so Files does not keep a listing parsed before one
 }
 
 // NewMethodResolver creates a method descriptor resolver; descriptorDir is the directory containing .pb files.
 func NewMethodResolver(descriptorDir string) *MethodResolver {
+	dir := descriptorDir
+	if dir == "" {
+		dir = "."
+	}
+	r := NewMethodResolverFS(os.DirFS(dir))
+	r.location = descriptorDir
+	return r
+}
+
+// NewMethodResolverFS creates a method descriptor resolver reading .pb files from the root of fsys, e.g. an
+// embed.FS, so the descriptors need not exist on disk at runtime.
+func NewMethodResolverFS(fsys fs.FS) *MethodResolver {
 	return &MethodResolver{
-		descriptorDir: descriptorDir,
-		cache:         make(map[string]*desc.MethodDescriptor),
+		files: fsys,
+		cache: make(map[string]*desc.MethodDescriptor),
+	}
+}
+
+// Flush drops the cached methods and the files listed by Files, so that edited descriptor files take effect;
+// methods of preloaded sets (see Preload) stay. It returns the number of methods dropped.
+func (r *MethodResolver) Flush() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	before := len(r.cache)
+	r.listed = nil
+	r.flushes++
+	r.cache = make(map[string]*desc.MethodDescriptor)
+	for _, fd := range r.preloaded {
+		for _, svc := range fd.GetServices() {
+			for _, m := range svc.GetMethods() {
+				r.cache["/"+svc.GetFullyQualifiedName()+"/"+m.GetName()] = m
+			}
+		}
 	}
+	return before - len(r.cache)
 }
 
 func (r *MethodResolver) Resolve(fullMethodName string) (*desc.MethodDescriptor, error) {
@@ -62,10 +100,9 @@ func (r *MethodResolver) Resolve(fullMethodName string) (*desc.MethodDescriptor,
 		data = b
 	} else {
 		// Convention: descriptor file name is {service_name}.pb, matching the service name in full_method_name
-		pbPath := filepath.Join(r.descriptorDir, serviceName+".pb")
-		b, err := os.ReadFile(pbPath)
+		b, err := fs.ReadFile(r.files, serviceName+".pb")
 		if err != nil {
-			return nil, fmt.Errorf("read descriptor file %s: %w", pbPath, err)
+			return nil, fmt.Errorf("read descriptor file %s: %w", filepath.Join(r.location, serviceName+".pb"), err)
 		}
 		data = b
 	}
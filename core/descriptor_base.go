@@ -0,0 +1,118 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	// Register the well-known types and the common google/api protos, which uploaded sets may import without
+	// carrying them.
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	_ "google.golang.org/genproto/googleapis/api/httpbody"
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/apipb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/sourcecontextpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/typepb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// baseDescriptors are the files that uploaded descriptor sets may import without carrying them, see
+// InlineMethodResolver.SetBaseDescriptors.
+type baseDescriptors struct {
+	files map[string]*descriptorpb.FileDescriptorProto
+}
+
+// SetBaseDescriptors sets the base descriptor sets of inline and fetched descriptors, see
+// InlineMethodResolver.SetBaseDescriptors.
+func (inv *Invoker) SetBaseDescriptors(sets ...[]byte) error {
+	return inv.inlineResolver.SetBaseDescriptors(sets...)
+}
+
+// SetBaseDescriptors sets the FileDescriptorSets (e.g. organization-wide common protos) whose files fill in
+// the imports missing from uploaded sets, so clients can upload only their own files. The well-known types
+// (google/protobuf/*) and the common google/api protos (annotations, http, httpbody, field_behavior, resource,
+// client) are always available; base files of the same name take precedence.
+// A file present in several base sets must have the same content in all of them.
+func (r *InlineMethodResolver) SetBaseDescriptors(sets ...[]byte) error {
+	base := &baseDescriptors{files: make(map[string]*descriptorpb.FileDescriptorProto)}
+	for i, data := range sets {
+		data, err := DecompressDescriptorSet(data, "")
+		if err != nil {
+			return fmt.Errorf("base descriptor set %d: %w", i, err)
+		}
+		var fds descriptorpb.FileDescriptorSet
+		if err := proto.Unmarshal(data, &fds); err != nil {
+			return fmt.Errorf("base descriptor set %d: unmarshal FileDescriptorSet: %w", i, err)
+		}
+		for _, fd := range fds.GetFile() {
+			if existing, ok := base.files[fd.GetName()]; ok && !proto.Equal(existing, fd) {
+				return fmt.Errorf("base descriptor set %d: file %q already registered with different content", i, fd.GetName())
+			}
+			base.files[fd.GetName()] = fd
+		}
+	}
+	all := &descriptorpb.FileDescriptorSet{}
+	for _, fd := range base.files {
+		all.File = append(all.File, fd)
+	}
+	if err := ValidateDescriptorSet(base.complete(all)); err != nil {
+		return fmt.Errorf("base descriptors: %w", err)
+	}
+	r.base.Store(base)
+	return nil
+}
+
+// complete returns fds with the files it imports but does not carry, transitively, taken from the base
+// files or the well-known ones. Imports found in neither are left for ValidateDescriptorSet to report.
+func (b *baseDescriptors) complete(fds *descriptorpb.FileDescriptorSet) *descriptorpb.FileDescriptorSet {
+	have := make(map[string]bool, len(fds.GetFile()))
+	for _, fd := range fds.GetFile() {
+		have[fd.GetName()] = true
+	}
+	var added []*descriptorpb.FileDescriptorProto
+	var add func(fd *descriptorpb.FileDescriptorProto)
+	add = func(fd *descriptorpb.FileDescriptorProto) {
+		for _, dep := range fd.GetDependency() {
+			if have[dep] {
+				continue
+			}
+			if f := b.lookup(dep); f != nil {
+				have[dep] = true
+				add(f)
+				// Dependencies first, as descriptor sets list them.
+				added = append(added, f)
+			}
+		}
+	}
+	for _, fd := range fds.GetFile() {
+		add(fd)
+	}
+	if len(added) == 0 {
+		return fds
+	}
+	return &descriptorpb.FileDescriptorSet{File: append(added, fds.GetFile()...)}
+}
+
+func (b *baseDescriptors) lookup(name string) *descriptorpb.FileDescriptorProto {
+	if b != nil {
+		if fd, ok := b.files[name]; ok {
+			return fd
+		}
+	}
+	if !strings.HasPrefix(name, "google/protobuf/") && !strings.HasPrefix(name, "google/api/") {
+		return nil
+	}
+	if fd, err := protoregistry.GlobalFiles.FindFileByPath(name); err == nil {
+		return protodesc.ToFileDescriptorProto(fd)
+	}
+	return nil
+}
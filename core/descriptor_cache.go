@@ -0,0 +1,237 @@
+package core
+
+import (
+	"container/list"
+	"time"
+)
+
+// DescriptorCacheLimits bounds the inline descriptor cache. Any client can submit arbitrary descriptor_ids,
+// so the cache evicts least-recently-used pools once a limit is reached.
+//
+// Zero values select the defaults; negative values disable the corresponding limit.
+type DescriptorCacheLimits struct {
+	MaxEntries int           // default 1024
+	MaxBytes   int64         // total FileDescriptorSet bytes, including in-progress chunked uploads; default 256MiB
+	TTL        time.Duration // max age of a cached pool since upload; default none
+}
+
+const (
+	defaultDescriptorCacheMaxEntries = 1024
+	defaultDescriptorCacheMaxBytes   = 256 << 20
+)
+
+// DescriptorCacheStats is a point-in-time view of the inline descriptor cache.
+type DescriptorCacheStats struct {
+	Entries     int   `json:"entries"`
+	Bytes       int64 `json:"bytes"`
+	Evictions   int64 `json:"evictions"`
+	Expirations int64 `json:"expirations"`
+	// PendingBytes are held by in-progress chunked uploads and count toward MaxBytes.
+	PendingBytes int64 `json:"pending_bytes"`
+}
+
+type descriptorCacheEntry struct {
+	key      string
+	pool     *InlineDescriptorPool // the current version's pool
+	size     int64                 // bytes of all retained versions
+	loadedAt time.Time
+	versions []*descriptorVersion // oldest first
+}
+
+// DescriptorVersion describes one uploaded revision of a descriptor_id.
+type DescriptorVersion struct {
+	Version    int       `json:"version"`
+	Hash       string    `json:"hash"` // hex sha256 of the FileDescriptorSet
+	UploadedAt time.Time `json:"uploaded_at"`
+	Size       int64     `json:"size"`
+	Current    bool      `json:"current"`
+}
+
+type descriptorVersion struct {
+	DescriptorVersion
+	pool *InlineDescriptorPool
+}
+
+// maxDescriptorVersions bounds the history kept per descriptor_id; older versions are dropped first.
+const maxDescriptorVersions = 16
+
+// descriptorCache is an LRU of descriptor pools keyed by descriptor_id. It is not safe for concurrent use;
+// InlineMethodResolver guards it with its mutex.
+type descriptorCache struct {
+	limits  DescriptorCacheLimits
+	metrics Metrics
+	ll      *list.List
+	items   map[string]*list.Element
+	stats   DescriptorCacheStats
+}
+
+func newDescriptorCache(limits DescriptorCacheLimits) *descriptorCache {
+	if limits.MaxEntries == 0 {
+		limits.MaxEntries = defaultDescriptorCacheMaxEntries
+	}
+	if limits.MaxBytes == 0 {
+		limits.MaxBytes = defaultDescriptorCacheMaxBytes
+	}
+	return &descriptorCache{
+		limits:  limits,
+		metrics: NopMetrics(),
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+func (c *descriptorCache) get(key string, now time.Time) (*InlineDescriptorPool, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*descriptorCacheEntry)
+	if c.limits.TTL > 0 && now.Sub(e.loadedAt) >= c.limits.TTL {
+		c.removeElement(el)
+		c.stats.Expirations++
+		c.metrics.Add("gateway_descriptor_cache_expirations_total", 1)
+		c.report()
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.pool, true
+}
+
+// getVersion returns the pool of a specific version of key.
+func (c *descriptorCache) getVersion(key string, version int, now time.Time) (*InlineDescriptorPool, bool) {
+	if _, ok := c.get(key, now); !ok {
+		return nil, false
+	}
+	for _, v := range c.items[key].Value.(*descriptorCacheEntry).versions {
+		if v.Version == version {
+			return v.pool, true
+		}
+	}
+	return nil, false
+}
+
+// reserve counts n more bytes of in-progress uploads toward MaxBytes, evicting pools to make room. It reports
+// false, reserving nothing, if the uploads alone would exceed MaxBytes.
+func (c *descriptorCache) reserve(n int64) bool {
+	if c.limits.MaxBytes > 0 && c.stats.PendingBytes+n > c.limits.MaxBytes {
+		return false
+	}
+	c.stats.PendingBytes += n
+	for c.ll.Len() > 0 && c.overLimit() {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+		c.metrics.Add("gateway_descriptor_cache_evictions_total", 1)
+	}
+	c.report()
+	return true
+}
+
+// release returns n bytes reserved for in-progress uploads.
+func (c *descriptorCache) release(n int64) {
+	c.stats.PendingBytes -= n
+	c.report()
+}
+
+// put stores pool as the new current version of key. Re-uploading the content of the current version
+// refreshes it without creating a version.
+func (c *descriptorCache) put(key string, pool *InlineDescriptorPool, size int64, now time.Time) {
+	var versions []*descriptorVersion
+	next := 1
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*descriptorCacheEntry)
+		if e.pool.hash == pool.hash {
+			e.loadedAt = now
+			c.ll.MoveToFront(el)
+			return
+		}
+		c.removeElement(el)
+		versions = e.versions
+		next = versions[len(versions)-1].Version + 1
+	}
+	versions = append(versions, &descriptorVersion{
+		DescriptorVersion: DescriptorVersion{Version: next, Hash: pool.hash, UploadedAt: now, Size: size},
+		pool:              pool,
+	})
+	if len(versions) > maxDescriptorVersions {
+		versions = versions[len(versions)-maxDescriptorVersions:]
+	}
+	var total int64
+	for _, v := range versions {
+		total += v.Size
+	}
+	c.insert(&descriptorCacheEntry{key: key, pool: pool, size: total, loadedAt: now, versions: versions})
+}
+
+// insert adds e as the most recently used entry and evicts as needed.
+func (c *descriptorCache) insert(e *descriptorCacheEntry) {
+	if el, ok := c.items[e.key]; ok {
+		c.removeElement(el)
+	}
+	c.items[e.key] = c.ll.PushFront(e)
+	c.stats.Entries++
+	c.stats.Bytes += e.size
+
+	// Evict from the back, but never the entry just inserted.
+	for c.ll.Len() > 1 && c.overLimit() {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+		c.metrics.Add("gateway_descriptor_cache_evictions_total", 1)
+	}
+	c.report()
+}
+
+// versionList lists the retained versions of key, oldest first.
+func (c *descriptorCache) versionList(key string, now time.Time) ([]DescriptorVersion, bool) {
+	if _, ok := c.get(key, now); !ok {
+		return nil, false
+	}
+	e := c.items[key].Value.(*descriptorCacheEntry)
+	out := make([]DescriptorVersion, len(e.versions))
+	for i, v := range e.versions {
+		out[i] = v.DescriptorVersion
+		out[i].Current = v.pool == e.pool
+	}
+	return out, true
+}
+
+// rollback makes version the current version of key.
+func (c *descriptorCache) rollback(key string, version int, now time.Time) bool {
+	if _, ok := c.get(key, now); !ok {
+		return false
+	}
+	e := c.items[key].Value.(*descriptorCacheEntry)
+	for _, v := range e.versions {
+		if v.Version == version {
+			e.pool = v.pool
+			return true
+		}
+	}
+	return false
+}
+
+func (c *descriptorCache) delete(key string) {
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+		c.report()
+	}
+}
+
+func (c *descriptorCache) overLimit() bool {
+	if c.limits.MaxEntries > 0 && c.stats.Entries > c.limits.MaxEntries {
+		return true
+	}
+	return c.limits.MaxBytes > 0 && c.stats.Bytes+c.stats.PendingBytes > c.limits.MaxBytes
+}
+
+func (c *descriptorCache) removeElement(el *list.Element) {
+	e := c.ll.Remove(el).(*descriptorCacheEntry)
+	delete(c.items, e.key)
+	c.stats.Entries--
+	c.stats.Bytes -= e.size
+}
+
+func (c *descriptorCache) report() {
+	c.metrics.Set("gateway_descriptor_cache_entries", float64(c.stats.Entries))
+	c.metrics.Set("gateway_descriptor_cache_bytes", float64(c.stats.Bytes))
+	c.metrics.Set("gateway_descriptor_sync_pending_bytes", float64(c.stats.PendingBytes))
+}
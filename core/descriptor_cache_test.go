@@ -0,0 +1,119 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestInlineMethodResolver_LRUEviction(t *testing.T) {
+	fds, _ := EmbeddedDescriptorSet("echo.EchoService")
+	metrics := NewMemoryMetrics()
+
+	r := NewInlineMethodResolver()
+	r.SetCacheLimits(DescriptorCacheLimits{MaxEntries: 2})
+	r.SetMetrics(metrics)
+
+	ctx := context.Background()
+	for _, id := range []string{"a", "b"} {
+		if _, _, err := r.Resolve(ctx, "", fds, id, "", "/echo.EchoService/Echo"); err != nil {
+			t.Fatalf("resolve %s: %v", id, err)
+		}
+	}
+	// Touch "a" so that "b" becomes least recently used.
+	if _, _, err := r.Resolve(ctx, "", nil, "a", "", "/echo.EchoService/Echo"); err != nil {
+		t.Fatalf("resolve cached a: %v", err)
+	}
+	if _, _, err := r.Resolve(ctx, "", fds, "c", "", "/echo.EchoService/Echo"); err != nil {
+		t.Fatalf("resolve c: %v", err)
+	}
+
+	if _, _, err := r.Resolve(ctx, "", nil, "b", "", "/echo.EchoService/Echo"); err == nil {
+		t.Fatalf("expected b to be evicted")
+	}
+	if _, _, err := r.Resolve(ctx, "", nil, "a", "", "/echo.EchoService/Echo"); err != nil {
+		t.Fatalf("expected a to survive eviction: %v", err)
+	}
+
+	st := r.CacheStats()
+	if st.Entries != 2 || st.Evictions != 1 || st.Bytes != int64(2*len(fds)) {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+	if got := metrics.Get("gateway_descriptor_cache_entries"); got != 2 {
+		t.Fatalf("unexpected entries gauge: %v", got)
+	}
+}
+
+func TestInlineMethodResolver_TTL(t *testing.T) {
+	fds, _ := EmbeddedDescriptorSet("echo.EchoService")
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+
+	r := NewInlineMethodResolver()
+	r.clock = clock
+	r.SetCacheLimits(DescriptorCacheLimits{TTL: time.Minute})
+
+	ctx := context.Background()
+	if _, _, err := r.Resolve(ctx, "", fds, "echo", "", "/echo.EchoService/Echo"); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	clock.Advance(59 * time.Second)
+	if _, _, err := r.Resolve(ctx, "", nil, "echo", "", "/echo.EchoService/Echo"); err != nil {
+		t.Fatalf("resolve before TTL: %v", err)
+	}
+	clock.Advance(time.Second)
+	if _, _, err := r.Resolve(ctx, "", nil, "echo", "", "/echo.EchoService/Echo"); err == nil {
+		t.Fatalf("expected descriptor to expire")
+	}
+	if st := r.CacheStats(); st.Expirations != 1 || st.Entries != 0 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+}
+
+func TestInlineMethodResolver_PendingSyncs(t *testing.T) {
+	fds, _ := EmbeddedDescriptorSet("echo.EchoService")
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+
+	r := NewInlineMethodResolver()
+	r.clock = clock
+	r.SetCacheLimits(DescriptorCacheLimits{MaxBytes: int64(4 * len(fds))})
+	if _, _, err := r.Resolve(context.Background(), "", fds, "cached", "", "/echo.EchoService/Echo"); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	// Abandoned uploads never block new ones: the idlest is dropped to make room.
+	for i := 0; i < maxPendingDescriptorSyncs+1; i++ {
+		if _, _, _, err := r.SyncDescriptorChunk(fmt.Sprintf("abandoned-%d", i), 0, 2, []byte{1}, false, false); err != nil {
+			t.Fatalf("sync %d: %v", i, err)
+		}
+		clock.Advance(time.Millisecond)
+	}
+	if len(r.pending) != maxPendingDescriptorSyncs || r.pending["abandoned-0"] != nil {
+		t.Fatalf("pending = %d, abandoned-0 kept: %v", len(r.pending), r.pending["abandoned-0"] != nil)
+	}
+	if st := r.CacheStats(); st.PendingBytes != maxPendingDescriptorSyncs {
+		t.Fatalf("pending bytes = %d", st.PendingBytes)
+	}
+
+	// They expire once idle, releasing their bytes.
+	clock.Advance(descriptorSyncIdleTimeout)
+	big := make([]byte, 3*len(fds))
+	if _, _, _, err := r.SyncDescriptorChunk("big", 0, 3, big, false, false); err != nil {
+		t.Fatalf("sync big: %v", err)
+	}
+	if len(r.pending) != 1 {
+		t.Fatalf("pending = %d after the idle timeout", len(r.pending))
+	}
+
+	// Pending bytes count toward MaxBytes: the cached pool is evicted to make room, and uploads beyond the
+	// limit are refused.
+	if _, _, _, err := r.SyncDescriptorChunk("big", 1, 3, make([]byte, len(fds)/2), false, false); err != nil {
+		t.Fatalf("sync big chunk 1: %v", err)
+	}
+	if st := r.CacheStats(); st.Entries != 0 || st.Evictions != 1 {
+		t.Fatalf("stats = %+v, want the cached pool evicted", st)
+	}
+	if _, _, _, err := r.SyncDescriptorChunk("other", 0, 1, big, false, false); err == nil {
+		t.Fatal("expected uploads over the byte limit to be refused")
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressions of uploaded FileDescriptorSets, see DecompressDescriptorSet.
+const (
+	DescriptorEncodingIdentity = "identity"
+	DescriptorEncodingGzip     = "gzip"
+	DescriptorEncodingZstd     = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// DetectDescriptorEncoding returns the compression of data from its magic bytes. A serialized
+// FileDescriptorSet starts with the tag of its first file (0x0a), so it cannot be mistaken for either.
+func DetectDescriptorEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return DescriptorEncodingGzip
+	case bytes.HasPrefix(data, zstdMagic):
+		return DescriptorEncodingZstd
+	}
+	return DescriptorEncodingIdentity
+}
+
+// DecompressDescriptorSet returns the FileDescriptorSet in data, compressed with encoding; the empty
+// encoding detects it from the magic bytes. Decompressed sets are bounded like chunked uploads (32MiB).
+func DecompressDescriptorSet(data []byte, encoding string) ([]byte, error) {
+	if encoding == "" {
+		encoding = DetectDescriptorEncoding(data)
+	}
+	var r io.Reader
+	switch encoding {
+	case DescriptorEncodingIdentity:
+		return data, nil
+	case DescriptorEncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gzip descriptor: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	case DescriptorEncodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxDescriptorSyncBytes))
+		if err != nil {
+			return nil, fmt.Errorf("zstd descriptor: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("unsupported descriptor encoding %q", encoding)
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxDescriptorSyncBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s descriptor: %w", encoding, err)
+	}
+	if len(out) > maxDescriptorSyncBytes {
+		return nil, fmt.Errorf("descriptor too large: more than %d bytes decompressed", maxDescriptorSyncBytes)
+	}
+	return out, nil
+}
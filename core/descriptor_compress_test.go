@@ -0,0 +1,44 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestDecompressDescriptorSet(t *testing.T) {
+	set := buildServiceSet(t, "acme/users.proto", "Users", "User")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(set)
+	_ = zw.Close()
+	enc, _ := zstd.NewWriter(nil)
+	zst := enc.EncodeAll(set, nil)
+
+	for name, data := range map[string][]byte{"identity": set, "gzip": gz.Bytes(), "zstd": zst} {
+		if got := DetectDescriptorEncoding(data); got != name {
+			t.Errorf("%s detected as %s", name, got)
+		}
+		out, err := DecompressDescriptorSet(data, "")
+		if err != nil || !bytes.Equal(out, set) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := DecompressDescriptorSet(set, DescriptorEncodingGzip); err == nil {
+		t.Error("uncompressed set decoded as gzip")
+	}
+
+	// Compressed uploads of the same set are one version.
+	r := NewInlineMethodResolver()
+	for _, data := range [][]byte{gz.Bytes(), zst, set} {
+		if _, _, err := r.Resolve(context.Background(), "", data, "users", "acme.Users", "Get"); err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+	}
+	if versions, _ := r.DescriptorVersions("users"); len(versions) != 1 {
+		t.Fatalf("versions = %+v", versions)
+	}
+}
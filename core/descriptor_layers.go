@@ -0,0 +1,246 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DescriptorLayer is a source methods are resolved from, see WithDescriptorLayers.
+type DescriptorLayer string
+
+const (
+	// LayerLocal is the services registered on the in-process server, for calls to LocalTarget.
+	LayerLocal DescriptorLayer = "local"
+	// LayerDirectory is the preloaded and embedded descriptor sets and the {service}.pb files of the
+	// descriptor directory.
+	LayerDirectory DescriptorLayer = "directory"
+	// LayerCache is the inline descriptors cached under descriptor_ids in the request's namespace.
+	LayerCache DescriptorLayer = "cache"
+	// LayerRegistry is the DescriptorFetcher; requests without a descriptor_id ask it for the service name.
+	LayerRegistry DescriptorLayer = "registry"
+)
+
+// DefaultDescriptorLayers is the resolution order of full method names without WithDescriptorLayers.
+// Requests naming a descriptor_id try the cache and registry first and then fall back to the local server
+// and the descriptor directory, as with WithDescriptorLayers.
+var DefaultDescriptorLayers = []DescriptorLayer{LayerLocal, LayerDirectory, LayerCache, LayerRegistry}
+
+// errLayerSkipped is returned by resolveFrom for layers that do not apply to a request.
+var errLayerSkipped = errors.New("layer does not apply")
+
+// WithDescriptorLayers sets the order methods are resolved in; layers left out are not consulted. A request
+// naming a descriptor_id tries the layers keyed by it (cache, registry) before falling back to those keyed by
+// method name (local, directory), each group in the given order; a pinned "id@vN" only resolves from the
+// cache. Requests with an inline descriptor always use it.
+func WithDescriptorLayers(layers ...DescriptorLayer) InvokerOption {
+	return func(inv *Invoker) {
+		inv.layers = layers
+	}
+}
+
+// ParseDescriptorLayers parses layer names, as in configuration files.
+func ParseDescriptorLayers(names []string) ([]DescriptorLayer, error) {
+	layers := make([]DescriptorLayer, 0, len(names))
+	seen := make(map[DescriptorLayer]bool, len(names))
+	for _, name := range names {
+		layer := DescriptorLayer(strings.TrimSpace(name))
+		switch layer {
+		case LayerLocal, LayerDirectory, LayerCache, LayerRegistry:
+		default:
+			return nil, fmt.Errorf("unknown descriptor layer %q", name)
+		}
+		if seen[layer] {
+			return nil, fmt.Errorf("descriptor layer %q listed twice", name)
+		}
+		seen[layer] = true
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// layerOrder returns the layers to try for a request, by whether it names a descriptor_id.
+func (inv *Invoker) layerOrder(byID bool) []DescriptorLayer {
+	layers := inv.layers
+	if layers == nil {
+		layers = DefaultDescriptorLayers
+	}
+	if !byID {
+		return layers
+	}
+	out := make([]DescriptorLayer, 0, len(layers))
+	for _, keyed := range []bool{true, false} {
+		for _, layer := range layers {
+			if (layer == LayerCache || layer == LayerRegistry) == keyed {
+				out = append(out, layer)
+			}
+		}
+	}
+	return out
+}
+
+// resolvedCall is the resolution of an InvokeRequest made by ResolveMethod.
+type resolvedCall struct {
+	method   *ResolvedMethod
+	name     string
+	duration time.Duration
+}
+
+// ResolveMethod resolves the method of req as calling it would and returns its full name
+// ("/package.Service/Method"), whichever way req spells it (e.g. a short service name). The resolution is
+// kept in req, and calls of req reuse it: they run exactly the method named here, and an inline descriptor is
+// loaded only once. Change none of the method or descriptor fields of req afterwards.
+func (inv *Invoker) ResolveMethod(ctx context.Context, req *InvokeRequest) (string, error) {
+	clock := ClockFromContext(ctx, inv.clock)
+	for _, d := range []time.Duration{inv.timeout, req.Timeout} {
+		if d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = WithTimeout(ctx, clock, d)
+			defer cancel()
+		}
+	}
+	start := clock.Now()
+	method, name, err := inv.resolve(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	req.resolved = &resolvedCall{method: method, name: name, duration: clock.Now().Sub(start)}
+	return name, nil
+}
+
+// resolve returns the method of req and its full name, from the inline descriptor of req or else from the
+// first descriptor layer that has it.
+func (inv *Invoker) resolve(ctx context.Context, req *InvokeRequest) (*ResolvedMethod, string, error) {
+	if r := req.resolved; r != nil {
+		return r.method, r.name, nil
+	}
+	if len(req.InlineDescriptorSet) > 0 {
+		if req.MethodName == "" {
+			return nil, "", fmt.Errorf("missing method for inline descriptor invocation")
+		}
+		set := req.InlineDescriptorSet
+		if req.MergeDescriptor {
+			if req.DescriptorID == "" {
+				return nil, "", fmt.Errorf("descriptor merge requires a descriptor_id")
+			}
+			if err := inv.inlineResolver.MergeDescriptorSet(NamespacedDescriptorID(req.DescriptorNamespace, req.DescriptorID), set); err != nil {
+				return nil, "", fmt.Errorf("merge inline descriptor: %w", err)
+			}
+			set = nil
+		}
+		method, _, err := inv.inlineResolver.Resolve(ctx, req.DescriptorNamespace, set, req.DescriptorID, req.ServiceName, req.MethodName)
+		if err != nil {
+			return nil, "", fmt.Errorf("resolve method from inline descriptor: %w", err)
+		}
+		return method, "/" + method.ServiceFQN + "/" + method.Method.GetName(), nil
+	}
+
+	byID := req.DescriptorID != ""
+	fullMethodName := req.FullMethodName
+	if byID {
+		if req.MethodName == "" {
+			return nil, "", fmt.Errorf("missing method for inline descriptor invocation")
+		}
+		fullMethodName = joinMethodName(req.ServiceName, req.MethodName)
+	} else if fullMethodName == "" {
+		return nil, "", fmt.Errorf("missing full method name")
+	}
+	_, _, pinned := ParseDescriptorVersion(req.DescriptorID)
+	var errs layerErrors
+	for _, layer := range inv.layerOrder(byID) {
+		if pinned && layer != LayerCache {
+			continue
+		}
+		method, err := inv.resolveFrom(ctx, layer, req, fullMethodName)
+		if err == nil {
+			return method, "/" + method.ServiceFQN + "/" + method.Method.GetName(), nil
+		}
+		if err != errLayerSkipped {
+			errs = append(errs, fmt.Errorf("%s: %w", layer, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil, "", fmt.Errorf("resolve method %s: no descriptor layer applies", fullMethodName)
+	}
+	return nil, "", fmt.Errorf("resolve method %s: %w", fullMethodName, errs)
+}
+
+// layerErrors are why each consulted layer could not resolve a method.
+type layerErrors []error
+
+func (e layerErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e layerErrors) Unwrap() []error { return e }
+
+// resolveFrom looks the method of req up in one layer; name-keyed layers use fullMethodName, which is empty
+// if req names the method by a short service name.
+func (inv *Invoker) resolveFrom(ctx context.Context, layer DescriptorLayer, req *InvokeRequest, fullMethodName string) (*ResolvedMethod, error) {
+	byID := req.DescriptorID != ""
+	switch layer {
+	case LayerLocal:
+		if req.Target != LocalTarget || inv.local == nil || fullMethodName == "" {
+			return nil, errLayerSkipped
+		}
+		md, err := inv.resolveLocal(fullMethodName)
+		if err != nil {
+			return nil, err
+		}
+		return &ResolvedMethod{Method: md, ServiceFQN: md.GetService().GetFullyQualifiedName(), Source: "local"}, nil
+	case LayerDirectory:
+		if fullMethodName == "" {
+			return nil, errLayerSkipped
+		}
+		md, err := inv.resolver.Resolve(fullMethodName)
+		if err != nil {
+			return nil, err
+		}
+		return &ResolvedMethod{Method: md, ServiceFQN: md.GetService().GetFullyQualifiedName(), Source: "directory"}, nil
+	case LayerCache:
+		if byID {
+			method, _, err := inv.inlineResolver.resolveCached(ctx, req.DescriptorNamespace, req.DescriptorID, req.ServiceName, req.MethodName)
+			return method, err
+		}
+		if method, ok := inv.inlineResolver.FindMethod(req.DescriptorNamespace, fullMethodName); ok {
+			return method, nil
+		}
+		return nil, fmt.Errorf("method not found in cached descriptors")
+	case LayerRegistry:
+		if inv.inlineResolver.fetcher == nil {
+			return nil, errLayerSkipped
+		}
+		id, service, method := req.DescriptorID, req.ServiceName, req.MethodName
+		if !byID {
+			var err error
+			if service, method, err = ParseFullMethodName(fullMethodName); err != nil {
+				return nil, err
+			}
+			id = service
+		}
+		rm, _, err := inv.inlineResolver.resolveFetched(ctx, req.DescriptorNamespace, id, service, method)
+		return rm, err
+	}
+	return nil, errLayerSkipped
+}
+
+// joinMethodName returns "/service/method" for a v2 request, or "" if service is not given and method is not
+// a full method name. The service may still be a short name, which the name-keyed layers will not find.
+func joinMethodName(service, method string) string {
+	if strings.Contains(method, "/") {
+		if svc, m, err := ParseFullMethodName(method); err == nil {
+			return "/" + svc + "/" + m
+		}
+	}
+	service = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(service), "/"), ".")
+	if service == "" {
+		return ""
+	}
+	return "/" + service + "/" + strings.TrimPrefix(strings.TrimSpace(method), "/")
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+type mapFetcher map[string][]byte
+
+func (f mapFetcher) FetchDescriptorSet(_ context.Context, id string) ([]byte, bool, error) {
+	b, ok := f[id]
+	return b, ok, nil
+}
+
+func TestInvoker_DescriptorLayers(t *testing.T) {
+	users := buildServiceSet(t, "acme/users.proto", "Users", "User")
+	orders := buildServiceSet(t, "acme/orders.proto", "Orders", "Order")
+	newInvoker := func(opts ...InvokerOption) *Invoker {
+		inv := NewInvoker(append([]InvokerOption{WithDescriptorDir(t.TempDir()), WithDescriptorFetcher(mapFetcher{"acme.Orders": orders})}, opts...)...)
+		if _, _, _, err := inv.SyncInlineDescriptorChunk("users", 0, 1, users, false, false); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		return inv
+	}
+	resolve := func(inv *Invoker, req InvokeRequest) (string, error) {
+		t.Helper()
+		m, _, err := inv.resolve(context.Background(), &req)
+		if err != nil {
+			return "", err
+		}
+		return m.Source, nil
+	}
+
+	inv := newInvoker()
+	for _, c := range []struct {
+		name string
+		req  InvokeRequest
+		want string
+	}{
+		{"full name from an upload", InvokeRequest{FullMethodName: "/acme.Users/Get"}, "cache"},
+		{"full name from the registry", InvokeRequest{FullMethodName: "/acme.Orders/Get"}, "fetched"},
+		{"full name from embedded sets", InvokeRequest{FullMethodName: "/echo.EchoService/Echo"}, "directory"},
+		{"descriptor_id", InvokeRequest{DescriptorID: "users", ServiceName: "acme.Users", MethodName: "Get"}, "cache"},
+	} {
+		if got, err := resolve(inv, c.req); err != nil || got != c.want {
+			t.Errorf("%s: source = %q, %v; want %q", c.name, got, err, c.want)
+		}
+	}
+	// Unknown descriptor_ids fall back to the directory, unless the chain leaves it out.
+	unknown := InvokeRequest{DescriptorID: "nope", ServiceName: "echo.EchoService", MethodName: "Echo"}
+	if got, err := resolve(inv, unknown); err != nil || got != "directory" {
+		t.Errorf("unknown descriptor_id: source = %q, %v", got, err)
+	}
+	if _, err := resolve(newInvoker(WithDescriptorLayers(LayerCache, LayerRegistry)), unknown); err == nil {
+		t.Error("an unknown descriptor_id resolved without the directory layer")
+	}
+	inv = newInvoker(WithDescriptorLayers(DefaultDescriptorLayers...))
+	if _, err := resolve(inv, InvokeRequest{DescriptorID: "users@v9", ServiceName: "echo.EchoService", MethodName: "Echo"}); err == nil {
+		t.Error("a missing pinned version resolved from another layer")
+	}
+
+	// Layers left out are not consulted.
+	inv = newInvoker(WithDescriptorLayers(LayerDirectory))
+	if _, err := resolve(inv, InvokeRequest{FullMethodName: "/acme.Users/Get"}); err == nil {
+		t.Error("resolved from the cache layer without it")
+	}
+	if _, err := ParseDescriptorLayers([]string{"cache", "cache"}); err == nil {
+		t.Error("duplicate layer accepted")
+	}
+}
+
+func TestInvoker_ResolveMethod(t *testing.T) {
+	users := buildServiceSet(t, "acme/users.proto", "Users", "User")
+	inv := NewInvoker(WithDescriptorDir(t.TempDir()))
+	req := InvokeRequest{InlineDescriptorSet: users, ServiceName: "Users", MethodName: "Get"}
+	name, err := inv.ResolveMethod(context.Background(), &req)
+	if err != nil || name != "/acme.Users/Get" {
+		t.Fatalf("ResolveMethod = %q, %v; want /acme.Users/Get", name, err)
+	}
+	// The call reuses the resolution rather than resolving again.
+	req.InlineDescriptorSet = nil
+	if m, methodName, err := inv.resolve(context.Background(), &req); err != nil || methodName != name || m.Method.GetName() != "Get" {
+		t.Fatalf("resolve after ResolveMethod = %q, %v", methodName, err)
+	}
+}
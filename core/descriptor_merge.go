@@ -0,0 +1,101 @@
+package core
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// MergeDescriptorSet merges the FileDescriptorSet descriptorSetBytes into the pool cached under key (a namespaced
+// descriptor id, see NamespacedDescriptorID), creating the pool if there is none. Files already present with
+// identical content are skipped, so re-sending a set is harmless. A file with the same name but different content,
+// or a symbol defined by two different files, is a conflict: the merge fails and the cached pool is unchanged.
+func (r *InlineMethodResolver) MergeDescriptorSet(key string, descriptorSetBytes []byte) error {
+	descriptorSetBytes, err := DecompressDescriptorSet(descriptorSetBytes, "")
+	if err != nil {
+		return err
+	}
+	var incoming descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(descriptorSetBytes, &incoming); err != nil {
+		return fmt.Errorf("unmarshal FileDescriptorSet: %w", err)
+	}
+
+	// Hold the lock across build and put so concurrent merges under the same key cannot drop each other's files.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock.Now()
+	var base []*descriptorpb.FileDescriptorProto
+	if pool, ok := r.pools.get(key, now); ok {
+		base = pool.set.GetFile()
+	}
+	merged, err := mergeFileDescriptorProtos(base, incoming.GetFile())
+	if err != nil {
+		return err
+	}
+	set := &descriptorpb.FileDescriptorSet{File: merged}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("marshal merged FileDescriptorSet: %w", err)
+	}
+	pool, err := newInlineDescriptorPoolFromSet(set, descriptorSetHash(b), r.base.Load())
+	if err != nil {
+		return err
+	}
+	r.pools.put(key, pool, int64(len(b)), now)
+	return nil
+}
+
+// mergeFileDescriptorProtos appends the files of add to base, skipping identical duplicates and rejecting conflicts.
+func mergeFileDescriptorProtos(base, add []*descriptorpb.FileDescriptorProto) ([]*descriptorpb.FileDescriptorProto, error) {
+	byName := make(map[string]*descriptorpb.FileDescriptorProto, len(base))
+	symbols := make(map[string]string) // fully-qualified symbol -> defining file
+	out := make([]*descriptorpb.FileDescriptorProto, 0, len(base)+len(add))
+	for _, fd := range base {
+		byName[fd.GetName()] = fd
+		for _, sym := range topLevelSymbols(fd) {
+			symbols[sym] = fd.GetName()
+		}
+		out = append(out, fd)
+	}
+	for _, fd := range add {
+		if existing, ok := byName[fd.GetName()]; ok {
+			if proto.Equal(existing, fd) {
+				continue
+			}
+			return nil, fmt.Errorf("descriptor merge conflict: file %q already registered with different content", fd.GetName())
+		}
+		for _, sym := range topLevelSymbols(fd) {
+			if other, ok := symbols[sym]; ok {
+				return nil, fmt.Errorf("descriptor merge conflict: %q defined in both %q and %q", sym, other, fd.GetName())
+			}
+			symbols[sym] = fd.GetName()
+		}
+		byName[fd.GetName()] = fd
+		out = append(out, fd)
+	}
+	return out, nil
+}
+
+// topLevelSymbols lists the fully-qualified names of the messages, enums, services and extensions declared
+// at file scope; nested declarations cannot collide unless their parents do.
+func topLevelSymbols(fd *descriptorpb.FileDescriptorProto) []string {
+	prefix := ""
+	if fd.GetPackage() != "" {
+		prefix = fd.GetPackage() + "."
+	}
+	var out []string
+	for _, m := range fd.GetMessageType() {
+		out = append(out, prefix+m.GetName())
+	}
+	for _, e := range fd.GetEnumType() {
+		out = append(out, prefix+e.GetName())
+	}
+	for _, s := range fd.GetService() {
+		out = append(out, prefix+s.GetName())
+	}
+	for _, x := range fd.GetExtension() {
+		out = append(out, prefix+x.GetName())
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/protobuf/proto"
+)
+
+// buildServiceSet returns a FileDescriptorSet with one file declaring service svc (method Get) and its messages.
+func buildServiceSet(t *testing.T, file, svc, msgPrefix string) []byte {
+	t.Helper()
+	req := builder.NewMessage(msgPrefix + "Request")
+	resp := builder.NewMessage(msgPrefix + "Response")
+	fd, err := builder.NewFile(file).SetPackageName("acme").
+		AddMessage(req).AddMessage(resp).
+		AddService(builder.NewService(svc).AddMethod(builder.NewMethod("Get", builder.RpcTypeMessage(req, false), builder.RpcTypeMessage(resp, false)))).
+		Build()
+	if err != nil {
+		t.Fatalf("build %s: %v", file, err)
+	}
+	b, err := proto.Marshal(desc.ToFileDescriptorSet(fd))
+	if err != nil {
+		t.Fatalf("marshal %s: %v", file, err)
+	}
+	return b
+}
+
+func TestMergeDescriptorSet(t *testing.T) {
+	r := NewInlineMethodResolver()
+	users := buildServiceSet(t, "acme/users.proto", "Users", "User")
+	orders := buildServiceSet(t, "acme/orders.proto", "Orders", "Order")
+
+	for _, set := range [][]byte{users, orders, users} { // re-sending an identical set is a no-op
+		if err := r.MergeDescriptorSet("acme", set); err != nil {
+			t.Fatalf("merge: %v", err)
+		}
+	}
+	for _, svc := range []string{"acme.Users", "acme.Orders"} {
+		if _, _, err := r.Resolve(context.Background(), "", nil, "acme", svc, "Get"); err != nil {
+			t.Fatalf("resolve %s: %v", svc, err)
+		}
+	}
+
+	// Same file name, different content.
+	err := r.MergeDescriptorSet("acme", buildServiceSet(t, "acme/users.proto", "Users", "Member"))
+	if err == nil || !strings.Contains(err.Error(), "different content") {
+		t.Fatalf("expected file conflict, got %v", err)
+	}
+	// Same symbol from another file.
+	err = r.MergeDescriptorSet("acme", buildServiceSet(t, "acme/users_v2.proto", "Users", "Member"))
+	if err == nil || !strings.Contains(err.Error(), `"acme.Users" defined in both`) {
+		t.Fatalf("expected symbol conflict, got %v", err)
+	}
+	// The pool is unchanged after failed merges.
+	if _, _, err := r.Resolve(context.Background(), "", nil, "acme", "acme.Orders", "Get"); err != nil {
+		t.Fatalf("resolve after conflict: %v", err)
+	}
+}
+
+func TestSyncDescriptorChunk_Merge(t *testing.T) {
+	r := NewInlineMethodResolver()
+	if _, _, _, err := r.SyncDescriptorChunk("acme", 0, 1, buildServiceSet(t, "acme/users.proto", "Users", "User"), false, false); err != nil {
+		t.Fatalf("sync users: %v", err)
+	}
+	orders := buildServiceSet(t, "acme/orders.proto", "Orders", "Order")
+	half := len(orders) / 2
+	if _, _, done, err := r.SyncDescriptorChunk("acme", 0, 2, orders[:half], false, true); err != nil || done {
+		t.Fatalf("sync orders chunk 0: done=%v err=%v", done, err)
+	}
+	if _, _, done, err := r.SyncDescriptorChunk("acme", 1, 2, orders[half:], false, true); err != nil || !done {
+		t.Fatalf("sync orders chunk 1: done=%v err=%v", done, err)
+	}
+	for _, svc := range []string{"acme.Users", "acme.Orders"} {
+		if _, _, err := r.Resolve(context.Background(), "", nil, "acme", svc, "Get"); err != nil {
+			t.Fatalf("resolve %s: %v", svc, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/protobuf/proto"
+)
+
+// usersDescriptorSet returns the FileDescriptorSet of acme.Users with the unary method Get.
+func usersDescriptorSet(t *testing.T) []byte {
+	t.Helper()
+	req := builder.NewMessage("GetRequest")
+	svc := builder.NewService("Users").AddMethod(builder.NewMethod("Get", builder.RpcTypeMessage(req, false), builder.RpcTypeMessage(req, false)))
+	fd, err := builder.NewFile("acme/users.proto").SetPackageName("acme").AddMessage(req).AddService(svc).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	set, err := proto.Marshal(desc.ToFileDescriptorSet(fd))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return set
+}
+
+func TestMethodResolverFS(t *testing.T) {
+	r := NewMethodResolverFS(fstest.MapFS{"acme.Users.pb": {Data: usersDescriptorSet(t)}})
+	if md, err := r.Resolve("/acme.Users/Get"); err != nil || md.GetFullyQualifiedName() != "acme.Users.Get" {
+		t.Fatalf("resolve from FS: %v %v", md, err)
+	}
+	if _, err := r.Resolve("/echo.EchoService/Echo"); err != nil {
+		t.Fatalf("embedded method: %v", err)
+	}
+	if _, err := r.Resolve("/acme.Orders/Get"); err == nil || !strings.Contains(err.Error(), "acme.Orders.pb") {
+		t.Fatalf("missing file: %v", err)
+	}
+	if files := r.Files(); len(files) != 2 {
+		t.Fatalf("files = %d, want the embedded and the FS set", len(files))
+	}
+}
+
+func TestMethodResolver_FilesCachedUntilFlush(t *testing.T) {
+	fsys := fstest.MapFS{"acme.Users.pb": {Data: usersDescriptorSet(t)}}
+	r := NewMethodResolverFS(fsys)
+	first := r.Files()
+	if len(first) != 2 {
+		t.Fatalf("files = %d, want 2", len(first))
+	}
+	delete(fsys, "acme.Users.pb")
+	if files := r.Files(); len(files) != 2 || files[1] != first[1] {
+		t.Fatalf("files = %v, want the set parsed by the first call", files)
+	}
+	r.Flush()
+	if files := r.Files(); len(files) != 1 {
+		t.Fatalf("files after Flush = %d, want only the embedded set", len(files))
+	}
+}
@@ -0,0 +1,301 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// DescriptorProblem is one defect of a FileDescriptorSet found by ValidateDescriptorSet.
+type DescriptorProblem struct {
+	File string `json:"file"`
+	// Element is the message, field, service or method at fault, if the problem is not about the whole file.
+	Element string `json:"element,omitempty"`
+	Problem string `json:"problem"`
+}
+
+func (p DescriptorProblem) String() string {
+	if p.Element == "" {
+		return p.File + ": " + p.Problem
+	}
+	return p.File + ": " + p.Element + ": " + p.Problem
+}
+
+// DescriptorSetError is returned for uploaded descriptor sets that cannot be built, listing every problem
+// rather than the first one the descriptor library trips over.
+type DescriptorSetError struct {
+	Problems []DescriptorProblem
+}
+
+// maxDescriptorProblemsInError bounds the problems spelled out by Error; all of them are in Problems.
+const maxDescriptorProblemsInError = 5
+
+func (e *DescriptorSetError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid descriptor set: ")
+	for i, p := range e.Problems {
+		if i == maxDescriptorProblemsInError {
+			fmt.Fprintf(&b, " (and %d more)", len(e.Problems)-i)
+			break
+		}
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
+
+type descriptorSymbolKind int
+
+const (
+	symbolMessage descriptorSymbolKind = iota
+	symbolEnum
+	symbolOther // services, methods, extensions, enum values
+)
+
+type descriptorSymbol struct {
+	file string
+	kind descriptorSymbolKind
+}
+
+// ValidateDescriptorSet checks that fds is self-contained and consistent: file names are unique, every import
+// is in the set and there are no import cycles, no symbol is defined twice, and every type referenced by a
+// field, extension or method is defined in the file or in one it imports. It returns a *DescriptorSetError
+// listing all problems found, or nil.
+func ValidateDescriptorSet(fds *descriptorpb.FileDescriptorSet) error {
+	v := &descriptorValidator{
+		files:   make(map[string]*descriptorpb.FileDescriptorProto, len(fds.GetFile())),
+		symbols: make(map[string]descriptorSymbol),
+	}
+	for _, fd := range fds.GetFile() {
+		name := fd.GetName()
+		if name == "" {
+			v.report("", "", "file has no name")
+			continue
+		}
+		if _, ok := v.files[name]; ok {
+			v.report(name, "", "file appears more than once in the set")
+			continue
+		}
+		v.files[name] = fd
+	}
+	names := make([]string, 0, len(v.files))
+	for name := range v.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v.checkImports(v.files[name])
+	}
+	for _, name := range names {
+		v.collect(v.files[name])
+	}
+	for _, name := range names {
+		v.checkReferences(v.files[name])
+	}
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &DescriptorSetError{Problems: v.problems}
+}
+
+type descriptorValidator struct {
+	files    map[string]*descriptorpb.FileDescriptorProto
+	symbols  map[string]descriptorSymbol // fully-qualified name without the leading dot
+	problems []DescriptorProblem
+}
+
+func (v *descriptorValidator) report(file, element, format string, args ...any) {
+	v.problems = append(v.problems, DescriptorProblem{File: file, Element: element, Problem: fmt.Sprintf(format, args...)})
+}
+
+func (v *descriptorValidator) checkImports(fd *descriptorpb.FileDescriptorProto) {
+	for _, dep := range fd.GetDependency() {
+		if _, ok := v.files[dep]; !ok {
+			v.report(fd.GetName(), "", "imports %q, which is not in the set (build it with --include_imports)", dep)
+		}
+	}
+	if cycle := v.importCycle(fd.GetName(), fd.GetName(), map[string]bool{}); cycle != nil {
+		v.report(fd.GetName(), "", "import cycle: %s", strings.Join(append([]string{fd.GetName()}, cycle...), " -> "))
+	}
+}
+
+// importCycle returns the import path from file back to start, if there is one.
+func (v *descriptorValidator) importCycle(start, file string, seen map[string]bool) []string {
+	seen[file] = true
+	for _, dep := range v.files[file].GetDependency() {
+		if dep == start {
+			return []string{dep}
+		}
+		if _, ok := v.files[dep]; !ok || seen[dep] {
+			continue
+		}
+		if path := v.importCycle(start, dep, seen); path != nil {
+			return append([]string{dep}, path...)
+		}
+	}
+	return nil
+}
+
+func (v *descriptorValidator) define(file, name string, kind descriptorSymbolKind) {
+	if other, ok := v.symbols[name]; ok {
+		if other.file == file {
+			v.report(file, name, "defined more than once")
+		} else {
+			v.report(file, name, "also defined in %q", other.file)
+		}
+		return
+	}
+	v.symbols[name] = descriptorSymbol{file: file, kind: kind}
+}
+
+// collect records the symbols defined by fd.
+func (v *descriptorValidator) collect(fd *descriptorpb.FileDescriptorProto) {
+	file, pkg := fd.GetName(), fd.GetPackage()
+	var message func(scope string, m *descriptorpb.DescriptorProto)
+	enum := func(scope string, e *descriptorpb.EnumDescriptorProto) {
+		v.define(file, qualify(scope, e.GetName()), symbolEnum)
+		for _, val := range e.GetValue() {
+			// Enum values are siblings of their enum.
+			v.define(file, qualify(scope, val.GetName()), symbolOther)
+		}
+	}
+	message = func(scope string, m *descriptorpb.DescriptorProto) {
+		name := qualify(scope, m.GetName())
+		v.define(file, name, symbolMessage)
+		for _, n := range m.GetNestedType() {
+			message(name, n)
+		}
+		for _, e := range m.GetEnumType() {
+			enum(name, e)
+		}
+		for _, x := range m.GetExtension() {
+			v.define(file, qualify(name, x.GetName()), symbolOther)
+		}
+	}
+	for _, m := range fd.GetMessageType() {
+		message(pkg, m)
+	}
+	for _, e := range fd.GetEnumType() {
+		enum(pkg, e)
+	}
+	for _, x := range fd.GetExtension() {
+		v.define(file, qualify(pkg, x.GetName()), symbolOther)
+	}
+	for _, s := range fd.GetService() {
+		name := qualify(pkg, s.GetName())
+		v.define(file, name, symbolOther)
+		for _, m := range s.GetMethod() {
+			v.define(file, qualify(name, m.GetName()), symbolOther)
+		}
+	}
+}
+
+// checkReferences checks the types referenced by the fields, extensions and methods of fd.
+func (v *descriptorValidator) checkReferences(fd *descriptorpb.FileDescriptorProto) {
+	file, pkg := fd.GetName(), fd.GetPackage()
+	visible := v.visibleFiles(fd)
+	ref := func(scope, element, typeName string, allowEnum bool) {
+		if typeName == "" {
+			return
+		}
+		name, sym, ok := v.lookup(scope, typeName)
+		switch {
+		case !ok:
+			v.report(file, element, "type %q is not defined in the set", typeName)
+		case sym.kind == symbolOther || sym.kind == symbolEnum && !allowEnum:
+			v.report(file, element, "%q is not a message type", name)
+		case !visible[sym.file]:
+			v.report(file, element, "type %q is defined in %q, which %q does not import", name, sym.file, file)
+		}
+	}
+	field := func(scope string, f *descriptorpb.FieldDescriptorProto) {
+		element := qualify(scope, f.GetName())
+		ref(scope, element, f.GetTypeName(), true)
+		ref(scope, element, f.GetExtendee(), false)
+	}
+	var message func(scope string, m *descriptorpb.DescriptorProto)
+	message = func(scope string, m *descriptorpb.DescriptorProto) {
+		name := qualify(scope, m.GetName())
+		for _, f := range m.GetField() {
+			field(name, f)
+		}
+		for _, x := range m.GetExtension() {
+			field(name, x)
+		}
+		for _, n := range m.GetNestedType() {
+			message(name, n)
+		}
+	}
+	for _, m := range fd.GetMessageType() {
+		message(pkg, m)
+	}
+	for _, x := range fd.GetExtension() {
+		field(pkg, x)
+	}
+	for _, s := range fd.GetService() {
+		name := qualify(pkg, s.GetName())
+		for _, m := range s.GetMethod() {
+			element := qualify(name, m.GetName())
+			ref(pkg, element, m.GetInputType(), false)
+			ref(pkg, element, m.GetOutputType(), false)
+		}
+	}
+}
+
+// visibleFiles returns the files whose symbols fd may use: itself, its imports and, transitively, the
+// public imports of those.
+func (v *descriptorValidator) visibleFiles(fd *descriptorpb.FileDescriptorProto) map[string]bool {
+	visible := map[string]bool{fd.GetName(): true}
+	var addPublic func(name string)
+	addPublic = func(name string) {
+		dep := v.files[name]
+		for _, i := range dep.GetPublicDependency() {
+			if int(i) < len(dep.GetDependency()) && !visible[dep.GetDependency()[i]] {
+				visible[dep.GetDependency()[i]] = true
+				addPublic(dep.GetDependency()[i])
+			}
+		}
+	}
+	for _, dep := range fd.GetDependency() {
+		if !visible[dep] {
+			visible[dep] = true
+			addPublic(dep)
+		}
+	}
+	return visible
+}
+
+// lookup resolves typeName as protoc does: fully-qualified names start with "."; others are searched for
+// in scope and its enclosing scopes.
+func (v *descriptorValidator) lookup(scope, typeName string) (string, descriptorSymbol, bool) {
+	if strings.HasPrefix(typeName, ".") {
+		name := typeName[1:]
+		sym, ok := v.symbols[name]
+		return name, sym, ok
+	}
+	for {
+		name := qualify(scope, typeName)
+		if sym, ok := v.symbols[name]; ok {
+			return name, sym, true
+		}
+		if scope == "" {
+			return "", descriptorSymbol{}, false
+		}
+		if i := strings.LastIndexByte(scope, '.'); i >= 0 {
+			scope = scope[:i]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestValidateDescriptorSet(t *testing.T) {
+	file := func(name string, deps []string, messages ...*descriptorpb.DescriptorProto) *descriptorpb.FileDescriptorProto {
+		return &descriptorpb.FileDescriptorProto{Name: proto.String(name), Package: proto.String("acme"), Dependency: deps, MessageType: messages}
+	}
+	message := func(name string, fieldTypes ...string) *descriptorpb.DescriptorProto {
+		m := &descriptorpb.DescriptorProto{Name: proto.String(name)}
+		for i, typ := range fieldTypes {
+			m.Field = append(m.Field, &descriptorpb.FieldDescriptorProto{
+				Name:     proto.String(fmt.Sprintf("ref%d", i+1)),
+				Number:   proto.Int32(int32(i + 1)),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				TypeName: proto.String(typ),
+			})
+		}
+		return m
+	}
+	service := &descriptorpb.ServiceDescriptorProto{Name: proto.String("Users"), Method: []*descriptorpb.MethodDescriptorProto{{
+		Name: proto.String("Get"), InputType: proto.String(".acme.GetRequest"), OutputType: proto.String(".acme.User"),
+	}}}
+	api := file("acme/api.proto", []string{"acme/user.proto"}, message("GetRequest"))
+	api.Service = []*descriptorpb.ServiceDescriptorProto{service}
+
+	cases := []struct {
+		name  string
+		files []*descriptorpb.FileDescriptorProto
+		want  []string // one substring per expected problem, in order
+	}{
+		{"valid", []*descriptorpb.FileDescriptorProto{api, file("acme/user.proto", nil, message("User", "Address"), message("Address"))}, nil},
+		{"missing import", []*descriptorpb.FileDescriptorProto{api}, []string{
+			`acme/api.proto: imports "acme/user.proto", which is not in the set`,
+			`acme/api.proto: acme.Users.Get: type ".acme.User" is not defined in the set`,
+		}},
+		{"duplicate file", []*descriptorpb.FileDescriptorProto{file("a.proto", nil), file("a.proto", nil)}, []string{
+			"a.proto: file appears more than once",
+		}},
+		{"duplicate symbol", []*descriptorpb.FileDescriptorProto{file("a.proto", nil, message("User")), file("b.proto", nil, message("User"))}, []string{
+			`b.proto: acme.User: also defined in "a.proto"`,
+		}},
+		{"not imported", []*descriptorpb.FileDescriptorProto{file("a.proto", nil, message("Order", ".acme.User")), file("b.proto", nil, message("User"))}, []string{
+			`a.proto: acme.Order.ref1: type "acme.User" is defined in "b.proto", which "a.proto" does not import`,
+		}},
+		{"import cycle", []*descriptorpb.FileDescriptorProto{file("a.proto", []string{"b.proto"}), file("b.proto", []string{"a.proto"})}, []string{
+			"a.proto: import cycle: a.proto -> b.proto -> a.proto",
+			"b.proto: import cycle: b.proto -> a.proto -> b.proto",
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateDescriptorSet(&descriptorpb.FileDescriptorSet{File: c.files})
+			if c.want == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var invalid *DescriptorSetError
+			if !errors.As(err, &invalid) || len(invalid.Problems) != len(c.want) {
+				t.Fatalf("err = %v", err)
+			}
+			for i, want := range c.want {
+				if got := invalid.Problems[i].String(); !strings.Contains(got, want) {
+					t.Errorf("problem %d = %q, want %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInlineMethodResolver_InvalidSet(t *testing.T) {
+	set, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name: proto.String("acme/api.proto"), Package: proto.String("acme"), Dependency: []string{"acme/common.proto"},
+	}}})
+	_, _, _, err := NewInlineMethodResolver().SyncDescriptorChunk("acme", 0, 1, set, false, false)
+	var invalid *DescriptorSetError
+	if !errors.As(err, &invalid) || invalid.Problems[0].File != "acme/api.proto" {
+		t.Fatalf("err = %v", err)
+	}
+}
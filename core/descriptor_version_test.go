@@ -0,0 +1,104 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDescriptorVersions_PinAndRollback(t *testing.T) {
+	r := NewInlineMethodResolver()
+	ctx := context.Background()
+	v1 := buildServiceSet(t, "acme/users.proto", "Users", "User")
+	v2 := buildServiceSet(t, "acme/users.proto", "Users", "Member")
+
+	for _, set := range [][]byte{v1, v1, v2} { // identical re-upload does not create a version
+		if _, _, err := r.Resolve(ctx, "", set, "users", "acme.Users", "Get"); err != nil {
+			t.Fatalf("resolve with upload: %v", err)
+		}
+	}
+	versions, ok := r.DescriptorVersions("users")
+	if !ok || len(versions) != 2 || versions[0].Version != 1 || versions[1].Version != 2 || !versions[1].Current {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	if versions[0].Hash != descriptorSetHash(v1) {
+		t.Fatalf("version 1 hash = %s", versions[0].Hash)
+	}
+
+	input := func(id string) string {
+		rm, _, err := r.Resolve(ctx, "", nil, id, "acme.Users", "Get")
+		if err != nil {
+			t.Fatalf("resolve %s: %v", id, err)
+		}
+		return rm.Method.GetInputType().GetName()
+	}
+	if got := input("users"); got != "MemberRequest" {
+		t.Fatalf("current input = %s", got)
+	}
+	if got := input("users@v1"); got != "UserRequest" {
+		t.Fatalf("pinned v1 input = %s", got)
+	}
+	if _, _, err := r.Resolve(ctx, "", nil, "users@v9", "acme.Users", "Get"); err == nil {
+		t.Fatalf("expected unknown version error")
+	}
+	if _, _, err := r.Resolve(ctx, "", v1, "users@v1", "acme.Users", "Get"); err == nil {
+		t.Fatalf("expected upload to pinned version to fail")
+	}
+
+	if err := r.RollbackDescriptor("users", 1); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if got := input("users"); got != "UserRequest" {
+		t.Fatalf("input after rollback = %s", got)
+	}
+	// The next upload continues numbering after the newest version.
+	v3 := buildServiceSet(t, "acme/users.proto", "Users", "Account")
+	if _, _, err := r.Resolve(ctx, "", v3, "users", "acme.Users", "Get"); err != nil {
+		t.Fatalf("upload v3: %v", err)
+	}
+	versions, _ = r.DescriptorVersions("users")
+	if last := versions[len(versions)-1]; last.Version != 3 || !last.Current {
+		t.Fatalf("unexpected versions after upload: %+v", versions)
+	}
+}
+
+func TestParseDescriptorVersion(t *testing.T) {
+	cases := []struct {
+		id      string
+		base    string
+		version int
+		pinned  bool
+	}{
+		{"echo@v3", "echo", 3, true},
+		{"echo", "echo", 0, false},
+		{"buf.build/acme/payments:v1.2.0", "buf.build/acme/payments:v1.2.0", 0, false},
+		{"echo@vx", "echo@vx", 0, false},
+		{"@v1", "@v1", 0, false},
+	}
+	for _, c := range cases {
+		base, version, pinned := ParseDescriptorVersion(c.id)
+		if base != c.base || version != c.version || pinned != c.pinned {
+			t.Errorf("ParseDescriptorVersion(%q) = %q, %d, %v", c.id, base, version, pinned)
+		}
+	}
+}
+
+func TestSyncDescriptorChunk_ResetOnEveryChunk(t *testing.T) {
+	r := NewInlineMethodResolver()
+	set := buildServiceSet(t, "acme/users.proto", "Users", "User")
+	third := len(set)/3 + 1
+	chunks := [][]byte{set[:third], set[third : 2*third], set[2*third:]}
+	for round := 0; round < 2; round++ {
+		for i, chunk := range chunks {
+			received, _, done, err := r.SyncDescriptorChunk("users", i, len(chunks), chunk, true, false)
+			if err != nil || received != i+1 || done != (i == len(chunks)-1) {
+				t.Fatalf("round %d chunk %d: received=%d done=%v err=%v", round, i, received, done, err)
+			}
+		}
+	}
+	if _, _, err := r.Resolve(context.Background(), "", nil, "users", "acme.Users", "Get"); err != nil {
+		t.Fatalf("resolve after reset uploads: %v", err)
+	}
+	if _, _, _, err := r.SyncDescriptorChunk("users@v1", 0, 1, set, true, false); err == nil {
+		t.Fatalf("chunk sync to a pinned version succeeded")
+	}
+}
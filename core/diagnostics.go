@@ -0,0 +1,43 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// Diagnostics describes how one invocation was carried out, for troubleshooting from the client side.
+type Diagnostics struct {
+	Method string `json:"method,omitempty"` // resolved full method name
+	Target string `json:"target,omitempty"`
+	Peer   string `json:"peer,omitempty"` // address of the upstream that served the last attempt
+	// DescriptorSource is where the method descriptor came from: "directory", "local", "inline", "cache" or
+	// "fetched".
+	DescriptorSource string `json:"descriptor_source,omitempty"`
+	// ResolveDuration is the time spent finding the method descriptor, DecodeDuration the time spent turning
+	// the body into request messages, MarshalDuration the time spent turning the response into JSON.
+	ResolveDuration time.Duration `json:"resolve_ns"`
+	DecodeDuration  time.Duration `json:"decode_ns"`
+	MarshalDuration time.Duration `json:"marshal_ns"`
+	// DialDuration is the time spent obtaining upstream connections; InvokeDuration the time spent in calls.
+	DialDuration   time.Duration `json:"dial_ns"`
+	InvokeDuration time.Duration `json:"invoke_ns"`
+	Attempts       int           `json:"attempts"`
+	Hedged         bool          `json:"hedged,omitempty"`    // a hedged duplicate call was sent
+	Coalesced      bool          `json:"coalesced,omitempty"` // the response of an identical call in flight was shared
+	Pages          int           `json:"pages,omitempty"`     // pages fetched for InvokeRequest.FetchAllPages
+}
+
+type diagnosticsKey struct{}
+
+func withDiagnostics(ctx context.Context, d *Diagnostics) context.Context {
+	if d == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, diagnosticsKey{}, d)
+}
+
+// diagnosticsFromContext returns the Diagnostics being collected under ctx, or nil.
+func diagnosticsFromContext(ctx context.Context) *Diagnostics {
+	d, _ := ctx.Value(diagnosticsKey{}).(*Diagnostics)
+	return d
+}
@@ -0,0 +1,20 @@
+// Package core is the invocation engine of the gateway, usable on its own for dynamic gRPC calls from Go
+// services that have descriptors but no generated stubs:
+//
+//	inv := core.NewInvoker(
+//		core.WithDescriptorFS(descriptors),          // or WithDescriptorDir, WithDescriptorFetcher
+//		core.WithTLS(&tls.Config{}),                 // or WithDialer, WithDialOptions
+//		core.WithUnaryInterceptors(otelInterceptor), // tracing, auth, ...
+//		core.WithCallTimeout(10*time.Second),
+//	)
+//	defer inv.Close()
+//	resp, err := inv.Invoke(ctx, &core.InvokeRequest{
+//		Target:         "users.internal:443",
+//		FullMethodName: "/users.v1.Users/GetUser",
+//		Body:           []byte(`{"id":"42"}`),
+//	})
+//
+// Per-target channel settings are set with WithTargetConfigs and per-method policies with WithMethodTimeouts,
+// WithHedging, WithShadows and WithCoalescing. The Invoker, its options and InvokeRequest are a supported
+// API, not an implementation detail of the HTTP gateway.
+package core
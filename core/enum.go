@@ -0,0 +1,103 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// lenientEnums rewrites the enum values of body, a JSON message of type md, that name a value
+// case-insensitively or without the enum's conventional prefix ("active" for USER_STATUS_ACTIVE of enum
+// UserStatus) to the value's name. Values that match nothing are left for the decoder to report.
+func lenientEnums(md *desc.MessageDescriptor, body []byte) ([]byte, error) {
+	return rewriteJSON(body, func(v any) any { return walkEnums(md, v) })
+}
+
+// walkEnums rewrites the enum values within v, a JSON value of message md.
+func walkEnums(md *desc.MessageDescriptor, v any) any {
+	obj, ok := v.(map[string]any)
+	if !ok || isCoercedWKT(md.GetFullyQualifiedName()) {
+		return v
+	}
+	for key, fv := range obj {
+		fd := md.FindFieldByJSONName(key)
+		if fd == nil {
+			fd = md.FindFieldByName(key)
+		}
+		if fd == nil {
+			continue
+		}
+		elem := fd
+		if fd.IsMap() {
+			elem = fd.GetMapValueType()
+		}
+		one := func(v any) any {
+			if et := elem.GetEnumType(); et != nil {
+				return matchEnum(et, v)
+			}
+			if mt := elem.GetMessageType(); mt != nil {
+				return walkEnums(mt, v)
+			}
+			return v
+		}
+		switch fv := fv.(type) {
+		case map[string]any:
+			if fd.IsMap() {
+				for k, e := range fv {
+					fv[k] = one(e)
+				}
+			} else {
+				obj[key] = one(fv)
+			}
+		case []any:
+			if fd.IsRepeated() {
+				for i, e := range fv {
+					fv[i] = one(e)
+				}
+			}
+		default:
+			obj[key] = one(fv)
+		}
+	}
+	return obj
+}
+
+// matchEnum returns the name of the value of et that v names leniently, or v.
+func matchEnum(et *desc.EnumDescriptor, v any) any {
+	s, ok := v.(string)
+	if !ok || et.FindValueByName(s) != nil {
+		return v
+	}
+	want := strings.ToUpper(strings.TrimSpace(s))
+	prefix := enumPrefix(et.GetName())
+	var short *desc.EnumValueDescriptor
+	for _, ev := range et.GetValues() {
+		name := ev.GetName()
+		if strings.ToUpper(name) == want {
+			return name
+		}
+		if short == nil && strings.HasPrefix(name, prefix) && strings.TrimPrefix(name, prefix) == want {
+			short = ev
+		}
+	}
+	if short != nil {
+		return short.GetName()
+	}
+	return v
+}
+
+// enumPrefix returns the conventional value prefix of an enum: USER_STATUS_ for UserStatus, HTTP_METHOD_
+// for HTTPMethod.
+func enumPrefix(enumName string) string {
+	runes := []rune(enumName)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	b.WriteByte('_')
+	return b.String()
+}
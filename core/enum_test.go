@@ -0,0 +1,40 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/builder"
+)
+
+func TestLenientEnums(t *testing.T) {
+	status := builder.NewEnum("UserStatus").
+		AddValue(builder.NewEnumValue("USER_STATUS_UNSPECIFIED")).
+		AddValue(builder.NewEnumValue("USER_STATUS_ACTIVE")).
+		AddValue(builder.NewEnumValue("USER_STATUS_SUSPENDED"))
+	method := builder.NewEnum("HTTPMethod").
+		AddValue(builder.NewEnumValue("HTTP_METHOD_UNSPECIFIED")).
+		AddValue(builder.NewEnumValue("HTTP_METHOD_GET"))
+	filter := builder.NewMessage("Filter").
+		AddField(builder.NewField("statuses", builder.FieldTypeEnum(status)).SetRepeated())
+	req := builder.NewMessage("ListUsersRequest").
+		AddField(builder.NewField("status", builder.FieldTypeEnum(status))).
+		AddField(builder.NewField("method", builder.FieldTypeEnum(method))).
+		AddField(builder.NewField("filter", builder.FieldTypeMessage(filter))).
+		AddField(builder.NewMapField("by_team", builder.FieldTypeString(), builder.FieldTypeEnum(status))).
+		AddField(builder.NewField("name", builder.FieldTypeString()))
+	fd, err := builder.NewFile("acme/users.proto").SetPackageName("acme").
+		AddEnum(status).AddEnum(method).AddMessage(filter).AddMessage(req).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	body := `{"status":"active","method":"Get","filter":{"statuses":["user_status_suspended","ACTIVE",1]},"byTeam":{"ops":"Suspended"},"name":"active"}`
+	got, err := lenientEnums(fd.FindMessage("acme.ListUsersRequest"), []byte(body))
+	if err != nil {
+		t.Fatalf("lenientEnums: %v", err)
+	}
+	want := `{"byTeam":{"ops":"USER_STATUS_SUSPENDED"},"filter":{"statuses":["USER_STATUS_SUSPENDED","USER_STATUS_ACTIVE",1]},"method":"HTTP_METHOD_GET","name":"active","status":"USER_STATUS_ACTIVE"}`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,239 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Transport is the wire protocol spoken to an upstream target.
+type Transport string
+
+const (
+	// TransportGRPC is native gRPC over HTTP/2 (default).
+	TransportGRPC Transport = ""
+	// TransportGRPCWeb is gRPC-Web over HTTP/1.1, for backends only reachable through proxies, CDNs or load
+	// balancers that do not forward HTTP/2 end to end. Only unary calls are supported.
+	TransportGRPCWeb Transport = "grpc-web"
+)
+
+const grpcWebContentType = "application/grpc-web+proto"
+
+// grpcWebChannel is a grpc.ClientConnInterface that sends unary calls as gRPC-Web requests to baseURL.
+type grpcWebChannel struct {
+	client  *http.Client
+	baseURL string
+	cfg     TargetConfig
+}
+
+// newGRPCWebChannel returns a channel for target, which is either "host:port" (plain HTTP) or an
+// http(s) URL whose path prefixes the method paths.
+func newGRPCWebChannel(target string, cfg TargetConfig, client *http.Client) *grpcWebChannel {
+	base := target
+	if !strings.HasPrefix(base, "http://") && !strings.HasPrefix(base, "https://") {
+		base = "http://" + base
+	}
+	return &grpcWebChannel{client: client, baseURL: strings.TrimSuffix(base, "/"), cfg: cfg}
+}
+
+func (c *grpcWebChannel) Invoke(ctx context.Context, method string, args, reply any, _ ...grpc.CallOption) error {
+	in, ok := args.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "grpc-web: unsupported request type %T", args)
+	}
+	out, ok := reply.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "grpc-web: unsupported response type %T", reply)
+	}
+	payload, err := proto.Marshal(in)
+	if err != nil {
+		return status.Errorf(codes.Internal, "grpc-web: marshal request: %v", err)
+	}
+	if c.cfg.MaxSendMsgSize > 0 && len(payload) > c.cfg.MaxSendMsgSize {
+		return status.Errorf(codes.ResourceExhausted, "grpc-web: trying to send message larger than max (%d vs. %d)", len(payload), c.cfg.MaxSendMsgSize)
+	}
+
+	body := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(payload)))
+	copy(body[5:], payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+method, bytes.NewReader(body))
+	if err != nil {
+		return status.Errorf(codes.Internal, "grpc-web: %v", err)
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	for k, vs := range md {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if creds := c.cfg.perRPCCredentials(); creds != nil {
+		if creds.RequireTransportSecurity() && req.URL.Scheme != "https" {
+			return status.Error(codes.Unauthenticated, "grpc-web: cannot send secure credentials on an insecure connection")
+		}
+		h, err := creds.GetRequestMetadata(ctx, c.baseURL+path.Dir(method))
+		if err != nil {
+			if _, ok := status.FromError(err); ok {
+				return err
+			}
+			return status.Errorf(codes.Unauthenticated, "grpc-web: %v", err)
+		}
+		for k, v := range h {
+			req.Header.Set(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", grpcWebContentType)
+	req.Header.Set("Accept", grpcWebContentType)
+	req.Header.Set("X-Grpc-Web", "1")
+	if c.cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", c.cfg.UserAgent)
+	}
+	if c.cfg.Authority != "" {
+		req.Host = c.cfg.Authority
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", encodeGRPCTimeout(time.Until(deadline)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return status.FromContextError(ctxErr).Err()
+		}
+		return status.Errorf(codes.Unavailable, "grpc-web: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// A trailers-only response carries the status in the HTTP headers.
+	if resp.Header.Get("Grpc-Status") != "" {
+		return grpcWebStatus(resp.Header)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return status.Errorf(httpStatusCode(resp.StatusCode), "grpc-web: unexpected HTTP status %s", resp.Status)
+	}
+
+	var msg []byte
+	var gotMsg bool
+	r := bufio.NewReader(resp.Body)
+	for {
+		var hdr [5]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return status.FromContextError(ctxErr).Err()
+			}
+			return status.Errorf(codes.Internal, "grpc-web: response ended without trailers: %v", err)
+		}
+		n := binary.BigEndian.Uint32(hdr[1:])
+		if c.cfg.MaxRecvMsgSize > 0 && int64(n) > int64(c.cfg.MaxRecvMsgSize) {
+			return status.Errorf(codes.ResourceExhausted, "grpc-web: received message larger than max (%d vs. %d)", n, c.cfg.MaxRecvMsgSize)
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return status.Errorf(codes.Internal, "grpc-web: read frame: %v", err)
+		}
+		if hdr[0]&0x80 != 0 {
+			trailers, err := textproto.NewReader(bufio.NewReader(io.MultiReader(bytes.NewReader(frame), strings.NewReader("\r\n")))).ReadMIMEHeader()
+			if err != nil && err != io.EOF {
+				return status.Errorf(codes.Internal, "grpc-web: parse trailers: %v", err)
+			}
+			if err := grpcWebStatus(http.Header(trailers)); err != nil {
+				return err
+			}
+			if !gotMsg {
+				return status.Error(codes.Internal, "grpc-web: no response message")
+			}
+			if err := proto.Unmarshal(msg, out); err != nil {
+				return status.Errorf(codes.Internal, "grpc-web: unmarshal response: %v", err)
+			}
+			return nil
+		}
+		if hdr[0]&0x01 != 0 {
+			return status.Error(codes.Internal, "grpc-web: compressed response messages are not supported")
+		}
+		msg, gotMsg = frame, true
+	}
+}
+
+func (c *grpcWebChannel) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "grpc-web: streaming calls are not supported")
+}
+
+// grpcWebStatus converts the grpc-status, grpc-message and grpc-status-details-bin fields of h to an error
+// (nil for OK).
+func grpcWebStatus(h http.Header) error {
+	raw := h.Get("Grpc-Status")
+	if raw == "" {
+		return status.Error(codes.Internal, "grpc-web: missing grpc-status")
+	}
+	code, err := strconv.Atoi(raw)
+	if err != nil {
+		return status.Errorf(codes.Internal, "grpc-web: invalid grpc-status %q", raw)
+	}
+	if codes.Code(code) == codes.OK {
+		return nil
+	}
+	if bin := h.Get("Grpc-Status-Details-Bin"); bin != "" {
+		if b, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(bin, "=")); err == nil {
+			var st spb.Status
+			if proto.Unmarshal(b, &st) == nil {
+				return status.FromProto(&st).Err()
+			}
+		}
+	}
+	msg := h.Get("Grpc-Message")
+	if m, err := url.PathUnescape(msg); err == nil {
+		msg = m
+	}
+	return status.Error(codes.Code(code), msg)
+}
+
+// httpStatusCode maps an HTTP status without a gRPC status to a gRPC code, as gRPC clients do.
+func httpStatusCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	}
+	return codes.Unknown
+}
+
+// encodeGRPCTimeout renders d in the grpc-timeout wire format (at most 8 digits and a unit).
+func encodeGRPCTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "1n"
+	}
+	units := []struct {
+		unit string
+		d    time.Duration
+	}{{"n", time.Nanosecond}, {"u", time.Microsecond}, {"m", time.Millisecond}, {"S", time.Second}, {"M", time.Minute}, {"H", time.Hour}}
+	for _, u := range units {
+		if v := (d + u.d - 1) / u.d; v < 1e8 {
+			return fmt.Sprintf("%d%s", v, u.unit)
+		}
+	}
+	return "99999999H"
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// HealthCheckConfig configures the grpc.health.v1 probing of pooled connections, see WithHealthChecks.
+type HealthCheckConfig struct {
+	// Interval is the time between probes of each pooled connection; default 10s.
+	Interval time.Duration
+	// Timeout bounds each probe; default 2s.
+	Timeout time.Duration
+	// Service is the service name sent in the probe; empty asks for the overall health of the server.
+	Service string
+	// UnhealthyThreshold is the number of consecutive failed probes after which the connection is evicted,
+	// so the next call dials a fresh one; default 2.
+	UnhealthyThreshold int
+}
+
+// Target health statuses reported in TargetHealth.
+const (
+	HealthServing     = "serving"
+	HealthNotServing  = "not_serving"
+	HealthUnknown     = "unknown" // the upstream does not implement grpc.health.v1; counted as healthy
+	HealthUnreachable = "unreachable"
+)
+
+// TargetHealth is the result of the latest probes of a target's pooled connection.
+type TargetHealth struct {
+	Status              string    `json:"status"`
+	CheckedAt           time.Time `json:"checked_at"`
+	ConsecutiveFailures int       `json:"consecutive_failures,omitempty"`
+	Evictions           int64     `json:"evictions,omitempty"` // connections evicted as unhealthy
+	Error               string    `json:"error,omitempty"`
+}
+
+// WithHealthChecks probes every pooled gRPC connection with grpc.health.v1 Check on the invoker's clock and
+// evicts connections that keep failing, so stale connections are replaced before calls fail on them.
+// gRPC-Web targets are not probed. Results are reported by TargetHealth.
+func WithHealthChecks(cfg HealthCheckConfig) InvokerOption {
+	return func(inv *Invoker) {
+		if cfg.Interval <= 0 {
+			cfg.Interval = 10 * time.Second
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = 2 * time.Second
+		}
+		if cfg.UnhealthyThreshold <= 0 {
+			cfg.UnhealthyThreshold = 2
+		}
+		inv.health = &healthChecker{cfg: cfg, inv: inv, targets: make(map[string]*TargetHealth)}
+	}
+}
+
+// TargetHealth returns the probe results by target, or nil without WithHealthChecks.
+func (inv *Invoker) TargetHealth() map[string]TargetHealth {
+	if inv.health == nil {
+		return nil
+	}
+	return inv.health.snapshot()
+}
+
+type healthChecker struct {
+	cfg HealthCheckConfig
+	inv *Invoker
+
+	mu      sync.Mutex
+	targets map[string]*TargetHealth
+	stop    func() bool
+	closed  bool
+}
+
+// schedule arms the next round of probes.
+func (hc *healthChecker) schedule() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if !hc.closed {
+		hc.stop = hc.inv.clock.AfterFunc(hc.cfg.Interval, hc.run)
+	}
+}
+
+func (hc *healthChecker) run() {
+	var wg sync.WaitGroup
+	for target, conn := range hc.inv.conns.snapshot() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hc.check(target, conn)
+		}()
+	}
+	wg.Wait()
+	hc.schedule()
+}
+
+// check probes conn, the pooled connection for target, and evicts it once it reaches the threshold.
+func (hc *healthChecker) check(target string, conn *grpc.ClientConn) {
+	clock := hc.inv.clock
+	ctx, cancel := WithTimeout(context.Background(), clock, hc.cfg.Timeout)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: hc.cfg.Service})
+	result := HealthServing
+	switch {
+	case err == nil && resp.GetStatus() != healthpb.HealthCheckResponse_SERVING:
+		result = HealthNotServing
+	case status.Code(err) == codes.Unimplemented:
+		result = HealthUnknown
+	case err != nil:
+		result = HealthUnreachable
+	}
+	hc.inv.metrics.Add("gateway_upstream_health_checks_total", 1, "target", target, "status", result)
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	th, ok := hc.targets[target]
+	if !ok {
+		th = &TargetHealth{}
+		hc.targets[target] = th
+	}
+	th.Status, th.CheckedAt, th.Error = result, clock.Now(), ""
+	if err != nil && result != HealthUnknown {
+		th.Error = err.Error()
+	}
+	if result == HealthServing || result == HealthUnknown {
+		th.ConsecutiveFailures = 0
+		return
+	}
+	th.ConsecutiveFailures++
+	if th.ConsecutiveFailures >= hc.cfg.UnhealthyThreshold && hc.inv.conns.evict(target, conn, clock) {
+		th.ConsecutiveFailures = 0
+		th.Evictions++
+		hc.inv.metrics.Add("gateway_upstream_health_evictions_total", 1, "target", target)
+	}
+}
+
+func (hc *healthChecker) snapshot() map[string]TargetHealth {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	out := make(map[string]TargetHealth, len(hc.targets))
+	for target, th := range hc.targets {
+		out[target] = *th
+	}
+	return out
+}
+
+func (hc *healthChecker) close() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.closed = true
+	if hc.stop != nil {
+		hc.stop()
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealthChecks_EvictUnhealthy(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+	target := lis.Addr().String()
+
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	metrics := NewMemoryMetrics()
+	inv := NewInvoker(WithDescriptorDir(t.TempDir()), WithCallTimeout(time.Second), WithClock(clock), WithMetrics(metrics), WithHealthChecks(HealthCheckConfig{Interval: time.Second}))
+	defer inv.Close()
+	conn, _, err := inv.conns.get(target)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+
+	// Probes run on the clock.
+	clock.Advance(time.Second)
+	for deadline := time.Now().Add(5 * time.Second); inv.TargetHealth()[target].Status != HealthServing; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no probe: %+v", inv.TargetHealth())
+		}
+	}
+
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	inv.health.check(target, conn)
+	if th := inv.TargetHealth()[target]; th.Status != HealthNotServing || th.ConsecutiveFailures != 1 || th.Evictions != 0 {
+		t.Fatalf("after one failure: %+v", th)
+	}
+	inv.health.check(target, conn)
+	if th := inv.TargetHealth()[target]; th.Evictions != 1 || th.ConsecutiveFailures != 0 {
+		t.Fatalf("after threshold: %+v", th)
+	}
+	if fresh, _, _ := inv.conns.get(target); fresh == conn {
+		t.Fatal("unhealthy connection still pooled")
+	}
+	if got := metrics.Get("gateway_upstream_health_evictions_total", "target", target); got != 1 {
+		t.Fatalf("evictions metric = %v", got)
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// HedgeConfig hedges calls of a latency-sensitive method: when the first call has not completed after Delay,
+// a duplicate is sent to another endpoint and the first successful response wins; the other call is cancelled.
+// Only enable it for methods without side effects, since the upstream may execute both calls.
+type HedgeConfig struct {
+	// Delay is how long the first call may run before the duplicate is sent, typically around the method's
+	// p95 latency. Zero disables hedging.
+	Delay time.Duration
+}
+
+// WithHedging sets per-method hedging keyed by full method name ("/package.Service/Method"); the "*" entry
+// applies to methods without their own.
+func WithHedging(hedges map[string]HedgeConfig) InvokerOption {
+	return func(inv *Invoker) {
+		p := *inv.methodPolicies()
+		p.hedges = hedges
+		inv.policies.Store(&p)
+	}
+}
+
+func (inv *Invoker) hedgeConfig(methodName string) (HedgeConfig, bool) {
+	configs := inv.methodPolicies().hedges
+	cfg, ok := configs[methodName]
+	if !ok {
+		cfg = configs["*"]
+	}
+	return cfg, cfg.Delay > 0
+}
+
+type hedgeResult struct {
+	resp   proto.Message
+	err    error
+	diag   *Diagnostics
+	span   *Span
+	hedged bool
+}
+
+// invokeHedged calls md on target and, per the method's HedgeConfig, on the first of alternates (or target
+// again when there are none) once the delay has passed without a response. A failure before the delay is
+// returned without hedging.
+func (inv *Invoker) invokeHedged(ctx context.Context, methodName, target string, alternates []string, md *desc.MethodDescriptor, reqMsg proto.Message) (proto.Message, error) {
+	cfg, ok := inv.hedgeConfig(methodName)
+	if !ok {
+		return inv.invokeUnary(ctx, target, md, reqMsg)
+	}
+	hedgeTarget := target
+	if len(alternates) > 0 {
+		hedgeTarget = alternates[0]
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // cancels the losing call
+	// Each call collects its own diagnostics and spans; only calls that reported back are merged, so a loser
+	// still running after the return never races with the caller reading them or rendering the trace.
+	parent := diagnosticsFromContext(ctx)
+	span := SpanFromContext(ctx)
+	results := make(chan hedgeResult, 2)
+	call := func(target string, msg proto.Message, hedged bool) {
+		callCtx, callSpan := detachedSpan(ctx)
+		var d *Diagnostics
+		if parent != nil {
+			d = &Diagnostics{}
+			callCtx = context.WithValue(callCtx, diagnosticsKey{}, d)
+		}
+		resp, err := inv.invokeUnary(callCtx, target, md, msg)
+		results <- hedgeResult{resp: resp, err: err, diag: d, span: callSpan, hedged: hedged}
+	}
+	go call(target, reqMsg, false)
+
+	fire := make(chan struct{})
+	stop := ClockFromContext(ctx, inv.clock).AfterFunc(cfg.Delay, func() { close(fire) })
+	defer stop()
+
+	inflight := 1
+	var firstErr error
+	for {
+		select {
+		case <-fire:
+			fire = nil
+			inflight++
+			span.SetAttr("hedge", hedgeTarget)
+			inv.metrics.Add("gateway_hedged_calls_total", 1, "method", methodName)
+			if parent != nil {
+				parent.Hedged = true
+			}
+			go call(hedgeTarget, proto.Clone(reqMsg), true)
+		case res := <-results:
+			inflight--
+			span.attach(res.span)
+			if parent != nil {
+				parent.DialDuration += res.diag.DialDuration
+				parent.InvokeDuration += res.diag.InvokeDuration
+				parent.Attempts += res.diag.Attempts
+				if res.err == nil || parent.Peer == "" {
+					parent.Peer = res.diag.Peer
+				}
+			}
+			if res.err == nil {
+				if res.hedged {
+					inv.metrics.Add("gateway_hedge_wins_total", 1, "method", methodName)
+				}
+				return res.resp, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if inflight == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
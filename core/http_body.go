@@ -0,0 +1,25 @@
+package core
+
+import (
+	"encoding/json"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// HTTPBodyType is the full name of google.api.HttpBody, the message of arbitrary HTTP bodies. Methods taking
+// it can be sent raw request bodies (InvokeRequest.HTTPBodyContentType); gateways answer methods returning
+// it with its data and content type instead of JSON.
+const HTTPBodyType = "google.api.HttpBody"
+
+// IsHTTPBody reports whether md is google.api.HttpBody.
+func IsHTTPBody(md *desc.MessageDescriptor) bool {
+	return md != nil && md.GetFullyQualifiedName() == HTTPBodyType
+}
+
+// httpBodyJSON returns the JSON of a google.api.HttpBody holding a raw body of contentType.
+func httpBodyJSON(contentType string, data []byte) ([]byte, error) {
+	return json.Marshal(struct {
+		ContentType string `json:"contentType,omitempty"`
+		Data        []byte `json:"data,omitempty"`
+	}{contentType, data})
+}
@@ -1,11 +1,16 @@
 package core
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jhump/protoreflect/desc"
 	"google.golang.org/protobuf/proto"
@@ -17,26 +22,46 @@ import (
 type ResolvedMethod struct {
 	Method     *desc.MethodDescriptor
 	ServiceFQN string
+	// Source is where the descriptor came from: "directory", "local", "inline", "cache" or "fetched".
+	Source string
+	// Key is the descriptor cache key of cached, inline and fetched descriptors.
+	Key string
 }
 
 // InlineDescriptorPool is a descriptor pool built from FileDescriptorSet, for looking up MethodDescriptor by service+method.
 // It does not rely on on-disk core/*.pb files; suitable for gateway requests with inline single-interface descriptor.
 type InlineDescriptorPool struct {
+	hash           string // hex sha256 of the FileDescriptorSet, identifies the version
+	set            *descriptorpb.FileDescriptorSet
+	files          []*desc.FileDescriptor
 	servicesByFQN  map[string]*desc.ServiceDescriptor
 	servicesByName map[string][]*desc.ServiceDescriptor
 }
 
-func newInlineDescriptorPool(descriptorSetBytes []byte) (*InlineDescriptorPool, error) {
+func newInlineDescriptorPool(descriptorSetBytes []byte, base *baseDescriptors) (*InlineDescriptorPool, error) {
 	var fds descriptorpb.FileDescriptorSet
 	if err := proto.Unmarshal(descriptorSetBytes, &fds); err != nil {
 		return nil, fmt.Errorf("unmarshal FileDescriptorSet: %w", err)
 	}
-	files, err := desc.CreateFileDescriptorsFromSet(&fds)
+	return newInlineDescriptorPoolFromSet(&fds, descriptorSetHash(descriptorSetBytes), base)
+}
+
+// newInlineDescriptorPoolFromSet builds the pool of fds, completed with the files of base it imports. The pool
+// keeps fds as uploaded, for merges.
+func newInlineDescriptorPoolFromSet(fds *descriptorpb.FileDescriptorSet, hash string, base *baseDescriptors) (*InlineDescriptorPool, error) {
+	complete := base.complete(fds)
+	if err := ValidateDescriptorSet(complete); err != nil {
+		return nil, err
+	}
+	files, err := desc.CreateFileDescriptorsFromSet(complete)
 	if err != nil {
 		return nil, fmt.Errorf("create file descriptors: %w", err)
 	}
 
 	pool := &InlineDescriptorPool{
+		hash:           hash,
+		set:            fds,
+		files:          sortedFiles(files),
 		servicesByFQN:  make(map[string]*desc.ServiceDescriptor),
 		servicesByName: make(map[string][]*desc.ServiceDescriptor),
 	}
@@ -51,6 +76,11 @@ func newInlineDescriptorPool(descriptorSetBytes []byte) (*InlineDescriptorPool,
 	return pool, nil
 }
 
+func descriptorSetHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
 func (p *InlineDescriptorPool) Resolve(service string, method string) (*ResolvedMethod, error) {
 	service = strings.TrimSpace(service)
 	method = strings.TrimSpace(method)
@@ -98,36 +128,109 @@ func (p *InlineDescriptorPool) Resolve(service string, method string) (*Resolved
 }
 
 // InlineMethodResolver caches resolution results of inline descriptors to avoid rebuilding the pool on every request.
+// Cached pools are bounded by DescriptorCacheLimits and evicted least-recently-used first.
 type InlineMethodResolver struct {
-	mu    sync.RWMutex
-	pools map[string]*InlineDescriptorPool
+	mu    sync.Mutex
+	pools *descriptorCache
 	// pending holds in-progress chunked descriptor uploads, keyed by descriptorID.
 	pending map[string]*descriptorSyncState
+	// fetcher, if set, loads descriptors for ids that are not cached (e.g. BSR module references).
+	fetcher DescriptorFetcher
+	clock   Clock
+	// base fills in imports missing from uploaded sets, see SetBaseDescriptors.
+	base atomic.Pointer[baseDescriptors]
+}
+
+// Flush drops the descriptor pools cached in namespace, with all their versions, or only descriptorID's if
+// it is set; pending chunked uploads are kept. It returns the number of descriptor_ids dropped.
+func (r *InlineMethodResolver) Flush(namespace, descriptorID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if descriptorID != "" {
+		key := NamespacedDescriptorID(namespace, descriptorID)
+		if _, ok := r.pools.items[key]; !ok {
+			return 0
+		}
+		r.pools.delete(key)
+		return 1
+	}
+	var n int
+	for el := r.pools.ll.Front(); el != nil; {
+		next := el.Next()
+		if inNamespace(el.Value.(*descriptorCacheEntry).key, namespace) {
+			r.pools.removeElement(el)
+			n++
+		}
+		el = next
+	}
+	r.pools.report()
+	return n
 }
 
 func NewInlineMethodResolver() *InlineMethodResolver {
 	return &InlineMethodResolver{
-		pools:   make(map[string]*InlineDescriptorPool),
+		pools:   newDescriptorCache(DescriptorCacheLimits{}),
 		pending: make(map[string]*descriptorSyncState),
+		clock:   SystemClock(),
 	}
 }
 
+// SetCacheLimits replaces the cache limits; existing entries are kept and trimmed on the next insert.
+func (r *InlineMethodResolver) SetCacheLimits(limits DescriptorCacheLimits) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := newDescriptorCache(limits)
+	c.metrics = r.pools.metrics
+	for el := r.pools.ll.Back(); el != nil; el = el.Prev() {
+		c.insert(el.Value.(*descriptorCacheEntry))
+	}
+	c.stats.Evictions += r.pools.stats.Evictions
+	c.stats.Expirations += r.pools.stats.Expirations
+	c.stats.PendingBytes = r.pools.stats.PendingBytes
+	r.pools = c
+}
+
+// SetMetrics sets the sink for cache size gauges and eviction counters.
+func (r *InlineMethodResolver) SetMetrics(m Metrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m == nil {
+		m = NopMetrics()
+	}
+	r.pools.metrics = m
+	r.pools.report()
+}
+
+// CacheStats returns current cache size and eviction counters.
+func (r *InlineMethodResolver) CacheStats() DescriptorCacheStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pools.stats
+}
+
 const (
-	maxDescriptorSyncChunks = 2048
-	maxDescriptorSyncBytes  = 32 << 20 // 32MiB
+	maxDescriptorSyncChunks   = 2048
+	maxDescriptorSyncBytes    = 32 << 20 // 32MiB
+	maxPendingDescriptorSyncs = 256
+	// descriptorSyncIdleTimeout abandons uploads that received no chunk for this long.
+	descriptorSyncIdleTimeout = 10 * time.Minute
 )
 
 type descriptorSyncState struct {
-	total    int
-	received int
-	size     int
-	chunks   map[int][]byte
+	startedAt time.Time
+	lastChunk time.Time
+	total     int
+	received  int
+	size      int
+	chunks    map[int][]byte
 }
 
-func newDescriptorSyncState(total int) *descriptorSyncState {
+func newDescriptorSyncState(total int, now time.Time) *descriptorSyncState {
 	return &descriptorSyncState{
-		total:  total,
-		chunks: make(map[int][]byte, total),
+		startedAt: now,
+		lastChunk: now,
+		total:     total,
+		chunks:    make(map[int][]byte, total),
 	}
 }
 
@@ -149,15 +252,58 @@ func (s *descriptorSyncState) assemble() ([]byte, error) {
 	return out, nil
 }
 
+// dropPending discards the in-progress upload of descriptorID, if any, and releases its bytes. r.mu must be held.
+func (r *InlineMethodResolver) dropPending(descriptorID string) {
+	if st, ok := r.pending[descriptorID]; ok {
+		delete(r.pending, descriptorID)
+		r.pools.release(int64(st.size))
+	}
+}
+
+// expirePending drops the uploads abandoned by now: those without a chunk for descriptorSyncIdleTimeout or,
+// with a cache TTL, started longer than the TTL ago. r.mu must be held.
+func (r *InlineMethodResolver) expirePending(now time.Time) {
+	for id, st := range r.pending {
+		if now.Sub(st.lastChunk) >= descriptorSyncIdleTimeout || (r.pools.limits.TTL > 0 && now.Sub(st.startedAt) >= r.pools.limits.TTL) {
+			r.dropPending(id)
+		}
+	}
+}
+
+// dropIdlestPending drops the upload that received its last chunk longest ago. r.mu must be held.
+func (r *InlineMethodResolver) dropIdlestPending() {
+	var idlest string
+	var idlestAt time.Time
+	for id, st := range r.pending {
+		if idlestAt.IsZero() || st.lastChunk.Before(idlestAt) {
+			idlest, idlestAt = id, st.lastChunk
+		}
+	}
+	r.dropPending(idlest)
+}
+
 // SyncDescriptorChunk accepts one descriptor chunk and, once complete, builds and caches the descriptor pool under descriptorID.
 // Chunks are expected to be 0-based indexed: index in [0, total).
 //
-// If reset is true, any existing cached descriptor (and in-progress sync state) for descriptorID is cleared first.
-func (r *InlineMethodResolver) SyncDescriptorChunk(descriptorID string, index, total int, chunk []byte, reset bool) (received int, totalChunks int, done bool, err error) {
+// If reset is true, the completed upload replaces the cached descriptor as its next version (earlier versions
+// stay available for pinning and rollback), and chunk 0 also restarts an upload in progress for descriptorID.
+// Later chunks may carry reset too without losing the chunks received so far.
+// Without reset, an upload to an id that is already cached completes immediately.
+//
+// If merge is true, the completed set is merged into the cached pool (see MergeDescriptorSet) instead of
+// replacing it, and an existing pool does not short-circuit the upload.
+//
+// Uploads that receive no chunk for 10 minutes (or outlive the cache TTL) are abandoned, and at most 256 are
+// in progress at once: starting another abandons the one idle longest. Their bytes count toward
+// DescriptorCacheLimits.MaxBytes.
+func (r *InlineMethodResolver) SyncDescriptorChunk(descriptorID string, index, total int, chunk []byte, reset, merge bool) (received int, totalChunks int, done bool, err error) {
 	descriptorID = strings.TrimSpace(descriptorID)
 	if descriptorID == "" {
 		return 0, 0, false, fmt.Errorf("empty descriptor id")
 	}
+	if _, _, pinned := ParseDescriptorVersion(descriptorID); pinned {
+		return 0, 0, false, fmt.Errorf("cannot upload a descriptor to pinned version %q", descriptorID)
+	}
 	if total <= 0 {
 		return 0, 0, false, fmt.Errorf("invalid total chunks: %d", total)
 	}
@@ -174,27 +320,25 @@ func (r *InlineMethodResolver) SyncDescriptorChunk(descriptorID string, index, t
 		return 0, 0, false, fmt.Errorf("chunk too large: %d bytes", len(chunk))
 	}
 
-	r.mu.RLock()
-	_, alreadyCached := r.pools[descriptorID]
-	r.mu.RUnlock()
-	if alreadyCached && !reset {
-		return total, total, true, nil
-	}
-
 	var assembled []byte
 
+	now := r.clock.Now()
 	r.mu.Lock()
-	if reset {
-		delete(r.pools, descriptorID)
+	// Abandoned uploads start over rather than mixing stale chunks in.
+	r.expirePending(now)
+	if reset && index == 0 {
+		r.dropPending(descriptorID)
 	}
-	if _, ok := r.pools[descriptorID]; ok {
-		// Another goroutine may have cached it after our read lock.
+	st := r.pending[descriptorID]
+	if _, ok := r.pools.get(descriptorID, now); ok && st == nil && !reset && !merge {
 		r.mu.Unlock()
 		return total, total, true, nil
 	}
-	st := r.pending[descriptorID]
 	if st == nil {
-		st = newDescriptorSyncState(total)
+		if len(r.pending) >= maxPendingDescriptorSyncs {
+			r.dropIdlestPending()
+		}
+		st = newDescriptorSyncState(total, now)
 		r.pending[descriptorID] = st
 	}
 	if st.total != total {
@@ -206,11 +350,16 @@ func (r *InlineMethodResolver) SyncDescriptorChunk(descriptorID string, index, t
 			r.mu.Unlock()
 			return 0, 0, false, fmt.Errorf("descriptor too large: %d bytes (max %d)", st.size+len(chunk), maxDescriptorSyncBytes)
 		}
+		if !r.pools.reserve(int64(len(chunk))) {
+			r.mu.Unlock()
+			return 0, 0, false, fmt.Errorf("in-progress descriptor syncs exceed the cache limit of %d bytes", r.pools.limits.MaxBytes)
+		}
 		// Copy chunk bytes to decouple from caller buffer.
 		st.chunks[index] = append([]byte(nil), chunk...)
 		st.received++
 		st.size += len(chunk)
 	}
+	st.lastChunk = now
 	received = st.received
 	totalChunks = st.total
 	done = received == totalChunks
@@ -226,54 +375,207 @@ func (r *InlineMethodResolver) SyncDescriptorChunk(descriptorID string, index, t
 	if !done {
 		return received, totalChunks, false, nil
 	}
+	if assembled, err = DecompressDescriptorSet(assembled, ""); err != nil {
+		return received, totalChunks, false, err
+	}
+
+	if merge {
+		err = r.MergeDescriptorSet(descriptorID, assembled)
+		r.mu.Lock()
+		r.dropPending(descriptorID)
+		r.mu.Unlock()
+		if err != nil {
+			return received, totalChunks, false, err
+		}
+		return totalChunks, totalChunks, true, nil
+	}
 
-	pool, err := newInlineDescriptorPool(assembled)
+	pool, err := newInlineDescriptorPool(assembled, r.base.Load())
 	if err != nil {
 		return received, totalChunks, false, err
 	}
 
 	r.mu.Lock()
-	r.pools[descriptorID] = pool
-	delete(r.pending, descriptorID)
+	r.dropPending(descriptorID)
+	r.pools.put(descriptorID, pool, int64(len(assembled)), r.clock.Now())
 	r.mu.Unlock()
 
 	return totalChunks, totalChunks, true, nil
 }
 
+// ParseDescriptorVersion splits a pinned descriptor id "name@vN" into name and N.
+func ParseDescriptorVersion(descriptorID string) (base string, version int, pinned bool) {
+	i := strings.LastIndex(descriptorID, "@v")
+	if i <= 0 {
+		return descriptorID, 0, false
+	}
+	n, err := strconv.Atoi(descriptorID[i+2:])
+	if err != nil || n <= 0 {
+		return descriptorID, 0, false
+	}
+	return descriptorID[:i], n, true
+}
+
+// DescriptorVersions lists the retained versions of the descriptor cached under key, oldest first.
+func (r *InlineMethodResolver) DescriptorVersions(key string) ([]DescriptorVersion, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pools.versionList(key, r.clock.Now())
+}
+
+// RollbackDescriptor makes a retained version the current one for key. Later uploads continue numbering
+// after the newest version.
+func (r *InlineMethodResolver) RollbackDescriptor(key string, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.pools.rollback(key, version, r.clock.Now()) {
+		return fmt.Errorf("descriptor version %d not found", version)
+	}
+	return nil
+}
+
+// NamespacedDescriptorID returns the cache key for descriptorID within namespace.
+// The empty namespace is the shared, un-namespaced key space. The key joins both with a NUL byte, so callers
+// must reject namespaces and descriptorIDs containing NUL, which would otherwise address another namespace.
+func NamespacedDescriptorID(namespace, descriptorID string) string {
+	if namespace == "" {
+		return descriptorID
+	}
+	return namespace + "\x00" + descriptorID
+}
+
 // Resolve resolves the concrete method by descriptor bytes or descriptorID.
 // - If descriptorSetBytes is non-empty: use this descriptor and cache it under descriptorID (or sha256 of bytes if empty).
-// - If descriptorSetBytes is empty but descriptorID is non-empty: only read the corresponding pool from cache.
-func (r *InlineMethodResolver) Resolve(descriptorSetBytes []byte, descriptorID, service, method string) (*ResolvedMethod, string, error) {
-	key := descriptorID
-	if key == "" && len(descriptorSetBytes) > 0 {
-		sum := sha256.Sum256(descriptorSetBytes)
-		key = hex.EncodeToString(sum[:])
-	}
-	if key == "" {
-		return nil, "", fmt.Errorf("empty descriptor id")
+// - If descriptorSetBytes is empty but descriptorID is non-empty: read the corresponding pool from cache,
+// falling back to the configured DescriptorFetcher (result is cached under descriptorID).
+//
+// namespace scopes the cache key (see NamespacedDescriptorID) so clients in different namespaces cannot
+// read or overwrite each other's descriptor_ids; the returned key is the namespaced cache key.
+func (r *InlineMethodResolver) Resolve(ctx context.Context, namespace string, descriptorSetBytes []byte, descriptorID, service, method string) (*ResolvedMethod, string, error) {
+	if len(descriptorSetBytes) == 0 {
+		rm, key, err := r.resolveCached(ctx, namespace, descriptorID, service, method)
+		if _, _, pinned := ParseDescriptorVersion(descriptorID); errors.Is(err, errDescriptorNotCached) && !pinned && r.fetcher != nil {
+			return r.resolveFetched(ctx, namespace, descriptorID, service, method)
+		}
+		return rm, key, err
 	}
-
-	r.mu.RLock()
-	pool, ok := r.pools[key]
-	r.mu.RUnlock()
-	if !ok && len(descriptorSetBytes) == 0 {
-		return nil, "", fmt.Errorf("descriptor not found for id %q", key)
+	// Hash the set itself so recompressing it does not make a new version.
+	descriptorSetBytes, err := DecompressDescriptorSet(descriptorSetBytes, "")
+	if err != nil {
+		return nil, "", err
 	}
-	if !ok {
-		var err error
-		pool, err = newInlineDescriptorPool(descriptorSetBytes)
-		if err != nil {
+	hash := descriptorSetHash(descriptorSetBytes)
+	id := descriptorID
+	if id == "" {
+		id = hash
+	}
+	if _, _, pinned := ParseDescriptorVersion(id); pinned {
+		return nil, "", fmt.Errorf("cannot upload a descriptor to pinned version %q", id)
+	}
+	key := NamespacedDescriptorID(namespace, id)
+	now := ClockFromContext(ctx, r.clock).Now()
+
+	r.mu.Lock()
+	pool, ok := r.pools.get(key, now)
+	r.mu.Unlock()
+	source := "cache"
+	if !ok || pool.hash != hash {
+		// New content under an existing id becomes its next version.
+		source = "inline"
+		if pool, err = newInlineDescriptorPool(descriptorSetBytes, r.base.Load()); err != nil {
 			return nil, "", err
 		}
 		r.mu.Lock()
-		// Overwrite/write the latest pool
-		r.pools[key] = pool
+		r.pools.put(key, pool, int64(len(descriptorSetBytes)), now)
 		r.mu.Unlock()
 	}
+	return resolveInPool(pool, source, key, service, method)
+}
+
+// errDescriptorNotCached is returned by resolveCached for descriptor ids that are not in the cache.
+var errDescriptorNotCached = errors.New("descriptor not found")
 
+// resolveCached resolves the method from the pool cached under descriptorID ("id@vN" pins a retained version).
+func (r *InlineMethodResolver) resolveCached(ctx context.Context, namespace, descriptorID, service, method string) (*ResolvedMethod, string, error) {
+	if descriptorID == "" {
+		return nil, "", fmt.Errorf("empty descriptor id")
+	}
+	now := ClockFromContext(ctx, r.clock).Now()
+	var (
+		pool *InlineDescriptorPool
+		ok   bool
+		key  string
+	)
+	if base, version, pinned := ParseDescriptorVersion(descriptorID); pinned {
+		key = NamespacedDescriptorID(namespace, base)
+		r.mu.Lock()
+		pool, ok = r.pools.getVersion(key, version, now)
+		r.mu.Unlock()
+	} else {
+		key = NamespacedDescriptorID(namespace, descriptorID)
+		r.mu.Lock()
+		pool, ok = r.pools.get(key, now)
+		r.mu.Unlock()
+	}
+	if !ok {
+		return nil, "", fmt.Errorf("%w for id %q", errDescriptorNotCached, descriptorID)
+	}
+	return resolveInPool(pool, "cache", key, service, method)
+}
+
+// resolveFetched loads descriptorID from the DescriptorFetcher, caches it and resolves the method from it.
+func (r *InlineMethodResolver) resolveFetched(ctx context.Context, namespace, descriptorID, service, method string) (*ResolvedMethod, string, error) {
+	if r.fetcher == nil {
+		return nil, "", fmt.Errorf("descriptor not found for id %q", descriptorID)
+	}
+	data, handled, err := r.fetcher.FetchDescriptorSet(ctx, descriptorID)
+	if err != nil {
+		return nil, "", err
+	}
+	if !handled {
+		return nil, "", fmt.Errorf("descriptor not found for id %q", descriptorID)
+	}
+	if data, err = DecompressDescriptorSet(data, ""); err != nil {
+		return nil, "", err
+	}
+	pool, err := newInlineDescriptorPool(data, r.base.Load())
+	if err != nil {
+		return nil, "", err
+	}
+	key := NamespacedDescriptorID(namespace, descriptorID)
+	r.mu.Lock()
+	r.pools.put(key, pool, int64(len(data)), ClockFromContext(ctx, r.clock).Now())
+	r.mu.Unlock()
+	return resolveInPool(pool, "fetched", key, service, method)
+}
+
+func resolveInPool(pool *InlineDescriptorPool, source, key, service, method string) (*ResolvedMethod, string, error) {
 	rm, err := pool.Resolve(service, method)
 	if err != nil {
 		return nil, "", err
 	}
+	rm.Source, rm.Key = source, key
 	return rm, key, nil
 }
+
+// FindMethod looks fullMethodName up in the cached pools of namespace, most recently used first.
+func (r *InlineMethodResolver) FindMethod(namespace, fullMethodName string) (*ResolvedMethod, bool) {
+	service, method, err := ParseFullMethodName(fullMethodName)
+	if err != nil {
+		return nil, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for el := r.pools.ll.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*descriptorCacheEntry)
+		if !inNamespace(e.key, namespace) {
+			continue
+		}
+		if svc, ok := e.pool.servicesByFQN[service]; ok {
+			if md := svc.FindMethodByName(method); md != nil {
+				return &ResolvedMethod{Method: md, ServiceFQN: svc.GetFullyQualifiedName(), Source: "cache", Key: e.key}, true
+			}
+		}
+	}
+	return nil, false
+}
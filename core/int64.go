@@ -0,0 +1,158 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Int64Encoding selects how 64-bit integer fields (int64, uint64, sint64, fixed64, sfixed64 and their
+// wrappers) travel in JSON. JavaScript parses JSON numbers as doubles, which are exact only up to 2^53, so
+// the proto3 JSON mapping renders these fields as decimal strings.
+type Int64Encoding string
+
+const (
+	// Int64Default follows the proto3 JSON mapping: strings in responses, strings or numbers in requests.
+	Int64Default Int64Encoding = ""
+	// Int64Strings renders strings in responses like Int64Default, and rejects request numbers beyond
+	// ±2^53 with ErrUnsafeInt64: a client that sends such a number as JSON number may already have rounded
+	// it. Strings of any size are accepted.
+	Int64Strings Int64Encoding = "string"
+	// Int64Numbers renders JSON numbers in responses, for clients that parse them exactly (not JavaScript's
+	// JSON.parse); requests take strings or numbers.
+	Int64Numbers Int64Encoding = "number"
+)
+
+// ErrUnsafeInt64 is returned for request bodies with 64-bit integer numbers that Int64Strings rejects.
+var ErrUnsafeInt64 = errors.New("64-bit integer is not exactly representable as a JSON number; send it as a string")
+
+// maxSafeInt64 is the largest magnitude of integers that doubles represent exactly.
+const maxSafeInt64 = 1 << 53
+
+// is64Bit reports whether fd is a 64-bit integer field, or a 64-bit integer wrapper message.
+func is64Bit(fd *desc.FieldDescriptor) bool {
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SINT64, descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		return true
+	}
+	if mt := fd.GetMessageType(); mt != nil {
+		name := mt.GetFullyQualifiedName()
+		return name == "google.protobuf.Int64Value" || name == "google.protobuf.UInt64Value"
+	}
+	return false
+}
+
+// walkInt64 replaces every non-null value of a 64-bit integer field within v, a JSON value of message md,
+// with f's result; the first error of f ends the walk.
+func walkInt64(md *desc.MessageDescriptor, v any, f func(fd *desc.FieldDescriptor, v any) (any, error)) (any, error) {
+	obj, ok := v.(map[string]any)
+	if !ok || isCoercedWKT(md.GetFullyQualifiedName()) || md.GetFullyQualifiedName() == "google.protobuf.Any" {
+		return v, nil
+	}
+	var err error
+	value := func(fd *desc.FieldDescriptor, v any) (any, error) {
+		switch {
+		case v == nil:
+			return nil, nil
+		case is64Bit(fd):
+			return f(fd, v)
+		case fd.GetMessageType() != nil:
+			return walkInt64(fd.GetMessageType(), v, f)
+		}
+		return v, nil
+	}
+	for key, fv := range obj {
+		fd := md.FindFieldByJSONName(key)
+		if fd == nil {
+			fd = md.FindFieldByName(key)
+		}
+		if fd == nil {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			if m, ok := fv.(map[string]any); ok {
+				for k, e := range m {
+					if m[k], err = value(fd.GetMapValueType(), e); err != nil {
+						return nil, err
+					}
+				}
+			}
+		case fd.IsRepeated():
+			if list, ok := fv.([]any); ok {
+				for i, e := range list {
+					if list[i], err = value(fd, e); err != nil {
+						return nil, err
+					}
+				}
+			}
+		default:
+			if obj[key], err = value(fd, fv); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return obj, nil
+}
+
+// checkSafeInt64 rejects the 64-bit integer numbers beyond ±2^53 in body, a JSON message of type md.
+func checkSafeInt64(md *desc.MessageDescriptor, body []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil // left to the decoder to report
+	}
+	_, err := walkInt64(md, v, func(fd *desc.FieldDescriptor, v any) (any, error) {
+		n, ok := v.(json.Number)
+		if !ok {
+			return v, nil
+		}
+		var unsafe bool
+		if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil {
+			unsafe = i > maxSafeInt64 || i < -maxSafeInt64
+		} else if f, err := n.Float64(); err == nil {
+			unsafe = math.Abs(f) > maxSafeInt64 // beyond int64, or with a fraction or exponent
+		}
+		if unsafe {
+			return nil, fmt.Errorf("%w: %s = %s", ErrUnsafeInt64, fd.GetName(), n)
+		}
+		return v, nil
+	})
+	return err
+}
+
+// int64Numbers renders the 64-bit integer strings of body, a JSON message of type md, as numbers.
+func int64Numbers(md *desc.MessageDescriptor, body []byte) ([]byte, error) {
+	return rewriteJSON(body, func(v any) any {
+		v, _ = walkInt64(md, v, func(_ *desc.FieldDescriptor, v any) (any, error) {
+			s, ok := v.(string)
+			if !ok {
+				return v, nil
+			}
+			if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+				if _, err := strconv.ParseUint(s, 10, 64); err != nil {
+					return v, nil
+				}
+			}
+			return json.Number(s), nil
+		})
+		return v
+	})
+}
+
+// encodeResponse applies e to body, a JSON response message of type md.
+func (e Int64Encoding) encodeResponse(md *desc.MessageDescriptor, body []byte) ([]byte, error) {
+	if e != Int64Numbers {
+		return body, nil
+	}
+	return int64Numbers(md, body)
+}
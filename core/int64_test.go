@@ -0,0 +1,60 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	_ "google.golang.org/protobuf/types/known/wrapperspb" // registers the well-known types
+)
+
+func int64TestMessage(t *testing.T) *desc.MessageDescriptor {
+	t.Helper()
+	wrapper, err := desc.LoadMessageDescriptor("google.protobuf.Int64Value")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	child := builder.NewMessage("Child").
+		AddField(builder.NewField("size", builder.FieldTypeFixed64()))
+	msg := builder.NewMessage("Order").
+		AddField(builder.NewField("id", builder.FieldTypeInt64())).
+		AddField(builder.NewField("count", builder.FieldTypeInt32())).
+		AddField(builder.NewField("ids", builder.FieldTypeUInt64()).SetRepeated()).
+		AddField(builder.NewField("limit", builder.FieldTypeImportedMessage(wrapper))).
+		AddField(builder.NewField("child", builder.FieldTypeMessage(child))).
+		AddField(builder.NewMapField("totals", builder.FieldTypeString(), builder.FieldTypeSInt64()))
+	fd, err := builder.NewFile("acme/order.proto").SetPackageName("acme").AddMessage(child).AddMessage(msg).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	return fd.FindMessage("acme.Order")
+}
+
+func TestInt64Numbers(t *testing.T) {
+	md := int64TestMessage(t)
+	body := `{"id":"-9007199254740993","count":7,"ids":["18446744073709551615"],"limit":"5","child":{"size":"3"},"totals":{"a":"-1"}}`
+	got, err := int64Numbers(md, []byte(body))
+	want := `{"child":{"size":3},"count":7,"id":-9007199254740993,"ids":[18446744073709551615],"limit":5,"totals":{"a":-1}}`
+	if err != nil || string(got) != want {
+		t.Fatalf("got %s, %v; want %s", got, err, want)
+	}
+}
+
+func TestCheckSafeInt64(t *testing.T) {
+	md := int64TestMessage(t)
+	for body, ok := range map[string]bool{
+		`{"id":9007199254740992,"count":2147483647}`: true,
+		`{"id":"9007199254740993"}`:                  true,
+		`{"id":9007199254740993}`:                    false,
+		`{"ids":[1,-1e17]}`:                          false,
+		`{"limit":18014398509481984}`:                false,
+		`{"child":{"size":18014398509481984}}`:       false,
+		`{"totals":{"a":18014398509481984}}`:         false,
+	} {
+		err := checkSafeInt64(md, []byte(body))
+		if ok != (err == nil) || (err != nil && !errors.Is(err, ErrUnsafeInt64)) {
+			t.Errorf("%s: %v", body, err)
+		}
+	}
+}
@@ -2,34 +2,225 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
 	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
 )
 
-// Invoker performs gRPC calls using the descriptor directory and target address.
+// Invoker performs dynamic gRPC calls: it resolves methods from descriptors (files, inline sets, a
+// DescriptorFetcher or a local server), converts JSON (or prototext, YAML) request bodies to messages, calls
+// the target over a pooled connection and renders the response as JSON. It is safe for concurrent use and
+// usable without the HTTP gateway, see NewInvoker.
 type Invoker struct {
 	resolver       *MethodResolver
 	inlineResolver *InlineMethodResolver
 	timeout        time.Duration
+	clock          Clock
+	rand           Rand
+	metrics        Metrics
+	conns          *connPool
+	churn          churnTracker
+	limiter        targetLimiter
+	policies       atomic.Pointer[methodPolicies]
+	flights        flightGroup       // calls in flight, see WithCoalescing
+	local          *grpc.Server      // served at LocalTarget, see WithLocalServer
+	maxResponse    int               // see WithMaxResponseBytes
+	health         *healthChecker    // nil without WithHealthChecks
+	layers         []DescriptorLayer // resolution order, see WithDescriptorLayers; nil means DefaultDescriptorLayers
+	shadowWG       sync.WaitGroup
 }
 
-// NewInvoker creates an invoker; descriptorDir is the directory containing .pb files, timeout is the per-call gRPC timeout.
-func NewInvoker(descriptorDir string, timeout time.Duration) *Invoker {
-	return &Invoker{
-		resolver:       NewMethodResolver(descriptorDir),
+// InvokerOption configures optional Invoker behavior.
+type InvokerOption func(*Invoker)
+
+// WithDescriptorFetcher sets the backend used to load descriptor_ids that are not in the inline cache.
+func WithDescriptorFetcher(f DescriptorFetcher) InvokerOption {
+	return func(inv *Invoker) {
+		inv.inlineResolver.fetcher = f
+	}
+}
+
+// WithClock sets the time source used for call deadlines; a clock carried by the call context takes precedence.
+func WithClock(c Clock) InvokerOption {
+	return func(inv *Invoker) {
+		inv.clock = c
+		inv.inlineResolver.clock = c
+	}
+}
+
+// WithRand sets the randomness source used for jitter; a source carried by the call context takes precedence.
+func WithRand(r Rand) InvokerOption {
+	return func(inv *Invoker) {
+		inv.rand = r
+	}
+}
+
+// WithDescriptorCacheLimits bounds the inline descriptor cache (entries, bytes, TTL).
+func WithDescriptorCacheLimits(limits DescriptorCacheLimits) InvokerOption {
+	return func(inv *Invoker) {
+		inv.inlineResolver.SetCacheLimits(limits)
+	}
+}
+
+// WithMetrics sets the sink for invoker and cache metrics.
+func WithMetrics(m Metrics) InvokerOption {
+	return func(inv *Invoker) {
+		if m == nil {
+			m = NopMetrics()
+		}
+		inv.metrics = m
+		inv.inlineResolver.SetMetrics(m)
+	}
+}
+
+// WithMethodTimeouts sets per-method call timeouts keyed by full method name ("/package.Service/Method");
+// the "*" entry applies to methods without their own.
+// They tighten, never extend, the invoker timeout and any deadline carried by the request.
+func WithMethodTimeouts(timeouts map[string]time.Duration) InvokerOption {
+	return func(inv *Invoker) {
+		p := *inv.methodPolicies()
+		p.timeouts = timeouts
+		inv.policies.Store(&p)
+	}
+}
+
+// methodPolicies are the per-method settings, replaced as a whole by SetMethodPolicies.
+type methodPolicies struct {
+	timeouts map[string]time.Duration
+	shadows  map[string]ShadowConfig
+	hedges   map[string]HedgeConfig
+	coalesce map[string]bool
+}
+
+func (inv *Invoker) methodPolicies() *methodPolicies {
+	if p := inv.policies.Load(); p != nil {
+		return p
+	}
+	return &methodPolicies{}
+}
+
+// SetMethodPolicies replaces the per-method timeouts, shadows, hedging and coalescing set by WithMethodTimeouts,
+// WithShadows, WithHedging and WithCoalescing, e.g. on a configuration reload. It is safe to call while calls
+// are in flight; those may still apply the previous settings.
+func (inv *Invoker) SetMethodPolicies(timeouts map[string]time.Duration, shadows map[string]ShadowConfig, hedges map[string]HedgeConfig, coalesce map[string]bool) {
+	inv.policies.Store(&methodPolicies{timeouts: timeouts, shadows: shadows, hedges: hedges, coalesce: coalesce})
+}
+
+// WithMaxResponseBytes limits upstream responses to n bytes, both as received (overriding larger or unset
+// TargetConfig.MaxRecvMsgSize values, which may raise the 4MiB gRPC default) and as rendered to JSON. Calls
+// exceeding it fail with ErrResponseTooLarge. Zero means no limit beyond the target configuration.
+func WithMaxResponseBytes(n int) InvokerOption {
+	return func(inv *Invoker) {
+		inv.maxResponse = n
+		inv.conns.maxRecvMsgSize = n
+	}
+}
+
+// ErrResponseTooLarge is returned by Invoke when the upstream response exceeds the WithMaxResponseBytes limit.
+var ErrResponseTooLarge = errors.New("upstream response too large")
+
+// WithTargetConfigs sets per-target channel settings (keepalive, message sizes, authority, ...) keyed by
+// target address; the "*" entry applies to targets without their own.
+func WithTargetConfigs(configs map[string]TargetConfig) InvokerOption {
+	return func(inv *Invoker) {
+		inv.conns.configs = configs
+	}
+}
+
+// WithDescriptorDir reads the {service_name}.pb descriptor files from dir instead of DefaultDescriptorDir.
+func WithDescriptorDir(dir string) InvokerOption {
+	return func(inv *Invoker) {
+		inv.resolver = NewMethodResolver(dir)
+	}
+}
+
+// WithDescriptorFS reads the {service_name}.pb descriptor files from fsys (e.g. an embed.FS of them) instead of
+// a descriptor directory.
+func WithDescriptorFS(fsys fs.FS) InvokerOption {
+	return func(inv *Invoker) {
+		inv.resolver = NewMethodResolverFS(fsys)
+	}
+}
+
+// WithCallTimeout bounds every call to d, on top of per-method timeouts and request deadlines; zero (the
+// default) leaves calls bounded by those alone.
+func WithCallTimeout(d time.Duration) InvokerOption {
+	return func(inv *Invoker) {
+		inv.timeout = d
+	}
+}
+
+// NewInvoker creates an invoker configured by opts. Without options it resolves methods from the descriptor
+// files in DefaultDescriptorDir, dials targets in plaintext with gRPC defaults and sets no call timeout.
+// Close it to release its connections.
+func NewInvoker(opts ...InvokerOption) *Invoker {
+	inv := &Invoker{
+		resolver:       NewMethodResolver(DefaultDescriptorDir()),
 		inlineResolver: NewInlineMethodResolver(),
-		timeout:        timeout,
+		clock:          SystemClock(),
+		rand:           SystemRand(),
+		metrics:        NopMetrics(),
+		conns:          newConnPool(),
 	}
+	for _, opt := range opts {
+		opt(inv)
+	}
+	inv.conns.clock = inv.clock
+	if inv.health != nil {
+		inv.health.schedule()
+	}
+	return inv
 }
 
 // SyncInlineDescriptorChunk streams a descriptor in chunks into the in-memory cache.
 // Once all chunks are received, the descriptor pool is built and stored under descriptorID.
-func (inv *Invoker) SyncInlineDescriptorChunk(descriptorID string, index, total int, chunk []byte, reset bool) (received int, totalChunks int, done bool, err error) {
-	return inv.inlineResolver.SyncDescriptorChunk(descriptorID, index, total, chunk, reset)
+// With merge, the completed set is merged into the existing pool rather than replacing it.
+func (inv *Invoker) SyncInlineDescriptorChunk(descriptorID string, index, total int, chunk []byte, reset, merge bool) (received int, totalChunks int, done bool, err error) {
+	return inv.inlineResolver.SyncDescriptorChunk(descriptorID, index, total, chunk, reset, merge)
+}
+
+// DescriptorVersions lists the retained versions of descriptorID in namespace, oldest first.
+func (inv *Invoker) DescriptorVersions(namespace, descriptorID string) ([]DescriptorVersion, bool) {
+	return inv.inlineResolver.DescriptorVersions(NamespacedDescriptorID(namespace, descriptorID))
+}
+
+// RollbackDescriptor makes version the current version of descriptorID in namespace.
+func (inv *Invoker) RollbackDescriptor(namespace, descriptorID string, version int) error {
+	return inv.inlineResolver.RollbackDescriptor(NamespacedDescriptorID(namespace, descriptorID), version)
+}
+
+// FlushDescriptors drops the inline descriptors cached in namespace, or only descriptorID's if it is set, so
+// that requests naming them upload them again or have them fetched anew (see WithDescriptorFetcher). It
+// returns the number of descriptor_ids dropped.
+func (inv *Invoker) FlushDescriptors(namespace, descriptorID string) int {
+	return inv.inlineResolver.Flush(namespace, descriptorID)
+}
+
+// FlushMethods drops the methods and files cached from the descriptor directory and embedded descriptors; see
+// MethodResolver.Flush. It returns the number of methods dropped.
+func (inv *Invoker) FlushMethods() int {
+	return inv.resolver.Flush()
+}
+
+// DescriptorCacheStats reports the size of the inline descriptor cache.
+func (inv *Invoker) DescriptorCacheStats() DescriptorCacheStats {
+	return inv.inlineResolver.CacheStats()
 }
 
 // InvokeRequest is the input for the HTTP gateway.
@@ -42,64 +233,440 @@ type InvokeRequest struct {
 	MethodName          string
 	InlineDescriptorSet []byte // if non-empty, use this descriptor and write/overwrite cache
 	DescriptorID        string // when InlineDescriptorSet is empty, fetch descriptor from cache
+	DescriptorNamespace string // caller namespace that scopes DescriptorID in the cache; empty means shared
+	MergeDescriptor     bool   // merge InlineDescriptorSet into the pool cached under DescriptorID instead of replacing it
+
+	Metadata   map[string][]string // gRPC metadata added to the outgoing call
+	Body       []byte              // request body, JSON unless BodyFormat says otherwise; see Invoke for client-streaming methods
+	BodyFormat BodyFormat          // encoding of Body; zero means JSON
+	// HTTPBodyContentType, if set, marks Body as a raw HTTP body of this Content-Type: methods whose input is
+	// google.api.HttpBody take it as the body's data, whatever BodyFormat says; others decode it as usual.
+	HTTPBodyContentType string
+
+	// WKTCoercion, if set, accepts non-canonical JSON forms of well-known types in Body (JSON or YAML) and
+	// renders them in the response as it selects.
+	WKTCoercion *WKTCoercion
+	// FieldPresence selects how unset response fields with presence are rendered; see FieldPresence.
+	FieldPresence FieldPresence
+	// FieldVisibility, if set, hides response fields whose visibility rules do not hold for the caller.
+	FieldVisibility *FieldVisibility
+	// Int64Encoding selects the JSON form of 64-bit integers in Body and the response; see Int64Encoding.
+	Int64Encoding Int64Encoding
+	// LenientEnums accepts enum value names in Body (JSON or YAML) case-insensitively and without the enum's
+	// prefix, e.g. "active" for USER_STATUS_ACTIVE.
+	LenientEnums bool
+	// UnknownFields selects how fields of a JSON or YAML Body that the request message does not declare are
+	// handled; the zero value rejects them. Under UnknownFieldsWarn, OnUnknownFields gets their paths.
+	UnknownFields   UnknownFieldPolicy
+	OnUnknownFields func(paths []string)
+	// Defaults maps dotted field paths (e.g. "paging.page_size") to values in the proto3 JSON mapping that
+	// are set on the request message where the body leaves them unset. They take precedence over defaults
+	// declared with the gateway.default_value field option, which apply regardless.
+	Defaults map[string]any
+	// Overrides maps dotted field paths to values in the proto3 JSON mapping that are set on the request
+	// message whatever Body says, e.g. fields bound from a URL path; Defaults apply after them. Values that
+	// do not fit their fields fail the call with ErrInvalidBinding.
+	Overrides map[string]any
 
-	Body []byte // request body as JSON
+	// AffinityKey routes the call, on targets with TargetConfig.ConsistentHash, to the endpoint the key hashes
+	// to, so that calls with the same key (e.g. a user ID) reach the same instance of a stateful backend.
+	// AffinityField, used if AffinityKey is empty, names a dotted request field whose value is the key; for
+	// client-streaming calls, that of the first message; bidirectional-streaming calls only use AffinityKey.
+	// Calls without a key are balanced round-robin.
+	AffinityKey   string
+	AffinityField string
+
+	// FetchAllPages, if positive, follows the next_page_token of an AIP-158 list method for up to this many
+	// pages and returns the first response with the items of all of them and the next_page_token of the last
+	// page fetched (empty unless the cap cut the listing short). Other methods fail with ErrNotPaginated.
+	FetchAllPages int
+
+	// HedgeTargets are other endpoints serving Target's methods; hedged calls (see WithHedging) go to the
+	// first of them, or to Target again when empty.
+	HedgeTargets []string
+
+	// OnResolve, if set, is called with the resolved method before Body is decoded; an error aborts the call
+	// and is returned as is.
+	OnResolve func(method *desc.MethodDescriptor) error
+
+	// Authorize, if set, is called with the resolved full method name and the decoded request message as
+	// JSON (defaults included) before the upstream call; an error aborts the call and is returned as is.
+	Authorize func(method string, request []byte) error
+
+	// ValidateOnly resolves the method, decodes the body and runs Authorize without calling the upstream;
+	// Invoke then returns a nil response and the first error encountered.
+	ValidateOnly bool
+
+	// Capture, if set, is called once the upstream call completes with the resolved method and the request and
+	// response messages as JSON (response nil if the call failed), e.g. for audit logging.
+	Capture func(method *desc.MethodDescriptor, request, response []byte)
+
+	// Diagnostics, if set, is filled in with how the call was carried out (method, peer, timings, attempts).
+	Diagnostics *Diagnostics
+
+	// Timeout is the caller's remaining deadline (e.g. from a grpc-timeout header); zero means none.
+	// The effective deadline is the minimum of this, the per-method timeout and the invoker timeout.
+	Timeout time.Duration
+
+	resolved *resolvedCall // set by ResolveMethod
 }
 
 // Invoke performs one Unary gRPC call: Body (JSON) is converted to PB request, target is called, response is converted to JSON.
+// For client-streaming methods Body is a JSON (or YAML) array or NDJSON, each element of which is sent as one
+// stream message ("[]" sends none), and the single response is returned; malformed bodies fail with
+// ErrInvalidStreamBody.
 func (inv *Invoker) Invoke(ctx context.Context, req *InvokeRequest) ([]byte, error) {
-	if inv.timeout > 0 {
+	// Nested deadlines compose to their minimum; the per-method timeout is applied once the method is resolved.
+	for _, d := range []time.Duration{inv.timeout, req.Timeout} {
+		if d > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = WithTimeout(ctx, ClockFromContext(ctx, inv.clock), d)
+			defer cancel()
+		}
+	}
+
+	ctx, span := StartSpan(ctx, "invoke")
+	ctx = withDiagnostics(ctx, req.Diagnostics)
+	resp, err := inv.invoke(ctx, req, span)
+	span.End(err)
+	return resp, err
+}
+
+func (inv *Invoker) invoke(ctx context.Context, req *InvokeRequest, span *Span) ([]byte, error) {
+	clock := ClockFromContext(ctx, inv.clock)
+	resolveStart := clock.Now()
+	_, resolveSpan := StartSpan(ctx, "resolve")
+	method, methodName, err := inv.resolve(ctx, req)
+	resolveSpan.End(err)
+	if d := req.Diagnostics; d != nil {
+		d.ResolveDuration += clock.Now().Sub(resolveStart)
+		if req.resolved != nil {
+			d.ResolveDuration += req.resolved.duration
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	ctx = withResolvedCall(ctx, req, method, methodName)
+	span.SetTarget(req.Target, methodName)
+	if d := req.Diagnostics; d != nil {
+		d.Method, d.Target, d.DescriptorSource = methodName, req.Target, method.Source
+	}
+
+	timeouts := inv.methodPolicies().timeouts
+	d, ok := timeouts[methodName]
+	if !ok {
+		d = timeouts["*"]
+	}
+	if d > 0 {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, inv.timeout)
+		ctx, cancel = WithTimeout(ctx, ClockFromContext(ctx, inv.clock), d)
 		defer cancel()
 	}
 
-	var (
-		method     = (*ResolvedMethod)(nil)
-		methodName string
-		err        error
-	)
-	if len(req.InlineDescriptorSet) > 0 || req.DescriptorID != "" {
-		if req.MethodName == "" {
-			return nil, fmt.Errorf("missing method for inline descriptor invocation")
+	if method.Method.IsServerStreaming() {
+		return nil, fmt.Errorf("%w: %s", ErrStreamingMethod, methodName)
+	}
+
+	var pages *pagination
+	if req.FetchAllPages > 0 {
+		if pages, err = paginationOf(method.Method); err != nil {
+			return nil, err
 		}
-		method, _, err = inv.inlineResolver.Resolve(req.InlineDescriptorSet, req.DescriptorID, req.ServiceName, req.MethodName)
-		if err != nil {
-			return nil, fmt.Errorf("resolve method from inline descriptor: %w", err)
+	}
+	resolver := inv.anyResolver(req.DescriptorNamespace, method.Method)
+	var respMsg proto.Message
+	var request []byte
+	if method.Method.IsClientStreaming() {
+		var msgs []proto.Message
+		if msgs, request, err = inv.decodeStream(ctx, req, methodName, method.Method, resolver); err != nil {
+			return nil, err
+		}
+		if req.ValidateOnly {
+			return nil, nil
 		}
-		methodName = "/" + method.ServiceFQN + "/" + method.Method.GetName()
+		ctx := outgoingMetadata(ctx, req.Metadata)
+		if len(msgs) > 0 {
+			ctx = withAffinityKey(ctx, req.affinityKey(msgs[0]))
+		}
+		respMsg, err = inv.invokeClientStream(ctx, req.Target, methodName, method.Method, msgs)
 	} else {
-		if req.FullMethodName == "" {
-			return nil, fmt.Errorf("missing full method name")
+		var reqMsg proto.Message
+		if reqMsg, request, err = inv.decodeRequest(ctx, req, methodName, method.Method, resolver); err != nil {
+			return nil, err
 		}
-		md, err := inv.resolver.Resolve(req.FullMethodName)
-		if err != nil {
-			return nil, fmt.Errorf("resolve method: %w", err)
+		if req.ValidateOnly {
+			return nil, nil
+		}
+		inv.mirror(ctx, methodName, req.Target, method.Method, reqMsg)
+
+		ctx := withAffinityKey(outgoingMetadata(ctx, req.Metadata), req.affinityKey(reqMsg))
+		call := func(reqMsg proto.Message) (proto.Message, error) {
+			return inv.invokeCoalesced(ctx, methodName, req.Target, reqMsg, func(ctx context.Context) (proto.Message, error) {
+				return inv.invokeHedged(ctx, methodName, req.Target, req.HedgeTargets, method.Method, reqMsg)
+			})
+		}
+		respMsg, err = call(reqMsg)
+		if err == nil && pages != nil {
+			var n int
+			respMsg, n, err = pages.fetchAll(respMsg, reqMsg, req.FetchAllPages, call)
+			if d := req.Diagnostics; d != nil {
+				d.Pages = n
+			}
 		}
-		method = &ResolvedMethod{Method: md, ServiceFQN: md.GetService().GetFullyQualifiedName()}
-		methodName = req.FullMethodName
+	}
+	if err != nil {
+		if req.Capture != nil {
+			req.Capture(method.Method, request, nil)
+		}
+		if responseTooLarge(err) {
+			return nil, fmt.Errorf("%w: %v", ErrResponseTooLarge, err)
+		}
+		// The upstream call shares ctx, so a cancelled caller (e.g. the HTTP client went away) or an expired
+		// deadline has already aborted it; count these separately from upstream failures.
+		switch ctx.Err() {
+		case context.Canceled:
+			inv.metrics.Add("gateway_upstream_cancelled_total", 1, "method", methodName, "reason", "canceled")
+		case context.DeadlineExceeded:
+			inv.metrics.Add("gateway_upstream_cancelled_total", 1, "method", methodName, "reason", "deadline_exceeded")
+		}
+		return nil, newUpstreamError(err, resolver)
 	}
 
-	if method.Method.IsClientStreaming() || method.Method.IsServerStreaming() {
-		return nil, fmt.Errorf("streaming method not supported: %s", methodName)
+	marshalStart := clock.Now()
+	resp, err := messageToJSON(respMsg, resolver)
+	if err == nil {
+		resp, err = req.FieldPresence.applyPresence(respMsg, resp)
+	}
+	if err == nil {
+		resp, err = req.FieldVisibility.hideFields(method.Method.GetOutputType(), resp)
 	}
+	if err == nil {
+		resp, err = req.Int64Encoding.encodeResponse(method.Method.GetOutputType(), resp)
+	}
+	if err == nil && req.WKTCoercion != nil {
+		resp, err = req.WKTCoercion.coerceResponse(method.Method.GetOutputType(), resp)
+	}
+	if d := req.Diagnostics; d != nil {
+		d.MarshalDuration += clock.Now().Sub(marshalStart)
+	}
+	if err == nil && inv.maxResponse > 0 && len(resp) > inv.maxResponse {
+		resp, err = nil, fmt.Errorf("%w: %d bytes of JSON exceed the limit of %d", ErrResponseTooLarge, len(resp), inv.maxResponse)
+	}
+	if req.Capture != nil {
+		req.Capture(method.Method, request, resp)
+	}
+	return resp, err
+}
 
-	reqMsg, err := JSONToMessage(method.Method, req.Body)
-	if err != nil {
-		return nil, fmt.Errorf("json to message: %w", err)
+// outgoingMetadata adds md to the outgoing gRPC metadata of ctx.
+func outgoingMetadata(ctx context.Context, md map[string][]string) context.Context {
+	if len(md) == 0 {
+		return ctx
 	}
+	out, _ := metadata.FromOutgoingContext(ctx)
+	return metadata.NewOutgoingContext(ctx, metadata.Join(out, metadata.MD(md)))
+}
 
-	conn, err := grpc.DialContext(ctx, req.Target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// decodeRequest runs req.OnResolve, turns the Body of req into the request message of md, applying the body
+// options of req, and runs req.Authorize. The message is also returned as JSON if Authorize or Capture needs it.
+func (inv *Invoker) decodeRequest(ctx context.Context, req *InvokeRequest, methodName string, md *desc.MethodDescriptor, resolver jsonpb.AnyResolver) (proto.Message, []byte, error) {
+	if req.OnResolve != nil {
+		if err := req.OnResolve(md); err != nil {
+			return nil, nil, err
+		}
+	}
+	if d := req.Diagnostics; d != nil {
+		clock := ClockFromContext(ctx, inv.clock)
+		start := clock.Now()
+		defer func() { d.DecodeDuration += clock.Now().Sub(start) }()
+	}
+	var err error
+	body, format := req.Body, req.BodyFormat
+	if req.HTTPBodyContentType != "" && IsHTTPBody(md.GetInputType()) {
+		if body, err = httpBodyJSON(req.HTTPBodyContentType, body); err != nil {
+			return nil, nil, err
+		}
+		format = BodyFormatJSON
+	} else if format == BodyFormatQuery {
+		if body, err = queryToJSON(md.GetInputType(), string(body)); err != nil {
+			return nil, nil, err
+		}
+		format = BodyFormatJSON
+	}
+	warnUnknown := req.UnknownFields == UnknownFieldsWarn && req.OnUnknownFields != nil
+	safeInt64 := req.Int64Encoding == Int64Strings
+	if (req.WKTCoercion != nil || req.LenientEnums || warnUnknown || safeInt64) && format != BodyFormatText {
+		if format == BodyFormatYAML {
+			if body, err = yamlToJSON(body); err != nil {
+				return nil, nil, fmt.Errorf("yaml to message: %w", err)
+			}
+			format = BodyFormatJSON
+		}
+		if req.WKTCoercion != nil {
+			if body, err = req.WKTCoercion.coerceRequest(md.GetInputType(), body); err != nil {
+				return nil, nil, fmt.Errorf("json to message: %w", err)
+			}
+		}
+		if req.LenientEnums {
+			if body, err = lenientEnums(md.GetInputType(), body); err != nil {
+				return nil, nil, fmt.Errorf("json to message: %w", err)
+			}
+		}
+		if safeInt64 {
+			if err := checkSafeInt64(md.GetInputType(), body); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	allowUnknown := req.UnknownFields == UnknownFieldsDrop || req.UnknownFields == UnknownFieldsWarn
+	reqMsg, err := decodeBody(md, body, format, resolver, allowUnknown)
 	if err != nil {
-		return nil, fmt.Errorf("dial %s: %w", req.Target, err)
+		if !allowUnknown && format != BodyFormatText {
+			jsonBody := body
+			if format == BodyFormatYAML {
+				jsonBody, _ = yamlToJSON(body)
+			}
+			if err := unknownFieldsError(md.GetInputType(), jsonBody, err); errors.Is(err, ErrUnknownFields) {
+				return nil, nil, err
+			}
+		}
+		if req.BodyFormat != BodyFormatJSON {
+			return nil, nil, fmt.Errorf("%s to message: %w", req.BodyFormat, err)
+		}
+		return nil, nil, fmt.Errorf("json to message: %w", err)
+	}
+	if msg, ok := reqMsg.(*dynamic.Message); ok {
+		if err := applyOverrides(msg, req.Overrides, resolver); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidBinding, err)
+		}
+		if err := applyDefaults(msg, req.Defaults, resolver); err != nil {
+			return nil, nil, fmt.Errorf("request defaults: %w", err)
+		}
 	}
-	defer conn.Close()
+	if warnUnknown && format == BodyFormatJSON {
+		if paths := unknownFields(md.GetInputType(), body); len(paths) > 0 {
+			req.OnUnknownFields(paths)
+		}
+	}
+	var request []byte
+	if req.Authorize != nil || req.Capture != nil {
+		if request, err = messageToJSON(reqMsg, resolver); err != nil {
+			return nil, nil, fmt.Errorf("message to json: %w", err)
+		}
+	}
+	if req.Authorize != nil {
+		if err := req.Authorize(methodName, request); err != nil {
+			return nil, nil, err
+		}
+	}
+	return reqMsg, request, nil
+}
 
-	stub := grpcdynamic.NewStub(conn)
-	respMsg, err := stub.InvokeRpc(ctx, method.Method, reqMsg)
-	if err != nil {
-		return nil, fmt.Errorf("invoke rpc: %w", err)
+const maxChurnRetries = 2
+
+var churnBackoff = Backoff{Base: 20 * time.Millisecond, Max: 500 * time.Millisecond, Jitter: 0.2}
+
+// invokeUnary calls md on the pooled connection for target. When the call fails because the upstream
+// connection went away (GOAWAY, reset), the connection is replaced and safe (idempotent) methods are
+// retried on the fresh connection.
+func (inv *Invoker) invokeUnary(ctx context.Context, target string, md *desc.MethodDescriptor, reqMsg proto.Message) (proto.Message, error) {
+	clock := ClockFromContext(ctx, inv.clock)
+	for attempt := 0; ; attempt++ {
+		attemptCtx, span := StartSpan(ctx, "attempt")
+		span.SetTarget(target, "/"+md.GetService().GetFullyQualifiedName()+"/"+md.GetName())
+		release, err := inv.limiter.acquire(attemptCtx, clock, inv.metrics, target, inv.conns.label(target), inv.conns.config(target))
+		if err != nil {
+			span.End(err)
+			return nil, err
+		}
+		diag := diagnosticsFromContext(ctx)
+		start := clock.Now()
+		channel, conn, err := inv.conns.channel(target)
+		if diag != nil {
+			diag.DialDuration += clock.Now().Sub(start)
+			diag.Attempts++
+			start = clock.Now()
+		}
+		if err != nil {
+			release()
+			span.End(err)
+			return nil, fmt.Errorf("dial %s: %w", target, err)
+		}
+		var p peer.Peer
+		respMsg, err := grpcdynamic.NewStub(channel).InvokeRpc(attemptCtx, md, reqMsg, grpc.Peer(&p))
+		release()
+		if p.Addr != nil {
+			recordPeer(ctx, p.Addr.String())
+		}
+		if diag != nil {
+			diag.InvokeDuration += clock.Now().Sub(start)
+			if p.Addr != nil {
+				diag.Peer = p.Addr.String()
+			}
+		}
+		span.End(err)
+		if err == nil {
+			return respMsg, nil
+		}
+		kind, churn := classifyChurn(err)
+		if !churn || conn == nil {
+			return nil, fmt.Errorf("invoke rpc: %w", err)
+		}
+
+		label := inv.conns.label(target)
+		inv.metrics.Add("gateway_upstream_churn_total", 1, "target", label, "kind", kind)
+		reconnect := inv.conns.evict(target, conn, clock)
+		inv.churn.record(label, func(st *ChurnStats) {
+			if kind == churnGoAway {
+				st.GoAways++
+			} else {
+				st.Resets++
+			}
+			if reconnect {
+				st.Reconnects++
+			}
+		})
+		if attempt >= maxChurnRetries || !retrySafe(md) {
+			return nil, fmt.Errorf("invoke rpc: %w", err)
+		}
+
+		inv.metrics.Add("gateway_upstream_churn_retries_total", 1, "target", label)
+		inv.churn.record(label, func(st *ChurnStats) { st.Retries++ })
+		if err := Sleep(ctx, clock, churnBackoff.Delay(attempt, RandFromContext(ctx, inv.rand))); err != nil {
+			return nil, fmt.Errorf("invoke rpc: %w", err)
+		}
 	}
+}
+
+// responseTooLarge reports whether err is the client-side rejection of a response over the receive limit.
+func responseTooLarge(err error) bool {
+	st, ok := status.FromError(err)
+	return ok && st.Code() == codes.ResourceExhausted && strings.Contains(st.Message(), "received message larger than max")
+}
 
-	return MessageToJSON(respMsg)
+// retrySafe reports whether md may be re-sent after a connection failure without risking duplicate side effects,
+// i.e. it is declared with option idempotency_level = NO_SIDE_EFFECTS or IDEMPOTENT.
+func retrySafe(md *desc.MethodDescriptor) bool {
+	switch md.GetMethodOptions().GetIdempotencyLevel() {
+	case descriptorpb.MethodOptions_NO_SIDE_EFFECTS, descriptorpb.MethodOptions_IDEMPOTENT:
+		return true
+	}
+	return false
+}
+
+// ChurnStats returns per-target counters of upstream connection churn. Unconfigured targets beyond the first
+// 100 seen are counted together under "other".
+func (inv *Invoker) ChurnStats() map[string]ChurnStats {
+	return inv.churn.snapshot()
+}
+
+// Close waits for in-flight shadow calls, then closes all pooled upstream connections.
+func (inv *Invoker) Close() error {
+	if inv.health != nil {
+		inv.health.close()
+	}
+	inv.shadowWG.Wait()
+	inv.conns.closeAll()
+	return nil
 }
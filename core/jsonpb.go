@@ -13,9 +13,15 @@ var jsonpbMarshaler = &jsonpb.Marshaler{EmitDefaults: true}
 
 // JSONToMessage converts JSON request body to a dynamic.Message of the method's input type (compatible with grpcdynamic proto.Message).
 func JSONToMessage(method *desc.MethodDescriptor, jsonBody []byte) (proto.Message, error) {
-	msgDesc := method.GetInputType()
-	msg := dynamic.NewMessage(msgDesc)
-	if err := jsonpb.Unmarshal(bytes.NewReader(jsonBody), msg); err != nil {
+	return jsonToMessage(method, jsonBody, nil, false)
+}
+
+// jsonToMessage is JSONToMessage with resolver for google.protobuf.Any fields (nil: the method's own file and linked-in types),
+// ignoring unknown fields if allowUnknown.
+func jsonToMessage(method *desc.MethodDescriptor, jsonBody []byte, resolver jsonpb.AnyResolver, allowUnknown bool) (proto.Message, error) {
+	msg := dynamic.NewMessage(method.GetInputType())
+	u := &jsonpb.Unmarshaler{AnyResolver: resolver, AllowUnknownFields: allowUnknown}
+	if err := u.Unmarshal(bytes.NewReader(jsonBody), msg); err != nil {
 		return nil, err
 	}
 	return msg, nil
@@ -23,9 +29,17 @@ func JSONToMessage(method *desc.MethodDescriptor, jsonBody []byte) (proto.Messag
 
 // MessageToJSON converts gRPC response proto message to JSON.
 func MessageToJSON(msg proto.Message) ([]byte, error) {
-	var buf bytes.Buffer
-	if err := jsonpbMarshaler.Marshal(&buf, msg); err != nil {
+	return messageToJSON(msg, nil)
+}
+
+// messageToJSON is MessageToJSON with resolver for google.protobuf.Any fields.
+func messageToJSON(msg proto.Message, resolver jsonpb.AnyResolver) ([]byte, error) {
+	m := *jsonpbMarshaler
+	m.AnyResolver = resolver
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	if err := m.Marshal(buf, msg); err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return bytes.Clone(buf.Bytes()), nil
 }
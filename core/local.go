@@ -0,0 +1,65 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// LocalTarget is the target that calls the in-process server set with WithLocalServer.
+const LocalTarget = "local"
+
+// localBufferSize is the size of the in-memory pipe between the gateway and the local server.
+const localBufferSize = 1 << 20
+
+// WithLocalServer serves srv on an in-memory listener and routes calls to LocalTarget to it, without TCP.
+// srv may also be serving on other listeners. Methods of its services registered from generated code are
+// resolved from the compiled-in descriptors, so they need no descriptor files.
+func WithLocalServer(srv *grpc.Server) InvokerOption {
+	return func(inv *Invoker) {
+		lis := bufconn.Listen(localBufferSize)
+		go func() { _ = srv.Serve(lis) }()
+		inv.local = srv
+		inv.conns.local = lis
+	}
+}
+
+// dialLocal dials the in-memory listener of the local server.
+func dialLocal(lis *bufconn.Listener) grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})
+}
+
+// resolveLocal finds fullMethodName among the services registered on the local server.
+func (inv *Invoker) resolveLocal(fullMethodName string) (*desc.MethodDescriptor, error) {
+	serviceName, methodName, err := ParseFullMethodName(fullMethodName)
+	if err != nil {
+		return nil, err
+	}
+	info, ok := inv.local.GetServiceInfo()[serviceName]
+	if !ok {
+		return nil, fmt.Errorf("service %s is not registered on the local server", serviceName)
+	}
+	file, ok := info.Metadata.(string)
+	if !ok {
+		return nil, fmt.Errorf("service %s on the local server has no descriptor", serviceName)
+	}
+	fd, err := desc.LoadFileDescriptor(file)
+	if err != nil {
+		return nil, fmt.Errorf("load descriptor of %s: %w", serviceName, err)
+	}
+	sd := fd.FindService(serviceName)
+	if sd == nil {
+		return nil, fmt.Errorf("service %s not found in %s", serviceName, file)
+	}
+	md := sd.FindMethodByName(methodName)
+	if md == nil {
+		return nil, fmt.Errorf("method %s not found on the local server", fullMethodName)
+	}
+	return md, nil
+}
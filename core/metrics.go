@@ -0,0 +1,83 @@
+package core
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics receives gateway counters and gauges. Implementations adapt it to Prometheus, expvar, StatsD, etc.
+// labels are alternating key/value pairs, e.g. Add("gateway_calls_total", 1, "target", "host:port").
+type Metrics interface {
+	// Add increments the counter name by delta.
+	Add(name string, delta float64, labels ...string)
+	// Set sets the gauge name to value.
+	Set(name string, value float64, labels ...string)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Add(string, float64, ...string) {}
+func (nopMetrics) Set(string, float64, ...string) {}
+
+// NopMetrics returns a Metrics that discards everything.
+func NopMetrics() Metrics { return nopMetrics{} }
+
+// MemoryMetrics is an in-memory Metrics implementation, useful for tests and simple admin endpoints.
+type MemoryMetrics struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewMemoryMetrics returns an empty MemoryMetrics.
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{values: make(map[string]float64)}
+}
+
+// Add implements Metrics.
+func (m *MemoryMetrics) Add(name string, delta float64, labels ...string) {
+	key := MetricKey(name, labels...)
+	m.mu.Lock()
+	m.values[key] += delta
+	m.mu.Unlock()
+}
+
+// Set implements Metrics.
+func (m *MemoryMetrics) Set(name string, value float64, labels ...string) {
+	key := MetricKey(name, labels...)
+	m.mu.Lock()
+	m.values[key] = value
+	m.mu.Unlock()
+}
+
+// Get returns the current value for name and labels.
+func (m *MemoryMetrics) Get(name string, labels ...string) float64 {
+	key := MetricKey(name, labels...)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.values[key]
+}
+
+// Snapshot returns a copy of all values keyed by MetricKey.
+func (m *MemoryMetrics) Snapshot() map[string]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]float64, len(m.values))
+	for k, v := range m.values {
+		out[k] = v
+	}
+	return out
+}
+
+// MetricKey formats name and labels as `name{k1="v1",k2="v2"}` with labels sorted by key.
+func MetricKey(name string, labels ...string) string {
+	if len(labels) < 2 {
+		return name
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"=\""+labels[i+1]+"\"")
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,240 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// OpenAPIInfo carries the document-level fields of a generated OpenAPI spec.
+type OpenAPIInfo struct {
+	Title   string // default "gRPC gateway"
+	Version string // default "1.0.0"
+	// ServerURL is the base URL that method paths are relative to, usually the gateway path (e.g. "/grpc-gateway").
+	ServerURL string
+	// TargetRequired documents the X-Gateway-Target header as required (no default target configured).
+	TargetRequired bool
+	// Int64Encoding documents 64-bit integers as integers rather than strings for Int64Numbers.
+	Int64Encoding Int64Encoding
+}
+
+// OpenAPI renders an OpenAPI 3 document with one POST operation per unary method, at path
+// "/{package.Service}/{Method}" relative to info.ServerURL. Request and response schemas follow
+// the proto3 JSON mapping of the method's input and output messages. Comments of services, methods,
+// messages and fields become descriptions when the descriptors carry source code info (see Comments).
+func OpenAPI(services []*desc.ServiceDescriptor, info OpenAPIInfo) ([]byte, error) {
+	if info.Title == "" {
+		info.Title = "gRPC gateway"
+	}
+	if info.Version == "" {
+		info.Version = "1.0.0"
+	}
+
+	g := &openAPIGen{numbers: info.Int64Encoding == Int64Numbers, schemas: map[string]any{
+		"gateway.Error": map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"error": map[string]any{"type": "string"}},
+		},
+	}}
+	paths := map[string]any{}
+	var tags []any
+	for _, svc := range services {
+		if c := Comments(svc); c != "" {
+			tags = append(tags, map[string]any{"name": svc.GetFullyQualifiedName(), "description": c})
+		}
+		for _, m := range svc.GetMethods() {
+			if m.IsServerStreaming() {
+				continue
+			}
+			full := "/" + svc.GetFullyQualifiedName() + "/" + m.GetName()
+			paths[full] = map[string]any{"post": g.operation(svc, m, info)}
+		}
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   info.Title,
+			"version": info.Version,
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": g.schemas},
+	}
+	if len(tags) > 0 {
+		doc["tags"] = tags
+	}
+	if info.ServerURL != "" {
+		doc["servers"] = []any{map[string]any{"url": info.ServerURL}}
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+type openAPIGen struct {
+	schemas map[string]any
+	numbers bool // 64-bit integers are JSON numbers
+}
+
+func (g *openAPIGen) operation(svc *desc.ServiceDescriptor, m *desc.MethodDescriptor, info OpenAPIInfo) map[string]any {
+	input := g.messageSchema(m.GetInputType())
+	if m.IsClientStreaming() {
+		// One stream message per element, see Invoker.Invoke.
+		input = map[string]any{"type": "array", "items": input}
+	}
+	op := map[string]any{
+		"operationId": svc.GetFullyQualifiedName() + "." + m.GetName(),
+		"tags":        []string{svc.GetFullyQualifiedName()},
+		"parameters": []any{map[string]any{
+			"name":        "X-Gateway-Target",
+			"in":          "header",
+			"required":    info.TargetRequired,
+			"description": "gRPC target address (host:port)",
+			"schema":      map[string]any{"type": "string"},
+		}},
+		"requestBody": map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": input},
+			},
+		},
+		"responses": map[string]any{
+			"200": map[string]any{
+				"description": "OK",
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": g.messageSchema(m.GetOutputType())},
+				},
+			},
+			"default": map[string]any{
+				"description": "Gateway or upstream error",
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/gateway.Error"}},
+				},
+			},
+		},
+		"x-grpc-full-method": "/" + svc.GetFullyQualifiedName() + "/" + m.GetName(),
+	}
+	if c := Comments(m); c != "" {
+		summary, _, _ := strings.Cut(c, "\n")
+		op["summary"] = summary
+		op["description"] = c
+	}
+	if m.GetMethodOptions().GetDeprecated() {
+		op["deprecated"] = true
+	}
+	return op
+}
+
+// wellKnownSchemas maps google.protobuf types to their proto3 JSON representation.
+var wellKnownSchemas = map[string]map[string]any{
+	"google.protobuf.Timestamp":   {"type": "string", "format": "date-time"},
+	"google.protobuf.Duration":    {"type": "string", "example": "1.5s"},
+	"google.protobuf.FieldMask":   {"type": "string", "example": "a.b,c"},
+	"google.protobuf.Struct":      {"type": "object", "additionalProperties": true},
+	"google.protobuf.Value":       {},
+	"google.protobuf.ListValue":   {"type": "array", "items": map[string]any{}},
+	"google.protobuf.Empty":       {"type": "object"},
+	"google.protobuf.Any":         {"type": "object", "properties": map[string]any{"@type": map[string]any{"type": "string"}}, "additionalProperties": true},
+	"google.protobuf.DoubleValue": {"type": "number", "format": "double", "nullable": true},
+	"google.protobuf.FloatValue":  {"type": "number", "format": "float", "nullable": true},
+	"google.protobuf.Int32Value":  {"type": "integer", "format": "int32", "nullable": true},
+	"google.protobuf.UInt32Value": {"type": "integer", "format": "int64", "nullable": true},
+	"google.protobuf.Int64Value":  {"type": "string", "format": "int64", "nullable": true},
+	"google.protobuf.UInt64Value": {"type": "string", "format": "uint64", "nullable": true},
+	"google.protobuf.BoolValue":   {"type": "boolean", "nullable": true},
+	"google.protobuf.StringValue": {"type": "string", "nullable": true},
+	"google.protobuf.BytesValue":  {"type": "string", "format": "byte", "nullable": true},
+}
+
+// messageSchema returns a schema (usually a $ref) for md, registering component schemas as needed.
+func (g *openAPIGen) messageSchema(md *desc.MessageDescriptor) map[string]any {
+	fqn := md.GetFullyQualifiedName()
+	if g.numbers && (fqn == "google.protobuf.Int64Value" || fqn == "google.protobuf.UInt64Value") {
+		return map[string]any{"type": "integer", "format": "int64", "nullable": true}
+	}
+	if s, ok := wellKnownSchemas[fqn]; ok {
+		return s
+	}
+	ref := map[string]any{"$ref": "#/components/schemas/" + fqn}
+	if _, ok := g.schemas[fqn]; ok {
+		return ref
+	}
+	props := map[string]any{}
+	schema := map[string]any{"type": "object", "properties": props}
+	if c := Comments(md); c != "" {
+		schema["description"] = c
+	}
+	g.schemas[fqn] = schema // register before recursing so self-references terminate
+	for _, f := range md.GetFields() {
+		props[f.GetJSONName()] = describe(g.fieldSchema(f), Comments(f))
+	}
+	return ref
+}
+
+// describe returns schema s with description c, leaving s itself unchanged since it may be shared. References
+// are wrapped in allOf, as OpenAPI 3.0 ignores the siblings of $ref.
+func describe(s map[string]any, c string) map[string]any {
+	if c == "" {
+		return s
+	}
+	if _, ok := s["$ref"]; ok {
+		return map[string]any{"allOf": []any{s}, "description": c}
+	}
+	out := make(map[string]any, len(s)+1)
+	for k, v := range s {
+		out[k] = v
+	}
+	out["description"] = c
+	return out
+}
+
+func (g *openAPIGen) fieldSchema(f *desc.FieldDescriptor) map[string]any {
+	if f.IsMap() {
+		return map[string]any{"type": "object", "additionalProperties": g.singularSchema(f.GetMapValueType())}
+	}
+	s := g.singularSchema(f)
+	if f.IsRepeated() {
+		return map[string]any{"type": "array", "items": s}
+	}
+	return s
+}
+
+func (g *openAPIGen) singularSchema(f *desc.FieldDescriptor) map[string]any {
+	switch f.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		return map[string]any{"type": "number", "format": "double"}
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT:
+		return map[string]any{"type": "number", "format": "float"}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_TYPE_FIXED32:
+		return map[string]any{"type": "integer", "format": "int64", "minimum": 0}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT64, descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED64:
+		if g.numbers {
+			return map[string]any{"type": "integer", "format": "int64"}
+		}
+		return map[string]any{"type": "string", "format": "int64"}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT64, descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		if g.numbers {
+			return map[string]any{"type": "integer", "format": "int64", "minimum": 0}
+		}
+		return map[string]any{"type": "string", "format": "uint64"}
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return map[string]any{"type": "boolean"}
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return map[string]any{"type": "string"}
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		return map[string]any{"type": "string", "format": "byte"}
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		var names []string
+		for _, v := range f.GetEnumType().GetValues() {
+			names = append(names, v.GetName())
+		}
+		return map[string]any{"type": "string", "enum": names}
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_GROUP:
+		return g.messageSchema(f.GetMessageType())
+	}
+	return map[string]any{}
+}
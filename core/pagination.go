@@ -0,0 +1,89 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ErrNotPaginated is returned by Invoke for InvokeRequest.FetchAllPages on a method that does not follow
+// AIP-158 pagination.
+var ErrNotPaginated = errors.New("method is not paginated")
+
+// pagination holds the AIP-158 fields of a list method.
+type pagination struct {
+	pageToken     *desc.FieldDescriptor // string page_token of the request
+	nextPageToken *desc.FieldDescriptor // string next_page_token of the response
+	items         *desc.FieldDescriptor // the first repeated field of the response
+}
+
+// paginationOf returns the pagination fields of md, or ErrNotPaginated.
+func paginationOf(md *desc.MethodDescriptor) (*pagination, error) {
+	p := &pagination{
+		pageToken:     md.GetInputType().FindFieldByName("page_token"),
+		nextPageToken: md.GetOutputType().FindFieldByName("next_page_token"),
+	}
+	for _, fd := range md.GetOutputType().GetFields() {
+		if fd.IsRepeated() && !fd.IsMap() {
+			p.items = fd
+			break
+		}
+	}
+	isString := func(fd *desc.FieldDescriptor) bool {
+		return fd != nil && !fd.IsRepeated() && fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_STRING
+	}
+	if !isString(p.pageToken) || !isString(p.nextPageToken) || p.items == nil {
+		return nil, fmt.Errorf("%w: %s needs a page_token request field, a next_page_token response field and a repeated response field",
+			ErrNotPaginated, md.GetFullyQualifiedName())
+	}
+	return p, nil
+}
+
+// fetchAll follows the next_page_token of first, the response to reqMsg, calling call for at most maxPages
+// pages in all, and returns first with the items of every page. Its next_page_token is that of the last page
+// fetched, empty unless maxPages cut the listing short.
+func (p *pagination) fetchAll(first proto.Message, reqMsg proto.Message, maxPages int, call func(proto.Message) (proto.Message, error)) (proto.Message, int, error) {
+	merged, err := dynamic.AsDynamicMessage(first)
+	if err != nil {
+		return nil, 0, err
+	}
+	merged = proto.Clone(merged).(*dynamic.Message) // first may be shared with coalesced callers
+	pages := 1
+	for ; pages < maxPages; pages++ {
+		token, _ := merged.GetField(p.nextPageToken).(string)
+		if token == "" {
+			break
+		}
+		next, err := dynamic.AsDynamicMessage(reqMsg)
+		if err != nil {
+			return nil, pages, err
+		}
+		next = proto.Clone(next).(*dynamic.Message)
+		if err := next.TrySetField(p.pageToken, token); err != nil {
+			return nil, pages, err
+		}
+		resp, err := call(next)
+		if err != nil {
+			return nil, pages, err
+		}
+		page, err := dynamic.AsDynamicMessage(resp)
+		if err != nil {
+			return nil, pages, err
+		}
+		for i := 0; i < page.FieldLength(p.items); i++ {
+			if err := merged.TryAddRepeatedField(p.items, page.GetRepeatedField(p.items, i)); err != nil {
+				return nil, pages, err
+			}
+		}
+		if token, _ := page.GetField(p.nextPageToken).(string); token != "" {
+			merged.SetField(p.nextPageToken, token)
+		} else {
+			merged.ClearField(p.nextPageToken)
+		}
+	}
+	return merged, pages, nil
+}
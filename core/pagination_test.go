@@ -0,0 +1,90 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+func listMethod(t *testing.T) *desc.MethodDescriptor {
+	t.Helper()
+	book := builder.NewMessage("Book").AddField(builder.NewField("title", builder.FieldTypeString()))
+	req := builder.NewMessage("ListBooksRequest").
+		AddField(builder.NewField("page_size", builder.FieldTypeInt32())).
+		AddField(builder.NewField("page_token", builder.FieldTypeString()))
+	resp := builder.NewMessage("ListBooksResponse").
+		AddField(builder.NewField("books", builder.FieldTypeMessage(book)).SetRepeated()).
+		AddField(builder.NewField("next_page_token", builder.FieldTypeString()))
+	svc := builder.NewService("Library").
+		AddMethod(builder.NewMethod("ListBooks", builder.RpcTypeMessage(req, false), builder.RpcTypeMessage(resp, false))).
+		AddMethod(builder.NewMethod("GetBook", builder.RpcTypeMessage(req, false), builder.RpcTypeMessage(book, false)))
+	fd, err := builder.NewFile("acme/library.proto").SetPackageName("acme").
+		AddMessage(book).AddMessage(req).AddMessage(resp).AddService(svc).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	return fd.FindService("acme.Library").FindMethodByName("ListBooks")
+}
+
+func TestPagination_FetchAll(t *testing.T) {
+	md := listMethod(t)
+	p, err := paginationOf(md)
+	if err != nil {
+		t.Fatalf("paginationOf: %v", err)
+	}
+	// Three pages of two books each.
+	page := func(token string) proto.Message {
+		n := 0
+		fmt.Sscanf(token, "p%d", &n)
+		msg := dynamic.NewMessage(md.GetOutputType())
+		for i := 0; i < 2; i++ {
+			book := dynamic.NewMessage(p.items.GetMessageType())
+			book.SetFieldByName("title", fmt.Sprintf("book %d", 2*n+i))
+			msg.AddRepeatedField(p.items, book)
+		}
+		if n < 2 {
+			msg.SetField(p.nextPageToken, fmt.Sprintf("p%d", n+1))
+		}
+		return msg
+	}
+	var tokens []string
+	call := func(req proto.Message) (proto.Message, error) {
+		token := req.(*dynamic.Message).GetField(p.pageToken).(string)
+		tokens = append(tokens, token)
+		return page(token), nil
+	}
+	reqMsg := dynamic.NewMessage(md.GetInputType())
+	reqMsg.SetFieldByName("page_size", int32(2))
+
+	first := page("")
+	got, n, err := p.fetchAll(first, reqMsg, 10, call)
+	if err != nil {
+		t.Fatalf("fetchAll: %v", err)
+	}
+	js, _ := got.(*dynamic.Message).MarshalJSON()
+	want := `{"books":[{"title":"book 0"},{"title":"book 1"},{"title":"book 2"},{"title":"book 3"},{"title":"book 4"},{"title":"book 5"}]}`
+	if string(js) != want || n != 3 || fmt.Sprint(tokens) != "[p1 p2]" {
+		t.Fatalf("got %s after %d pages (tokens %v)", js, n, tokens)
+	}
+	if first.(*dynamic.Message).FieldLength(p.items) != 2 {
+		t.Fatal("first response modified")
+	}
+	if reqMsg.GetField(p.pageToken) != "" {
+		t.Fatal("request modified")
+	}
+
+	// The cap leaves the token of the remaining pages.
+	got, n, _ = p.fetchAll(page(""), reqMsg, 2, call)
+	if js, _ := got.(*dynamic.Message).MarshalJSON(); n != 2 || string(js) != `{"books":[{"title":"book 0"},{"title":"book 1"},{"title":"book 2"},{"title":"book 3"}],"nextPageToken":"p2"}` {
+		t.Fatalf("capped: got %s after %d pages", js, n)
+	}
+
+	if _, err := paginationOf(md.GetService().FindMethodByName("GetBook")); !errors.Is(err, ErrNotPaginated) {
+		t.Fatalf("GetBook: got %v, want ErrNotPaginated", err)
+	}
+}
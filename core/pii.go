@@ -0,0 +1,134 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// PIIOption is the field number of the gateway.pii field option (see proto/gateway/options.proto), which
+// tags fields holding personal data:
+//
+//	string email = 3 [(gateway.pii) = true];
+//
+// PII fields are redacted by RedactJSON, and the gateway can require encryption for requests that set them
+// or hide them in responses (see FieldVisibility.PIIRule).
+const PIIOption = 50753
+
+// IsPII reports whether fd is tagged with the gateway.pii option.
+func IsPII(fd *desc.FieldDescriptor) bool {
+	return boolFieldOption(fd, PIIOption)
+}
+
+// PIIFields returns the sorted dotted JSON paths of the PII fields that body, a JSON-encoded md message,
+// sets: the fields tagged with the gateway.pii option (at any depth, including repeated and map values) and
+// the fields at paths, which apply to every element of arrays along the way. Nulls and default values (empty
+// strings, zeros, false, empty lists and maps) do not count.
+func PIIFields(md *desc.MessageDescriptor, body []byte, paths []string) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	findPII(md, v, "", found)
+	for _, p := range paths {
+		if hasPath(v, strings.Split(p, ".")) {
+			found[p] = true
+		}
+	}
+	out := make([]string, 0, len(found))
+	for p := range found {
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// findPII adds the paths of the set PII fields of the md-typed JSON object v, under prefix, to found.
+func findPII(md *desc.MessageDescriptor, v any, prefix string, found map[string]bool) {
+	obj, ok := v.(map[string]any)
+	if !ok || md == nil || isCoercedWKT(md.GetFullyQualifiedName()) {
+		return
+	}
+	for _, f := range md.GetFields() {
+		name := f.GetJSONName()
+		val, ok := obj[name]
+		if !ok {
+			if val, ok = obj[f.GetName()]; !ok {
+				continue
+			}
+			name = f.GetName()
+		}
+		if isZeroJSON(val) {
+			continue
+		}
+		if IsPII(f) {
+			found[prefix+name] = true
+			continue
+		}
+		switch {
+		case f.IsMap():
+			if vt := f.GetMapValueType(); vt.GetMessageType() != nil {
+				if m, ok := val.(map[string]any); ok {
+					for _, e := range m {
+						findPII(vt.GetMessageType(), e, prefix+name+".", found)
+					}
+				}
+			}
+		case f.GetMessageType() != nil:
+			if f.IsRepeated() {
+				if list, ok := val.([]any); ok {
+					for _, e := range list {
+						findPII(f.GetMessageType(), e, prefix+name+".", found)
+					}
+				}
+				continue
+			}
+			findPII(f.GetMessageType(), val, prefix+name+".", found)
+		}
+	}
+}
+
+// hasPath reports whether v sets the field at path, descending through objects and arrays.
+func hasPath(v any, path []string) bool {
+	switch x := v.(type) {
+	case []any:
+		for _, e := range x {
+			if hasPath(e, path) {
+				return true
+			}
+		}
+	case map[string]any:
+		next, ok := x[path[0]]
+		if !ok || isZeroJSON(next) {
+			return false
+		}
+		return len(path) == 1 || hasPath(next, path[1:])
+	}
+	return false
+}
+
+// isZeroJSON reports whether v, a JSON value decoded with UseNumber, is null or a proto3 default value.
+func isZeroJSON(v any) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case string:
+		return x == ""
+	case bool:
+		return !x
+	case json.Number:
+		f, err := x.Float64()
+		return err == nil && f == 0
+	case []any:
+		return len(x) == 0
+	case map[string]any:
+		return len(x) == 0
+	}
+	return false
+}
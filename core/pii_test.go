@@ -0,0 +1,55 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// piiOption returns field options carrying gateway.pii = true, as protoc would encode it.
+func piiOption() *descriptorpb.FieldOptions {
+	opts := &descriptorpb.FieldOptions{}
+	b := protowire.AppendTag(nil, PIIOption, protowire.VarintType)
+	opts.ProtoReflect().SetUnknown(protowire.AppendVarint(b, 1))
+	return opts
+}
+
+func TestPIIFields(t *testing.T) {
+	contact := builder.NewMessage("Contact").
+		AddField(builder.NewField("email", builder.FieldTypeString()).SetOptions(piiOption())).
+		AddField(builder.NewField("kind", builder.FieldTypeString()))
+	user := builder.NewMessage("User").
+		AddField(builder.NewField("name", builder.FieldTypeString())).
+		AddField(builder.NewField("contacts", builder.FieldTypeMessage(contact)).SetRepeated()).
+		AddField(builder.NewField("birth_date", builder.FieldTypeString())).
+		AddField(builder.NewField("tax_id", builder.FieldTypeString()).SetOptions(piiOption()))
+	fd, err := builder.NewFile("acme/user.proto").SetPackageName("acme").AddMessage(contact).AddMessage(user).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	md := fd.FindMessage("acme.User")
+	if !IsPII(md.FindFieldByName("tax_id")) || IsPII(md.FindFieldByName("name")) {
+		t.Fatal("IsPII")
+	}
+
+	body := []byte(`{"name":"ada","contacts":[{"kind":"work"},{"email":"a@b.c"}],"birthDate":"1815-12-10","taxId":null}`)
+	got, err := PIIFields(md, body, []string{"birthDate", "missing"})
+	if err != nil {
+		t.Fatalf("pii fields: %v", err)
+	}
+	if want := []string{"birthDate", "contacts.email"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// PII fields are redacted like debug_redact fields.
+	redacted, err := RedactJSON(md, body, nil)
+	if err != nil {
+		t.Fatalf("redact: %v", err)
+	}
+	if want := `{"birthDate":"1815-12-10","contacts":[{"kind":"work"},{"email":"[REDACTED]"}],"name":"ada","taxId":"[REDACTED]"}`; string(redacted) != want {
+		t.Fatalf("got  %s\nwant %s", redacted, want)
+	}
+}
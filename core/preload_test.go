@@ -0,0 +1,44 @@
+package core
+
+import "testing"
+
+func TestInvoker_PreloadDescriptors(t *testing.T) {
+	set := usersDescriptorSet(t)
+
+	metrics := NewMemoryMetrics()
+	inv := NewInvoker(WithDescriptorDir(t.TempDir()), WithMetrics(metrics))
+	defer inv.Close()
+	if _, err := inv.PreloadDescriptors(set, []byte("garbage")); err == nil {
+		t.Fatal("invalid set preloaded")
+	}
+	if _, err := inv.resolver.Resolve("/acme.Users/Get"); err == nil {
+		t.Fatal("failed preload indexed methods")
+	}
+
+	n, err := inv.PreloadDescriptors(set)
+	if err != nil || n != 1 {
+		t.Fatalf("preload: n=%d err=%v", n, err)
+	}
+	md, err := inv.resolver.Resolve("/acme.Users/Get")
+	if err != nil || md.GetFullyQualifiedName() != "acme.Users.Get" {
+		t.Fatalf("resolve: %v %v", md, err)
+	}
+	if got := metrics.Get("gateway_descriptor_preloaded_methods"); got != 1 {
+		t.Fatalf("preloaded methods metric = %v", got)
+	}
+	var found bool
+	for _, s := range inv.Services("") {
+		found = found || s.GetFullyQualifiedName() == "acme.Users"
+	}
+	if !found {
+		t.Fatal("preloaded service not listed")
+	}
+
+	// Flushing the method cache keeps preloaded methods.
+	if n := inv.FlushMethods(); n != 0 {
+		t.Fatalf("flushed %d preloaded methods", n)
+	}
+	if _, err := inv.resolver.Resolve("/acme.Users/Get"); err != nil {
+		t.Fatalf("resolve after flush: %v", err)
+	}
+}
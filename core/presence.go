@@ -0,0 +1,99 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+)
+
+// FieldPresence selects how the response fields with presence that the upstream left unset (message and
+// wrapper fields, proto3 optional fields and oneof members) appear in JSON. Fields without presence always
+// appear, with their default value if unset.
+type FieldPresence string
+
+const (
+	// FieldPresenceDefault renders unset message and wrapper fields as null and omits unset optional fields
+	// and oneof members.
+	FieldPresenceDefault FieldPresence = ""
+	// FieldPresenceOmit omits all unset fields with presence, so every field with presence in the JSON was
+	// set, if only to its default value.
+	FieldPresenceOmit FieldPresence = "omit"
+	// FieldPresenceNull renders all unset fields with presence as null, except oneof members other than
+	// proto3 optional fields, which stay omitted.
+	FieldPresenceNull FieldPresence = "null"
+)
+
+// applyPresence re-renders the unset fields with presence of body, msg marshalled to JSON, for p.
+func (p FieldPresence) applyPresence(msg proto.Message, body []byte) ([]byte, error) {
+	if p == FieldPresenceDefault {
+		return body, nil
+	}
+	dm, err := dynamic.AsDynamicMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return rewriteJSON(body, func(v any) any { return p.walk(dm, v) })
+}
+
+// walk re-renders the unset fields with presence within v, the JSON value of msg.
+func (p FieldPresence) walk(msg *dynamic.Message, v any) any {
+	obj, ok := v.(map[string]any)
+	if !ok || strings.HasPrefix(msg.GetMessageDescriptor().GetFullyQualifiedName(), "google.protobuf.") {
+		return v // well-known types have JSON forms of their own
+	}
+	for _, fd := range msg.GetMessageDescriptor().GetFields() {
+		name := fd.GetJSONName()
+		if !msg.HasField(fd) {
+			switch {
+			case !fd.HasPresence():
+			case p == FieldPresenceOmit:
+				delete(obj, name)
+			case fd.GetOneOf() == nil || fd.IsProto3Optional():
+				obj[name] = nil
+			}
+			continue
+		}
+		if fd.GetMessageType() == nil {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			entries, _ := obj[name].(map[string]any)
+			msg.ForEachMapFieldEntry(fd, func(key, val any) bool {
+				if k := fmt.Sprint(key); entries[k] != nil {
+					entries[k] = p.walkField(fd.GetMapValueType(), val, entries[k])
+				}
+				return true
+			})
+		case fd.IsRepeated():
+			items, _ := obj[name].([]any)
+			for i := range items {
+				if i < msg.FieldLength(fd) {
+					items[i] = p.walkField(fd, msg.GetRepeatedField(fd, i), items[i])
+				}
+			}
+		default:
+			obj[name] = p.walkField(fd, msg.GetField(fd), obj[name])
+		}
+	}
+	return obj
+}
+
+// walkField walks v, the JSON value of val, a value of the message field fd.
+func (p FieldPresence) walkField(fd *desc.FieldDescriptor, val, v any) any {
+	if fd.GetMessageType() == nil {
+		return v
+	}
+	m, ok := val.(proto.Message)
+	if !ok {
+		return v
+	}
+	dm, err := dynamic.AsDynamicMessage(m)
+	if err != nil {
+		return v
+	}
+	return p.walk(dm, v)
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/dynamic"
+	_ "google.golang.org/protobuf/types/known/wrapperspb" // registers the well-known types
+)
+
+func TestFieldPresence(t *testing.T) {
+	wrapper, err := desc.LoadMessageDescriptor("google.protobuf.Int32Value")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	item := builder.NewMessage("Item").
+		AddField(builder.NewField("count", builder.FieldTypeInt32()).SetProto3Optional(true))
+	msg := builder.NewMessage("Profile").
+		AddField(builder.NewField("nickname", builder.FieldTypeString()).SetProto3Optional(true)).
+		AddField(builder.NewField("age", builder.FieldTypeInt32())).
+		AddField(builder.NewField("limit", builder.FieldTypeImportedMessage(wrapper))).
+		AddField(builder.NewField("item", builder.FieldTypeMessage(item))).
+		AddField(builder.NewField("items", builder.FieldTypeMessage(item)).SetRepeated()).
+		AddOneOf(builder.NewOneOf("contact").
+			AddChoice(builder.NewField("email", builder.FieldTypeString())).
+			AddChoice(builder.NewField("phone", builder.FieldTypeString())))
+	fd, err := builder.NewFile("acme/profile.proto").SetProto3(true).SetPackageName("acme").AddMessage(item).AddMessage(msg).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	md := fd.FindMessage("acme.Profile")
+
+	m := dynamic.NewMessage(md)
+	zero := dynamic.NewMessage(fd.FindMessage("acme.Item"))
+	zero.SetFieldByName("count", int32(0))
+	m.SetFieldByName("items", []any{dynamic.NewMessage(fd.FindMessage("acme.Item")), zero})
+	m.SetFieldByName("email", "")
+
+	for _, tc := range []struct {
+		presence FieldPresence
+		want     string
+	}{
+		{FieldPresenceDefault, `{"age":0,"limit":null,"item":null,"items":[{},{"count":0}],"email":""}`},
+		{FieldPresenceOmit, `{"age":0,"email":"","items":[{},{"count":0}]}`},
+		{FieldPresenceNull, `{"age":0,"email":"","item":null,"items":[{"count":null},{"count":0}],"limit":null,"nickname":null}`},
+	} {
+		body, err := messageToJSON(m, nil)
+		if err == nil {
+			body, err = tc.presence.applyPresence(m, body)
+		}
+		if err != nil || string(body) != tc.want {
+			t.Errorf("%q: %s, %v; want %s", tc.presence, body, err, tc.want)
+		}
+	}
+}
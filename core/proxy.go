@@ -0,0 +1,147 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// ProxyDirect as TargetConfig.Proxy dials the target directly, bypassing the proxy of WithProxy.
+const ProxyDirect = "direct"
+
+// WithProxy dials the upstream connections of targets whose TargetConfig has no Proxy of its own through
+// the forward proxy at proxyURL, see TargetConfig.Proxy.
+func WithProxy(proxyURL string) InvokerOption {
+	return func(inv *Invoker) {
+		inv.conns.proxy = proxyURL
+	}
+}
+
+// ParseProxyURL parses a TargetConfig.Proxy URL: http://host:port for HTTP CONNECT proxies, or
+// socks5://host:port for SOCKS5 proxies, both with optional user:password@ credentials.
+func ParseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "socks5":
+	default:
+		return nil, fmt.Errorf("proxy %s: scheme must be http or socks5", u.Redacted())
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy %s: missing host", u.Redacted())
+	}
+	return u, nil
+}
+
+// proxyDialer returns the dial function of connections through the proxy at raw.
+func proxyDialer(raw string) (func(ctx context.Context, addr string) (net.Conn, error), error) {
+	u, err := ParseProxyURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "http" {
+		return func(ctx context.Context, addr string) (net.Conn, error) { return dialConnect(ctx, u, addr) }, nil
+	}
+	var auth *proxy.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: password}
+	}
+	d, err := proxy.SOCKS5("tcp", u.Host, auth, &net.Dialer{})
+	if err != nil {
+		return nil, err
+	}
+	socks := d.(proxy.ContextDialer)
+	return func(ctx context.Context, addr string) (net.Conn, error) { return socks.DialContext(ctx, "tcp", addr) }, nil
+}
+
+// dialConnect opens a tunnel to addr with an HTTP CONNECT request to the proxy at u.
+func dialConnect(ctx context.Context, u *url.URL, addr string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	req := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: addr}, Host: addr, Header: make(http.Header)}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", u.Host, err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", u.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: CONNECT %s: %s", u.Host, addr, resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		// The upstream may speak first (an HTTP/2 server sends its SETTINGS at once).
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads what its reader buffered from the connection before the connection itself.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// proxyFor returns the proxy of target with config cfg: its own Proxy, else the invoker-wide one; "" for
+// none.
+func (p *connPool) proxyFor(cfg TargetConfig) string {
+	switch cfg.Proxy {
+	case "":
+		return p.proxy
+	case ProxyDirect:
+		return ""
+	}
+	return cfg.Proxy
+}
+
+// proxyClient returns the gRPC-Web HTTP client for targets behind the proxy at raw.
+func (p *connPool) proxyClient(raw string) (*http.Client, error) {
+	if c, ok := p.proxyClients[raw]; ok {
+		return c, nil
+	}
+	u, err := ParseProxyURL(raw)
+	if err != nil {
+		return nil, err
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if u.Scheme == "http" {
+		t.Proxy = http.ProxyURL(u)
+	} else {
+		dial, err := proxyDialer(raw)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = nil
+		t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) { return dial(ctx, addr) }
+	}
+	c := &http.Client{Transport: t}
+	p.proxyClients[raw] = c
+	return c, nil
+}
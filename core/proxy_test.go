@@ -0,0 +1,175 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+)
+
+// startProxy serves serve on a local listener, counting the connections it tunnels.
+func startProxy(t *testing.T, serve func(conn net.Conn) (target string, ok bool)) (addr string, tunnels *atomic.Int32) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	tunnels = new(atomic.Int32)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				target, ok := serve(conn)
+				if !ok {
+					return
+				}
+				up, err := net.Dial("tcp", target)
+				if err != nil {
+					return
+				}
+				defer up.Close()
+				tunnels.Add(1)
+				go func() { _, _ = io.Copy(up, conn) }()
+				_, _ = io.Copy(conn, up)
+			}()
+		}
+	}()
+	return lis.Addr().String(), tunnels
+}
+
+// connectProxy answers an HTTP CONNECT request that carries the credentials user:secret.
+func connectProxy(conn net.Conn) (string, bool) {
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil || req.Method != http.MethodConnect {
+		return "", false
+	}
+	if req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpzZWNyZXQ=" {
+		_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		return "", false
+	}
+	_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	return req.Host, true
+}
+
+// socks5Proxy answers a SOCKS5 CONNECT without authentication.
+func socks5Proxy(conn net.Conn) (string, bool) {
+	r := bufio.NewReader(conn)
+	hello := make([]byte, 2)
+	if _, err := io.ReadFull(r, hello); err != nil || hello[0] != 5 {
+		return "", false
+	}
+	if _, err := io.ReadFull(r, make([]byte, hello[1])); err != nil {
+		return "", false
+	}
+	_, _ = conn.Write([]byte{5, 0})
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(r, head); err != nil || head[1] != 1 {
+		return "", false
+	}
+	var host string
+	switch head[3] {
+	case 1, 4:
+		ip := make([]byte, map[byte]int{1: 4, 4: 16}[head[3]])
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", false
+		}
+		host = net.IP(ip).String()
+	case 3:
+		n, _ := r.ReadByte()
+		name := make([]byte, n)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", false
+		}
+		host = string(name)
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", false
+	}
+	_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), true
+}
+
+func TestInvoker_Proxy(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterEchoServiceServer(srv, benchEchoServer{})
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+	target := lis.Addr().String()
+
+	connectAddr, connectTunnels := startProxy(t, connectProxy)
+	socksAddr, socksTunnels := startProxy(t, socks5Proxy)
+
+	invoke := func(inv *Invoker, target string) error {
+		t.Helper()
+		defer inv.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		resp, err := inv.Invoke(ctx, &InvokeRequest{Target: target, FullMethodName: benchMethod, Body: []byte(`{"message":"hi"}`)})
+		if err == nil && string(resp) != `{"message":"hi"}` {
+			t.Fatalf("response %s", resp)
+		}
+		return err
+	}
+
+	// The invoker-wide proxy.
+	if err := invoke(NewInvoker(WithDescriptorDir(t.TempDir()), WithProxy("http://user:secret@"+connectAddr)), target); err != nil {
+		t.Fatalf("via CONNECT: %v", err)
+	}
+	if connectTunnels.Load() != 1 {
+		t.Fatalf("CONNECT tunnels = %d", connectTunnels.Load())
+	}
+
+	// A target's own proxy wins, and ProxyDirect bypasses the invoker-wide one.
+	inv := NewInvoker(WithDescriptorDir(t.TempDir()), WithProxy("http://user:secret@"+connectAddr),
+		WithTargetConfigs(map[string]TargetConfig{target: {Proxy: "socks5://" + socksAddr}}))
+	if err := invoke(inv, target); err != nil {
+		t.Fatalf("via SOCKS5: %v", err)
+	}
+	if socksTunnels.Load() != 1 || connectTunnels.Load() != 1 {
+		t.Fatalf("tunnels: socks5 %d, CONNECT %d", socksTunnels.Load(), connectTunnels.Load())
+	}
+	inv = NewInvoker(WithDescriptorDir(t.TempDir()), WithProxy("http://user:secret@"+connectAddr),
+		WithTargetConfigs(map[string]TargetConfig{target: {Proxy: ProxyDirect}}))
+	if err := invoke(inv, target); err != nil || connectTunnels.Load() != 1 {
+		t.Fatalf("direct: %v, CONNECT tunnels %d", err, connectTunnels.Load())
+	}
+
+	// Rejected credentials fail the call.
+	if err := invoke(NewInvoker(WithDescriptorDir(t.TempDir()), WithCallTimeout(time.Second), WithProxy("http://user:wrong@"+connectAddr)), target); err == nil {
+		t.Fatal("call through a proxy refusing the credentials succeeded")
+	}
+}
+
+func TestParseProxyURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"http://proxy:3128":             true,
+		"socks5://user:pw@proxy:1080":   true,
+		"https://proxy:443":             false,
+		"proxy:3128":                    false,
+		"socks5://":                     false,
+		"http://proxy:3128/%zz invalid": false,
+	} {
+		if _, err := ParseProxyURL(raw); (err == nil) != ok {
+			t.Errorf("%s: err = %v", raw, err)
+		}
+	}
+}
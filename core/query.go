@@ -0,0 +1,187 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ErrInvalidQuery is returned (wrapped) for query parameters that cannot be bound to the request message.
+var ErrInvalidQuery = errors.New("invalid query parameters")
+
+// queryToJSON binds the URL query parameters of a GET request to the JSON of message md. Parameter names
+// are field names (JSON or proto), with dots for nested message fields and map entries, e.g.
+// filter.status=ACTIVE&labels.team=ops. Repeated fields take every value of their parameter; other fields
+// take exactly one. Values are typed by their field, so the JSON decoder sees numbers and bools where it
+// expects them; parameters that name no field are kept as strings for the unknown fields policy.
+func queryToJSON(md *desc.MessageDescriptor, query string) ([]byte, error) {
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	obj := map[string]any{}
+	for _, key := range keys {
+		if err := bindQueryParam(obj, md, key, strings.Split(key, "."), params[key]); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// bindQueryParam sets path within obj, a JSON object of message md (nil below unknown fields), to the
+// values of the parameter key.
+func bindQueryParam(obj map[string]any, md *desc.MessageDescriptor, key string, path []string, values []string) error {
+	var fd *desc.FieldDescriptor
+	if md != nil {
+		if fd = md.FindFieldByJSONName(path[0]); fd == nil {
+			fd = md.FindFieldByName(path[0])
+		}
+	}
+	name := path[0]
+	if fd != nil {
+		name = fd.GetJSONName()
+	}
+	if len(path) == 1 {
+		if _, ok := obj[name]; ok {
+			return fmt.Errorf("%s is set more than once", key)
+		}
+		v, err := queryValue(fd, key, values)
+		if err != nil {
+			return err
+		}
+		obj[name] = v
+		return nil
+	}
+	var child *desc.MessageDescriptor
+	switch {
+	case fd == nil:
+	case fd.IsMap():
+		return bindQueryMapEntry(obj, fd, name, key, path[1:], values)
+	case fd.GetMessageType() != nil && !fd.IsRepeated() && !isCoercedWKT(fd.GetMessageType().GetFullyQualifiedName()):
+		child = fd.GetMessageType()
+	default:
+		return fmt.Errorf("%s: %s has no fields to set", key, fd.GetName())
+	}
+	sub, err := subObject(obj, name, key)
+	if err != nil {
+		return err
+	}
+	return bindQueryParam(sub, child, key, path[1:], values)
+}
+
+// bindQueryMapEntry sets the entry path[0] of map field fd, named name in obj, or a field within it.
+func bindQueryMapEntry(obj map[string]any, fd *desc.FieldDescriptor, name, key string, path []string, values []string) error {
+	entries, err := subObject(obj, name, key)
+	if err != nil {
+		return err
+	}
+	vfd := fd.GetMapValueType()
+	if len(path) == 1 {
+		if _, ok := entries[path[0]]; ok {
+			return fmt.Errorf("%s is set more than once", key)
+		}
+		v, err := queryValue(vfd, key, values)
+		if err != nil {
+			return err
+		}
+		entries[path[0]] = v
+		return nil
+	}
+	mt := vfd.GetMessageType()
+	if mt == nil || isCoercedWKT(mt.GetFullyQualifiedName()) {
+		return fmt.Errorf("%s: the values of %s have no fields to set", key, fd.GetName())
+	}
+	sub, err := subObject(entries, path[0], key)
+	if err != nil {
+		return err
+	}
+	return bindQueryParam(sub, mt, key, path[1:], values)
+}
+
+// subObject returns the JSON object obj[name], adding it if missing.
+func subObject(obj map[string]any, name, key string) (map[string]any, error) {
+	v, ok := obj[name]
+	if !ok {
+		sub := map[string]any{}
+		obj[name] = sub
+		return sub, nil
+	}
+	sub, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s conflicts with a parameter setting %s", key, name)
+	}
+	return sub, nil
+}
+
+// queryValue returns the JSON value of field fd (nil if unknown) given the values of parameter key.
+func queryValue(fd *desc.FieldDescriptor, key string, values []string) (any, error) {
+	if fd == nil {
+		if len(values) == 1 {
+			return values[0], nil
+		}
+		return values, nil
+	}
+	if fd.IsMap() {
+		return nil, fmt.Errorf("%s is a map; set its entries as %s.KEY", key, key)
+	}
+	if fd.IsRepeated() {
+		out := make([]any, 0, len(values))
+		for _, v := range values {
+			e, err := queryScalar(fd, key, v)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, e)
+		}
+		return out, nil
+	}
+	if len(values) > 1 {
+		return nil, fmt.Errorf("%s is set more than once", key)
+	}
+	return queryScalar(fd, key, values[0])
+}
+
+// queryScalar types v as a JSON value of the (singular) field fd. Values that do not parse are passed on
+// as strings for the decoder to report.
+func queryScalar(fd *desc.FieldDescriptor, key, v string) (any, error) {
+	if mt := fd.GetMessageType(); mt != nil {
+		name := mt.GetFullyQualifiedName()
+		switch {
+		case wrapperTypes[name]:
+			return queryScalar(mt.FindFieldByName("value"), key, v)
+		case isCoercedWKT(name):
+			return v, nil
+		}
+		return nil, fmt.Errorf("%s is a message; set its fields as %s.FIELD", key, key)
+	}
+	switch fd.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		if v == "" {
+			return true, nil
+		}
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, nil
+		}
+	case descriptorpb.FieldDescriptorProto_TYPE_INT32, descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_SFIXED32, descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32, descriptorpb.FieldDescriptorProto_TYPE_ENUM,
+		descriptorpb.FieldDescriptorProto_TYPE_FLOAT, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		if _, err := strconv.ParseFloat(v, 64); err == nil && json.Valid([]byte(v)) {
+			return json.Number(v), nil
+		}
+	}
+	// 64-bit integers, strings, bytes and enum names are JSON strings.
+	return v, nil
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/builder"
+)
+
+func TestQueryToJSON(t *testing.T) {
+	status := builder.NewEnum("Status").
+		AddValue(builder.NewEnumValue("STATUS_UNSPECIFIED")).
+		AddValue(builder.NewEnumValue("STATUS_ACTIVE"))
+	filter := builder.NewMessage("Filter").
+		AddField(builder.NewField("statuses", builder.FieldTypeEnum(status)).SetRepeated()).
+		AddField(builder.NewField("min_age", builder.FieldTypeInt32()))
+	req := builder.NewMessage("ListUsersRequest").
+		AddField(builder.NewField("page_size", builder.FieldTypeInt32())).
+		AddField(builder.NewField("after_id", builder.FieldTypeInt64())).
+		AddField(builder.NewField("active", builder.FieldTypeBool())).
+		AddField(builder.NewField("ids", builder.FieldTypeString()).SetRepeated()).
+		AddField(builder.NewField("filter", builder.FieldTypeMessage(filter))).
+		AddField(builder.NewMapField("labels", builder.FieldTypeString(), builder.FieldTypeString())).
+		AddField(builder.NewMapField("filters", builder.FieldTypeString(), builder.FieldTypeMessage(filter)))
+	fd, err := builder.NewFile("acme/users.proto").SetPackageName("acme").
+		AddEnum(status).AddMessage(filter).AddMessage(req).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	md := fd.FindMessage("acme.ListUsersRequest")
+
+	query := "pageSize=10&after_id=9007199254740993&active&ids=a&ids=b&filter.statuses=STATUS_ACTIVE&filter.statuses=0" +
+		"&filter.minAge=18&labels.team=ops&filters.eu.min_age=21&extra=x"
+	got, err := queryToJSON(md, query)
+	if err != nil {
+		t.Fatalf("queryToJSON: %v", err)
+	}
+	want := `{"active":true,"afterId":"9007199254740993","extra":"x","filter":{"minAge":18,"statuses":["STATUS_ACTIVE",0]},` +
+		`"filters":{"eu":{"minAge":21}},"ids":["a","b"],"labels":{"team":"ops"},"pageSize":10}`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+
+	for _, query := range []string{
+		"pageSize=1&pageSize=2",
+		"filter=x",
+		"labels=x",
+		"filter.minAge=1&filter.min_age=2",
+		"ids.x=1",
+		"%zz",
+	} {
+		if _, err := queryToJSON(md, query); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%q: err = %v, want ErrInvalidQuery", query, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// RedactedValue replaces the value of redacted fields.
+const RedactedValue = "[REDACTED]"
+
+// RedactJSON replaces fields of body, a JSON-encoded md message, with RedactedValue: every field declared
+// with the debug_redact = true or the gateway.pii field option (at any depth, including repeated and map
+// values) and every field at one of paths. Paths are dotted JSON field names (e.g. "card.number") and apply
+// to every element of arrays along the way.
+func RedactJSON(md *desc.MessageDescriptor, body []byte, paths []string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	redactMarked(md, v)
+	for _, p := range paths {
+		redactPath(v, strings.Split(p, "."))
+	}
+	return json.Marshal(v)
+}
+
+// redactMarked redacts the debug_redact and PII fields of the md-typed JSON object v.
+func redactMarked(md *desc.MessageDescriptor, v any) {
+	obj, ok := v.(map[string]any)
+	if !ok || md == nil {
+		return
+	}
+	for _, f := range md.GetFields() {
+		name := f.GetJSONName()
+		val, ok := obj[name]
+		if !ok {
+			if val, ok = obj[f.GetName()]; !ok {
+				continue
+			}
+			name = f.GetName()
+		}
+		if f.GetFieldOptions().GetDebugRedact() || IsPII(f) {
+			obj[name] = RedactedValue
+			continue
+		}
+		switch {
+		case f.IsMap():
+			if vt := f.GetMapValueType(); vt.GetMessageType() != nil {
+				if m, ok := val.(map[string]any); ok {
+					for _, e := range m {
+						redactMarked(vt.GetMessageType(), e)
+					}
+				}
+			}
+		case f.GetMessageType() != nil:
+			if f.IsRepeated() {
+				if list, ok := val.([]any); ok {
+					for _, e := range list {
+						redactMarked(f.GetMessageType(), e)
+					}
+				}
+				continue
+			}
+			redactMarked(f.GetMessageType(), val)
+		}
+	}
+}
+
+// redactPath redacts the field at path (relative to v), descending through objects and arrays.
+func redactPath(v any, path []string) {
+	switch x := v.(type) {
+	case []any:
+		for _, e := range x {
+			redactPath(e, path)
+		}
+	case map[string]any:
+		next, ok := x[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			x[path[0]] = RedactedValue
+			return
+		}
+		redactPath(next, path[1:])
+	}
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestRedactJSON(t *testing.T) {
+	card := builder.NewMessage("Card").
+		AddField(builder.NewField("number", builder.FieldTypeString()).SetOptions(&descriptorpb.FieldOptions{DebugRedact: proto.Bool(true)})).
+		AddField(builder.NewField("brand", builder.FieldTypeString()))
+	pay := builder.NewMessage("PayRequest").
+		AddField(builder.NewField("cards", builder.FieldTypeMessage(card)).SetRepeated()).
+		AddField(builder.NewField("customer_email", builder.FieldTypeString())).
+		AddField(builder.NewField("amount", builder.FieldTypeInt64()))
+	fd, err := builder.NewFile("acme/pay.proto").SetPackageName("acme").AddMessage(card).AddMessage(pay).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	md := fd.FindMessage("acme.PayRequest")
+
+	body := `{"cards":[{"number":"4111","brand":"visa"},{"number":"5500","brand":"mc"}],"customerEmail":"a@b.c","amount":"1200"}`
+	got, err := RedactJSON(md, []byte(body), []string{"customerEmail", "missing.path"})
+	if err != nil {
+		t.Fatalf("redact: %v", err)
+	}
+	want := `{"amount":"1200","cards":[{"brand":"visa","number":"[REDACTED]"},{"brand":"mc","number":"[REDACTED]"}],"customerEmail":"[REDACTED]"}`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/jhump/protoreflect/desc"
+)
+
+// defaultShadowTimeout bounds a mirrored call when neither the shadow config nor the invoker sets a timeout.
+const defaultShadowTimeout = 10 * time.Second
+
+// ShadowConfig mirrors calls of a method to a secondary target, e.g. a new backend version under validation.
+// Mirrored calls run asynchronously after the request is decoded; their responses are discarded and their
+// failures never reach the caller.
+type ShadowConfig struct {
+	// Target is the shadow gRPC target ("host:port"). Empty disables mirroring.
+	Target string
+	// SampleRate is the fraction of calls mirrored, in (0, 1]; zero means every call.
+	SampleRate float64
+	// Timeout bounds each mirrored call; zero means the invoker timeout, or 10s if that is zero too.
+	Timeout time.Duration
+	// OnError, if set, is called with the full method name and error of each failed mirrored call.
+	OnError func(method string, err error)
+}
+
+// WithShadows sets per-method shadow targets keyed by full method name ("/package.Service/Method");
+// the "*" entry applies to methods without their own.
+func WithShadows(shadows map[string]ShadowConfig) InvokerOption {
+	return func(inv *Invoker) {
+		p := *inv.methodPolicies()
+		p.shadows = shadows
+		inv.policies.Store(&p)
+	}
+}
+
+func (inv *Invoker) shadowConfig(methodName string) (ShadowConfig, bool) {
+	configs := inv.methodPolicies().shadows
+	cfg, ok := configs[methodName]
+	if !ok {
+		cfg = configs["*"]
+	}
+	return cfg, cfg.Target != ""
+}
+
+// mirror sends reqMsg to the shadow target of methodName, if any, in the background. The call is detached
+// from ctx (it outlives the primary call and is not part of its trace) but keeps ctx's clock and rand.
+func (inv *Invoker) mirror(ctx context.Context, methodName, primary string, md *desc.MethodDescriptor, reqMsg proto.Message) {
+	cfg, ok := inv.shadowConfig(methodName)
+	if !ok || cfg.Target == primary {
+		return
+	}
+	rnd := RandFromContext(ctx, inv.rand)
+	if cfg.SampleRate > 0 && cfg.SampleRate < 1 && float64(rnd.Int63())/(1<<63) >= cfg.SampleRate {
+		return
+	}
+	SpanFromContext(ctx).SetAttr("shadow", cfg.Target)
+
+	clock := ClockFromContext(ctx, inv.clock)
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = inv.timeout
+	}
+	if timeout <= 0 {
+		timeout = defaultShadowTimeout
+	}
+	shadowCtx := ContextWithRand(ContextWithClock(context.Background(), clock), rnd)
+	msg := proto.Clone(reqMsg)
+
+	inv.shadowWG.Add(1)
+	go func() {
+		defer inv.shadowWG.Done()
+		callCtx, cancel := WithTimeout(shadowCtx, clock, timeout)
+		defer cancel()
+		if _, err := inv.invokeUnary(callCtx, cfg.Target, md, msg); err != nil {
+			inv.metrics.Add("gateway_shadow_calls_total", 1, "method", methodName, "target", cfg.Target, "outcome", "error")
+			if cfg.OnError != nil {
+				cfg.OnError(methodName, err)
+			}
+			return
+		}
+		inv.metrics.Add("gateway_shadow_calls_total", 1, "method", methodName, "target", cfg.Target, "outcome", "ok")
+	}()
+}
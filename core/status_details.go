@@ -0,0 +1,60 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/status"
+
+	// Register google.rpc error detail types (BadRequest, RetryInfo, ErrorInfo, ...) so they resolve
+	// even when the caller's descriptors do not include google/rpc/error_details.proto.
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// UpstreamError is returned by Invoke when the upstream call fails with a gRPC status. Details holds the
+// status details (google.protobuf.Any) expanded to JSON, each with its "@type".
+type UpstreamError struct {
+	Status  *status.Status
+	Details []json.RawMessage
+	err     error
+}
+
+func (e *UpstreamError) Error() string { return e.err.Error() }
+
+func (e *UpstreamError) Unwrap() error { return e.err }
+
+// newUpstreamError wraps err if it carries a gRPC status, decoding its details with resolver.
+func newUpstreamError(err error, resolver jsonpb.AnyResolver) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	return &UpstreamError{Status: st, Details: statusDetailsJSON(st, resolver), err: err}
+}
+
+// statusDetailsJSON renders each detail of st as JSON. Details whose type cannot be resolved are kept
+// as {"@type": ..., "value": base64} rather than dropped.
+func statusDetailsJSON(st *status.Status, resolver jsonpb.AnyResolver) []json.RawMessage {
+	details := st.Proto().GetDetails()
+	if len(details) == 0 {
+		return nil
+	}
+	m := &jsonpb.Marshaler{AnyResolver: resolver}
+	out := make([]json.RawMessage, 0, len(details))
+	for _, d := range details {
+		var buf bytes.Buffer
+		if err := m.Marshal(&buf, proto.MessageV1(d)); err == nil {
+			out = append(out, buf.Bytes())
+			continue
+		}
+		b, _ := json.Marshal(map[string]string{
+			"@type": d.GetTypeUrl(),
+			"value": base64.StdEncoding.EncodeToString(d.GetValue()),
+		})
+		out = append(out, b)
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+)
+
+// ErrNotServerStreaming is returned by OpenServerStream for methods that are not server-streaming.
+var ErrNotServerStreaming = errors.New("method is not server-streaming")
+
+// ErrStreamingMethod is returned by Invoke for server-streaming methods, which need OpenServerStream.
+var ErrStreamingMethod = errors.New("streaming method not supported")
+
+// ServerStream is an open server-streaming call, see OpenServerStream.
+type ServerStream struct {
+	stream   *grpcdynamic.ServerStream
+	resolver jsonpb.AnyResolver
+	wkt      *WKTCoercion
+	presence FieldPresence
+	visible  *FieldVisibility
+	int64    Int64Encoding
+	output   *desc.MessageDescriptor
+	method   string
+}
+
+// OpenServerStream starts a server-streaming call: Body is decoded as for Invoke (including Authorize) and
+// sent as the single request message. The call lasts until the stream ends or ctx is done; the invoker and
+// per-method timeouts, which bound unary calls, do not apply. Client-streaming methods are not supported.
+func (inv *Invoker) OpenServerStream(ctx context.Context, req *InvokeRequest) (*ServerStream, error) {
+	method, methodName, err := inv.resolve(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if !method.Method.IsServerStreaming() || method.Method.IsClientStreaming() {
+		return nil, fmt.Errorf("%w: %s", ErrNotServerStreaming, methodName)
+	}
+	ctx = withResolvedCall(ctx, req, method, methodName)
+	resolver := inv.anyResolver(req.DescriptorNamespace, method.Method)
+	reqMsg, _, err := inv.decodeRequest(ctx, req, methodName, method.Method, resolver)
+	if err != nil {
+		return nil, err
+	}
+	ctx = withAffinityKey(outgoingMetadata(ctx, req.Metadata), req.affinityKey(reqMsg))
+	channel, _, err := inv.conns.channel(req.Target)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", req.Target, err)
+	}
+	stream, err := grpcdynamic.NewStub(channel).InvokeRpcServerStream(ctx, method.Method, reqMsg)
+	if err != nil {
+		return nil, newUpstreamError(err, resolver)
+	}
+	inv.metrics.Add("gateway_streams_opened_total", 1, "method", methodName)
+	return &ServerStream{stream: stream, resolver: resolver, wkt: req.WKTCoercion, presence: req.FieldPresence, visible: req.FieldVisibility, int64: req.Int64Encoding, output: method.Method.GetOutputType(), method: methodName}, nil
+}
+
+// Method returns the full method name of the call.
+func (s *ServerStream) Method() string { return s.method }
+
+// OutputType returns the type of the response messages.
+func (s *ServerStream) OutputType() *desc.MessageDescriptor { return s.output }
+
+// Recv returns the next response message as JSON. At the end of the stream it returns io.EOF; a failed call
+// returns an *UpstreamError for gRPC statuses.
+func (s *ServerStream) Recv() ([]byte, error) {
+	msg, err := s.stream.RecvMsg()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, newUpstreamError(err, s.resolver)
+	}
+	resp, err := messageToJSON(msg, s.resolver)
+	if err == nil {
+		resp, err = s.presence.applyPresence(msg, resp)
+	}
+	if err == nil {
+		resp, err = s.visible.hideFields(s.output, resp)
+	}
+	if err == nil {
+		resp, err = s.int64.encodeResponse(s.output, resp)
+	}
+	if err == nil && s.wkt != nil {
+		resp, err = s.wkt.coerceResponse(s.output, resp)
+	}
+	return resp, err
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/encoding/gzip" // registers the "gzip" compressor for TargetConfig.Compression
+	"google.golang.org/grpc/keepalive"
+)
+
+// TargetConfig holds channel settings for one upstream target. The zero value dials with gRPC defaults.
+type TargetConfig struct {
+	// KeepaliveTime is the interval of client keepalive pings; zero disables them.
+	KeepaliveTime time.Duration
+	// KeepaliveTimeout is how long to wait for a ping ack before closing the connection (gRPC default 20s).
+	KeepaliveTimeout time.Duration
+	// KeepaliveWithoutStream sends pings even when no call is active.
+	KeepaliveWithoutStream bool
+	// MaxRecvMsgSize and MaxSendMsgSize bound message sizes in bytes; zero keeps the gRPC defaults (4MiB / unlimited).
+	MaxRecvMsgSize int
+	MaxSendMsgSize int
+	// Authority overrides the :authority pseudo-header (e.g. when dialing an IP behind virtual hosting).
+	Authority string
+	// UserAgent is prepended to the gRPC user agent.
+	UserAgent string
+	// InitialWindowSize and InitialConnWindowSize set HTTP/2 flow-control windows in bytes; values below 64KiB are ignored by gRPC.
+	InitialWindowSize     int32
+	InitialConnWindowSize int32
+	// Compression names the compressor for request messages sent to the target, e.g. "gzip"; empty sends
+	// them uncompressed. Responses are decompressed whatever the upstream chooses.
+	Compression string
+	// WaitForReady makes calls wait, within their deadline, for a connection to the target that is down or
+	// still connecting instead of failing at once with Unavailable.
+	WaitForReady bool
+	// DialOptions are appended last, for settings not covered above.
+	DialOptions []grpc.DialOption
+	// Transport selects the wire protocol; TransportGRPCWeb calls the target over HTTP/1.1 (the target may then
+	// be an http(s) URL) and honors only MaxRecvMsgSize, MaxSendMsgSize, Authority and UserAgent above.
+	Transport Transport
+	// Credentials are attached to every call to the target, e.g. BearerToken, ClientCredentials or
+	// GoogleCredentials, so the gateway can call authenticated APIs on behalf of its clients.
+	Credentials credentials.PerRPCCredentials
+	// InsecureCredentials sends Credentials over plaintext connections too; by default they require TLS
+	// (set through DialOptions or an https gRPC-Web target) and calls to plaintext targets fail.
+	InsecureCredentials bool
+	// MaxInFlight bounds the concurrent unary calls to the target; further calls wait in a queue for up to
+	// QueueTimeout (zero: as long as their deadline allows) and then fail with ErrTargetOverloaded, so a slow
+	// upstream cannot tie up every gateway goroutine. Zero means no limit.
+	MaxInFlight  int
+	QueueTimeout time.Duration
+	// ConsistentHash balances calls over the endpoints the target resolves to (e.g. "dns:///users:443") by
+	// InvokeRequest.AffinityKey or AffinityField, so a key keeps reaching the same endpoint while it is ready.
+	// Without it, calls go to the first endpoint that connects. xDS targets balance as their control plane
+	// configures and ignore it.
+	ConsistentHash bool
+	// Proxy dials the target through a forward proxy, for networks where the gateway cannot reach it
+	// directly: http://host:port tunnels with HTTP CONNECT and socks5://host:port through SOCKS5, either with
+	// optional user:password@ credentials (see ParseProxyURL). Empty means the proxy of WithProxy, if any;
+	// ProxyDirect bypasses it.
+	Proxy string
+}
+
+// defaultTargetKey selects the TargetConfig for targets without an entry of their own.
+const defaultTargetKey = "*"
+
+// dialOptions returns the dial options of c, with shared (the invoker-wide options) before c.DialOptions.
+func (c TargetConfig) dialOptions(shared ...grpc.DialOption) []grpc.DialOption {
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if c.KeepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                c.KeepaliveTime,
+			Timeout:             c.KeepaliveTimeout,
+			PermitWithoutStream: c.KeepaliveWithoutStream,
+		}))
+	}
+	var callOpts []grpc.CallOption
+	if c.MaxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(c.MaxSendMsgSize))
+	}
+	if c.Compression != "" {
+		callOpts = append(callOpts, grpc.UseCompressor(c.Compression))
+	}
+	if c.WaitForReady {
+		callOpts = append(callOpts, grpc.WaitForReady(true))
+	}
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	if c.Authority != "" {
+		opts = append(opts, grpc.WithAuthority(c.Authority))
+	}
+	if c.UserAgent != "" {
+		opts = append(opts, grpc.WithUserAgent(c.UserAgent))
+	}
+	if c.InitialWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialWindowSize(c.InitialWindowSize))
+	}
+	if c.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.WithInitialConnWindowSize(c.InitialConnWindowSize))
+	}
+	if c.ConsistentHash {
+		opts = append(opts, consistentHashDialOption())
+	}
+	if creds := c.perRPCCredentials(); creds != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(creds))
+	}
+	opts = append(opts, shared...)
+	return append(opts, c.DialOptions...)
+}
+
+// targetConfig returns the configuration for target from configs, falling back to the "*" entry.
+func targetConfig(configs map[string]TargetConfig, target string) TargetConfig {
+	if c, ok := configs[target]; ok {
+		return c
+	}
+	return configs[defaultTargetKey]
+}
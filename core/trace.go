@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/status"
+)
+
+// Span is one node of a request execution tree: which upstream calls were made, in what order,
+// with timings and outcomes. A nil *Span is valid and records nothing, so instrumentation is free
+// when tracing is off.
+type Span struct {
+	Name     string            `json:"name"`
+	Target   string            `json:"target,omitempty"`
+	Method   string            `json:"method,omitempty"`
+	Start    time.Time         `json:"start"`
+	Duration time.Duration     `json:"duration_ns"`
+	Outcome  string            `json:"outcome,omitempty"` // "ok", or the gRPC code name / "error" on failure
+	Error    string            `json:"error,omitempty"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Children []*Span           `json:"children,omitempty"`
+
+	mu    sync.Mutex
+	clock Clock
+}
+
+type spanKey struct{}
+
+// NewTrace starts a root span and returns a context carrying it; spans started under ctx become its children.
+func NewTrace(ctx context.Context, name string) (context.Context, *Span) {
+	clock := ClockFromContext(ctx, nil)
+	s := &Span{Name: name, Start: clock.Now(), clock: clock}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// StartSpan starts a child of the span carried by ctx. If ctx carries no span, it returns ctx and a nil span.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent, _ := ctx.Value(spanKey{}).(*Span)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := &Span{Name: name, Start: parent.clock.Now(), clock: parent.clock}
+	parent.mu.Lock()
+	parent.Children = append(parent.Children, s)
+	parent.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// detachedSpan returns a context carrying a span that is not linked into the tree of ctx's span, for work that
+// may outlive the caller (a losing hedged call); attach links its children in once the work is done. If ctx
+// carries no span, it returns ctx and a nil span.
+func detachedSpan(ctx context.Context) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	s := &Span{Start: parent.clock.Now(), clock: parent.clock}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// attach appends the children of the detached span d to s.
+func (s *Span) attach(d *Span) {
+	if s == nil || d == nil {
+		return
+	}
+	d.mu.Lock()
+	children := d.Children
+	d.mu.Unlock()
+	s.mu.Lock()
+	s.Children = append(s.Children, children...)
+	s.mu.Unlock()
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetTarget records the upstream target and full method name on s.
+func (s *Span) SetTarget(target, method string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Target, s.Method = target, method
+	s.mu.Unlock()
+}
+
+// SetAttr records a free-form attribute on s.
+func (s *Span) SetAttr(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.Attrs == nil {
+		s.Attrs = make(map[string]string)
+	}
+	s.Attrs[key] = value
+	s.mu.Unlock()
+}
+
+// End finishes s with the outcome derived from err.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	now := s.clock.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Duration = now.Sub(s.Start)
+	switch {
+	case err == nil:
+		s.Outcome = "ok"
+	default:
+		s.Outcome = "error"
+		if st, ok := status.FromError(err); ok {
+			s.Outcome = st.Code().String()
+		}
+		s.Error = err.Error()
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// UnknownFieldPolicy selects what happens to JSON request fields the request message does not declare.
+type UnknownFieldPolicy string
+
+const (
+	UnknownFieldsReject UnknownFieldPolicy = "reject" // fail the call with ErrUnknownFields (also the zero value)
+	UnknownFieldsDrop   UnknownFieldPolicy = "drop"   // ignore them
+	UnknownFieldsWarn   UnknownFieldPolicy = "warn"   // ignore them and report them to InvokeRequest.OnUnknownFields
+)
+
+// ErrUnknownFields is returned by Invoke for a request body with undeclared fields under UnknownFieldsReject.
+var ErrUnknownFields = errors.New("unknown fields in request")
+
+// unknownFields returns the paths of the fields in body, a JSON message of type md, that md does not declare,
+// e.g. "bogus", "address.zip" or "items[1].colour". Well-known types, which have JSON forms of their own,
+// are not looked into.
+func unknownFields(md *desc.MessageDescriptor, body []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+	var paths []string
+	collectUnknownFields(md, v, "", &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+func collectUnknownFields(md *desc.MessageDescriptor, v any, prefix string, paths *[]string) {
+	obj, ok := v.(map[string]any)
+	if name := md.GetFullyQualifiedName(); !ok || isCoercedWKT(name) || name == "google.protobuf.Any" {
+		return
+	}
+	for key, fv := range obj {
+		fd := md.FindFieldByJSONName(key)
+		if fd == nil {
+			fd = md.FindFieldByName(key)
+		}
+		if fd == nil {
+			*paths = append(*paths, prefix+key)
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			vt := fd.GetMapValueType().GetMessageType()
+			if m, ok := fv.(map[string]any); ok && vt != nil {
+				for k, e := range m {
+					collectUnknownFields(vt, e, prefix+key+"["+k+"].", paths)
+				}
+			}
+		case fd.GetMessageType() == nil:
+		case fd.IsRepeated():
+			if list, ok := fv.([]any); ok {
+				for i, e := range list {
+					collectUnknownFields(fd.GetMessageType(), e, prefix+key+"["+strconv.Itoa(i)+"].", paths)
+				}
+			}
+		default:
+			collectUnknownFields(fd.GetMessageType(), fv, prefix+key+".", paths)
+		}
+	}
+}
+
+// unknownFieldsError reports the undeclared fields of body, or returns err if there are none (err is then
+// about something else).
+func unknownFieldsError(md *desc.MessageDescriptor, body []byte, err error) error {
+	if paths := unknownFields(md, body); len(paths) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownFields, strings.Join(paths, ", "))
+	}
+	return err
+}
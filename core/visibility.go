@@ -0,0 +1,150 @@
+package core
+
+import (
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// VisibleIfOption is the field number of the gateway.visible_if field option (see
+// proto/gateway/options.proto): a rule that must hold for the caller to see the field in responses:
+//
+//	string email = 3 [(gateway.visible_if) = "'admin' in claims.roles"];
+const VisibleIfOption = 50752
+
+// FieldVisibility hides response fields from callers that may not see them, so that one method can serve
+// callers with different access. A field is hidden (omitted from the JSON) unless its rule holds.
+type FieldVisibility struct {
+	// Rules maps dotted JSON field paths of the response message (e.g. "owner.email") to rules; paths apply
+	// to every element of arrays along the way. Fields declared with the gateway.visible_if option, at any
+	// depth, carry rules of their own.
+	Rules map[string]string
+	// PIIRule, if set, is the rule of fields tagged as PII with the gateway.pii option (see PIIOption), in
+	// addition to any rule of their own.
+	PIIRule string
+	// Visible reports whether rule holds for the caller. The invoker does not interpret rules.
+	Visible func(rule string) bool
+}
+
+// hideFields omits the fields of body, a JSON response message of type md, whose rules do not hold.
+func (v *FieldVisibility) hideFields(md *desc.MessageDescriptor, body []byte) ([]byte, error) {
+	if v == nil || v.Visible == nil || (len(v.Rules) == 0 && !v.hasMarked(md, map[*desc.MessageDescriptor]bool{})) {
+		return body, nil
+	}
+	return rewriteJSON(body, func(val any) any {
+		v.hideMarked(md, val)
+		for path, rule := range v.Rules {
+			if !v.Visible(rule) {
+				hidePath(val, strings.Split(path, "."))
+			}
+		}
+		return val
+	})
+}
+
+// fieldRules returns the rules fd carries: its visible_if option, and PIIRule if it is tagged as PII.
+func (v *FieldVisibility) fieldRules(fd *desc.FieldDescriptor) []string {
+	var rules []string
+	if rule, ok := visibleIfOption(fd); ok {
+		rules = append(rules, rule)
+	}
+	if v.PIIRule != "" && IsPII(fd) {
+		rules = append(rules, v.PIIRule)
+	}
+	return rules
+}
+
+// visibleField reports whether all rules of fd hold.
+func (v *FieldVisibility) visibleField(fd *desc.FieldDescriptor) bool {
+	for _, rule := range v.fieldRules(fd) {
+		if !v.Visible(rule) {
+			return false
+		}
+	}
+	return true
+}
+
+// hideMarked omits the fields of the md-typed JSON object val whose own rules do not hold.
+func (v *FieldVisibility) hideMarked(md *desc.MessageDescriptor, val any) {
+	obj, ok := val.(map[string]any)
+	if !ok || md == nil || isCoercedWKT(md.GetFullyQualifiedName()) {
+		return
+	}
+	for _, f := range md.GetFields() {
+		name := f.GetJSONName()
+		fv, ok := obj[name]
+		if !ok {
+			if fv, ok = obj[f.GetName()]; !ok {
+				continue
+			}
+			name = f.GetName()
+		}
+		if !v.visibleField(f) {
+			delete(obj, name)
+			continue
+		}
+		switch {
+		case f.IsMap():
+			if vt := f.GetMapValueType(); vt.GetMessageType() != nil {
+				if m, ok := fv.(map[string]any); ok {
+					for _, e := range m {
+						v.hideMarked(vt.GetMessageType(), e)
+					}
+				}
+			}
+		case f.GetMessageType() != nil:
+			if f.IsRepeated() {
+				if list, ok := fv.([]any); ok {
+					for _, e := range list {
+						v.hideMarked(f.GetMessageType(), e)
+					}
+				}
+				continue
+			}
+			v.hideMarked(f.GetMessageType(), fv)
+		}
+	}
+}
+
+// hidePath omits the field at path (relative to v), descending through objects and arrays.
+func hidePath(v any, path []string) {
+	switch x := v.(type) {
+	case []any:
+		for _, e := range x {
+			hidePath(e, path)
+		}
+	case map[string]any:
+		next, ok := x[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			delete(x, path[0])
+			return
+		}
+		hidePath(next, path[1:])
+	}
+}
+
+// hasMarked reports whether md, or any message type it contains, has fields with rules of their own, so
+// that responses without rules skip the rewrite.
+func (v *FieldVisibility) hasMarked(md *desc.MessageDescriptor, seen map[*desc.MessageDescriptor]bool) bool {
+	if seen[md] {
+		return false
+	}
+	seen[md] = true
+	for _, f := range md.GetFields() {
+		if len(v.fieldRules(f)) > 0 {
+			return true
+		}
+		if mt := f.GetMessageType(); mt != nil && v.hasMarked(mt, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleIfOption returns the gateway.visible_if option of fd, read like defaultValueOption.
+func visibleIfOption(fd *desc.FieldDescriptor) (string, bool) {
+	return stringFieldOption(fd, VisibleIfOption)
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// visibleIf returns field options carrying the gateway.visible_if option, as protoc would encode it.
+func visibleIf(rule string) *descriptorpb.FieldOptions {
+	opts := &descriptorpb.FieldOptions{}
+	b := protowire.AppendTag(nil, VisibleIfOption, protowire.BytesType)
+	opts.ProtoReflect().SetUnknown(protowire.AppendString(b, rule))
+	return opts
+}
+
+func TestFieldVisibility(t *testing.T) {
+	contact := builder.NewMessage("Contact").
+		AddField(builder.NewField("email", builder.FieldTypeString()).SetOptions(visibleIf("admin"))).
+		AddField(builder.NewField("phone", builder.FieldTypeString()))
+	user := builder.NewMessage("User").
+		AddField(builder.NewField("name", builder.FieldTypeString())).
+		AddField(builder.NewField("contacts", builder.FieldTypeMessage(contact)).SetRepeated()).
+		AddField(builder.NewField("salary", builder.FieldTypeInt64()).SetOptions(visibleIf("hr"))).
+		AddField(builder.NewField("notes", builder.FieldTypeString()))
+	fd, err := builder.NewFile("acme/user.proto").SetPackageName("acme").AddMessage(contact).AddMessage(user).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	md := fd.FindMessage("acme.User")
+	body := `{"name":"ada","contacts":[{"email":"a@b.c","phone":"1"},{"email":"d@e.f","phone":"2"}],"salary":"100","notes":"n"}`
+
+	var evaluated []string
+	v := &FieldVisibility{
+		Rules: map[string]string{"contacts.phone": "admin", "notes": "support"},
+		Visible: func(rule string) bool {
+			evaluated = append(evaluated, rule)
+			return rule == "hr" || rule == "support"
+		},
+	}
+	got, err := v.hideFields(md, []byte(body))
+	if err != nil {
+		t.Fatalf("hide: %v", err)
+	}
+	if want := `{"contacts":[{},{}],"name":"ada","notes":"n","salary":"100"}`; string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	if len(evaluated) == 0 {
+		t.Fatal("rules were not evaluated")
+	}
+
+	if !v.hasMarked(md, map[*desc.MessageDescriptor]bool{}) {
+		t.Fatal("hasMarked: option in a nested message not found")
+	}
+	var nilVisibility *FieldVisibility
+	if got, _ := nilVisibility.hideFields(md, []byte(body)); string(got) != body {
+		t.Fatalf("nil visibility changed the body: %s", got)
+	}
+}
@@ -0,0 +1,297 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// WKTCoercion relaxes the JSON mapping of the google.protobuf well-known types for clients that send
+// non-canonical forms. Requests accept, besides the canonical forms:
+//
+//   - Timestamp: unix seconds or milliseconds (numbers or digit strings, milliseconds from 1e11 on), and
+//     RFC 3339 date-times without a zone or plain dates, taken as UTC
+//   - Duration: numbers of seconds and Go durations such as "5m" or "1h30m"
+//   - FieldMask: the canonical "user.displayName,email" string and arrays of paths, besides {"paths": [...]}
+//   - Struct and ListValue: a string holding the JSON object or array
+//   - wrappers (StringValue, Int64Value, ...): the message form {"value": ...}
+//
+// The fields below select non-canonical forms for responses.
+type WKTCoercion struct {
+	// Timestamps renders Timestamp fields of responses; default TimestampRFC3339.
+	Timestamps TimestampFormat
+	// DurationSeconds renders Duration fields of responses as numbers of seconds instead of strings like "1.5s".
+	DurationSeconds bool
+}
+
+// TimestampFormat is the JSON form of google.protobuf.Timestamp in responses.
+type TimestampFormat string
+
+const (
+	TimestampRFC3339    TimestampFormat = ""        // "2024-05-01T12:00:00Z", the proto3 JSON mapping
+	TimestampUnix       TimestampFormat = "unix"    // seconds since the epoch, fractional if needed
+	TimestampUnixMillis TimestampFormat = "unix_ms" // integer milliseconds since the epoch
+)
+
+// unixMillisThreshold separates unix seconds from milliseconds: 1e11 seconds is in the year 5138.
+const unixMillisThreshold = 1e11
+
+// wrapperTypes are the google/protobuf/wrappers.proto messages.
+var wrapperTypes = map[string]bool{
+	"google.protobuf.DoubleValue": true, "google.protobuf.FloatValue": true,
+	"google.protobuf.Int64Value": true, "google.protobuf.UInt64Value": true,
+	"google.protobuf.Int32Value": true, "google.protobuf.UInt32Value": true,
+	"google.protobuf.BoolValue": true, "google.protobuf.StringValue": true, "google.protobuf.BytesValue": true,
+}
+
+func isCoercedWKT(name string) bool {
+	switch name {
+	case "google.protobuf.Timestamp", "google.protobuf.Duration", "google.protobuf.FieldMask",
+		"google.protobuf.Struct", "google.protobuf.ListValue", "google.protobuf.Value":
+		return true
+	}
+	return wrapperTypes[name]
+}
+
+// coerceRequest rewrites the non-canonical well-known type values of body, a JSON message of type md.
+// Values it does not recognize are left for the decoder to report.
+func (c *WKTCoercion) coerceRequest(md *desc.MessageDescriptor, body []byte) ([]byte, error) {
+	return rewriteWKT(md, body, coerceWKTInput)
+}
+
+// coerceResponse renders the well-known type values of body, a JSON message of type md, in the response
+// forms selected by c.
+func (c *WKTCoercion) coerceResponse(md *desc.MessageDescriptor, body []byte) ([]byte, error) {
+	if c.Timestamps == TimestampRFC3339 && !c.DurationSeconds {
+		return body, nil
+	}
+	return rewriteWKT(md, body, c.coerceWKTOutput)
+}
+
+func rewriteWKT(md *desc.MessageDescriptor, body []byte, f func(name string, v any) any) ([]byte, error) {
+	return rewriteJSON(body, func(v any) any { return walkWKT(md, v, f) })
+}
+
+// rewriteJSON decodes body, replaces its value with f's result and encodes that again. Numbers keep their
+// exact text.
+func rewriteJSON(body []byte, f func(v any) any) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(f(v)); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
+
+// walkWKT replaces every non-null value of a coerced well-known type within v, a JSON value of message md,
+// with f's result.
+func walkWKT(md *desc.MessageDescriptor, v any, f func(name string, v any) any) any {
+	if v == nil {
+		return nil
+	}
+	if name := md.GetFullyQualifiedName(); isCoercedWKT(name) {
+		return f(name, v)
+	}
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	for key, fv := range obj {
+		fd := md.FindFieldByJSONName(key)
+		if fd == nil {
+			fd = md.FindFieldByName(key)
+		}
+		if fd == nil {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			vt := fd.GetMapValueType().GetMessageType()
+			if m, ok := fv.(map[string]any); ok && vt != nil {
+				for k, e := range m {
+					m[k] = walkWKT(vt, e, f)
+				}
+			}
+		case fd.GetMessageType() == nil:
+		case fd.IsRepeated():
+			if list, ok := fv.([]any); ok {
+				for i, e := range list {
+					list[i] = walkWKT(fd.GetMessageType(), e, f)
+				}
+			}
+		default:
+			obj[key] = walkWKT(fd.GetMessageType(), fv, f)
+		}
+	}
+	return obj
+}
+
+// coerceWKTInput converts a non-canonical request value of well-known type name to its canonical form.
+func coerceWKTInput(name string, v any) any {
+	switch name {
+	case "google.protobuf.Timestamp":
+		if t, ok := parseLenientTimestamp(v); ok {
+			return t.UTC().Format(time.RFC3339Nano)
+		}
+	case "google.protobuf.Duration":
+		if d, ok := parseLenientDuration(v); ok {
+			return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+		}
+	case "google.protobuf.FieldMask":
+		switch v := v.(type) {
+		case string:
+			return map[string]any{"paths": snakePaths(strings.Split(v, ","))}
+		case []any:
+			paths := make([]string, 0, len(v))
+			for _, p := range v {
+				s, ok := p.(string)
+				if !ok {
+					return v
+				}
+				paths = append(paths, s)
+			}
+			return map[string]any{"paths": snakePaths(paths)}
+		}
+	case "google.protobuf.Struct", "google.protobuf.ListValue":
+		if s, ok := v.(string); ok {
+			var decoded any
+			if err := json.Unmarshal([]byte(s), &decoded); err == nil {
+				if _, obj := decoded.(map[string]any); obj == (name == "google.protobuf.Struct") {
+					return decoded
+				}
+			}
+		}
+	default:
+		if obj, ok := v.(map[string]any); ok && wrapperTypes[name] && len(obj) == 1 {
+			if inner, ok := obj["value"]; ok {
+				return inner
+			}
+		}
+	}
+	return v
+}
+
+// coerceWKTOutput renders a response value of well-known type name in the form selected by c.
+func (c *WKTCoercion) coerceWKTOutput(name string, v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	switch name {
+	case "google.protobuf.Timestamp":
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return v
+		}
+		switch c.Timestamps {
+		case TimestampUnix:
+			return json.Number(formatSeconds(t.Unix(), int64(t.Nanosecond())))
+		case TimestampUnixMillis:
+			return json.Number(strconv.FormatInt(t.UnixMilli(), 10))
+		}
+	case "google.protobuf.Duration":
+		if c.DurationSeconds && strings.HasSuffix(s, "s") {
+			if _, err := strconv.ParseFloat(strings.TrimSuffix(s, "s"), 64); err == nil {
+				return json.Number(strings.TrimSuffix(s, "s"))
+			}
+		}
+	}
+	return v
+}
+
+// formatSeconds renders sec seconds plus nanos (0 <= nanos < 1e9) as an exact decimal number.
+func formatSeconds(sec, nanos int64) string {
+	if nanos == 0 {
+		return strconv.FormatInt(sec, 10)
+	}
+	sign := ""
+	if sec < 0 {
+		sign, sec, nanos = "-", -sec-1, 1e9-nanos
+	}
+	return sign + strconv.FormatInt(sec, 10) + "." + strings.TrimRight(fmt.Sprintf("%09d", nanos), "0")
+}
+
+// parseLenientTimestamp accepts RFC 3339, RFC 3339 without a zone and dates (UTC), and unix seconds or
+// milliseconds as numbers or digit strings.
+func parseLenientTimestamp(v any) (time.Time, bool) {
+	var n string
+	switch v := v.(type) {
+	case json.Number:
+		n = string(v)
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+		n = v
+	default:
+		return time.Time{}, false
+	}
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return time.Time{}, false
+	}
+	if math.Abs(f) >= unixMillisThreshold {
+		f /= 1e3
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9))), true
+}
+
+// parseLenientDuration accepts numbers of seconds (also as strings) and Go durations.
+func parseLenientDuration(v any) (time.Duration, bool) {
+	var n string
+	switch v := v.(type) {
+	case json.Number:
+		n = string(v)
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return d, true
+		}
+		n = v
+	default:
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, false
+	}
+	return time.Duration(f * float64(time.Second)), true
+}
+
+// snakePaths converts FieldMask paths to the field names the message form of FieldMask holds, accepting
+// both the lowerCamelCase JSON names and the snake_case proto names.
+func snakePaths(paths []string) []any {
+	out := make([]any, 0, len(paths))
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		var b strings.Builder
+		for _, r := range p {
+			if 'A' <= r && r <= 'Z' {
+				b.WriteByte('_')
+				r += 'a' - 'A'
+			}
+			b.WriteRune(r)
+		}
+		out = append(out, b.String())
+	}
+	return out
+}
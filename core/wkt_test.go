@@ -0,0 +1,85 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/dynamic"
+	_ "google.golang.org/protobuf/types/known/durationpb" // registers the well-known types
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func wktTestMessage(t *testing.T) *desc.MessageDescriptor {
+	t.Helper()
+	load := func(name string) *builder.FieldType {
+		md, err := desc.LoadMessageDescriptor(name)
+		if err != nil || md == nil {
+			t.Fatalf("load %s: %v", name, err)
+		}
+		return builder.FieldTypeImportedMessage(md)
+	}
+	msg := builder.NewMessage("Event").
+		AddField(builder.NewField("created_at", load("google.protobuf.Timestamp"))).
+		AddField(builder.NewField("history", load("google.protobuf.Timestamp")).SetRepeated()).
+		AddField(builder.NewField("ttl", load("google.protobuf.Duration"))).
+		AddField(builder.NewField("update_mask", load("google.protobuf.FieldMask"))).
+		AddField(builder.NewField("attrs", load("google.protobuf.Struct"))).
+		AddField(builder.NewField("note", load("google.protobuf.StringValue"))).
+		AddField(builder.NewMapField("timeouts", builder.FieldTypeString(), load("google.protobuf.Duration")))
+	fd, err := builder.NewFile("acme/event.proto").SetPackageName("acme").AddMessage(msg).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	return fd.FindMessage("acme.Event")
+}
+
+func TestWKTCoercion_Request(t *testing.T) {
+	md := wktTestMessage(t)
+	body := `{
+		"createdAt": 1700000000,
+		"history": ["1700000000500", "2024-05-01", "2024-05-01T12:00:00"],
+		"ttl": "5m",
+		"update_mask": "displayName,address.zip_code",
+		"attrs": "{\"plan\":\"pro\"}",
+		"note": {"value": "hi"},
+		"timeouts": {"read": 1.5}
+	}`
+	got, err := (&WKTCoercion{}).coerceRequest(md, []byte(body))
+	if err != nil {
+		t.Fatalf("coerce: %v", err)
+	}
+	want := `{"attrs":{"plan":"pro"},"createdAt":"2023-11-14T22:13:20Z","history":["2023-11-14T22:13:20.5Z","2024-05-01T00:00:00Z","2024-05-01T12:00:00Z"],"note":"hi","timeouts":{"read":"1.5s"},"ttl":"300s","update_mask":{"paths":["display_name","address.zip_code"]}}`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	msg := dynamic.NewMessage(md)
+	if err := (&jsonpb.Unmarshaler{}).Unmarshal(bytes.NewReader(got), msg); err != nil {
+		t.Fatalf("coerced body does not decode: %v", err)
+	}
+}
+
+func TestWKTCoercion_Response(t *testing.T) {
+	md := wktTestMessage(t)
+	body := []byte(`{"createdAt":"2023-11-14T22:13:20.250Z","history":["2023-11-14T22:13:20Z"],"ttl":"1.5s","note":"<b>"}`)
+	got, err := (&WKTCoercion{Timestamps: TimestampUnixMillis, DurationSeconds: true}).coerceResponse(md, body)
+	if err != nil {
+		t.Fatalf("coerce: %v", err)
+	}
+	want := `{"createdAt":1700000000250,"history":[1700000000000],"note":"<b>","ttl":1.5}`
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	got, _ = (&WKTCoercion{Timestamps: TimestampUnix}).coerceResponse(md, body)
+	if want := `{"createdAt":1700000000.25,"history":[1700000000],"note":"<b>","ttl":"1.5s"}`; string(got) != want {
+		t.Fatalf("unix: got %s", got)
+	}
+	if got, _ := (&WKTCoercion{}).coerceResponse(md, body); !bytes.Equal(got, body) {
+		t.Fatalf("canonical forms rewritten: %s", got)
+	}
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	xdscreds "google.golang.org/grpc/credentials/xds"
+	_ "google.golang.org/grpc/xds" // registers the xds resolver and the balancers of xDS clusters
+)
+
+// Targets such as "xds:///users" are resolved through xDS: the gateway subscribes to the listener named by
+// the target at the control plane of the xDS bootstrap (the file named by $GRPC_XDS_BOOTSTRAP, or the JSON in
+// $GRPC_XDS_BOOTSTRAP_CONFIG), and calls follow the route configuration the control plane serves for it, as
+// proxyless gRPC clients in a service mesh do: routing by method and header, weighted clusters, endpoints,
+// load balancing, timeouts (the shorter of the route's and the call's), retries and fault injection. Security
+// configured by the control plane secures the connections; without it they are plaintext, as for other
+// targets.
+
+// xdsScheme is the scheme of targets resolved through xDS.
+const xdsScheme = "xds:"
+
+// IsXDSTarget reports whether target is resolved through xDS, e.g. "xds:///users".
+func IsXDSTarget(target string) bool {
+	return len(target) >= len(xdsScheme) && strings.EqualFold(target[:len(xdsScheme)], xdsScheme)
+}
+
+// xdsDialOption secures connections of xDS targets as their control plane configures, falling back to
+// plaintext. Credentials of WithTLS or TargetConfig.DialOptions, which come later, override it.
+func xdsDialOption() (grpc.DialOption, error) {
+	creds, err := xdscreds.NewClientCredentials(xdscreds.ClientOptions{FallbackCreds: insecure.NewCredentials()})
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(creds), nil
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listenerpb "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	routepb "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	routerpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
+	hcmpb "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	discoverypb "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	xdsserver "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/xds"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// xdsSnapshot routes the listener "echo" to one cluster whose only endpoint is addr, for calls whose path starts
+// with prefix.
+func xdsSnapshot(t *testing.T, version, prefix, addr string) *cache.Snapshot {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(addr)
+	portNum, _ := strconv.ParseUint(port, 10, 32)
+	router, _ := anypb.New(&routerpb.Router{})
+	hcm, err := anypb.New(&hcmpb.HttpConnectionManager{
+		RouteSpecifier: &hcmpb.HttpConnectionManager_RouteConfig{RouteConfig: &routepb.RouteConfiguration{
+			Name: "echo-routes",
+			VirtualHosts: []*routepb.VirtualHost{{
+				Name:    "echo",
+				Domains: []string{"*"},
+				Routes: []*routepb.Route{{
+					Match:  &routepb.RouteMatch{PathSpecifier: &routepb.RouteMatch_Prefix{Prefix: prefix}},
+					Action: &routepb.Route_Route{Route: &routepb.RouteAction{ClusterSpecifier: &routepb.RouteAction_Cluster{Cluster: "echo-cluster"}}},
+				}},
+			}},
+		}},
+		HttpFilters: []*hcmpb.HttpFilter{{Name: "router", ConfigType: &hcmpb.HttpFilter_TypedConfig{TypedConfig: router}}},
+	})
+	if err != nil {
+		t.Fatalf("listener: %v", err)
+	}
+	ads := &corepb.ConfigSource{ConfigSourceSpecifier: &corepb.ConfigSource_Ads{Ads: &corepb.AggregatedConfigSource{}}}
+	snap, err := cache.NewSnapshot(version, map[resource.Type][]types.Resource{
+		resource.ListenerType: {&listenerpb.Listener{Name: "echo", ApiListener: &listenerpb.ApiListener{ApiListener: hcm}}},
+		resource.ClusterType: {&clusterpb.Cluster{
+			Name:                 "echo-cluster",
+			ClusterDiscoveryType: &clusterpb.Cluster_Type{Type: clusterpb.Cluster_EDS},
+			EdsClusterConfig:     &clusterpb.Cluster_EdsClusterConfig{EdsConfig: ads},
+		}},
+		resource.EndpointType: {&endpointpb.ClusterLoadAssignment{
+			ClusterName: "echo-cluster",
+			Endpoints: []*endpointpb.LocalityLbEndpoints{{
+				Locality:            &corepb.Locality{Zone: "local"},
+				LoadBalancingWeight: wrapperspb.UInt32(1),
+				LbEndpoints: []*endpointpb.LbEndpoint{{HostIdentifier: &endpointpb.LbEndpoint_Endpoint{Endpoint: &endpointpb.Endpoint{
+					Address: &corepb.Address{Address: &corepb.Address_SocketAddress{SocketAddress: &corepb.SocketAddress{
+						Address: host, PortSpecifier: &corepb.SocketAddress_PortValue{PortValue: uint32(portNum)},
+					}}},
+				}}}},
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	return snap
+}
+
+func TestInvoker_XDSTarget(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterEchoServiceServer(srv, benchEchoServer{})
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	// The control plane.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	snapshots := cache.NewSnapshotCache(true, cache.IDHash{}, nil)
+	if err := snapshots.SetSnapshot(ctx, "gateway", xdsSnapshot(t, "1", "/echo.EchoService/", lis.Addr().String())); err != nil {
+		t.Fatalf("set snapshot: %v", err)
+	}
+	cpLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	cp := grpc.NewServer()
+	discoverypb.RegisterAggregatedDiscoveryServiceServer(cp, xdsserver.NewServer(ctx, snapshots, nil))
+	go func() { _ = cp.Serve(cpLis) }()
+	defer cp.Stop()
+
+	bootstrap := fmt.Sprintf(`{"xds_servers": [{"server_uri": %q, "channel_creds": [{"type": "insecure"}], "server_features": ["xds_v3"]}], "node": {"id": "gateway"}}`, cpLis.Addr())
+	r, err := xds.NewXDSResolverWithConfigForTesting([]byte(bootstrap))
+	if err != nil {
+		t.Fatalf("resolver: %v", err)
+	}
+	inv := NewInvoker(WithDescriptorDir(t.TempDir()), WithCallTimeout(5*time.Second),
+		WithTargetConfigs(map[string]TargetConfig{"xds:///echo": {DialOptions: []grpc.DialOption{grpc.WithResolvers(r)}}}))
+	defer inv.Close()
+
+	req := &InvokeRequest{Target: "xds:///echo", FullMethodName: benchMethod, Body: []byte(`{"message":"hi"}`)}
+	resp, err := inv.Invoke(context.Background(), req)
+	if err != nil || string(resp) != `{"message":"hi"}` {
+		t.Fatalf("invoke: %s, %v", resp, err)
+	}
+
+	// Calls follow route changes pushed by the control plane: here, a route that no longer matches the method.
+	if err := snapshots.SetSnapshot(ctx, "gateway", xdsSnapshot(t, "2", "/users.", lis.Addr().String())); err != nil {
+		t.Fatalf("set snapshot: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		_, err := inv.Invoke(context.Background(), req)
+		if status.Code(err) == codes.Unavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("call after the route changed: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestIsXDSTarget(t *testing.T) {
+	for target, want := range map[string]bool{"xds:///users": true, "XDS:///users": true, "dns:///users:443": false, "xds": false, "users:9000": false} {
+		if got := IsXDSTarget(target); got != want {
+			t.Errorf("IsXDSTarget(%q) = %v", target, got)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig is the cross-origin policy for browser callers (Options.CORS).
+type CORSConfig struct {
+	// AllowedOrigins lists origins allowed to call the gateway, e.g. "https://app.example.com". "*" allows any
+	// origin, and a "*." label allows subdomains, e.g. "https://*.example.com".
+	AllowedOrigins []string
+	// AllowedMethods for preflight requests; default POST, GET and OPTIONS.
+	AllowedMethods []string
+	// AllowedHeaders for preflight requests; default Content-Type plus every request header the gateway reads
+	// (X-Request-Id, X-Gateway-Target, X-Gateway-Timeout, X-Gateway-Encoding, the signature headers,
+	// Idempotency-Key, X-API-Key, If-None-Match, ...) except X-Gateway-Admin-Token. "*" reflects whatever the
+	// browser asks for.
+	AllowedHeaders []string
+	// ExposedHeaders readable by scripts; default every response header the gateway sets beyond the
+	// CORS-safelisted ones (X-Request-Id, X-Gateway-Trace, ETag, Idempotent-Replayed, Deprecation, Sunset,
+	// Retry-After, Location, ...).
+	ExposedHeaders []string
+	// MaxAge lets browsers cache preflight results; zero omits the header.
+	MaxAge time.Duration
+	// AllowCredentials permits cookies and HTTP auth. It requires AllowedOrigins to list the origins: Handler
+	// panics if they include "*", which would let any website make credentialed calls.
+	AllowCredentials bool
+}
+
+var (
+	defaultCORSMethods = []string{http.MethodPost, http.MethodGet, http.MethodOptions}
+	// defaultCORSHeaders and defaultCORSExposed are the one list of the gateway's request and response
+	// headers; a header constant added elsewhere belongs in one of them (see TestDefaultCORSHeaders).
+	defaultCORSHeaders = []string{"Content-Type", requestIDHeader, targetHeader, descriptorIDHeader,
+		descriptorTokenHeader, traceHeader, gatewayTimeoutHeader, grpcTimeoutHeader, targetOverrideHeader,
+		encodingHeader, symmetricResponseHeader, encryptionKeyIDHeader, signatureHeader, signatureKeyIDHeader,
+		signatureTimestampHeader, signatureNonceHeader, idempotencyKeyHeader, debugHeader, fetchAllHeader,
+		longPollHeader, echoHeader, apiKeyHeader, ifNoneMatchHeader}
+	defaultCORSExposed = []string{requestIDHeader, traceHeader, encodingHeader, encryptionKeyIDHeader, etagHeader,
+		idempotentReplayedHeader, unknownFieldsHeader, deprecationHeader, sunsetHeader, linkHeader,
+		retryAfterHeader, contentDispositionHeader, locationHeader}
+)
+
+// handleCORS applies the policy to r. It reports true when the request was a preflight and has been answered;
+// preflights from disallowed origins are answered through reject.
+func (c *CORSConfig) handleCORS(w http.ResponseWriter, r *http.Request, reject func(w http.ResponseWriter, r *http.Request, status int, code, msg string)) bool {
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	w.Header().Add("Vary", "Origin")
+	if origin == "" {
+		return false
+	}
+	if !c.originAllowed(origin) {
+		if preflight {
+			reject(w, r, http.StatusForbidden, ErrCodeForbidden, "origin not allowed: "+origin)
+			return true
+		}
+		return false
+	}
+
+	h := w.Header()
+	if c.allowsAnyOrigin() {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if !preflight {
+		h.Set("Access-Control-Expose-Headers", strings.Join(orDefault(c.ExposedHeaders, defaultCORSExposed), ", "))
+		return false
+	}
+
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	h.Set("Access-Control-Allow-Methods", strings.Join(orDefault(c.AllowedMethods, defaultCORSMethods), ", "))
+	allowed := orDefault(c.AllowedHeaders, defaultCORSHeaders)
+	if len(allowed) == 1 && allowed[0] == "*" {
+		if req := r.Header.Get("Access-Control-Request-Headers"); req != "" {
+			h.Set("Access-Control-Allow-Headers", req)
+		}
+	} else {
+		h.Set("Access-Control-Allow-Headers", strings.Join(allowed, ", "))
+	}
+	if c.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// validate rejects AllowCredentials with the "*" origin, which the CORS spec forbids.
+func (c *CORSConfig) validate() error {
+	if c.AllowCredentials && c.allowsAnyOrigin() {
+		return errors.New(`CORS cannot allow credentials for the "*" origin; list the allowed origins instead`)
+	}
+	return nil
+}
+
+func (c *CORSConfig) allowsAnyOrigin() bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORSConfig) originAllowed(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+		// "https://*.example.com" matches "https://api.example.com" but not "https://example.com".
+		if prefix, suffix, ok := strings.Cut(o, "*."); ok {
+			if len(origin) > len(prefix)+len(suffix)+1 &&
+				strings.HasPrefix(strings.ToLower(origin), strings.ToLower(prefix)) &&
+				strings.HasSuffix(strings.ToLower(origin), "."+strings.ToLower(suffix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func orDefault(v, def []string) []string {
+	if len(v) == 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGateway_CORS(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	srv := httptest.NewServer(Handler(Options{CORS: &CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		MaxAge:           10 * time.Minute,
+		AllowCredentials: true,
+	}}))
+	defer srv.Close()
+
+	preflight := func(origin string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodOptions, srv.URL, nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "content-type")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("preflight: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := preflight("https://api.example.org")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("preflight status = %d", resp.StatusCode)
+	}
+	for k, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://api.example.org",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "600",
+		"Access-Control-Allow-Methods":     "POST, GET, OPTIONS",
+	} {
+		if got := resp.Header.Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+	allowed := strings.Split(resp.Header.Get("Access-Control-Allow-Headers"), ", ")
+	for _, h := range []string{encodingHeader, encryptionKeyIDHeader, signatureHeader, signatureKeyIDHeader,
+		signatureTimestampHeader, idempotencyKeyHeader, debugHeader} {
+		if !slices.Contains(allowed, h) {
+			t.Errorf("Access-Control-Allow-Headers = %q, missing %s", allowed, h)
+		}
+	}
+	if resp := preflight("https://example.org"); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("disallowed origin preflight status = %d", resp.StatusCode)
+	}
+
+	raw, _ := json.Marshal(map[string]any{"target": target, "method": "/echo.EchoService/Echo"})
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, bytes.NewBufferString(encodeBase64V1(raw)))
+	req.Header.Set("Origin", "https://app.example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		resp.Header.Get("Access-Control-Expose-Headers") != strings.Join(defaultCORSExposed, ", ") {
+		t.Fatalf("unexpected actual response: %d %v", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestHandler_CORSCredentialsWithAnyOrigin(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(r.(string), "credentials") {
+			t.Fatalf("recover() = %v, want a panic about credentials", r)
+		}
+	}()
+	Handler(Options{CORS: &CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}})
+}
+
+// TestDefaultCORSHeaders checks that every header constant of the package is allowed or exposed by the
+// default CORS policy, so browsers can use headers added after the policy was written.
+func TestDefaultCORSHeaders(t *testing.T) {
+	notForBrowsers := map[string]bool{
+		adminTokenHeader: true, // admin endpoints are not meant to be called cross-origin
+		apiVersionHeader: true, // gRPC metadata of GatewayService, not an HTTP header
+	}
+	pkgs, err := parser.ParseDir(token.NewFileSet(), ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var headers []string
+	for _, f := range pkgs["gateway"].Files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, name := range vs.Names {
+					lit, ok := vs.Values[i].(*ast.BasicLit)
+					if !strings.HasSuffix(name.Name, "Header") || !ok || lit.Kind != token.STRING {
+						continue
+					}
+					v, _ := strconv.Unquote(lit.Value)
+					headers = append(headers, v)
+				}
+			}
+		}
+	}
+	if len(headers) < 20 {
+		t.Fatalf("found only %d header constants: %v", len(headers), headers)
+	}
+	for _, h := range headers {
+		if !notForBrowsers[h] && !slices.Contains(defaultCORSHeaders, h) && !slices.Contains(defaultCORSExposed, h) {
+			t.Errorf("%s is neither an allowed nor an exposed default CORS header", h)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/keicoqk/gateway/core"
+	pb "github.com/keicoqk/gateway/example/pb"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGateway_TargetCredentials(t *testing.T) {
+	seen := make(chan string, 1)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		seen <- strings.Join(md.Get("authorization"), ",")
+		return handler(ctx, req)
+	}))
+	pb.RegisterEchoServiceServer(s, echoServer{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+	target := lis.Addr().String()
+
+	var issued atomic.Int32
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" {
+			http.Error(w, "bad grant", http.StatusBadRequest)
+			return
+		}
+		issued.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"access_token":"minted","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer tokens.Close()
+
+	for _, tc := range []struct {
+		name string
+		cfg  core.TargetConfig
+		want string
+	}{
+		{"static", core.TargetConfig{Credentials: core.BearerToken("static-token"), InsecureCredentials: true}, "Bearer static-token"},
+		{"client credentials", core.TargetConfig{Credentials: core.ClientCredentials(&clientcredentials.Config{
+			ClientID: "gw", ClientSecret: "secret", TokenURL: tokens.URL,
+		}), InsecureCredentials: true}, "Bearer minted"},
+	} {
+		srv := httptest.NewServer(Handler(Options{Targets: map[string]core.TargetConfig{target: tc.cfg}}))
+		for i := 0; i < 2; i++ {
+			code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+			if code != http.StatusOK {
+				t.Fatalf("%s: status=%d body=%s", tc.name, code, b)
+			}
+			if got := <-seen; got != tc.want {
+				t.Fatalf("%s: authorization = %q, want %q", tc.name, got, tc.want)
+			}
+		}
+		srv.Close()
+	}
+	if n := issued.Load(); n != 1 {
+		t.Fatalf("token endpoint called %d times, want 1", n)
+	}
+
+	// Without InsecureCredentials, credentials are never sent in clear.
+	srv := httptest.NewServer(Handler(Options{Targets: map[string]core.TargetConfig{target: {Credentials: core.BearerToken("t")}}}))
+	defer srv.Close()
+	code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+	if code != http.StatusBadGateway || !strings.Contains(string(b), "transport level security") {
+		t.Fatalf("plaintext: status=%d body=%s", code, b)
+	}
+}
@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	grpcTimeoutHeader    = "Grpc-Timeout"
+	gatewayTimeoutHeader = "X-Gateway-Timeout"
+)
+
+// requestTimeout returns the caller's deadline from the grpc-timeout header (gRPC wire format, e.g. "1500m"
+// for 1500 milliseconds) or X-Gateway-Timeout (Go duration only, e.g. "1.5s" or "10m" for ten minutes). Zero
+// means the caller set none. When both are present the shorter one wins.
+func requestTimeout(r *http.Request) (time.Duration, error) {
+	var timeout time.Duration
+	for _, h := range []string{grpcTimeoutHeader, gatewayTimeoutHeader} {
+		v := r.Header.Get(h)
+		if v == "" {
+			continue
+		}
+		parse := parseGRPCTimeout
+		if h == gatewayTimeoutHeader {
+			parse = time.ParseDuration
+		}
+		d, err := parse(v)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid %s header %q", h, v)
+		}
+		if timeout == 0 || d < timeout {
+			timeout = d
+		}
+	}
+	return timeout, nil
+}
+
+// parseGRPCTimeout decodes the grpc-timeout wire format: at most 8 ASCII digits followed by a unit
+// (H hours, M minutes, S seconds, m milliseconds, u microseconds, n nanoseconds).
+func parseGRPCTimeout(v string) (time.Duration, error) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, fmt.Errorf("bad grpc-timeout length")
+	}
+	var unit time.Duration
+	switch v[len(v)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, fmt.Errorf("bad grpc-timeout unit")
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad grpc-timeout value")
+	}
+	if n > math.MaxInt64/int64(unit) {
+		return time.Duration(math.MaxInt64), nil
+	}
+	return time.Duration(n) * unit, nil
+}
@@ -0,0 +1,109 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+)
+
+func TestParseGRPCTimeout(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"1S":        time.Second,
+		"1500m":     1500 * time.Millisecond,
+		"2M":        2 * time.Minute,
+		"10u":       10 * time.Microsecond,
+		"99999999H": time.Duration(1<<63 - 1),
+	} {
+		got, err := parseGRPCTimeout(in)
+		if err != nil || got != want {
+			t.Errorf("parseGRPCTimeout(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "S", "1s", "123456789S", "-1S"} {
+		if _, err := parseGRPCTimeout(in); err == nil {
+			t.Errorf("parseGRPCTimeout(%q): expected error", in)
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		header, value string
+		want          time.Duration
+	}{
+		{gatewayTimeoutHeader, "10m", 10 * time.Minute},
+		{gatewayTimeoutHeader, "1h", time.Hour},
+		{gatewayTimeoutHeader, "1.5s", 1500 * time.Millisecond},
+		{grpcTimeoutHeader, "10m", 10 * time.Millisecond},
+		{grpcTimeoutHeader, "5M", 5 * time.Minute},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set(tc.header, tc.value)
+		if got, err := requestTimeout(r); err != nil || got != tc.want {
+			t.Errorf("%s: %s = %v, %v; want %v", tc.header, tc.value, got, err, tc.want)
+		}
+	}
+	// X-Gateway-Timeout takes Go durations only, not the gRPC wire format.
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set(gatewayTimeoutHeader, "5M")
+	if _, err := requestTimeout(r); err == nil {
+		t.Error(`X-Gateway-Timeout "5M": expected error`)
+	}
+}
+
+func TestGateway_DeadlinePropagation(t *testing.T) {
+	remaining := make(chan time.Duration, 1)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var d time.Duration
+		if deadline, ok := ctx.Deadline(); ok {
+			d = time.Until(deadline)
+		}
+		remaining <- d
+		return handler(ctx, req)
+	}))
+	pb.RegisterEchoServiceServer(s, echoServer{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	srv := httptest.NewServer(Handler(Options{
+		Timeout: 10 * time.Second,
+		Methods: map[string]MethodConfig{"/echo.EchoService/Echo": {Timeout: 5 * time.Second}},
+	}))
+	defer srv.Close()
+
+	body := map[string]any{"target": lis.Addr().String(), "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}
+	cases := []struct {
+		name   string
+		header map[string]string
+		max    time.Duration
+		min    time.Duration
+	}{
+		{"method config", nil, 5 * time.Second, 4 * time.Second},
+		{"grpc-timeout", map[string]string{"grpc-timeout": "2S"}, 2 * time.Second, time.Second},
+		{"x-gateway-timeout", map[string]string{"X-Gateway-Timeout": "1500ms"}, 1500 * time.Millisecond, 500 * time.Millisecond},
+		{"header longer than config", map[string]string{"grpc-timeout": "1M"}, 5 * time.Second, 4 * time.Second},
+	}
+	for _, tc := range cases {
+		code, b := postGateway(t, srv.URL, body, tc.header)
+		if code != http.StatusOK {
+			t.Fatalf("%s: status=%d body=%s", tc.name, code, b)
+		}
+		if d := <-remaining; d > tc.max || d < tc.min {
+			t.Fatalf("%s: upstream deadline %v, want in [%v, %v]", tc.name, d, tc.min, tc.max)
+		}
+	}
+
+	if code, _ := postGateway(t, srv.URL, body, map[string]string{"grpc-timeout": "soon"}); code != http.StatusBadRequest {
+		t.Fatalf("invalid header: expected 400, got %d", code)
+	}
+}
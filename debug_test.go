@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGateway_DebugDiagnostics(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}, "debug": true}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	var got struct {
+		Message string `json:"message"`
+		Gateway struct {
+			Method           string `json:"method"`
+			Peer             string `json:"peer"`
+			DescriptorSource string `json:"descriptor_source"`
+			Attempts         int    `json:"attempts"`
+		} `json:"_gateway"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("decode %s: %v", b, err)
+	}
+	if got.Message != "hi" || got.Gateway.Method != "/echo.EchoService/Echo" || got.Gateway.Peer != target ||
+		got.Gateway.DescriptorSource != "directory" || got.Gateway.Attempts != 1 {
+		t.Fatalf("unexpected response %s", b)
+	}
+
+	code, b = postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+	if code != http.StatusOK || string(b) != `{"message":"hi"}` {
+		t.Fatalf("without debug: status=%d body=%s", code, b)
+	}
+}
@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/keicoqk/gateway/core"
+)
+
+// Deprecation marks a method (MethodConfig.Deprecation) or API version (APIVersion.Deprecation) deprecated.
+// Calls to it get the Deprecation header (RFC 9745), and the Sunset header (RFC 8594) and a Link to the
+// migration docs when set, so clients can find out before the method goes away. Methods declared with option deprecated = true (on the method or its
+// service) are treated as deprecated without dates when they have no Deprecation of their own.
+type Deprecation struct {
+	// Since is when the method was deprecated; zero sends "Deprecation: true".
+	Since time.Time
+	// Sunset is when the method stops being served, if planned.
+	Sunset time.Time
+	// Link is a URL documenting the deprecation, sent as Link: <url>; rel="deprecation".
+	Link string
+	// RejectAfterSunset answers calls after Sunset with 410 instead of passing them on.
+	RejectAfterSunset bool
+}
+
+// DeprecatedCall is reported to Options.OnDeprecatedCall for every call to a deprecated method.
+type DeprecatedCall struct {
+	Method string
+	// Version is the Options.Versions entry called, if any; the whole version is deprecated if the method has
+	// no Deprecation of its own.
+	Version string
+	// Client identifies the caller like Options.Quota does: the QuotaConfig.ClientKey if set, otherwise the
+	// remote IP.
+	Client   string
+	Sunset   time.Time // zero if none is planned
+	Rejected bool      // the call came after the sunset and was refused
+}
+
+// checkDeprecation returns the core.InvokeRequest.OnResolve hook that signals the deprecation of the resolved
+// method on w, reports the call and rejects it after the sunset if configured to.
+func (h *handler) checkDeprecation(w http.ResponseWriter, r *http.Request, opts Options) func(method *desc.MethodDescriptor) error {
+	return func(md *desc.MethodDescriptor) error {
+		method := "/" + md.GetService().GetFullyQualifiedName() + "/" + md.GetName()
+		dep := opts.methodConfig(method).Deprecation
+		retired := "method " + method
+		if dep == nil && opts.versionDeprecation != nil {
+			dep, retired = opts.versionDeprecation, "API version "+opts.version
+		}
+		if dep == nil {
+			if !md.GetMethodOptions().GetDeprecated() && !md.GetService().GetServiceOptions().GetDeprecated() {
+				return nil
+			}
+			dep = &Deprecation{}
+		}
+
+		header := w.Header()
+		if dep.Since.IsZero() {
+			header.Set(deprecationHeader, "true")
+		} else {
+			header.Set(deprecationHeader, "@"+strconv.FormatInt(dep.Since.Unix(), 10))
+		}
+		if !dep.Sunset.IsZero() {
+			header.Set(sunsetHeader, dep.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if dep.Link != "" {
+			header.Add(linkHeader, "<"+dep.Link+`>; rel="deprecation"`)
+		}
+
+		var key func(r *http.Request) string
+		if opts.Quota != nil {
+			key = opts.Quota.ClientKey
+		}
+		call := DeprecatedCall{Method: method, Version: opts.version, Client: clientKey(key, r), Sunset: dep.Sunset}
+		now := core.ClockFromContext(r.Context(), opts.Clock).Now()
+		call.Rejected = dep.RejectAfterSunset && !dep.Sunset.IsZero() && !now.Before(dep.Sunset)
+		outcome := "served"
+		if call.Rejected {
+			outcome = "rejected"
+		}
+		h.metrics.Add("gateway_deprecated_calls_total", 1, "method", method, "outcome", outcome)
+		if opts.OnDeprecatedCall != nil {
+			opts.OnDeprecatedCall(r, call)
+		}
+		if call.Rejected {
+			return &authorizationError{status: http.StatusGone, code: ErrCodeGone, msg: retired + " was retired on " + dep.Sunset.UTC().Format(time.DateOnly)}
+		}
+		return nil
+	}
+}
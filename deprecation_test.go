@@ -0,0 +1,116 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestGateway_DeprecatedMethod(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	clock := core.NewFakeClock(time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC))
+	metrics := core.NewMemoryMetrics()
+	var calls []DeprecatedCall
+	srv := httptest.NewServer(Handler(Options{
+		Path:    "/grpc-gateway",
+		Clock:   clock,
+		Metrics: metrics,
+		Methods: map[string]MethodConfig{"/echo.EchoService/Echo": {Deprecation: &Deprecation{
+			Since:             time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			Sunset:            time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC),
+			Link:              "https://docs.example.com/echo-v2",
+			RejectAfterSunset: true,
+		}}},
+		OnDeprecatedCall: func(r *http.Request, call DeprecatedCall) { calls = append(calls, call) },
+	}))
+	defer srv.Close()
+
+	call := func() *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/echo.EchoService/Echo", strings.NewReader(`{"message":"hi"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(targetHeader, target)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("call: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := call()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Deprecation"); got != "@1767225600" {
+		t.Fatalf("Deprecation = %q", got)
+	}
+	if got := resp.Header.Get("Sunset"); got != "Tue, 30 Jun 2026 00:00:00 GMT" {
+		t.Fatalf("Sunset = %q", got)
+	}
+	if got := resp.Header.Get("Link"); got != `<https://docs.example.com/echo-v2>; rel="deprecation"` {
+		t.Fatalf("Link = %q", got)
+	}
+	if len(calls) != 1 || calls[0].Client != "127.0.0.1" || calls[0].Method != "/echo.EchoService/Echo" || calls[0].Rejected {
+		t.Fatalf("calls = %+v", calls)
+	}
+
+	clock.Advance(30 * 24 * time.Hour)
+	if resp := call(); resp.StatusCode != http.StatusGone || resp.Header.Get("Sunset") == "" {
+		t.Fatalf("after sunset: status=%d headers=%v", resp.StatusCode, resp.Header)
+	}
+	if len(calls) != 2 || !calls[1].Rejected {
+		t.Fatalf("calls = %+v", calls)
+	}
+	if metrics.Get("gateway_deprecated_calls_total", "method", "/echo.EchoService/Echo", "outcome", "served") != 1 ||
+		metrics.Get("gateway_deprecated_calls_total", "method", "/echo.EchoService/Echo", "outcome", "rejected") != 1 {
+		t.Fatalf("metrics = %v", metrics.Snapshot())
+	}
+}
+
+func TestGateway_DeprecatedOption(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	// echo.EchoService as the server implements it, with Echo declared deprecated.
+	req := builder.NewMessage("EchoRequest").AddField(builder.NewField("message", builder.FieldTypeString()))
+	resp := builder.NewMessage("EchoResponse").AddField(builder.NewField("message", builder.FieldTypeString()))
+	echo := builder.NewMethod("Echo", builder.RpcTypeMessage(req, false), builder.RpcTypeMessage(resp, false)).
+		SetOptions(&descriptorpb.MethodOptions{Deprecated: proto.Bool(true)})
+	fd, err := builder.NewFile("echo.proto").SetPackageName("echo").AddMessage(req).AddMessage(resp).
+		AddService(builder.NewService("EchoService").AddMethod(echo)).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	set, _ := proto.Marshal(desc.ToFileDescriptorSet(fd))
+
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway"}))
+	defer srv.Close()
+	body := map[string]any{"target": target, "service": "echo.EchoService", "method": "Echo", "descriptor": base64.StdEncoding.EncodeToString(set), "params": map[string]any{"message": "hi"}}
+	b, _ := json.Marshal(body)
+	httpResp, err := http.Post(srv.URL+"/grpc-gateway", "text/plain", strings.NewReader(encodeBase64V1(b)))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK || httpResp.Header.Get("Deprecation") != "true" || httpResp.Header.Get("Sunset") != "" {
+		t.Fatalf("status=%d headers=%v", httpResp.StatusCode, httpResp.Header)
+	}
+
+	// The embedded echo descriptor does not declare it deprecated.
+	code, _ := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{"target": target, "method": "/echo.EchoService/Echo"}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+}
@@ -0,0 +1,34 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// echoRequest answers r with the upstream request invokeReq maps to, see Options.RequestEcho.
+func (h *handler) echoRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, invokeReq core.InvokeRequest) {
+	canonical, err := h.inv.Canonicalize(ctx, &invokeReq)
+	if err != nil {
+		var denied *authorizationError
+		switch {
+		case errors.As(err, &denied):
+			h.writeError(w, r, denied.status, denied.code, denied.msg)
+		case errors.Is(err, core.ErrUnknownFields), errors.Is(err, core.ErrInvalidStreamBody), errors.Is(err, core.ErrInvalidQuery), errors.Is(err, core.ErrUnsafeInt64), errors.Is(err, core.ErrInvalidBinding):
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		default:
+			h.writeInvokeError(w, r, err, nil)
+		}
+		return
+	}
+	h.metrics.Add("gateway_request_echoes_total", 1, "method", canonical.Method)
+	body, err := json.Marshal(canonical)
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	h.writeResponseBody(w, r, body)
+}
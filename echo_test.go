@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+func TestGateway_RequestEcho(t *testing.T) {
+	target := "127.0.0.1:1" // nothing listens: the upstream is not called
+
+	metrics := core.NewMemoryMetrics()
+	srv := httptest.NewServer(Handler(Options{RequestEcho: true, Metrics: metrics}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{
+		"target": target, "method": "/echo.EchoService/Echo", "echo": true,
+		"body": map[string]any{"message": "hi"}, "metadata": map[string]any{"x-tenant": "acme"},
+	}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("echo: status=%d body=%s", code, b)
+	}
+	var got core.CanonicalRequest
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("decode %s: %v", b, err)
+	}
+	if got.Method != "/echo.EchoService/Echo" || got.Target != target || got.Metadata["x-tenant"][0] != "acme" || len(got.Messages) != 1 {
+		t.Fatalf("echo: %s", b)
+	}
+	// message = "hi" is field 1, length-delimited.
+	if m := got.Messages[0]; string(m.Binary) != "\x0a\x02hi" || string(m.JSON) != `{"message":"hi"}` {
+		t.Fatalf("message: %q %s", m.Binary, m.JSON)
+	}
+	if n := metrics.Get("gateway_request_echoes_total", "method", "/echo.EchoService/Echo"); n != 1 {
+		t.Fatalf("echo metric = %v", n)
+	}
+
+	// Disabled by default.
+	off := httptest.NewServer(Handler(Options{}))
+	defer off.Close()
+	if code, b := postGateway(t, off.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{}}, map[string]string{echoHeader: "1"}); code != http.StatusBadRequest {
+		t.Fatalf("disabled: status=%d body=%s", code, b)
+	}
+}
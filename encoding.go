@@ -1,47 +1,222 @@
 package gateway
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// Body codecs of the X-Gateway-Encoding header, which selects the encoding of each request body. Without
+// the header the gateway detects it: gzip by its magic bytes, aesgcm by an X-Gateway-Encryption-Key-Id
+// header, and on the envelope endpoint plain for a JSON object and b64v1 otherwise, so clients predating the
+// header keep working. Method routes default to plain.
+const (
+	EncodingB64V1  = "b64v1"  // reversed standard base64, see encodeBase64V1
+	EncodingPlain  = "plain"  // the body as is
+	EncodingGzip   = "gzip"   // gzip-compressed body
+	EncodingAESGCM = "aesgcm" // AES-GCM sealed body, see EncryptionConfig; "b64v2" is accepted as an alias
 )
 
+const encodingHeader = "X-Gateway-Encoding"
+
+// maxDecompressedBody bounds gzip request bodies, which could otherwise expand without limit.
+const maxDecompressedBody = 32 << 20
+
 // encodeBase64V1 / decodeBase64V1 implement a simple "base64 variant":
 // - encode raw JSON with standard base64.StdEncoding
 // - then reverse the entire string (slight obfuscation, to distinguish from plain base64)
-//
-// Note: the gateway expects all HTTP request bodies to use this encoding; no extra header is required.
 func encodeBase64V1(plain []byte) string {
-	s := base64.StdEncoding.EncodeToString(plain)
-	r := []rune(s)
-	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
-		r[i], r[j] = r[j], r[i]
-	}
-	return string(r)
+	b := make([]byte, base64.StdEncoding.EncodedLen(len(plain)))
+	base64.StdEncoding.Encode(b, plain)
+	slices.Reverse(b) // base64 is ASCII, so reversing bytes reverses characters
+	return string(b)
 }
 
 func decodeBase64V1(s string) ([]byte, error) {
 	if s == "" {
 		return nil, nil
 	}
-	r := []rune(s)
-	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
-		r[i], r[j] = r[j], r[i]
+	buf := core.GetBuffer()
+	defer core.PutBuffer(buf)
+	buf.WriteString(s)
+	return decodeReversedBase64(buf.Bytes())
+}
+
+// decodeReversedBase64 decodes src, b64v1 text, into a new slice. It reverses src in place.
+func decodeReversedBase64(src []byte) ([]byte, error) {
+	slices.Reverse(src)
+	dst := make([]byte, base64.StdEncoding.DecodedLen(len(src)))
+	n, err := base64.StdEncoding.Decode(dst, src)
+	if err != nil {
+		return nil, err
 	}
-	return base64.StdEncoding.DecodeString(string(r))
+	return dst[:n], nil
 }
 
-// decodeRequestBody decodes the entire HTTP body with b64v1 rules.
-// Returns an error if decoding fails.
-func decodeRequestBody(r *http.Request) ([]byte, error) {
-	raw, err := io.ReadAll(r.Body)
+// decodeRequestBody reads and decodes r's body under its codec; envelope selects the envelope endpoint's
+// detection rules. The returned request carries the codec for writeResponseBody.
+func (h *handler) decodeRequestBody(r *http.Request, envelope bool) ([]byte, *http.Request, error) {
+	// The encoded body is only needed while decoding, so it is read into a pooled buffer; the decoded body
+	// outlives the request (async jobs, idempotency records) and gets its own exactly sized slice.
+	buf := core.GetBuffer()
+	defer core.PutBuffer(buf)
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		return nil, r, fmt.Errorf("read body: %w", err)
+	}
+	enc, err := h.requestEncoding(r, buf.Bytes(), envelope)
 	if err != nil {
-		return nil, fmt.Errorf("read body: %w", err)
+		return nil, r, err
 	}
-	decoded, err := decodeBase64V1(string(raw))
+	codec := &requestCodec{encoding: enc}
+	var decoded []byte
+	switch {
+	case buf.Len() == 0:
+		if enc == EncodingAESGCM {
+			return nil, r, errors.New("decode aesgcm: empty body")
+		}
+	case enc == EncodingB64V1:
+		if decoded, err = decodeReversedBase64(buf.Bytes()); err != nil {
+			return nil, r, fmt.Errorf("decode b64v1: %w", err)
+		}
+	case enc == EncodingGzip:
+		if decoded, err = gunzip(buf); err != nil {
+			return nil, r, fmt.Errorf("decode gzip: %w", err)
+		}
+	case enc == EncodingAESGCM:
+		if decoded, codec.cipher, err = h.openRequest(r, buf.Bytes()); err != nil {
+			return nil, r, err
+		}
+	default:
+		decoded = bytes.Clone(buf.Bytes())
+	}
+	return decoded, r.WithContext(context.WithValue(r.Context(), requestCodecKey{}, codec)), nil
+}
+
+// gunzip decompresses src, up to maxDecompressedBody bytes.
+func gunzip(src io.Reader) ([]byte, error) {
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := io.ReadAll(io.LimitReader(zr, maxDecompressedBody+1))
 	if err != nil {
-		return nil, fmt.Errorf("decode b64v1: %w", err)
+		return nil, err
+	}
+	if len(decoded) > maxDecompressedBody {
+		return nil, fmt.Errorf("body exceeds %d bytes", maxDecompressedBody)
 	}
 	return decoded, nil
 }
+
+// requestCodec is the negotiated codec of a request, kept in its context for encoding the response.
+type requestCodec struct {
+	encoding  string
+	cipher    *bodyCipher // aesgcm only
+	symmetric bool        // encode the response with the request's codec, see Options.SymmetricResponses
+}
+
+type requestCodecKey struct{}
+
+// setSymmetricResponse makes the response to r use r's codec.
+func setSymmetricResponse(r *http.Request) {
+	if codec, ok := r.Context().Value(requestCodecKey{}).(*requestCodec); ok {
+		codec.symmetric = true
+	}
+}
+
+// responseEncoding returns the codec writeResponseBody encodes the response to r with.
+func responseEncoding(r *http.Request) string {
+	if codec, _ := r.Context().Value(requestCodecKey{}).(*requestCodec); codec != nil && (codec.symmetric || codec.cipher != nil) {
+		return codec.encoding
+	}
+	return EncodingPlain
+}
+
+// writeResponseBody answers r with a successful JSON response. The body is plain unless r's codec is aesgcm
+// (always sealed) or the response is symmetric; the X-Gateway-Encoding header tells clients how to decode it.
+func (h *handler) writeResponseBody(w http.ResponseWriter, r *http.Request, body []byte) {
+	body, err := encodeResponseBody(w, r, body)
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+// encodeResponseBody encodes body as writeResponseBody sends it and sets the headers describing it.
+func encodeResponseBody(w http.ResponseWriter, r *http.Request, body []byte) ([]byte, error) {
+	enc := responseEncoding(r)
+	codec, _ := r.Context().Value(requestCodecKey{}).(*requestCodec)
+	contentType := "text/plain; charset=utf-8"
+	switch enc {
+	case EncodingAESGCM:
+		sealed, err := codec.cipher.seal("response", body)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt response: %w", err)
+		}
+		w.Header().Set(encryptionKeyIDHeader, codec.cipher.keyID)
+		body = sealed
+	case EncodingB64V1:
+		body = []byte(encodeBase64V1(body))
+	case EncodingGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = zw.Write(body)
+		_ = zw.Close()
+		body, contentType = buf.Bytes(), "application/gzip"
+	default:
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set(encodingHeader, enc)
+	return body, nil
+}
+
+// encodingError reports a body codec the gateway refuses, as opposed to a malformed body.
+type encodingError struct{ error }
+
+// requestEncoding returns the codec of r's body from X-Gateway-Encoding or, without the header, detected
+// from body.
+func (h *handler) requestEncoding(r *http.Request, body []byte, envelope bool) (string, error) {
+	enc := strings.ToLower(strings.TrimSpace(r.Header.Get(encodingHeader)))
+	switch {
+	case enc == "b64v2":
+		enc = EncodingAESGCM
+	case enc != "":
+	case bytes.HasPrefix(body, []byte{0x1f, 0x8b}):
+		enc = EncodingGzip
+	case r.Header.Get(encryptionKeyIDHeader) != "":
+		enc = EncodingAESGCM
+	case !envelope:
+		enc = EncodingPlain
+	case bytes.HasPrefix(bytes.TrimLeft(body, " \t\r\n"), []byte("{")):
+		enc = EncodingPlain
+	default:
+		enc = EncodingB64V1
+	}
+	encryption := h.live.Load().opts.Encryption
+	switch enc {
+	case EncodingB64V1, EncodingPlain, EncodingGzip:
+	case EncodingAESGCM:
+		if encryption == nil {
+			return "", encodingError{fmt.Errorf("body encoding %s is not enabled", EncodingAESGCM)}
+		}
+		return enc, nil
+	default:
+		return "", encodingError{fmt.Errorf("unsupported body encoding %q", enc)}
+	}
+	if encryption != nil && encryption.Required {
+		return "", encodingError{fmt.Errorf("request body must be encrypted (%s: %s)", encodingHeader, EncodingAESGCM)}
+	}
+	return enc, nil
+}
@@ -2,8 +2,13 @@ package gateway
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -41,7 +46,7 @@ func TestDecodeRequestBody_UsesB64V1(t *testing.T) {
 	r := httptest.NewRequest(http.MethodPost, "/grpc-gateway", bytes.NewBufferString(encoded))
 	r.Header.Set("Content-Type", "application/json")
 
-	decoded, err := decodeRequestBody(r)
+	decoded, _, err := newHandler(Options{}, "").decodeRequestBody(r, true)
 	if err != nil {
 		t.Fatalf("decodeRequestBody error: %v", err)
 	}
@@ -55,8 +60,135 @@ func TestDecodeRequestBody_InvalidBase64(t *testing.T) {
 	r := httptest.NewRequest(http.MethodPost, "/grpc-gateway", bytes.NewBufferString("not-a-valid-b64v1"))
 	r.Header.Set("Content-Type", "application/json")
 
-	_, err := decodeRequestBody(r)
+	_, _, err := newHandler(Options{}, "").decodeRequestBody(r, true)
 	if err == nil {
 		t.Fatalf("expected error for invalid base64 body, got nil")
 	}
 }
+
+func TestDecodeBase64V1_Allocs(t *testing.T) {
+	encoded := encodeBase64V1(bytes.Repeat([]byte(`{"message":"hello"}`), 100))
+	// One allocation for the decoded body; the reversed text goes through a pooled buffer.
+	if allocs := testing.AllocsPerRun(100, func() { _, _ = decodeBase64V1(encoded) }); allocs > 2 {
+		t.Fatalf("decodeBase64V1 allocates %v times per call", allocs)
+	}
+}
+
+func TestGateway_EncodingNegotiation(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	srv := httptest.NewServer(Handler(Options{StrictErrors: true}))
+	defer srv.Close()
+
+	plain := []byte(`{"target":"` + target + `","method":"/echo.EchoService/Echo","params":{"message":"hi"}}`)
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(plain)
+	_ = zw.Close()
+	for name, tc := range map[string]struct {
+		header string
+		body   []byte
+		code   int
+	}{
+		"b64v1 detected":    {"", []byte(encodeBase64V1(plain)), http.StatusOK},
+		"plain detected":    {"", append([]byte("\n  "), plain...), http.StatusOK},
+		"gzip detected":     {"", gz.Bytes(), http.StatusOK},
+		"b64v1":             {EncodingB64V1, []byte(encodeBase64V1(plain)), http.StatusOK},
+		"plain":             {"Plain", plain, http.StatusOK},
+		"gzip":              {EncodingGzip, gz.Bytes(), http.StatusOK},
+		"wrong codec":       {EncodingB64V1, plain, http.StatusBadRequest},
+		"unsupported codec": {"rot13", plain, http.StatusBadRequest},
+		"aesgcm disabled":   {EncodingAESGCM, plain, http.StatusBadRequest},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, bytes.NewReader(tc.body))
+		if tc.header != "" {
+			req.Header.Set(encodingHeader, tc.header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		out, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.code {
+			t.Errorf("%s: status=%d body=%s", name, resp.StatusCode, out)
+			continue
+		}
+		if tc.code == http.StatusOK && (resp.Header.Get(encodingHeader) != EncodingPlain || !strings.Contains(string(out), `"hi"`)) {
+			t.Errorf("%s: encoding=%q body=%s", name, resp.Header.Get(encodingHeader), out)
+		}
+	}
+
+	for _, enc := range []string{EncodingB64V1, EncodingPlain, EncodingGzip} {
+		out, err := NewClient(srv.URL, WithEncoding(enc)).InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", json.RawMessage(`{"message":"hi"}`))
+		if err != nil || !strings.Contains(string(out), `"hi"`) {
+			t.Errorf("client with %s: %s, %v", enc, out, err)
+		}
+	}
+}
+
+func TestGateway_SymmetricResponses(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	envelope := func(extra string) []byte {
+		return []byte(`{"target":"` + target + `","method":"/echo.EchoService/Echo","params":{"message":"hi"}` + extra + `}`)
+	}
+	post := func(url string, body []byte, headers map[string]string) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		out, _ := io.ReadAll(resp.Body)
+		return resp, out
+	}
+
+	symmetric := httptest.NewServer(Handler(Options{SymmetricResponses: true}))
+	defer symmetric.Close()
+	resp, out := post(symmetric.URL, []byte(encodeBase64V1(envelope(""))), nil)
+	if resp.Header.Get(encodingHeader) != EncodingB64V1 {
+		t.Fatalf("b64v1 request: encoding=%q", resp.Header.Get(encodingHeader))
+	}
+	if plain, err := decodeBase64V1(string(out)); err != nil || !strings.Contains(string(plain), `"hi"`) {
+		t.Fatalf("b64v1 response: %s, %v", plain, err)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(envelope(""))
+	_ = zw.Close()
+	resp, out = post(symmetric.URL, gz.Bytes(), nil)
+	if resp.Header.Get(encodingHeader) != EncodingGzip {
+		t.Fatalf("gzip request: encoding=%q", resp.Header.Get(encodingHeader))
+	}
+	if plain, err := gunzip(bytes.NewReader(out)); err != nil || !strings.Contains(string(plain), `"hi"`) {
+		t.Fatalf("gzip response: %s, %v", plain, err)
+	}
+	if resp, _ := post(symmetric.URL, envelope(""), nil); resp.Header.Get(encodingHeader) != EncodingPlain || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("plain request: header=%v", resp.Header)
+	}
+	for _, enc := range []string{EncodingB64V1, EncodingGzip} {
+		out, err := NewClient(symmetric.URL, WithEncoding(enc)).InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", json.RawMessage(`{"message":"hi"}`))
+		if err != nil || !strings.Contains(string(out), `"hi"`) {
+			t.Errorf("client with %s: %s, %v", enc, out, err)
+		}
+	}
+
+	// Without the option, responses are plain unless the request asks for symmetry.
+	srv := httptest.NewServer(Handler(Options{}))
+	defer srv.Close()
+	encoded := []byte(encodeBase64V1(envelope("")))
+	if resp, _ := post(srv.URL, encoded, nil); resp.Header.Get(encodingHeader) != EncodingPlain {
+		t.Fatalf("default: encoding=%q", resp.Header.Get(encodingHeader))
+	}
+	if resp, _ := post(srv.URL, encoded, map[string]string{symmetricResponseHeader: "1"}); resp.Header.Get(encodingHeader) != EncodingB64V1 {
+		t.Fatalf("header flag: encoding=%q", resp.Header.Get(encodingHeader))
+	}
+	if resp, _ := post(srv.URL, []byte(encodeBase64V1(envelope(`,"symmetric_response":true`))), nil); resp.Header.Get(encodingHeader) != EncodingB64V1 {
+		t.Fatalf("envelope flag: encoding=%q", resp.Header.Get(encodingHeader))
+	}
+}
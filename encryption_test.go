@@ -0,0 +1,154 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGateway_EncryptedBody(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	keys := map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")}
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", StrictErrors: true, Encryption: &EncryptionConfig{
+		Keys: func(id string) ([]byte, bool) { k, ok := keys[id]; return k, ok },
+	}}))
+	defer srv.Close()
+
+	// The Go client encrypts its calls and decrypts the responses.
+	out, err := NewClient(srv.URL+"/grpc-gateway", WithEncryption("k1", keys["k1"])).InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", json.RawMessage(`{"message":"secret"}`))
+	if err != nil || !strings.Contains(string(out), `"secret"`) {
+		t.Fatalf("encrypted client call: %s, %v", out, err)
+	}
+	// b64v1 is still accepted unless Required is set.
+	if _, err := NewClient(srv.URL+"/grpc-gateway").InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", nil); err != nil {
+		t.Fatalf("b64v1 client call: %v", err)
+	}
+	var ce *ClientError
+	if _, err := NewClient(srv.URL+"/grpc-gateway", WithEncryption("k2", keys["k1"])).InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", nil); !errors.As(err, &ce) || ce.StatusCode != http.StatusBadRequest || ce.Code != ErrCodeInvalidEncoding {
+		t.Fatalf("unknown key: %v", err)
+	}
+
+	c, err := newBodyCipher("k1", keys["k1"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(body []byte, headers map[string]string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/echo.EchoService/Echo", strings.NewReader(string(body)))
+		req.Header.Set(targetHeader, target)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		return resp
+	}
+	b64v2 := map[string]string{encodingHeader: EncodingAESGCM, encryptionKeyIDHeader: "k1"}
+
+	// Method routes negotiate the codec too; the response is sealed with the request's key.
+	sealed, _ := c.seal("request", []byte(`{"message":"routed"}`))
+	resp := post(sealed, b64v2)
+	text, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(encodingHeader) != EncodingAESGCM || resp.Header.Get(encryptionKeyIDHeader) != "k1" {
+		t.Fatalf("method route: status=%d header=%v", resp.StatusCode, resp.Header)
+	}
+	if plain, err := c.open("response", text); err != nil || !strings.Contains(string(plain), `"routed"`) {
+		t.Fatalf("method route response: %s, %v", plain, err)
+	}
+	// Responses cannot be replayed as requests, and tampered bodies are rejected.
+	tampered := append([]byte(nil), sealed...)
+	tampered[20] ^= 1
+	for name, body := range map[string][]byte{"response as request": text, "tampered": tampered} {
+		resp := post(body, b64v2)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status=%d", name, resp.StatusCode)
+		}
+	}
+	resp = post([]byte(`{}`), map[string]string{encodingHeader: "rot13"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unsupported encoding: status=%d", resp.StatusCode)
+	}
+}
+
+func TestGateway_EncryptionRequired(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	key := []byte("0123456789abcdef")
+	srv := httptest.NewServer(Handler(Options{Encryption: &EncryptionConfig{
+		Keys:     func(id string) ([]byte, bool) { return key, id == "k1" },
+		Required: true,
+	}}))
+	defer srv.Close()
+
+	var ce *ClientError
+	if _, err := NewClient(srv.URL).InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", nil); !errors.As(err, &ce) || ce.StatusCode != http.StatusBadRequest || ce.Code != ErrCodeInvalidEncoding {
+		t.Fatalf("b64v1 call: %v", err)
+	}
+	if _, err := NewClient(srv.URL, WithEncryption("k1", key)).InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", nil); err != nil {
+		t.Fatalf("b64v2 call: %v", err)
+	}
+	if _, err := NewClient(srv.URL, WithEncryption("k1", []byte("short"))).InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", nil); err == nil {
+		t.Fatal("invalid client key: no error")
+	}
+}
+
+func TestGateway_EncryptionRequiredMethodRoutes(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	chat, chatSet := startChatServer(t)
+	key := []byte("0123456789abcdef")
+	srv := httptest.NewServer(Handler(Options{
+		Path:               "/grpc-gateway",
+		BidiStreaming:      true,
+		PreloadDescriptors: []DescriptorSource{{FS: fstest.MapFS{"chat.pb": {Data: chatSet}}, Path: "chat.pb"}},
+		Routes:             []Route{{Pattern: "DELETE /api/echo", Method: "/echo.EchoService/Echo"}},
+		Encryption: &EncryptionConfig{
+			Keys:     func(id string) ([]byte, bool) { return key, id == "k1" },
+			Required: true,
+		},
+	}))
+	defer srv.Close()
+
+	call := func(method, path string, body []byte, header map[string]string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewReader(body))
+		req.Header.Set(targetHeader, target)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	c, _ := newBodyCipher("k1", key)
+	sealed, _ := c.seal("request", []byte(`{"message":"hi"}`))
+	if resp := call(http.MethodPost, "/grpc-gateway/echo.EchoService/Echo", sealed, map[string]string{encodingHeader: EncodingAESGCM, encryptionKeyIDHeader: "k1"}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("sealed POST: status=%d", resp.StatusCode)
+	}
+	// Request messages in the query or in a stream cannot be sealed, so they do not get past Required.
+	for name, resp := range map[string]*http.Response{
+		"GET":    call(http.MethodGet, "/grpc-gateway/echo.EchoService/Echo?message=hi", nil, nil),
+		"DELETE": call(http.MethodDelete, "/api/echo?message=hi", nil, nil),
+		"bidi":   call(http.MethodPost, "/grpc-gateway/acme.Chat/Shout", []byte(`{"text":"hi"}`+"\n"), map[string]string{targetHeader: chat, "Accept": ndjsonContentType}),
+	} {
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status=%d, want 400", name, resp.StatusCode)
+		}
+	}
+}
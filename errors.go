@@ -0,0 +1,201 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc/status"
+)
+
+// Error codes reported in the "code" field of error responses. Unlike messages, they are stable and meant
+// for clients to branch on.
+const (
+	ErrCodeNotFound          = "not_found"          // no such route
+	ErrCodeMethodNotAllowed  = "method_not_allowed" // wrong HTTP method for the route
+	ErrCodeInvalidEncoding   = "invalid_encoding"   // body is not valid b64v1
+	ErrCodeInvalidRequest    = "invalid_request"    // malformed JSON, bad header or field values
+	ErrCodeMissingTarget     = "missing_target"
+	ErrCodeMissingMethod     = "missing_method"
+	ErrCodeInvalidDescriptor = "invalid_descriptor" // descriptor or chunk cannot be decoded or synced
+	ErrCodeUnauthenticated   = "unauthenticated"    // Options.Claims rejected the caller's credentials
+	ErrCodeForbidden         = "forbidden"          // missing or wrong token, disallowed origin, denied by an authorization rule
+	ErrCodeQuotaExceeded     = "quota_exceeded"     // a client quota is exhausted; see Retry-After
+	ErrCodeUnavailable       = "unavailable"        // the gateway cannot take the request now (e.g. async queue full)
+	ErrCodeDuplicateRequest  = "duplicate_request"  // Idempotency-Key in use by a running request or used for another one
+	ErrCodeGone              = "gone"               // the method is past its Deprecation sunset
+	ErrCodeUpstream          = "upstream_error"     // the gRPC call failed; see grpc_code
+	ErrCodeResponseTooLarge  = "response_too_large" // the upstream response exceeds Options.MaxResponseBytes
+	ErrCodeClientClosed      = "client_closed_request"
+	ErrCodeInternal          = "internal"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+	// Code is one of the ErrCode constants.
+	Code string `json:"code,omitempty"`
+	// GRPCCode is the upstream gRPC status code name (e.g. "NotFound") for upstream errors.
+	GRPCCode string `json:"grpc_code,omitempty"`
+	// Details are the upstream gRPC status details (google.rpc.BadRequest, RetryInfo, ...) as JSON, each with "@type".
+	Details []json.RawMessage `json:"details,omitempty"`
+	// Gateway carries the diagnostics of a debug request.
+	Gateway *core.Diagnostics `json:"_gateway,omitempty"`
+	// DescriptorProblems lists what is wrong with an uploaded descriptor set, file by file.
+	DescriptorProblems []core.DescriptorProblem `json:"descriptor_problems,omitempty"`
+
+	grpcStatus *status.Status
+	err        error // the failure behind the response, if any, for Options.ErrorMapper
+}
+
+// Error is what Options.ErrorMapper is given: the error response the gateway would send, with the failure
+// behind it (resolver, conversion or upstream error, e.g. a *core.UpstreamError) as Err for errors.As. Errors
+// the gateway finds itself (bad requests, missing routes, ...) have no Err.
+type Error struct {
+	Status   int    // HTTP status
+	Code     string // one of the ErrCode constants
+	Message  string
+	GRPCCode string            // upstream gRPC status code name, for upstream errors
+	Details  []json.RawMessage // upstream gRPC status details, each with "@type"
+	Err      error
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// problemDetails is the RFC 7807 rendering of errorResponse, with the gateway's fields as extension members.
+type problemDetails struct {
+	Type       string            `json:"type"`
+	Title      string            `json:"title"`
+	Status     int               `json:"status"`
+	Detail     string            `json:"detail,omitempty"`
+	Instance   string            `json:"instance,omitempty"`
+	Code       string            `json:"code,omitempty"`
+	GRPCCode   string            `json:"grpc_code,omitempty"`
+	GRPCStatus int               `json:"grpc_status,omitempty"` // numeric gRPC status code
+	RequestID  string            `json:"request_id,omitempty"`
+	Details    []json.RawMessage `json:"details,omitempty"`
+	Gateway    *core.Diagnostics `json:"_gateway,omitempty"`
+
+	DescriptorProblems []core.DescriptorProblem `json:"descriptor_problems,omitempty"`
+}
+
+const defaultProblemTypeBase = "urn:gateway:error:"
+
+// writeError reports a request error.
+func (h *handler) writeError(w http.ResponseWriter, r *http.Request, httpStatus int, code, msg string) {
+	h.writeErrorResponse(w, r, httpStatus, errorResponse{Error: msg, Code: code})
+}
+
+// writeErrorResponse renders resp with Options.ErrorMapper, or in the configured Options.ErrorFormat.
+func (h *handler) writeErrorResponse(w http.ResponseWriter, r *http.Request, httpStatus int, resp errorResponse) {
+	if rec, ok := w.(*serviceRecorder); ok {
+		rec.failure = &resp
+	}
+	if h.opts.ErrorMapper != nil {
+		e := &Error{Status: httpStatus, Code: resp.Code, Message: resp.Error, GRPCCode: resp.GRPCCode, Details: resp.Details, Err: resp.err}
+		if mappedStatus, body := h.opts.ErrorMapper(r.Context(), e); mappedStatus != 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(mappedStatus)
+			_ = json.NewEncoder(w).Encode(body)
+			return
+		}
+	}
+	if h.opts.ErrorFormat != ErrorFormatProblem {
+		writeErrorResponse(w, httpStatus, resp)
+		return
+	}
+	base := h.opts.ProblemTypeBase
+	if base == "" {
+		base = defaultProblemTypeBase
+	}
+	code := resp.Code
+	if code == "" {
+		code = ErrCodeInternal
+	}
+	p := problemDetails{
+		Type:      base + code,
+		Title:     http.StatusText(httpStatus),
+		Status:    httpStatus,
+		Detail:    resp.Error,
+		Instance:  r.URL.Path,
+		Code:      resp.Code,
+		GRPCCode:  resp.GRPCCode,
+		RequestID: w.Header().Get(requestIDHeader),
+		Details:   resp.Details,
+		Gateway:   resp.Gateway,
+
+		DescriptorProblems: resp.DescriptorProblems,
+	}
+	if p.Title == "" {
+		p.Title = code
+	}
+	if resp.grpcStatus != nil {
+		p.GRPCStatus = int(resp.grpcStatus.Code())
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(httpStatus)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// rejectRoute answers a request for a route that does not exist (allow == "") or does not accept r's
+// method. By default this is a bare 404, for compatibility; with Options.StrictErrors it is a structured
+// 404 or 405 with an Allow header.
+func (h *handler) rejectRoute(w http.ResponseWriter, r *http.Request, allow string) {
+	if !h.opts.StrictErrors {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if allow == "" {
+		h.writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no route for "+r.URL.Path)
+		return
+	}
+	w.Header().Set("Allow", allow)
+	h.writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "method "+r.Method+" not allowed, use "+allow)
+}
+
+// writeInvokeError reports a failed invocation as 502, including the upstream status code and details when present,
+// and diag for debug requests. Calls rejected by an overloaded target's queue are reported as 503, and inline
+// descriptor sets that fail validation as 400 with their problems.
+func (h *handler) writeInvokeError(w http.ResponseWriter, r *http.Request, err error, diag *core.Diagnostics) {
+	var invalid *core.DescriptorSetError
+	if errors.As(err, &invalid) {
+		h.writeErrorResponse(w, r, http.StatusBadRequest, errorResponse{Error: err.Error(), Code: ErrCodeInvalidDescriptor, DescriptorProblems: invalid.Problems, Gateway: diag, err: err})
+		return
+	}
+	if errors.Is(err, core.ErrTargetOverloaded) {
+		h.writeErrorResponse(w, r, http.StatusServiceUnavailable, errorResponse{Error: err.Error(), Code: ErrCodeUnavailable, Gateway: diag, err: err})
+		return
+	}
+	h.writeErrorResponse(w, r, http.StatusBadGateway, invokeErrorResponse(err, diag))
+}
+
+// invokeErrorResponse describes a failed invocation.
+func invokeErrorResponse(err error, diag *core.Diagnostics) errorResponse {
+	if errors.Is(err, core.ErrResponseTooLarge) {
+		return errorResponse{Error: err.Error(), Code: ErrCodeResponseTooLarge, Gateway: diag, err: err}
+	}
+	resp := errorResponse{Error: err.Error(), Code: ErrCodeUpstream, Gateway: diag, err: err}
+	var upstream *core.UpstreamError
+	if errors.As(err, &upstream) {
+		resp.grpcStatus = upstream.Status
+		resp.Details = upstream.Details
+	} else if st, ok := status.FromError(err); ok {
+		resp.grpcStatus = st
+	}
+	if resp.grpcStatus != nil {
+		resp.GRPCCode = resp.grpcStatus.Code().String()
+	}
+	return resp
+}
+
+func writeJSONError(w http.ResponseWriter, httpStatus int, code, msg string) {
+	writeErrorResponse(w, httpStatus, errorResponse{Error: msg, Code: code})
+}
+
+func writeErrorResponse(w http.ResponseWriter, httpStatus int, resp errorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,176 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/keicoqk/gateway/core"
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+)
+
+func TestGateway_StrictErrors(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	mux := http.NewServeMux()
+	for _, strict := range []bool{false, true} {
+		path := "/lenient"
+		if strict {
+			path = "/strict"
+		}
+		h := Handler(Options{Path: path, StrictErrors: strict})
+		mux.Handle(path, h)
+		mux.Handle(path+"/", h)
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	do := func(method, path, body string) (int, http.Header, errorResponse) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		var er errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&er)
+		return resp.StatusCode, resp.Header, er
+	}
+
+	cases := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{http.MethodGet, "/strict", "", http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed},
+		{http.MethodPost, "/strict", "%%%not-b64", http.StatusBadRequest, ErrCodeInvalidEncoding},
+		{http.MethodPost, "/strict/services", "", http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed},
+		{http.MethodPost, "/strict/not/a/method/route", "", http.StatusNotFound, ErrCodeNotFound},
+		{http.MethodGet, "/lenient", "", http.StatusNotFound, ""},
+		{http.MethodPost, "/lenient", "%%%not-b64", http.StatusNotFound, ""},
+	}
+	for _, c := range cases {
+		status, header, er := do(c.method, c.path, c.body)
+		if status != c.status || er.Code != c.code {
+			t.Errorf("%s %s: status=%d code=%q, want %d %q", c.method, c.path, status, er.Code, c.status, c.code)
+		}
+		if status == http.StatusMethodNotAllowed && header.Get("Allow") == "" {
+			t.Errorf("%s %s: missing Allow header", c.method, c.path)
+		}
+	}
+
+	// Validation and upstream errors carry codes in both modes.
+	raw, _ := json.Marshal(map[string]any{"method": "/echo.EchoService/Echo"})
+	if status, _, er := do(http.MethodPost, "/lenient", encodeBase64V1(raw)); status != http.StatusBadRequest || er.Code != ErrCodeMissingTarget {
+		t.Errorf("missing target: %d %+v", status, er)
+	}
+	raw, _ = json.Marshal(map[string]any{"target": target, "method": "/echo.EchoService/Nope"})
+	if status, _, er := do(http.MethodPost, "/lenient", encodeBase64V1(raw)); status != http.StatusBadGateway || er.Code != ErrCodeUpstream {
+		t.Errorf("unknown method: %d %+v", status, er)
+	}
+}
+
+func TestGateway_ProblemDetails(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, failingEchoServer{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	srv := httptest.NewServer(Handler(Options{ErrorFormat: ErrorFormatProblem}))
+	defer srv.Close()
+
+	raw, _ := json.Marshal(map[string]any{"target": lis.Addr().String(), "method": "/echo.EchoService/Echo"})
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/", bytes.NewBufferString(encodeBase64V1(raw)))
+	req.Header.Set("X-Request-Id", "req-42")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var p problemDetails
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if p.Type != "urn:gateway:error:upstream_error" || p.Title != "Bad Gateway" || p.Status != http.StatusBadGateway ||
+		p.Instance != "/" || p.GRPCCode != "InvalidArgument" || p.GRPCStatus != 3 || p.RequestID != "req-42" || len(p.Details) != 2 {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+
+	code, b := postGateway(t, srv.URL, map[string]any{"method": "/echo.EchoService/Echo"}, nil)
+	if code != http.StatusBadRequest || !strings.Contains(string(b), `"type":"urn:gateway:error:missing_target"`) {
+		t.Fatalf("missing target: %d %s", code, b)
+	}
+}
+
+func TestGateway_ErrorMapper(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, failingEchoServer{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	srv := httptest.NewServer(Handler(Options{ErrorMapper: func(ctx context.Context, err error) (int, any) {
+		var upstream *core.UpstreamError
+		if !errors.As(err, &upstream) {
+			return 0, nil
+		}
+		e, info := err.(*Error), core.CallInfoFromContext(ctx)
+		return http.StatusUnprocessableEntity, map[string]any{"errcode": "E" + e.GRPCCode, "details": len(upstream.Details), "method": info.FullMethod, "upstream": info.Peer() == lis.Addr().String()}
+	}}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": lis.Addr().String(), "method": "/echo.EchoService/Echo"}, nil)
+	if code != http.StatusUnprocessableEntity || strings.TrimSpace(string(b)) != `{"details":2,"errcode":"EInvalidArgument","method":"/echo.EchoService/Echo","upstream":true}` {
+		t.Fatalf("mapped: %d %s", code, b)
+	}
+	// Errors the mapper declines keep the default rendering.
+	code, b = postGateway(t, srv.URL, map[string]any{"method": "/echo.EchoService/Echo"}, nil)
+	if code != http.StatusBadRequest || !strings.Contains(string(b), `"code":"missing_target"`) {
+		t.Fatalf("default: %d %s", code, b)
+	}
+}
+
+func TestGateway_MaxResponseBytes(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	message := strings.Repeat("x", 100)
+	for name, limit := range map[string]int{
+		"received message": 50,  // the 102-byte message is rejected by the gRPC client
+		"json rendering":   105, // the message fits, its 114-byte JSON form does not
+	} {
+		srv := httptest.NewServer(Handler(Options{MaxResponseBytes: limit}))
+		code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": message}}, nil)
+		srv.Close()
+		var got errorResponse
+		_ = json.Unmarshal(b, &got)
+		if code != http.StatusBadGateway || got.Code != ErrCodeResponseTooLarge {
+			t.Errorf("%s: status=%d body=%s", name, code, b)
+		}
+	}
+
+	srv := httptest.NewServer(Handler(Options{MaxResponseBytes: 1024}))
+	defer srv.Close()
+	if code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": message}}, nil); code != http.StatusOK {
+		t.Fatalf("within limit: status=%d body=%s", code, b)
+	}
+}
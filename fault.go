@@ -0,0 +1,215 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc/status"
+)
+
+// Fault injects failures into calls to a method or a target (exactly one is set; method "*" matches every
+// call) for resilience testing: a delay before the upstream call, an abort with a gRPC status instead of
+// it, or both. Faults are set in Options.Faults or through the admin API and last until removed or the
+// process restarts. A call gets the fault of its method before those of its targets.
+type Fault struct {
+	Method string
+	Target string
+	// Delay is added before the upstream call of DelayPercent of the calls.
+	Delay        time.Duration
+	DelayPercent float64 // in (0, 100]; zero means every call
+	// AbortCode, if set, is the gRPC code name (e.g. "Unavailable") that AbortPercent of the calls fail with,
+	// reported like an upstream error with Message.
+	AbortCode    string
+	AbortPercent float64 // in (0, 100]; zero means every call
+	Message      string
+}
+
+func (f Fault) key() string { return killSwitchKey(f.Method, f.Target) }
+
+// validate reports what is wrong with f.
+func (f Fault) validate() error {
+	if (f.Method == "") == (f.Target == "") {
+		return fmt.Errorf("fault: exactly one of method and target is required")
+	}
+	if f.Delay < 0 || f.DelayPercent < 0 || f.DelayPercent > 100 || f.AbortPercent < 0 || f.AbortPercent > 100 {
+		return fmt.Errorf("fault %s: delay must not be negative and percentages must be in [0, 100]", f.key())
+	}
+	if f.AbortCode != "" {
+		if _, ok := grpcCodeByName(f.AbortCode); !ok {
+			return fmt.Errorf("fault %s: unknown gRPC code %q", f.key(), f.AbortCode)
+		}
+	}
+	if f.Delay == 0 && f.AbortCode == "" {
+		return fmt.Errorf("fault %s: a delay or an abort_code is required", f.key())
+	}
+	return nil
+}
+
+// faultJSON is the admin API form of Fault, with the delay as a duration string such as "250ms".
+type faultJSON struct {
+	Method       string  `json:"method,omitempty"`
+	Target       string  `json:"target,omitempty"`
+	Delay        string  `json:"delay,omitempty"`
+	DelayPercent float64 `json:"delay_percent,omitempty"`
+	AbortCode    string  `json:"abort_code,omitempty"`
+	AbortPercent float64 `json:"abort_percent,omitempty"`
+	Message      string  `json:"message,omitempty"`
+}
+
+func (f Fault) toJSON() faultJSON {
+	out := faultJSON{Method: f.Method, Target: f.Target, DelayPercent: f.DelayPercent, AbortCode: f.AbortCode, AbortPercent: f.AbortPercent, Message: f.Message}
+	if f.Delay > 0 {
+		out.Delay = f.Delay.String()
+	}
+	return out
+}
+
+type faultsResponse struct {
+	Faults []faultJSON `json:"faults"`
+}
+
+// faults are the injected faults of a handler, keyed like kill switches.
+type faults struct {
+	mu     sync.RWMutex
+	faults map[string]Fault
+}
+
+func newFaults(initial []Fault) *faults {
+	f := &faults{faults: make(map[string]Fault, len(initial))}
+	for _, fault := range initial {
+		if err := fault.validate(); err != nil {
+			panic("gateway: " + err.Error())
+		}
+		f.faults[fault.key()] = fault
+	}
+	return f
+}
+
+// match returns the fault for a call of method to targets, if any: the "*" fault first, then the method's,
+// then the targets'.
+func (f *faults) match(method string, targets ...string) (Fault, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if len(f.faults) == 0 {
+		return Fault{}, false
+	}
+	for _, m := range []string{"*", method} {
+		if fault, ok := f.faults[killSwitchKey(m, "")]; ok && m != "" {
+			return fault, true
+		}
+	}
+	for _, target := range targets {
+		if fault, ok := f.faults[killSwitchKey("", target)]; ok && target != "" {
+			return fault, true
+		}
+	}
+	return Fault{}, false
+}
+
+func (f *faults) set(fault Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.faults[fault.key()] = fault
+}
+
+func (f *faults) remove(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.faults[key]
+	delete(f.faults, key)
+	return ok
+}
+
+func (f *faults) list() []faultJSON {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make([]faultJSON, 0, len(f.faults))
+	for _, fault := range f.faults {
+		out = append(out, fault.toJSON())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return killSwitchKey(out[i].Method, out[i].Target) < killSwitchKey(out[j].Method, out[j].Target)
+	})
+	return out
+}
+
+// injectFault applies the fault matching a call of method to targets: it sleeps for the delay and returns
+// the abort error, each for its share of the calls.
+func (h *handler) injectFault(r *http.Request, method string, targets ...string) error {
+	fault, ok := h.faults.match(method, targets...)
+	if !ok {
+		return nil
+	}
+	ctx := r.Context()
+	rnd := core.RandFromContext(ctx, h.opts.Rand)
+	hit := func(percent float64) bool {
+		return percent == 0 || unitFloat(rnd)*100 < percent
+	}
+	if fault.Delay > 0 && hit(fault.DelayPercent) {
+		h.metrics.Add("gateway_faults_injected_total", 1, "fault", fault.key(), "kind", "delay")
+		if err := core.Sleep(ctx, core.ClockFromContext(ctx, h.opts.Clock), fault.Delay); err != nil {
+			return err
+		}
+	}
+	if fault.AbortCode != "" && hit(fault.AbortPercent) {
+		h.metrics.Add("gateway_faults_injected_total", 1, "fault", fault.key(), "kind", "abort")
+		code, _ := grpcCodeByName(fault.AbortCode)
+		msg := fault.Message
+		if msg == "" {
+			msg = "injected fault"
+		}
+		return status.Error(code, msg)
+	}
+	return nil
+}
+
+// serveFaults handles the admin fault injection routes:
+//
+//	GET    /faults                        the injected faults
+//	POST   /faults                        {"method": M | "target": T, "delay": "250ms", "delay_percent": P,
+//	                                      "abort_code": C, "abort_percent": P, "message": ...} sets one
+//	DELETE /faults?method=M | ?target=T   removes one
+func (h *handler) serveFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req faultJSON
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+		fault := Fault{Method: req.Method, Target: req.Target, DelayPercent: req.DelayPercent, AbortCode: req.AbortCode, AbortPercent: req.AbortPercent, Message: req.Message}
+		if req.Delay != "" {
+			d, err := time.ParseDuration(req.Delay)
+			if err != nil {
+				h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid delay: "+err.Error())
+				return
+			}
+			fault.Delay = d
+		}
+		if err := fault.validate(); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+			return
+		}
+		h.faults.set(fault)
+	case http.MethodDelete:
+		key := killSwitchKey(r.URL.Query().Get("method"), r.URL.Query().Get("target"))
+		if !h.faults.remove(key) {
+			h.writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no fault for "+key)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		h.rejectRoute(w, r, "GET, POST, DELETE")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(faultsResponse{Faults: h.faults.list()})
+}
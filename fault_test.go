@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGateway_Faults(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{
+		Path:       "/grpc-gateway",
+		AdminToken: "admin",
+		Faults:     []Fault{{Method: "/echo.EchoService/Echo", AbortCode: "Unavailable", Message: "chaos"}},
+	}))
+	defer srv.Close()
+	echo := func() (int, string) {
+		code, b := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+		return code, string(b)
+	}
+	admin := func(method, path string, body any) (int, faultsResponse) {
+		t.Helper()
+		raw, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, srv.URL+"/grpc-gateway/admin"+path, bytes.NewReader(raw))
+		req.Header.Set(adminTokenHeader, "admin")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("admin %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		var out faultsResponse
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+
+	if code, b := echo(); code != http.StatusBadGateway || !strings.Contains(b, `"grpc_code":"Unavailable"`) || !strings.Contains(b, "chaos") {
+		t.Fatalf("abort: status=%d body=%s", code, b)
+	}
+	if code, _ := admin(http.MethodDelete, "/faults?method=/echo.EchoService/Echo", nil); code != http.StatusNoContent {
+		t.Fatalf("delete: status=%d", code)
+	}
+	if code, b := echo(); code != http.StatusOK {
+		t.Fatalf("without fault: status=%d body=%s", code, b)
+	}
+
+	code, out := admin(http.MethodPost, "/faults", faultJSON{Target: target, Delay: "50ms"})
+	if code != http.StatusOK || len(out.Faults) != 1 || out.Faults[0].Delay != "50ms" {
+		t.Fatalf("set: status=%d out=%+v", code, out)
+	}
+	start := time.Now()
+	if code, b := echo(); code != http.StatusOK || time.Since(start) < 50*time.Millisecond {
+		t.Fatalf("delay: status=%d body=%s after %v", code, b, time.Since(start))
+	}
+	if code, _ := admin(http.MethodPost, "/faults", faultJSON{Method: "/echo.EchoService/Echo", AbortCode: "Oops"}); code != http.StatusBadRequest {
+		t.Fatalf("invalid fault: status=%d", code)
+	}
+}
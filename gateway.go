@@ -1,40 +1,53 @@
 package gateway
 
 import (
+	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
 	"sync"
 )
 
-// Register registers the gRPC gateway Handler on mux at opts.Path (default "/grpc-gateway").
+// Register registers the gRPC gateway Handler on mux at opts.Path (default "/grpc-gateway"), configured by
+// DefaultOptions when no opts are given. Each of several opts registers a gateway of its own, e.g. an internal
+// one without auth next to a public one with Claims and AllowedTargets on the same mux; they share nothing
+// (invokers, descriptor caches, quotas, async workers). A path registers once per mux: registering it again
+// with equal Options (reflect.DeepEqual, which Options holding functions never are) is a no-op, and with
+// other Options panics.
 // If DefaultServeMux was already registered via import _ "github.com/keicoqk/gateway/sdk", call Register only for a custom mux.
-func Register(mux *http.ServeMux) {
-	opts := DefaultOptions()
-	if opts.Path == "" {
-		opts.Path = DefaultOptions().Path
+// Routers other than *http.ServeMux (chi, gin, echo, ...) mount the gateway with RegisterFunc.
+func Register(mux *http.ServeMux, opts ...Options) {
+	if len(opts) == 0 {
+		opts = []Options{DefaultOptions()}
+	}
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	for _, o := range opts {
+		if o.Path == "" {
+			o.Path = DefaultOptions().Path
+		}
+		byPath, ok := registered[mux]
+		if !ok {
+			byPath = map[string]Options{}
+			registered[mux] = byPath
+		}
+		if prev, ok := byPath[o.Path]; ok {
+			if !reflect.DeepEqual(prev, o) {
+				panic(fmt.Sprintf("gateway: Register: path %q is already registered on this mux with other Options", o.Path))
+			}
+			continue
+		}
+		h := Handler(o)
+		mux.Handle(o.Path, h)
+		// Sub-routes: {Path}/openapi.json, {Path}/services, {Path}/admin/... and {Path}/{package.Service}/{Method}.
+		if sub := strings.TrimSuffix(o.Path, "/") + "/"; sub != o.Path {
+			mux.Handle(sub, h)
+		}
+		byPath[o.Path] = o
 	}
-	getRegisterOnce(mux, opts.Path).Do(func() {
-		mux.Handle(opts.Path, Handler(opts))
-	})
 }
 
 var (
-	registerOnceMu sync.Mutex
-	registerOnce   = map[*http.ServeMux]map[string]*sync.Once{}
+	registeredMu sync.Mutex
+	registered   = map[*http.ServeMux]map[string]Options{} // Options registered by mux and path
 )
-
-func getRegisterOnce(mux *http.ServeMux, path string) *sync.Once {
-	registerOnceMu.Lock()
-	defer registerOnceMu.Unlock()
-
-	byPath, ok := registerOnce[mux]
-	if !ok {
-		byPath = map[string]*sync.Once{}
-		registerOnce[mux] = byPath
-	}
-	once, ok := byPath[path]
-	if !ok {
-		once = &sync.Once{}
-		byPath[path] = once
-	}
-	return once
-}
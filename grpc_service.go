@@ -0,0 +1,198 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	gatewayv1 "github.com/keicoqk/gateway/proto/gateway/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RegisterGatewayService registers gateway.v1.GatewayService (proto/gateway/v1/gateway.proto) on s, so Go
+// services can call methods through the gateway gw, as returned by Handler, over gRPC rather than HTTP and
+// b64v1. Calls take the same path as envelope requests to gw, sharing its invoker, descriptor caches and
+// policies (client IP filter, Claims, quotas, authorization, kill switches, mocks, ...); only the request
+// signature and body encoding, which are about HTTP bodies, do not apply. The incoming gRPC metadata stands in
+// for the HTTP headers, e.g. for Claims, X-Request-Id or the tenant header. With Options.Versions, the
+// x-gateway-api-version metadata selects the version; calls without it go to the unversioned gateway.
+func RegisterGatewayService(s grpc.ServiceRegistrar, gw http.Handler) {
+	switch gw.(type) {
+	case *handler, *tenantRouter, *versionRouter:
+	default:
+		panic("gateway: RegisterGatewayService needs a handler returned by Handler")
+	}
+	gatewayv1.RegisterGatewayServiceServer(s, &gatewayService{gw: gw})
+}
+
+type gatewayService struct {
+	gatewayv1.UnimplementedGatewayServiceServer
+	gw http.Handler
+}
+
+// serviceRecorder records the response to a GatewayService call, and the error response behind a failure
+// so that it can be returned with its gRPC status.
+type serviceRecorder struct {
+	*httptest.ResponseRecorder
+	failure *errorResponse
+}
+
+func (g *gatewayService) Invoke(ctx context.Context, in *gatewayv1.InvokeRequest) (resp *gatewayv1.InvokeResponse, err error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		if strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-") || strings.HasSuffix(key, "-bin") || key == "content-type" {
+			continue
+		}
+		for _, v := range values {
+			r.Header.Add(key, v)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	h, err := g.handler(r, in.GetTenant())
+	if err != nil {
+		return nil, err
+	}
+	r.URL.Path = h.opts.Path
+	req := &gatewayRequest{
+		Target:       in.GetTarget(),
+		Method:       in.GetMethod(),
+		Service:      in.GetService(),
+		DescriptorID: in.GetDescriptorId(),
+	}
+	if len(in.GetBody()) > 0 {
+		req.Body = json.RawMessage(in.GetBody())
+	}
+	if len(in.GetDescriptorSet()) > 0 {
+		req.Descriptor = base64.StdEncoding.EncodeToString(in.GetDescriptorSet())
+	}
+	if len(in.GetMetadata()) > 0 {
+		req.Metadata = make(map[string]metadataValues, len(in.GetMetadata()))
+		for key, v := range in.GetMetadata() {
+			req.Metadata[key] = metadataValues{v}
+		}
+	}
+
+	w := &serviceRecorder{ResponseRecorder: httptest.NewRecorder()}
+	defer func() {
+		// Raw responses abort the handler when the upstream stream fails midway.
+		if p := recover(); p != nil {
+			if p != http.ErrAbortHandler {
+				panic(p)
+			}
+			resp, err = nil, status.Error(codes.Aborted, "response aborted")
+		}
+	}()
+	if r, ok := h.filterClientIP(w, r); ok {
+		h.serve(w, r, req)
+	}
+	if w.Code >= http.StatusBadRequest || w.failure != nil {
+		return nil, w.status()
+	}
+	return &gatewayv1.InvokeResponse{Body: w.Body.Bytes(), RequestId: w.Header().Get(requestIDHeader)}, nil
+}
+
+// handler returns the gateway that serves r: gw itself, or the gateway of tenant (else the one named by
+// Options.TenantHeader) of a gateway with tenants.
+func (g *gatewayService) handler(r *http.Request, tenant string) (*handler, error) {
+	switch gw := g.gw.(type) {
+	case *handler:
+		return gw, nil
+	case *tenantRouter:
+		if tenant == "" && gw.opts.TenantHeader != "" {
+			tenant = r.Header.Get(gw.opts.TenantHeader)
+		}
+		if tenant == "" {
+			return nil, status.Error(codes.InvalidArgument, "missing tenant")
+		}
+		h, ok := gw.tenants[tenant]
+		if !ok {
+			return nil, status.Error(codes.NotFound, "unknown tenant "+tenant)
+		}
+		return h, nil
+	case *versionRouter:
+		name := r.Header.Get(apiVersionHeader)
+		if name == "" {
+			return gw.unversioned, nil
+		}
+		h, ok := gw.versions[name]
+		if !ok {
+			return nil, status.Error(codes.NotFound, "unknown API version "+name)
+		}
+		return h, nil
+	}
+	return nil, status.Error(codes.Internal, "not a gateway handler")
+}
+
+// status returns the gRPC status of the failed call w recorded: the upstream's own status, or the code
+// closest to the gateway's error.
+func (w *serviceRecorder) status() error {
+	if w.failure == nil {
+		return status.Error(httpStatusCode(w.Code), strings.TrimSpace(w.Body.String()))
+	}
+	if st := w.failure.grpcStatus; st != nil {
+		return st.Err()
+	}
+	return status.Error(errorCodeStatus(w.failure.Code, w.Code), w.failure.Error)
+}
+
+// errorCodeStatus maps an ErrCode of an error response with HTTP status httpStatus to a gRPC code.
+func errorCodeStatus(code string, httpStatus int) codes.Code {
+	switch code {
+	case ErrCodeInvalidEncoding, ErrCodeInvalidRequest, ErrCodeMissingTarget, ErrCodeMissingMethod, ErrCodeInvalidDescriptor:
+		return codes.InvalidArgument
+	case ErrCodeUnauthenticated:
+		return codes.Unauthenticated
+	case ErrCodeForbidden:
+		return codes.PermissionDenied
+	case ErrCodeQuotaExceeded, ErrCodeResponseTooLarge:
+		return codes.ResourceExhausted
+	case ErrCodeUnavailable:
+		return codes.Unavailable
+	case ErrCodeDuplicateRequest:
+		return codes.Aborted
+	case ErrCodeGone:
+		return codes.FailedPrecondition
+	case ErrCodeNotFound:
+		return codes.NotFound
+	case ErrCodeClientClosed:
+		return codes.Canceled
+	case ErrCodeInternal:
+		return codes.Internal
+	}
+	return httpStatusCode(httpStatus)
+}
+
+// httpStatusCode maps the HTTP status of a response without an error code to a gRPC code.
+func httpStatusCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/keicoqk/gateway/example/pb"
+	gatewayv1 "github.com/keicoqk/gateway/proto/gateway/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGatewayService(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	failing, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	fs := grpc.NewServer()
+	pb.RegisterEchoServiceServer(fs, failingEchoServer{})
+	go func() { _ = fs.Serve(failing) }()
+	defer fs.Stop()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer()
+	RegisterGatewayService(s, Handler(Options{Timeout: 5 * time.Second, MetadataAllow: []string{"x-tenant"}}))
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	client := gatewayv1.NewGatewayServiceClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "grpc-1")
+	resp, err := client.Invoke(ctx, &gatewayv1.InvokeRequest{Target: target, Method: "/echo.EchoService/Echo", Body: []byte(`{"message":"hi"}`), Metadata: map[string]string{"x-tenant": "a"}})
+	if err != nil || string(resp.GetBody()) != `{"message":"hi"}` || resp.GetRequestId() != "grpc-1" {
+		t.Fatalf("invoke: %v %v", resp, err)
+	}
+
+	// Upstream failures keep their status and details.
+	_, err = client.Invoke(context.Background(), &gatewayv1.InvokeRequest{Target: failing.Addr().String(), Method: "/echo.EchoService/Echo"})
+	if st := status.Convert(err); st.Code() != codes.InvalidArgument || len(st.Details()) != 2 {
+		t.Fatalf("upstream error: %v (%d details)", err, len(st.Details()))
+	}
+	// Gateway failures get the closest code.
+	_, err = client.Invoke(context.Background(), &gatewayv1.InvokeRequest{Method: "/echo.EchoService/Echo"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("missing target: %v", err)
+	}
+	_, err = client.Invoke(context.Background(), &gatewayv1.InvokeRequest{Target: target, Method: "/echo.EchoService/Echo", Metadata: map[string]string{"x-secret": "1"}})
+	if st := status.Convert(err); st.Code() != codes.InvalidArgument || st.Message() != `metadata key "x-secret" is not allowed` {
+		t.Fatalf("denied metadata: %v", err)
+	}
+}
+
+func TestGatewayService_Versions(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer()
+	RegisterGatewayService(s, Handler(Options{Path: "/grpc-gateway", Versions: map[string]APIVersion{"v1": {DefaultTarget: target}}}))
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	client := gatewayv1.NewGatewayServiceClient(conn)
+
+	in := &gatewayv1.InvokeRequest{Method: "/echo.EchoService/Echo", Body: []byte(`{"message":"hi"}`)}
+	v1 := metadata.AppendToOutgoingContext(context.Background(), "x-gateway-api-version", "v1")
+	if resp, err := client.Invoke(v1, in); err != nil || string(resp.GetBody()) != `{"message":"hi"}` {
+		t.Fatalf("v1 invoke: %v %v", resp, err)
+	}
+	// The unversioned gateway has no default target.
+	if _, err := client.Invoke(context.Background(), in); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("unversioned invoke: %v", err)
+	}
+	v9 := metadata.AppendToOutgoingContext(context.Background(), "x-gateway-api-version", "v9")
+	if _, err := client.Invoke(v9, in); status.Code(err) != codes.NotFound {
+		t.Fatalf("unknown version: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/keicoqk/gateway/core"
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpcWebEcho is a minimal HTTP/1.1 gRPC-Web server for EchoService/Echo; "fail" is answered with NOT_FOUND.
+func grpcWebEcho() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/echo.EchoService/Echo" || r.Header.Get("Content-Type") != "application/grpc-web+proto" {
+			http.Error(w, "unexpected request", http.StatusNotFound)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req pb.EchoRequest
+		if len(body) < 5 || proto.Unmarshal(body[5:], &req) != nil {
+			http.Error(w, "bad frame", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		if req.GetMessage() == "fail" {
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "no%20such%20thing")
+			return
+		}
+		msg, _ := proto.Marshal(&pb.EchoResponse{Message: req.GetMessage()})
+		trailer := []byte("grpc-status: 0\r\ngrpc-message: \r\n")
+		for _, f := range []struct {
+			flag byte
+			b    []byte
+		}{{0, msg}, {0x80, trailer}} {
+			var hdr [5]byte
+			hdr[0] = f.flag
+			binary.BigEndian.PutUint32(hdr[1:], uint32(len(f.b)))
+			_, _ = w.Write(hdr[:])
+			_, _ = w.Write(f.b)
+		}
+	})
+}
+
+func TestGateway_GRPCWebUpstream(t *testing.T) {
+	upstream := httptest.NewServer(grpcWebEcho())
+	defer upstream.Close()
+
+	for _, target := range []string{upstream.Listener.Addr().String(), upstream.URL} {
+		srv := httptest.NewServer(Handler(Options{Targets: map[string]core.TargetConfig{
+			target: {Transport: core.TransportGRPCWeb},
+		}}))
+
+		code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "over http/1.1"}}, nil)
+		if code != http.StatusOK || string(b) != `{"message":"over http/1.1"}` {
+			t.Fatalf("%s: status=%d body=%s", target, code, b)
+		}
+
+		code, b = postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "fail"}}, nil)
+		if code != http.StatusBadGateway || !strings.Contains(string(b), "no such thing") || !strings.Contains(string(b), `"grpc_code":"NotFound"`) {
+			t.Fatalf("%s: status=%d body=%s", target, code, b)
+		}
+		srv.Close()
+	}
+}
@@ -1,41 +1,100 @@
 package gateway
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/jhump/protoreflect/desc"
 	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc"
 )
 
 // JSON structure of the HTTP request body.
 //
 // v1 (legacy): target + full method name + body
 // v2 (new): service + method + inline descriptor + params
+//
+// Client marshals the same structure, hence omitempty on every field.
 type gatewayRequest struct {
-	Target            string          `json:"target"`           // gRPC target address, e.g. "host:port"
-	TargetAddr        string          `json:"target_addr"`      // same as above, compatibility field
-	Method            string          `json:"method"`           // v1: full method name; v2: method name (e.g. CreateUser)
-	FullMethodNameAlt string          `json:"full_method_name"` // same as above, compatibility field
-	Body              json.RawMessage `json:"body"`             // request body as JSON
+	Target            string          `json:"target,omitempty"`           // gRPC target address, e.g. "host:port"
+	TargetAddr        string          `json:"target_addr,omitempty"`      // same as above, compatibility field
+	Method            string          `json:"method,omitempty"`           // v1: full method name; v2: method name (e.g. CreateUser)
+	FullMethodNameAlt string          `json:"full_method_name,omitempty"` // same as above, compatibility field
+	Body              json.RawMessage `json:"body,omitempty"`             // request body as JSON
 
 	// v2: gateway resolves single-interface descriptor dynamically; no dependency on core/*.pb files.
 	// service is optional; if omitted, method must be full name "/package.Service/Method", from which gateway parses service.
-	Service      string          `json:"service"`       // service name
-	Descriptor   string          `json:"descriptor"`    // base64(FileDescriptorSet bytes)
-	DescriptorID string          `json:"descriptor_id"` // logical ID; if only this is sent, use cached descriptor
-	Params       json.RawMessage `json:"params"`        // v2 request body JSON (alternative to body)
+	Service      string          `json:"service,omitempty"`       // service name
+	Descriptor   string          `json:"descriptor,omitempty"`    // base64(FileDescriptorSet bytes)
+	DescriptorID string          `json:"descriptor_id,omitempty"` // logical ID; if only this is sent, use cached descriptor; "id@v3" pins a version
+	Params       json.RawMessage `json:"params,omitempty"`        // v2 request body JSON (alternative to body)
 
 	// v2: chunked descriptor sync (to avoid oversized request bodies).
 	// Chunks are 0-based: index in [0, total).
-	DescriptorChunk      string `json:"descriptor_chunk"`       // base64(chunk bytes)
-	DescriptorChunkIndex int    `json:"descriptor_chunk_index"` // 0-based index
-	DescriptorChunkTotal int    `json:"descriptor_chunk_total"` // total chunks
-	DescriptorChunkReset bool   `json:"descriptor_chunk_reset"` // if true, clear existing cache before syncing
-}
+	DescriptorChunk      string `json:"descriptor_chunk,omitempty"`       // base64(chunk bytes)
+	DescriptorChunkIndex int    `json:"descriptor_chunk_index,omitempty"` // 0-based index
+	DescriptorChunkTotal int    `json:"descriptor_chunk_total,omitempty"` // total chunks
+	DescriptorChunkReset bool   `json:"descriptor_chunk_reset,omitempty"` // if true, replace the cached descriptor (as a new version); on chunk 0 also restart the sync
+
+	// DescriptorMerge merges the uploaded set (inline descriptor or completed chunk sync) into the pool already
+	// cached under descriptor_id instead of replacing it, so services from several proto modules can be
+	// registered incrementally. Conflicting files or symbols are rejected.
+	DescriptorMerge bool `json:"descriptor_merge,omitempty"`
+
+	// DescriptorEncoding is the compression of descriptor or the chunked upload: "gzip", "zstd" or "identity".
+	// Gzip and zstd are also detected from their magic bytes, so it is only needed to insist on one.
+	DescriptorEncoding string `json:"descriptor_encoding,omitempty"`
+
+	// Metadata is attached to the outgoing gRPC call (e.g. tracing or tenant headers); each value is a string or
+	// an array of strings. Keys are subject to Options.MetadataAllow and MetadataDeny.
+	Metadata map[string]metadataValues `json:"metadata,omitempty"`
+
+	// Debug adds a "_gateway" block (resolved method, upstream peer, dial/invoke timings, descriptor source,
+	// attempts) to the response, like the X-Gateway-Debug header.
+	Debug bool `json:"debug,omitempty"`
+
+	// Trace asks for the execution tree (upstream calls, order, timings, outcomes) in the X-Gateway-Trace response header.
+	Trace bool `json:"trace,omitempty"`
+
+	// FetchAll follows the pages of an AIP-158 list method and returns the items of all of them at once, like
+	// the X-Gateway-Fetch-All header. The method must enable it with MethodConfig.FetchAllPages.
+	FetchAll bool `json:"fetch_all,omitempty"`
 
-type errorResponse struct {
-	Error string `json:"error"`
+	// LongPoll opens a long-poll session on a server-streaming method instead of calling it, like the
+	// X-Gateway-Long-Poll header; see Options.LongPoll.
+	LongPoll bool `json:"long_poll,omitempty"`
+
+	// Echo returns the upstream request the call maps to instead of calling the upstream, like the
+	// X-Gateway-Echo header; see Options.RequestEcho.
+	Echo bool `json:"echo,omitempty"`
+
+	// SymmetricResponse encodes the response with the codec of the request (see X-Gateway-Encoding), like the
+	// X-Gateway-Symmetric-Response header and Options.SymmetricResponses.
+	SymmetricResponse bool `json:"symmetric_response,omitempty"`
+
+	// bodyFormat is the encoding of Body on method routes, from the Content-Type (or the query of GET
+	// requests); envelope bodies are JSON.
+	bodyFormat core.BodyFormat
+	// contentType is the Content-Type of non-empty method route bodies, for google.api.HttpBody inputs.
+	contentType string
+	// bidi marks method route requests whose body is streamed to a bidirectional-streaming method instead of
+	// being read up front, see Options.BidiStreaming.
+	bidi bool
+	// overrides are the field bindings of the Options.Routes entry the request matched, see
+	// core.InvokeRequest.Overrides.
+	overrides map[string]any
 }
 
 type descriptorSyncResponse struct {
@@ -47,135 +106,861 @@ type descriptorSyncResponse struct {
 
 // Handler returns the gateway http.Handler; descriptors are read from the SDK core package directory (shipped with SDK, callers need not generate).
 func Handler(opts Options) http.Handler {
-	inv := core.NewInvoker(core.DefaultDescriptorDir(), opts.Timeout)
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			// writeJSONError(w, http.StatusMethodNotAllowed, "method must be POST")
+	if len(opts.Versions) > 0 {
+		if len(opts.Tenants) > 0 {
+			panic("gateway: Versions cannot be combined with Tenants")
+		}
+		return newVersionRouter(opts)
+	}
+	if len(opts.Tenants) > 0 {
+		return newTenantRouter(opts)
+	}
+	return newHandler(opts, "")
+}
+
+// newHandler returns the gateway for opts; tenant is the name of the virtual gateway it serves, if any.
+func newHandler(opts Options, tenant string) *handler {
+	if opts.CORS != nil {
+		if err := opts.CORS.validate(); err != nil {
+			panic("gateway: " + err.Error())
+		}
+	}
+	live, webhooks := newLiveConfig(opts), newWebhookRoutes(opts)
+	if err := errors.Join(live.responses.err(), webhooks.err()); err != nil {
+		panic("gateway: " + err.Error())
+	}
+	invOpts := []core.InvokerOption{core.WithCallTimeout(opts.Timeout)}
+	if opts.Clock != nil {
+		invOpts = append(invOpts, core.WithClock(opts.Clock))
+	}
+	if opts.Rand != nil {
+		invOpts = append(invOpts, core.WithRand(opts.Rand))
+	}
+	invOpts = append(invOpts, core.WithDescriptorCacheLimits(opts.DescriptorCache))
+	if opts.Metrics != nil {
+		invOpts = append(invOpts, core.WithMetrics(opts.Metrics))
+	}
+	if opts.DescriptorFS != nil {
+		invOpts = append(invOpts, core.WithDescriptorFS(opts.DescriptorFS))
+	}
+	if opts.DescriptorFetcher != nil {
+		invOpts = append(invOpts, core.WithDescriptorFetcher(opts.DescriptorFetcher))
+	}
+	if opts.DescriptorLayers != nil {
+		invOpts = append(invOpts, core.WithDescriptorLayers(opts.DescriptorLayers...))
+	}
+	if len(opts.Targets) > 0 {
+		invOpts = append(invOpts, core.WithTargetConfigs(opts.Targets))
+	}
+	if opts.MaxResponseBytes > 0 {
+		invOpts = append(invOpts, core.WithMaxResponseBytes(opts.MaxResponseBytes))
+	}
+	if opts.Proxy != "" {
+		invOpts = append(invOpts, core.WithProxy(opts.Proxy))
+	}
+	if opts.HealthCheck != nil {
+		invOpts = append(invOpts, core.WithHealthChecks(*opts.HealthCheck))
+	}
+	if len(opts.UnaryInterceptors) > 0 {
+		invOpts = append(invOpts, core.WithUnaryInterceptors(opts.UnaryInterceptors...))
+	}
+	if len(opts.StreamInterceptors) > 0 {
+		invOpts = append(invOpts, core.WithStreamInterceptors(opts.StreamInterceptors...))
+	}
+	if opts.LocalServer == nil && opts.LocalServices != nil {
+		opts.LocalServer = grpc.NewServer()
+		opts.LocalServices(opts.LocalServer)
+	}
+	if opts.LocalServer != nil {
+		invOpts = append(invOpts, core.WithLocalServer(opts.LocalServer))
+	}
+	h := &handler{
+		opts:     opts,
+		inv:      core.NewInvoker(invOpts...),
+		webhooks: webhooks,
+		routes:   newRouteTable(opts.Routes),
+		metrics:  opts.Metrics,
+		tenant:   tenant,
+		faults:   newFaults(opts.Faults),
+	}
+	if sets := opts.preloadedSets; len(sets) > 0 || len(opts.PreloadDescriptors) > 0 {
+		if sets == nil {
+			sets = mustLoadDescriptorSources("preload descriptors", opts.PreloadDescriptors)
+		}
+		if _, err := h.inv.PreloadDescriptors(sets...); err != nil {
+			panic("gateway: preload descriptors: " + err.Error())
+		}
+	}
+	if sets := opts.baseSets; len(sets) > 0 || len(opts.BaseDescriptors) > 0 {
+		if sets == nil {
+			sets = mustLoadDescriptorSources("base descriptors", opts.BaseDescriptors)
+		}
+		if err := h.inv.SetBaseDescriptors(sets...); err != nil {
+			panic("gateway: " + err.Error())
+		}
+	}
+	h.inv.SetMethodPolicies(methodPolicies(opts.Methods))
+	h.live.Store(live)
+	if h.metrics == nil {
+		h.metrics = core.NopMetrics()
+	}
+	if opts.Quota != nil {
+		h.quota = newQuotaTracker(*opts.Quota, h.metrics)
+	}
+	if opts.Async != nil && opts.Async.Queue != nil {
+		h.startAsyncWorkers(*opts.Async)
+	}
+	if opts.ClientIP != nil {
+		f, err := newClientIPFilter(*opts.ClientIP)
+		if err != nil {
+			panic("gateway: " + err.Error())
+		}
+		h.clientIP = f
+	}
+	if opts.LongPoll != nil {
+		h.polls = newPollSessions(*opts.LongPoll, opts.Clock, h.metrics)
+	}
+	if opts.ReloadOnSIGHUP && opts.Reload != nil {
+		h.reloadOnSIGHUP()
+	}
+	if opts.Readiness != nil {
+		h.readiness = h.startReadiness(*opts.Readiness)
+	}
+	return h
+}
+
+type handler struct {
+	opts       Options // as passed to Handler; see live for the reloadable settings
+	live       atomic.Pointer[liveConfig]
+	reloadMu   sync.Mutex
+	inv        *core.Invoker
+	webhooks   *webhookRoutes
+	routes     *routeTable
+	metrics    core.Metrics
+	quota      *quotaTracker // nil without Options.Quota
+	polls      *pollSessions // nil without Options.LongPoll
+	kills      killSwitches
+	mocks      mockSwitches
+	faults     *faults
+	clientIP   *clientIPFilter // nil without Options.ClientIP
+	readiness  *readiness      // nil without Options.Readiness
+	signatures seenSignatures
+	tenant     string // see Options.Tenants
+}
+
+// ServeHTTP routes requests under opts.Path:
+//
+//	POST {Path}                          request envelope (v1/v2), encoded as per X-Gateway-Encoding
+//	GET  {Path}/openapi.json             OpenAPI document for the loaded descriptors
+//	GET  {Path}/services                 catalog of loaded services and methods
+//	GET  {Path}/ready                    readiness, see Options.Readiness
+//	*    {Path}/admin/...                admin operations, see serveAdmin
+//	POST {Path}/webhooks/{name}          webhook adapter, see Options.Webhooks
+//	GET  {Path}/polls/{session}          long-poll messages of a server stream, see Options.LongPoll
+//	POST {Path}/{package.Service}/{Method} plain request message (JSON, prototext, YAML or multipart form by
+//	                                     Content-Type, see MethodConfig.Multipart);
+//	                                     target from X-Gateway-Target
+//	GET  {Path}/{package.Service}/{Method} the request message bound from the query parameters
+//	*    /{Options.Routes pattern}       method of the first matching route, see Route
+//
+// Routes are matched first, on the full request path. Sub-routes are only served when opts.Path is set;
+// otherwise every other request is treated as an envelope.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r, ok := h.filterClientIP(w, r)
+	if !ok {
+		return
+	}
+	if h.opts.CORS != nil && h.opts.CORS.handleCORS(w, r, h.writeError) {
+		return
+	}
+	if h.opts.ResponseCompression {
+		if enc := negotiateEncoding(r.Header.Get("Accept-Encoding")); enc != "" {
+			cw := newCompressWriter(w, enc, h.opts.ResponseCompressionMinSize)
+			defer cw.Close()
+			w = cw
+			r = r.WithContext(context.WithValue(r.Context(), compressWriterKey{}, cw))
+		}
+	}
+	if route, params, ok := h.routes.match(r); ok {
+		h.serveRoute(w, r, route, params)
+		return
+	}
+	switch rel := h.subpath(r); {
+	case rel == "":
+		h.serveEnvelope(w, r)
+	case rel == "/openapi.json":
+		h.serveOpenAPI(w, r)
+	case rel == "/services":
+		h.serveServices(w, r)
+	case rel == "/ready":
+		h.serveReady(w, r)
+	case strings.HasPrefix(rel, "/admin/"):
+		h.serveAdmin(w, r, strings.TrimPrefix(rel, "/admin"))
+	case strings.HasPrefix(rel, "/webhooks/"):
+		h.serveWebhook(w, r, strings.TrimPrefix(rel, "/webhooks/"))
+	case strings.HasPrefix(rel, "/polls/"):
+		h.servePoll(w, r, strings.TrimPrefix(rel, "/polls/"))
+	default:
+		h.serveMethodRoute(w, r, rel)
+	}
+}
+
+// subpath returns the part of the request path below opts.Path ("" for the envelope endpoint itself).
+func (h *handler) subpath(r *http.Request) string {
+	base := strings.TrimSuffix(h.opts.Path, "/")
+	if base == "" || !strings.HasPrefix(r.URL.Path, base+"/") {
+		return ""
+	}
+	rel := strings.TrimPrefix(r.URL.Path, base)
+	if rel == "/" {
+		return ""
+	}
+	return rel
+}
+
+func (h *handler) serveEnvelope(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.rejectRoute(w, r, http.MethodPost)
+		return
+	}
+	if !h.verifySignature(w, r) {
+		return
+	}
+	decodedBody, r, err := h.decodeRequestBody(r, true)
+	if err != nil {
+		if !h.opts.StrictErrors && !errors.As(err, new(encodingError)) {
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
-		decodedBody, err := decodeRequestBody(r)
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidEncoding, "invalid encoded body: "+err.Error())
+		return
+	}
+	var req gatewayRequest
+	if err := json.Unmarshal(decodedBody, &req); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	h.serve(w, r, &req)
+}
+
+// serveMethodRoute handles POST {Path}/{package.Service}/{Method} with the request message as plain JSON body,
+// so standard HTTP tooling (e.g. generated from the OpenAPI document) can call methods directly. GET binds
+// the query parameters to the request message instead (see core.BodyFormatQuery), for cacheable, linkable
+// reads, and so do multipart/form-data posts with their parts under MethodConfig.Multipart.
+func (h *handler) serveMethodRoute(w http.ResponseWriter, r *http.Request, rel string) {
+	if _, _, err := core.ParseFullMethodName(rel); err != nil || strings.Count(rel, "/") != 2 {
+		h.rejectRoute(w, r, "")
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		h.rejectRoute(w, r, "GET, POST")
+		return
+	}
+	h.serveMethod(w, r, rel, r.Header.Get(targetHeader), nil)
+}
+
+// serveMethod calls method on target with the request message of r, bound from the query parameters of GET
+// and DELETE requests and read from the body of others, and with overrides on top (see Route).
+func (h *handler) serveMethod(w http.ResponseWriter, r *http.Request, method, target string, overrides map[string]any) {
+	query := r.Method == http.MethodGet || r.Method == http.MethodDelete
+	bidi := !query && h.live.Load().opts.BidiStreaming && wantsBidi(r)
+	if bidi && h.live.Load().opts.Signature != nil {
+		// The signature covers the whole body, which a full-duplex stream only ends after the last reply.
+		// Closing the connection spares the server draining a body the client may never end.
+		w.Header().Set("Connection", "close")
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "bidirectional streams cannot be signed; call the method without Accept: "+ndjsonContentType)
+		return
+	}
+	if ec := h.live.Load().opts.Encryption; ec != nil && ec.Required && (query || bidi) {
+		// Neither a query string nor a stream of messages can be sealed.
+		if bidi {
+			w.Header().Set("Connection", "close")
+		}
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidEncoding, fmt.Sprintf("request body must be encrypted (%s: %s); GET, DELETE and bidirectional stream calls cannot be", encodingHeader, EncodingAESGCM))
+		return
+	}
+	if !h.verifySignature(w, r) {
+		return
+	}
+	if query {
+		h.serve(w, r, &gatewayRequest{
+			Target:       target,
+			Method:       method,
+			DescriptorID: r.Header.Get(descriptorIDHeader),
+			Body:         []byte(r.URL.RawQuery),
+			Trace:        r.Header.Get(traceHeader) != "",
+			bodyFormat:   core.BodyFormatQuery,
+			overrides:    overrides,
+		})
+		return
+	}
+	if bidi {
+		h.serve(w, r, &gatewayRequest{
+			Target:       target,
+			Method:       method,
+			DescriptorID: r.Header.Get(descriptorIDHeader),
+			Trace:        r.Header.Get(traceHeader) != "",
+			bidi:         true,
+			overrides:    overrides,
+		})
+		return
+	}
+	body, r, err := h.decodeRequestBody(r, false)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidEncoding, "invalid encoded body: "+err.Error())
+		return
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		body, contentType = nil, ""
+	}
+	format := bodyFormat(r.Header.Get("Content-Type"))
+	if mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		mc := h.live.Load().opts.methodConfig(method).Multipart
+		if mc == nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "multipart/form-data bodies are not accepted by "+method)
+			return
+		}
+		query, err := mc.multipartQuery(body, params["boundary"])
 		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			// writeJSONError(w, http.StatusBadRequest, "invalid encoded body: "+err.Error())
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
 			return
 		}
-		var req gatewayRequest
-		if err := json.Unmarshal(decodedBody, &req); err != nil {
-			writeJSONError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		body, format, contentType = []byte(query), core.BodyFormatQuery, ""
+	}
+	h.serve(w, r, &gatewayRequest{
+		Target:       target,
+		Method:       method,
+		DescriptorID: r.Header.Get(descriptorIDHeader),
+		Body:         body,
+		Trace:        r.Header.Get(traceHeader) != "",
+		bodyFormat:   format,
+		contentType:  contentType,
+		overrides:    overrides,
+	})
+}
+
+// checkDescriptorEncoding reports why an uploaded descriptor (or chunk index of one) does not match its
+// descriptor_encoding, if it does not. The invoker decompresses sets by their magic bytes, which are in the
+// first chunk, so the later ones are not checked.
+func checkDescriptorEncoding(encoding string, index int, data []byte) string {
+	switch encoding {
+	case "":
+		return ""
+	case core.DescriptorEncodingIdentity, core.DescriptorEncodingGzip, core.DescriptorEncodingZstd:
+	default:
+		return fmt.Sprintf("unsupported descriptor_encoding %q", encoding)
+	}
+	detected := core.DetectDescriptorEncoding(data)
+	switch {
+	case index != 0 || detected == encoding:
+		return ""
+	case encoding == core.DescriptorEncodingIdentity:
+		return "descriptor is " + detected + "-compressed, not identity"
+	}
+	return "descriptor is not " + encoding + "-compressed"
+}
+
+// bodyFormat maps the Content-Type of a method route request to its body encoding. Unknown types
+// (including form-encoded bodies sent by curl -d) are read as JSON.
+func bodyFormat(contentType string) core.BodyFormat {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/x-protobuf", "application/x-protobuf-text", "text/x-protobuf-text":
+		return core.BodyFormatText
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return core.BodyFormatYAML
+	}
+	return core.BodyFormatJSON
+}
+
+// serve executes a parsed request: descriptor chunk sync or a gRPC invocation.
+func (h *handler) serve(w http.ResponseWriter, r *http.Request, req *gatewayRequest) {
+	live := h.live.Load()
+	opts, inv := live.opts, h.inv
+
+	// Pin the effective clock and randomness into the request context (unless the replay harness already did)
+	// so every subsystem below observes the same, replayable sources.
+	ctx := r.Context()
+	ctx = core.ContextWithClock(ctx, core.ClockFromContext(ctx, opts.Clock))
+	ctx = core.ContextWithRand(ctx, core.RandFromContext(ctx, opts.Rand))
+	// The invoker fills in the call info; error responses read it from r.
+	ctx = core.WithCallInfo(ctx)
+	r = r.WithContext(ctx)
+
+	// Request ID: honor the caller's X-Request-Id, otherwise derive one from the (replayable) Rand source.
+	requestID := r.Header.Get(requestIDHeader)
+	if requestID == "" {
+		requestID = newRequestID(core.RandFromContext(ctx, nil))
+	}
+	w.Header().Set(requestIDHeader, requestID)
+	if opts.SymmetricResponses || req.SymmetricResponse || r.Header.Get(symmetricResponseHeader) != "" {
+		setSymmetricResponse(r)
+	}
+
+	if h.quota != nil {
+		clock := core.ClockFromContext(ctx, nil)
+		key := h.quota.clientKey(r)
+		if ok, limit, wait := h.quota.admit(key, clock.Now()); !ok {
+			w.Header().Set(retryAfterHeader, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			h.writeError(w, r, http.StatusTooManyRequests, ErrCodeQuotaExceeded, "quota exceeded: "+limit)
 			return
 		}
+		cw := &countingWriter{ResponseWriter: w}
+		w = cw
+		defer func() { h.quota.addBytes(key, max(r.ContentLength, 0)+cw.n, clock.Now()) }()
+	}
 
-		// Chunked descriptor sync path: uses the same HTTP endpoint, but does not invoke gRPC.
-		// This must run before target/method validation because syncing does not require them.
-		if req.DescriptorChunk != "" || req.DescriptorChunkTotal > 0 || req.DescriptorChunkIndex > 0 || req.DescriptorChunkReset {
-			if req.DescriptorID == "" {
-				writeJSONError(w, http.StatusBadRequest, "missing descriptor_id for descriptor chunk sync")
-				return
-			}
-			if req.DescriptorChunk == "" {
-				writeJSONError(w, http.StatusBadRequest, "missing descriptor_chunk for descriptor chunk sync")
-				return
-			}
-			chunkBytes, err := base64.StdEncoding.DecodeString(req.DescriptorChunk)
-			if err != nil {
-				writeJSONError(w, http.StatusBadRequest, "invalid base64 descriptor_chunk: "+err.Error())
-				return
-			}
-			received, total, done, err := inv.SyncInlineDescriptorChunk(req.DescriptorID, req.DescriptorChunkIndex, req.DescriptorChunkTotal, chunkBytes, req.DescriptorChunkReset)
-			if err != nil {
-				writeJSONError(w, http.StatusBadRequest, "sync descriptor chunk: "+err.Error())
-				return
+	// Chunked descriptor sync path: uses the same HTTP endpoint, but does not invoke gRPC.
+	// This must run before target/method validation because syncing does not require them.
+	var namespace string
+	if opts.DescriptorNamespace != nil {
+		namespace = opts.DescriptorNamespace(r)
+	}
+	if hasNUL(namespace, req.DescriptorID) {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, errNULInDescriptorKey)
+		return
+	}
+	if req.DescriptorChunk != "" || req.DescriptorChunkTotal > 0 || req.DescriptorChunkIndex > 0 || req.DescriptorChunkReset {
+		if !authorizeDescriptorWrite(opts, r) {
+			h.writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "descriptor upload requires a valid "+descriptorTokenHeader+" header")
+			return
+		}
+		if req.DescriptorID == "" {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidDescriptor, "missing descriptor_id for descriptor chunk sync")
+			return
+		}
+		if req.DescriptorChunk == "" {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidDescriptor, "missing descriptor_chunk for descriptor chunk sync")
+			return
+		}
+		chunkBytes, err := base64.StdEncoding.DecodeString(req.DescriptorChunk)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidDescriptor, "invalid base64 descriptor_chunk: "+err.Error())
+			return
+		}
+		if msg := checkDescriptorEncoding(req.DescriptorEncoding, req.DescriptorChunkIndex, chunkBytes); msg != "" {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidDescriptor, msg)
+			return
+		}
+		received, total, done, err := inv.SyncInlineDescriptorChunk(core.NamespacedDescriptorID(namespace, req.DescriptorID), req.DescriptorChunkIndex, req.DescriptorChunkTotal, chunkBytes, req.DescriptorChunkReset, req.DescriptorMerge)
+		if err != nil {
+			resp := errorResponse{Error: "sync descriptor chunk: " + err.Error(), Code: ErrCodeInvalidDescriptor, err: err}
+			var invalid *core.DescriptorSetError
+			if errors.As(err, &invalid) {
+				resp.DescriptorProblems = invalid.Problems
 			}
+			h.writeErrorResponse(w, r, http.StatusBadRequest, resp)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(descriptorSyncResponse{
+			DescriptorID:   req.DescriptorID,
+			ReceivedChunks: received,
+			TotalChunks:    total,
+			Done:           done,
+		})
+		return
+	}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode(descriptorSyncResponse{
-				DescriptorID:   req.DescriptorID,
-				ReceivedChunks: received,
-				TotalChunks:    total,
-				Done:           done,
-			})
+	// target precedence: method split > target > target_addr > opts.DefaultTarget; a target naming a group is split
+	target := req.Target
+	if target == "" {
+		target = req.TargetAddr
+	}
+	if target == "" {
+		target = opts.DefaultTarget
+	}
+	override, err := h.targetOverride(live, r, req.fullMethodName())
+	if err != nil {
+		h.writeError(w, r, http.StatusForbidden, ErrCodeForbidden, err.Error())
+		return
+	}
+	requested := target
+	if override != "" {
+		// A trusted caller's override wins over everything else, see TargetOverrideConfig.
+		target, requested = override, override
+	} else {
+		if !opts.targetAllowed(requested) {
+			h.writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "target "+requested+" is not allowed")
 			return
 		}
+		target = opts.splitTarget(r, core.RandFromContext(ctx, nil), req.fullMethodName(), requested)
+	}
+	mockKey, mock, mocked := h.mocks.mock(opts, req.fullMethodName())
+	if target == "" && !mocked {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeMissingTarget, "missing target")
+		return
+	}
+	if ks, ok := h.kills.match(req.fullMethodName(), requested, target); ok {
+		h.rejectKilled(w, r, ks)
+		return
+	}
+
+	// body or params, default {}
+	body := req.Body
+	if body == nil {
+		body = req.Params
+	}
+	if body == nil && req.bodyFormat == core.BodyFormatJSON {
+		body = []byte("{}")
+	}
+	if mocked {
+		data := mockData{Header: r.Header, RequestID: requestID, Method: req.fullMethodName(), Target: target}
+		h.serveMock(ctx, w, r, live, mockKey, mock, data, body, req.bodyFormat == core.BodyFormatJSON)
+		return
+	}
+
+	// v2: either descriptor or descriptor_id.
+	// - If descriptor is provided: use it and update cache to latest;
+	// - If only descriptor_id: look up descriptor from cache.
+	timeout, err := requestTimeout(r)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	md, err := opts.outgoingMetadata(req.Metadata)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		return
+	}
 
-		// target precedence: target > target_addr > opts.DefaultTarget
-		target := req.Target
-		if target == "" {
-			target = req.TargetAddr
+	var invokeReq core.InvokeRequest
+	invokeReq.Target = target
+	invokeReq.Timeout = timeout
+	invokeReq.DescriptorNamespace = namespace
+	if req.Descriptor != "" {
+		if !authorizeDescriptorWrite(opts, r) {
+			h.writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "descriptor upload requires a valid "+descriptorTokenHeader+" header")
+			return
 		}
-		if target == "" {
-			target = opts.DefaultTarget
+		if req.Method == "" {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeMissingMethod, "missing method for inline descriptor request")
+			return
 		}
-		if target == "" {
-			writeJSONError(w, http.StatusBadRequest, "missing target")
+		descBytes, err := base64.StdEncoding.DecodeString(req.Descriptor)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidDescriptor, "invalid base64 descriptor: "+err.Error())
 			return
 		}
-
-		// body or params, default {}
-		body := req.Body
-		if body == nil {
-			body = req.Params
+		if msg := checkDescriptorEncoding(req.DescriptorEncoding, 0, descBytes); msg != "" {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidDescriptor, msg)
+			return
+		}
+		invokeReq.ServiceName = req.Service // may be empty; resolved later from method="/pkg.Svc/Method"
+		invokeReq.MethodName = req.Method
+		invokeReq.InlineDescriptorSet = descBytes
+		invokeReq.DescriptorID = req.DescriptorID
+		invokeReq.MergeDescriptor = req.DescriptorMerge
+	} else if req.DescriptorID != "" {
+		if req.Method == "" {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeMissingMethod, "missing method for descriptor_id request")
+			return
+		}
+		invokeReq.ServiceName = req.Service // may be empty; resolved later from method="/pkg.Svc/Method"
+		invokeReq.MethodName = req.Method
+		invokeReq.DescriptorID = req.DescriptorID
+	} else {
+		// v1: full method name (compat full_method_name field)
+		fullMethod := req.Method
+		if fullMethod == "" {
+			fullMethod = req.FullMethodNameAlt
 		}
-		if body == nil {
-			body = []byte("{}")
+		if fullMethod == "" {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeMissingMethod, "missing method (full_method_name) or inline descriptor fields")
+			return
 		}
+		invokeReq.FullMethodName = fullMethod
+	}
 
-		// v2: either descriptor or descriptor_id.
-		// - If descriptor is provided: use it and update cache to latest;
-		// - If only descriptor_id: look up descriptor from cache.
-		var invokeReq core.InvokeRequest
-		invokeReq.Target = target
-		invokeReq.Body = body
-		if req.Descriptor != "" {
-			if req.Method == "" {
-				writeJSONError(w, http.StatusBadRequest, "missing method for inline descriptor request")
-				return
-			}
-			descBytes, err := base64.StdEncoding.DecodeString(req.Descriptor)
-			if err != nil {
-				writeJSONError(w, http.StatusBadRequest, "invalid base64 descriptor: "+err.Error())
-				return
-			}
-			invokeReq.ServiceName = req.Service // may be empty; resolved later from method="/pkg.Svc/Method"
-			invokeReq.MethodName = req.Method
-			invokeReq.InlineDescriptorSet = descBytes
-			invokeReq.DescriptorID = req.DescriptorID
-		} else if req.DescriptorID != "" {
-			if req.Method == "" {
-				writeJSONError(w, http.StatusBadRequest, "missing method for descriptor_id request")
-				return
-			}
-			invokeReq.ServiceName = req.Service // may be empty; resolved later from method="/pkg.Svc/Method"
-			invokeReq.MethodName = req.Method
-			invokeReq.DescriptorID = req.DescriptorID
-		} else {
-			// v1: full method name (compat full_method_name field)
-			fullMethod := req.Method
-			if fullMethod == "" {
-				fullMethod = req.FullMethodNameAlt
+	var diag *core.Diagnostics
+	if req.Debug || r.Header.Get(debugHeader) != "" {
+		diag = &core.Diagnostics{}
+		invokeReq.Diagnostics = diag
+	}
+	// Per-method settings apply to the method that is called, however the request spells it (e.g. with a
+	// short service name), so they are looked up by its resolved name.
+	method, err := inv.ResolveMethod(ctx, &invokeReq)
+	if err != nil {
+		if r.Context().Err() == context.Canceled {
+			if opts.OnClientDisconnect != nil {
+				opts.OnClientDisconnect(r, err)
 			}
-			if fullMethod == "" {
-				writeJSONError(w, http.StatusBadRequest, "missing method (full_method_name) or inline descriptor fields")
-				return
-			}
-			invokeReq.FullMethodName = fullMethod
+			h.writeError(w, r, statusClientClosedRequest, ErrCodeClientClosed, "client closed request")
+			return
+		}
+		h.writeInvokeError(w, r, err, diag)
+		return
+	}
+	mc := opts.methodConfig(method)
+	invokeReq.HedgeTargets = opts.hedgeTargets(method, requested, target)
+	invokeReq.Metadata = md
+	invokeReq.Body = body
+	invokeReq.BodyFormat = req.bodyFormat
+	invokeReq.HTTPBodyContentType = req.contentType
+	invokeReq.WKTCoercion = opts.WKTCoercion
+	invokeReq.FieldPresence = opts.FieldPresence
+	invokeReq.Int64Encoding = opts.Int64Encoding
+	invokeReq.LenientEnums = mc.LenientEnums
+	invokeReq.Defaults = mc.Defaults
+	invokeReq.Overrides = req.overrides
+	mc.Affinity.apply(r, &invokeReq)
+	invokeReq.UnknownFields = opts.unknownFieldPolicy(method)
+	if req.FetchAll || r.Header.Get(fetchAllHeader) != "" {
+		invokeReq.FetchAllPages = mc.FetchAllPages
+		if invokeReq.FetchAllPages <= 0 {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "fetch_all is not enabled for "+method)
+			return
 		}
+	}
+	invokeReq.OnUnknownFields = func(paths []string) {
+		w.Header().Set(unknownFieldsHeader, strings.Join(paths, ", "))
+	}
 
-		resp, err := inv.Invoke(r.Context(), &invokeReq)
-		if err != nil {
-			writeJSONError(w, http.StatusBadGateway, err.Error())
+	onResolve := h.onResolve(w, r, opts, requested, target)
+	var httpBodyOutput bool // the method returns google.api.HttpBody
+	invokeReq.OnResolve = func(md *desc.MethodDescriptor) error {
+		httpBodyOutput = core.IsHTTPBody(md.GetOutputType())
+		return onResolve(md)
+	}
+	if live.authz.enabled() {
+		invokeReq.Authorize = live.authz.check(opts, r)
+	}
+	if opts.PII != nil && opts.PII.RequireEncryption {
+		invokeReq.Authorize = requireEncryptedPII(opts, r, invokeReq.Authorize)
+	}
+	invokeReq.FieldVisibility = live.visible.forRequest(opts, r, method)
+	if req.Echo || r.Header.Get(echoHeader) != "" {
+		if !opts.RequestEcho {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "request echo is not enabled")
+			return
+		}
+		h.echoRequest(ctx, w, r, invokeReq)
+		return
+	}
+	if req.LongPoll || r.Header.Get(longPollHeader) != "" {
+		if h.polls == nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "long polling is not enabled")
 			return
 		}
+		h.openPoll(ctx, w, r, invokeReq)
+		return
+	}
+	if req.bidi {
+		h.serveBidi(ctx, opts, w, r, invokeReq)
+		return
+	}
+	raw := mc.RawResponse
+	rawData := headerData{Header: r.Header, RequestID: requestID, Method: method, Target: target}
+	if raw != nil && h.streamRaw(ctx, w, r, live, raw, rawData, invokeReq) {
+		return
+	}
+	if opts.Async != nil && opts.Async.Queue != nil && mc.Async {
+		h.enqueue(ctx, w, r, requestID, invokeReq)
+		return
+	}
+	idem, done := h.beginIdempotent(ctx, w, r, opts, &invokeReq)
+	if done {
+		return
+	}
+	var stored []byte // the response recorded under the Idempotency-Key; nil releases the key
+	if idem != nil {
+		defer func() { idem.finish(ctx, stored) }()
+	}
+	var audit *auditCall
+	if opts.AuditSink != nil {
+		audit = &auditCall{opts: opts, start: core.ClockFromContext(ctx, nil).Now()}
+		invokeReq.Capture = audit.capture
+	}
+	var contract *contractCall
+	if opts.ContractSink != nil {
+		contract = &contractCall{opts: opts}
+		invokeReq.Capture = chainCapture(invokeReq.Capture, contract.capture)
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write(resp)
+	slowThreshold := mc.SlowThreshold
+	if slowThreshold > 0 && invokeReq.Diagnostics == nil {
+		invokeReq.Diagnostics = &core.Diagnostics{}
+	}
+	invokeStart := core.ClockFromContext(ctx, nil).Now()
+
+	var trace *core.Span
+	if req.Trace || opts.TraceSink != nil {
+		ctx, trace = core.NewTrace(ctx, "request")
+		trace.SetAttr("request_id", requestID)
+	}
+	resp, err := inv.Invoke(ctx, &invokeReq)
+	if elapsed := core.ClockFromContext(ctx, nil).Now().Sub(invokeStart); slowThreshold > 0 && elapsed > slowThreshold {
+		h.logSlow(ctx, opts, slowThreshold, elapsed, requestID, method, target, invokeReq.Diagnostics, err)
+	}
+	if audit != nil && audit.rec != nil {
+		audit.rec.RequestID, audit.rec.Namespace, audit.rec.Target = requestID, namespace, target
+		h.writeAudit(ctx, r, audit.rec, err)
+	}
+	if contract != nil && contract.rec != nil {
+		h.writeContract(ctx, contract.rec, err)
+	}
+	if trace != nil {
+		trace.End(err)
+		if opts.TraceSink != nil {
+			opts.TraceSink(trace)
+		}
+		if req.Trace {
+			setTraceHeader(w, trace)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, core.ErrStreamingMethod) && raw == nil && h.streamRaw(ctx, w, r, live, nil, rawData, invokeReq) {
+			return
+		}
+		if r.Context().Err() == context.Canceled {
+			// The client disconnected; the upstream call was cancelled with the request context.
+			if opts.OnClientDisconnect != nil {
+				opts.OnClientDisconnect(r, err)
+			}
+			h.writeError(w, r, statusClientClosedRequest, ErrCodeClientClosed, "client closed request")
+			return
+		}
+		var denied *authorizationError
+		if errors.As(err, &denied) {
+			h.writeError(w, r, denied.status, denied.code, denied.msg)
+			return
+		}
+		if errors.Is(err, core.ErrUnknownFields) || errors.Is(err, core.ErrNotPaginated) || errors.Is(err, core.ErrInvalidStreamBody) ||
+			errors.Is(err, core.ErrInvalidQuery) || errors.Is(err, core.ErrUnsafeInt64) || errors.Is(err, core.ErrInvalidBinding) {
+			h.writeErrorResponse(w, r, http.StatusBadRequest, errorResponse{Error: err.Error(), Code: ErrCodeInvalidRequest, err: err})
+			return
+		}
+		h.writeInvokeError(w, r, err, diag)
+		return
+	}
+	headers, err := live.responses.responseHeaders(headerData{Header: r.Header, RequestID: requestID, Method: method, Target: target}, resp)
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	if raw == nil && httpBodyOutput {
+		raw = httpBodyResponse
+	}
+	if raw != nil {
+		h.writeRaw(w, r, raw, headers, resp)
+		return
+	}
+	resp, err = live.responses.transform(opts, envelopeData{
+		Data:      resp,
+		RequestID: requestID,
+		Method:    method,
+		Target:    target,
 	})
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	stored = resp
+	if diag != nil {
+		resp = withDiagnostics(resp, diag)
+	}
+	for name, values := range headers {
+		w.Header()[name] = values
+	}
+	if mc.ETag && diag == nil {
+		h.writeTaggedResponseBody(w, r, resp)
+		return
+	}
+
+	h.writeResponseBody(w, r, resp)
+}
+
+// statusClientClosedRequest is the de facto (nginx) status for requests abandoned by the client; it is
+// only ever seen in logs and metrics since the client is gone.
+const statusClientClosedRequest = 499
+
+const (
+	requestIDHeader         = "X-Request-Id"
+	descriptorTokenHeader   = "X-Gateway-Descriptor-Token"
+	adminTokenHeader        = "X-Gateway-Admin-Token"
+	traceHeader             = "X-Gateway-Trace"
+	targetHeader            = "X-Gateway-Target"
+	descriptorIDHeader      = "X-Gateway-Descriptor-Id"
+	debugHeader             = "X-Gateway-Debug"
+	unknownFieldsHeader     = "X-Gateway-Unknown-Fields"
+	fetchAllHeader          = "X-Gateway-Fetch-All"
+	longPollHeader          = "X-Gateway-Long-Poll"
+	echoHeader              = "X-Gateway-Echo"
+	symmetricResponseHeader = "X-Gateway-Symmetric-Response"
+	targetOverrideHeader    = "X-Gateway-Target-Override"
+)
+
+// Standard headers the gateway reads or sets, named so the default CORS policy can list them.
+const (
+	etagHeader               = "ETag"
+	ifNoneMatchHeader        = "If-None-Match"
+	retryAfterHeader         = "Retry-After"
+	locationHeader           = "Location"
+	deprecationHeader        = "Deprecation"
+	sunsetHeader             = "Sunset"
+	linkHeader               = "Link"
+	contentDispositionHeader = "Content-Disposition"
+)
+
+// withDiagnostics adds diag as the "_gateway" member of a JSON object response; other responses are returned
+// unchanged.
+func withDiagnostics(resp []byte, diag *core.Diagnostics) []byte {
+	trimmed := bytes.TrimSpace(resp)
+	if len(trimmed) < 2 || trimmed[0] != '{' {
+		return resp
+	}
+	b, err := json.Marshal(diag)
+	if err != nil {
+		return resp
+	}
+	body := bytes.TrimSpace(trimmed[1 : len(trimmed)-1])
+	out := append([]byte(`{"_gateway":`), b...)
+	if len(body) > 0 {
+		out = append(append(out, ','), body...)
+	}
+	return append(out, '}')
+}
+
+// setTraceHeader writes trace as base64(JSON) so arbitrary error text stays header-safe.
+func setTraceHeader(w http.ResponseWriter, trace *core.Span) {
+	b, err := json.Marshal(trace)
+	if err != nil {
+		return
+	}
+	w.Header().Set(traceHeader, base64.StdEncoding.EncodeToString(b))
+}
+
+// errNULInDescriptorKey rejects namespaces and descriptor_ids that hasNUL reports.
+const errNULInDescriptorKey = "descriptor namespace and descriptor_id must not contain NUL bytes"
+
+// hasNUL reports whether any of parts contains a NUL byte. NUL separates the namespace from the descriptor_id
+// in descriptor cache keys (see core.NamespacedDescriptorID) and from the Idempotency-Key in idempotency
+// keys, so a namespace or descriptor_id containing one could address another namespace's entries.
+func hasNUL(parts ...string) bool {
+	for _, p := range parts {
+		if strings.IndexByte(p, 0) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeDescriptorWrite reports whether r may upload descriptors under Options.DescriptorWriteToken.
+func authorizeDescriptorWrite(opts Options, r *http.Request) bool {
+	if opts.DescriptorWriteToken == "" {
+		return true
+	}
+	got := r.Header.Get(descriptorTokenHeader)
+	return subtle.ConstantTimeCompare([]byte(got), []byte(opts.DescriptorWriteToken)) == 1
 }
 
-func writeJSONError(w http.ResponseWriter, code int, msg string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	_ = json.NewEncoder(w).Encode(errorResponse{Error: msg})
+func newRequestID(rnd core.Rand) string {
+	return fmt.Sprintf("%016x%016x", rnd.Int63(), rnd.Int63())
 }
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -9,12 +10,19 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/keicoqk/gateway/core"
 	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 type echoServer struct {
@@ -25,7 +33,7 @@ func (s echoServer) Echo(_ context.Context, req *pb.EchoRequest) (*pb.EchoRespon
 	return &pb.EchoResponse{Message: req.GetMessage()}, nil
 }
 
-func startTestGRPCServer(t *testing.T) (target string, stop func()) {
+func startTestGRPCServer(t testing.TB) (target string, stop func()) {
 	t.Helper()
 
 	lis, err := net.Listen("tcp", "127.0.0.1:0")
@@ -99,6 +107,84 @@ func TestGateway_V2InlineDescriptor(t *testing.T) {
 	}
 }
 
+func TestGateway_InvalidInlineDescriptor(t *testing.T) {
+	srv := httptest.NewServer(Handler(Options{}))
+	defer srv.Close()
+
+	// The service's request type lives in an import that was left out of the set.
+	set, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:       proto.String("acme/api.proto"),
+		Package:    proto.String("acme"),
+		Dependency: []string{"acme/types.proto"},
+		Service: []*descriptorpb.ServiceDescriptorProto{{Name: proto.String("Users"), Method: []*descriptorpb.MethodDescriptorProto{{
+			Name: proto.String("Get"), InputType: proto.String(".acme.GetRequest"), OutputType: proto.String(".acme.GetRequest"),
+		}}}},
+	}}})
+	code, b := postGateway(t, srv.URL, map[string]any{
+		"target":     "127.0.0.1:1",
+		"method":     "/acme.Users/Get",
+		"descriptor": base64.StdEncoding.EncodeToString(set),
+	}, nil)
+	var out errorResponse
+	_ = json.Unmarshal(b, &out)
+	if code != http.StatusBadRequest || out.Code != ErrCodeInvalidDescriptor || len(out.DescriptorProblems) != 3 {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	if p := out.DescriptorProblems[0]; p.File != "acme/api.proto" || !strings.Contains(p.Problem, `imports "acme/types.proto"`) {
+		t.Fatalf("first problem: %+v", p)
+	}
+}
+
+func TestGateway_CompressedDescriptor(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+	srv := httptest.NewServer(Handler(Options{}))
+	defer srv.Close()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(mustReadDescriptor(t))
+	_ = zw.Close()
+	descB64 := base64.StdEncoding.EncodeToString(gz.Bytes())
+
+	// Detected from the magic bytes.
+	code, b := postGateway(t, srv.URL, map[string]any{
+		"target":     target,
+		"method":     "/echo.EchoService/Echo",
+		"descriptor": descB64,
+		"params":     map[string]any{"message": "zipped"},
+	}, nil)
+	if code != http.StatusOK || !strings.Contains(string(b), "zipped") {
+		t.Fatalf("inline: status=%d body=%s", code, b)
+	}
+	// A chunked upload is decompressed once complete.
+	code, b = postGateway(t, srv.URL, map[string]any{
+		"descriptor_id":          "echo-gz",
+		"descriptor_chunk":       descB64,
+		"descriptor_chunk_total": 1,
+		"descriptor_encoding":    "gzip",
+	}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("chunk: status=%d body=%s", code, b)
+	}
+	code, b = postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "descriptor_id": "echo-gz"}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("cached: status=%d body=%s", code, b)
+	}
+	// A declared encoding must match.
+	for _, enc := range []string{"zstd", "brotli"} {
+		code, b = postGateway(t, srv.URL, map[string]any{
+			"target":              target,
+			"method":              "/echo.EchoService/Echo",
+			"descriptor":          descB64,
+			"descriptor_encoding": enc,
+		}, nil)
+		if code != http.StatusBadRequest || !strings.Contains(string(b), ErrCodeInvalidDescriptor) {
+			t.Fatalf("%s: status=%d body=%s", enc, code, b)
+		}
+	}
+}
+
 func TestGateway_V1FullMethodCompat(t *testing.T) {
 	target, stopGRPC := startTestGRPCServer(t)
 	defer stopGRPC()
@@ -351,3 +437,243 @@ func TestGateway_V2ChunkedDescriptorSync_ThenDescriptorID(t *testing.T) {
 		t.Fatalf("unexpected message: %#v", out2["message"])
 	}
 }
+
+// postGateway sends body b64v1-encoded to url with the given headers and returns the status and raw response body.
+func postGateway(t *testing.T, url string, body map[string]any, header map[string]string) (int, []byte) {
+	t.Helper()
+
+	raw, _ := json.Marshal(body)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBufferString(encodeBase64V1(raw)))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, b
+}
+
+// echoMethodSpellings returns request fields calling /echo.EchoService/Echo with its inline descriptor, by
+// every spelling of the method the gateway resolves.
+func echoMethodSpellings(t *testing.T) map[string]map[string]any {
+	t.Helper()
+	descriptor := base64.StdEncoding.EncodeToString(mustReadDescriptor(t))
+	return map[string]map[string]any{
+		"canonical":     {"method": "/echo.EchoService/Echo", "descriptor": descriptor},
+		"short service": {"service": "EchoService", "method": "Echo", "descriptor": descriptor},
+		"no slash":      {"method": "echo.EchoService/Echo", "descriptor": descriptor},
+		"leading dot":   {"service": ".echo.EchoService", "method": "Echo", "descriptor": descriptor},
+	}
+}
+
+// TestGateway_MethodConfigBySpelling checks that per-method settings apply to the called method however the
+// request spells it.
+func TestGateway_MethodConfigBySpelling(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+	srv := httptest.NewServer(Handler(Options{Methods: map[string]MethodConfig{
+		"/echo.EchoService/Echo": {Defaults: map[string]any{"message": "defaulted"}},
+	}}))
+	defer srv.Close()
+
+	for name, fields := range echoMethodSpellings(t) {
+		body := map[string]any{"target": target, "params": map[string]any{}}
+		for k, v := range fields {
+			body[k] = v
+		}
+		code, b := postGateway(t, srv.URL, body, nil)
+		if code != http.StatusOK || !strings.Contains(string(b), `"defaulted"`) {
+			t.Errorf("%s: status=%d body=%s", name, code, b)
+		}
+	}
+}
+
+func TestGateway_DescriptorIDFallsBackToDirectory(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+	srv := httptest.NewServer(Handler(Options{Timeout: 5 * time.Second}))
+	defer srv.Close()
+
+	// Nothing is cached under the id; the embedded echo set of the directory layer serves the call.
+	code, b := postGateway(t, srv.URL, map[string]any{
+		"target":        target,
+		"method":        "/echo.EchoService/Echo",
+		"descriptor_id": "never-uploaded",
+		"params":        map[string]any{"message": "hi"},
+	}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+}
+
+func TestGateway_DescriptorWriteTokenAndNamespaces(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	descB64 := base64.StdEncoding.EncodeToString(mustReadDescriptor(t))
+
+	h := Handler(Options{
+		Timeout:              5 * time.Second,
+		DescriptorWriteToken: "s3cret",
+		// Leave out the directory, whose embedded echo set would otherwise answer unknown descriptor_ids.
+		DescriptorLayers: []core.DescriptorLayer{core.LayerCache, core.LayerRegistry},
+		DescriptorNamespace: func(r *http.Request) string {
+			return r.Header.Get("X-Client")
+		},
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	upload := map[string]any{
+		"target":        target,
+		"method":        "/echo.EchoService/Echo",
+		"descriptor":    descB64,
+		"descriptor_id": "shared",
+		"params":        map[string]any{"message": "hi"},
+	}
+	if code, b := postGateway(t, srv.URL, upload, map[string]string{"X-Client": "alice"}); code != http.StatusForbidden {
+		t.Fatalf("upload without token: expected 403, got %d: %s", code, b)
+	}
+	if code, b := postGateway(t, srv.URL, upload, map[string]string{"X-Client": "alice", descriptorTokenHeader: "s3cret"}); code != http.StatusOK {
+		t.Fatalf("upload with token: expected 200, got %d: %s", code, b)
+	}
+
+	lookup := map[string]any{
+		"target":        target,
+		"method":        "/echo.EchoService/Echo",
+		"descriptor_id": "shared",
+		"params":        map[string]any{"message": "hi"},
+	}
+	if code, b := postGateway(t, srv.URL, lookup, map[string]string{"X-Client": "alice"}); code != http.StatusOK {
+		t.Fatalf("lookup in own namespace: expected 200, got %d: %s", code, b)
+	}
+	if code, b := postGateway(t, srv.URL, lookup, map[string]string{"X-Client": "bob"}); code == http.StatusOK {
+		t.Fatalf("lookup from another namespace must not see alice's descriptor, got 200: %s", b)
+	}
+
+	// A caller in the empty namespace must not reach alice's key by embedding the separator in descriptor_id.
+	lookup["descriptor_id"] = "alice\x00shared"
+	if code, b := postGateway(t, srv.URL, lookup, nil); code != http.StatusBadRequest {
+		t.Fatalf("lookup of a NUL descriptor_id: expected 400, got %d: %s", code, b)
+	}
+	upload["descriptor_id"] = "alice\x00shared"
+	if code, b := postGateway(t, srv.URL, upload, map[string]string{descriptorTokenHeader: "s3cret"}); code != http.StatusBadRequest {
+		t.Fatalf("upload under a NUL descriptor_id: expected 400, got %d: %s", code, b)
+	}
+}
+
+func TestGateway_TraceTree(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	var stored *core.Span
+	h := Handler(Options{
+		Timeout:   5 * time.Second,
+		TraceSink: func(s *core.Span) { stored = s },
+	})
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	raw, _ := json.Marshal(map[string]any{
+		"target": target,
+		"method": "/echo.EchoService/Echo",
+		"body":   map[string]any{"message": "traced"},
+		"trace":  true,
+	})
+	resp, err := http.Post(srv.URL, "application/json", bytes.NewBufferString(encodeBase64V1(raw)))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected status: %d, body: %s", resp.StatusCode, string(b))
+	}
+
+	hdr, err := base64.StdEncoding.DecodeString(resp.Header.Get(traceHeader))
+	if err != nil {
+		t.Fatalf("decode trace header: %v", err)
+	}
+	var root struct {
+		Name     string `json:"name"`
+		Outcome  string `json:"outcome"`
+		Children []struct {
+			Name     string `json:"name"`
+			Method   string `json:"method"`
+			Children []struct {
+				Name    string `json:"name"`
+				Target  string `json:"target"`
+				Outcome string `json:"outcome"`
+			} `json:"children"`
+		} `json:"children"`
+	}
+	if err := json.Unmarshal(hdr, &root); err != nil {
+		t.Fatalf("unmarshal trace: %v, %s", err, hdr)
+	}
+	if root.Name != "request" || root.Outcome != "ok" || len(root.Children) != 1 {
+		t.Fatalf("unexpected root: %s", hdr)
+	}
+	inv := root.Children[0]
+	if inv.Name != "invoke" || inv.Method != "/echo.EchoService/Echo" || len(inv.Children) != 2 {
+		t.Fatalf("unexpected invoke span: %s", hdr)
+	}
+	if a := inv.Children[1]; a.Name != "attempt" || a.Target != target || a.Outcome != "ok" {
+		t.Fatalf("unexpected attempt span: %s", hdr)
+	}
+	if stored == nil {
+		t.Fatalf("trace was not passed to TraceSink")
+	}
+}
+
+type failingEchoServer struct {
+	pb.UnimplementedEchoServiceServer
+}
+
+func (failingEchoServer) Echo(context.Context, *pb.EchoRequest) (*pb.EchoResponse, error) {
+	st, _ := status.New(codes.InvalidArgument, "bad message").WithDetails(
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "message", Description: "must not be empty"}}},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(2 * time.Second)},
+	)
+	return nil, st.Err()
+}
+
+func TestGateway_UpstreamErrorDetails(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, failingEchoServer{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	srv := httptest.NewServer(Handler(Options{}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": lis.Addr().String(), "method": "/echo.EchoService/Echo"}, nil)
+	if code != http.StatusBadGateway {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	var out struct {
+		Error   string           `json:"error"`
+		Details []map[string]any `json:"details"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("unmarshal %s: %v", b, err)
+	}
+	if len(out.Details) != 2 {
+		t.Fatalf("expected 2 details, got %s", b)
+	}
+	if out.Details[0]["@type"] != "type.googleapis.com/google.rpc.BadRequest" || out.Details[0]["fieldViolations"] == nil {
+		t.Fatalf("unexpected BadRequest detail: %v", out.Details[0])
+	}
+	if out.Details[1]["@type"] != "type.googleapis.com/google.rpc.RetryInfo" || out.Details[1]["retryDelay"] != "2s" {
+		t.Fatalf("unexpected RetryInfo detail: %v", out.Details[1])
+	}
+}
@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+)
+
+// stallFirstServer never answers its first call (until cancelled) and echoes every later one.
+type stallFirstServer struct {
+	pb.UnimplementedEchoServiceServer
+	calls     atomic.Int32
+	cancelled chan struct{}
+}
+
+func (s *stallFirstServer) Echo(ctx context.Context, req *pb.EchoRequest) (*pb.EchoResponse, error) {
+	if s.calls.Add(1) == 1 {
+		<-ctx.Done()
+		close(s.cancelled)
+		return nil, ctx.Err()
+	}
+	return &pb.EchoResponse{Message: req.GetMessage()}, nil
+}
+
+func TestGateway_HedgedCall(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	upstream := &stallFirstServer{cancelled: make(chan struct{})}
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, upstream)
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+	target := lis.Addr().String()
+
+	srv := httptest.NewServer(Handler(Options{
+		Timeout: 5 * time.Second,
+		Methods: map[string]MethodConfig{"/echo.EchoService/Echo": {Hedge: core.HedgeConfig{Delay: 20 * time.Millisecond}}},
+	}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "fast"}, "debug": true}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	var got struct {
+		Message string `json:"message"`
+		Gateway struct {
+			Hedged   bool `json:"hedged"`
+			Attempts int  `json:"attempts"`
+		} `json:"_gateway"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("decode %s: %v", b, err)
+	}
+	if got.Message != "fast" || !got.Gateway.Hedged || got.Gateway.Attempts != 1 {
+		t.Fatalf("unexpected response %s", b)
+	}
+	select {
+	case <-upstream.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("losing call was not cancelled")
+	}
+}
+
+func TestGateway_HedgedCallTraced(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	upstream := &stallFirstServer{cancelled: make(chan struct{})}
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, upstream)
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	traces := make(chan []byte, 1)
+	srv := httptest.NewServer(Handler(Options{
+		Timeout:   5 * time.Second,
+		Methods:   map[string]MethodConfig{"/echo.EchoService/Echo": {Hedge: core.HedgeConfig{Delay: 20 * time.Millisecond}}},
+		TraceSink: func(s *core.Span) { b, _ := json.Marshal(s); traces <- b },
+	}))
+	defer srv.Close()
+
+	// The losing call ends its attempt span after the response; it must stay out of the rendered trace
+	// (run with -race).
+	code, b := postGateway(t, srv.URL, map[string]any{"target": lis.Addr().String(), "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "fast"}, "trace": true}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	<-upstream.cancelled
+	var root struct {
+		Children []struct {
+			Name     string            `json:"name"`
+			Attrs    map[string]string `json:"attrs"`
+			Children []struct {
+				Name    string `json:"name"`
+				Outcome string `json:"outcome"`
+			} `json:"children"`
+		} `json:"children"`
+	}
+	trace := <-traces
+	if err := json.Unmarshal(trace, &root); err != nil {
+		t.Fatalf("decode trace %s: %v", trace, err)
+	}
+	if len(root.Children) != 1 {
+		t.Fatalf("unexpected trace %s", trace)
+	}
+	inv := root.Children[0]
+	var attempts []string
+	for _, c := range inv.Children {
+		if c.Name == "attempt" {
+			attempts = append(attempts, c.Outcome)
+		}
+	}
+	if inv.Attrs["hedge"] == "" || !reflect.DeepEqual(attempts, []string{"ok"}) {
+		t.Fatalf("want a hedged invoke span with only the winning attempt, got %s", trace)
+	}
+}
+
+func TestOptions_HedgeTargets(t *testing.T) {
+	opts := Options{TargetGroups: map[string]TrafficSplit{
+		"users": {Targets: []WeightedTarget{{Target: "a", Weight: 1}, {Target: "b", Weight: 1}, {Target: "off", Weight: 0}, {Target: "c", Weight: 2}}},
+	}}
+	if got := opts.hedgeTargets("/svc/M", "users", "b"); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Fatalf("group alternates = %v", got)
+	}
+	if got := opts.hedgeTargets("/svc/M", "host:1", "host:1"); got != nil {
+		t.Fatalf("plain target alternates = %v", got)
+	}
+}
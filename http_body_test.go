@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/genproto/googleapis/api/httpbody"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// startBlobServer serves acme.Blobs: Upper answers an HttpBody with its data upper-cased, and Download
+// streams the data of the requested HttpBody back one byte per message, as text/csv. It returns the target
+// and the descriptor set of the service (without google/api/httpbody.proto).
+func startBlobServer(t *testing.T) (string, []byte) {
+	t.Helper()
+	hb, err := desc.LoadMessageDescriptorForMessage(&httpbody.HttpBody{})
+	if err != nil {
+		t.Fatalf("load HttpBody: %v", err)
+	}
+	body := builder.RpcTypeImportedMessage(hb, false)
+	svc := builder.NewService("Blobs").
+		AddMethod(builder.NewMethod("Upper", body, body)).
+		AddMethod(builder.NewMethod("Download", body, builder.RpcTypeImportedMessage(hb, true)))
+	fd, err := builder.NewFile("acme/blobs.proto").SetPackageName("acme").AddService(svc).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	s := grpc.NewServer()
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "acme.Blobs",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Upper",
+			Handler: func(_ any, _ context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				in := &httpbody.HttpBody{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return &httpbody.HttpBody{ContentType: in.GetContentType(), Data: bytes.ToUpper(in.GetData())}, nil
+			},
+		}},
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Download",
+			ServerStreams: true,
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				in := &httpbody.HttpBody{}
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				for i, b := range in.GetData() {
+					out := &httpbody.HttpBody{Data: []byte{b}}
+					if i == 0 {
+						out.ContentType = "text/csv"
+					}
+					if err := stream.SendMsg(out); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}},
+	}, struct{}{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	set, err := proto.Marshal(desc.ToFileDescriptorSet(fd))
+	if err != nil {
+		t.Fatalf("marshal descriptor: %v", err)
+	}
+	return lis.Addr().String(), set
+}
+
+func TestGateway_HTTPBody(t *testing.T) {
+	target, set := startBlobServer(t)
+	src := DescriptorSource{FS: fstest.MapFS{"blobs.pb": {Data: set}}, Path: "blobs.pb"}
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", DefaultTarget: target, PreloadDescriptors: []DescriptorSource{src}}))
+	defer srv.Close()
+
+	read := func(resp *http.Response, err error) (*http.Response, string) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+
+	// The raw request body and its Content-Type become the HttpBody; the response HttpBody is the body.
+	resp, body := read(http.Post(srv.URL+"/grpc-gateway/acme.Blobs/Upper", "text/plain", strings.NewReader(`{"not":"json"}`)))
+	if resp.StatusCode != http.StatusOK || body != `{"NOT":"JSON"}` || resp.Header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("unary: status=%d Content-Type=%q body=%s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	// Envelope calls send the HttpBody as JSON; a streamed HttpBody is relayed as one body.
+	raw, _ := json.Marshal(map[string]any{
+		"method": "/acme.Blobs/Download",
+		"params": map[string]any{"data": base64.StdEncoding.EncodeToString([]byte("a,b\n1,2\n"))},
+	})
+	resp, body = read(http.Post(srv.URL+"/grpc-gateway", "text/plain", strings.NewReader(encodeBase64V1(raw))))
+	if resp.StatusCode != http.StatusOK || body != "a,b\n1,2\n" || resp.Header.Get("Content-Type") != "text/csv" {
+		t.Fatalf("stream: status=%d Content-Type=%q body=%q", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+}
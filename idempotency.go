@@ -0,0 +1,224 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// IdempotencyConfig enables the Idempotency-Key request header: the result of the first successful invocation
+// with a key is stored and replayed for later requests with the same key, so client retries never execute a
+// non-idempotent upstream method twice.
+type IdempotencyConfig struct {
+	// Store keeps keys and results; see IdempotencyStore.
+	Store IdempotencyStore
+	// TTL is how long a result is replayed; default 24h.
+	TTL time.Duration
+}
+
+// IdempotentResult is a stored invocation result.
+type IdempotentResult struct {
+	// Fingerprint identifies the request (method, target, metadata and body) the key was first used with;
+	// reusing the key for a different request is rejected.
+	Fingerprint string `json:"fingerprint"`
+	Body        []byte `json:"body"`
+}
+
+// ErrIdempotencyInProgress is returned by IdempotencyStore.Begin while another request with the key is running.
+var ErrIdempotencyInProgress = errors.New("a request with this idempotency key is in progress")
+
+// IdempotencyStore holds idempotency keys. Shared stores (Redis, a SQL table) let gateway replicas replay each
+// other's results; Begin must then be atomic across replicas.
+type IdempotencyStore interface {
+	// Begin claims key for a new invocation and returns nil, nil, or returns the stored result of a completed
+	// one, or ErrIdempotencyInProgress. A claim expires after ttl if neither Complete nor Abort follows.
+	Begin(ctx context.Context, key string, ttl time.Duration) (*IdempotentResult, error)
+	// Complete stores the result of a successful invocation for ttl.
+	Complete(ctx context.Context, key string, res *IdempotentResult, ttl time.Duration) error
+	// Abort releases the claim after a failed invocation, so the request can be retried.
+	Abort(ctx context.Context, key string) error
+}
+
+// IdempotencyFlusher is implemented by IdempotencyStores whose results the admin cache flush route can drop
+// (cache "idempotency"). MemoryIdempotencyStore implements it.
+type IdempotencyFlusher interface {
+	// Flush drops the stored results of the keys starting with prefix and returns how many it dropped. Claims
+	// of invocations still in progress stay, so a flush never lets a running request execute twice.
+	Flush(ctx context.Context, prefix string) (int, error)
+}
+
+// MemoryIdempotencyStore is an in-process IdempotencyStore, for single-replica deployments and tests.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]idempotencyEntry
+}
+
+type idempotencyEntry struct {
+	res     *IdempotentResult // nil while in progress
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore returns an empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: make(map[string]idempotencyEntry)}
+}
+
+func (s *MemoryIdempotencyStore) Begin(ctx context.Context, key string, ttl time.Duration) (*IdempotentResult, error) {
+	now := core.ClockFromContext(ctx, nil).Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+	if e, ok := s.entries[key]; ok {
+		if e.res == nil {
+			return nil, ErrIdempotencyInProgress
+		}
+		return e.res, nil
+	}
+	s.entries[key] = idempotencyEntry{expires: now.Add(ttl)}
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key string, res *IdempotentResult, ttl time.Duration) error {
+	now := core.ClockFromContext(ctx, nil).Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = idempotencyEntry{res: res, expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Abort(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Flush(_ context.Context, prefix string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for k, e := range s.entries {
+		if e.res != nil && strings.HasPrefix(k, prefix) {
+			delete(s.entries, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	defaultIdempotencyTTL    = 24 * time.Hour
+	maxIdempotencyKeyLength  = 255
+)
+
+// idempotentCall is an invocation claimed under an Idempotency-Key.
+type idempotentCall struct {
+	store       IdempotencyStore
+	key         string
+	fingerprint string
+	ttl         time.Duration
+}
+
+// beginIdempotent claims the request's Idempotency-Key. It returns a nil call when the header is absent or
+// idempotency is not configured, and done when the response (a replay or an error) has been written.
+func (h *handler) beginIdempotent(ctx context.Context, w http.ResponseWriter, r *http.Request, opts Options, invokeReq *core.InvokeRequest) (call *idempotentCall, done bool) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" || opts.Idempotency == nil || opts.Idempotency.Store == nil {
+		return nil, false
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "Idempotency-Key is longer than 255 bytes")
+		return nil, true
+	}
+	call = &idempotentCall{
+		store:       opts.Idempotency.Store,
+		key:         h.idempotencyKeyPrefix(invokeReq.DescriptorNamespace) + key,
+		fingerprint: requestFingerprint(invokeReq),
+		ttl:         opts.Idempotency.TTL,
+	}
+	if call.ttl <= 0 {
+		call.ttl = defaultIdempotencyTTL
+	}
+	res, err := call.store.Begin(ctx, call.key, call.ttl)
+	switch {
+	case errors.Is(err, ErrIdempotencyInProgress):
+		h.writeError(w, r, http.StatusConflict, ErrCodeDuplicateRequest, err.Error())
+		return nil, true
+	case err != nil:
+		h.writeError(w, r, http.StatusServiceUnavailable, ErrCodeUnavailable, "idempotency store: "+err.Error())
+		return nil, true
+	case res == nil:
+		return call, false
+	case res.Fingerprint != call.fingerprint:
+		h.writeError(w, r, http.StatusUnprocessableEntity, ErrCodeDuplicateRequest, "Idempotency-Key was already used for a different request")
+		return nil, true
+	}
+	h.metrics.Add("gateway_idempotent_replays_total", 1)
+	w.Header().Set(idempotentReplayedHeader, "true")
+	h.writeResponseBody(w, r, res.Body)
+	return nil, true
+}
+
+// idempotencyKeyPrefix returns the prefix of the store keys of the Idempotency-Keys sent in namespace.
+func (h *handler) idempotencyKeyPrefix(namespace string) string {
+	prefix := namespace + "\x00"
+	if h.tenant != "" {
+		prefix = h.tenant + "\x00" + prefix // tenants may share a store
+	}
+	return prefix
+}
+
+// finish stores resp, or releases the key when the invocation failed (resp nil).
+func (c *idempotentCall) finish(ctx context.Context, resp []byte) {
+	// The client may be gone; the outcome must still be recorded.
+	ctx = context.WithoutCancel(ctx)
+	if resp == nil {
+		_ = c.store.Abort(ctx, c.key)
+		return
+	}
+	if err := c.store.Complete(ctx, c.key, &IdempotentResult{Fingerprint: c.fingerprint, Body: resp}, c.ttl); err != nil {
+		_ = c.store.Abort(ctx, c.key)
+	}
+}
+
+// requestFingerprint hashes what determines the upstream call.
+func requestFingerprint(req *core.InvokeRequest) string {
+	h := sha256.New()
+	write := func(b []byte) {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(b)))
+		h.Write(n[:])
+		h.Write(b)
+	}
+	for _, s := range []string{req.Target, req.FullMethodName, req.ServiceName, req.MethodName, req.DescriptorID, string(req.BodyFormat)} {
+		write([]byte(s))
+	}
+	keys := make([]string, 0, len(req.Metadata))
+	for k := range req.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		write([]byte(k))
+		for _, v := range req.Metadata[k] {
+			write([]byte(v))
+		}
+	}
+	write(req.Body)
+	return hex.EncodeToString(h.Sum(nil))
+}
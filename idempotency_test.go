@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+)
+
+func TestGateway_IdempotencyKey(t *testing.T) {
+	var calls atomic.Int32
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		calls.Add(1)
+		return handler(ctx, req)
+	}))
+	pb.RegisterEchoServiceServer(s, echoServer{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+	target := lis.Addr().String()
+
+	srv := httptest.NewServer(Handler(Options{Idempotency: &IdempotencyConfig{Store: NewMemoryIdempotencyStore()}}))
+	defer srv.Close()
+
+	call := func(target, msg, key string) (int, []byte) {
+		var header map[string]string
+		if key != "" {
+			header = map[string]string{"Idempotency-Key": key}
+		}
+		return postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": msg}}, header)
+	}
+
+	for i := 0; i < 2; i++ {
+		if code, b := call(target, "charge", "k1"); code != http.StatusOK || string(b) != `{"message":"charge"}` {
+			t.Fatalf("attempt %d: status=%d body=%s", i, code, b)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("upstream called %d times, want 1", n)
+	}
+	if code, b := call(target, "other", "k1"); code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key: status=%d body=%s", code, b)
+	}
+	if code, _ := call(target, "charge", ""); code != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("without key: status=%d calls=%d", code, calls.Load())
+	}
+
+	// A failed call releases its key for the retry.
+	if code, b := call("127.0.0.1:1", "charge", "k2"); code != http.StatusBadGateway {
+		t.Fatalf("unreachable target: status=%d body=%s", code, b)
+	}
+	if code, b := call(target, "charge", "k2"); code != http.StatusOK {
+		t.Fatalf("retry: status=%d body=%s", code, b)
+	}
+}
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/keicoqk/gateway/core"
+)
+
+type servicesResponse struct {
+	Services []serviceInfo `json:"services"`
+	// Targets is the health of pooled upstream connections, with Options.HealthCheck.
+	Targets map[string]core.TargetHealth `json:"targets,omitempty"`
+	// Messages documents the request and response messages of the methods, and the messages of their fields,
+	// by fully-qualified name; only those with comments are listed.
+	Messages map[string]messageInfo `json:"messages,omitempty"`
+}
+
+type serviceInfo struct {
+	Name    string       `json:"name"` // fully-qualified, e.g. "echo.EchoService"
+	File    string       `json:"file"`
+	Comment string       `json:"comment,omitempty"` // from the proto source, see core.Comments
+	Methods []methodInfo `json:"methods"`
+}
+
+type methodInfo struct {
+	Name            string `json:"name"`
+	FullMethod      string `json:"full_method"`
+	InputType       string `json:"input_type"`
+	OutputType      string `json:"output_type"`
+	ClientStreaming bool   `json:"client_streaming"`
+	ServerStreaming bool   `json:"server_streaming"`
+	Kind            string `json:"kind"` // unary, client_streaming, server_streaming or bidi_streaming
+	Comment         string `json:"comment,omitempty"`
+}
+
+type messageInfo struct {
+	Comment string            `json:"comment,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"` // field comments by JSON name
+}
+
+// addMessage records the comments of md and of the messages of its fields in out, unless already visited.
+func addMessage(out map[string]messageInfo, seen map[string]bool, md *desc.MessageDescriptor) {
+	fqn := md.GetFullyQualifiedName()
+	if seen[fqn] {
+		return
+	}
+	seen[fqn] = true
+	info := messageInfo{Comment: core.Comments(md)}
+	for _, f := range md.GetFields() {
+		if c := core.Comments(f); c != "" {
+			if info.Fields == nil {
+				info.Fields = make(map[string]string)
+			}
+			info.Fields[f.GetJSONName()] = c
+		}
+		if f.IsMap() {
+			f = f.GetMapValueType()
+		}
+		if ft := f.GetMessageType(); ft != nil {
+			addMessage(out, seen, ft)
+		}
+	}
+	if info.Comment != "" || info.Fields != nil {
+		out[fqn] = info
+	}
+}
+
+// serveServices handles GET {Path}/services: a catalog of every service and method known from the descriptor
+// directory, embedded descriptors and the caller's cached inline descriptors, for tooling and debugging, and
+// the health of upstream targets when they are probed.
+func (h *handler) serveServices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.rejectRoute(w, r, http.MethodGet)
+		return
+	}
+	var namespace string
+	if h.opts.DescriptorNamespace != nil {
+		namespace = h.opts.DescriptorNamespace(r)
+	}
+
+	out := servicesResponse{Services: []serviceInfo{}, Targets: h.inv.TargetHealth(), Messages: map[string]messageInfo{}}
+	seen := make(map[string]bool)
+	for _, svc := range h.inv.Services(namespace) {
+		si := serviceInfo{
+			Name:    svc.GetFullyQualifiedName(),
+			File:    svc.GetFile().GetName(),
+			Comment: core.Comments(svc),
+			Methods: []methodInfo{},
+		}
+		for _, m := range svc.GetMethods() {
+			kind := "unary"
+			switch {
+			case m.IsClientStreaming() && m.IsServerStreaming():
+				kind = "bidi_streaming"
+			case m.IsClientStreaming():
+				kind = "client_streaming"
+			case m.IsServerStreaming():
+				kind = "server_streaming"
+			}
+			si.Methods = append(si.Methods, methodInfo{
+				Name:            m.GetName(),
+				FullMethod:      "/" + svc.GetFullyQualifiedName() + "/" + m.GetName(),
+				InputType:       m.GetInputType().GetFullyQualifiedName(),
+				OutputType:      m.GetOutputType().GetFullyQualifiedName(),
+				ClientStreaming: m.IsClientStreaming(),
+				ServerStreaming: m.IsServerStreaming(),
+				Kind:            kind,
+				Comment:         core.Comments(m),
+			})
+			addMessage(out.Messages, seen, m.GetInputType())
+			addMessage(out.Messages, seen, m.GetOutputType())
+		}
+		out.Services = append(out.Services, si)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,53 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGateway_ServicesCatalog(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	mux := http.NewServeMux()
+	h := Handler(Options{Timeout: 5 * time.Second, Path: "/grpc-gateway"})
+	mux.Handle("/grpc-gateway", h)
+	mux.Handle("/grpc-gateway/", h)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// Cache an inline descriptor so the catalog includes it as well.
+	if code, b := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{
+		"target":        target,
+		"method":        "/echo.EchoService/Echo",
+		"descriptor":    base64.StdEncoding.EncodeToString(mustReadDescriptor(t)),
+		"descriptor_id": "echo-inline",
+	}, nil); code != http.StatusOK {
+		t.Fatalf("inline call: %d %s", code, b)
+	}
+
+	resp, err := http.Get(srv.URL + "/grpc-gateway/services")
+	if err != nil {
+		t.Fatalf("get services: %v", err)
+	}
+	defer resp.Body.Close()
+	var out servicesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(out.Services) != 1 {
+		t.Fatalf("expected echo.EchoService once (deduplicated), got %+v", out.Services)
+	}
+	svc := out.Services[0]
+	if svc.Name != "echo.EchoService" || len(svc.Methods) != 1 {
+		t.Fatalf("unexpected service: %+v", svc)
+	}
+	m := svc.Methods[0]
+	if m.FullMethod != "/echo.EchoService/Echo" || m.InputType != "echo.EchoRequest" || m.OutputType != "echo.EchoResponse" || m.Kind != "unary" {
+		t.Fatalf("unexpected method: %+v", m)
+	}
+}
@@ -0,0 +1,178 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/keicoqk/gateway/core"
+)
+
+// killSwitch disables calls to a method or a target (exactly one is set); method "*" disables every call,
+// putting the gateway in maintenance mode. Switches are set through the admin API and last until removed
+// or the process restarts.
+type killSwitch struct {
+	Method string `json:"method,omitempty"`
+	Target string `json:"target,omitempty"`
+	// Message is returned to callers in the 503 response.
+	Message string `json:"message,omitempty"`
+	// RetryAfter, if positive, is sent as the Retry-After header, in seconds.
+	RetryAfter int       `json:"retry_after,omitempty"`
+	Since      time.Time `json:"since"`
+}
+
+type killSwitchesResponse struct {
+	Switches []killSwitch `json:"switches"`
+}
+
+// killSwitches are the kill switches of a handler, keyed by "method:" or "target:" and the name.
+type killSwitches struct {
+	mu       sync.RWMutex
+	switches map[string]killSwitch
+}
+
+func killSwitchKey(method, target string) string {
+	if method != "" {
+		return "method:" + method
+	}
+	return "target:" + target
+}
+
+// match returns the switch disabling a call of method to target, if any: maintenance mode first, then the
+// method's switch, then the targets' switches.
+func (k *killSwitches) match(method string, targets ...string) (killSwitch, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if len(k.switches) == 0 {
+		return killSwitch{}, false
+	}
+	if ks, ok := k.switches[killSwitchKey("*", "")]; ok {
+		return ks, true
+	}
+	if method != "" {
+		if ks, ok := k.switches[killSwitchKey(method, "")]; ok {
+			return ks, true
+		}
+	}
+	for _, target := range targets {
+		if ks, ok := k.switches[killSwitchKey("", target)]; ok && target != "" {
+			return ks, true
+		}
+	}
+	return killSwitch{}, false
+}
+
+// set adds or replaces ks and returns the number of switches.
+func (k *killSwitches) set(ks killSwitch) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.switches == nil {
+		k.switches = make(map[string]killSwitch)
+	}
+	k.switches[killSwitchKey(ks.Method, ks.Target)] = ks
+	return len(k.switches)
+}
+
+// remove deletes the switch with key, reporting whether there was one, and returns the number left.
+func (k *killSwitches) remove(key string) (int, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, ok := k.switches[key]
+	delete(k.switches, key)
+	return len(k.switches), ok
+}
+
+func (k *killSwitches) list() []killSwitch {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	out := make([]killSwitch, 0, len(k.switches))
+	for _, ks := range k.switches {
+		out = append(out, ks)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return killSwitchKey(out[i].Method, out[i].Target) < killSwitchKey(out[j].Method, out[j].Target)
+	})
+	return out
+}
+
+// rejectKilled answers a call disabled by ks with 503.
+func (h *handler) rejectKilled(w http.ResponseWriter, r *http.Request, ks killSwitch) {
+	err := h.killSwitchError(w, ks)
+	h.writeError(w, r, err.status, err.code, err.msg)
+}
+
+// killSwitchError returns the error rejecting a call disabled by ks and sets its Retry-After header on w.
+func (h *handler) killSwitchError(w http.ResponseWriter, ks killSwitch) *authorizationError {
+	h.metrics.Add("gateway_kill_switch_rejections_total", 1, "switch", killSwitchKey(ks.Method, ks.Target))
+	if ks.RetryAfter > 0 {
+		w.Header().Set(retryAfterHeader, strconv.Itoa(ks.RetryAfter))
+	}
+	msg := ks.Message
+	if msg == "" {
+		msg = "temporarily disabled"
+		if ks.Method == "*" {
+			msg = "the gateway is in maintenance mode"
+		}
+	}
+	return &authorizationError{status: http.StatusServiceUnavailable, code: ErrCodeUnavailable, msg: msg}
+}
+
+// onResolve returns the core.InvokeRequest.OnResolve hook of a call to targets: it applies the kill switch of
+// the resolved method, which requests naming the method by descriptor_id only do not reveal before, then its
+// deprecation and then the injected fault of the method or targets.
+func (h *handler) onResolve(w http.ResponseWriter, r *http.Request, opts Options, targets ...string) func(md *desc.MethodDescriptor) error {
+	deprecation := h.checkDeprecation(w, r, opts)
+	return func(md *desc.MethodDescriptor) error {
+		method := "/" + md.GetService().GetFullyQualifiedName() + "/" + md.GetName()
+		if ks, ok := h.kills.match(method); ok {
+			return h.killSwitchError(w, ks)
+		}
+		if err := deprecation(md); err != nil {
+			return err
+		}
+		return h.injectFault(r, method, targets...)
+	}
+}
+
+// serveKillSwitches handles the admin kill switch routes:
+//
+//	GET    /kill-switches                      the active switches
+//	POST   /kill-switches                      {"method": M | "target": T, "message": ..., "retry_after": S} sets one
+//	DELETE /kill-switches?method=M | ?target=T removes one
+func (h *handler) serveKillSwitches(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var ks killSwitch
+		if err := json.NewDecoder(r.Body).Decode(&ks); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+		if (ks.Method == "") == (ks.Target == "") || ks.RetryAfter < 0 {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "exactly one of method and target is required, and retry_after must not be negative")
+			return
+		}
+		ks.Since = core.ClockFromContext(r.Context(), h.opts.Clock).Now()
+		h.metrics.Set("gateway_kill_switches", float64(h.kills.set(ks)))
+	case http.MethodDelete:
+		key := killSwitchKey(r.URL.Query().Get("method"), r.URL.Query().Get("target"))
+		n, ok := h.kills.remove(key)
+		if !ok {
+			h.writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no kill switch for "+key)
+			return
+		}
+		h.metrics.Set("gateway_kill_switches", float64(n))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		h.rejectRoute(w, r, "GET, POST, DELETE")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(killSwitchesResponse{Switches: h.kills.list()})
+}
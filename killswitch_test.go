@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGateway_KillSwitches(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", AdminToken: "s3cret"}))
+	defer srv.Close()
+
+	admin := func(method, query string, body any) (int, []byte) {
+		t.Helper()
+		var rd io.Reader
+		if body != nil {
+			b, _ := json.Marshal(body)
+			rd = bytes.NewReader(b)
+		}
+		req, _ := http.NewRequest(method, srv.URL+"/grpc-gateway/admin/kill-switches"+query, rd)
+		req.Header.Set(adminTokenHeader, "s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("admin %s: %v", method, err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, b
+	}
+	echo := func() (int, http.Header, string) {
+		t.Helper()
+		raw, _ := json.Marshal(map[string]any{"target": target, "method": "/echo.EchoService/Echo"})
+		resp, err := http.Post(srv.URL+"/grpc-gateway", "text/plain", strings.NewReader(encodeBase64V1(raw)))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header, string(b)
+	}
+
+	if code, _, _ := echo(); code != http.StatusOK {
+		t.Fatalf("before: status=%d", code)
+	}
+	if code, b := admin(http.MethodPost, "", map[string]any{"method": "/echo.EchoService/Echo", "message": "echo is shed during incident 42", "retry_after": 120}); code != http.StatusOK {
+		t.Fatalf("set: status=%d body=%s", code, b)
+	}
+	code, header, body := echo()
+	if code != http.StatusServiceUnavailable || header.Get("Retry-After") != "120" || !strings.Contains(body, "incident 42") || !strings.Contains(body, ErrCodeUnavailable) {
+		t.Fatalf("method switch: status=%d retry-after=%q body=%s", code, header.Get("Retry-After"), body)
+	}
+
+	// Target switches and maintenance mode apply as well.
+	if code, _ := admin(http.MethodDelete, "?method=/echo.EchoService/Echo", nil); code != http.StatusNoContent {
+		t.Fatalf("delete: status=%d", code)
+	}
+	admin(http.MethodPost, "", map[string]any{"target": target})
+	if code, _, body := echo(); code != http.StatusServiceUnavailable || !strings.Contains(body, "temporarily disabled") {
+		t.Fatalf("target switch: status=%d body=%s", code, body)
+	}
+	admin(http.MethodPost, "", map[string]any{"method": "*"})
+	code, b := admin(http.MethodGet, "", nil)
+	var list killSwitchesResponse
+	if err := json.Unmarshal(b, &list); code != http.StatusOK || err != nil || len(list.Switches) != 2 || list.Switches[0].Method != "*" || list.Switches[0].Since.IsZero() {
+		t.Fatalf("list: status=%d body=%s", code, b)
+	}
+	admin(http.MethodDelete, "?target="+target, nil)
+	if code, _, body := echo(); code != http.StatusServiceUnavailable || !strings.Contains(body, "maintenance mode") {
+		t.Fatalf("maintenance: status=%d body=%s", code, body)
+	}
+	admin(http.MethodDelete, "?method=*", nil)
+	if code, _, _ := echo(); code != http.StatusOK {
+		t.Fatalf("after: status=%d", code)
+	}
+
+	if code, _ := admin(http.MethodPost, "", map[string]any{"method": "/a.B/C", "target": "x:1"}); code != http.StatusBadRequest {
+		t.Fatalf("both: status=%d", code)
+	}
+	if code, _ := admin(http.MethodDelete, "?method=/a.B/C", nil); code != http.StatusNotFound {
+		t.Fatalf("delete unknown: status=%d", code)
+	}
+}
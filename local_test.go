@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+)
+
+func TestGateway_LocalTarget(t *testing.T) {
+	srv := httptest.NewServer(Handler(Options{LocalServices: func(s grpc.ServiceRegistrar) {
+		pb.RegisterEchoServiceServer(s, echoServer{})
+	}}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": "local", "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "in process"}, "debug": true}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	var got struct {
+		Message string `json:"message"`
+		Gateway struct {
+			DescriptorSource string `json:"descriptor_source"`
+		} `json:"_gateway"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("decode %s: %v", b, err)
+	}
+	if got.Message != "in process" || got.Gateway.DescriptorSource != "local" {
+		t.Fatalf("unexpected response %s", b)
+	}
+
+	code, b = postGateway(t, srv.URL, map[string]any{"target": "local", "method": "/echo.EchoService/Missing", "body": map[string]any{}}, nil)
+	if code == http.StatusOK {
+		t.Fatalf("unknown method: status=%d body=%s", code, b)
+	}
+}
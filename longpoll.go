@@ -0,0 +1,291 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// LongPollConfig enables the long-poll bridge for server-streaming methods, for clients that cannot use
+// streaming HTTP. A request with "long_poll": true (or the X-Gateway-Long-Poll header on method routes) opens
+// the upstream stream and answers 201 with a session token; the gateway buffers the streamed messages and
+// each GET {Path}/polls/{session}?cursor=N returns those from N on, waiting for new ones if there are none.
+// Passing a cursor acknowledges the messages before it. DELETE {Path}/polls/{session} closes the session.
+type LongPollConfig struct {
+	// SessionTTL closes sessions that have not been polled for this long, cancelling the stream; default 1m.
+	SessionTTL time.Duration
+	// PollTimeout bounds how long a poll waits for messages; default 30s. Polls may ask for less with ?wait=.
+	PollTimeout time.Duration
+	// MaxBuffered bounds the unacknowledged messages per session; reading from the upstream pauses while
+	// the buffer is full. Default 1000.
+	MaxBuffered int
+	// MaxSessions bounds the open sessions; further requests are rejected with 503. Default 1000.
+	MaxSessions int
+}
+
+func (c LongPollConfig) withDefaults() LongPollConfig {
+	if c.SessionTTL <= 0 {
+		c.SessionTTL = time.Minute
+	}
+	if c.PollTimeout <= 0 {
+		c.PollTimeout = 30 * time.Second
+	}
+	if c.MaxBuffered <= 0 {
+		c.MaxBuffered = 1000
+	}
+	if c.MaxSessions <= 0 {
+		c.MaxSessions = 1000
+	}
+	return c
+}
+
+// pollSessions are the open long-poll sessions of a handler.
+type pollSessions struct {
+	cfg     LongPollConfig
+	clock   core.Clock
+	metrics core.Metrics
+
+	mu       sync.Mutex
+	sessions map[string]*pollSession
+}
+
+// pollSession buffers the messages of one upstream stream.
+type pollSession struct {
+	id     string
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	base     int               // cursor of messages[0]; earlier messages were acknowledged
+	messages []json.RawMessage // received and not yet acknowledged
+	done     bool              // the stream ended; err is its error, if any
+	err      error
+	changed  chan struct{} // closed and replaced when messages, base or done change
+	stopTTL  func() bool
+}
+
+type pollOpened struct {
+	Session string `json:"session"`
+	Cursor  int    `json:"cursor"`
+}
+
+type pollResponse struct {
+	Session  string            `json:"session"`
+	Messages []json.RawMessage `json:"messages"`
+	// Cursor is the position after the returned messages; pass it to the next poll.
+	Cursor int  `json:"cursor"`
+	Done   bool `json:"done"` // the stream ended; no messages follow the returned ones
+	// Error is why the stream failed, if it did.
+	Error *errorResponse `json:"error,omitempty"`
+}
+
+func newPollSessions(cfg LongPollConfig, clock core.Clock, metrics core.Metrics) *pollSessions {
+	return &pollSessions{cfg: cfg.withDefaults(), clock: core.ClockFromContext(context.Background(), clock), metrics: metrics, sessions: map[string]*pollSession{}}
+}
+
+// openPoll opens the server stream of invokeReq and registers a session reading it.
+func (h *handler) openPoll(ctx context.Context, w http.ResponseWriter, r *http.Request, invokeReq core.InvokeRequest) {
+	p := h.polls
+	p.mu.Lock()
+	full := len(p.sessions) >= p.cfg.MaxSessions
+	p.mu.Unlock()
+	if full {
+		h.writeError(w, r, http.StatusServiceUnavailable, ErrCodeUnavailable, "too many long-poll sessions")
+		return
+	}
+
+	// The stream outlives the request that opens it; it ends with the session.
+	streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stream, err := h.inv.OpenServerStream(streamCtx, &invokeReq)
+	if err != nil {
+		cancel()
+		var denied *authorizationError
+		switch {
+		case errors.As(err, &denied):
+			h.writeError(w, r, denied.status, denied.code, denied.msg)
+		case errors.Is(err, core.ErrNotServerStreaming), errors.Is(err, core.ErrUnknownFields), errors.Is(err, core.ErrUnsafeInt64), errors.Is(err, core.ErrInvalidBinding):
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, err.Error())
+		default:
+			h.writeInvokeError(w, r, err, nil)
+		}
+		return
+	}
+
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	s := &pollSession{id: hex.EncodeToString(id[:]), cancel: cancel, changed: make(chan struct{})}
+	p.mu.Lock()
+	p.sessions[s.id] = s
+	p.mu.Unlock()
+	p.touch(s)
+	p.metrics.Add("gateway_long_poll_sessions_total", 1, "outcome", "opened")
+	go p.read(s, stream)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(locationHeader, strings.TrimSuffix(h.opts.Path, "/")+"/polls/"+s.id)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(pollOpened{Session: s.id})
+}
+
+// read buffers the messages of stream in s until the stream ends or the session is closed.
+func (p *pollSessions) read(s *pollSession, stream *core.ServerStream) {
+	for {
+		msg, err := stream.Recv()
+		s.mu.Lock()
+		if err != nil {
+			s.done = true
+			if err != io.EOF {
+				s.err = err
+			}
+			s.signal()
+			s.mu.Unlock()
+			return
+		}
+		s.messages = append(s.messages, msg)
+		s.signal()
+		for len(s.messages) >= p.cfg.MaxBuffered && !s.done {
+			changed := s.changed
+			s.mu.Unlock()
+			<-changed
+			s.mu.Lock()
+		}
+		closed := s.done
+		s.mu.Unlock()
+		if closed {
+			return
+		}
+	}
+}
+
+// signal wakes the reader and pollers of s; s.mu must be held.
+func (s *pollSession) signal() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// touch restarts the idle timer of s.
+func (p *pollSessions) touch(s *pollSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopTTL != nil {
+		s.stopTTL()
+	}
+	s.stopTTL = p.clock.AfterFunc(p.cfg.SessionTTL, func() { p.close(s.id, "expired") })
+}
+
+// close ends the session id, cancelling its stream.
+func (p *pollSessions) close(id, outcome string) bool {
+	p.mu.Lock()
+	s, ok := p.sessions[id]
+	delete(p.sessions, id)
+	p.mu.Unlock()
+	if !ok {
+		return false
+	}
+	s.cancel()
+	s.mu.Lock()
+	if s.stopTTL != nil {
+		s.stopTTL()
+	}
+	if !s.done {
+		s.done = true
+		s.signal()
+	}
+	s.mu.Unlock()
+	p.metrics.Add("gateway_long_poll_sessions_total", 1, "outcome", outcome)
+	return true
+}
+
+// servePoll handles GET and DELETE {Path}/polls/{session}.
+func (h *handler) servePoll(w http.ResponseWriter, r *http.Request, id string) {
+	p := h.polls
+	if p == nil || id == "" || strings.Contains(id, "/") {
+		h.rejectRoute(w, r, "")
+		return
+	}
+	p.mu.Lock()
+	s, ok := p.sessions[id]
+	p.mu.Unlock()
+	if !ok {
+		h.writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "unknown or expired long-poll session")
+		return
+	}
+	switch r.Method {
+	case http.MethodDelete:
+		p.close(id, "closed")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodGet:
+	default:
+		h.rejectRoute(w, r, "GET, DELETE")
+		return
+	}
+
+	wait := p.cfg.PollTimeout
+	if v := r.URL.Query().Get("wait"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid wait "+strconv.Quote(v))
+			return
+		}
+		wait = min(wait, d)
+	}
+	cursor := 0
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid cursor "+strconv.Quote(v))
+			return
+		}
+		cursor = n
+	}
+
+	p.touch(s)
+	defer p.touch(s) // the idle time starts when the poll returns
+	timeout := make(chan struct{})
+	stop := p.clock.AfterFunc(wait, func() { close(timeout) })
+	defer stop()
+
+	s.mu.Lock()
+	if cursor > s.base {
+		n := min(cursor-s.base, len(s.messages))
+		s.messages = append([]json.RawMessage(nil), s.messages[n:]...)
+		s.base += n
+		s.signal()
+	}
+	for len(s.messages) == 0 && !s.done {
+		changed, expired := s.changed, false
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-timeout:
+			expired = true
+		case <-r.Context().Done():
+			expired = true
+		}
+		s.mu.Lock()
+		if expired {
+			break
+		}
+	}
+	resp := pollResponse{Session: s.id, Messages: append([]json.RawMessage{}, s.messages...), Done: s.done}
+	resp.Cursor = s.base + len(resp.Messages)
+	if s.err != nil {
+		e := invokeErrorResponse(s.err, nil)
+		resp.Error = &e
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
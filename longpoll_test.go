@@ -0,0 +1,205 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// startTickerServer serves acme.Ticker/Watch, which streams count ticks and waits for release before the
+// last one. It returns the target and the descriptor set of the service.
+func startTickerServer(t *testing.T, release <-chan struct{}) (string, []byte) {
+	t.Helper()
+	req := builder.NewMessage("WatchRequest").AddField(builder.NewField("count", builder.FieldTypeInt32()))
+	tick := builder.NewMessage("Tick").AddField(builder.NewField("n", builder.FieldTypeInt32()))
+	svc := builder.NewService("Ticker").
+		AddMethod(builder.NewMethod("Watch", builder.RpcTypeMessage(req, false), builder.RpcTypeMessage(tick, true)))
+	fd, err := builder.NewFile("acme/ticker.proto").SetPackageName("acme").AddMessage(req).AddMessage(tick).AddService(svc).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	watch := fd.FindService("acme.Ticker").FindMethodByName("Watch")
+
+	s := grpc.NewServer()
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "acme.Ticker",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Watch",
+			ServerStreams: true,
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				in := dynamic.NewMessage(watch.GetInputType())
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				count := in.GetFieldByName("count").(int32)
+				for n := int32(1); n <= count; n++ {
+					if n == count {
+						<-release
+					}
+					out := dynamic.NewMessage(watch.GetOutputType())
+					out.SetFieldByName("n", n)
+					if err := stream.SendMsg(out); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}},
+	}, struct{}{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	set, err := proto.Marshal(desc.ToFileDescriptorSet(fd))
+	if err != nil {
+		t.Fatalf("marshal descriptor: %v", err)
+	}
+	return lis.Addr().String(), set
+}
+
+func TestGateway_LongPoll(t *testing.T) {
+	release := make(chan struct{})
+	target, set := startTickerServer(t, release)
+	metrics := core.NewMemoryMetrics()
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", LongPoll: &LongPollConfig{}, Metrics: metrics}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{
+		"target":     target,
+		"service":    "acme.Ticker",
+		"method":     "Watch",
+		"descriptor": base64.StdEncoding.EncodeToString(set),
+		"params":     map[string]any{"count": 3},
+		"long_poll":  true,
+	}, nil)
+	if code != http.StatusCreated {
+		t.Fatalf("open: status=%d body=%s", code, b)
+	}
+	var opened pollOpened
+	_ = json.Unmarshal(b, &opened)
+
+	poll := func(query string) pollResponse {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/grpc-gateway/polls/" + opened.Session + query)
+		if err != nil {
+			t.Fatalf("poll: %v", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("poll: status=%d body=%s", resp.StatusCode, b)
+		}
+		var p pollResponse
+		if err := json.Unmarshal(b, &p); err != nil {
+			t.Fatalf("decode %s: %v", b, err)
+		}
+		return p
+	}
+	messages := func(p pollResponse) string {
+		var parts []string
+		for _, m := range p.Messages {
+			parts = append(parts, string(m))
+		}
+		return strings.Join(parts, " ")
+	}
+
+	// The first two ticks arrive; the third waits for release.
+	var p pollResponse
+	for deadline := time.Now().Add(5 * time.Second); len(p.Messages) < 2 && time.Now().Before(deadline); {
+		p = poll("?wait=1s")
+	}
+	if messages(p) != `{"n":1} {"n":2}` || p.Cursor != 2 || p.Done {
+		t.Fatalf("first poll: %+v", p)
+	}
+	// Polling again without acknowledging returns the same messages.
+	if again := poll("?wait=10ms"); messages(again) != messages(p) {
+		t.Fatalf("repeated poll: %+v", again)
+	}
+	// Acknowledged messages are dropped; with none left the poll times out empty.
+	if empty := poll(fmt.Sprintf("?cursor=%d&wait=10ms", p.Cursor)); len(empty.Messages) != 0 || empty.Cursor != 2 || empty.Done {
+		t.Fatalf("empty poll: %+v", empty)
+	}
+	close(release)
+	p = poll("?cursor=2&wait=5s")
+	for !p.Done {
+		next := poll(fmt.Sprintf("?cursor=%d&wait=5s", p.Cursor))
+		next.Messages = append(p.Messages, next.Messages...)
+		p = next
+	}
+	if messages(p) != `{"n":3}` || p.Cursor != 3 || p.Error != nil {
+		t.Fatalf("last poll: %+v", p)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/grpc-gateway/polls/"+opened.Session, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("close: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	resp, _ = http.Get(srv.URL + "/grpc-gateway/polls/" + opened.Session)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("poll after close: status=%d", resp.StatusCode)
+	}
+	if got := metrics.Get("gateway_long_poll_sessions_total", "outcome", "closed"); got != 1 {
+		t.Fatalf("closed sessions = %v", got)
+	}
+}
+
+func TestGateway_LongPollSessionExpires(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	target, set := startTickerServer(t, release)
+	clock := core.NewFakeClock(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", LongPoll: &LongPollConfig{SessionTTL: time.Minute}, Clock: clock}))
+	defer srv.Close()
+
+	body := map[string]any{"target": target, "service": "acme.Ticker", "method": "Watch", "descriptor": base64.StdEncoding.EncodeToString(set), "long_poll": true}
+	code, b := postGateway(t, srv.URL+"/grpc-gateway", body, nil)
+	if code != http.StatusCreated {
+		t.Fatalf("open: status=%d body=%s", code, b)
+	}
+	var opened pollOpened
+	_ = json.Unmarshal(b, &opened)
+
+	clock.Advance(2 * time.Minute) // expiry runs in its own goroutine
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		resp, err := http.Get(srv.URL + "/grpc-gateway/polls/" + opened.Session + "?wait=0s")
+		if err != nil {
+			t.Fatalf("poll: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("session did not expire")
+		}
+	}
+
+	// Unary methods cannot be long-polled.
+	echoTarget, stop := startTestGRPCServer(t)
+	defer stop()
+	code, b = postGateway(t, srv.URL+"/grpc-gateway", map[string]any{"target": echoTarget, "method": "/echo.EchoService/Echo", "long_poll": true}, nil)
+	if code != http.StatusBadRequest || !strings.Contains(string(b), "not server-streaming") {
+		t.Fatalf("unary: status=%d body=%s", code, b)
+	}
+}
@@ -0,0 +1,99 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// metadataValues is a "metadata" entry of a request: a string or an array of strings.
+type metadataValues []string
+
+func (v *metadataValues) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*v = metadataValues{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return fmt.Errorf("metadata values must be a string or an array of strings")
+	}
+	*v = many
+	return nil
+}
+
+func (v metadataValues) MarshalJSON() ([]byte, error) {
+	if len(v) == 1 {
+		return json.Marshal(v[0])
+	}
+	return json.Marshal([]string(v))
+}
+
+// reservedMetadata are headers owned by the gRPC transport; callers can never set them.
+var reservedMetadata = map[string]bool{
+	"content-type": true, "te": true, "user-agent": true, "host": true, "connection": true,
+}
+
+// outgoingMetadata validates the request's metadata against Options.MetadataAllow/MetadataDeny and returns
+// it with lower-cased keys.
+func (o Options) outgoingMetadata(in map[string]metadataValues) (map[string][]string, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	out := make(map[string][]string, len(in))
+	keys := make([]string, 0, len(in))
+	for k := range in {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // report the same offending key on every attempt
+	for _, k := range keys {
+		name := strings.ToLower(k)
+		if !validMetadataKey(name) {
+			return nil, fmt.Errorf("invalid metadata key %q", k)
+		}
+		if reservedMetadata[name] || strings.HasPrefix(name, "grpc-") || !o.metadataAllowed(name) {
+			return nil, fmt.Errorf("metadata key %q is not allowed", k)
+		}
+		out[name] = append(out[name], in[k]...)
+	}
+	return out, nil
+}
+
+// metadataAllowed applies the deny list, then the allow list (if any). Entries ending in "*" match prefixes.
+func (o Options) metadataAllowed(name string) bool {
+	if matchPattern(o.MetadataDeny, name) {
+		return false
+	}
+	return len(o.MetadataAllow) == 0 || matchPattern(o.MetadataAllow, name)
+}
+
+// matchPattern reports whether name matches one of patterns, compared case-insensitively; a pattern ending in
+// "*" matches by prefix.
+func matchPattern(patterns []string, name string) bool {
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validMetadataKey reports whether name is a valid lower-case gRPC metadata key.
+func validMetadataKey(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGateway_RequestMetadata(t *testing.T) {
+	seen := make(chan metadata.MD, 1)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		seen <- md
+		return handler(ctx, req)
+	}))
+	pb.RegisterEchoServiceServer(s, echoServer{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+	target := lis.Addr().String()
+
+	srv := httptest.NewServer(Handler(Options{MetadataAllow: []string{"x-tenant", "x-trace-*"}, MetadataDeny: []string{"x-trace-secret"}}))
+	defer srv.Close()
+
+	call := func(md map[string]any) (int, []byte) {
+		return postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}, "metadata": md}, nil)
+	}
+
+	code, b := call(map[string]any{"X-Tenant": "acme", "x-trace-id": []string{"a", "b"}})
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	md := <-seen
+	if got := md.Get("x-tenant"); len(got) != 1 || got[0] != "acme" {
+		t.Fatalf("x-tenant = %v", got)
+	}
+	if got := md.Get("x-trace-id"); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("x-trace-id = %v", got)
+	}
+
+	for _, bad := range []map[string]any{
+		{"x-trace-secret": "s"},
+		{"x-other": "v"},
+		{"grpc-timeout": "1S"},
+		{"x-tenant": 42},
+	} {
+		if code, b := call(bad); code != http.StatusBadRequest || !strings.Contains(string(b), "metadata") {
+			t.Fatalf("%v: status=%d body=%s", bad, code, b)
+		}
+	}
+}
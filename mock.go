@@ -0,0 +1,212 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MockConfig answers calls to a method from the gateway instead of its upstream, e.g. so frontends can be
+// built before the backend exists. Mocked calls need neither a reachable target nor the method's descriptors;
+// Authorize rules, which need the decoded request, do not apply to them. The response goes through the
+// method's RenameFields, ResponseEnvelope and ResponseHeaders like an upstream response.
+type MockConfig struct {
+	// Enabled turns the mock on; the admin API (POST {Path}/admin/mocks) toggles it at runtime.
+	Enabled bool
+	// Response is a text/template of the JSON response message. It sees .Request (the JSON request body,
+	// decoded; nil for other body formats), .Header (the request headers), .RequestID, .Method and .Target,
+	// and a json function that encodes a value as JSON, e.g. {"id":{{json .Request.id}},"name":"Ada"}.
+	// Empty responds with {}.
+	Response string
+	// Latency delays each response, plus a random part of up to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+	// ErrorRate is the fraction of calls, in [0, 1], that fail with ErrorCode (a gRPC code name such as
+	// "Unavailable", the default) and ErrorMessage, reported like upstream errors.
+	ErrorRate    float64
+	ErrorCode    string
+	ErrorMessage string
+}
+
+// mockData is the value Response templates are executed with.
+type mockData struct {
+	Request   any
+	Header    http.Header
+	RequestID string
+	Method    string
+	Target    string
+}
+
+// grpcCodeByName returns the gRPC code named name (e.g. "NotFound"), or Unavailable for ""; it reports false
+// for unknown names.
+func grpcCodeByName(name string) (codes.Code, bool) {
+	if name == "" {
+		return codes.Unavailable, true
+	}
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if c.String() == name {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// mockSwitches are the runtime overrides of MockConfig.Enabled, by Options.Methods key. They last until
+// the process restarts.
+type mockSwitches struct {
+	mu      sync.RWMutex
+	enabled map[string]bool
+}
+
+// mock returns the mock of method under opts, if it is enabled.
+func (m *mockSwitches) mock(opts Options, method string) (string, *MockConfig, bool) {
+	key := method
+	if _, ok := opts.Methods[key]; !ok {
+		key = "*"
+	}
+	mc := opts.Methods[key].Mock
+	if mc == nil {
+		return "", nil, false
+	}
+	m.mu.RLock()
+	enabled, ok := m.enabled[key]
+	m.mu.RUnlock()
+	if !ok {
+		enabled = mc.Enabled
+	}
+	return key, mc, enabled
+}
+
+func (m *mockSwitches) set(key string, enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.enabled == nil {
+		m.enabled = make(map[string]bool)
+	}
+	m.enabled[key] = enabled
+}
+
+// serveMock answers a call of method with its mock mc, registered under the Options.Methods key.
+func (h *handler) serveMock(ctx context.Context, w http.ResponseWriter, r *http.Request, live *liveConfig, key string, mc *MockConfig, data mockData, body []byte, jsonBody bool) {
+	h.metrics.Add("gateway_mock_calls_total", 1, "method", data.Method)
+	rnd := core.RandFromContext(ctx, nil)
+	if delay := mc.Latency + time.Duration(float64(mc.Jitter)*unitFloat(rnd)); delay > 0 {
+		if err := core.Sleep(ctx, core.ClockFromContext(ctx, nil), delay); err != nil {
+			h.writeError(w, r, statusClientClosedRequest, ErrCodeClientClosed, "client closed request")
+			return
+		}
+	}
+	if mc.ErrorRate > 0 && unitFloat(rnd) < mc.ErrorRate {
+		code, _ := grpcCodeByName(mc.ErrorCode)
+		msg := mc.ErrorMessage
+		if msg == "" {
+			msg = "mock error"
+		}
+		h.writeInvokeError(w, r, status.Error(code, msg), nil)
+		return
+	}
+	if jsonBody && len(bytes.TrimSpace(body)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&data.Request); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+	}
+	resp, err := live.responses.mockResponse(key, data)
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	headers, err := live.responses.responseHeaders(headerData{Header: r.Header, RequestID: data.RequestID, Method: data.Method, Target: data.Target}, resp)
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	resp, err = live.responses.transform(live.opts, envelopeData{Data: resp, RequestID: data.RequestID, Method: data.Method, Target: data.Target})
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	for name, values := range headers {
+		w.Header()[name] = values
+	}
+	h.writeResponseBody(w, r, resp)
+}
+
+// unitFloat returns a random number in [0, 1).
+func unitFloat(rnd core.Rand) float64 {
+	return float64(rnd.Int63()) / (1 << 63)
+}
+
+type mockInfo struct {
+	Method  string `json:"method"` // Options.Methods key
+	Enabled bool   `json:"enabled"`
+}
+
+type mocksResponse struct {
+	Mocks []mockInfo `json:"mocks"`
+}
+
+// serveMocks handles the admin mock routes:
+//
+//	GET  /mocks                                   the configured mocks and whether they are enabled
+//	POST /mocks {"method": M, "enabled": bool}    turns the mock of M on or off
+func (h *handler) serveMocks(w http.ResponseWriter, r *http.Request) {
+	opts := h.live.Load().opts
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req mockInfo
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid JSON body: "+err.Error())
+			return
+		}
+		if opts.Methods[req.Method].Mock == nil {
+			h.writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no mock configured for "+req.Method)
+			return
+		}
+		h.mocks.set(req.Method, req.Enabled)
+	default:
+		h.rejectRoute(w, r, "GET, POST")
+		return
+	}
+	out := mocksResponse{Mocks: []mockInfo{}}
+	for key := range opts.Methods {
+		if _, _, enabled := h.mocks.mock(opts, key); opts.Methods[key].Mock != nil {
+			out.Mocks = append(out.Mocks, mockInfo{Method: key, Enabled: enabled})
+		}
+	}
+	sort.Slice(out.Mocks, func(i, j int) bool { return out.Mocks[i].Method < out.Mocks[j].Method })
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// mockResponse renders the mock Response of the Options.Methods entry key.
+func (t *responseTransformer) mockResponse(key string, data mockData) ([]byte, error) {
+	if err := t.errs[key]; err != nil {
+		return nil, err
+	}
+	tmpl := t.mocks[key]
+	if tmpl == nil {
+		return []byte("{}"), nil
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("mock response: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("mock response for %s produced invalid JSON", data.Method)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGateway_Mock(t *testing.T) {
+	srv := httptest.NewServer(Handler(Options{
+		Path:       "/grpc-gateway",
+		AdminToken: "admin",
+		Methods: map[string]MethodConfig{
+			"/acme.Users/Get":    {Mock: &MockConfig{Enabled: true, Response: `{"id":{{json .Request.id}},"name":"Ada"}`, Latency: 20 * time.Millisecond}},
+			"/acme.Users/Delete": {Mock: &MockConfig{Enabled: true, ErrorRate: 1, ErrorCode: "NotFound", ErrorMessage: "no such user"}},
+		},
+	}))
+	defer srv.Close()
+	post := func(path, body string, header map[string]string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(buf.String())
+	}
+
+	// No target or descriptors are needed for mocked methods.
+	start := time.Now()
+	if code, b := post("/acme.Users/Get", `{"id":"u1"}`, nil); code != http.StatusOK || b != `{"id":"u1","name":"Ada"}` {
+		t.Fatalf("mock: status=%d body=%s", code, b)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("mock answered after %v, want the configured latency", elapsed)
+	}
+	if code, b := post("/acme.Users/Delete", `{}`, nil); code != http.StatusBadGateway || !strings.Contains(b, `"grpc_code":"NotFound"`) {
+		t.Fatalf("mock error: status=%d body=%s", code, b)
+	}
+
+	// Turned off at runtime, the call goes to the (missing) upstream again.
+	admin := map[string]string{adminTokenHeader: "admin"}
+	if code, b := post("/admin/mocks", `{"method":"/acme.Users/Get","enabled":false}`, admin); code != http.StatusOK || !strings.Contains(b, `{"method":"/acme.Users/Get","enabled":false}`) {
+		t.Fatalf("toggle: status=%d body=%s", code, b)
+	}
+	if code, b := post("/acme.Users/Get", `{"id":"u1"}`, nil); code != http.StatusBadRequest || !strings.Contains(b, ErrCodeMissingTarget) {
+		t.Fatalf("unmocked: status=%d body=%s", code, b)
+	}
+	if code, b := post("/admin/mocks", `{"method":"/acme.Users/List","enabled":true}`, admin); code != http.StatusNotFound {
+		t.Fatalf("unknown mock: status=%d body=%s", code, b)
+	}
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+)
+
+// MultipartConfig accepts multipart/form-data posts on the method's route, e.g. browser file uploads. Each
+// part sets the request field at a dotted path, bound like the query parameters of GET calls: file parts
+// set bytes fields to their content (no client-side base64), form fields set scalar fields. Parts sent
+// several times fill repeated fields. Parts that name no field are subject to the unknown fields policy.
+type MultipartConfig struct {
+	// Fields maps part names to field paths, e.g. {"avatar": "user.photo"}; unmapped parts set the field
+	// of their own name.
+	Fields map[string]string
+	// FileNames maps file part names to string fields that receive the part's file name, e.g.
+	// {"avatar": "user.photo_name"}.
+	FileNames map[string]string
+}
+
+// multipartQuery converts a multipart/form-data body into the query string the invoker binds to the request
+// message (core.BodyFormatQuery), with file contents base64-encoded as the JSON mapping of bytes expects.
+func (c *MultipartConfig) multipartQuery(body []byte, boundary string) (string, error) {
+	if boundary == "" {
+		return "", errors.New("multipart body without boundary")
+	}
+	values := url.Values{}
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return values.Encode(), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("multipart body: %w", err)
+		}
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return "", fmt.Errorf("multipart part %q: %w", name, err)
+		}
+		path := name
+		if p, ok := c.Fields[name]; ok {
+			path = p
+		}
+		if part.FileName() == "" {
+			values.Add(path, string(data))
+			continue
+		}
+		values.Add(path, base64.StdEncoding.EncodeToString(data))
+		if p, ok := c.FileNames[name]; ok {
+			values.Add(p, part.FileName())
+		}
+	}
+}
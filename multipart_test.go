@@ -0,0 +1,71 @@
+package gateway
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMultipartQuery(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("title", "Report")
+	_ = mw.WriteField("tags", "a")
+	_ = mw.WriteField("tags", "b")
+	fw, _ := mw.CreateFormFile("file", "report.pdf")
+	_, _ = fw.Write([]byte("%PDF"))
+	_ = mw.Close()
+
+	c := &MultipartConfig{Fields: map[string]string{"file": "document.content"}, FileNames: map[string]string{"file": "document.name"}}
+	got, err := c.multipartQuery(body.Bytes(), mw.Boundary())
+	if err != nil {
+		t.Fatalf("multipartQuery: %v", err)
+	}
+	want := url.Values{"title": {"Report"}, "tags": {"a", "b"}, "document.content": {"JVBERg=="}, "document.name": {"report.pdf"}}
+	if got != want.Encode() {
+		t.Fatalf("got  %s\nwant %s", got, want.Encode())
+	}
+	if _, err := c.multipartQuery(body.Bytes(), "other"); err == nil {
+		t.Fatal("wrong boundary accepted")
+	}
+}
+
+func TestGateway_MultipartRoute(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{Timeout: 5 * time.Second, Path: "/grpc-gateway", DefaultTarget: target, Methods: map[string]MethodConfig{
+		"/echo.EchoService/Echo": {Multipart: &MultipartConfig{Fields: map[string]string{"text": "message"}}},
+	}}))
+	defer srv.Close()
+
+	post := func(method, field string) (int, string) {
+		t.Helper()
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		_ = mw.WriteField(field, "from a form")
+		_ = mw.Close()
+		resp, err := http.Post(srv.URL+"/grpc-gateway"+method, mw.FormDataContentType(), &body)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+	if code, body := post("/echo.EchoService/Echo", "text"); code != http.StatusOK || !strings.Contains(body, `"message":"from a form"`) {
+		t.Fatalf("mapped field: status=%d body=%s", code, body)
+	}
+	if code, body := post("/echo.EchoService/Echo", "nope"); code != http.StatusBadRequest || !strings.Contains(body, "nope") {
+		t.Fatalf("unknown field: status=%d body=%s", code, body)
+	}
+	if code, body := post("/echo.EchoService/Missing", "text"); code != http.StatusBadRequest || !strings.Contains(body, "not accepted") {
+		t.Fatalf("not enabled: status=%d body=%s", code, body)
+	}
+}
@@ -0,0 +1,32 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// serveOpenAPI handles GET {Path}/openapi.json: an OpenAPI document for every unary method known from the
+// descriptor directory, embedded descriptors and the caller's cached inline descriptors.
+func (h *handler) serveOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.rejectRoute(w, r, http.MethodGet)
+		return
+	}
+	var namespace string
+	if h.opts.DescriptorNamespace != nil {
+		namespace = h.opts.DescriptorNamespace(r)
+	}
+	doc, err := core.OpenAPI(h.inv.Services(namespace), core.OpenAPIInfo{
+		ServerURL:      h.opts.Path,
+		TargetRequired: h.opts.DefaultTarget == "",
+		Int64Encoding:  h.opts.Int64Encoding,
+	})
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "render openapi: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(doc)
+}
@@ -0,0 +1,166 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestGateway_OpenAPIAndMethodRoute(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	mux := http.NewServeMux()
+	h := Handler(Options{Timeout: 5 * time.Second, Path: "/grpc-gateway"})
+	mux.Handle("/grpc-gateway", h)
+	mux.Handle("/grpc-gateway/", h)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/grpc-gateway/openapi.json")
+	if err != nil {
+		t.Fatalf("get openapi: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected status: %d, body: %s", resp.StatusCode, string(b))
+	}
+	var doc struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+		Comps   struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatalf("decode openapi: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" {
+		t.Fatalf("unexpected openapi version: %q", doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/echo.EchoService/Echo"]["post"]; !ok {
+		t.Fatalf("missing operation for /echo.EchoService/Echo: %v", doc.Paths)
+	}
+	if got := doc.Comps.Schemas["echo.EchoRequest"].Properties["message"]["type"]; got != "string" {
+		t.Fatalf("unexpected schema for echo.EchoRequest.message: %v", got)
+	}
+
+	// The documented path is callable with a plain JSON body.
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/echo.EchoService/Echo", bytes.NewBufferString(`{"message":"direct"}`))
+	req.Header.Set(targetHeader, target)
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post method route: %v", err)
+	}
+	defer resp2.Body.Close()
+	b, _ := io.ReadAll(resp2.Body)
+	if resp2.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d, body: %s", resp2.StatusCode, b)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(b, &out); err != nil || out["message"] != "direct" {
+		t.Fatalf("unexpected response: %s", b)
+	}
+}
+
+func TestGateway_ProtoComments(t *testing.T) {
+	loc := func(leading, trailing string, path ...int32) *descriptorpb.SourceCodeInfo_Location {
+		l := &descriptorpb.SourceCodeInfo_Location{Path: path, Span: []int32{0, 0, 1}}
+		if leading != "" {
+			l.LeadingComments = proto.String(leading)
+		}
+		if trailing != "" {
+			l.TrailingComments = proto.String(trailing)
+		}
+		return l
+	}
+	set, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{
+		Name:    proto.String("acme/docs.proto"),
+		Package: proto.String("acme"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Doc"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("title"), JsonName: proto.String("title"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("parent"), JsonName: proto.String("parent"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".acme.Doc"), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name:   proto.String("Docs"),
+			Method: []*descriptorpb.MethodDescriptorProto{{Name: proto.String("Get"), InputType: proto.String(".acme.Doc"), OutputType: proto.String(".acme.Doc")}},
+		}},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{
+			loc(" Docs serves documents.\n", "", 6, 0),
+			loc(" Get returns a document.\n\n It never fails.\n", "", 6, 0, 2, 0),
+			loc(" A document.\n", "", 4, 0),
+			loc("", " The title.\n", 4, 0, 2, 0),
+			loc(" The parent document.\n", "", 4, 0, 2, 1),
+		}},
+	}}})
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", DescriptorFS: fstest.MapFS{"acme.Docs.pb": {Data: set}}}))
+	defer srv.Close()
+
+	get := func(path string, out any) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/grpc-gateway" + path)
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s: %v", path, err)
+		}
+	}
+
+	var catalog servicesResponse
+	get("/services", &catalog)
+	var docs serviceInfo
+	for _, svc := range catalog.Services {
+		if svc.Name == "acme.Docs" {
+			docs = svc
+		}
+	}
+	if docs.Comment != "Docs serves documents." || len(docs.Methods) != 1 || docs.Methods[0].Comment != "Get returns a document.\n\nIt never fails." {
+		t.Fatalf("service: %+v", docs)
+	}
+	if msg := catalog.Messages["acme.Doc"]; msg.Comment != "A document." || msg.Fields["title"] != "The title." || msg.Fields["parent"] != "The parent document." {
+		t.Fatalf("messages: %+v", catalog.Messages)
+	}
+	if _, ok := catalog.Messages["echo.EchoRequest"]; ok {
+		t.Fatal("undocumented message listed")
+	}
+
+	var doc struct {
+		Tags  []map[string]string                  `json:"tags"`
+		Paths map[string]map[string]map[string]any `json:"paths"`
+		Comps struct {
+			Schemas map[string]map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	get("/openapi.json", &doc)
+	if len(doc.Tags) != 1 || doc.Tags[0]["name"] != "acme.Docs" || doc.Tags[0]["description"] != "Docs serves documents." {
+		t.Fatalf("tags: %v", doc.Tags)
+	}
+	if op := doc.Paths["/acme.Docs/Get"]["post"]; op["summary"] != "Get returns a document." || op["description"] != "Get returns a document.\n\nIt never fails." {
+		t.Fatalf("operation: %v", op)
+	}
+	schema := doc.Comps.Schemas["acme.Doc"]
+	props, _ := schema["properties"].(map[string]any)
+	title, _ := props["title"].(map[string]any)
+	parent, _ := props["parent"].(map[string]any)
+	if schema["description"] != "A document." || title["description"] != "The title." || title["type"] != "string" ||
+		parent["description"] != "The parent document." || parent["allOf"] == nil {
+		t.Fatalf("schema: %v", schema)
+	}
+}
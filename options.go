@@ -1,16 +1,366 @@
 package gateway
 
-import "time"
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc"
+)
 
 // Options is the gateway SDK configuration (optional).
 type Options struct {
-	// Timeout for a single gRPC call; zero means no timeout.
+	// Timeout for a single gRPC call; zero means no timeout. Callers may shorten it per request with a
+	// grpc-timeout or X-Gateway-Timeout header, and Methods may shorten it per method.
 	Timeout time.Duration
 	// Path to register on the mux, default "/grpc-gateway".
 	Path string
-	// DefaultTarget is the default gRPC target (e.g. "host:port") when the request does not provide target/target_addr.
+	// DefaultTarget is the default gRPC target (e.g. "host:port", or "xds:///users" for a service managed by an xDS
+	// control plane, see core.IsXDSTarget) when the request does not provide target/target_addr.
 	// If empty, the request must still provide target.
 	DefaultTarget string
+	// LocalServer, if set, is called in-process for requests with "target": "local", over an in-memory
+	// connection instead of TCP (e.g. a modular monolith embedding the gateway). It may also be serving on
+	// the network. Its services registered from generated code need no descriptor files.
+	LocalServer *grpc.Server
+	// LocalServices, if set, registers service implementations (e.g. pb.RegisterUserServiceServer(s, impl))
+	// on a server the gateway creates and serves as LocalServer. It is ignored when LocalServer is set.
+	LocalServices func(s grpc.ServiceRegistrar)
+	// UnaryInterceptors and StreamInterceptors wrap every upstream call to gRPC targets, the first outermost,
+	// so existing client interceptors (auth, tracing, metrics) plug in unchanged. Stream interceptors see
+	// server-, client- and bidirectional-streaming calls; gRPC-Web targets bypass both. core.CallInfoFromContext
+	// tells them the resolved method, target and descriptor of the call.
+	UnaryInterceptors  []grpc.UnaryClientInterceptor
+	StreamInterceptors []grpc.StreamClientInterceptor
+	// DescriptorFS, if set, holds the {service}.pb descriptor files resolved for full method names, e.g. an
+	// embed.FS so they ship inside the binary. Nil reads them from the core package's source directory
+	// (core.DefaultDescriptorDir), which only exists where the gateway was built.
+	DescriptorFS fs.FS
+	// DescriptorFetcher loads descriptor_ids that are not cached, e.g. &core.BSRFetcher{} for
+	// Buf Schema Registry module references such as "buf.build/acme/payments:v1.2.0". Nil disables remote lookup.
+	DescriptorFetcher core.DescriptorFetcher
+	// DescriptorLayers is the order methods are resolved in: the local server, the preloaded and directory
+	// descriptors, the cached uploads and the DescriptorFetcher (see core.WithDescriptorLayers). Full method
+	// names are also served from uploads and the registry by default, and a descriptor_id the cache and
+	// registry do not have falls back to the local server and the directory. Nil means
+	// core.DefaultDescriptorLayers.
+	DescriptorLayers []core.DescriptorLayer
+	// DescriptorNamespace, if set, maps a request to its caller's namespace (e.g. from an API key or tenant header).
+	// descriptor_ids are scoped per namespace, so one client cannot read or overwrite another client's descriptors.
+	DescriptorNamespace func(r *http.Request) string
+	// DescriptorWriteToken, if set, is required in the X-Gateway-Descriptor-Token header of any request that
+	// uploads a descriptor (inline "descriptor" or chunked sync). Lookups by descriptor_id alone do not need it.
+	DescriptorWriteToken string
+	// ClientIP, if set, determines caller addresses behind trusted proxies and enforces allow and deny lists;
+	// callers that are not allowed get 403. Handler panics on malformed prefixes.
+	ClientIP *ClientIPConfig
+	// Signature, if set, requires an HMAC signature on every call; see SignatureConfig.
+	Signature *SignatureConfig
+	// Encryption, if set, accepts AES-GCM encrypted (b64v2) bodies and answers them encrypted; see
+	// EncryptionConfig.
+	Encryption *EncryptionConfig
+	// AdminToken enables the {Path}/admin/ routes (e.g. descriptor version listing and rollback) for requests
+	// carrying it in the X-Gateway-Admin-Token header. Empty disables them.
+	AdminToken string
+	// Profiling adds the {Path}/admin/debug/ routes serving pprof profiles and expvar-style runtime statistics.
+	// Like the other admin routes they need AdminToken.
+	Profiling bool
+	// PreloadDescriptors are FileDescriptorSets loaded and indexed when the Handler is built, so the first
+	// calls of their methods skip descriptor resolution. Handler panics if a source cannot be read or holds an
+	// invalid descriptor set.
+	PreloadDescriptors []DescriptorSource
+	// BaseDescriptors are FileDescriptorSets (e.g. organization-wide common protos) that fill in the imports
+	// missing from inline and chunk-uploaded descriptors, so clients need to upload only their own files. The
+	// well-known types and common google/api protos are always filled in. Handler panics if a source cannot be
+	// read or the sets are inconsistent.
+	BaseDescriptors []DescriptorSource
+	// DescriptorCache bounds the in-memory cache of inline/fetched descriptors (LRU by entries and bytes, optional TTL).
+	// The zero value applies the defaults.
+	DescriptorCache core.DescriptorCacheLimits
+	// Metrics receives counters and gauges (cache size, evictions, ...); nil discards them.
+	Metrics core.Metrics
+	// TraceSink, if set, receives the execution tree of every invocation (see core.Span) for storage or rendering.
+	// Independently, a request with "trace": true gets its tree back in the X-Gateway-Trace header.
+	TraceSink func(trace *core.Span)
+	// OnClientDisconnect, if set, is called when the HTTP client goes away before the upstream call completes.
+	// The upstream call has already been cancelled at that point; err is the resulting invocation error.
+	OnClientDisconnect func(r *http.Request, err error)
+	// OnDeprecatedCall, if set, is called for every call to a deprecated method (see Deprecation) with the
+	// caller's identity, e.g. to log who still needs to migrate. Calls are also counted in
+	// gateway_deprecated_calls_total by method.
+	OnDeprecatedCall func(r *http.Request, call DeprecatedCall)
+	// AllowedTargets, if non-empty, lists the targets callers may request; others are rejected with 403.
+	// Entries ending in "*" match by prefix, e.g. "users-*" or "10.0.*". Target groups and DefaultTarget are
+	// always allowed.
+	AllowedTargets []string
+	// TargetOverride, if set, lets the callers it allows redirect calls with the X-Gateway-Target-Override
+	// header, e.g. to a branch deployment; the header is rejected with 403 otherwise.
+	TargetOverride *TargetOverrideConfig
+	// Targets holds per-target channel settings (keepalive, max message sizes, authority, user agent, window sizes,
+	// credentials attached to upstream calls) keyed by target address; the "*" entry applies to targets without
+	// their own.
+	Targets map[string]core.TargetConfig
+	// Idempotency, if set, makes requests carrying an Idempotency-Key header replay the stored result of the
+	// first successful call with that key instead of invoking the upstream again.
+	Idempotency *IdempotencyConfig
+	// TargetGroups maps a group name to weighted targets: a request whose target names a group is routed to
+	// one of the group's targets (see TrafficSplit). A method's own Split takes precedence.
+	TargetGroups map[string]TrafficSplit
+	// StrictErrors reports wrong HTTP methods as 405 and undecodable bodies as 400 with a JSON error body,
+	// instead of the default bare 404. Error bodies carry a stable "code" (see the ErrCode constants) either way.
+	StrictErrors bool
+	// ErrorFormat selects how errors are rendered: ErrorFormatJSON (default, {"error", "code", ...}) or
+	// ErrorFormatProblem (RFC 7807 application/problem+json with code, grpc_code, grpc_status, request_id and
+	// details as extension members).
+	ErrorFormat ErrorFormat
+	// ProblemTypeBase prefixes the error code to form the problem "type" URI; default "urn:gateway:error:".
+	ProblemTypeBase string
+	// Logger receives the gateway's warnings, e.g. slow requests (see MethodConfig.SlowThreshold); nil means
+	// slog.Default().
+	Logger *slog.Logger
+	// ErrorMapper, if set, renders error responses instead of ErrorFormat, e.g. with company error codes or
+	// localized messages: it is given the *Error the gateway would report and returns the HTTP status and a
+	// body encoded as JSON. A zero status keeps the default rendering, so mappers can handle only some errors.
+	// core.CallInfoFromContext(ctx) describes the call, once its method was resolved.
+	ErrorMapper func(ctx context.Context, err error) (status int, body any)
+	// MetadataAllow, if non-empty, lists the metadata keys callers may send in the request "metadata" object;
+	// MetadataDeny lists keys they may not (it wins over MetadataAllow). Entries ending in "*" match key
+	// prefixes, e.g. "x-tenant-*". Transport headers (grpc-*, content-type, te, user-agent, ...) are never allowed.
+	MetadataAllow []string
+	MetadataDeny  []string
+	// Claims, if set, returns the verified token claims of the caller for MethodConfig.Authorize rules, where
+	// an error rejects the call with 401, and for field visibility rules (MethodConfig.VisibleIf).
+	Claims func(r *http.Request) (map[string]any, error)
+	// PII, if set, enforces policies on fields holding personal data; see PIIPolicy.
+	PII *PIIPolicy
+	// AuditSink receives the records of methods with MethodConfig.Audit; sink failures are counted in
+	// gateway_audit_errors_total and do not affect the call.
+	AuditSink AuditSink
+	// ContractSink receives the records of methods with MethodConfig.Record, e.g. golden files for contract
+	// tests; sink failures are counted in gateway_contract_errors_total and do not affect the call.
+	ContractSink ContractSink
+	// Async, if set, runs the workers that invoke calls accepted for methods with MethodConfig.Async.
+	Async *AsyncConfig
+	// HealthCheck, if set, probes pooled upstream connections with grpc.health.v1 and replaces those that keep
+	// failing; the results are listed under "targets" in GET {Path}/services.
+	HealthCheck *core.HealthCheckConfig
+	// Faults are injected into calls from the start, e.g. for a chaos experiment; the admin API
+	// ({Path}/admin/faults) changes them at runtime. See Fault.
+	Faults []Fault
+	// Readiness, if set, makes GET {Path}/ready answer 503 until the upstream connections and warm-up calls
+	// it lists have succeeded; see ReadinessConfig.
+	Readiness *ReadinessConfig
+	// LongPoll, if set, lets clients consume server-streaming methods by polling; see LongPollConfig.
+	LongPoll *LongPollConfig
+	// BidiStreaming lets method routes call bidirectional-streaming methods over one full-duplex request:
+	// a POST with Accept: application/x-ndjson streams NDJSON request messages in its body as they are
+	// written and gets the responses as NDJSON lines, flushed per message. It needs HTTP/2, or HTTP/1.1
+	// servers and proxies that allow full duplex. Such calls are refused when Signature is set.
+	BidiStreaming bool
+	// RequestEcho lets callers ask, with "echo": true or the X-Gateway-Echo header, for the request the
+	// gateway would send upstream instead of calling it: the resolved method, target, outgoing metadata and
+	// each request message as binary protobuf (base64) and canonical JSON (see core.CanonicalRequest), for
+	// diffing against what a backend that rejects the call expects. Authorization and the other checks
+	// before the call still apply.
+	RequestEcho bool
+	// Webhooks maps route names to webhook adapters served at POST {Path}/webhooks/{name}, which turn
+	// third-party deliveries (JSON, form-encoded, signed) into gRPC calls.
+	Webhooks map[string]WebhookRoute
+	// Routes map HTTP methods and paths to gRPC methods with field bindings, e.g. "POST /api/orders" to
+	// /orders.OrderService/CreateOrder with channel "web", for an HTTP API facade; the first match wins. See
+	// Route. Handler panics on invalid patterns.
+	Routes []Route
+	// CORS, if set, answers OPTIONS preflights and adds CORS headers so browser apps can call the gateway directly.
+	CORS *CORSConfig
+	// Quota, if set, accounts calls and bytes per client (IP or verified key) over rolling windows and rejects
+	// clients over their limits with 429. Usage is reported at {Path}/admin/usage.
+	Quota *QuotaConfig
+	// UnknownFields selects what happens to request body fields the request message does not declare:
+	// core.UnknownFieldsReject (the default) fails the call with 400, core.UnknownFieldsDrop ignores them and
+	// core.UnknownFieldsWarn ignores them and lists their paths in the X-Gateway-Unknown-Fields response
+	// header. MethodConfig.UnknownFields overrides it per method.
+	UnknownFields core.UnknownFieldPolicy
+	// WKTCoercion, if set, accepts common non-canonical JSON forms of well-known types in request bodies
+	// (unix timestamps, "5m" durations, FieldMask path arrays, ...) and selects their form in responses;
+	// see core.WKTCoercion.
+	WKTCoercion *core.WKTCoercion
+	// FieldPresence, if set, renders the response fields with presence (message and wrapper fields, proto3
+	// optional fields, oneof members) that the upstream left unset consistently: core.FieldPresenceOmit
+	// leaves them out, so clients can tell a field set to its default from an unset one, and
+	// core.FieldPresenceNull renders them as null.
+	FieldPresence core.FieldPresence
+	// Int64Encoding selects the JSON form of 64-bit integers: core.Int64Strings keeps the strings of the proto3
+	// JSON mapping in responses and rejects request numbers too large for JavaScript to hold exactly;
+	// core.Int64Numbers renders numbers in responses, for backends whose clients parse them exactly. Requests
+	// take strings or numbers either way.
+	Int64Encoding core.Int64Encoding
+	// MaxResponseBytes, if positive, bounds upstream responses, both the received message (replacing larger
+	// or unset TargetConfig.MaxRecvMsgSize values) and its JSON rendering; larger responses fail with 502
+	// response_too_large instead of being buffered.
+	MaxResponseBytes int
+	// Proxy, if set, dials upstream targets through a forward proxy, http://host:port (HTTP CONNECT) or
+	// socks5://host:port, for networks where the gateway cannot reach backends directly. Targets can use a
+	// proxy of their own or none with core.TargetConfig.Proxy.
+	Proxy string
+	// ResponseCompression compresses response bodies with gzip or deflate, as negotiated by Accept-Encoding.
+	// Compression toward upstreams is configured per target (TargetConfig.Compression).
+	ResponseCompression bool
+	// ResponseCompressionMinSize is the smallest body that gets compressed; zero means 1KiB.
+	ResponseCompressionMinSize int
+	// SymmetricResponses encodes successful responses with the codec of their request (b64v1, gzip, ...)
+	// instead of as plain JSON, for clients whose transport expects symmetric encoding. Clients can ask for it
+	// per request with the X-Gateway-Symmetric-Response header. aesgcm responses are always encrypted.
+	SymmetricResponses bool
+	// Methods holds per-method settings keyed by full method name ("/package.Service/Method");
+	// the "*" entry applies to methods without their own. Calls are matched by the method they resolve to, so
+	// a request spelling it otherwise (e.g. with a short service name) gets the same settings.
+	Methods map[string]MethodConfig
+	// Reload, if set, loads a new configuration (e.g. with LoadOptions) whose AllowedTargets, Methods,
+	// AdminToken, DescriptorWriteToken, Signature, Encryption and Quota limits replace the current ones
+	// without dropping in-flight requests, e.g. to rotate keys. It runs on POST {Path}/admin/reload and, with ReloadOnSIGHUP, when the process gets SIGHUP.
+	// Other settings need a restart. Quota limits are only reloaded if Quota was set initially. With Tenants,
+	// each tenant reloads its own settings from its entry in the result, and so does each of the Versions,
+	// including its Deprecation.
+	Reload         func() (Options, error)
+	ReloadOnSIGHUP bool
+	// OnReload, if set, is called after every reload attempt with its error (nil on success).
+	OnReload func(err error)
+	// Tenants, if set, serves one virtual gateway per tenant from this handler, each with the settings of
+	// its TenantConfig. The tenant is named by the TenantHeader request header or, if TenantHeader is empty,
+	// by the first path segment below Path: {Path}/{tenant}, {Path}/{tenant}/services, ...
+	Tenants      map[string]TenantConfig
+	TenantHeader string
+	// Versions, if set, serves one gateway per API version below {Path}/{version} from this handler, e.g.
+	// {Path}/v1/{package.Service}/{Method}, each with the descriptors, targets, methods and deprecation of its
+	// APIVersion. Requests below no version prefix are served with the shared settings. Versions cannot be
+	// combined with Tenants.
+	Versions map[string]APIVersion
+	// Clock is the time source for timestamps, deadlines and TTLs; nil means the system clock.
+	Clock core.Clock
+	// Rand is the randomness source for request IDs and jitter; nil means math/rand.
+	Rand core.Rand
+
+	preloadedSets [][]byte // PreloadDescriptors as read once for all tenants
+	baseSets      [][]byte // BaseDescriptors as read once for all tenants
+	// version is the Options.Versions entry these options serve, if any, and versionDeprecation its
+	// APIVersion.Deprecation.
+	version            string
+	versionDeprecation *Deprecation
+}
+
+// ErrorFormat is the wire format of error responses.
+type ErrorFormat string
+
+const (
+	ErrorFormatJSON    ErrorFormat = ""
+	ErrorFormatProblem ErrorFormat = "problem+json"
+)
+
+// MethodConfig is the per-method configuration in Options.Methods.
+type MethodConfig struct {
+	// Timeout caps calls to the method; the effective deadline is the minimum of this, the caller's
+	// grpc-timeout/X-Gateway-Timeout header and Options.Timeout. Zero means no per-method cap.
+	Timeout time.Duration
+	// RenameFields renames fields of the successful JSON response, keyed by dotted path of the original
+	// field (e.g. "user.displayName") with the new name (e.g. "display_name") as value. Paths descend
+	// through nested objects and apply to every element of arrays.
+	RenameFields map[string]string
+	// ResponseEnvelope, if set, is a text/template that wraps the successful JSON response to match an
+	// existing API convention, e.g. {"code":0,"data":{{.Data}},"request_id":{{json .RequestID}}}.
+	// The template sees .Data (the response JSON), .RequestID, .Method and .Target, and a json function
+	// that encodes a value as JSON. Its output must be valid JSON.
+	ResponseEnvelope string
+	// Shadow mirrors calls to a secondary target in the background (responses discarded, failures only
+	// metered as gateway_shadow_calls_total and reported to Shadow.OnError), e.g. to validate a new backend
+	// version with production traffic.
+	Shadow core.ShadowConfig
+	// Authorize, if set, is a CEL expression that must evaluate to true for the call to proceed; otherwise the
+	// caller gets 403. It sees request (the decoded request message in its JSON form, defaults included),
+	// headers (lower-cased names), claims (from Options.Claims) and method, e.g.
+	// request.user_id == claims.sub && headers["x-tenant"] == claims.tenant.
+	Authorize string
+	// VisibleIf maps dotted JSON field paths of the response (e.g. "owner.email"; arrays along the way apply
+	// to every element) to CEL expressions that must evaluate to true for the caller to see the field, e.g.
+	// "'admin' in claims.roles"; otherwise the field is omitted. Fields declared with the gateway.visible_if
+	// option carry rules of their own, whatever the method. Rules see headers (lower-cased names), claims
+	// (from Options.Claims; none if it fails) and method, and fail closed: a rule that cannot be evaluated
+	// hides its field. Async results passed to AsyncConfig.OnResult are not filtered.
+	VisibleIf map[string]string
+	// PII lists dotted JSON field paths (e.g. "customer.email") of the method's requests and responses that
+	// hold personal data, in addition to the fields tagged with the gateway.pii option; see PIIPolicy.
+	PII []string
+	// Audit records the method's calls, with request and response payloads, to Options.AuditSink. Fields
+	// declared with the debug_redact = true option and the fields at Redact paths are redacted.
+	Audit bool
+	// Redact lists dotted JSON field paths (e.g. "card.number") redacted in audited and recorded requests and
+	// responses.
+	Redact []string
+	// Record captures the method's unary calls as request/response pairs to Options.ContractSink, redacted
+	// like audit records, for contract and regression tests replayed with ReplayContract.
+	Record bool
+	// Async accepts calls to the method with 202 and invokes the upstream in the background through
+	// Options.Async (fire-and-forget). The response carries the job_id (the request ID).
+	Async bool
+	// Split, if it has targets, routes calls to the method across weighted targets regardless of the
+	// requested target, e.g. for a canary rollout of a new backend version.
+	Split TrafficSplit
+	// Hedge sends a duplicate call when the first has not answered after Hedge.Delay and returns the first
+	// successful response, cutting tail latency of read-only methods. The duplicate goes to another target of
+	// the method's Split or of the requested target group, or to the same target otherwise.
+	Hedge core.HedgeConfig
+	// Coalesce lets concurrent identical calls (same target, method, request message and metadata) share one
+	// upstream call and its response, protecting the backend from thundering herds on hot reads. Only enable
+	// it for methods without side effects.
+	Coalesce bool
+	// LenientEnums accepts enum values in request bodies case-insensitively and without the enum's prefix,
+	// e.g. "active" or "Active" for USER_STATUS_ACTIVE of enum UserStatus. Set it on "*" for all methods.
+	LenientEnums bool
+	// UnknownFields, if set, replaces Options.UnknownFields for the method.
+	UnknownFields core.UnknownFieldPolicy
+	// Defaults sets request fields the body leaves unset before the call, e.g. {"page_size": 20}. Keys are
+	// dotted field paths ("paging.page_size", JSON or proto names), values are in the proto3 JSON mapping.
+	// They take precedence over defaults declared in the descriptor with the gateway.default_value field
+	// option (proto/gateway/options.proto), which apply to every method.
+	Defaults map[string]any
+	// FetchAllPages lets callers of an AIP-158 list method (page_token in the request, next_page_token and a
+	// repeated items field in the response) ask for all pages at once with "fetch_all": true; the gateway then
+	// follows next_page_token for up to this many pages and returns the merged items. Zero disables it.
+	FetchAllPages int
+	// Affinity keys the calls of the method for targets with core.TargetConfig.ConsistentHash, so that the
+	// calls of one client (e.g. one user) reach the same endpoint of a stateful backend.
+	Affinity *AffinityConfig
+	// ResponseHeaders are set on successful responses, by header name, e.g. Cache-Control for cacheable reads.
+	// Values are text/templates seeing .Response (the upstream response JSON, e.g. {{.Response.etag}}),
+	// .Header (the request headers, e.g. {{.Header.Get "X-Tenant"}}), .RequestID, .Method and .Target;
+	// values rendering as empty are left out. The headers of the "*" entry, e.g. security headers, apply to
+	// every method; a method's own replace them by name.
+	ResponseHeaders map[string]string
+	// ETag sends a strong ETag of each successful response and answers requests whose If-None-Match lists it
+	// with 304 and no body, saving the transfer for clients polling the method. The tag is computed from the
+	// body as sent, so every codec (X-Gateway-Encoding) and content coding (ResponseCompression) gets its own,
+	// and Vary lists the request headers choosing them. The gateway keeps no response cache: the upstream is
+	// still called and the tag computed from its answer, so only enable it for methods without side effects,
+	// as with Coalesce. Responses sealed with aesgcm differ on every sealing, so they get a weak tag of the
+	// plaintext instead, keyed by the encryption key so the tag does not reveal it to others.
+	ETag bool
+	// Deprecation, if set, marks the method deprecated; see Deprecation.
+	Deprecation *Deprecation
+	// Mock, if set, can answer calls to the method without calling the upstream; see MockConfig.
+	Mock *MockConfig
+	// Multipart, if set, accepts multipart/form-data posts, e.g. file uploads, on the method's route; see
+	// MultipartConfig.
+	Multipart *MultipartConfig
+	// SlowThreshold, if positive, logs calls to the method that take longer as a warning on Options.Logger,
+	// with the time spent decoding, resolving, dialing, invoking and marshalling, and counts them in
+	// gateway_slow_requests_total. Set it on "*" for all methods.
+	SlowThreshold time.Duration
+	// RawResponse, if set, writes a bytes field of the responses to the body instead of the JSON message,
+	// e.g. for file downloads; see RawResponse.
+	RawResponse *RawResponse
 }
 
 // DefaultOptions returns the default configuration.
@@ -20,3 +370,14 @@ func DefaultOptions() Options {
 		Path: string(decoded),
 	}
 }
+
+// targetAllowed reports whether callers may request target under AllowedTargets.
+func (o Options) targetAllowed(target string) bool {
+	if len(o.AllowedTargets) == 0 || target == "" || target == o.DefaultTarget {
+		return true
+	}
+	if _, ok := o.TargetGroups[target]; ok {
+		return true
+	}
+	return matchPattern(o.AllowedTargets, strings.ToLower(target))
+}
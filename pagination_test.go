@@ -0,0 +1,34 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGateway_FetchAllRequiresPaginatedMethod(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	body := map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}, "fetch_all": true}
+	call := func(opts Options) (int, string) {
+		opts.Path = "/grpc-gateway"
+		srv := httptest.NewServer(Handler(opts))
+		defer srv.Close()
+		code, b := postGateway(t, srv.URL+"/grpc-gateway", body, nil)
+		return code, string(b)
+	}
+
+	if code, b := call(Options{}); code != http.StatusBadRequest || !strings.Contains(b, "fetch_all is not enabled") {
+		t.Fatalf("not enabled: status=%d body=%s", code, b)
+	}
+	enabled := Options{Methods: map[string]MethodConfig{"/echo.EchoService/Echo": {FetchAllPages: 5}}}
+	if code, b := call(enabled); code != http.StatusBadRequest || !strings.Contains(b, "not paginated") {
+		t.Fatalf("not paginated: status=%d body=%s", code, b)
+	}
+	delete(body, "fetch_all")
+	if code, b := call(enabled); code != http.StatusOK {
+		t.Fatalf("plain call: status=%d body=%s", code, b)
+	}
+}
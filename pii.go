@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/keicoqk/gateway/core"
+)
+
+// PIIPolicy enforces policies on fields holding personal data: fields tagged with the gateway.pii option
+// (see core.PIIOption) and the fields at the MethodConfig.PII paths. PII fields are always redacted in audit
+// records and contract recordings, like MethodConfig.Redact fields.
+type PIIPolicy struct {
+	// RequireEncryption rejects requests that set PII fields with 400 unless their body is aesgcm-encoded
+	// (see EncryptionConfig), so personal data does not travel in clear between client and gateway. Calls
+	// through RegisterGatewayService have no body encoding and are rejected too.
+	RequireEncryption bool
+	// TrustedIf, if set, is a CEL expression over the caller, like MethodConfig.VisibleIf rules, that must
+	// evaluate to true for the caller to see PII fields in responses; otherwise they are omitted.
+	TrustedIf string
+}
+
+// redactPaths returns the paths redacted in mc's audit records and contract recordings.
+func (mc MethodConfig) redactPaths() []string {
+	return append(slices.Clip(mc.Redact), mc.PII...)
+}
+
+// requireEncryptedPII returns the core.InvokeRequest.Authorize hook for r that rejects unencrypted requests
+// setting PII fields, before calling next (if any).
+func requireEncryptedPII(opts Options, r *http.Request, next func(method string, request []byte) error) func(method string, request []byte) error {
+	return func(method string, request []byte) error {
+		codec, _ := r.Context().Value(requestCodecKey{}).(*requestCodec)
+		if codec == nil || codec.cipher == nil {
+			var md *desc.MessageDescriptor
+			if c := core.CallInfoFromContext(r.Context()); c != nil && c.Method != nil {
+				md = c.Method.GetInputType()
+			}
+			fields, err := core.PIIFields(md, request, opts.methodConfig(method).PII)
+			if err != nil {
+				return &authorizationError{status: http.StatusInternalServerError, code: ErrCodeInternal, msg: "pii: decode request: " + err.Error()}
+			}
+			if len(fields) > 0 {
+				return &authorizationError{status: http.StatusBadRequest, code: ErrCodeInvalidRequest,
+					msg: "request sets PII fields (" + strings.Join(fields, ", ") + "); send it " + EncodingAESGCM + "-encoded"}
+			}
+		}
+		if next != nil {
+			return next(method, request)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,64 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGateway_PIIPolicy(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	keys := map[string][]byte{"k1": []byte("0123456789abcdef")}
+	srv := httptest.NewServer(Handler(Options{
+		Path:    "/grpc-gateway",
+		Methods: map[string]MethodConfig{"/echo.EchoService/Echo": {PII: []string{"message"}}},
+		Encryption: &EncryptionConfig{
+			Keys: func(id string) ([]byte, bool) { k, ok := keys[id]; return k, ok },
+		},
+		Claims: func(r *http.Request) (map[string]any, error) {
+			return map[string]any{"scopes": strings.Fields(r.Header.Get("X-Test-Scopes"))}, nil
+		},
+		PII: &PIIPolicy{RequireEncryption: true, TrustedIf: `"pii" in claims.scopes`},
+	}))
+	defer srv.Close()
+	echo := func(c *Client, message string) (json.RawMessage, error) {
+		body, _ := json.Marshal(map[string]string{"message": message})
+		return c.InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", body)
+	}
+
+	// Requests setting PII fields must be encrypted.
+	var ce *ClientError
+	if _, err := echo(NewClient(srv.URL+"/grpc-gateway"), "ada@example.com"); !errors.As(err, &ce) || ce.StatusCode != http.StatusBadRequest || !strings.Contains(ce.Message, "PII fields (message)") {
+		t.Fatalf("plain call with PII: %v", err)
+	}
+	if _, err := echo(NewClient(srv.URL+"/grpc-gateway"), ""); err != nil {
+		t.Fatalf("plain call without PII: %v", err)
+	}
+
+	// Untrusted callers do not see PII fields in responses.
+	encrypted := NewClient(srv.URL+"/grpc-gateway", WithEncryption("k1", keys["k1"]))
+	if out, err := echo(encrypted, "ada@example.com"); err != nil || strings.Contains(string(out), "ada") {
+		t.Fatalf("untrusted caller: %s, %v", out, err)
+	}
+	// Spelling the method differently does not escape its PII paths.
+	set := mustReadDescriptor(t)
+	for service, method := range map[string]string{"EchoService": "Echo", ".echo.EchoService": "Echo", "": "echo.EchoService/Echo"} {
+		out, err := encrypted.InvokeWithDescriptor(context.Background(), target, service, method, set, "", json.RawMessage(`{"message":"ada@example.com"}`))
+		if err != nil || strings.Contains(string(out), "ada") {
+			t.Errorf("untrusted caller, service %q method %q: %s, %v", service, method, out, err)
+		}
+		_, err = NewClient(srv.URL+"/grpc-gateway").InvokeWithDescriptor(context.Background(), target, service, method, set, "", json.RawMessage(`{"message":"ada@example.com"}`))
+		if !errors.As(err, &ce) || ce.StatusCode != http.StatusBadRequest {
+			t.Errorf("plain call with PII, service %q method %q: %v", service, method, err)
+		}
+	}
+	trusted := NewClient(srv.URL+"/grpc-gateway", WithEncryption("k1", keys["k1"]), WithHeader("X-Test-Scopes", "read pii"))
+	if out, err := echo(trusted, "ada@example.com"); err != nil || !strings.Contains(string(out), `"ada@example.com"`) {
+		t.Fatalf("trusted caller: %s, %v", out, err)
+	}
+}
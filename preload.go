@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DescriptorSource names FileDescriptorSets for Options.PreloadDescriptors and BaseDescriptors: set exactly one of Path and URL.
+type DescriptorSource struct {
+	// Path is a file path or glob (e.g. "descriptors/*.pb") in FS, or in the local file system without FS.
+	// A glob must match at least one file.
+	Path string
+	// FS, if set, is the file system Path is read from, e.g. an embed.FS compiled into the binary.
+	FS fs.FS
+	// URL is an http(s) URL serving a binary FileDescriptorSet.
+	URL string
+}
+
+func (s DescriptorSource) String() string {
+	if s.URL != "" {
+		return s.URL
+	}
+	return s.Path
+}
+
+// preloadTimeout bounds fetching each URL source of Options.PreloadDescriptors.
+const preloadTimeout = 30 * time.Second
+
+// mustLoadDescriptorSources is loadDescriptorSources for Handler, which panics on errors; what names the
+// option in the panic.
+func mustLoadDescriptorSources(what string, sources []DescriptorSource) [][]byte {
+	sets, err := loadDescriptorSources(sources)
+	if err != nil {
+		panic("gateway: " + what + ": " + err.Error())
+	}
+	return sets
+}
+
+// loadDescriptorSources reads the FileDescriptorSets of sources.
+func loadDescriptorSources(sources []DescriptorSource) ([][]byte, error) {
+	var sets [][]byte
+	for _, src := range sources {
+		var (
+			data [][]byte
+			err  error
+		)
+		switch {
+		case (src.Path == "") == (src.URL == ""):
+			err = fmt.Errorf("exactly one of path and url must be set")
+		case src.URL != "":
+			var b []byte
+			b, err = fetchDescriptorSet(src.URL)
+			data = [][]byte{b}
+		default:
+			data, err = readDescriptorFiles(src.FS, src.Path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("descriptor source %q: %w", src, err)
+		}
+		sets = append(sets, data...)
+	}
+	return sets, nil
+}
+
+// readDescriptorFiles reads the files matching pattern in fsys, or in the local file system if fsys is nil.
+func readDescriptorFiles(fsys fs.FS, pattern string) ([][]byte, error) {
+	glob, read := filepath.Glob, os.ReadFile
+	if fsys != nil {
+		glob = func(pattern string) ([]string, error) { return fs.Glob(fsys, pattern) }
+		read = func(name string) ([]byte, error) { return fs.ReadFile(fsys, name) }
+	}
+	paths, err := glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no files match")
+	}
+	sort.Strings(paths)
+	sets := make([][]byte, 0, len(paths))
+	for _, p := range paths {
+		b, err := read(p)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, b)
+	}
+	return sets, nil
+}
+
+func fetchDescriptorSet(url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("url must be http or https")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), preloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET returned %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
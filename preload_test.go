@@ -0,0 +1,135 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestGateway_PreloadDescriptors(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	target, set := startTickerServer(t, release)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ticker.pb"), set, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(set) }))
+	defer remote.Close()
+
+	for name, src := range map[string]DescriptorSource{
+		"path": {Path: filepath.Join(dir, "*.pb")},
+		"fs":   {FS: fstest.MapFS{"descriptors/ticker.pb": {Data: set}}, Path: "descriptors/*.pb"},
+		"url":  {URL: remote.URL + "/ticker.pb"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", LongPoll: &LongPollConfig{}, PreloadDescriptors: []DescriptorSource{src}}))
+			defer srv.Close()
+
+			// The method resolves by full name without an inline descriptor.
+			code, b := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{"target": target, "method": "/acme.Ticker/Watch", "long_poll": true}, nil)
+			if code != http.StatusCreated {
+				t.Fatalf("open: status=%d body=%s", code, b)
+			}
+			resp, err := http.Get(srv.URL + "/grpc-gateway/services")
+			if err != nil {
+				t.Fatalf("get services: %v", err)
+			}
+			defer resp.Body.Close()
+			var out servicesResponse
+			_ = json.NewDecoder(resp.Body).Decode(&out)
+			var names []string
+			for _, svc := range out.Services {
+				names = append(names, svc.Name)
+			}
+			if !strings.Contains(strings.Join(names, ","), "acme.Ticker") {
+				t.Fatalf("services = %v", names)
+			}
+		})
+	}
+}
+
+func TestGateway_PreloadDescriptorsFailsFast(t *testing.T) {
+	for name, src := range map[string]DescriptorSource{
+		"invalid set": {FS: fstest.MapFS{"bad.pb": {Data: []byte("not a descriptor")}}, Path: "*.pb"},
+		"no match":    {Path: filepath.Join(t.TempDir(), "*.pb")},
+		"both":        {Path: "a.pb", URL: "https://example.com/a.pb"},
+		"scheme":      {URL: "file:///etc/passwd"},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(r.(string), "preload descriptors") {
+					t.Errorf("%s: recovered %v", name, r)
+				}
+			}()
+			Handler(Options{PreloadDescriptors: []DescriptorSource{src}})
+		}()
+	}
+}
+
+func TestGateway_DescriptorFS(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	target, set := startTickerServer(t, release)
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", LongPoll: &LongPollConfig{}, DescriptorFS: fstest.MapFS{"acme.Ticker.pb": {Data: set}}}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{"target": target, "method": "/acme.Ticker/Watch", "long_poll": true}, nil)
+	if code != http.StatusCreated {
+		t.Fatalf("open: status=%d body=%s", code, b)
+	}
+}
+
+func TestGateway_BaseDescriptors(t *testing.T) {
+	ts, err := desc.LoadMessageDescriptorForMessage(&timestamppb.Timestamp{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	money := builder.NewMessage("Money").
+		AddField(builder.NewField("cents", builder.FieldTypeInt64())).
+		AddField(builder.NewField("at", builder.FieldTypeImportedMessage(ts)))
+	common, err := builder.NewFile("acme/common.proto").SetPackageName("acme").AddMessage(money).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := builder.NewMessage("PayRequest").AddField(builder.NewField("amount", builder.FieldTypeImportedMessage(common.FindMessage("acme.Money"))))
+	svc := builder.NewService("Payments").AddMethod(builder.NewMethod("Pay", builder.RpcTypeMessage(req, false), builder.RpcTypeImportedMessage(common.FindMessage("acme.Money"), false)))
+	api, err := builder.NewFile("acme/payments.proto").SetPackageName("acme").AddMessage(req).AddService(svc).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the service's own file is uploaded; common.proto (and the timestamp.proto it imports) is left out.
+	full := desc.ToFileDescriptorSet(api)
+	own, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: full.File[len(full.File)-1:]})
+	base, _ := proto.Marshal(desc.ToFileDescriptorSet(common))
+
+	upload := func(srv *httptest.Server) (int, []byte) {
+		return postGateway(t, srv.URL, map[string]any{
+			"descriptor_id":          "payments",
+			"descriptor_chunk":       base64.StdEncoding.EncodeToString(own),
+			"descriptor_chunk_total": 1,
+		}, nil)
+	}
+	without := httptest.NewServer(Handler(Options{}))
+	defer without.Close()
+	if code, b := upload(without); code != http.StatusBadRequest || !strings.Contains(string(b), `imports \"acme/common.proto\"`) {
+		t.Fatalf("without base: status=%d body=%s", code, b)
+	}
+	with := httptest.NewServer(Handler(Options{BaseDescriptors: []DescriptorSource{{FS: fstest.MapFS{"common.pb": {Data: base}}, Path: "*.pb"}}}))
+	defer with.Close()
+	if code, b := upload(with); code != http.StatusOK {
+		t.Fatalf("with base: status=%d body=%s", code, b)
+	}
+}
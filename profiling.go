@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// maxProfileDuration bounds the ?seconds= of CPU profiles and execution traces.
+const maxProfileDuration = 5 * time.Minute
+
+// varsResponse is the body of GET /admin/debug/vars, in the layout of the expvar package.
+type varsResponse struct {
+	Goroutines int                `json:"goroutines"`
+	MemStats   runtime.MemStats   `json:"memstats"`
+	Metrics    map[string]float64 `json:"metrics,omitempty"` // with a *core.MemoryMetrics in Options.Metrics
+}
+
+// serveProfiling handles the Options.Profiling admin routes, mirroring net/http/pprof and expvar:
+//
+//	GET /debug/pprof/                   the available profiles
+//	GET /debug/pprof/profile?seconds=N  CPU profile over N seconds (default 30)
+//	GET /debug/pprof/trace?seconds=N    execution trace over N seconds (default 1)
+//	GET /debug/pprof/{name}?debug=N     named profile (heap, goroutine, allocs, block, mutex, ...)
+//	GET /debug/vars                     memory statistics, goroutine count and in-memory metrics as JSON
+//
+// The handlers are served here rather than through net/http/pprof and expvar, which register themselves on
+// http.DefaultServeMux when imported and expect to be mounted at /debug/.
+func (h *handler) serveProfiling(w http.ResponseWriter, r *http.Request, rel string) {
+	if r.Method != http.MethodGet {
+		h.rejectRoute(w, r, http.MethodGet)
+		return
+	}
+	if rel == "/debug/vars" {
+		resp := varsResponse{Goroutines: runtime.NumGoroutine()}
+		runtime.ReadMemStats(&resp.MemStats)
+		if m, ok := h.opts.Metrics.(*core.MemoryMetrics); ok {
+			resp.Metrics = m.Snapshot()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+	name, ok := strings.CutPrefix(rel, "/debug/pprof/")
+	if !ok {
+		h.rejectRoute(w, r, "")
+		return
+	}
+	query := r.URL.Query()
+	switch name {
+	case "":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		for _, p := range pprof.Profiles() {
+			fmt.Fprintf(w, "%d\t%s\n", p.Count(), p.Name())
+		}
+		fmt.Fprintln(w, "-\tprofile")
+		fmt.Fprintln(w, "-\ttrace")
+	case "profile", "trace":
+		d := 30 * time.Second
+		if name == "trace" {
+			d = time.Second
+		}
+		if v := query.Get("seconds"); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || n <= 0 || time.Duration(n*float64(time.Second)) > maxProfileDuration {
+				h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "invalid seconds "+strconv.Quote(v))
+				return
+			}
+			d = time.Duration(n * float64(time.Second))
+		}
+		start, stop := pprof.StartCPUProfile, pprof.StopCPUProfile
+		if name == "trace" {
+			start, stop = trace.Start, trace.Stop
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set(contentDispositionHeader, `attachment; filename="`+name+`"`)
+		if err := start(w); err != nil {
+			w.Header().Del(contentDispositionHeader)
+			h.writeError(w, r, http.StatusConflict, ErrCodeUnavailable, name+" already in progress: "+err.Error())
+			return
+		}
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+		}
+		stop()
+	default:
+		p := pprof.Lookup(name)
+		if p == nil {
+			h.writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "unknown profile "+strconv.Quote(name))
+			return
+		}
+		debug, _ := strconv.Atoi(query.Get("debug"))
+		if name == "heap" && query.Get("gc") != "" {
+			runtime.GC()
+		}
+		if debug > 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set(contentDispositionHeader, `attachment; filename="`+name+`"`)
+		}
+		_ = p.WriteTo(w, debug)
+	}
+}
@@ -0,0 +1,319 @@
+package gateway
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// QuotaConfig enables per-client usage accounting and quotas (Options.Quota).
+type QuotaConfig struct {
+	// ClientKey identifies the caller; default the remote IP (see Options.ClientIP). It must return verified
+	// identities: callers free to pick their key could dodge every quota with a fresh key per request. See
+	// QuotaAPIKey to account by API key.
+	ClientKey func(r *http.Request) string
+	// Limits are enforced independently; a request is rejected with 429 if any of them is exhausted.
+	Limits []QuotaLimit
+	// MaxClients caps the clients tracked at once; when a new client would exceed it, the one seen least
+	// recently is forgotten. Default 10000.
+	MaxClients int
+}
+
+// QuotaAPIKey returns a QuotaConfig.ClientKey that identifies callers by their X-API-Key header if valid
+// accepts the key, and by the remote IP otherwise. valid must check the key against the issued ones.
+func QuotaAPIKey(valid func(key string) bool) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if k := r.Header.Get(apiKeyHeader); k != "" && valid(k) {
+			return k
+		}
+		return remoteIP(r)
+	}
+}
+
+// QuotaLimit is a budget of calls and bytes (request plus response bodies) over a rolling window.
+type QuotaLimit struct {
+	Name     string        // reported in usage and errors, e.g. "daily"
+	Window   time.Duration // e.g. 24 * time.Hour
+	MaxCalls int64         // zero means unlimited
+	MaxBytes int64         // zero means unlimited
+}
+
+// QuotaUsage is a client's consumption within one QuotaLimit window.
+type QuotaUsage struct {
+	Name     string `json:"name"`
+	Window   string `json:"window"`
+	Calls    int64  `json:"calls"`
+	Bytes    int64  `json:"bytes"`
+	MaxCalls int64  `json:"max_calls,omitempty"`
+	MaxBytes int64  `json:"max_bytes,omitempty"`
+}
+
+const (
+	apiKeyHeader = "X-API-Key"
+	// quotaBuckets is the resolution of a rolling window: usage expires in steps of Window/quotaBuckets.
+	quotaBuckets = 24
+	// defaultMaxQuotaClients is the default QuotaConfig.MaxClients.
+	defaultMaxQuotaClients = 10000
+)
+
+type quotaBucket struct {
+	start        time.Time
+	calls, bytes int64
+}
+
+// clientUsage holds one bucket ring per configured limit.
+type clientUsage struct {
+	key      string
+	rings    [][quotaBuckets]quotaBucket
+	lastSeen time.Time
+	elem     *list.Element // in quotaTracker.recent
+}
+
+// quotaTracker accounts usage per client key. Clients idle for longer than the largest window are dropped.
+type quotaTracker struct {
+	cfg     QuotaConfig
+	metrics core.Metrics
+
+	mu        sync.Mutex
+	clients   map[string]*clientUsage
+	recent    *list.List // of *clientUsage, most recently seen first
+	maxWindow time.Duration
+	lastSweep time.Time
+}
+
+func newQuotaTracker(cfg QuotaConfig, metrics core.Metrics) *quotaTracker {
+	var limits []QuotaLimit
+	for _, l := range cfg.Limits {
+		if l.Window > 0 {
+			limits = append(limits, l)
+		}
+	}
+	cfg.Limits = limits
+	if cfg.MaxClients <= 0 {
+		cfg.MaxClients = defaultMaxQuotaClients
+	}
+	t := &quotaTracker{cfg: cfg, metrics: metrics, clients: make(map[string]*clientUsage), recent: list.New()}
+	for _, l := range cfg.Limits {
+		t.maxWindow = max(t.maxWindow, l.Window)
+	}
+	return t
+}
+
+// setLimits replaces the limits. Usage is kept for limits whose name and window are unchanged.
+func (t *quotaTracker) setLimits(limits []QuotaLimit) {
+	next := newQuotaTracker(QuotaConfig{Limits: limits}, t.metrics)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, u := range t.clients {
+		rings := make([][quotaBuckets]quotaBucket, len(next.cfg.Limits))
+		for i, l := range next.cfg.Limits {
+			for j, old := range t.cfg.Limits {
+				if old.Name == l.Name && old.Window == l.Window {
+					rings[i] = u.rings[j]
+					break
+				}
+			}
+		}
+		u.rings = rings
+	}
+	t.cfg.Limits = next.cfg.Limits
+	t.maxWindow = next.maxWindow
+}
+
+func quotaStep(window time.Duration) time.Duration {
+	return max(window/quotaBuckets, 1)
+}
+
+func (t *quotaTracker) clientKey(r *http.Request) string {
+	return clientKey(t.cfg.ClientKey, r)
+}
+
+// clientKey identifies the caller of r by key if set, else by the remote IP (see Options.ClientIP).
+func clientKey(key func(r *http.Request) string, r *http.Request) string {
+	if key != nil {
+		return key(r)
+	}
+	return remoteIP(r)
+}
+
+// hashClientKey is how usage reports name a client, so they do not disclose API keys.
+func hashClientKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// bucket returns the current bucket of ring i for now, resetting it if it belongs to an earlier period.
+func (t *quotaTracker) bucket(u *clientUsage, i int, now time.Time) *quotaBucket {
+	step := quotaStep(t.cfg.Limits[i].Window)
+	start := now.Truncate(step)
+	b := &u.rings[i][int(start.UnixNano()/int64(step))%quotaBuckets]
+	if !b.start.Equal(start) {
+		*b = quotaBucket{start: start}
+	}
+	return b
+}
+
+// usage sums ring i over the window ending at now and returns the time until the oldest counted bucket expires.
+func (t *quotaTracker) usage(u *clientUsage, i int, now time.Time) (calls, bytes int64, retryAfter time.Duration) {
+	l := t.cfg.Limits[i]
+	step := quotaStep(l.Window)
+	oldest := time.Time{}
+	for _, b := range u.rings[i] {
+		if b.start.IsZero() || !b.start.After(now.Add(-l.Window)) {
+			continue
+		}
+		calls += b.calls
+		bytes += b.bytes
+		if (b.calls > 0 || b.bytes > 0) && (oldest.IsZero() || b.start.Before(oldest)) {
+			oldest = b.start
+		}
+	}
+	if !oldest.IsZero() {
+		retryAfter = oldest.Add(l.Window + step).Sub(now)
+	}
+	return calls, bytes, retryAfter
+}
+
+// admit counts a call for key at now unless a limit is exhausted, in which case it returns that limit's
+// name and how long until usage drops.
+func (t *quotaTracker) admit(key string, now time.Time) (ok bool, limit string, retryAfter time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(now)
+	u := t.clients[key]
+	if u == nil {
+		if len(t.clients) >= t.cfg.MaxClients {
+			t.forgetLeastRecent()
+		}
+		u = &clientUsage{key: key, rings: make([][quotaBuckets]quotaBucket, len(t.cfg.Limits))}
+		u.elem = t.recent.PushFront(u)
+		t.clients[key] = u
+	} else {
+		t.recent.MoveToFront(u.elem)
+	}
+	u.lastSeen = now
+	for i, l := range t.cfg.Limits {
+		calls, bytes, wait := t.usage(u, i, now)
+		if (l.MaxCalls > 0 && calls >= l.MaxCalls) || (l.MaxBytes > 0 && bytes >= l.MaxBytes) {
+			t.metrics.Add("gateway_quota_rejections_total", 1, "limit", l.Name)
+			return false, l.Name, wait
+		}
+	}
+	for i := range t.cfg.Limits {
+		t.bucket(u, i, now).calls++
+	}
+	return true, "", 0
+}
+
+// addBytes charges n request/response bytes to key.
+func (t *quotaTracker) addBytes(key string, n int64, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.clients[key]
+	if u == nil {
+		return
+	}
+	for i := range t.cfg.Limits {
+		t.bucket(u, i, now).bytes += n
+	}
+}
+
+// forgetLeastRecent drops the client seen least recently to make room for a new one. t.mu must be held.
+func (t *quotaTracker) forgetLeastRecent() {
+	if el := t.recent.Back(); el != nil {
+		t.forget(el.Value.(*clientUsage))
+	}
+}
+
+// forget stops tracking u. t.mu must be held.
+func (t *quotaTracker) forget(u *clientUsage) {
+	t.recent.Remove(u.elem)
+	delete(t.clients, u.key)
+}
+
+// report returns usage per hashed client key (see hashClientKey) for all clients, or only for the one whose
+// key or hashed key is client if it is set.
+func (t *quotaTracker) report(client string, now time.Time) map[string][]QuotaUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string][]QuotaUsage)
+	for k, u := range t.clients {
+		hashed := hashClientKey(k)
+		if client != "" && k != client && hashed != client {
+			continue
+		}
+		usages := make([]QuotaUsage, 0, len(t.cfg.Limits))
+		for i, l := range t.cfg.Limits {
+			calls, bytes, _ := t.usage(u, i, now)
+			usages = append(usages, QuotaUsage{
+				Name: l.Name, Window: l.Window.String(),
+				Calls: calls, Bytes: bytes,
+				MaxCalls: l.MaxCalls, MaxBytes: l.MaxBytes,
+			})
+		}
+		out[hashed] = usages
+	}
+	return out
+}
+
+// sweep drops clients idle for longer than the largest window, at most once per bucket step.
+func (t *quotaTracker) sweep(now time.Time) {
+	if t.maxWindow <= 0 || now.Sub(t.lastSweep) < quotaStep(t.maxWindow) {
+		return
+	}
+	t.lastSweep = now
+	for el := t.recent.Back(); el != nil; el = t.recent.Back() {
+		u := el.Value.(*clientUsage)
+		if now.Sub(u.lastSeen) <= t.maxWindow {
+			break
+		}
+		t.forget(u)
+	}
+}
+
+type usageResponse struct {
+	Clients []clientUsageReport `json:"clients"`
+}
+
+type clientUsageReport struct {
+	Client string       `json:"client"`
+	Usage  []QuotaUsage `json:"usage"`
+}
+
+func (t *quotaTracker) usageResponse(key string, now time.Time) usageResponse {
+	byClient := t.report(key, now)
+	out := usageResponse{Clients: make([]clientUsageReport, 0, len(byClient))}
+	for k, u := range byClient {
+		out.Clients = append(out.Clients, clientUsageReport{Client: k, Usage: u})
+	}
+	sort.Slice(out.Clients, func(i, j int) bool { return out.Clients[i].Client < out.Clients[j].Client })
+	return out
+}
+
+// countingWriter counts response body bytes for quota accounting.
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// Flush flushes the underlying writer, if it can.
+func (cw *countingWriter) Flush() {
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. for EnableFullDuplex.
+func (cw *countingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+func TestGateway_Quota(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	clock := core.NewFakeClock(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	mux := http.NewServeMux()
+	h := Handler(Options{
+		Path:       "/grpc-gateway",
+		AdminToken: "s3cret",
+		Clock:      clock,
+		Quota: &QuotaConfig{
+			ClientKey: QuotaAPIKey(func(key string) bool { return key == "team-a" || key == "team-b" }),
+			Limits: []QuotaLimit{
+				{Name: "daily", Window: 24 * time.Hour, MaxCalls: 2},
+				{Name: "monthly", Window: 30 * 24 * time.Hour, MaxCalls: 100},
+			},
+		},
+	})
+	mux.Handle("/grpc-gateway", h)
+	mux.Handle("/grpc-gateway/", h)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	call := func(key string) (int, http.Header) {
+		t.Helper()
+		raw, _ := json.Marshal(map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}})
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway", strings.NewReader(encodeBase64V1(raw)))
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("do: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode, resp.Header
+	}
+
+	for i := 0; i < 2; i++ {
+		if code, _ := call("team-a"); code != http.StatusOK {
+			t.Fatalf("call %d: status %d", i, code)
+		}
+	}
+	code, hdr := call("team-a")
+	if code != http.StatusTooManyRequests || hdr.Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", code, hdr)
+	}
+	if code, _ := call("team-b"); code != http.StatusOK {
+		t.Fatalf("other client should be unaffected, got %d", code)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/grpc-gateway/admin/usage?client=team-a", nil)
+	req.Header.Set("X-Gateway-Admin-Token", "s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	var usage usageResponse
+	_ = json.NewDecoder(resp.Body).Decode(&usage)
+	resp.Body.Close()
+	if len(usage.Clients) != 1 || usage.Clients[0].Client != hashClientKey("team-a") {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+	daily := usage.Clients[0].Usage[0]
+	if daily.Name != "daily" || daily.Calls != 2 || daily.Bytes == 0 || daily.MaxCalls != 2 {
+		t.Fatalf("unexpected daily usage: %+v", daily)
+	}
+
+	// Unknown keys count against the remote IP, so a fresh key per request does not dodge the quota.
+	for i := 0; i < 2; i++ {
+		if code, _ := call(fmt.Sprintf("made-up-%d", i)); code != http.StatusOK {
+			t.Fatalf("unknown key call %d: status %d", i, code)
+		}
+	}
+	if code, _ := call("made-up-2"); code != http.StatusTooManyRequests {
+		t.Fatalf("unknown keys should share the caller's IP quota, got %d", code)
+	}
+
+	// The daily window rolls over; the monthly one still counts the earlier calls.
+	clock.Advance(25 * time.Hour)
+	if code, _ := call("team-a"); code != http.StatusOK {
+		t.Fatalf("after window: status %d", code)
+	}
+}
+
+func TestQuotaTracker_MaxClients(t *testing.T) {
+	tr := newQuotaTracker(QuotaConfig{MaxClients: 2, Limits: []QuotaLimit{{Name: "daily", Window: 24 * time.Hour, MaxCalls: 10}}}, core.NopMetrics())
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tr.admit("a", now)
+	tr.admit("b", now.Add(time.Second))
+	tr.admit("a", now.Add(2*time.Second))
+	tr.admit("c", now.Add(3*time.Second))
+	got := tr.report("", now.Add(3*time.Second))
+	if len(got) != 2 || got[hashClientKey("a")] == nil || got[hashClientKey("c")] == nil {
+		t.Fatalf("tracked clients = %v, want a and c", got)
+	}
+}
+
+func TestCountingWriter_Flush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	cw := &countingWriter{ResponseWriter: rec}
+	if _, err := cw.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := http.NewResponseController(cw).Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if !rec.Flushed || cw.n != 3 {
+		t.Fatalf("flushed = %v, n = %d; want true, 3", rec.Flushed, cw.n)
+	}
+}
@@ -0,0 +1,178 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// RawResponse writes a bytes field of the method's responses to the HTTP body as is, e.g. for file download
+// RPCs, instead of the JSON message with the field base64-encoded. Server-streaming methods, which are not
+// callable otherwise, write the field of each message as it arrives, so large files are not buffered. Raw
+// bodies bypass RenameFields, ResponseEnvelope and the response codec of X-Gateway-Encoding; streamed calls
+// are neither audited nor recorded. Methods returning google.api.HttpBody are answered this way without
+// configuration, with its data and content_type.
+type RawResponse struct {
+	// Field is the dotted JSON path of the bytes field, e.g. "chunk.data".
+	Field string
+	// ContentType of the body; default application/octet-stream. ResponseHeaders can set it, or e.g.
+	// Content-Disposition, from the response (the first message of a stream).
+	ContentType string
+	// ContentTypeField, if set, is the dotted JSON path of a string field holding the content type, which
+	// takes precedence over ContentType when the (first) message sets it.
+	ContentTypeField string
+}
+
+// httpBodyResponse is the RawResponse of methods returning google.api.HttpBody.
+var httpBodyResponse = &RawResponse{Field: "data", ContentTypeField: "contentType"}
+
+// jsonPathValue returns the value at the dotted path in resp, a JSON message; nil if unset.
+func jsonPathValue(resp []byte, path string) (any, error) {
+	var v any
+	if err := json.Unmarshal(resp, &v); err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("raw response field %s: %s is not a message", path, name)
+		}
+		if v = obj[name]; v == nil {
+			return nil, nil
+		}
+	}
+	return v, nil
+}
+
+// rawField returns the bytes of the field at path in resp, a JSON message; unset fields are empty.
+func rawField(resp []byte, path string) ([]byte, error) {
+	v, err := jsonPathValue(resp, path)
+	if v == nil || err != nil {
+		return nil, err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("raw response field %s is not a bytes field", path)
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// writeRawHeader writes the status line and headers of a raw response whose (first) message is resp, with
+// headers (from ResponseHeaders) taking precedence over the content type.
+func writeRawHeader(w http.ResponseWriter, raw *RawResponse, headers http.Header, resp []byte) {
+	contentType := raw.ContentType
+	if raw.ContentTypeField != "" {
+		if v, _ := jsonPathValue(resp, raw.ContentTypeField); v != nil {
+			if s, ok := v.(string); ok && s != "" {
+				contentType = s
+			}
+		}
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	for name, values := range headers {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeRaw answers a unary call with the raw field of its response resp.
+func (h *handler) writeRaw(w http.ResponseWriter, r *http.Request, raw *RawResponse, headers http.Header, resp []byte) {
+	body, err := rawField(resp, raw.Field)
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	writeRawHeader(w, raw, headers, resp)
+	_, _ = w.Write(body)
+}
+
+// streamRaw calls a server-streaming method and relays the raw field of each message, flushing after each.
+// It returns false, without answering, if the method is not server-streaming so the call goes the unary
+// way, or if raw is nil (methods without RawResponse) and the method does not stream google.api.HttpBody. Errors before the first message get a normal error response; later ones abort the response, so the
+// client sees a truncated transfer rather than a complete-looking file.
+func (h *handler) streamRaw(ctx context.Context, w http.ResponseWriter, r *http.Request, live *liveConfig, raw *RawResponse, data headerData, invokeReq core.InvokeRequest) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := h.inv.OpenServerStream(ctx, &invokeReq)
+	if errors.Is(err, core.ErrNotServerStreaming) {
+		return false
+	}
+	if raw == nil {
+		if err == nil && !core.IsHTTPBody(stream.OutputType()) {
+			return false
+		}
+		raw = httpBodyResponse
+	}
+	var denied *authorizationError
+	switch {
+	case err == nil:
+	case errors.As(err, &denied):
+		h.writeError(w, r, denied.status, denied.code, denied.msg)
+		return true
+	case errors.Is(err, core.ErrUnknownFields), errors.Is(err, core.ErrInvalidQuery), errors.Is(err, core.ErrUnsafeInt64), errors.Is(err, core.ErrInvalidBinding):
+		h.writeErrorResponse(w, r, http.StatusBadRequest, errorResponse{Error: err.Error(), Code: ErrCodeInvalidRequest, err: err})
+		return true
+	default:
+		h.writeInvokeError(w, r, err, nil)
+		return true
+	}
+
+	first, err := stream.Recv()
+	if err != nil && err != io.EOF {
+		h.writeInvokeError(w, r, err, nil)
+		return true
+	}
+	ended := err == io.EOF
+	if ended {
+		first = []byte("{}")
+	}
+	headers, err := live.responses.responseHeaders(data, first)
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return true
+	}
+	chunk, err := rawField(first, raw.Field)
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return true
+	}
+	rc := http.NewResponseController(w)
+	writeRawHeader(w, raw, headers, first)
+	flush := true
+	for !ended {
+		if _, err := w.Write(chunk); err != nil {
+			return true
+		}
+		if flush {
+			if err := rc.Flush(); err != nil {
+				// The body still arrives whole, only buffered; say so once rather than on every chunk.
+				flush = false
+				live.opts.logger().LogAttrs(ctx, slog.LevelWarn, "raw response stream cannot be flushed",
+					slog.String("method", data.Method), slog.String("error", err.Error()))
+			}
+		}
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return true
+		}
+		if err == nil {
+			chunk, err = rawField(msg, raw.Field)
+		}
+		if err != nil {
+			h.metrics.Add("gateway_raw_stream_errors_total", 1, "method", data.Method)
+			panic(http.ErrAbortHandler)
+		}
+	}
+	return true
+}
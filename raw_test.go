@@ -0,0 +1,195 @@
+package gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/builder"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// startFileServer serves acme.Files: Get returns a whole file and Download streams it in chunks of two
+// bytes, failing after the first chunk for the name "broken" and waiting for release after it for the name
+// "held". It returns the target and the descriptor set.
+func startFileServer(t *testing.T, content string, release <-chan struct{}) (string, []byte) {
+	t.Helper()
+	req := builder.NewMessage("FileRequest").AddField(builder.NewField("name", builder.FieldTypeString()))
+	file := builder.NewMessage("File").
+		AddField(builder.NewField("name", builder.FieldTypeString())).
+		AddField(builder.NewField("data", builder.FieldTypeBytes()))
+	chunk := builder.NewMessage("Chunk").AddField(builder.NewField("file", builder.FieldTypeMessage(file)))
+	svc := builder.NewService("Files").
+		AddMethod(builder.NewMethod("Get", builder.RpcTypeMessage(req, false), builder.RpcTypeMessage(file, false))).
+		AddMethod(builder.NewMethod("Download", builder.RpcTypeMessage(req, false), builder.RpcTypeMessage(chunk, true)))
+	fd, err := builder.NewFile("acme/files.proto").SetPackageName("acme").
+		AddMessage(req).AddMessage(file).AddMessage(chunk).AddService(svc).Build()
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	get := fd.FindService("acme.Files").FindMethodByName("Get")
+	download := fd.FindService("acme.Files").FindMethodByName("Download")
+	newFile := func(name, data string) *dynamic.Message {
+		f := dynamic.NewMessage(get.GetOutputType())
+		f.SetFieldByName("name", name)
+		f.SetFieldByName("data", []byte(data))
+		return f
+	}
+
+	s := grpc.NewServer()
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "acme.Files",
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Get",
+			Handler: func(_ any, _ context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				in := dynamic.NewMessage(get.GetInputType())
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return newFile(in.GetFieldByName("name").(string), content), nil
+			},
+		}},
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Download",
+			ServerStreams: true,
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				in := dynamic.NewMessage(download.GetInputType())
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				name := in.GetFieldByName("name").(string)
+				for i := 0; i < len(content); i += 2 {
+					if name == "broken" && i > 0 {
+						return status.Error(codes.DataLoss, "disk error")
+					}
+					if name == "held" && i > 0 {
+						<-release
+					}
+					out := dynamic.NewMessage(download.GetOutputType())
+					out.SetFieldByName("file", newFile(name, content[i:min(i+2, len(content))]))
+					if err := stream.SendMsg(out); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}},
+	}, struct{}{})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	set, err := proto.Marshal(desc.ToFileDescriptorSet(fd))
+	if err != nil {
+		t.Fatalf("marshal descriptor: %v", err)
+	}
+	return lis.Addr().String(), set
+}
+
+func TestGateway_RawResponse(t *testing.T) {
+	target, set := startFileServer(t, "hello raw", nil)
+	metrics := core.NewMemoryMetrics()
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", Metrics: metrics, Methods: map[string]MethodConfig{
+		"/acme.Files/Get": {
+			RawResponse:     &RawResponse{Field: "data", ContentType: "text/plain"},
+			ResponseHeaders: map[string]string{"Content-Disposition": `attachment; filename="{{.Response.name}}"`},
+		},
+		"/acme.Files/Download": {RawResponse: &RawResponse{Field: "file.data"}},
+	}}))
+	defer srv.Close()
+
+	call := func(method, name string) (*http.Response, string, error) {
+		t.Helper()
+		raw, _ := json.Marshal(map[string]any{
+			"target":     target,
+			"service":    "acme.Files",
+			"method":     method,
+			"descriptor": base64.StdEncoding.EncodeToString(set),
+			"params":     map[string]any{"name": name},
+		})
+		resp, err := http.Post(srv.URL+"/grpc-gateway", "text/plain", strings.NewReader(encodeBase64V1(raw)))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return resp, string(b), err
+	}
+
+	resp, body, err := call("Get", "report.txt")
+	if err != nil || resp.StatusCode != http.StatusOK || body != "hello raw" {
+		t.Fatalf("unary: status=%d body=%q err=%v", resp.StatusCode, body, err)
+	}
+	if ct, cd := resp.Header.Get("Content-Type"), resp.Header.Get("Content-Disposition"); ct != "text/plain" || cd != `attachment; filename="report.txt"` {
+		t.Fatalf("unary headers: Content-Type=%q Content-Disposition=%q", ct, cd)
+	}
+
+	resp, body, err = call("Download", "report.txt")
+	if err != nil || resp.StatusCode != http.StatusOK || body != "hello raw" {
+		t.Fatalf("stream: status=%d body=%q err=%v", resp.StatusCode, body, err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/octet-stream" {
+		t.Fatalf("stream Content-Type = %q", ct)
+	}
+
+	// A stream failing after the first chunk is cut off instead of ending normally.
+	resp, body, err = call("Download", "broken")
+	if err == nil || resp.StatusCode != http.StatusOK || body != "he" {
+		t.Fatalf("broken stream: status=%d body=%q err=%v", resp.StatusCode, body, err)
+	}
+	if got := metrics.Get("gateway_raw_stream_errors_total", "method", "/acme.Files/Download"); got != 1 {
+		t.Fatalf("gateway_raw_stream_errors_total = %v", got)
+	}
+}
+
+func TestGateway_RawResponseStreamWrappedWriter(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"quota":       {Quota: &QuotaConfig{Limits: []QuotaLimit{{Name: "daily", Window: 24 * time.Hour, MaxCalls: 100}}}},
+		"compression": {ResponseCompression: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			release := make(chan struct{})
+			defer close(release)
+			target, set := startFileServer(t, "hello raw", release)
+			opts.Path = "/grpc-gateway"
+			opts.Methods = map[string]MethodConfig{"/acme.Files/Download": {RawResponse: &RawResponse{Field: "file.data"}}}
+			srv := httptest.NewServer(Handler(opts))
+			defer srv.Close()
+
+			raw, _ := json.Marshal(map[string]any{
+				"target":     target,
+				"service":    "acme.Files",
+				"method":     "Download",
+				"descriptor": base64.StdEncoding.EncodeToString(set),
+				"params":     map[string]any{"name": "held"},
+			})
+			resp, err := (&http.Client{Timeout: 5 * time.Second}).Post(srv.URL+"/grpc-gateway", "text/plain", strings.NewReader(encodeBase64V1(raw)))
+			if err != nil {
+				t.Fatalf("post: %v", err)
+			}
+			defer resp.Body.Close()
+			// The upstream holds the rest of the file, so the first chunk can only arrive flushed.
+			buf := make([]byte, 2)
+			if _, err := io.ReadFull(resp.Body, buf); err != nil || string(buf) != "he" {
+				t.Fatalf("first chunk = %q, %v", buf, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// ReadinessConfig gates GET {Path}/ready on upstream connections and warm-up calls, so orchestrators do not
+// route traffic to a cold gateway. Preloaded descriptors are indexed before Handler returns. Checks run in the
+// background from Handler on and are retried until they pass; once passed they are not run again.
+type ReadinessConfig struct {
+	// Targets are the upstreams whose connections must be established; default DefaultTarget and the
+	// targets of Options.Targets other than "*".
+	Targets []string
+	// WarmUp are calls that must succeed, e.g. to fill upstream caches before the first request.
+	WarmUp []WarmUpCall
+	// Timeout bounds each connection attempt and warm-up call; default 5s.
+	Timeout time.Duration
+	// RetryInterval is the time between attempts of a failing check; default 1s.
+	RetryInterval time.Duration
+}
+
+// WarmUpCall is a unary call made before the gateway reports ready, see ReadinessConfig.
+type WarmUpCall struct {
+	Target string // default DefaultTarget
+	Method string // full method name, e.g. "/acme.Users/Get"
+	Body   []byte // JSON request message; empty sends the empty message
+}
+
+func (c ReadinessConfig) withDefaults(opts Options) ReadinessConfig {
+	if c.Targets == nil {
+		for target := range opts.Targets {
+			if target != "*" && target != opts.DefaultTarget {
+				c.Targets = append(c.Targets, target)
+			}
+		}
+		sort.Strings(c.Targets)
+		if opts.DefaultTarget != "" {
+			c.Targets = append([]string{opts.DefaultTarget}, c.Targets...)
+		}
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = time.Second
+	}
+	return c
+}
+
+// readinessCheck is the state of one check in GET {Path}/ready.
+type readinessCheck struct {
+	Name  string `json:"name"` // "descriptors", "target:{target}" or "warm_up:{method}"
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"` // of the latest failed attempt
+}
+
+type readinessResponse struct {
+	Ready  bool             `json:"ready"`
+	Checks []readinessCheck `json:"checks"`
+}
+
+// readiness runs the checks of ReadinessConfig and records their state.
+type readiness struct {
+	mu     sync.Mutex
+	checks []readinessCheck
+}
+
+// startReadiness runs the checks of cfg, each in its own goroutine until it passes. The descriptors check
+// passes at once: newHandler has already preloaded them, or panicked.
+func (h *handler) startReadiness(cfg ReadinessConfig) *readiness {
+	cfg = cfg.withDefaults(h.opts)
+	rd := &readiness{checks: []readinessCheck{{Name: "descriptors", Ready: true}}}
+	ctx := core.ContextWithClock(context.Background(), core.ClockFromContext(context.Background(), h.opts.Clock))
+	for _, target := range cfg.Targets {
+		rd.run(ctx, cfg, "target:"+target, func(ctx context.Context) error {
+			return h.inv.Connect(ctx, target)
+		})
+	}
+	for _, call := range cfg.WarmUp {
+		target := call.Target
+		if target == "" {
+			target = h.opts.DefaultTarget
+		}
+		rd.run(ctx, cfg, "warm_up:"+call.Method, func(ctx context.Context) error {
+			_, err := h.inv.Invoke(ctx, &core.InvokeRequest{Target: target, FullMethodName: call.Method, Body: call.Body})
+			return err
+		})
+	}
+	return rd
+}
+
+// run adds the check name and retries attempt until it succeeds.
+func (rd *readiness) run(ctx context.Context, cfg ReadinessConfig, name string, attempt func(ctx context.Context) error) {
+	rd.mu.Lock()
+	i := len(rd.checks)
+	rd.checks = append(rd.checks, readinessCheck{Name: name})
+	rd.mu.Unlock()
+	go func() {
+		clock := core.ClockFromContext(ctx, nil)
+		for {
+			actx, cancel := core.WithTimeout(ctx, clock, cfg.Timeout)
+			err := attempt(actx)
+			cancel()
+			rd.mu.Lock()
+			rd.checks[i].Ready = err == nil
+			rd.checks[i].Error = ""
+			if err != nil {
+				rd.checks[i].Error = err.Error()
+			}
+			rd.mu.Unlock()
+			if err == nil {
+				return
+			}
+			_ = core.Sleep(ctx, clock, cfg.RetryInterval)
+		}
+	}()
+}
+
+func (rd *readiness) snapshot() readinessResponse {
+	out := readinessResponse{Ready: true, Checks: []readinessCheck{}}
+	if rd == nil {
+		return out
+	}
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	for _, c := range rd.checks {
+		out.Ready = out.Ready && c.Ready
+		out.Checks = append(out.Checks, c)
+	}
+	return out
+}
+
+// serveReady handles GET {Path}/ready: 200 once every check of Options.Readiness has passed, 503 before,
+// with the state of each check. Without Options.Readiness the gateway is ready as soon as it serves.
+func (h *handler) serveReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		h.rejectRoute(w, r, "GET, HEAD")
+		return
+	}
+	out := h.readiness.snapshot()
+	code := http.StatusOK
+	if !out.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if r.Method == http.MethodGet {
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
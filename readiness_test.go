@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGateway_Readiness(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	get := func(srv *httptest.Server) (int, readinessResponse) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + "/grpc-gateway/ready")
+		if err != nil {
+			t.Fatalf("get ready: %v", err)
+		}
+		defer resp.Body.Close()
+		var out readinessResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.StatusCode, out
+	}
+	waitFor := func(srv *httptest.Server, done func(code int, out readinessResponse) bool) readinessResponse {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			code, out := get(srv)
+			if done(code, out) {
+				return out
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("status=%d checks=%+v", code, out.Checks)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	t.Run("unconfigured", func(t *testing.T) {
+		srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway"}))
+		defer srv.Close()
+		if code, out := get(srv); code != http.StatusOK || !out.Ready {
+			t.Fatalf("status=%d out=%+v", code, out)
+		}
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", DefaultTarget: target, Readiness: &ReadinessConfig{
+			WarmUp: []WarmUpCall{{Method: "/echo.EchoService/Echo", Body: []byte(`{"message":"warm"}`)}},
+		}}))
+		defer srv.Close()
+		out := waitFor(srv, func(code int, out readinessResponse) bool { return code == http.StatusOK })
+		var names []string
+		for _, c := range out.Checks {
+			names = append(names, c.Name)
+		}
+		if len(names) != 3 || names[0] != "descriptors" || names[1] != "target:"+target || names[2] != "warm_up:/echo.EchoService/Echo" {
+			t.Fatalf("checks = %v", names)
+		}
+	})
+
+	t.Run("failing warm-up", func(t *testing.T) {
+		srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", DefaultTarget: target, Readiness: &ReadinessConfig{
+			WarmUp:        []WarmUpCall{{Method: "/echo.EchoService/Missing"}},
+			RetryInterval: 10 * time.Millisecond,
+		}}))
+		defer srv.Close()
+		// The connection is established while the warm-up call keeps failing.
+		waitFor(srv, func(code int, out readinessResponse) bool {
+			return code == http.StatusServiceUnavailable && !out.Ready && out.Checks[1].Ready && out.Checks[2].Error != ""
+		})
+	})
+}
@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// liveConfig is the configuration snapshot a request runs with. Reloads swap in a new snapshot, so in-flight
+// requests finish with the settings they started with.
+type liveConfig struct {
+	opts      Options
+	responses *responseTransformer
+	authz     *authorizer
+	visible   *fieldVisibility
+}
+
+func newLiveConfig(opts Options) *liveConfig {
+	return &liveConfig{opts: opts, responses: newResponseTransformer(opts), authz: newAuthorizer(opts), visible: newFieldVisibility(opts)}
+}
+
+// err reports the method templates and rules that fail to compile.
+func (c *liveConfig) err() error {
+	return errors.Join(joinSorted(c.responses.errs), joinSorted(c.authz.errs), joinSorted(c.visible.errs))
+}
+
+// joinSorted joins the errors of m in key order.
+func joinSorted(m map[string]error) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	errs := make([]error, 0, len(keys))
+	for _, k := range keys {
+		errs = append(errs, m[k])
+	}
+	return errors.Join(errs...)
+}
+
+// methodPolicies splits Options.Methods into the invoker's per-method settings.
+func methodPolicies(methods map[string]MethodConfig) (map[string]time.Duration, map[string]core.ShadowConfig, map[string]core.HedgeConfig, map[string]bool) {
+	timeouts := make(map[string]time.Duration, len(methods))
+	shadows := make(map[string]core.ShadowConfig, len(methods))
+	hedges := make(map[string]core.HedgeConfig, len(methods))
+	coalesce := make(map[string]bool, len(methods))
+	for name, mc := range methods {
+		timeouts[name] = mc.Timeout
+		shadows[name] = mc.Shadow
+		hedges[name] = mc.Hedge
+		coalesce[name] = mc.Coalesce
+	}
+	return timeouts, shadows, hedges, coalesce
+}
+
+// reload calls Options.Reload and applies the reloadable settings of its result: AllowedTargets, Methods,
+// AdminToken, DescriptorWriteToken, Signature, Encryption and the Quota limits (if Quota was enabled). A result whose method
+// templates or rules do not compile is rejected and the current configuration stays in effect. An applied
+// reload also flushes the methods and files read from the descriptor directory (see Invoker.FlushMethods).
+func (h *handler) reload() (err error) {
+	h.reloadMu.Lock()
+	defer h.reloadMu.Unlock()
+	defer func() {
+		outcome := "ok"
+		if err != nil {
+			outcome = "error"
+		}
+		h.metrics.Add("gateway_config_reloads_total", 1, "outcome", outcome)
+		if h.opts.OnReload != nil {
+			h.opts.OnReload(err)
+		}
+	}()
+
+	next, err := h.opts.Reload()
+	if err != nil {
+		return fmt.Errorf("reload: %w", err)
+	}
+	opts := h.opts
+	opts.AllowedTargets = next.AllowedTargets
+	opts.Methods = next.Methods
+	opts.AdminToken = next.AdminToken
+	opts.DescriptorWriteToken = next.DescriptorWriteToken
+	opts.versionDeprecation = next.versionDeprecation
+	opts.Signature = next.Signature
+	opts.Encryption = next.Encryption
+	if h.quota != nil {
+		opts.Quota = next.Quota
+	}
+	live := newLiveConfig(opts)
+	if err := live.err(); err != nil {
+		return fmt.Errorf("reload: %w", err)
+	}
+
+	h.inv.SetMethodPolicies(methodPolicies(opts.Methods))
+	h.inv.FlushMethods()
+	if h.quota != nil {
+		var limits []QuotaLimit
+		if opts.Quota != nil {
+			limits = opts.Quota.Limits
+		}
+		h.quota.setLimits(limits)
+	}
+	h.live.Store(live)
+	return nil
+}
+
+// reloadOnSIGHUP reloads the configuration whenever the process receives SIGHUP.
+func (h *handler) reloadOnSIGHUP() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			_ = h.reload() // reported through OnReload and gateway_config_reloads_total
+		}
+	}()
+}
@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+func TestGateway_Reload(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	var next atomic.Pointer[Options]
+	next.Store(&Options{AdminToken: "admin"})
+	var reloads []error
+	srv := httptest.NewServer(Handler(Options{
+		Path:       "/grpc-gateway",
+		AdminToken: "admin",
+		Reload: func() (Options, error) {
+			if o := next.Load(); o != nil {
+				return *o, nil
+			}
+			return Options{}, errors.New("config unavailable")
+		},
+		OnReload: func(err error) { reloads = append(reloads, err) },
+	}))
+	defer srv.Close()
+
+	reload := func(token string) int {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/admin/reload", nil)
+		req.Header.Set("X-Gateway-Admin-Token", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("reload: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	call := func() int {
+		code, _ := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+		return code
+	}
+
+	if code := call(); code != http.StatusOK {
+		t.Fatalf("before reload: status=%d", code)
+	}
+	next.Store(&Options{
+		AdminToken:     "rotated",
+		AllowedTargets: []string{"users:9000"},
+		Methods:        map[string]MethodConfig{"*": {Timeout: time.Second}},
+	})
+	if code := reload("admin"); code != http.StatusOK {
+		t.Fatalf("reload: status=%d", code)
+	}
+	if code := call(); code != http.StatusForbidden {
+		t.Fatalf("after reload: status=%d, want 403 for a target no longer allowed", code)
+	}
+	if code := reload("admin"); code != http.StatusForbidden {
+		t.Fatalf("old admin token still accepted: status=%d", code)
+	}
+
+	// A configuration that does not compile is rejected as a whole.
+	next.Store(&Options{AdminToken: "other", Methods: map[string]MethodConfig{"*": {Authorize: "request.("}}})
+	if code := reload("rotated"); code != http.StatusBadRequest {
+		t.Fatalf("invalid reload: status=%d", code)
+	}
+	next.Store(nil)
+	if code := reload("rotated"); code != http.StatusBadRequest {
+		t.Fatalf("failing loader: status=%d", code)
+	}
+	if len(reloads) != 3 || reloads[0] != nil || reloads[1] == nil || reloads[2] == nil {
+		t.Fatalf("OnReload calls = %v", reloads)
+	}
+}
+
+func TestQuotaTracker_SetLimitsKeepsUsage(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tr := newQuotaTracker(QuotaConfig{Limits: []QuotaLimit{{Name: "minute", Window: time.Minute, MaxCalls: 2}}}, core.NopMetrics())
+	tr.admit("c", now)
+	tr.admit("c", now)
+	tr.setLimits([]QuotaLimit{{Name: "hourly", Window: time.Hour, MaxCalls: 10}, {Name: "minute", Window: time.Minute, MaxCalls: 3}})
+	if ok, _, _ := tr.admit("c", now); !ok {
+		t.Fatal("raised limit not applied")
+	}
+	if ok, limit, _ := tr.admit("c", now); ok || limit != "minute" {
+		t.Fatalf("usage of the unchanged limit was lost: ok=%v limit=%q", ok, limit)
+	}
+}
+
+func TestGateway_ReloadRotatesSignatureKeys(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	signature := func(keyID, secret string) *SignatureConfig {
+		return &SignatureConfig{Keys: func(id string) ([]byte, bool) { return []byte(secret), id == keyID }}
+	}
+	var next atomic.Pointer[Options]
+	next.Store(&Options{AdminToken: "admin", Signature: signature("k2", "new")})
+	srv := httptest.NewServer(Handler(Options{
+		Path:       "/grpc-gateway",
+		AdminToken: "admin",
+		Signature:  signature("k1", "old"),
+		Reload:     func() (Options, error) { return *next.Load(), nil },
+	}))
+	defer srv.Close()
+
+	call := func(keyID, secret string) error {
+		_, err := NewClient(srv.URL+"/grpc-gateway", WithSignature(keyID, []byte(secret))).InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", json.RawMessage(`{"message":"hi"}`))
+		return err
+	}
+	if err := call("k1", "old"); err != nil {
+		t.Fatalf("before reload: %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/admin/reload", nil)
+	req.Header.Set(adminTokenHeader, "admin")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("reload: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if err := call("k1", "old"); err == nil {
+		t.Fatal("retired key still accepted after reload")
+	}
+	if err := call("k2", "new"); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// Recording is a captured gateway request together with every clock reading and random value
+// observed while serving it. Replaying it pins those values so the gateway-side behavior is reproducible.
+type Recording struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body"` // raw (still encoded) HTTP body
+
+	Times []time.Time `json:"times,omitempty"` // Clock.Now results, in call order
+	Rands []int64     `json:"rands,omitempty"` // Rand.Int63 results, in call order
+
+	Status   int    `json:"status"`
+	Response []byte `json:"response"`
+}
+
+// Capture returns Handler(opts) wrapped so that every request is recorded and passed to sink once served.
+func Capture(opts Options, sink func(*Recording)) http.Handler {
+	h := Handler(opts)
+	clock := opts.Clock
+	if clock == nil {
+		clock = core.SystemClock()
+	}
+	rnd := opts.Rand
+	if rnd == nil {
+		rnd = core.SystemRand()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "read body: "+err.Error())
+			return
+		}
+		rec := &Recording{
+			Method: r.Method,
+			URL:    r.URL.String(),
+			Header: r.Header.Clone(),
+			Body:   body,
+		}
+		rc := &recordingClock{clock: clock, rec: rec}
+		rr := &recordingRand{rand: rnd, rec: rec}
+		ctx := core.ContextWithRand(core.ContextWithClock(r.Context(), rc), rr)
+		r = r.WithContext(ctx)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		cw := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(cw, r)
+
+		rec.Status = cw.status
+		rec.Response = cw.buf.Bytes()
+		sink(rec)
+	})
+}
+
+// Replay serves rec again through h, a gateway Handler built once and reused across replays, with the clock
+// and randomness pinned to the recorded values. It returns an error if the replay consumed more or fewer clock
+// readings or random values than were recorded, which means gateway behavior diverged from the original request.
+func Replay(h http.Handler, rec *Recording) (*httptest.ResponseRecorder, error) {
+	r := httptest.NewRequest(rec.Method, rec.URL, bytes.NewReader(rec.Body))
+	for k, v := range rec.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	rc := &replayClock{times: rec.Times}
+	rr := &replayRand{values: rec.Rands}
+	r = r.WithContext(core.ContextWithRand(core.ContextWithClock(r.Context(), rc), rr))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if rc.overrun > 0 || rr.overrun > 0 {
+		return w, fmt.Errorf("replay diverged: %d extra clock readings, %d extra random values", rc.overrun, rr.overrun)
+	}
+	if unusedTimes, unusedRands := rc.unused(), rr.unused(); unusedTimes > 0 || unusedRands > 0 {
+		return w, fmt.Errorf("replay diverged: %d clock readings, %d random values recorded but not used", unusedTimes, unusedRands)
+	}
+	return w, nil
+}
+
+type recordingClock struct {
+	mu    sync.Mutex
+	clock core.Clock
+	rec   *Recording
+}
+
+func (c *recordingClock) Now() time.Time {
+	t := c.clock.Now()
+	c.mu.Lock()
+	c.rec.Times = append(c.rec.Times, t)
+	c.mu.Unlock()
+	return t
+}
+
+// AfterFunc is not recorded: timers only schedule work, the observable times come from Now.
+func (c *recordingClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return c.clock.AfterFunc(d, f)
+}
+
+type recordingRand struct {
+	mu   sync.Mutex
+	rand core.Rand
+	rec  *Recording
+}
+
+func (r *recordingRand) Int63() int64 {
+	v := r.rand.Int63()
+	r.mu.Lock()
+	r.rec.Rands = append(r.rec.Rands, v)
+	r.mu.Unlock()
+	return v
+}
+
+type replayClock struct {
+	mu      sync.Mutex
+	times   []time.Time
+	next    int
+	overrun int
+}
+
+func (c *replayClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next < len(c.times) {
+		t := c.times[c.next]
+		c.next++
+		return t
+	}
+	c.overrun++
+	if len(c.times) > 0 {
+		return c.times[len(c.times)-1]
+	}
+	return time.Time{}
+}
+
+// unused returns how many recorded times were never read.
+func (c *replayClock) unused() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.times) - c.next
+}
+
+// AfterFunc uses real timers during replay so that recorded deadlines still bound upstream calls.
+func (c *replayClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+type replayRand struct {
+	mu      sync.Mutex
+	values  []int64
+	next    int
+	overrun int
+}
+
+func (r *replayRand) Int63() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.next < len(r.values) {
+		v := r.values[r.next]
+		r.next++
+		return v
+	}
+	r.overrun++
+	return 0
+}
+
+// unused returns how many recorded values were never read.
+func (r *replayRand) unused() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.values) - r.next
+}
+
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *captureWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureReplay_PinsRequestID(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	opts := Options{Timeout: 5 * time.Second}
+
+	var rec *Recording
+	srv := httptest.NewServer(Capture(opts, func(r *Recording) { rec = r }))
+	defer srv.Close()
+
+	raw, _ := json.Marshal(map[string]any{
+		"target": target,
+		"method": "/echo.EchoService/Echo",
+		"body":   map[string]any{"message": "Replay"},
+	})
+	resp, err := http.Post(srv.URL, "application/json", bytes.NewBufferString(encodeBase64V1(raw)))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	_ = resp.Body.Close()
+	if rec == nil {
+		t.Fatalf("no recording captured")
+	}
+	if len(rec.Rands) == 0 {
+		t.Fatalf("expected request ID randomness to be recorded")
+	}
+
+	// Round-trip through JSON to make sure recordings can be persisted as fixtures.
+	b, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatalf("marshal recording: %v", err)
+	}
+	var loaded Recording
+	if err := json.Unmarshal(b, &loaded); err != nil {
+		t.Fatalf("unmarshal recording: %v", err)
+	}
+
+	w, err := Replay(Handler(opts), &loaded)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if w.Code != rec.Status {
+		t.Fatalf("status mismatch: got %d, want %d", w.Code, rec.Status)
+	}
+	if got, want := w.Header().Get(requestIDHeader), resp.Header.Get(requestIDHeader); got != want {
+		t.Fatalf("request ID mismatch: got %q, want %q", got, want)
+	}
+	if !bytes.Equal(w.Body.Bytes(), rec.Response) {
+		t.Fatalf("response mismatch: got %s, want %s", w.Body.String(), string(rec.Response))
+	}
+
+	// A replay that leaves recorded values unread diverged as much as one that runs out of them.
+	extra := loaded
+	extra.Rands = append(append([]int64(nil), loaded.Rands...), 42)
+	if _, err := Replay(Handler(opts), &extra); err == nil || !strings.Contains(err.Error(), "not used") {
+		t.Fatalf("replay with an unused random value: err = %v", err)
+	}
+	extra = loaded
+	extra.Times = append(append([]time.Time(nil), loaded.Times...), time.Now())
+	if _, err := Replay(Handler(opts), &extra); err == nil || !strings.Contains(err.Error(), "not used") {
+		t.Fatalf("replay with an unused clock reading: err = %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// methodConfig returns the Options.Methods entry for fullMethod, falling back to the "*" entry.
+func (o Options) methodConfig(fullMethod string) MethodConfig {
+	if mc, ok := o.Methods[fullMethod]; ok {
+		return mc
+	}
+	return o.Methods["*"]
+}
+
+// unknownFieldPolicy returns the UnknownFields policy for fullMethod: the method's own, else Options.UnknownFields.
+func (o Options) unknownFieldPolicy(fullMethod string) core.UnknownFieldPolicy {
+	if p := o.methodConfig(fullMethod).UnknownFields; p != "" {
+		return p
+	}
+	return o.UnknownFields
+}
+
+// fullMethodName returns "/package.Service/Method" for req as far as it can be told before resolution.
+func (req *gatewayRequest) fullMethodName() string {
+	m := req.Method
+	if m == "" {
+		m = req.FullMethodNameAlt
+	}
+	if strings.HasPrefix(m, "/") || req.Service == "" {
+		return m
+	}
+	return "/" + req.Service + "/" + m
+}
+
+// envelopeData is the value ResponseEnvelope templates are executed with.
+type envelopeData struct {
+	Data      json.RawMessage
+	RequestID string
+	Method    string
+	Target    string
+}
+
+var envelopeFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// headerData is the value ResponseHeaders templates are executed with.
+type headerData struct {
+	Response  any         // the upstream response JSON, decoded
+	Header    http.Header // of the HTTP request
+	RequestID string
+	Method    string
+	Target    string
+}
+
+// responseTransformer applies per-method response renaming, envelopes and headers; templates are parsed once
+// in Handler, which panics if one fails to parse (see err), and again on reloads, which reject them.
+type responseTransformer struct {
+	envelopes map[string]*template.Template            // by Options.Methods key
+	headers   map[string]map[string]*template.Template // by Options.Methods key, then header name
+	mocks     map[string]*template.Template            // MockConfig.Response by Options.Methods key
+	errs      map[string]error
+}
+
+func newResponseTransformer(opts Options) *responseTransformer {
+	t := &responseTransformer{envelopes: make(map[string]*template.Template), headers: make(map[string]map[string]*template.Template), mocks: make(map[string]*template.Template), errs: make(map[string]error)}
+	for name, mc := range opts.Methods {
+		var errs []error
+		if mc.ResponseEnvelope != "" {
+			tmpl, err := template.New(name).Funcs(envelopeFuncs).Parse(mc.ResponseEnvelope)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("response envelope for %s: %w", name, err))
+			}
+			t.envelopes[name] = tmpl
+		}
+		for header, value := range mc.ResponseHeaders {
+			tmpl, err := template.New(name + " " + header).Funcs(envelopeFuncs).Option("missingkey=zero").Parse(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("response header %s for %s: %w", header, name, err))
+			}
+			if t.headers[name] == nil {
+				t.headers[name] = make(map[string]*template.Template)
+			}
+			t.headers[name][header] = tmpl
+		}
+		if mc.Mock != nil {
+			if _, ok := grpcCodeByName(mc.Mock.ErrorCode); !ok {
+				errs = append(errs, fmt.Errorf("mock for %s: unknown gRPC code %q", name, mc.Mock.ErrorCode))
+			}
+			if mc.Mock.Response != "" {
+				tmpl, err := template.New(name + " mock").Funcs(envelopeFuncs).Parse(mc.Mock.Response)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("mock response for %s: %w", name, err))
+				}
+				t.mocks[name] = tmpl
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			t.errs[name] = err
+		}
+	}
+	return t
+}
+
+// err reports the templates that fail to parse.
+func (t *responseTransformer) err() error {
+	return joinSorted(t.errs)
+}
+
+// responseHeaders renders the ResponseHeaders of data.Method: those of the "*" entry, replaced by name by the
+// method's own. Headers rendering as empty are left out.
+func (t *responseTransformer) responseHeaders(data headerData, resp []byte) (http.Header, error) {
+	for _, key := range []string{"*", data.Method} {
+		if err := t.errs[key]; err != nil && t.headers[key] != nil {
+			return nil, err
+		}
+	}
+	templates := maps.Clone(t.headers["*"])
+	if own := t.headers[data.Method]; len(own) > 0 {
+		if templates == nil {
+			templates = make(map[string]*template.Template, len(own))
+		}
+		maps.Copy(templates, own)
+	}
+	if len(templates) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(resp))
+	dec.UseNumber()
+	if err := dec.Decode(&data.Response); err != nil {
+		return nil, fmt.Errorf("response headers: %w", err)
+	}
+	out := make(http.Header, len(templates))
+	var buf bytes.Buffer
+	for name, tmpl := range templates {
+		buf.Reset()
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("response header %s: %w", name, err)
+		}
+		if v := strings.TrimSpace(buf.String()); v != "" && v != "<no value>" {
+			out.Set(name, v)
+		}
+	}
+	return out, nil
+}
+
+// transform rewrites a successful upstream response according to the method's configuration.
+func (t *responseTransformer) transform(opts Options, data envelopeData) ([]byte, error) {
+	key := data.Method
+	if _, ok := opts.Methods[key]; !ok {
+		key = "*"
+	}
+	mc := opts.Methods[key]
+	if err := t.errs[key]; err != nil {
+		return nil, err
+	}
+
+	if len(mc.RenameFields) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(data.Data))
+		dec.UseNumber()
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, fmt.Errorf("rename fields: %w", err)
+		}
+		for path, name := range mc.RenameFields {
+			renameField(v, strings.Split(path, "."), name)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("rename fields: %w", err)
+		}
+		data.Data = b
+	}
+
+	tmpl := t.envelopes[key]
+	if tmpl == nil {
+		return data.Data, nil
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("response envelope: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("response envelope for %s produced invalid JSON", data.Method)
+	}
+	return buf.Bytes(), nil
+}
+
+// renameField renames the field at path (relative to v) to name, descending through objects and arrays.
+func renameField(v any, path []string, name string) {
+	switch x := v.(type) {
+	case []any:
+		for _, e := range x {
+			renameField(e, path, name)
+		}
+	case map[string]any:
+		if len(path) == 1 {
+			if val, ok := x[path[0]]; ok {
+				delete(x, path[0])
+				x[name] = val
+			}
+			return
+		}
+		if next, ok := x[path[0]]; ok {
+			renameField(next, path[1:], name)
+		}
+	}
+}
+
+// writeTaggedResponseBody is writeResponseBody for methods with MethodConfig.ETag: it sends the strong ETag of
+// the representation, and answers 304 with no body if If-None-Match lists it. Encrypted (aesgcm) responses
+// get a weak tag of their plaintext instead, see bodyCipher.entityTag.
+func (h *handler) writeTaggedResponseBody(w http.ResponseWriter, r *http.Request, plain []byte) {
+	body, err := encodeResponseBody(w, r, plain)
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	coding := responseContentCoding(r, w.Header(), len(body))
+	etag := strongETag(coding, body)
+	if codec, _ := r.Context().Value(requestCodecKey{}).(*requestCodec); codec != nil && codec.cipher != nil && responseEncoding(r) == EncodingAESGCM {
+		etag = codec.cipher.entityTag(coding, plain)
+	}
+	w.Header().Set(etagHeader, etag)
+	// The body depends on these request headers through its codec and content coding.
+	addVary(w.Header(), "Accept-Encoding", encodingHeader, symmetricResponseHeader, encryptionKeyIDHeader)
+	if inm := r.Header.Get(ifNoneMatchHeader); inm != "" && !noneMatch(inm, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body)
+}
+
+// strongETag returns the strong entity tag of a response body sent with the content coding coding, so
+// that compressed and uncompressed representations get different tags.
+func strongETag(coding string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(coding))
+	h.Write([]byte{0})
+	h.Write(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:18]) + `"`
+}
+
+// addVary adds names to the Vary header of h unless it lists them already.
+func addVary(h http.Header, names ...string) {
+	for _, name := range names {
+		if !slices.ContainsFunc(h.Values("Vary"), func(v string) bool { return strings.EqualFold(v, name) }) {
+			h.Add("Vary", name)
+		}
+	}
+}
+
+// noneMatch reports whether the If-None-Match header value ifNoneMatch fails to match etag, using the weak
+// comparison RFC 9110 prescribes for it: "*" or any listed tag, with or without W/, matches.
+func noneMatch(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,286 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGateway_ResponseEnvelopeAndRename(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	srv := httptest.NewServer(Handler(Options{Methods: map[string]MethodConfig{
+		"/echo.EchoService/Echo": {
+			RenameFields:     map[string]string{"message": "msg"},
+			ResponseEnvelope: `{"code":0,"data":{{.Data}},"request_id":{{json .RequestID}},"method":{{json .Method}}}`,
+		},
+	}}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{
+		"target": target,
+		"method": "/echo.EchoService/Echo",
+		"body":   map[string]any{"message": "hi"},
+	}, map[string]string{"X-Request-Id": "req-1"})
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	var out struct {
+		Code      int               `json:"code"`
+		Data      map[string]string `json:"data"`
+		RequestID string            `json:"request_id"`
+		Method    string            `json:"method"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("unmarshal %s: %v", b, err)
+	}
+	if out.Code != 0 || out.Data["msg"] != "hi" || out.RequestID != "req-1" || out.Method != "/echo.EchoService/Echo" {
+		t.Fatalf("unexpected envelope: %s", b)
+	}
+}
+
+func TestGateway_ResponseEnvelopeInvalidJSON(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	srv := httptest.NewServer(Handler(Options{Methods: map[string]MethodConfig{
+		"*": {ResponseEnvelope: `{"data":{{.Data}}`},
+	}}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo"}, nil)
+	if code != http.StatusInternalServerError || !strings.Contains(string(b), "invalid JSON") {
+		t.Fatalf("expected 500 invalid JSON, got %d %s", code, b)
+	}
+}
+
+func TestGateway_ResponseHeaders(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+
+	srv := httptest.NewServer(Handler(Options{Methods: map[string]MethodConfig{
+		"*": {ResponseHeaders: map[string]string{
+			"X-Content-Type-Options": "nosniff",
+			"Cache-Control":          "no-store",
+		}},
+		"/echo.EchoService/Echo": {ResponseHeaders: map[string]string{
+			"Cache-Control": "public, max-age=60",
+			"X-Echo":        "{{.Response.message}}",
+			"X-Tenant":      `{{.Header.Get "X-Tenant"}}`,
+			"X-Served-By":   "gateway {{.Target}}",
+		}},
+	}}))
+	defer srv.Close()
+
+	call := func(tenant string) http.Header {
+		t.Helper()
+		raw, _ := json.Marshal(map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}})
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(encodeBase64V1(raw)))
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status=%d", resp.StatusCode)
+		}
+		return resp.Header
+	}
+
+	h := call("acme")
+	for name, want := range map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "public, max-age=60",
+		"X-Echo":                 "hi",
+		"X-Tenant":               "acme",
+		"X-Served-By":            "gateway " + target,
+	} {
+		if got := h.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if h := call(""); len(h.Values("X-Tenant")) != 0 {
+		t.Fatalf("empty header sent: %q", h.Values("X-Tenant"))
+	}
+
+	// Invalid templates fail Handler rather than every matching response.
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "X-Bad") {
+			t.Fatalf("invalid template: recover() = %v", r)
+		}
+	}()
+	Handler(Options{Methods: map[string]MethodConfig{"*": {ResponseHeaders: map[string]string{"X-Bad": "{{.Response"}}}})
+}
+
+func TestGateway_ETag(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", Methods: map[string]MethodConfig{"/echo.EchoService/Echo": {ETag: true}}}))
+	defer srv.Close()
+
+	call := func(message, ifNoneMatch string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/echo.EchoService/Echo", strings.NewReader(`{"message":"`+message+`"}`))
+		req.Header.Set(targetHeader, target)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+
+	resp, _ := call("hi", "")
+	etag := resp.Header.Get("ETag")
+	if vary := resp.Header.Values("Vary"); resp.StatusCode != http.StatusOK || !strings.HasPrefix(etag, `"`) || !slices.Equal(vary, []string{"Accept-Encoding", encodingHeader, symmetricResponseHeader, encryptionKeyIDHeader}) {
+		t.Fatalf("status=%d etag=%q vary=%q", resp.StatusCode, etag, vary)
+	}
+	if again, _ := call("hi", ""); again.Header.Get("ETag") != etag {
+		t.Fatalf("etag changed for the same response: %q", again.Header.Get("ETag"))
+	}
+	resp, body := call("hi", `"other", W/`+etag)
+	if resp.StatusCode != http.StatusNotModified || body != "" || resp.Header.Get("ETag") != etag {
+		t.Fatalf("matching If-None-Match: status=%d body=%q", resp.StatusCode, body)
+	}
+	if resp, _ := call("changed", etag); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Fatalf("changed response: status=%d etag=%q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+}
+
+func TestGateway_ETagCompressed(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+	srv := httptest.NewServer(Handler(Options{
+		Path:                       "/grpc-gateway",
+		ResponseCompression:        true,
+		ResponseCompressionMinSize: 1,
+		Methods:                    map[string]MethodConfig{"/echo.EchoService/Echo": {ETag: true}},
+	}))
+	defer srv.Close()
+
+	call := func(acceptEncoding, ifNoneMatch string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/echo.EchoService/Echo", strings.NewReader(`{"message":"hi"}`))
+		req.Header.Set(targetHeader, target)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	gz, plain := call("gzip", ""), call("identity", "")
+	if gz.Header.Get("Content-Encoding") != "gzip" || plain.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("content-encoding = %q, %q", gz.Header.Get("Content-Encoding"), plain.Header.Get("Content-Encoding"))
+	}
+	if etag := gz.Header.Get("ETag"); !strings.HasPrefix(etag, `"`) || etag == plain.Header.Get("ETag") {
+		t.Fatalf("etags = %q, %q, want a strong tag per content coding", etag, plain.Header.Get("ETag"))
+	}
+	if vary := gz.Header.Values("Vary"); len(vary) != 4 || vary[0] != "Accept-Encoding" {
+		t.Fatalf("vary = %q", vary)
+	}
+	if resp := call("gzip", gz.Header.Get("ETag")); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("gzip revalidation: status=%d", resp.StatusCode)
+	}
+	if resp := call("identity", gz.Header.Get("ETag")); resp.StatusCode != http.StatusOK {
+		t.Fatalf("identity request with the gzip tag: status=%d", resp.StatusCode)
+	}
+}
+
+func TestRenameField(t *testing.T) {
+	var v any
+	_ = json.Unmarshal([]byte(`{"users":[{"displayName":"a"},{"displayName":"b"}],"page":{"nextToken":"x"}}`), &v)
+	renameField(v, []string{"users", "displayName"}, "name")
+	renameField(v, []string{"page", "nextToken"}, "next")
+	b, _ := json.Marshal(v)
+	if want := `{"page":{"next":"x"},"users":[{"name":"a"},{"name":"b"}]}`; string(b) != want {
+		t.Fatalf("got %s, want %s", b, want)
+	}
+}
+
+func TestGateway_ETagEncrypted(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+	keys := map[string][]byte{"k1": []byte("0123456789abcdef"), "k2": []byte("fedcba9876543210")}
+	srv := httptest.NewServer(Handler(Options{
+		Path:       "/grpc-gateway",
+		Methods:    map[string]MethodConfig{"/echo.EchoService/Echo": {ETag: true}},
+		Encryption: &EncryptionConfig{Keys: func(id string) ([]byte, bool) { k, ok := keys[id]; return k, ok }},
+	}))
+	defer srv.Close()
+
+	call := func(keyID, ifNoneMatch string) *http.Response {
+		t.Helper()
+		c, _ := newBodyCipher(keyID, keys[keyID])
+		sealed, _ := c.seal("request", []byte(`{"message":"hi"}`))
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/echo.EchoService/Echo", bytes.NewReader(sealed))
+		req.Header.Set(targetHeader, target)
+		req.Header.Set(encodingHeader, EncodingAESGCM)
+		req.Header.Set(encryptionKeyIDHeader, keyID)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	first := call("k1", "")
+	etag := first.Header.Get("ETag")
+	if first.StatusCode != http.StatusOK || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("status=%d etag=%q", first.StatusCode, etag)
+	}
+	// The sealed body differs every time, the tag of its plaintext does not.
+	if again := call("k1", etag); again.StatusCode != http.StatusNotModified {
+		t.Fatalf("revalidation: status=%d etag=%q", again.StatusCode, again.Header.Get("ETag"))
+	}
+	// Under another key the same plaintext gets an unrelated tag.
+	if other := call("k2", ""); other.Header.Get("ETag") == etag {
+		t.Fatalf("k2 tag = k1 tag %q", etag)
+	}
+}
+
+func TestGateway_ETagBySpelling(t *testing.T) {
+	target, stopGRPC := startTestGRPCServer(t)
+	defer stopGRPC()
+	srv := httptest.NewServer(Handler(Options{Methods: map[string]MethodConfig{"/echo.EchoService/Echo": {ETag: true}}}))
+	defer srv.Close()
+
+	for name, fields := range echoMethodSpellings(t) {
+		body := map[string]any{"target": target, "params": map[string]any{"message": "hi"}}
+		for k, v := range fields {
+			body[k] = v
+		}
+		raw, _ := json.Marshal(body)
+		resp, err := http.Post(srv.URL, "text/plain", strings.NewReader(encodeBase64V1(raw)))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == "" {
+			t.Errorf("%s: status=%d, no ETag", name, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// Route maps HTTP requests matching a pattern to a gRPC call, so the gateway can serve a REST-style API
+// facade over gRPC services, e.g. "POST /api/orders" to /orders.OrderService/CreateOrder with channel "web".
+// The request message is built as on method routes ({Path}/{package.Service}/{Method}): from the body by
+// Content-Type, or from the query parameters for GET and DELETE; path parameters and Fields then override
+// its fields. MethodConfig settings of the method apply.
+type Route struct {
+	// Pattern is an HTTP method and an absolute URL path, e.g. "GET /api/orders/{order_id}"; without a
+	// method, any method matches. {name} matches one path segment and a final {name...} the rest of the
+	// path; the (unescaped) segments are bound to the request field name, a dotted path such as {order.id},
+	// as JSON strings, which the proto3 JSON mapping accepts for string, enum and numeric fields. Route paths
+	// are matched before the gateway's own routes, so the handler must receive them, e.g. mounted at "/".
+	Pattern string
+	// Method is the full method name ("/package.Service/Method") called.
+	Method string
+	// Target is the gRPC target; empty means the X-Gateway-Target header, else Options.DefaultTarget.
+	Target string
+	// Fields maps dotted request field paths to static values in the proto3 JSON mapping, e.g.
+	// {"channel": "web"}; they take precedence over the body and path parameters.
+	Fields map[string]any
+}
+
+// routeTable matches requests against Options.Routes, in order.
+type routeTable struct {
+	routes []compiledRoute
+}
+
+type compiledRoute struct {
+	Route
+	httpMethod string
+	segments   []string // literal segments, or "{name}" / "{name...}" parameters
+}
+
+// newRouteTable compiles routes; it panics on invalid patterns, as Handler does for invalid options.
+func newRouteTable(routes []Route) *routeTable {
+	t := &routeTable{}
+	for i, route := range routes {
+		c, err := compileRoute(route)
+		if err != nil {
+			panic(fmt.Sprintf("gateway: route %d: %v", i, err))
+		}
+		t.routes = append(t.routes, c)
+	}
+	return t
+}
+
+func compileRoute(route Route) (compiledRoute, error) {
+	c := compiledRoute{Route: route}
+	path := route.Pattern
+	if method, rest, ok := strings.Cut(route.Pattern, " "); ok {
+		c.httpMethod, path = method, strings.TrimSpace(rest)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return c, fmt.Errorf("pattern %q: path must start with /", route.Pattern)
+	}
+	if _, _, err := core.ParseFullMethodName(route.Method); err != nil {
+		return c, fmt.Errorf("pattern %q: %w", route.Pattern, err)
+	}
+	c.segments = strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, seg := range c.segments {
+		if !strings.HasPrefix(seg, "{") {
+			if strings.ContainsAny(seg, "{}") {
+				return c, fmt.Errorf("pattern %q: parameters must be whole segments", route.Pattern)
+			}
+			continue
+		}
+		name, ok := strings.CutSuffix(seg, "}")
+		name = strings.TrimPrefix(name, "{")
+		if rest, isRest := strings.CutSuffix(name, "..."); isRest {
+			if i != len(c.segments)-1 {
+				return c, fmt.Errorf("pattern %q: {%s} must be the last segment", route.Pattern, name)
+			}
+			name = rest
+		}
+		if !ok || name == "" || strings.ContainsAny(name, "{}") {
+			return c, fmt.Errorf("pattern %q: invalid parameter %s", route.Pattern, seg)
+		}
+	}
+	return c, nil
+}
+
+// match returns the first route matching r, with the field bindings of its path parameters.
+func (t *routeTable) match(r *http.Request) (*compiledRoute, map[string]any, bool) {
+	path := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/"), "/")
+	for i := range t.routes {
+		c := &t.routes[i]
+		if c.httpMethod != "" && c.httpMethod != r.Method {
+			continue
+		}
+		if params, ok := c.bind(path); ok {
+			return c, params, true
+		}
+	}
+	return nil, nil, false
+}
+
+// bind matches the escaped segments of a request path, returning the bound path parameters.
+func (c *compiledRoute) bind(path []string) (map[string]any, bool) {
+	params := make(map[string]any)
+	for i, seg := range c.segments {
+		if name, ok := strings.CutPrefix(seg, "{"); ok {
+			name = strings.TrimSuffix(name, "}")
+			if rest, isRest := strings.CutSuffix(name, "..."); isRest {
+				if i >= len(path) {
+					return nil, false
+				}
+				value, err := unescapeSegments(path[i:])
+				if err != nil {
+					return nil, false
+				}
+				params[rest] = value
+				return params, true
+			}
+			if i >= len(path) || path[i] == "" {
+				return nil, false
+			}
+			value, err := unescapeSegments(path[i : i+1])
+			if err != nil {
+				return nil, false
+			}
+			params[name] = value
+			continue
+		}
+		if i >= len(path) || path[i] != seg {
+			return nil, false
+		}
+	}
+	return params, len(path) == len(c.segments)
+}
+
+func unescapeSegments(segments []string) (string, error) {
+	out := make([]string, len(segments))
+	for i, seg := range segments {
+		s, err := url.PathUnescape(seg)
+		if err != nil {
+			return "", err
+		}
+		out[i] = s
+	}
+	return strings.Join(out, "/"), nil
+}
+
+// serveRoute calls the method of route with the request message built from r and the route's bindings.
+func (h *handler) serveRoute(w http.ResponseWriter, r *http.Request, route *compiledRoute, params map[string]any) {
+	overrides := params
+	for path, v := range route.Fields {
+		overrides[path] = v
+	}
+	target := route.Target
+	if target == "" {
+		target = r.Header.Get(targetHeader)
+	}
+	h.serveMethod(w, r, route.Method, target, overrides)
+}
@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGateway_Routes(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{
+		Timeout: 5 * time.Second, Path: "/grpc-gateway", DefaultTarget: target, StrictErrors: true,
+		Routes: []Route{
+			{Pattern: "POST /api/echo", Method: "/echo.EchoService/Echo", Fields: map[string]any{"message": "web"}},
+			{Pattern: "GET /api/echo/{message}", Method: "/echo.EchoService/Echo", Target: target},
+			{Pattern: "/api/files/{message...}", Method: "/echo.EchoService/Echo"},
+			{Pattern: "GET /api/bad/{nope}", Method: "/echo.EchoService/Echo"},
+		},
+	}))
+	defer srv.Close()
+
+	cases := []struct {
+		method, path, body string
+		status             int
+		want               string
+	}{
+		// Static fields take precedence over the body.
+		{http.MethodPost, "/api/echo", `{"message":"body"}`, http.StatusOK, `{"message":"web"}`},
+		// Path parameters are unescaped, and take precedence over the query.
+		{http.MethodGet, "/api/echo/hello%20world?message=query", "", http.StatusOK, `{"message":"hello world"}`},
+		{http.MethodDelete, "/api/files/a/b%2Fc", "", http.StatusOK, `{"message":"a/b/c"}`},
+		{http.MethodGet, "/api/bad/1", "", http.StatusBadRequest, "has no field nope"},
+		// Unmatched requests fall through to the envelope endpoint, which only takes POST.
+		{http.MethodGet, "/api/echo/", "", http.StatusMethodNotAllowed, ""},
+		{http.MethodGet, "/api/echo/a/b", "", http.StatusMethodNotAllowed, ""},
+		{http.MethodPut, "/api/echo", "{}", http.StatusMethodNotAllowed, ""},
+		// The gateway's own routes are still served.
+		{http.MethodGet, "/grpc-gateway/echo.EchoService/Echo?message=hi", "", http.StatusOK, `{"message":"hi"}`},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.path, err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || !strings.Contains(string(b), tc.want) {
+			t.Fatalf("%s %s: status=%d body=%s", tc.method, tc.path, resp.StatusCode, b)
+		}
+	}
+}
+
+func TestNewRouteTable_InvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"api/echo", "GET /api/{a...}/b", "GET /api/x{id}", "GET /api/{}"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%q: no panic", pattern)
+				}
+			}()
+			newRouteTable([]Route{{Pattern: pattern, Method: "/echo.EchoService/Echo"}})
+		}()
+	}
+}
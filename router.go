@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RouteMethods are the HTTP methods the gateway serves: POST for calls and webhooks, GET for the OpenAPI
+// document, the service listing and admin reports, OPTIONS for CORS preflight.
+var RouteMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+
+// RouteConfig describes how RegisterFunc mounts the gateway on a router.
+type RouteConfig struct {
+	// Wildcard is the router's catch-all syntax appended to Options.Path for the sub-routes: "/*" (default)
+	// for chi and echo, "/*path" for gin and httprouter, "/{path...}" for the Go 1.22 ServeMux.
+	Wildcard string
+	// Methods are registered one by one, for routers that route by HTTP method; default RouteMethods.
+	// A single "" registers each pattern once for every method.
+	Methods []string
+}
+
+// RegisterFunc mounts the gateway configured by opts on any router: handle is called with each method of
+// cfg.Methods for Options.Path (default "/grpc-gateway") and for the pattern of its sub-routes, all served by
+// one handler. The handler expects the full request path, so routers must not strip the prefix. E.g.
+//
+//	gateway.RegisterFunc(opts, gateway.RouteConfig{}, func(method, pattern string, h http.Handler) {
+//		r.Method(method, pattern, h) // chi
+//	})
+//	gateway.RegisterFunc(opts, gateway.RouteConfig{Wildcard: "/*path"}, func(method, pattern string, h http.Handler) {
+//		engine.Handle(method, pattern, gin.WrapH(h)) // gin
+//	})
+//
+// For fasthttp, register fasthttpadaptor.NewFastHTTPHandler(h) for the same patterns.
+func RegisterFunc(opts Options, cfg RouteConfig, handle func(method, pattern string, h http.Handler)) {
+	if opts.Path == "" {
+		opts.Path = DefaultOptions().Path
+	}
+	wildcard := cfg.Wildcard
+	if wildcard == "" {
+		wildcard = "/*"
+	}
+	methods := cfg.Methods
+	if len(methods) == 0 {
+		methods = RouteMethods
+	}
+	h := Handler(opts)
+	base := strings.TrimSuffix(opts.Path, "/")
+	for _, method := range methods {
+		handle(method, opts.Path, h)
+		handle(method, base+"/"+strings.TrimPrefix(wildcard, "/"), h)
+	}
+}
@@ -0,0 +1,112 @@
+package gateway
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRegisterFunc_ServeMuxPatterns(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	mux := http.NewServeMux()
+	var patterns []string
+	RegisterFunc(Options{Path: "/api/grpc", DefaultTarget: target}, RouteConfig{Wildcard: "/{path...}", Methods: []string{http.MethodGet, http.MethodPost}}, func(method, pattern string, h http.Handler) {
+		patterns = append(patterns, method+" "+pattern)
+		mux.Handle(method+" "+pattern, h)
+	})
+	want := []string{"GET /api/grpc", "GET /api/grpc/{path...}", "POST /api/grpc", "POST /api/grpc/{path...}"}
+	if !reflect.DeepEqual(patterns, want) {
+		t.Fatalf("patterns = %v, want %v", patterns, want)
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL+"/api/grpc", map[string]any{"method": "/echo.EchoService/Echo", "body": map[string]any{"message": "routed"}}, nil)
+	if code != http.StatusOK || string(b) != `{"message":"routed"}` {
+		t.Fatalf("envelope: status=%d body=%s", code, b)
+	}
+
+	resp, err := http.Post(srv.URL+"/api/grpc/echo.EchoService/Echo", "application/json", strings.NewReader(`{"message":"sub-route"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	b, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(b) != `{"message":"sub-route"}` {
+		t.Fatalf("method route: status=%d body=%s", resp.StatusCode, b)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL+"/api/grpc", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("DELETE: status=%d", resp.StatusCode)
+	}
+}
+
+func TestRegister_MultiplePaths(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	mux := http.NewServeMux()
+	Register(mux,
+		Options{Path: "/internal-gateway"},
+		Options{Path: "/public-gateway", AllowedTargets: []string{"public.example.com:443"}},
+	)
+	// Registering a path again with the same Options is a no-op rather than a ServeMux conflict.
+	Register(mux, Options{Path: "/internal-gateway"})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	req := map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}
+	if code, b := postGateway(t, srv.URL+"/internal-gateway", req, nil); code != http.StatusOK {
+		t.Fatalf("internal gateway: status=%d body=%s", code, b)
+	}
+	if code, b := postGateway(t, srv.URL+"/public-gateway", req, nil); code != http.StatusForbidden {
+		t.Fatalf("public gateway: status=%d body=%s", code, b)
+	}
+	resp, err := http.Get(srv.URL + "/public-gateway/services")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("public sub-route: status=%d", resp.StatusCode)
+	}
+}
+
+func TestRegister_ConflictingOptionsPanics(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux, Options{Path: "/internal-gateway"})
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "already registered") {
+			t.Fatalf("recover() = %v, want a panic about the registered path", r)
+		}
+	}()
+	Register(mux, Options{Path: "/internal-gateway", AllowedTargets: []string{"public.example.com:443"}})
+}
+
+func TestRegister_TrailingSlashPath(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	for _, path := range []string{"/gw/", "/"} {
+		mux := http.NewServeMux()
+		Register(mux, Options{Path: path})
+		srv := httptest.NewServer(mux)
+		req := map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}
+		if code, b := postGateway(t, srv.URL+path, req, nil); code != http.StatusOK {
+			t.Errorf("%s: status=%d body=%s", path, code, b)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+)
+
+type recordingEchoServer struct {
+	pb.UnimplementedEchoServiceServer
+	seen chan string
+}
+
+func (s recordingEchoServer) Echo(_ context.Context, req *pb.EchoRequest) (*pb.EchoResponse, error) {
+	s.seen <- req.GetMessage()
+	return &pb.EchoResponse{Message: "shadow:" + req.GetMessage()}, nil
+}
+
+func TestGateway_ShadowTraffic(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	seen := make(chan string, 4)
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, recordingEchoServer{seen: seen})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	srv := httptest.NewServer(Handler(Options{Methods: map[string]MethodConfig{
+		"/echo.EchoService/Echo": {Shadow: core.ShadowConfig{Target: lis.Addr().String()}},
+	}}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+	if code != http.StatusOK || string(b) != `{"message":"hi"}` {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	select {
+	case got := <-seen:
+		if got != "hi" {
+			t.Fatalf("shadow got %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shadow target was not called")
+	}
+}
+
+func TestGateway_ShadowFailureDoesNotAffectCaller(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, failingEchoServer{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	failures := make(chan string, 1)
+	srv := httptest.NewServer(Handler(Options{Methods: map[string]MethodConfig{
+		"*": {Shadow: core.ShadowConfig{
+			Target:  lis.Addr().String(),
+			OnError: func(method string, err error) { failures <- method },
+		}},
+	}}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	select {
+	case method := <-failures:
+		if method != "/echo.EchoService/Echo" {
+			t.Fatalf("OnError method = %q", method)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shadow failure was not reported")
+	}
+}
@@ -0,0 +1,219 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// SignatureConfig requires an HMAC signature on every call (the envelope endpoint and method routes), checked
+// against the raw body before it is decoded, so only holders of a shared key can use the gateway.
+//
+// The signature is the hex-encoded HMAC of
+//
+//	{timestamp}\n{HTTP method}\n{path}\n{query}\n{target}\n{descriptor id}\n{target override}\n{encoding}\n{nonce}\n{body}
+//
+// with the secret of the key named in KeyIDHeader, where timestamp is the value of TimestampHeader (Unix
+// seconds), path the request path and query the raw query string, which carries the request message of GET and
+// DELETE calls of method routes. The next five are the values of the X-Gateway-Target, X-Gateway-Descriptor-Id,
+// X-Gateway-Target-Override and X-Gateway-Encoding headers and of NonceHeader, empty if absent, so a signed
+// call cannot be redirected or reinterpreted. Other headers are not signed. A signature is accepted once: the
+// gateway remembers the signatures it has seen within MaxSkew and rejects repeats, so clients that send the
+// same call twice within a second must vary the nonce. The memory is per gateway replica. Clients can sign with
+// WithSignature. Bidirectional streams (see Options.BidiStreaming) are refused, since their body only ends
+// once the call does.
+type SignatureConfig struct {
+	// Keys returns the secret of a key id; false rejects the request. Look-ups by id allow rotating keys.
+	Keys func(keyID string) (secret []byte, ok bool)
+	// Algorithm is "hmac-sha256" (default) or "hmac-sha512".
+	Algorithm string
+	// Header carries the signature; default X-Gateway-Signature.
+	Header string
+	// KeyIDHeader names the key; default X-Gateway-Key-Id.
+	KeyIDHeader string
+	// TimestampHeader carries the signing time; default X-Gateway-Timestamp.
+	TimestampHeader string
+	// NonceHeader carries an arbitrary value that makes otherwise identical calls differ; default
+	// X-Gateway-Nonce.
+	NonceHeader string
+	// MaxSkew rejects requests signed further than this from now, limiting replays; default 5 minutes.
+	MaxSkew time.Duration
+	// MaxBodyBytes limits the body read for verification; larger requests are rejected with 413. Default 32MiB.
+	MaxBodyBytes int64
+}
+
+// Signature algorithms of SignatureConfig.
+const (
+	SignatureHMACSHA256 = "hmac-sha256"
+	SignatureHMACSHA512 = "hmac-sha512"
+)
+
+const (
+	signatureHeader          = "X-Gateway-Signature"
+	signatureKeyIDHeader     = "X-Gateway-Key-Id"
+	signatureTimestampHeader = "X-Gateway-Timestamp"
+	signatureNonceHeader     = "X-Gateway-Nonce"
+)
+
+// signedHeaders are the fixed headers covered by the signature, before SignatureConfig.NonceHeader.
+var signedHeaders = []string{targetHeader, descriptorIDHeader, targetOverrideHeader, encodingHeader}
+
+func (c SignatureConfig) withDefaults() SignatureConfig {
+	if c.Algorithm == "" {
+		c.Algorithm = SignatureHMACSHA256
+	}
+	if c.Header == "" {
+		c.Header = signatureHeader
+	}
+	if c.KeyIDHeader == "" {
+		c.KeyIDHeader = signatureKeyIDHeader
+	}
+	if c.TimestampHeader == "" {
+		c.TimestampHeader = signatureTimestampHeader
+	}
+	if c.NonceHeader == "" {
+		c.NonceHeader = signatureNonceHeader
+	}
+	if c.MaxSkew <= 0 {
+		c.MaxSkew = 5 * time.Minute
+	}
+	if c.MaxBodyBytes <= 0 {
+		c.MaxBodyBytes = 32 << 20
+	}
+	return c
+}
+
+func signatureHash(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case SignatureHMACSHA256:
+		return sha256.New, nil
+	case SignatureHMACSHA512:
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported signature algorithm %q", algorithm)
+}
+
+// signedHeaderValues returns the values of the headers covered by the signature, in signing order.
+func signedHeaderValues(header http.Header, nonceHeader string) []string {
+	values := make([]string, 0, len(signedHeaders)+1)
+	for _, name := range signedHeaders {
+		values = append(values, header.Get(name))
+	}
+	return append(values, header.Get(nonceHeader))
+}
+
+// signRequest computes the signature of a request.
+func signRequest(newHash func() hash.Hash, secret []byte, timestamp, method, path, query string, headers []string, body []byte) []byte {
+	mac := hmac.New(newHash, secret)
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + path + "\n" + query + "\n"))
+	for _, v := range headers {
+		mac.Write([]byte(v + "\n"))
+	}
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// seenSignatures remembers accepted signatures until they fall out of the skew window, to reject replays.
+type seenSignatures struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // signature -> when it expires
+}
+
+// add records sig until expires and reports whether it was new.
+func (s *seenSignatures) add(sig string, now, expires time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, exp := range s.seen {
+		if !now.Before(exp) {
+			delete(s.seen, k)
+		}
+	}
+	if _, ok := s.seen[sig]; ok {
+		return false
+	}
+	if s.seen == nil {
+		s.seen = make(map[string]time.Time)
+	}
+	s.seen[sig] = expires
+	return true
+}
+
+// verifySignature checks the signature of r under Options.Signature, answering and returning false if it is
+// missing or invalid. The body is read and put back for decoding.
+func (h *handler) verifySignature(w http.ResponseWriter, r *http.Request) bool {
+	opts := h.live.Load().opts
+	sc := opts.Signature
+	if sc == nil {
+		return true
+	}
+	cfg := sc.withDefaults()
+	newHash, err := signatureHash(cfg.Algorithm)
+	if err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, cfg.MaxBodyBytes+1))
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "read body: "+err.Error())
+		return false
+	}
+	if int64(len(body)) > cfg.MaxBodyBytes {
+		h.writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodeInvalidRequest,
+			fmt.Sprintf("signed body exceeds %d bytes", cfg.MaxBodyBytes))
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	now := core.ClockFromContext(r.Context(), opts.Clock).Now()
+	err = cfg.verify(r, newHash, body, now)
+	// A signature stays within the skew for at most 2*MaxSkew from now; hex is case-insensitive.
+	if err == nil && !h.signatures.add(strings.ToLower(r.Header.Get(cfg.Header)), now, now.Add(2*cfg.MaxSkew)) {
+		err = errors.New("request signature already used")
+	}
+	if err != nil {
+		h.metrics.Add("gateway_signature_failures_total", 1)
+		h.writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthenticated, err.Error())
+		return false
+	}
+	return true
+}
+
+func (c SignatureConfig) verify(r *http.Request, newHash func() hash.Hash, body []byte, now time.Time) error {
+	sig, keyID, ts := r.Header.Get(c.Header), r.Header.Get(c.KeyIDHeader), r.Header.Get(c.TimestampHeader)
+	if sig == "" || keyID == "" || ts == "" {
+		return fmt.Errorf("request must be signed with %s, %s and %s headers", c.Header, c.KeyIDHeader, c.TimestampHeader)
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s", c.TimestampHeader)
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > c.MaxSkew || d < -c.MaxSkew {
+		return fmt.Errorf("%s outside the allowed clock skew", c.TimestampHeader)
+	}
+	var secret []byte
+	ok := c.Keys != nil
+	if ok {
+		secret, ok = c.Keys(keyID)
+	}
+	if !ok {
+		return fmt.Errorf("unknown signing key %q", keyID)
+	}
+	want, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(signRequest(newHash, secret, ts, r.Method, r.URL.Path, r.URL.RawQuery, signedHeaderValues(r.Header, c.NonceHeader), body), want) {
+		return errors.New("invalid request signature")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGateway_Signature(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	keys := map[string][]byte{"k1": []byte("s3cret")}
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", Signature: &SignatureConfig{
+		Keys: func(id string) ([]byte, bool) { k, ok := keys[id]; return k, ok },
+	}}))
+	defer srv.Close()
+
+	// The Go client signs its calls, with a nonce that keeps identical calls from looking like replays.
+	signed := NewClient(srv.URL+"/grpc-gateway", WithSignature("k1", keys["k1"]))
+	for i := 0; i < 2; i++ {
+		if _, err := signed.InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", json.RawMessage(`{"message":"hi"}`)); err != nil {
+			t.Fatalf("signed client call %d: %v", i, err)
+		}
+	}
+	var ce *ClientError
+	if _, err := NewClient(srv.URL+"/grpc-gateway").InvokeJSON(context.Background(), target, "/echo.EchoService/Echo", nil); !errors.As(err, &ce) || ce.StatusCode != http.StatusUnauthorized || ce.Code != ErrCodeUnauthenticated {
+		t.Fatalf("unsigned client call: %v", err)
+	}
+
+	body := `{"message":"hi"}`
+	path := "/grpc-gateway/echo.EchoService/Echo"
+	call := func(keyID string, secret []byte, signedAt time.Time, signedBody, signedTarget, nonce string) int {
+		t.Helper()
+		ts := strconv.FormatInt(signedAt.Unix(), 10)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(body))
+		req.Header.Set(targetHeader, signedTarget)
+		req.Header.Set(signatureNonceHeader, nonce)
+		sig := signRequest(sha256.New, secret, ts, http.MethodPost, path, "", signedHeaderValues(req.Header, signatureNonceHeader), []byte(signedBody))
+		req.Header.Set(targetHeader, target)
+		req.Header.Set(signatureKeyIDHeader, keyID)
+		req.Header.Set(signatureTimestampHeader, ts)
+		req.Header.Set(signatureHeader, hex.EncodeToString(sig))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	now := time.Now()
+	for _, tc := range []struct {
+		name string
+		code int
+		got  int
+	}{
+		{"valid", http.StatusOK, call("k1", keys["k1"], now, body, target, "n1")},
+		{"replayed", http.StatusUnauthorized, call("k1", keys["k1"], now, body, target, "n1")},
+		{"new nonce", http.StatusOK, call("k1", keys["k1"], now, body, target, "n2")},
+		{"unknown key", http.StatusUnauthorized, call("k2", keys["k1"], now, body, target, "n3")},
+		{"wrong secret", http.StatusUnauthorized, call("k1", []byte("guess"), now, body, target, "n4")},
+		{"tampered body", http.StatusUnauthorized, call("k1", keys["k1"], now, `{"message":"bye"}`, target, "n5")},
+		{"tampered target", http.StatusUnauthorized, call("k1", keys["k1"], now, body, "elsewhere:443", "n6")},
+		{"stale", http.StatusUnauthorized, call("k1", keys["k1"], now.Add(-10*time.Minute), body, target, "n7")},
+	} {
+		if tc.got != tc.code {
+			t.Errorf("%s: status=%d, want %d", tc.name, tc.got, tc.code)
+		}
+	}
+
+	// GET calls carry their request message in the query, which the signature covers.
+	get := func(signedQuery, query string) int {
+		t.Helper()
+		ts := strconv.FormatInt(now.Unix(), 10)
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path+"?"+query, nil)
+		req.Header.Set(targetHeader, target)
+		req.Header.Set(signatureKeyIDHeader, "k1")
+		req.Header.Set(signatureTimestampHeader, ts)
+		req.Header.Set(signatureHeader, hex.EncodeToString(signRequest(sha256.New, keys["k1"], ts, http.MethodGet, path, signedQuery, signedHeaderValues(req.Header, signatureNonceHeader), nil)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := get("message=hi", "message=hi"); code != http.StatusOK {
+		t.Errorf("signed GET: status=%d, want 200", code)
+	}
+	if code := get("message=hi", "message=bye"); code != http.StatusUnauthorized {
+		t.Errorf("GET with a changed query: status=%d, want 401", code)
+	}
+}
+
+func TestGateway_SignatureBodyLimit(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+	srv := httptest.NewServer(Handler(Options{Path: "/grpc-gateway", Signature: &SignatureConfig{
+		Keys:         func(string) ([]byte, bool) { return []byte("s3cret"), true },
+		MaxBodyBytes: 32,
+	}}))
+	defer srv.Close()
+
+	post := func(body string) int {
+		t.Helper()
+		path := "/grpc-gateway/echo.EchoService/Echo"
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(body))
+		req.Header.Set(targetHeader, target)
+		req.Header.Set(signatureKeyIDHeader, "k1")
+		req.Header.Set(signatureTimestampHeader, ts)
+		req.Header.Set(signatureHeader, hex.EncodeToString(signRequest(sha256.New, []byte("s3cret"), ts, http.MethodPost, path, "", signedHeaderValues(req.Header, signatureNonceHeader), []byte(body))))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post(`{"message":"hi"}`); code != http.StatusOK {
+		t.Errorf("small body: status=%d, want 200", code)
+	}
+	if code := post(`{"message":"` + strings.Repeat("x", 64) + `"}`); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: status=%d, want 413", code)
+	}
+}
@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc/status"
+)
+
+// logSlow reports a call of method that took elapsed, over the method's threshold, as a warning on
+// Options.Logger with the timing breakdown of diag, so the latency can be placed in the gateway (decode,
+// resolve, marshal) or the upstream (dial, invoke).
+func (h *handler) logSlow(ctx context.Context, opts Options, threshold, elapsed time.Duration, requestID, method, target string, diag *core.Diagnostics, err error) {
+	h.metrics.Add("gateway_slow_requests_total", 1, "method", method)
+	opts.logger().LogAttrs(ctx, slog.LevelWarn, "slow request",
+		slog.String("request_id", requestID),
+		slog.String("method", method),
+		slog.String("target", target),
+		slog.String("peer", diag.Peer),
+		slog.String("grpc_code", status.Code(err).String()),
+		slog.Duration("duration", elapsed),
+		slog.Duration("threshold", threshold),
+		slog.Duration("decode", diag.DecodeDuration),
+		slog.Duration("resolve", diag.ResolveDuration),
+		slog.Duration("dial", diag.DialDuration),
+		slog.Duration("invoke", diag.InvokeDuration),
+		slog.Duration("marshal", diag.MarshalDuration),
+		slog.Int("attempts", diag.Attempts),
+	)
+}
+
+// logger returns Options.Logger, or slog.Default() if it is unset.
+func (o Options) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+func TestGateway_SlowRequests(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	var logs bytes.Buffer
+	metrics := core.NewMemoryMetrics()
+	srv := httptest.NewServer(Handler(Options{
+		Path:    "/grpc-gateway",
+		Logger:  slog.New(slog.NewJSONHandler(&logs, nil)),
+		Metrics: metrics,
+		Methods: map[string]MethodConfig{
+			"/echo.EchoService/Echo": {SlowThreshold: 20 * time.Millisecond},
+		},
+		Faults: []Fault{{Method: "/echo.EchoService/Echo", Delay: 40 * time.Millisecond}},
+	}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL+"/grpc-gateway", map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, map[string]string{"X-Request-Id": "slow-1"})
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("log %q: %v", logs.String(), err)
+	}
+	if entry["level"] != "WARN" || entry["msg"] != "slow request" || entry["method"] != "/echo.EchoService/Echo" || entry["request_id"] != "slow-1" || entry["grpc_code"] != "OK" || entry["attempts"] != float64(1) {
+		t.Fatalf("log = %v", entry)
+	}
+	if d, _ := entry["duration"].(float64); d < float64(40*time.Millisecond) {
+		t.Fatalf("duration = %v", entry["duration"])
+	}
+	for _, name := range []string{"decode", "resolve", "dial", "invoke", "marshal", "threshold"} {
+		if _, ok := entry[name].(float64); !ok {
+			t.Fatalf("%s missing: %v", name, entry)
+		}
+	}
+	if got := metrics.Get("gateway_slow_requests_total", "method", "/echo.EchoService/Echo"); got != 1 {
+		t.Fatalf("gateway_slow_requests_total = %v", got)
+	}
+
+	fast := httptest.NewServer(Handler(Options{
+		Path:    "/grpc-gateway",
+		Logger:  slog.New(slog.NewJSONHandler(&logs, nil)),
+		Methods: map[string]MethodConfig{"*": {SlowThreshold: time.Minute}},
+	}))
+	defer fast.Close()
+	logs.Reset()
+	if code, _ := postGateway(t, fast.URL+"/grpc-gateway", map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil); code != http.StatusOK || logs.Len() != 0 {
+		t.Fatalf("fast call: status=%d log=%s", code, logs.String())
+	}
+}
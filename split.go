@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"hash/fnv"
+	"net/http"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// TrafficSplit routes calls across weighted targets, e.g. 95% to a v1 target and 5% to v2 for a canary rollout.
+type TrafficSplit struct {
+	Targets []WeightedTarget
+	// StickyHeader, if set, names a request header (e.g. "X-User-Id") whose value is hashed to pick the target,
+	// so a caller consistently reaches the same backend while the weights are unchanged. Requests without
+	// the header are split randomly.
+	StickyHeader string
+}
+
+// WeightedTarget is one backend of a TrafficSplit; it receives Weight out of the sum of all weights.
+type WeightedTarget struct {
+	Target string
+	Weight int
+}
+
+// pick returns the target for r, or "" if s has no target with a positive weight.
+func (s TrafficSplit) pick(r *http.Request, rnd core.Rand) string {
+	var total uint64
+	for _, t := range s.Targets {
+		if t.Weight > 0 {
+			total += uint64(t.Weight)
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+
+	var n uint64
+	if v := r.Header.Get(s.StickyHeader); s.StickyHeader != "" && v != "" {
+		hash := fnv.New64a()
+		_, _ = hash.Write([]byte(v))
+		n = hash.Sum64() % total
+	} else {
+		n = uint64(rnd.Int63()) % total
+	}
+	for _, t := range s.Targets {
+		if t.Weight <= 0 {
+			continue
+		}
+		if n < uint64(t.Weight) {
+			return t.Target
+		}
+		n -= uint64(t.Weight)
+	}
+	return ""
+}
+
+// splitTarget applies the method's traffic split, or the split of the target group named by target,
+// and returns the target to call.
+func (o Options) splitTarget(r *http.Request, rnd core.Rand, fullMethod, target string) string {
+	if t := o.methodConfig(fullMethod).Split.pick(r, rnd); t != "" {
+		return t
+	}
+	if group, ok := o.TargetGroups[target]; ok {
+		if t := group.pick(r, rnd); t != "" {
+			return t
+		}
+	}
+	return target
+}
+
+// hedgeTargets returns the targets other than chosen of the method's traffic split, or of the target group
+// named by requested, for hedged calls.
+func (o Options) hedgeTargets(fullMethod, requested, chosen string) []string {
+	split := o.methodConfig(fullMethod).Split
+	if len(split.Targets) == 0 {
+		split = o.TargetGroups[requested]
+	}
+	var out []string
+	for _, t := range split.Targets {
+		if t.Weight > 0 && t.Target != chosen {
+			out = append(out, t.Target)
+		}
+	}
+	return out
+}
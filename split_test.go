@@ -0,0 +1,72 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+type seqRand struct{ n int64 }
+
+func (r *seqRand) Int63() int64 {
+	r.n++
+	return r.n
+}
+
+func TestTrafficSplit_Weights(t *testing.T) {
+	split := TrafficSplit{Targets: []WeightedTarget{{Target: "v1", Weight: 95}, {Target: "v2", Weight: 5}, {Target: "off", Weight: 0}}}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	rnd := &seqRand{}
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[split.pick(r, rnd)]++
+	}
+	if counts["v1"] != 950 || counts["v2"] != 50 || counts["off"] != 0 {
+		t.Fatalf("counts = %v", counts)
+	}
+	if got := (TrafficSplit{}).pick(r, rnd); got != "" {
+		t.Fatalf("empty split picked %q", got)
+	}
+}
+
+func TestTrafficSplit_StickyHeader(t *testing.T) {
+	split := TrafficSplit{
+		Targets:      []WeightedTarget{{Target: "v1", Weight: 50}, {Target: "v2", Weight: 50}},
+		StickyHeader: "X-User-Id",
+	}
+	rnd := &seqRand{}
+	seen := map[string]bool{}
+	for u := 0; u < 20; u++ {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("X-User-Id", "user-"+strconv.Itoa(u))
+		first := split.pick(r, rnd)
+		for i := 0; i < 5; i++ {
+			if got := split.pick(r, rnd); got != first {
+				t.Fatalf("user-%d moved from %s to %s", u, first, got)
+			}
+		}
+		seen[first] = true
+	}
+	if !seen["v1"] || !seen["v2"] {
+		t.Fatalf("sticky hashing used only %v", seen)
+	}
+}
+
+func TestGateway_TargetGroup(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{
+		DefaultTarget: "echo",
+		TargetGroups: map[string]TrafficSplit{
+			"echo": {Targets: []WeightedTarget{{Target: target, Weight: 1}, {Target: "127.0.0.1:1", Weight: 0}}},
+		},
+	}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+	if code != http.StatusOK || string(b) != `{"message":"hi"}` {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+}
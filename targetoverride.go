@@ -0,0 +1,45 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// TargetOverrideConfig lets trusted callers redirect calls to another target with the
+// X-Gateway-Target-Override header, e.g. to a developer's branch deployment, so that a backend change can be
+// tried with the production frontend. The override replaces the target the call would have used, including
+// DefaultTarget and target splits, and is not subject to AllowedTargets.
+type TargetOverrideConfig struct {
+	// AllowIf is the rule callers must satisfy, with the variables of MethodConfig.VisibleIf rules (headers,
+	// claims and method), e.g. "'staff' in claims.roles". Calls of callers that do not satisfy it, or of
+	// any caller when it is empty or does not compile, are rejected with 403.
+	AllowIf string
+	// Targets lists the targets the header may name; entries ending in "*" match by prefix, e.g. "dev-*",
+	// and "*" allows any target. Empty allows none, so every override is rejected.
+	Targets []string
+}
+
+// targetOverride returns the target of r's X-Gateway-Target-Override header, "" if it has none, or the
+// reason (for a 403) if the caller may not override the target of method with it.
+func (h *handler) targetOverride(live *liveConfig, r *http.Request, method string) (string, error) {
+	target := r.Header.Get(targetOverrideHeader)
+	if target == "" {
+		return "", nil
+	}
+	opts := live.opts
+	oc := opts.TargetOverride
+	if oc == nil || oc.AllowIf == "" {
+		return "", errors.New("target overrides are not enabled")
+	}
+	if !live.visible.allows(opts, r, method, oc.AllowIf) {
+		h.metrics.Add("gateway_target_overrides_total", 1, "outcome", "denied")
+		return "", errors.New("target override is not allowed for this caller")
+	}
+	if !matchPattern(oc.Targets, strings.ToLower(target)) {
+		h.metrics.Add("gateway_target_overrides_total", 1, "outcome", "denied")
+		return "", errors.New("target override " + target + " is not allowed")
+	}
+	h.metrics.Add("gateway_target_overrides_total", 1, "outcome", "overridden")
+	return target, nil
+}
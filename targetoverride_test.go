@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+func TestGateway_TargetOverride(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	metrics := core.NewMemoryMetrics()
+	opts := Options{
+		Path:          "/grpc-gateway",
+		Timeout:       5 * time.Second,
+		Metrics:       metrics,
+		DefaultTarget: "127.0.0.1:1", // nothing listens
+		Claims: func(r *http.Request) (map[string]any, error) {
+			return map[string]any{"roles": strings.Split(r.Header.Get("X-Roles"), ",")}, nil
+		},
+		TargetOverride: &TargetOverrideConfig{AllowIf: "'staff' in claims.roles", Targets: []string{"127.0.0.1:*"}},
+	}
+	srv := httptest.NewServer(Handler(opts))
+	defer srv.Close()
+
+	call := func(url, roles, override string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, url+"/grpc-gateway/echo.EchoService/Echo", strings.NewReader(`{"message":"hi"}`))
+		req.Header.Set("X-Roles", roles)
+		if override != "" {
+			req.Header.Set(targetOverrideHeader, override)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("call: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := call(srv.URL, "staff", target); code != http.StatusOK {
+		t.Fatalf("staff override: status=%d", code)
+	}
+	if code := call(srv.URL, "customer", target); code != http.StatusForbidden {
+		t.Fatalf("customer override: status=%d", code)
+	}
+	if code := call(srv.URL, "staff", "payments.internal:443"); code != http.StatusForbidden {
+		t.Fatalf("override outside targets: status=%d", code)
+	}
+	if code := call(srv.URL, "staff", ""); code == http.StatusOK {
+		t.Fatal("call without override reached the override target")
+	}
+	if metrics.Get("gateway_target_overrides_total", "outcome", "overridden") != 1 ||
+		metrics.Get("gateway_target_overrides_total", "outcome", "denied") != 2 {
+		t.Fatalf("metrics = %v", metrics.Snapshot())
+	}
+
+	// Without Targets, no target may be named.
+	opts.TargetOverride = &TargetOverrideConfig{AllowIf: "'staff' in claims.roles"}
+	none := httptest.NewServer(Handler(opts))
+	defer none.Close()
+	if code := call(none.URL, "staff", target); code != http.StatusForbidden {
+		t.Fatalf("no targets: status=%d", code)
+	}
+
+	// Without TargetOverride, the header is refused rather than ignored.
+	opts.TargetOverride = nil
+	off := httptest.NewServer(Handler(opts))
+	defer off.Close()
+	if code := call(off.URL, "staff", target); code != http.StatusForbidden {
+		t.Fatalf("disabled: status=%d", code)
+	}
+}
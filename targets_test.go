@@ -0,0 +1,175 @@
+package gateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+	pb "github.com/keicoqk/gateway/example/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGateway_PerTargetDialOptions(t *testing.T) {
+	seen := make(chan metadata.MD, 4)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		seen <- md
+		return handler(ctx, req)
+	}))
+	pb.RegisterEchoServiceServer(s, echoServer{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+	target := lis.Addr().String()
+
+	srv := httptest.NewServer(Handler(Options{Targets: map[string]core.TargetConfig{
+		target: {Authority: "echo.internal", UserAgent: "edge-gateway/1", MaxRecvMsgSize: 16},
+	}}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	md := <-seen
+	if got := md.Get(":authority"); len(got) != 1 || got[0] != "echo.internal" {
+		t.Fatalf(":authority = %v", got)
+	}
+	if got := md.Get("user-agent"); len(got) != 1 || !strings.HasPrefix(got[0], "edge-gateway/1") {
+		t.Fatalf("user-agent = %v", got)
+	}
+
+	// A response larger than MaxRecvMsgSize is rejected by the client channel.
+	code, b = postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": strings.Repeat("x", 64)}}, nil)
+	<-seen
+	if code != http.StatusBadGateway || !strings.Contains(string(b), "ResourceExhausted") {
+		t.Fatalf("expected ResourceExhausted, got status=%d body=%s", code, b)
+	}
+}
+
+func TestGateway_TargetConcurrencyLimit(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	upstream := &gatedEchoServer{release: make(chan struct{})}
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, upstream)
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+	target := lis.Addr().String()
+
+	metrics := core.NewMemoryMetrics()
+	srv := httptest.NewServer(Handler(Options{
+		Metrics: metrics,
+		Targets: map[string]core.TargetConfig{"*": {MaxInFlight: 1, QueueTimeout: 50 * time.Millisecond}},
+	}))
+	defer srv.Close()
+	body := map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}
+
+	first := make(chan int, 1)
+	go func() {
+		code, _ := postGateway(t, srv.URL, body, nil)
+		first <- code
+	}()
+	for deadline := time.Now().Add(2 * time.Second); upstream.calls.Load() < 1; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("first call did not reach the upstream")
+		}
+	}
+
+	// The only slot is taken: the next call queues, times out and is rejected without reaching the upstream.
+	code, b := postGateway(t, srv.URL, body, nil)
+	if code != http.StatusServiceUnavailable || !strings.Contains(string(b), ErrCodeUnavailable) {
+		t.Fatalf("queued call: status=%d body=%s", code, b)
+	}
+	if n := upstream.calls.Load(); n != 1 {
+		t.Fatalf("upstream calls = %d", n)
+	}
+	if got := metrics.Get("gateway_upstream_queue_timeouts_total", "target", target); got != 1 {
+		t.Fatalf("queue timeouts = %v", got)
+	}
+
+	close(upstream.release)
+	if code := <-first; code != http.StatusOK {
+		t.Fatalf("first call: status=%d", code)
+	}
+	if code, b := postGateway(t, srv.URL, body, nil); code != http.StatusOK {
+		t.Fatalf("after release: status=%d body=%s", code, b)
+	}
+}
+
+func TestGateway_ClientInterceptors(t *testing.T) {
+	seen := make(chan metadata.MD, 1)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		seen <- md
+		return handler(ctx, req)
+	}))
+	pb.RegisterEchoServiceServer(s, echoServer{})
+	go func() { _ = s.Serve(lis) }()
+	defer s.Stop()
+
+	var order []string
+	tag := func(name string) grpc.UnaryClientInterceptor {
+		return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			info := core.CallInfoFromContext(ctx)
+			order = append(order, name+" "+method+" "+info.Method.GetName()+"@"+info.Target)
+			return invoker(metadata.AppendToOutgoingContext(ctx, "x-intercepted-by", name), method, req, reply, cc, opts...)
+		}
+	}
+	srv := httptest.NewServer(Handler(Options{UnaryInterceptors: []grpc.UnaryClientInterceptor{tag("auth"), tag("tracing")}}))
+	defer srv.Close()
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": lis.Addr().String(), "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+	if got := (<-seen).Get("x-intercepted-by"); strings.Join(got, ",") != "auth,tracing" {
+		t.Fatalf("x-intercepted-by = %v", got)
+	}
+	call := "/echo.EchoService/Echo Echo@" + lis.Addr().String()
+	if strings.Join(order, ",") != "auth "+call+",tracing "+call {
+		t.Fatalf("order = %v", order)
+	}
+}
+
+func TestGateway_TargetWaitForReady(t *testing.T) {
+	// Reserve an address, then start serving on it only after the call has been made.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	target := lis.Addr().String()
+	_ = lis.Close()
+
+	srv := httptest.NewServer(Handler(Options{Timeout: 5 * time.Second, Targets: map[string]core.TargetConfig{target: {WaitForReady: true}}}))
+	defer srv.Close()
+
+	s := grpc.NewServer()
+	pb.RegisterEchoServiceServer(s, echoServer{})
+	defer s.Stop()
+	time.AfterFunc(200*time.Millisecond, func() {
+		if lis, err := net.Listen("tcp", target); err == nil {
+			_ = s.Serve(lis)
+		}
+	})
+
+	code, b := postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", code, b)
+	}
+}
@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/keicoqk/gateway/core"
+	"google.golang.org/grpc"
+)
+
+// TenantConfig is a virtual gateway in Options.Tenants. Each tenant has its own descriptor cache, quota usage
+// and async workers, and its metrics carry a "tenant" label; zero fields inherit the shared Options.
+type TenantConfig struct {
+	// DefaultTarget replaces Options.DefaultTarget.
+	DefaultTarget string
+	// AllowedTargets replaces Options.AllowedTargets.
+	AllowedTargets []string
+	// AdminToken and DescriptorWriteToken replace the shared tokens, so one tenant's operators cannot
+	// administer another tenant.
+	AdminToken           string
+	DescriptorWriteToken string
+	// Claims replaces Options.Claims, e.g. to verify tokens against the tenant's own issuer.
+	Claims func(r *http.Request) (map[string]any, error)
+	// Methods replaces Options.Methods as a whole (entries are not merged).
+	Methods map[string]MethodConfig
+	// Quota replaces Options.Quota. Either way usage is accounted per tenant.
+	Quota *QuotaConfig
+	// Async runs the tenant's async workers. It is not inherited: a queue shared between tenants would let
+	// one tenant's workers run another tenant's calls.
+	Async *AsyncConfig
+}
+
+// tenantOptions returns the Options of tenant name's virtual gateway.
+func (o Options) tenantOptions(name string) Options {
+	tc := o.Tenants[name]
+	opts := o
+	opts.Tenants = nil
+	if o.TenantHeader == "" {
+		opts.Path = strings.TrimSuffix(o.Path, "/") + "/" + name
+	}
+	if tc.DefaultTarget != "" {
+		opts.DefaultTarget = tc.DefaultTarget
+	}
+	if tc.AllowedTargets != nil {
+		opts.AllowedTargets = tc.AllowedTargets
+	}
+	if tc.AdminToken != "" {
+		opts.AdminToken = tc.AdminToken
+	}
+	if tc.DescriptorWriteToken != "" {
+		opts.DescriptorWriteToken = tc.DescriptorWriteToken
+	}
+	if tc.Claims != nil {
+		opts.Claims = tc.Claims
+	}
+	if tc.Methods != nil {
+		opts.Methods = tc.Methods
+	}
+	if tc.Quota != nil {
+		opts.Quota = tc.Quota
+	}
+	opts.Async = tc.Async
+	if o.Metrics != nil {
+		opts.Metrics = labeledMetrics{Metrics: o.Metrics, label: "tenant", value: name}
+	}
+	if o.Reload != nil {
+		opts.Reload = func() (Options, error) {
+			next, err := o.Reload()
+			if err != nil {
+				return Options{}, err
+			}
+			if _, ok := next.Tenants[name]; !ok {
+				return Options{}, fmt.Errorf("tenant %s is not in the new configuration", name)
+			}
+			return next.tenantOptions(name), nil
+		}
+	}
+	return opts
+}
+
+// labeledMetrics labels every metric of a tenant's or API version's gateway with its name.
+type labeledMetrics struct {
+	core.Metrics
+	label, value string
+}
+
+func (m labeledMetrics) Add(name string, delta float64, labels ...string) {
+	m.Metrics.Add(name, delta, append(labels, m.label, m.value)...)
+}
+
+func (m labeledMetrics) Set(name string, value float64, labels ...string) {
+	m.Metrics.Set(name, value, append(labels, m.label, m.value)...)
+}
+
+// tenantRouter serves Options.Tenants: it selects the tenant of each request and passes the request to that
+// tenant's handler.
+type tenantRouter struct {
+	opts    Options
+	shared  *handler // renders errors for requests that select no tenant
+	tenants map[string]*handler
+}
+
+func newTenantRouter(opts Options) *tenantRouter {
+	if opts.LocalServer == nil && opts.LocalServices != nil {
+		// One local server for all tenants, rather than one per tenant.
+		opts.LocalServer = grpc.NewServer()
+		opts.LocalServices(opts.LocalServer)
+	}
+	if len(opts.PreloadDescriptors) > 0 {
+		opts.preloadedSets = mustLoadDescriptorSources("preload descriptors", opts.PreloadDescriptors)
+	}
+	if len(opts.BaseDescriptors) > 0 {
+		opts.baseSets = mustLoadDescriptorSources("base descriptors", opts.BaseDescriptors)
+	}
+	t := &tenantRouter{opts: opts, shared: &handler{opts: opts}, tenants: make(map[string]*handler, len(opts.Tenants))}
+	for name := range opts.Tenants {
+		t.tenants[name] = newHandler(opts.tenantOptions(name), name)
+	}
+	return t
+}
+
+// ServeHTTP selects the tenant from Options.TenantHeader or, without one, from the first path segment below
+// Options.Path. Requests naming no tenant get 400 and requests naming an unknown one 404.
+func (t *tenantRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var name string
+	if t.opts.TenantHeader != "" {
+		name = r.Header.Get(t.opts.TenantHeader)
+	} else {
+		base := strings.TrimSuffix(t.opts.Path, "/")
+		if rel, ok := strings.CutPrefix(r.URL.Path, base+"/"); ok {
+			name, _, _ = strings.Cut(rel, "/")
+		}
+	}
+	if h, ok := t.tenants[name]; ok {
+		h.ServeHTTP(w, r)
+		return
+	}
+	// The CORS headers let browsers read the error; preflights carry no tenant header and are answered here.
+	if t.opts.CORS != nil && t.opts.CORS.handleCORS(w, r, t.shared.writeError) {
+		return
+	}
+	if name == "" {
+		where := "header " + t.opts.TenantHeader
+		if t.opts.TenantHeader == "" {
+			where = "path"
+		}
+		t.shared.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "missing tenant in "+where)
+		return
+	}
+	t.shared.writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "unknown tenant "+name)
+}
@@ -0,0 +1,95 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+func TestGateway_TenantsByPath(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	metrics := core.NewMemoryMetrics()
+	srv := httptest.NewServer(Handler(Options{
+		Path:    "/grpc-gateway",
+		Metrics: metrics,
+		Quota:   &QuotaConfig{Limits: []QuotaLimit{{Name: "minute", Window: time.Minute, MaxCalls: 1}}},
+		Tenants: map[string]TenantConfig{
+			"payments": {},
+			"search":   {AllowedTargets: []string{"search-*"}},
+		},
+	}))
+	defer srv.Close()
+
+	call := func(path string) int {
+		code, _ := postGateway(t, srv.URL+path, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "hi"}}, nil)
+		return code
+	}
+	if code := call("/grpc-gateway/payments"); code != http.StatusOK {
+		t.Fatalf("payments: status=%d", code)
+	}
+	if code := call("/grpc-gateway/search"); code != http.StatusForbidden {
+		t.Fatalf("search: status=%d, want 403 for a target outside its allowlist", code)
+	}
+	if code := call("/grpc-gateway/other"); code != http.StatusNotFound {
+		t.Fatalf("unknown tenant: status=%d", code)
+	}
+	if code := call("/grpc-gateway"); code != http.StatusBadRequest {
+		t.Fatalf("no tenant: status=%d", code)
+	}
+
+	// Quota usage is per tenant and rejections are labelled with it.
+	if code := call("/grpc-gateway/payments"); code != http.StatusTooManyRequests {
+		t.Fatalf("payments over quota: status=%d", code)
+	}
+	if got := metrics.Get("gateway_quota_rejections_total", "limit", "minute", "tenant", "payments"); got != 1 {
+		t.Fatalf("rejections for payments = %v, metrics %v", got, metrics.Snapshot())
+	}
+}
+
+func TestGateway_TenantsByHeaderIsolateDescriptors(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{
+		Path:         "/grpc-gateway",
+		TenantHeader: "X-Tenant",
+		Tenants: map[string]TenantConfig{
+			"a": {DescriptorWriteToken: "a-token"},
+			"b": {},
+		},
+		// Leave out the directory, whose embedded echo set would otherwise answer unknown descriptor_ids.
+		DescriptorLayers: []core.DescriptorLayer{core.LayerCache, core.LayerRegistry},
+	}))
+	defer srv.Close()
+
+	upload := map[string]any{
+		"target":        target,
+		"method":        "/echo.EchoService/Echo",
+		"descriptor":    base64.StdEncoding.EncodeToString(mustReadDescriptor(t)),
+		"descriptor_id": "echo",
+		"params":        map[string]any{"message": "hi"},
+	}
+	if code, body := postGateway(t, srv.URL+"/grpc-gateway", upload, map[string]string{"X-Tenant": "a"}); code != http.StatusForbidden {
+		t.Fatalf("upload without the tenant's token: status=%d body=%s", code, body)
+	}
+	if code, body := postGateway(t, srv.URL+"/grpc-gateway", upload, map[string]string{"X-Tenant": "a", descriptorTokenHeader: "a-token"}); code != http.StatusOK {
+		t.Fatalf("upload: status=%d body=%s", code, body)
+	}
+
+	lookup := map[string]any{"target": target, "method": "/echo.EchoService/Echo", "descriptor_id": "echo", "params": map[string]any{"message": "hi"}}
+	if code, body := postGateway(t, srv.URL+"/grpc-gateway", lookup, map[string]string{"X-Tenant": "a"}); code != http.StatusOK {
+		t.Fatalf("lookup in a: status=%d body=%s", code, body)
+	}
+	if code, _ := postGateway(t, srv.URL+"/grpc-gateway", lookup, map[string]string{"X-Tenant": "b"}); code == http.StatusOK {
+		t.Fatal("tenant b resolved tenant a's descriptor_id")
+	}
+	if code, _ := postGateway(t, srv.URL+"/grpc-gateway", lookup, nil); code != http.StatusBadRequest {
+		t.Fatalf("missing tenant header: status=%d", code)
+	}
+}
@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+func TestGateway_UnknownFieldPolicies(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	call := func(opts Options) (int, string, errorResponse) {
+		opts.Path = "/grpc-gateway"
+		srv := httptest.NewServer(Handler(opts))
+		defer srv.Close()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/echo.EchoService/Echo", strings.NewReader(`{"message":"hi","bogus":1,"extra":{"x":true}}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(targetHeader, target)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("do: %v", err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		var e errorResponse
+		_ = json.Unmarshal(b, &e)
+		return resp.StatusCode, resp.Header.Get(unknownFieldsHeader), e
+	}
+
+	if code, _, e := call(Options{}); code != http.StatusBadRequest || e.Code != ErrCodeInvalidRequest || !strings.Contains(e.Error, "bogus, extra") {
+		t.Fatalf("reject: status=%d error=%+v", code, e)
+	}
+	if code, header, _ := call(Options{UnknownFields: core.UnknownFieldsDrop}); code != http.StatusOK || header != "" {
+		t.Fatalf("drop: status=%d header=%q", code, header)
+	}
+	if code, header, _ := call(Options{UnknownFields: core.UnknownFieldsWarn}); code != http.StatusOK || header != "bogus, extra" {
+		t.Fatalf("warn: status=%d header=%q", code, header)
+	}
+	strict := Options{
+		UnknownFields: core.UnknownFieldsDrop,
+		Methods:       map[string]MethodConfig{"/echo.EchoService/Echo": {UnknownFields: core.UnknownFieldsReject}},
+	}
+	if code, _, _ := call(strict); code != http.StatusBadRequest {
+		t.Fatalf("per-method reject: status=%d", code)
+	}
+}
@@ -0,0 +1,119 @@
+package gateway
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+// APIVersion is a version of the API in Options.Versions, served below {Path}/{version} with descriptors,
+// targets and method settings of its own, so that e.g. /v1 and /v2 can serve incompatible revisions of the
+// same services side by side. Each version has its own descriptor cache, quota usage and admin routes, and
+// its metrics carry a "version" label; zero fields inherit the shared Options.
+type APIVersion struct {
+	// DefaultTarget replaces Options.DefaultTarget, e.g. the deployment serving this version.
+	DefaultTarget string
+	// AllowedTargets replaces Options.AllowedTargets.
+	AllowedTargets []string
+	// DescriptorFS and PreloadDescriptors replace the shared ones, for the descriptors of this version.
+	DescriptorFS       fs.FS
+	PreloadDescriptors []DescriptorSource
+	// Methods replaces Options.Methods as a whole (entries are not merged).
+	Methods map[string]MethodConfig
+	// Deprecation deprecates every method of the version that has no MethodConfig.Deprecation of its own:
+	// calls get the deprecation headers, are reported to Options.OnDeprecatedCall and, with
+	// RejectAfterSunset, are refused with 410 after the sunset.
+	Deprecation *Deprecation
+}
+
+// versionOptions returns the Options of API version name's gateway.
+func (o Options) versionOptions(name string) Options {
+	vc := o.Versions[name]
+	opts := o
+	opts.Versions = nil
+	opts.Path = strings.TrimSuffix(o.Path, "/") + "/" + name
+	opts.version = name
+	opts.versionDeprecation = vc.Deprecation
+	if vc.DefaultTarget != "" {
+		opts.DefaultTarget = vc.DefaultTarget
+	}
+	if vc.AllowedTargets != nil {
+		opts.AllowedTargets = vc.AllowedTargets
+	}
+	if vc.DescriptorFS != nil {
+		opts.DescriptorFS = vc.DescriptorFS
+	}
+	if vc.PreloadDescriptors != nil {
+		opts.PreloadDescriptors, opts.preloadedSets = vc.PreloadDescriptors, nil
+	}
+	if vc.Methods != nil {
+		opts.Methods = vc.Methods
+	}
+	// Like tenants, versions do not share the async queue.
+	opts.Async = nil
+	if o.Metrics != nil {
+		opts.Metrics = labeledMetrics{Metrics: o.Metrics, label: "version", value: name}
+	}
+	if o.Reload != nil {
+		opts.Reload = func() (Options, error) {
+			next, err := o.Reload()
+			if err != nil {
+				return Options{}, err
+			}
+			if _, ok := next.Versions[name]; !ok {
+				return Options{}, fmt.Errorf("API version %s is not in the new configuration", name)
+			}
+			return next.versionOptions(name), nil
+		}
+	}
+	return opts
+}
+
+// apiVersionHeader selects the API version of GatewayService calls (see RegisterGatewayService), which have
+// no path to carry it.
+const apiVersionHeader = "X-Gateway-Api-Version"
+
+// versionRouter serves Options.Versions: it passes requests below {Path}/{version} to that version's
+// gateway, and all others to the unversioned gateway of the shared Options.
+type versionRouter struct {
+	opts        Options
+	unversioned *handler
+	versions    map[string]*handler
+}
+
+func newVersionRouter(opts Options) *versionRouter {
+	if opts.LocalServer == nil && opts.LocalServices != nil {
+		// One local server for all versions, rather than one per version.
+		opts.LocalServer = grpc.NewServer()
+		opts.LocalServices(opts.LocalServer)
+	}
+	if len(opts.PreloadDescriptors) > 0 {
+		opts.preloadedSets = mustLoadDescriptorSources("preload descriptors", opts.PreloadDescriptors)
+	}
+	if len(opts.BaseDescriptors) > 0 {
+		opts.baseSets = mustLoadDescriptorSources("base descriptors", opts.BaseDescriptors)
+	}
+	unversioned := opts
+	unversioned.Versions = nil
+	v := &versionRouter{opts: opts, unversioned: newHandler(unversioned, ""), versions: make(map[string]*handler, len(opts.Versions))}
+	for name := range opts.Versions {
+		v.versions[name] = newHandler(opts.versionOptions(name), "")
+	}
+	return v
+}
+
+// ServeHTTP selects the version from the first path segment below Options.Path.
+func (v *versionRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	base := strings.TrimSuffix(v.opts.Path, "/")
+	if rel, ok := strings.CutPrefix(r.URL.Path, base+"/"); ok {
+		name, _, _ := strings.Cut(rel, "/")
+		if h, ok := v.versions[name]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+	}
+	v.unversioned.ServeHTTP(w, r)
+}
@@ -0,0 +1,73 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+func TestGateway_Versions(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	clock := core.NewFakeClock(time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC))
+	metrics := core.NewMemoryMetrics()
+	var calls []DeprecatedCall
+	srv := httptest.NewServer(Handler(Options{
+		Path:          "/grpc-gateway",
+		Clock:         clock,
+		Metrics:       metrics,
+		StrictErrors:  true,
+		DefaultTarget: "127.0.0.1:1", // nothing listens
+		Versions: map[string]APIVersion{
+			"v1": {DefaultTarget: target, Deprecation: &Deprecation{
+				Sunset:            time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC),
+				RejectAfterSunset: true,
+			}},
+			"v2": {DefaultTarget: target},
+		},
+		OnDeprecatedCall: func(r *http.Request, call DeprecatedCall) { calls = append(calls, call) },
+	}))
+	defer srv.Close()
+
+	call := func(path string) *http.Response {
+		t.Helper()
+		resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(`{"message":"hi"}`))
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := call("/grpc-gateway/v2/echo.EchoService/Echo"); resp.StatusCode != http.StatusOK || resp.Header.Get("Deprecation") != "" {
+		t.Fatalf("v2: status=%d headers=%v", resp.StatusCode, resp.Header)
+	}
+	resp := call("/grpc-gateway/v1/echo.EchoService/Echo")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Deprecation") != "true" || resp.Header.Get("Sunset") != "Tue, 30 Jun 2026 00:00:00 GMT" {
+		t.Fatalf("v1: status=%d headers=%v", resp.StatusCode, resp.Header)
+	}
+	if len(calls) != 1 || calls[0].Version != "v1" || calls[0].Method != "/echo.EchoService/Echo" {
+		t.Fatalf("calls = %+v", calls)
+	}
+	if got := metrics.Get("gateway_deprecated_calls_total", "method", "/echo.EchoService/Echo", "outcome", "served", "version", "v1"); got != 1 {
+		t.Fatalf("deprecated calls = %v, metrics %v", got, metrics.Snapshot())
+	}
+
+	// Requests below no version prefix use the shared settings, here an unreachable default target.
+	if resp := call("/grpc-gateway/echo.EchoService/Echo"); resp.StatusCode == http.StatusOK {
+		t.Fatal("unversioned call reached a version's target")
+	}
+
+	clock.Advance(30 * 24 * time.Hour)
+	if resp := call("/grpc-gateway/v1/echo.EchoService/Echo"); resp.StatusCode != http.StatusGone {
+		t.Fatalf("v1 after sunset: status=%d", resp.StatusCode)
+	}
+	if resp := call("/grpc-gateway/v2/echo.EchoService/Echo"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("v2 after v1's sunset: status=%d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,165 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/keicoqk/gateway/core"
+)
+
+// visibilityEnv declares the variables available to field visibility rules (MethodConfig.VisibleIf, the
+// gateway.visible_if field option and PIIPolicy.TrustedIf) and to TargetOverrideConfig.AllowIf.
+func visibilityEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("method", cel.StringType),
+		cel.CrossTypeNumericComparisons(true),
+	)
+}
+
+// fieldVisibility evaluates field visibility rules. The rules of MethodConfig.VisibleIf are compiled in
+// Handler; those of visible_if options only turn up with the descriptors of resolved methods, so programs are
+// compiled on first use and cached by rule.
+type fieldVisibility struct {
+	env      *cel.Env
+	envErr   error
+	programs sync.Map         // rule -> cel.Program or error
+	errs     map[string]error // by Options.Methods key; "" for PIIPolicy.TrustedIf, the header for TargetOverride
+}
+
+func newFieldVisibility(opts Options) *fieldVisibility {
+	v := &fieldVisibility{errs: make(map[string]error)}
+	v.env, v.envErr = visibilityEnv()
+	if opts.PII != nil && opts.PII.TrustedIf != "" {
+		if _, err := v.program(opts.PII.TrustedIf); err != nil {
+			v.errs[""] = fmt.Errorf("PII trusted_if rule: %w", err)
+		}
+	}
+	if opts.TargetOverride != nil && opts.TargetOverride.AllowIf != "" {
+		if _, err := v.program(opts.TargetOverride.AllowIf); err != nil {
+			v.errs[targetOverrideHeader] = fmt.Errorf("target override allow_if rule: %w", err)
+		}
+	}
+	for name, mc := range opts.Methods {
+		for path, rule := range mc.VisibleIf {
+			if _, err := v.program(rule); err != nil {
+				v.errs[name] = fmt.Errorf("visibility rule for %s field %s: %w", name, path, err)
+				break
+			}
+		}
+	}
+	return v
+}
+
+// program returns the compiled rule.
+func (v *fieldVisibility) program(rule string) (cel.Program, error) {
+	if p, ok := v.programs.Load(rule); ok {
+		if err, ok := p.(error); ok {
+			return nil, err
+		}
+		return p.(cel.Program), nil
+	}
+	prg, err := v.compile(rule)
+	if err != nil {
+		v.programs.Store(rule, err)
+		return nil, err
+	}
+	v.programs.Store(rule, prg)
+	return prg, nil
+}
+
+func (v *fieldVisibility) compile(rule string) (cel.Program, error) {
+	if v.envErr != nil {
+		return nil, v.envErr
+	}
+	ast, iss := v.env.Compile(rule)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if t := ast.OutputType(); !t.IsExactType(cel.BoolType) && !t.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("must evaluate to bool, not %s", t)
+	}
+	return v.env.Program(ast)
+}
+
+// forRequest returns the core.InvokeRequest.FieldVisibility for r: the rules of method's VisibleIf, of
+// visible_if options and PIIPolicy.TrustedIf for PII fields, each evaluated at most once against r's
+// headers, the caller's claims and method. method must be the resolved name (see Invoker.ResolveMethod):
+// rules picked by the request's spelling of it would be skipped by spelling it differently.
+// Rules fail closed: a rule that does not compile or cannot be evaluated (e.g. a missing claim, or Claims
+// failing) hides its fields.
+func (v *fieldVisibility) forRequest(opts Options, r *http.Request, method string) *core.FieldVisibility {
+	var (
+		mu      sync.Mutex
+		vars    map[string]any
+		results = make(map[string]bool)
+	)
+	visible := func(rule string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if ok, done := results[rule]; done {
+			return ok
+		}
+		if vars == nil {
+			vars = visibilityVars(opts, r, method)
+		}
+		ok := false
+		if prg, err := v.program(rule); err == nil {
+			if out, _, err := prg.Eval(vars); err == nil {
+				ok, _ = out.Value().(bool)
+			}
+		}
+		results[rule] = ok
+		return ok
+	}
+	mc := opts.methodConfig(method)
+	fv := &core.FieldVisibility{Rules: mc.VisibleIf, Visible: visible}
+	if opts.PII != nil && opts.PII.TrustedIf != "" {
+		fv.PIIRule = opts.PII.TrustedIf
+		fv.Rules = make(map[string]string, len(mc.VisibleIf)+len(mc.PII))
+		for path, rule := range mc.VisibleIf {
+			fv.Rules[path] = rule
+		}
+		for _, path := range mc.PII {
+			if rule, ok := fv.Rules[path]; ok {
+				fv.Rules[path] = "(" + rule + ") && (" + opts.PII.TrustedIf + ")"
+				continue
+			}
+			fv.Rules[path] = opts.PII.TrustedIf
+		}
+	}
+	return fv
+}
+
+// allows reports whether rule holds for r, failing closed like forRequest.
+func (v *fieldVisibility) allows(opts Options, r *http.Request, method, rule string) bool {
+	prg, err := v.program(rule)
+	if err != nil {
+		return false
+	}
+	out, _, err := prg.Eval(visibilityVars(opts, r, method))
+	if err != nil {
+		return false
+	}
+	ok, _ := out.Value().(bool)
+	return ok
+}
+
+// visibilityVars returns the variables of visibility rules for r.
+func visibilityVars(opts Options, r *http.Request, method string) map[string]any {
+	claims := map[string]any{}
+	if opts.Claims != nil {
+		if c, err := opts.Claims(r); err == nil && c != nil {
+			claims = c
+		}
+	}
+	headers := make(map[string]string, len(r.Header))
+	for k, vs := range r.Header {
+		headers[strings.ToLower(k)] = strings.Join(vs, ", ")
+	}
+	return map[string]any{"headers": headers, "claims": claims, "method": method}
+}
@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGateway_FieldVisibility(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{
+		Methods: map[string]MethodConfig{
+			"/echo.EchoService/Echo": {VisibleIf: map[string]string{"message": `"admin" in claims.roles`}},
+		},
+		Claims: func(r *http.Request) (map[string]any, error) {
+			role := r.Header.Get("X-Test-Role")
+			if role == "" {
+				return nil, errors.New("no token")
+			}
+			return map[string]any{"roles": []any{role}}, nil
+		},
+	}))
+	defer srv.Close()
+
+	call := func(role string) (int, []byte) {
+		var headers map[string]string
+		if role != "" {
+			headers = map[string]string{"X-Test-Role": role}
+		}
+		return postGateway(t, srv.URL, map[string]any{"target": target, "method": "/echo.EchoService/Echo", "body": map[string]any{"message": "secret"}}, headers)
+	}
+
+	if code, b := call("admin"); code != http.StatusOK || !strings.Contains(string(b), `"message":"secret"`) {
+		t.Fatalf("admin: status=%d body=%s", code, b)
+	}
+	if code, b := call("viewer"); code != http.StatusOK || strings.Contains(string(b), "secret") {
+		t.Fatalf("viewer: status=%d body=%s", code, b)
+	}
+	// Without claims the rule cannot be evaluated and the field stays hidden.
+	if code, b := call(""); code != http.StatusOK || strings.Contains(string(b), "secret") {
+		t.Fatalf("anonymous: status=%d body=%s", code, b)
+	}
+	// The rules follow the called method, not the request's spelling of it.
+	for name, fields := range echoMethodSpellings(t) {
+		body := map[string]any{"target": target, "params": map[string]any{"message": "secret"}}
+		for k, v := range fields {
+			body[k] = v
+		}
+		if code, b := postGateway(t, srv.URL, body, map[string]string{"X-Test-Role": "viewer"}); code != http.StatusOK || strings.Contains(string(b), "secret") {
+			t.Errorf("viewer, %s: status=%d body=%s", name, code, b)
+		}
+	}
+}
+
+func TestLiveConfig_VisibilityRuleCompileError(t *testing.T) {
+	live := newLiveConfig(Options{Methods: map[string]MethodConfig{
+		"/a.B/C": {VisibleIf: map[string]string{"email": `claims.roles +`}},
+	}})
+	if err := live.err(); err == nil || !strings.Contains(err.Error(), "visibility rule for /a.B/C field email") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+// WebhookRoute maps third-party webhook deliveries, served at POST {Path}/webhooks/{name}, to a gRPC call.
+type WebhookRoute struct {
+	// Method is the full method name ("/package.Service/Method") called for each delivery.
+	Method string
+	// Target is the gRPC target; empty means Options.DefaultTarget.
+	Target string
+	// Template renders the JSON request message from the delivery; empty passes a JSON body through as is.
+	// It sees .Body (the parsed JSON body, or the form values of a form-encoded body, single values as
+	// strings), .Raw (the body as a string), .Headers and .Query (first value per name), and the json function,
+	// e.g. {"event_id":{{json .Body.id}},"kind":{{json .Body.type}}}.
+	Template string
+	// Verify, if set, authenticates the delivery before it is mapped, e.g. GitHubSignature or StripeSignature;
+	// a failure is answered with 401.
+	Verify WebhookVerifier
+}
+
+// WebhookVerifier checks the signature of a webhook delivery against its raw body.
+type WebhookVerifier func(r *http.Request, body []byte) error
+
+// HMACSignature verifies a hex-encoded HMAC-SHA256 of the body in header, after stripping prefix
+// (e.g. "sha256=").
+func HMACSignature(header, prefix, secret string) WebhookVerifier {
+	return func(r *http.Request, body []byte) error {
+		sig := r.Header.Get(header)
+		if sig == "" || !strings.HasPrefix(sig, prefix) {
+			return fmt.Errorf("missing %s signature", header)
+		}
+		if !hmacEqual(secret, body, strings.TrimPrefix(sig, prefix)) {
+			return fmt.Errorf("invalid %s signature", header)
+		}
+		return nil
+	}
+}
+
+// GitHubSignature verifies GitHub's X-Hub-Signature-256 header.
+func GitHubSignature(secret string) WebhookVerifier {
+	return HMACSignature("X-Hub-Signature-256", "sha256=", secret)
+}
+
+// StripeSignature verifies Stripe's Stripe-Signature header ("t=<unix>,v1=<hex>,..."), rejecting deliveries
+// whose timestamp is more than tolerance away from now (default 5 minutes) to prevent replays.
+func StripeSignature(secret string, tolerance time.Duration, clock core.Clock) WebhookVerifier {
+	if tolerance <= 0 {
+		tolerance = 5 * time.Minute
+	}
+	return func(r *http.Request, body []byte) error {
+		var ts string
+		var sigs []string
+		for _, part := range strings.Split(r.Header.Get("Stripe-Signature"), ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch k {
+			case "t":
+				ts = v
+			case "v1":
+				sigs = append(sigs, v)
+			}
+		}
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil || len(sigs) == 0 {
+			return errors.New("missing Stripe-Signature")
+		}
+		now := core.ClockFromContext(r.Context(), clock).Now()
+		if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+			return errors.New("Stripe-Signature timestamp outside tolerance")
+		}
+		signed := append([]byte(ts+"."), body...)
+		for _, sig := range sigs {
+			if hmacEqual(secret, signed, sig) {
+				return nil
+			}
+		}
+		return errors.New("invalid Stripe-Signature")
+	}
+}
+
+func hmacEqual(secret string, msg []byte, hexSig string) bool {
+	want, err := hex.DecodeString(hexSig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(msg)
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// webhookData is the value WebhookRoute templates are executed with.
+type webhookData struct {
+	Body    any
+	Raw     string
+	Headers map[string]string
+	Query   map[string]string
+}
+
+// webhookRoutes holds the parsed templates of Options.Webhooks. Handler panics if one fails to parse (see err);
+// a route whose template failed still rejects every delivery.
+type webhookRoutes struct {
+	tmpls map[string]*template.Template
+	errs  map[string]error
+}
+
+func newWebhookRoutes(opts Options) *webhookRoutes {
+	wr := &webhookRoutes{tmpls: make(map[string]*template.Template), errs: make(map[string]error)}
+	for name, route := range opts.Webhooks {
+		if route.Template == "" {
+			continue
+		}
+		tmpl, err := template.New(name).Funcs(envelopeFuncs).Parse(route.Template)
+		if err != nil {
+			wr.errs[name] = fmt.Errorf("webhook template for %s: %w", name, err)
+			continue
+		}
+		wr.tmpls[name] = tmpl
+	}
+	return wr
+}
+
+// err reports the templates that fail to parse.
+func (wr *webhookRoutes) err() error {
+	return joinSorted(wr.errs)
+}
+
+// serveWebhook handles POST {Path}/webhooks/{name}.
+func (h *handler) serveWebhook(w http.ResponseWriter, r *http.Request, name string) {
+	route, ok := h.opts.Webhooks[name]
+	if !ok {
+		h.rejectRoute(w, r, "")
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.rejectRoute(w, r, http.MethodPost)
+		return
+	}
+	if err := h.webhooks.errs[name]; err != nil {
+		h.writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "read body: "+err.Error())
+		return
+	}
+	if route.Verify != nil {
+		if err := route.Verify(r, raw); err != nil {
+			h.writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthenticated, "webhook: "+err.Error())
+			return
+		}
+	}
+
+	body := raw
+	if tmpl := h.webhooks.tmpls[name]; tmpl != nil {
+		data, err := newWebhookData(r, raw)
+		if err != nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "webhook: "+err.Error())
+			return
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "webhook template: "+err.Error())
+			return
+		}
+		body = buf.Bytes()
+	}
+	if !json.Valid(body) {
+		h.writeError(w, r, http.StatusBadRequest, ErrCodeInvalidRequest, "webhook "+name+" did not produce a JSON request message")
+		return
+	}
+	h.serve(w, r, &gatewayRequest{Target: route.Target, Method: route.Method, Body: body})
+}
+
+func newWebhookData(r *http.Request, raw []byte) (webhookData, error) {
+	data := webhookData{Raw: string(raw), Headers: make(map[string]string), Query: make(map[string]string)}
+	for k, vs := range r.Header {
+		data.Headers[k] = vs[0]
+	}
+	for k, vs := range r.URL.Query() {
+		data.Query[k] = vs[0]
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(raw))
+		if err != nil {
+			return data, fmt.Errorf("parse form body: %w", err)
+		}
+		form := make(map[string]any, len(values))
+		for k, vs := range values {
+			if len(vs) == 1 {
+				form[k] = vs[0]
+			} else {
+				form[k] = vs
+			}
+		}
+		data.Body = form
+	case len(bytes.TrimSpace(raw)) > 0 && json.Valid(raw):
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&data.Body); err != nil {
+			return data, fmt.Errorf("parse JSON body: %w", err)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/keicoqk/gateway/core"
+)
+
+func sign(secret, msg string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGateway_WebhookRoutes(t *testing.T) {
+	target, stop := startTestGRPCServer(t)
+	defer stop()
+
+	srv := httptest.NewServer(Handler(Options{
+		Path:          "/grpc-gateway",
+		DefaultTarget: target,
+		Webhooks: map[string]WebhookRoute{
+			"github": {
+				Method:   "/echo.EchoService/Echo",
+				Template: `{"message":{{json (printf "%s %s" (index .Headers "X-Github-Event") .Body.action)}}}`,
+				Verify:   GitHubSignature("gh-secret"),
+			},
+			"form": {
+				Method:   "/echo.EchoService/Echo",
+				Template: `{"message":{{json .Body.text}}}`,
+			},
+		},
+	}))
+	defer srv.Close()
+
+	post := func(route, contentType, body string, headers map[string]string) (int, string) {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/grpc-gateway/webhooks/"+route, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post %s: %v", route, err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	payload := `{"action":"opened","number":7}`
+	code, b := post("github", "application/json", payload, map[string]string{
+		"X-Hub-Signature-256": "sha256=" + sign("gh-secret", payload),
+		"X-Github-Event":      "pull_request",
+	})
+	if code != http.StatusOK || b != `{"message":"pull_request opened"}` {
+		t.Fatalf("github: status=%d body=%s", code, b)
+	}
+
+	code, b = post("github", "application/json", payload, map[string]string{"X-Hub-Signature-256": "sha256=" + sign("wrong", payload)})
+	if code != http.StatusUnauthorized || !strings.Contains(b, `"code":"unauthenticated"`) {
+		t.Fatalf("bad signature: status=%d body=%s", code, b)
+	}
+
+	code, b = post("form", "application/x-www-form-urlencoded", "text=hello+world&user=u1", nil)
+	if code != http.StatusOK || b != `{"message":"hello world"}` {
+		t.Fatalf("form: status=%d body=%s", code, b)
+	}
+
+	code, _ = post("unknown", "application/json", "{}", nil)
+	if code != http.StatusNotFound {
+		t.Fatalf("unknown route: status=%d", code)
+	}
+}
+
+func TestHandler_InvalidWebhookTemplate(t *testing.T) {
+	defer func() {
+		if r, ok := recover().(string); !ok || !strings.Contains(r, "webhook template for orders") {
+			t.Fatalf("recover() = %v, want the template parse error", r)
+		}
+	}()
+	Handler(Options{Webhooks: map[string]WebhookRoute{"orders": {Method: "/echo.EchoService/Echo", Template: "{{.Body"}}})
+}
+
+func TestStripeSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	verify := StripeSignature("whsec", 0, core.NewFakeClock(now))
+	body := `{"id":"evt_1"}`
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Stripe-Signature", "t="+ts+",v1=deadbeef,v1="+sign("whsec", ts+"."+body))
+	if err := verify(req, []byte(body)); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+
+	old := strconv.FormatInt(now.Add(-time.Hour).Unix(), 10)
+	req.Header.Set("Stripe-Signature", "t="+old+",v1="+sign("whsec", old+"."+body))
+	if err := verify(req, []byte(body)); err == nil {
+		t.Fatal("stale signature accepted")
+	}
+}